@@ -108,8 +108,8 @@ main() {
     echo ""
     echo "📝 Next steps:"
     echo "1. Build and deploy updated checkoutservice:"
-    echo "   cd src/checkoutservice"
-    echo "   docker build -t gcr.io/${PROJECT_ID}/checkoutservice-orders:latest ."
+    echo "   cd src"
+    echo "   docker build -f checkoutservice/Dockerfile -t gcr.io/${PROJECT_ID}/checkoutservice-orders:latest ."
     echo "   docker push gcr.io/${PROJECT_ID}/checkoutservice-orders:latest"
     echo ""
     echo "2. Deploy with: kubectl apply -k kubernetes-manifests/"
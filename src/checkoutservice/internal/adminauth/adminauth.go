@@ -0,0 +1,72 @@
+// Package adminauth restricts the administrative RPCs of the checkout
+// service, such as changing order status, to callers presenting the admin
+// token. Other RPCs are not affected.
+package adminauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Config holds the bearer token admin callers present in the
+// "authorization" metadata, as "Bearer <token>".
+type Config struct {
+	Token string
+}
+
+// FromEnv builds a Config from CHECKOUT_ADMIN_TOKEN, or returns nil when it
+// is unset and every admin RPC is refused.
+func FromEnv() (*Config, error) {
+	t := os.Getenv("CHECKOUT_ADMIN_TOKEN")
+	if t == "" {
+		return nil, nil
+	}
+	return &Config{Token: t}, nil
+}
+
+// Authorize checks that ctx carries c's token. It returns UNAUTHENTICATED
+// without a bearer token and PERMISSION_DENIED for a wrong one, or for any
+// token when c is nil.
+func (c *Config) Authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, v := range md.Get("authorization") {
+		if t, ok := strings.CutPrefix(v, "Bearer "); ok {
+			token = strings.TrimSpace(t)
+		}
+	}
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "admin RPCs need an admin bearer token")
+	}
+	if c == nil {
+		return status.Error(codes.PermissionDenied, "admin RPCs are disabled: CHECKOUT_ADMIN_TOKEN is not set")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) != 1 {
+		return status.Error(codes.PermissionDenied, "invalid admin token")
+	}
+	return nil
+}
+
+// UnaryServerInterceptor authorizes calls of the given full method names,
+// such as "/hipstershop.CheckoutService/UpdateOrderStatus", with Authorize.
+func (c *Config) UnaryServerInterceptor(methods ...string) grpc.UnaryServerInterceptor {
+	admin := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		admin[m] = true
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if admin[info.FullMethod] {
+			if err := c.Authorize(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
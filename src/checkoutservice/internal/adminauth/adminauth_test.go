@@ -0,0 +1,51 @@
+package adminauth
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	for _, tt := range []struct {
+		name   string
+		config *Config
+		method string
+		ctx    context.Context
+		want   codes.Code
+	}{
+		{"other method", &Config{Token: "s3cret"}, "/svc/GetOrder", context.Background(), codes.OK},
+		{"admin token", &Config{Token: "s3cret"}, "/svc/UpdateOrderStatus", withToken("s3cret"), codes.OK},
+		{"no token", &Config{Token: "s3cret"}, "/svc/UpdateOrderStatus", context.Background(), codes.Unauthenticated},
+		{"wrong token", &Config{Token: "s3cret"}, "/svc/UpdateOrderStatus", withToken("guess"), codes.PermissionDenied},
+		{"not configured", nil, "/svc/UpdateOrderStatus", withToken("s3cret"), codes.PermissionDenied},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			intercept := tt.config.UnaryServerInterceptor("/svc/UpdateOrderStatus")
+			_, err := intercept(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.want {
+				t.Errorf("interceptor = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CHECKOUT_ADMIN_TOKEN", "")
+	if c, err := FromEnv(); c != nil || err != nil {
+		t.Errorf("FromEnv without a token = %v, %v, want nil", c, err)
+	}
+	t.Setenv("CHECKOUT_ADMIN_TOKEN", "s3cret")
+	if c, err := FromEnv(); err != nil || c.Token != "s3cret" {
+		t.Errorf("FromEnv = %v, %v", c, err)
+	}
+}
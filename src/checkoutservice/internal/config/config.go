@@ -0,0 +1,192 @@
+// Package config loads and validates the checkout service's configuration
+// from the environment in one place, so a misconfigured pod fails at
+// startup with every problem listed.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/adminauth"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/confirmations"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/discounts"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/emailclaims"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/faultinjection"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/fraud"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/grpcopts"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/orderbuffer"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/orderevents"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/startup"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/tax"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/webhooks"
+)
+
+const (
+	defaultPort        = "5050"
+	defaultMetricsPort = "9090"
+
+	// defaultReservationTimeout is how long an order may stay pending, which
+	// is far longer than PlaceOrder takes.
+	defaultReservationTimeout = 15 * time.Minute
+)
+
+// Services holds the addresses of the services checkout calls.
+type Services struct {
+	Shipping       string
+	ProductCatalog string
+	Cart           string
+	Currency       string
+	Email          string
+	Payment        string
+}
+
+// Config is the checkout service's configuration.
+type Config struct {
+	Port string
+	// MetricsPort is where /metrics is served; "0" turns it off.
+	MetricsPort string
+	Services    Services
+
+	// CollectorAddr is where traces are exported; it is set when Tracing is.
+	Tracing       bool
+	CollectorAddr string
+	Profiling     bool
+
+	GRPC          grpcopts.Config
+	Faults        *faultinjection.Injector
+	StartupWindow time.Duration
+	Database      *database.Config
+	// OrderEvents is nil when order events are not published.
+	OrderEvents *orderevents.Config
+	// Confirmations configures sending queued order confirmation emails.
+	Confirmations *confirmations.Config
+	// Webhooks is nil when no webhook endpoints are configured.
+	Webhooks *webhooks.Config
+	// OrderBuffer is nil when orders are not buffered while the database is
+	// unavailable.
+	OrderBuffer *orderbuffer.Config
+	// Discounts is nil when no discount codes are configured.
+	Discounts *discounts.Config
+	// Tax calculates the tax on orders; tax.None when no rates are configured.
+	Tax tax.Calculator
+	// Fraud is nil when orders are not screened for fraud.
+	Fraud *fraud.Config
+	// EmailClaims is nil when guest orders can't be claimed.
+	EmailClaims *emailclaims.Config
+	// Admin is nil when every admin RPC is refused.
+	Admin *adminauth.Config
+	// ReservationTimeout is how long an order may stay pending before it is
+	// dropped, so that it can be placed again.
+	ReservationTimeout time.Duration
+	// CatalogAdminToken is the product catalog's admin token, which recording
+	// purchases there needs; purchases are not recorded when it is empty.
+	CatalogAdminToken string
+}
+
+// Load reads the Config from the environment. The error joins every setting
+// that is missing or invalid. Orders are persisted in Cloud SQL, so
+// CLOUDSQL_HOST is required; PROJECT_ID has no default.
+func Load() (*Config, error) {
+	c := &Config{
+		Port:          defaultPort,
+		MetricsPort:   defaultMetricsPort,
+		Tracing:       os.Getenv("ENABLE_TRACING") == "1",
+		CollectorAddr: os.Getenv("COLLECTOR_SERVICE_ADDR"),
+		Profiling:     os.Getenv("ENABLE_PROFILER") == "1",
+
+		ReservationTimeout: defaultReservationTimeout,
+		CatalogAdminToken:  os.Getenv("CATALOG_ADMIN_TOKEN"),
+	}
+	if p := os.Getenv("PORT"); p != "" {
+		c.Port = p
+	}
+	if p := os.Getenv("METRICS_PORT"); p != "" {
+		c.MetricsPort = p
+	}
+
+	var errs []error
+	for _, s := range []struct {
+		env    string
+		target *string
+	}{
+		{"SHIPPING_SERVICE_ADDR", &c.Services.Shipping},
+		{"PRODUCT_CATALOG_SERVICE_ADDR", &c.Services.ProductCatalog},
+		{"CART_SERVICE_ADDR", &c.Services.Cart},
+		{"CURRENCY_SERVICE_ADDR", &c.Services.Currency},
+		{"EMAIL_SERVICE_ADDR", &c.Services.Email},
+		{"PAYMENT_SERVICE_ADDR", &c.Services.Payment},
+	} {
+		if *s.target = os.Getenv(s.env); *s.target == "" {
+			errs = append(errs, fmt.Errorf("%s is required", s.env))
+		}
+	}
+	if n, err := strconv.Atoi(c.MetricsPort); err != nil || n < 0 || n > 65535 {
+		errs = append(errs, fmt.Errorf("failed to parse METRICS_PORT (%s) as a port number", c.MetricsPort))
+	}
+	if c.Tracing && c.CollectorAddr == "" {
+		errs = append(errs, errors.New("ENABLE_TRACING=1 needs COLLECTOR_SERVICE_ADDR"))
+	}
+
+	if s := os.Getenv("ORDER_RESERVATION_TIMEOUT"); s != "" {
+		if d, err := time.ParseDuration(s); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("failed to parse ORDER_RESERVATION_TIMEOUT (%s) as a positive time.Duration", s))
+		} else {
+			c.ReservationTimeout = d
+		}
+	}
+
+	var err error
+	if c.GRPC, err = grpcopts.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Faults, err = faultinjection.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.StartupWindow, err = startup.WindowFromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.OrderEvents, err = orderevents.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Confirmations, err = confirmations.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Webhooks, err = webhooks.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.OrderBuffer, err = orderbuffer.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Discounts, err = discounts.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Tax, err = tax.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Fraud, err = fraud.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.EmailClaims, err = emailclaims.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Admin, err = adminauth.FromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Database, err = database.LoadConfig(); err != nil {
+		errs = append(errs, err)
+	} else if c.Database.Host == "" {
+		errs = append(errs, errors.New("CLOUDSQL_HOST is required: orders are stored in Cloud SQL"))
+	} else {
+		c.Database.SkipPublish = c.OrderEvents == nil
+		c.Database.SkipWebhooks = c.Webhooks == nil
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return c, nil
+}
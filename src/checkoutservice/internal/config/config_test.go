@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequired sets every variable Load requires.
+func setRequired(t *testing.T) {
+	t.Helper()
+	for k, v := range map[string]string{
+		"SHIPPING_SERVICE_ADDR":        "shippingservice:50051",
+		"PRODUCT_CATALOG_SERVICE_ADDR": "productcatalogservice:3550",
+		"CART_SERVICE_ADDR":            "cartservice:7070",
+		"CURRENCY_SERVICE_ADDR":        "currencyservice:7000",
+		"EMAIL_SERVICE_ADDR":           "emailservice:5000",
+		"PAYMENT_SERVICE_ADDR":         "paymentservice:50051",
+		"CLOUDSQL_HOST":                "10.0.0.1",
+		"PROJECT_ID":                   "shop",
+		"ALLOYDB_DATABASE_NAME":        "orders",
+		"ALLOYDB_SECRET_NAME":          "orders-password",
+	} {
+		t.Setenv(k, v)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	setRequired(t)
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != "5050" || c.MetricsPort != "9090" || c.OrderBuffer != nil || c.Tax == nil || c.Services.Cart != "cartservice:7070" || c.Database.Host != "10.0.0.1" || c.Tracing {
+		t.Errorf("Load = %+v", c)
+	}
+	if c.CatalogAdminToken != "" {
+		t.Errorf("CatalogAdminToken = %q without CATALOG_ADMIN_TOKEN", c.CatalogAdminToken)
+	}
+	if c.ReservationTimeout != 15*time.Minute {
+		t.Errorf("ReservationTimeout = %v without ORDER_RESERVATION_TIMEOUT, want 15m", c.ReservationTimeout)
+	}
+	if !c.Database.SkipPublish || !c.Database.SkipWebhooks {
+		t.Error("Expected order events to skip Pub/Sub and webhooks without ORDER_EVENTS_TOPIC and WEBHOOK_ENDPOINTS")
+	}
+
+	t.Setenv("PORT", "8080")
+	t.Setenv("ENABLE_TRACING", "1")
+	t.Setenv("COLLECTOR_SERVICE_ADDR", "opentelemetrycollector:4317")
+	t.Setenv("CATALOG_ADMIN_TOKEN", "catalog-token")
+	t.Setenv("ORDER_BUFFER_DIR", "/var/lib/checkout/order-buffer")
+	if c, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.OrderBuffer == nil || c.OrderBuffer.Dir != "/var/lib/checkout/order-buffer" {
+		t.Errorf("OrderBuffer = %+v with ORDER_BUFFER_DIR set", c.OrderBuffer)
+	}
+	if c.Port != "8080" || !c.Tracing || c.CollectorAddr != "opentelemetrycollector:4317" || c.CatalogAdminToken != "catalog-token" {
+		t.Errorf("Load = %+v", c)
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	setRequired(t)
+	t.Setenv("CART_SERVICE_ADDR", "")
+	t.Setenv("PROJECT_ID", "")
+	t.Setenv("ENABLE_TRACING", "1")
+	t.Setenv("STARTUP_WAIT_TIMEOUT", "forever")
+	t.Setenv("FAULT_ERROR_RATE", "2")
+	t.Setenv("METRICS_PORT", "http")
+	t.Setenv("ORDER_BUFFER_MAX_ORDERS", "many")
+	t.Setenv("DISCOUNT_CODES", "HALF=fifty")
+	t.Setenv("TAX_RATES", "Germany")
+	t.Setenv("FRAUD_CHECKS", "geoip")
+	t.Setenv("ORDER_RESERVATION_TIMEOUT", "-1m")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load succeeded, want error")
+	}
+	for _, want := range []string{"CART_SERVICE_ADDR", "CLOUDSQL_HOST needs PROJECT_ID", "COLLECTOR_SERVICE_ADDR", "STARTUP_WAIT_TIMEOUT", "FAULT_ERROR_RATE", "METRICS_PORT", "ORDER_BUFFER_MAX_ORDERS", "DISCOUNT_CODES", "TAX_RATES", "FRAUD_CHECKS", "ORDER_RESERVATION_TIMEOUT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadRequiresDatabase(t *testing.T) {
+	setRequired(t)
+	t.Setenv("CLOUDSQL_HOST", "")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "CLOUDSQL_HOST is required") {
+		t.Errorf("Load without CLOUDSQL_HOST = %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package confirmations sends the order confirmation emails queued in the
+// order_confirmations table through the email service, retrying those that
+// fail.
+package confirmations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/delivery"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// sendTimeout bounds one call to the email service.
+const sendTimeout = 10 * time.Second
+
+// Config holds the confirmation email settings.
+type Config struct {
+	delivery.Schedule
+}
+
+// FromEnv builds a Config from the environment:
+//
+//	CONFIRMATION_EMAIL_INTERVAL      how often the queue is checked (default 5s)
+//	CONFIRMATION_EMAIL_BATCH_SIZE    emails sent per queue check, at most 100 (default 10)
+//	CONFIRMATION_EMAIL_MAX_ATTEMPTS  attempts before an email is marked failed (default 5)
+//	CONFIRMATION_EMAIL_BACKOFF       delay after the first failed attempt (default 30s)
+func FromEnv() (*Config, error) {
+	s, err := delivery.ScheduleFromEnv("CONFIRMATION_EMAIL",
+		delivery.Schedule{Interval: 5 * time.Second, BatchSize: 10, MaxAttempts: 5, Backoff: 30 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Config{Schedule: s}, nil
+}
+
+// Queue holds the confirmation emails waiting to be sent.
+type Queue interface {
+	DeliverConfirmations(ctx context.Context, limit int, lease time.Duration, deliver func(models.Confirmation) error, retryIn func(attempts int) (time.Duration, bool)) (int, error)
+}
+
+// SendFunc sends the confirmation email of order to email.
+type SendFunc func(ctx context.Context, email string, order *pb.OrderResult) error
+
+// Sender moves emails from a Queue to the email service. Delivery is at
+// least once: an email that was sent but could not be marked sent is sent
+// again.
+type Sender struct {
+	config *Config
+	send   SendFunc
+	log    *logrus.Logger
+}
+
+// NewSender returns a Sender for config, which must not be nil, that sends
+// emails with send.
+func NewSender(config *Config, send SendFunc, log *logrus.Logger) *Sender {
+	return &Sender{config: config, send: send, log: log}
+}
+
+// Run sends the queue's due emails every interval until ctx is done.
+func (s *Sender) Run(ctx context.Context, queue Queue) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Drain(ctx, queue); err != nil {
+			s.log.Warnf("failed to send order confirmations: %v", err)
+		}
+	}
+}
+
+// Drain sends batches of due emails until the queue has no more.
+func (s *Sender) Drain(ctx context.Context, queue Queue) error {
+	for {
+		tried := 0
+		sent, err := queue.DeliverConfirmations(ctx, s.config.BatchSize, s.lease(), func(c models.Confirmation) error {
+			tried++
+			return s.deliver(ctx, c)
+		}, s.config.RetryIn)
+		if err != nil {
+			return err
+		}
+		if sent > 0 {
+			s.log.Infof("sent %d order confirmations", sent)
+		}
+		if tried < s.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// lease returns how long a batch of emails is claimed for: long enough to
+// send all of them, each bounded by sendTimeout, with a minute to spare.
+func (s *Sender) lease() time.Duration {
+	return time.Duration(s.config.BatchSize)*sendTimeout + time.Minute
+}
+
+// deliver sends one queued email.
+func (s *Sender) deliver(ctx context.Context, c models.Confirmation) error {
+	var order pb.OrderResult
+	if err := protojson.Unmarshal(c.Order, &order); err != nil {
+		return fmt.Errorf("failed to decode order %s: %v", c.OrderID, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return s.send(ctx, c.Email, &order)
+}
@@ -0,0 +1,178 @@
+package confirmations
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/delivery"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestFromEnv(t *testing.T) {
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Interval != 5*time.Second || c.BatchSize != 10 || c.MaxAttempts != 5 || c.Backoff != 30*time.Second {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+
+	t.Setenv("CONFIRMATION_EMAIL_INTERVAL", "1s")
+	t.Setenv("CONFIRMATION_EMAIL_BATCH_SIZE", "50")
+	t.Setenv("CONFIRMATION_EMAIL_MAX_ATTEMPTS", "3")
+	t.Setenv("CONFIRMATION_EMAIL_BACKOFF", "1m")
+	if c, err = FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Interval != time.Second || c.BatchSize != 50 || c.MaxAttempts != 3 || c.Backoff != time.Minute {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+
+	for env, value := range map[string]string{
+		"CONFIRMATION_EMAIL_INTERVAL":     "soon",
+		"CONFIRMATION_EMAIL_BATCH_SIZE":   "101",
+		"CONFIRMATION_EMAIL_MAX_ATTEMPTS": "0",
+		"CONFIRMATION_EMAIL_BACKOFF":      "-1s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("FromEnv() error = %v, want one naming %s", err, env)
+			}
+		})
+	}
+}
+
+func TestRetryIn(t *testing.T) {
+	c := &Config{Schedule: delivery.Schedule{MaxAttempts: 10, Backoff: 10 * time.Minute}}
+	for attempts, want := range map[int]time.Duration{
+		1: 10 * time.Minute,
+		2: 20 * time.Minute,
+		3: 40 * time.Minute,
+		4: time.Hour,
+		9: time.Hour,
+	} {
+		if got, ok := c.RetryIn(attempts); !ok || got != want {
+			t.Errorf("RetryIn(%d) = %v, %v; want %v, true", attempts, got, ok, want)
+		}
+	}
+	if _, ok := c.RetryIn(10); ok {
+		t.Error("Expected no retry after MaxAttempts")
+	}
+}
+
+// setupQueue returns a mock database holding the given orders, each with a
+// queued confirmation.
+func setupQueue(t *testing.T, logger *logrus.Logger, orderIDs ...string) *database.MockConnection {
+	t.Helper()
+	db := database.NewMockConnection(logger)
+	for _, id := range orderIDs {
+		if err := db.SaveOrder(context.Background(), &models.Order{OrderID: id, UserID: "user-1"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		result, err := protojson.Marshal(&pb.OrderResult{OrderId: id, ShippingTrackingId: "TRACK-" + id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.EnqueueConfirmation(context.Background(), id, id+"@example.com", result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func confirmationStatus(t *testing.T, db *database.MockConnection, orderID string) string {
+	t.Helper()
+	order, err := db.GetOrderByID(context.Background(), orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order.ConfirmationStatus
+}
+
+func TestDrain(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	db := setupQueue(t, logger, "order-1", "order-2", "order-3")
+
+	sent := make(map[string]string)
+	s := NewSender(&Config{Schedule: delivery.Schedule{Interval: time.Second, BatchSize: 2, MaxAttempts: 3, Backoff: time.Minute}},
+		func(ctx context.Context, email string, order *pb.OrderResult) error {
+			if order.GetOrderId() == "order-2" {
+				return errors.New("email service unavailable")
+			}
+			sent[email] = order.GetShippingTrackingId()
+			return nil
+		}, logger)
+	if err := s.Drain(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 2 || sent["order-1@example.com"] != "TRACK-order-1" || sent["order-3@example.com"] != "TRACK-order-3" {
+		t.Errorf("Unexpected emails sent: %v", sent)
+	}
+	for id, want := range map[string]string{
+		"order-1": models.ConfirmationSent,
+		"order-2": models.ConfirmationPending,
+		"order-3": models.ConfirmationSent,
+	} {
+		if got := confirmationStatus(t, db, id); got != want {
+			t.Errorf("Order %s confirmation is %q, want %q", id, got, want)
+		}
+	}
+
+	// The failed email waits for its backoff before it is tried again.
+	if err := s.Drain(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 {
+		t.Errorf("Expected no more emails before the backoff, got %v", sent)
+	}
+}
+
+func TestDrainMarksFailedAfterMaxAttempts(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	db := setupQueue(t, logger, "order-1")
+
+	attempts := 0
+	s := NewSender(&Config{Schedule: delivery.Schedule{Interval: time.Second, BatchSize: 10, MaxAttempts: 3, Backoff: time.Nanosecond}},
+		func(context.Context, string, *pb.OrderResult) error {
+			attempts++
+			return errors.New("mailbox full")
+		}, logger)
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Millisecond)
+		if err := s.Drain(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if got := confirmationStatus(t, db, "order-1"); got != models.ConfirmationFailed {
+		t.Errorf("Expected the confirmation to fail for good, got %q", got)
+	}
+}
+
+func TestDrainReportsQueueErrors(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	db := database.NewMockConnection(logger)
+	db.SetShouldError(true)
+
+	s := NewSender(&Config{Schedule: delivery.Schedule{Interval: time.Second, BatchSize: 10, MaxAttempts: 3, Backoff: time.Minute}},
+		func(context.Context, string, *pb.OrderResult) error { return nil }, logger)
+	if err := s.Drain(context.Background(), db); err == nil {
+		t.Error("Expected the queue error")
+	}
+}
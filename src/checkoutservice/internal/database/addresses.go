@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+// ErrAddressNotFound is returned for an unknown address ID or the address of
+// another user.
+var ErrAddressNotFound error = &classifiedError{class: ErrNotFound, err: errors.New("address not found")}
+
+const (
+	// SQL queries for saved addresses
+
+	// A user's first address is the default whether asked for or not.
+	insertAddressSQL = `
+	INSERT INTO addresses (address_id, user_id, street_address, city, state, country, zip_code, is_default)
+	VALUES ($1, $2, $3, $4, $5, $6, $7,
+		$8 OR NOT EXISTS (SELECT 1 FROM addresses WHERE user_id = $2 AND is_default))
+	RETURNING is_default, created_at`
+
+	clearDefaultAddressSQL = `
+	UPDATE addresses SET is_default = FALSE WHERE user_id = $1 AND is_default`
+
+	setDefaultAddressSQL = `
+	UPDATE addresses SET is_default = TRUE
+	WHERE address_id = $1 AND user_id = $2
+	RETURNING address_id, user_id, street_address, city, state, country, zip_code, is_default, created_at`
+
+	getAddressesSQL = `
+	SELECT address_id, user_id, street_address, city, state, country, zip_code, is_default, created_at
+	FROM addresses
+	WHERE user_id = $1
+	ORDER BY is_default DESC, created_at DESC, address_id`
+
+	getAddressSQL = `
+	SELECT address_id, user_id, street_address, city, state, country, zip_code, is_default, created_at
+	FROM addresses
+	WHERE address_id = $1 AND user_id = $2`
+
+	deleteAddressSQL = `
+	DELETE FROM addresses WHERE address_id = $1 AND user_id = $2 RETURNING is_default`
+
+	// promoteNewestAddressSQL makes the newest remaining address of a user
+	// the default, after the default was deleted.
+	promoteNewestAddressSQL = `
+	UPDATE addresses SET is_default = TRUE
+	WHERE address_id = (
+		SELECT address_id FROM addresses WHERE user_id = $1
+		ORDER BY created_at DESC, address_id LIMIT 1
+	)`
+)
+
+// AddAddress saves an address to a user's address book and fills in its
+// creation time. If addr.IsDefault is set, the address replaces the user's
+// default; a user's first address becomes the default regardless.
+func (c *Connection) AddAddress(ctx context.Context, addr *models.SavedAddress) error {
+	if c.DB == nil {
+		return errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	if addr.IsDefault {
+		if _, err := tx.ExecContext(ctx, clearDefaultAddressSQL, addr.UserID); err != nil {
+			return fmt.Errorf("failed to clear default address: %w", classify(err))
+		}
+	}
+	err = tx.QueryRowContext(ctx, insertAddressSQL,
+		addr.AddressID,
+		addr.UserID,
+		addr.StreetAddress,
+		addr.City,
+		addr.State,
+		addr.Country,
+		addr.ZipCode,
+		addr.IsDefault,
+	).Scan(&addr.IsDefault, &addr.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert address: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit address: %w", classify(err))
+	}
+	return nil
+}
+
+// ListAddresses retrieves a user's saved addresses, the default first and
+// then newest first.
+func (c *Connection) ListAddresses(ctx context.Context, userID string) ([]models.SavedAddress, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	rows, err := c.readDB().QueryContext(ctx, getAddressesSQL, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query addresses: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var addrs []models.SavedAddress
+	for rows.Next() {
+		addr, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	return addrs, nil
+}
+
+// GetAddress retrieves one of a user's saved addresses. It returns
+// ErrAddressNotFound for an unknown address or one of another user.
+func (c *Connection) GetAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	addr, err := scanAddress(c.readDB().QueryRowContext(ctx, getAddressSQL, addressID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &addr, nil
+}
+
+// DeleteAddress deletes one of a user's saved addresses. If it was the
+// default, the newest remaining address becomes the default. Orders shipped
+// to it lose the link to it. It returns ErrAddressNotFound for an unknown
+// address or one of another user.
+func (c *Connection) DeleteAddress(ctx context.Context, userID, addressID string) error {
+	if c.DB == nil {
+		return errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var wasDefault bool
+	err = tx.QueryRowContext(ctx, deleteAddressSQL, addressID, userID).Scan(&wasDefault)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAddressNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete address: %w", classify(err))
+	}
+	if wasDefault {
+		if _, err := tx.ExecContext(ctx, promoteNewestAddressSQL, userID); err != nil {
+			return fmt.Errorf("failed to set default address: %w", classify(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit address deletion: %w", classify(err))
+	}
+	return nil
+}
+
+// SetDefaultAddress makes one of a user's saved addresses the default and
+// returns it. It returns ErrAddressNotFound for an unknown address or one of
+// another user.
+func (c *Connection) SetDefaultAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, clearDefaultAddressSQL, userID); err != nil {
+		return nil, fmt.Errorf("failed to clear default address: %w", classify(err))
+	}
+	addr, err := scanAddress(tx.QueryRowContext(ctx, setDefaultAddressSQL, addressID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit default address: %w", classify(err))
+	}
+	return &addr, nil
+}
+
+// scanAddress reads the addresses columns selected by the address queries.
+func scanAddress(row interface{ Scan(...any) error }) (models.SavedAddress, error) {
+	var addr models.SavedAddress
+	err := row.Scan(
+		&addr.AddressID,
+		&addr.UserID,
+		&addr.StreetAddress,
+		&addr.City,
+		&addr.State,
+		&addr.Country,
+		&addr.ZipCode,
+		&addr.IsDefault,
+		&addr.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return addr, err
+	}
+	if err != nil {
+		return addr, fmt.Errorf("failed to scan address: %w", classify(err))
+	}
+	return addr, nil
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+const (
+	// SQL queries for the order confirmation email queue
+
+	insertConfirmationSQL = `
+	INSERT INTO order_confirmations (order_id, email, order_result, status)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (order_id) DO NOTHING`
+
+	setOrderConfirmationStatusSQL = `
+	UPDATE order_history SET confirmation_status = $2 WHERE order_id = $1`
+
+	// claimDueConfirmationsSQL leases due confirmations by moving their next
+	// attempt to the end of the lease, so other replicas don't send them
+	// meanwhile, and they are due again if this one stops before recording
+	// the outcome. Confirmations being claimed by another replica are
+	// skipped.
+	claimDueConfirmationsSQL = `
+	WITH due AS (
+		SELECT order_id, next_attempt_at FROM order_confirmations
+		WHERE status = $1 AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	), claimed AS (
+		UPDATE order_confirmations c SET next_attempt_at = NOW() + $3::float8 * INTERVAL '1 millisecond'
+		FROM due WHERE c.order_id = due.order_id
+		RETURNING c.order_id, c.email, c.order_result, c.attempts, c.created_at, due.next_attempt_at AS due_at
+	)
+	SELECT order_id, email, order_result, attempts, created_at FROM claimed ORDER BY due_at, order_id`
+
+	markConfirmationSentSQL = `
+	UPDATE order_confirmations SET status = $2, attempts = attempts + 1, last_error = '', sent_at = NOW()
+	WHERE order_id = $1`
+
+	markConfirmationFailedSQL = `
+	UPDATE order_confirmations
+	SET status = $2, attempts = attempts + 1, last_error = $3,
+		next_attempt_at = NOW() + $4::float8 * INTERVAL '1 millisecond'
+	WHERE order_id = $1`
+)
+
+// EnqueueConfirmation queues the confirmation email of a saved order. order
+// is the pb.OrderResult to render it from, as protojson. Queueing an order
+// twice keeps the first email.
+func (c *Connection) EnqueueConfirmation(ctx context.Context, orderID, email string, order []byte) (err error) {
+	if c.DB == nil {
+		return errNotInitialized
+	}
+	ctx, span := c.startSpan(ctx, "EnqueueConfirmation", insertConfirmationSQL)
+	var queued int64
+	defer func() { endSpan(span, int(queued), err) }()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	// A string, since lib/pq would send []byte as bytea.
+	res, err := tx.ExecContext(ctx, insertConfirmationSQL, orderID, email, string(order), models.ConfirmationPending)
+	if err != nil {
+		return fmt.Errorf("failed to insert confirmation: %w", classify(err))
+	}
+	if queued, err = res.RowsAffected(); err == nil && queued == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, setOrderConfirmationStatusSQL, orderID, models.ConfirmationPending); err != nil {
+		return fmt.Errorf("failed to set order confirmation status: %w", classify(err))
+	}
+
+	return tx.Commit()
+}
+
+// DeliverConfirmations claims up to limit due confirmations, oldest first,
+// for lease, passes them to deliver one at a time and records each outcome
+// as soon as it is known. A confirmation that fails is tried again after the
+// delay retryIn returns for its number of attempts so far, or marked failed
+// for good if retryIn returns false. No transaction is held while sending;
+// the lease keeps other replicas from sending the same emails, and an email
+// whose outcome can't be saved is sent again once the lease is over. lease
+// must cover delivering the whole batch. It returns how many were sent.
+func (c *Connection) DeliverConfirmations(ctx context.Context, limit int, lease time.Duration, deliver func(models.Confirmation) error, retryIn func(attempts int) (time.Duration, bool)) (int, error) {
+	if c.DB == nil {
+		return 0, errNotInitialized
+	}
+
+	rows, err := c.DB.QueryContext(ctx, claimDueConfirmationsSQL, models.ConfirmationPending, limit, lease.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim confirmations: %w", classify(err))
+	}
+	var due []models.Confirmation
+	for rows.Next() {
+		var conf models.Confirmation
+		if err := rows.Scan(&conf.OrderID, &conf.Email, &conf.Order, &conf.Attempts, &conf.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan confirmation: %w", classify(err))
+		}
+		due = append(due, conf)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+
+	sent := 0
+	var errs []error
+	for _, conf := range due {
+		sendErr := deliver(conf)
+		if sendErr == nil {
+			sent++
+		} else {
+			c.log.Warnf("failed to send confirmation of order %s (attempt %d): %v", conf.OrderID, conf.Attempts+1, sendErr)
+		}
+		if err := c.recordConfirmation(ctx, conf, sendErr, retryIn); err != nil {
+			errs = append(errs, fmt.Errorf("failed to record confirmation of order %s: %w", conf.OrderID, err))
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// recordConfirmation saves the outcome of sending conf, sendErr, in its own
+// transaction.
+func (c *Connection) recordConfirmation(ctx context.Context, conf models.Confirmation, sendErr error, retryIn func(attempts int) (time.Duration, bool)) error {
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	status := models.ConfirmationSent
+	if sendErr == nil {
+		_, err = tx.ExecContext(ctx, markConfirmationSentSQL, conf.OrderID, status)
+	} else {
+		delay, retry := retryIn(conf.Attempts + 1)
+		status = models.ConfirmationPending
+		if !retry {
+			status = models.ConfirmationFailed
+		}
+		_, err = tx.ExecContext(ctx, markConfirmationFailedSQL, conf.OrderID, status, sendErr.Error(), delay.Milliseconds())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record confirmation outcome: %w", classify(err))
+	}
+	if _, err := tx.ExecContext(ctx, setOrderConfirmationStatusSQL, conf.OrderID, status); err != nil {
+		return fmt.Errorf("failed to set order confirmation status: %w", classify(err))
+	}
+	return tx.Commit()
+}
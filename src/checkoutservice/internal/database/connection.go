@@ -3,105 +3,229 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 	"github.com/sirupsen/logrus"
-	_ "github.com/lib/pq"
 )
 
+// ErrNotConfigured is returned by Connect when the environment does not
+// describe a database. Retrying cannot fix it.
+var ErrNotConfigured = errors.New("database not configured")
+
+// defaultPingTimeout bounds the ping in Connect when the pool sets no
+// ConnectTimeout.
+const defaultPingTimeout = 10 * time.Second
+
 // Config holds database configuration
 type Config struct {
 	Host         string
 	DatabaseName string
 	SecretName   string
 	ProjectID    string
+	Topology     *Topology
+	TLS          TLS
+	WriteRetry   WriteRetry
+	Pool         Pool
+	// SkipPublish and SkipWebhooks mark new order events as skipped by the
+	// Pub/Sub publisher and by webhooks, when they are not configured.
+	SkipPublish  bool
+	SkipWebhooks bool
 }
 
 // Connection represents a database connection
 type Connection struct {
-	DB  *sql.DB
-	log *logrus.Logger
+	// DB is the primary, which takes all writes.
+	DB     *sql.DB
+	log    *logrus.Logger
+	config *Config
+
+	// reads routes reads across the primary and regional read endpoints.
+	// It is nil when no read endpoints are configured.
+	reads      *readRouter
+	stopProbes context.CancelFunc
 }
 
-// NewConnection creates a new database connection
-func NewConnection(log *logrus.Logger) *Connection {
+// NewConnection creates a new database connection for config, as returned
+// by LoadConfig.
+func NewConnection(log *logrus.Logger, config *Config) *Connection {
 	return &Connection{
-		log: log,
+		log:    log,
+		config: config,
 	}
 }
 
 // Connect initializes the database connection
-func (c *Connection) Connect() error {
-	config, err := c.loadConfig()
-	if err != nil {
-		return err
-	}
-
+func (c *Connection) Connect(ctx context.Context) error {
+	config := c.config
 	if config.Host == "" {
-		return fmt.Errorf("CLOUDSQL_HOST not set - database connection is required")
+		return fmt.Errorf("%w: CLOUDSQL_HOST not set - database connection is required", ErrNotConfigured)
 	}
 
 	c.log.Info("Initializing Cloud SQL connection for order history...")
 
-	// Get database password from Secret Manager
-	password, err := c.getSecretPayload(config.ProjectID, config.SecretName, "latest")
-	if err != nil {
-		return fmt.Errorf("failed to get database password: %v", err)
+	// The password is read from Secret Manager when connecting and refetched
+	// if Postgres rejects it, so secret rotation does not need a restart.
+	open := func(host string) (*sql.DB, error) {
+		connector, err := newRotatingConnector(
+			func(password string) string {
+				return fmt.Sprintf("host=%s user=postgres password=%s dbname=%s %s %s",
+					host, password, config.DatabaseName, config.TLS.Params(), config.Pool.params())
+			},
+			func() (string, error) {
+				return c.getSecretPayload(config.ProjectID, config.SecretName, "latest")
+			},
+			c.log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get database password: %v", err)
+		}
+		db := sql.OpenDB(connector)
+		config.Pool.apply(db)
+		return db, nil
 	}
 
-	// Create connection string
-	dsn := fmt.Sprintf("host=%s user=postgres password=%s dbname=%s sslmode=disable",
-		config.Host, password, config.DatabaseName)
-
-	// Open database connection
-	db, err := sql.Open("postgres", dsn)
+	db, err := open(config.Host)
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %v", err)
+		return err
 	}
 
-	// Test connection
-	if err := db.Ping(); err != nil {
+	// Test connection, without hanging on an unresponsive host
+	pingTimeout := config.Pool.ConnectTimeout
+	if pingTimeout <= 0 {
+		pingTimeout = defaultPingTimeout
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
 		db.Close()
 		return fmt.Errorf("failed to ping database: %v", err)
 	}
 
 	c.DB = db
-	c.log.Info("Successfully connected to Cloud SQL for order history")
+	c.log.Infof("Successfully connected to Cloud SQL for order history (primary region %q)", config.Topology.PrimaryRegion)
+	c.log.Infof("Connection pool: %s", config.Pool)
 
-	// Create tables if they don't exist
-	if err := c.createTables(); err != nil {
+	// Bring the schema up to date
+	if err := c.migrate(ctx); err != nil {
 		c.DB.Close()
 		c.DB = nil
-		return fmt.Errorf("failed to create tables: %v", err)
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	if len(config.Topology.ReadHosts) > 0 {
+		if err := c.connectReadEndpoints(config.Topology, open); err != nil {
+			c.Close()
+			c.DB = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+// connectReadEndpoints opens the regional read endpoints and starts probing
+// their latency. Unreachable endpoints are not an error; reads skip them
+// until a probe succeeds.
+func (c *Connection) connectReadEndpoints(t *Topology, open func(host string) (*sql.DB, error)) error {
+	endpoints := []*readEndpoint{{region: t.PrimaryRegion, db: c.DB}}
+	for region, host := range t.ReadHosts {
+		db, err := open(host)
+		if err != nil {
+			for _, e := range endpoints[1:] {
+				e.db.Close()
+			}
+			return err
+		}
+		endpoints = append(endpoints, &readEndpoint{region: region, db: db})
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	c.reads = newReadRouter(c.log, endpoints...)
+	c.reads.probe(ctx)
+	c.log.Infof("Routing order history reads by latency across regions %v", c.reads.regions())
+	go c.reads.run(ctx, t.ProbeInterval)
+	c.stopProbes = cancel
 	return nil
 }
 
+// readDB returns the database handle reads should use.
+func (c *Connection) readDB() *sql.DB {
+	if c.reads == nil {
+		return c.DB
+	}
+	return c.reads.pick().db
+}
+
 // Close closes the database connection
 func (c *Connection) Close() error {
+	if c.stopProbes != nil {
+		c.stopProbes()
+	}
+	if c.reads != nil {
+		// The first endpoint is the primary, closed below.
+		for _, e := range c.reads.endpoints[1:] {
+			e.db.Close()
+		}
+		c.reads = nil
+	}
 	if c.DB != nil {
 		return c.DB.Close()
 	}
 	return nil
 }
 
-// loadConfig loads database configuration from environment variables
-func (c *Connection) loadConfig() (*Config, error) {
+// LoadConfig loads database configuration from environment variables. A
+// Config without a Host is valid; Connect then returns ErrNotConfigured.
+// The error joins every problem found.
+func LoadConfig() (*Config, error) {
+	var errs []error
+	topology, err := loadTopology()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	tls, err := loadTLS()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	writeRetry, err := loadWriteRetry()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	pool, err := loadPool()
+	if err != nil {
+		errs = append(errs, err)
+	}
 	config := &Config{
-		Host:         os.Getenv("CLOUDSQL_HOST"),
 		DatabaseName: os.Getenv("ALLOYDB_DATABASE_NAME"),
 		SecretName:   os.Getenv("ALLOYDB_SECRET_NAME"),
 		ProjectID:    os.Getenv("PROJECT_ID"),
+		Topology:     topology,
+		TLS:          tls,
+		WriteRetry:   writeRetry,
+		Pool:         pool,
 	}
-
-	if config.Host != "" && (config.ProjectID == "" || config.DatabaseName == "" || config.SecretName == "") {
-		return nil, fmt.Errorf("missing required environment variables: PROJECT_ID, ALLOYDB_DATABASE_NAME, ALLOYDB_SECRET_NAME")
+	if topology != nil {
+		config.Host = topology.PrimaryHost
 	}
 
+	if config.Host != "" {
+		for _, v := range []struct{ env, value string }{
+			{"PROJECT_ID", config.ProjectID},
+			{"ALLOYDB_DATABASE_NAME", config.DatabaseName},
+			{"ALLOYDB_SECRET_NAME", config.SecretName},
+		} {
+			if v.value == "" {
+				errs = append(errs, fmt.Errorf("CLOUDSQL_HOST needs %s", v.env))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 	return config, nil
 }
 
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// rotatingConnector is a driver.Connector that builds DSNs from a password
+// fetched from Secret Manager. When Postgres rejects the password, e.g.
+// after the secret was rotated, it fetches the latest version and retries
+// once, so new pool connections recover without restarting the pod.
+type rotatingConnector struct {
+	dsn   func(password string) string
+	fetch func() (string, error)
+	log   *logrus.Logger
+
+	mu       sync.Mutex
+	password string
+}
+
+// newRotatingConnector fetches the initial password so configuration errors
+// surface when connecting rather than on the first query.
+func newRotatingConnector(dsn func(string) string, fetch func() (string, error), log *logrus.Logger) (*rotatingConnector, error) {
+	password, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingConnector{dsn: dsn, fetch: fetch, log: log, password: password}, nil
+}
+
+// Connect implements driver.Connector.
+func (r *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	password := r.currentPassword()
+	conn, err := r.connect(ctx, password)
+	if !isAuthFailure(err) {
+		return conn, err
+	}
+
+	r.log.Warnf("database rejected credentials, refetching password from Secret Manager: %v", err)
+	fresh, ferr := r.refreshPassword(password)
+	if ferr != nil {
+		return nil, fmt.Errorf("%v (refetching password: %v)", err, ferr)
+	}
+	return r.connect(ctx, fresh)
+}
+
+// Driver implements driver.Connector.
+func (r *rotatingConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func (r *rotatingConnector) connect(ctx context.Context, password string) (driver.Conn, error) {
+	connector, err := pq.NewConnector(r.dsn(password))
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (r *rotatingConnector) currentPassword() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.password
+}
+
+// refreshPassword replaces stale with the latest secret version. Concurrent
+// callers that failed with the same stale password share a single fetch.
+func (r *rotatingConnector) refreshPassword(stale string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.password != stale {
+		return r.password, nil
+	}
+	password, err := r.fetch()
+	if err != nil {
+		return "", err
+	}
+	r.password = password
+	return password, nil
+}
+
+// isAuthFailure reports whether err is Postgres rejecting the credentials.
+func isAuthFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	// 28P01 invalid_password, 28000 invalid_authorization_specification.
+	return pqErr.Code == "28P01" || pqErr.Code == "28000"
+}
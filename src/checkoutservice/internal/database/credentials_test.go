@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRotatingConnectorRefreshPassword(t *testing.T) {
+	versions := []string{"old", "new"}
+	fetches := 0
+	fetch := func() (string, error) {
+		p := versions[fetches]
+		fetches++
+		return p, nil
+	}
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	r, err := newRotatingConnector(func(p string) string { return p }, fetch, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.currentPassword(); got != "old" {
+		t.Fatalf("initial password = %q, want old", got)
+	}
+
+	// Two callers failing with the same stale password share one fetch.
+	for i := 0; i < 2; i++ {
+		got, err := r.refreshPassword("old")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "new" {
+			t.Errorf("refreshPassword = %q, want new", got)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("fetches = %d, want 2", fetches)
+	}
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fmt.Errorf("dial tcp: connection refused"), false},
+		{&pq.Error{Code: "28P01"}, true},
+		{fmt.Errorf("connect: %w", &pq.Error{Code: "28000"}), true},
+		{&pq.Error{Code: "57P03"}, false},
+	}
+	for _, tt := range tests {
+		if got := isAuthFailure(tt.err); got != tt.want {
+			t.Errorf("isAuthFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
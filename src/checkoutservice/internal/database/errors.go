@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// Classes of errors returned by the database layer, matched with errors.Is.
+// Specific errors such as ErrOrderNotFound belong to one of them.
+var (
+	// ErrNotFound is returned for a row that does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned for a row whose key is already taken.
+	ErrDuplicate = errors.New("already exists")
+	// ErrConstraint is returned for a write that violates another integrity
+	// constraint, such as a foreign key or check.
+	ErrConstraint = errors.New("constraint violation")
+	// ErrUnavailable is returned when the database can't be reached or is
+	// overloaded or shutting down. Retrying later may succeed.
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// errNotInitialized is returned by methods of a Connection without a DB.
+var errNotInitialized = &classifiedError{class: ErrUnavailable, err: errors.New("database connection not initialized")}
+
+// classifiedError adds a class to an error without changing its message.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string   { return e.err.Error() }
+func (e *classifiedError) Unwrap() []error { return []error{e.class, e.err} }
+
+// classify returns err wrapped with its class if it has one, so callers can
+// tell a connection problem or constraint violation from other failures.
+// Errors that already have a class, and context errors, are returned as they
+// are.
+func classify(err error) error {
+	if class := errorClass(err); class != nil {
+		return &classifiedError{class: class, err: err}
+	}
+	return err
+}
+
+// errorClass returns the class of a driver error, or nil.
+func errorClass(err error) error {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrNotFound), errors.Is(err, ErrDuplicate),
+		errors.Is(err, ErrConstraint), errors.Is(err, ErrUnavailable):
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrUnavailable
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "23505": // unique_violation
+			return ErrDuplicate
+		case pqErr.Code.Class() == "23": // integrity_constraint_violation
+			return ErrConstraint
+		case pqErr.Code.Class() == "08", // connection_exception
+			pqErr.Code.Class() == "53",                          // insufficient_resources
+			pqErr.Code.Class() == "57" && pqErr.Code != "57014", // operator_intervention, except query_canceled
+			pqErr.Code == "25006":                               // read_only_sql_transaction, during a failover
+			return ErrUnavailable
+		}
+		return nil
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error // nil when the error has no class
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, ErrDuplicate},
+		{"foreign key violation", &pq.Error{Code: "23503"}, ErrConstraint},
+		{"connection failure", &pq.Error{Code: "08006"}, ErrUnavailable},
+		{"too many connections", &pq.Error{Code: "53300"}, ErrUnavailable},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, ErrUnavailable},
+		{"read-only replica", &pq.Error{Code: "25006"}, ErrUnavailable},
+		{"statement timeout", &pq.Error{Code: "57014"}, nil},
+		{"syntax error", &pq.Error{Code: "42601"}, nil},
+		{"no rows", sql.ErrNoRows, ErrNotFound},
+		{"bad connection", driver.ErrBadConn, ErrUnavailable},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrUnavailable},
+		{"cancelled", context.Canceled, nil},
+		{"other", errors.New("boom"), nil},
+	}
+	classes := []error{ErrNotFound, ErrDuplicate, ErrConstraint, ErrUnavailable}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("failed to insert order: %w", classify(tt.err))
+			for _, class := range classes {
+				if got := errors.Is(err, class); got != (class == tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %v", err, class, got)
+				}
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v to wrap %v", err, tt.err)
+			}
+			if err.Error() != "failed to insert order: "+tt.err.Error() {
+				t.Errorf("Expected the message to be kept, got %q", err)
+			}
+		})
+	}
+}
+
+func TestSpecificErrorsHaveClasses(t *testing.T) {
+	for err, class := range map[error]error{
+		ErrOrderNotFound:  ErrNotFound,
+		ErrReturnNotFound: ErrNotFound,
+		ErrDuplicateOrder: ErrDuplicate,
+		errNotInitialized: ErrUnavailable,
+	} {
+		if !errors.Is(err, class) {
+			t.Errorf("Expected %v to be %v", err, class)
+		}
+		if classify(err) != err {
+			t.Errorf("Expected classify to keep %v as it is", err)
+		}
+	}
+}
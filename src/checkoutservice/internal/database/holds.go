@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ErrNoOrderHold is returned by TakeOrderHold for an order that is not held
+// for review, or whose hold another caller took.
+var ErrNoOrderHold error = &classifiedError{class: ErrNotFound, err: errors.New("order is not held")}
+
+const (
+	// SQL queries for order holds
+
+	insertOrderHoldSQL = `
+	INSERT INTO order_holds (order_id, transaction_id, address)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (order_id) DO NOTHING`
+
+	// takeOrderHoldSQL deletes the hold of an order under review, so only
+	// one caller releases it.
+	takeOrderHoldSQL = `
+	DELETE FROM order_holds h
+	USING order_history o
+	WHERE h.order_id = $1 AND o.order_id = h.order_id AND o.status = 'under_review'
+	RETURNING h.order_id, h.transaction_id, h.address, h.created_at`
+)
+
+// putOrderHold stores hold in tx. A hold already stored for the order is
+// kept.
+func putOrderHold(ctx context.Context, tx *sql.Tx, hold *models.OrderHold) error {
+	address, err := protojson.Marshal(hold.Address)
+	if err != nil {
+		return fmt.Errorf("failed to encode held order address: %w", err)
+	}
+	// As a string: lib/pq would send a []byte as bytea.
+	if _, err := tx.ExecContext(ctx, insertOrderHoldSQL, hold.OrderID, hold.TransactionID, string(address)); err != nil {
+		return fmt.Errorf("failed to insert order hold: %w", classify(err))
+	}
+	return nil
+}
+
+// PutOrderHold stores the hold of an order again after releasing it failed,
+// so it can be retried.
+func (c *Connection) PutOrderHold(ctx context.Context, hold *models.OrderHold) error {
+	if c.DB == nil {
+		return errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+	if err := putOrderHold(ctx, tx, hold); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit order hold: %w", classify(err))
+	}
+	return nil
+}
+
+// TakeOrderHold deletes and returns the hold of an order under review, so
+// that the caller can capture its payment and ship it. It returns
+// ErrNoOrderHold if the order is not under review or has no hold.
+func (c *Connection) TakeOrderHold(ctx context.Context, orderID string) (*models.OrderHold, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	var hold models.OrderHold
+	var address []byte
+	err := c.DB.QueryRowContext(ctx, takeOrderHoldSQL, orderID).Scan(&hold.OrderID, &hold.TransactionID, &address, &hold.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoOrderHold
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take order hold: %w", classify(err))
+	}
+	hold.Address = new(pb.Address)
+	if err := protojson.Unmarshal(address, hold.Address); err != nil {
+		return nil, fmt.Errorf("failed to decode held order address: %w", err)
+	}
+	return &hold, nil
+}
+
+// ReleaseOrder moves an order under review whose hold was taken to paid once
+// its payment is captured and it has shipped with trackingID, recording the
+// status change with reason. It returns ErrOrderNotFound for an unknown
+// order and an error wrapping models.ErrInvalidStatusTransition for one that
+// is no longer under review.
+func (c *Connection) ReleaseOrder(ctx context.Context, orderID, trackingID, reason string) (*models.Order, error) {
+	return c.finishOrder(ctx, "ReleaseOrder", orderID, models.StatusUnderReview, models.StatusPaid, trackingID, reason, models.StatusEvent(models.StatusPaid), nil)
+}
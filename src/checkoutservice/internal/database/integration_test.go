@@ -0,0 +1,1331 @@
+//go:build integration
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// setupIntegrationConnection starts Postgres in a container and returns a
+// Connection with the order history schema applied.
+func setupIntegrationConnection(t *testing.T) *Connection {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	ctr, err := postgres.Run(ctx, "pgvector/pgvector:pg16",
+		postgres.WithDatabase("orders"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		postgres.BasicWaitStrategies())
+	testcontainers.CleanupContainer(t, ctr)
+	if err != nil {
+		t.Fatalf("failed to start postgres container: %v", err)
+	}
+
+	dsn, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	c := &Connection{DB: db, log: logger, config: &Config{}}
+	t.Cleanup(func() { c.Close() })
+
+	if err := c.migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return c
+}
+
+func TestIntegrationSaveOrder(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{
+		OrderID:             "order-1",
+		UserID:              "user-1",
+		Email:               "user@example.com",
+		TotalAmountCurrency: "USD",
+		TotalAmountUnits:    41,
+		TotalAmountNanos:    970000000,
+		ShippingTrackingID:  "TRACK-1",
+		ShippingAddress:     "1600 Amphitheatre Pkwy, Mountain View, CA 94043, USA",
+		Status:              models.StatusPaid,
+	}
+	items := []models.OrderItem{
+		{OrderID: "order-1", ProductID: "PRODUCT-1", Quantity: 2, UnitPriceCurrency: "USD", UnitPriceUnits: 15, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 31, TotalPriceNanos: 980000000},
+		{OrderID: "order-1", ProductID: "PRODUCT-2", Quantity: 1, UnitPriceCurrency: "USD", UnitPriceUnits: 9, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 9, TotalPriceNanos: 990000000},
+	}
+
+	if err := c.SaveOrder(context.Background(), order, items); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	orders, _, err := c.GetOrdersByUser(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("GetOrdersByUser failed: %v", err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("Expected 1 order, got %d", len(orders))
+	}
+	got := orders[0]
+	if got.OrderID != order.OrderID || got.TotalAmountUnits != order.TotalAmountUnits || got.TotalAmountNanos != order.TotalAmountNanos {
+		t.Errorf("Expected order %+v, got %+v", order, got)
+	}
+	if got.OrderDate.IsZero() {
+		t.Error("Expected order_date to be set")
+	}
+
+	gotItems, err := c.GetOrderItems(context.Background(), "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderItems failed: %v", err)
+	}
+	if len(gotItems) != len(items) {
+		t.Fatalf("Expected %d items, got %d", len(items), len(gotItems))
+	}
+	for i, item := range gotItems {
+		if item.ProductID != items[i].ProductID || item.Quantity != items[i].Quantity {
+			t.Errorf("Item %d: expected %+v, got %+v", i, items[i], item)
+		}
+	}
+}
+
+func TestIntegrationSaveOrderRollsBackOnItemFailure(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{OrderID: "order-2", UserID: "user-2", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+	// An item pointing at a different, non-existent order violates the foreign key.
+	items := []models.OrderItem{{OrderID: "missing-order", ProductID: "PRODUCT-1", Quantity: 1}}
+
+	if err := c.SaveOrder(context.Background(), order, items); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	orders, _, err := c.GetOrdersByUser(context.Background(), "user-2")
+	if err != nil {
+		t.Fatalf("GetOrdersByUser failed: %v", err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("Expected order to be rolled back, got %d orders", len(orders))
+	}
+}
+
+func TestIntegrationSaveOrderDuplicate(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", TotalAmountCurrency: "USD", TotalAmountUnits: 10, Status: models.StatusPaid}
+	items := []models.OrderItem{{OrderID: "order-1", ProductID: "PRODUCT-1", Quantity: 1}}
+	if err := c.SaveOrder(context.Background(), order, items); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	retry := *order
+	retry.TotalAmountUnits = 20
+	if err := c.SaveOrder(context.Background(), &retry, items); !errors.Is(err, ErrDuplicateOrder) {
+		t.Fatalf("Expected ErrDuplicateOrder, got %v", err)
+	}
+
+	got, err := c.GetOrderByID(context.Background(), "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderByID failed: %v", err)
+	}
+	if got.TotalAmountUnits != 10 {
+		t.Errorf("Expected the first order to be kept, got total %d", got.TotalAmountUnits)
+	}
+	gotItems, err := c.GetOrderItems(context.Background(), "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderItems failed: %v", err)
+	}
+	if len(gotItems) != 1 {
+		t.Errorf("Expected the retry to add no items, got %d", len(gotItems))
+	}
+
+	// A retried attempt takes the user's own order as saved by an attempt
+	// whose commit was not acknowledged, but not another user's.
+	if err := c.saveOrder(context.Background(), &retry, items, true); err != nil {
+		t.Errorf("Expected a retried attempt to succeed, got %v", err)
+	}
+	other := *order
+	other.UserID = "user-2"
+	if err := c.saveOrder(context.Background(), &other, items, true); !errors.Is(err, ErrDuplicateOrder) {
+		t.Errorf("Expected ErrDuplicateOrder for another user's order, got %v", err)
+	}
+	if gotItems, err := c.GetOrderItems(context.Background(), "order-1"); err != nil || len(gotItems) != 1 {
+		t.Errorf("Expected the retried attempts to add no items, got %d, %v", len(gotItems), err)
+	}
+}
+
+func TestIntegrationSaveOrderKeepsOrderDate(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	// An order saved late from the order buffer keeps the time it was placed.
+	placedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", Status: models.StatusPaid, OrderDate: placedAt}
+	if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	got, err := c.GetOrderByID(context.Background(), "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderByID failed: %v", err)
+	}
+	if !got.OrderDate.Equal(placedAt) {
+		t.Errorf("Expected order_date %v, got %v", placedAt, got.OrderDate)
+	}
+}
+
+func TestIntegrationSaveOrderDiscount(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	discounted := &models.Order{
+		OrderID: "order-1", UserID: "user-1", Status: models.StatusPaid,
+		DiscountCode:           "WELCOME10",
+		DiscountAmountCurrency: "USD", DiscountAmountUnits: 6, DiscountAmountNanos: 190000000,
+		SubtotalAmountCurrency: "USD", SubtotalAmountUnits: 61, SubtotalAmountNanos: 970000000,
+	}
+	plain := &models.Order{OrderID: "order-2", UserID: "user-1", Status: models.StatusPaid}
+	for _, order := range []*models.Order{discounted, plain} {
+		if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+	}
+
+	got, err := c.GetOrderByID(context.Background(), "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderByID failed: %v", err)
+	}
+	if got.DiscountCode != "WELCOME10" || got.DiscountAmountUnits != 6 || got.DiscountAmountNanos != 190000000 ||
+		got.SubtotalAmountCurrency != "USD" || got.SubtotalAmountUnits != 61 || got.SubtotalAmountNanos != 970000000 {
+		t.Errorf("Expected the discount and subtotal to be kept, got %+v", got)
+	}
+	if got, err = c.GetOrderByID(context.Background(), "order-2"); err != nil || got.DiscountCode != "" {
+		t.Errorf("Expected no discount code, got %+v, %v", got, err)
+	}
+}
+
+func TestIntegrationSaveOrderTax(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{
+		OrderID: "order-1", UserID: "user-1", Status: models.StatusPaid,
+		TaxAmountCurrency: "EUR", TaxAmountUnits: 3, TaxAmountNanos: 800000000,
+		TaxBreakdown: []models.TaxLine{{Jurisdiction: "germany", Currency: "EUR", Units: 3, Nanos: 800000000}},
+	}
+	if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	orders, _, err := c.GetOrdersByUser(context.Background(), "user-1")
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("GetOrdersByUser = %v, %v", orders, err)
+	}
+	got := orders[0]
+	if got.TaxAmountCurrency != "EUR" || got.TaxAmountUnits != 3 || got.TaxAmountNanos != 800000000 ||
+		len(got.TaxBreakdown) != 1 || got.TaxBreakdown[0] != order.TaxBreakdown[0] {
+		t.Errorf("Expected the tax and its breakdown to be kept, got %+v", got)
+	}
+}
+
+func TestIntegrationSaveOrderManyItems(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", Status: models.StatusPaid}
+	var items []models.OrderItem
+	for i := 0; i < 250; i++ {
+		items = append(items, models.OrderItem{
+			OrderID:            "order-1",
+			ProductID:          fmt.Sprintf("PRODUCT-%03d", i),
+			Quantity:           int32(i%5 + 1),
+			UnitPriceCurrency:  "USD",
+			UnitPriceUnits:     int64(i),
+			UnitPriceNanos:     990000000,
+			TotalPriceCurrency: "USD",
+			TotalPriceUnits:    int64(i * (i%5 + 1)),
+		})
+	}
+	if err := c.SaveOrder(context.Background(), order, items); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	got, err := c.GetOrderItems(context.Background(), "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderItems failed: %v", err)
+	}
+	if len(got) != len(items) {
+		t.Fatalf("Expected %d items, got %d", len(items), len(got))
+	}
+	for i, item := range got {
+		want := items[i]
+		want.ID = item.ID
+		if item != want {
+			t.Fatalf("item %d = %+v, want %+v", i, item, want)
+		}
+		if i > 0 && item.ID <= got[i-1].ID {
+			t.Errorf("Expected item IDs in cart order, got %d after %d", item.ID, got[i-1].ID)
+		}
+	}
+}
+
+func TestIntegrationConfirmations(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"order-1", "order-2", "order-3"} {
+		if err := c.SaveOrder(ctx, &models.Order{OrderID: id, UserID: "user-1", Status: models.StatusPaid}, nil); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+		if err := c.EnqueueConfirmation(ctx, id, id+"@example.com", []byte(`{"orderId":"`+id+`"}`)); err != nil {
+			t.Fatalf("EnqueueConfirmation failed: %v", err)
+		}
+	}
+	// Queueing again keeps the first email.
+	if err := c.EnqueueConfirmation(ctx, "order-1", "other@example.com", []byte(`{}`)); err != nil {
+		t.Fatalf("EnqueueConfirmation failed: %v", err)
+	}
+
+	retryIn := func(attempts int) (time.Duration, bool) { return time.Hour, attempts < 3 }
+	var emails []string
+	sent, err := c.DeliverConfirmations(ctx, 10, time.Minute, func(conf models.Confirmation) error {
+		emails = append(emails, conf.Email)
+		if conf.OrderID == "order-1" {
+			// The batch is claimed without holding a transaction, so another
+			// replica gets nothing rather than waiting.
+			n, err := c.DeliverConfirmations(ctx, 10, time.Minute, func(conf models.Confirmation) error {
+				t.Errorf("Expected claimed confirmations to be skipped, got %s", conf.OrderID)
+				return nil
+			}, retryIn)
+			if err != nil || n != 0 {
+				t.Errorf("Concurrent DeliverConfirmations = %d, %v; want 0, nil", n, err)
+			}
+		}
+		if conf.OrderID == "order-2" {
+			return errors.New("email service unavailable")
+		}
+		return nil
+	}, retryIn)
+	if err != nil {
+		t.Fatalf("DeliverConfirmations failed: %v", err)
+	}
+	if sent != 2 || len(emails) != 3 || emails[0] != "order-1@example.com" {
+		t.Errorf("Expected 2 of 3 emails sent, first to order-1@example.com; sent %d of %v", sent, emails)
+	}
+
+	for id, want := range map[string]string{
+		"order-1": models.ConfirmationSent,
+		"order-2": models.ConfirmationPending,
+		"order-3": models.ConfirmationSent,
+	} {
+		got, err := c.GetOrderByID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetOrderByID failed: %v", err)
+		}
+		if got.ConfirmationStatus != want {
+			t.Errorf("Order %s confirmation is %q, want %q", id, got.ConfirmationStatus, want)
+		}
+	}
+	var attempts int
+	var lastError string
+	if err := c.DB.QueryRow(`SELECT attempts, last_error FROM order_confirmations WHERE order_id = 'order-2'`).Scan(&attempts, &lastError); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 || lastError != "email service unavailable" {
+		t.Errorf("Expected 1 failed attempt recorded, got %d (%q)", attempts, lastError)
+	}
+
+	// The failed email is not due again until its backoff has passed.
+	sent, err = c.DeliverConfirmations(ctx, 10, time.Minute, func(models.Confirmation) error {
+		t.Error("Expected no email to be due")
+		return nil
+	}, retryIn)
+	if err != nil || sent != 0 {
+		t.Errorf("DeliverConfirmations = %d, %v; want 0, nil", sent, err)
+	}
+}
+
+func TestIntegrationWebhooks(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	if err := c.SaveOrder(ctx, &models.Order{OrderID: "order-1", UserID: "user-1", Status: models.StatusPaid}, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+	if _, err := c.UpdateOrderStatus(ctx, "order-1", models.StatusShipped, "handed to carrier"); err != nil {
+		t.Fatalf("UpdateOrderStatus failed: %v", err)
+	}
+
+	endpoints := []string{"https://a.example.com", "https://b.example.com"}
+	n, err := c.QueueWebhooks(ctx, endpoints, 10)
+	if err != nil || n != 2 {
+		t.Fatalf("QueueWebhooks = %d, %v; want 2 events queued", n, err)
+	}
+	if n, err := c.QueueWebhooks(ctx, endpoints, 10); err != nil || n != 0 {
+		t.Fatalf("Expected events to be queued once, got %d, %v", n, err)
+	}
+
+	retryIn := func(attempts int) (time.Duration, bool) { return time.Hour, true }
+	var got []models.WebhookDelivery
+	delivered, err := c.DeliverWebhooks(ctx, 10, time.Minute, func(d models.WebhookDelivery) error {
+		got = append(got, d)
+		if len(got) == 1 {
+			n, err := c.DeliverWebhooks(ctx, 10, time.Minute, func(d models.WebhookDelivery) error {
+				t.Errorf("Expected claimed deliveries to be skipped, got %d", d.ID)
+				return nil
+			}, retryIn)
+			if err != nil || n != 0 {
+				t.Errorf("Concurrent DeliverWebhooks = %d, %v; want 0, nil", n, err)
+			}
+		}
+		if d.Endpoint == "https://b.example.com" {
+			return errors.New("endpoint returned status 503")
+		}
+		return nil
+	}, retryIn)
+	if err != nil {
+		t.Fatalf("DeliverWebhooks failed: %v", err)
+	}
+	if delivered != 2 || len(got) != 4 {
+		t.Fatalf("Expected 2 of 4 deliveries to succeed, got %d of %d", delivered, len(got))
+	}
+	types := make(map[string]int)
+	for _, d := range got {
+		types[d.Event.Type]++
+		if d.Event.Order.OrderID != "order-1" || d.Event.Order.Status != models.StatusShipped {
+			t.Errorf("Unexpected event %+v", d.Event)
+		}
+	}
+	if types[models.EventOrderPlaced] != 2 || types[models.EventOrderShipped] != 2 {
+		t.Errorf("Expected each event for both endpoints, got %v", types)
+	}
+
+	// The failed deliveries wait for their backoff.
+	delivered, err = c.DeliverWebhooks(ctx, 10, time.Minute, func(models.WebhookDelivery) error {
+		t.Error("Expected no delivery to be due")
+		return nil
+	}, retryIn)
+	if err != nil || delivered != 0 {
+		t.Errorf("DeliverWebhooks = %d, %v; want 0, nil", delivered, err)
+	}
+}
+
+func TestIntegrationCancelledContext(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", Status: models.StatusPaid}
+	if err := c.SaveOrder(ctx, order, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected SaveOrder to fail with context.Canceled, got %v", err)
+	}
+	if _, _, err := c.GetOrdersByUser(ctx, "user-1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected GetOrdersByUser to fail with context.Canceled, got %v", err)
+	}
+
+	orders, _, err := c.GetOrdersByUser(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("GetOrdersByUser failed: %v", err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("Expected the cancelled save to store nothing, got %d orders", len(orders))
+	}
+}
+
+func TestIntegrationGetOrdersPage(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	ids := []string{"order-a", "order-b", "order-c", "order-d", "order-e"}
+	for _, id := range ids {
+		order := &models.Order{OrderID: id, UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+		if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+			t.Fatalf("SaveOrder(%s) failed: %v", id, err)
+		}
+	}
+	other := &models.Order{OrderID: "order-other", UserID: "user-2", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+	if err := c.SaveOrder(context.Background(), other, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+	// Orders placed at the same instant are ordered by ID.
+	if _, err := c.DB.Exec(`UPDATE order_history SET order_date = '2025-01-01 12:00:00.123456'
+		WHERE order_id IN ('order-b', 'order-c', 'order-d')`); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var after *OrderCursor
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Expected 3 pages")
+		}
+		orders, err := c.GetOrdersPage(context.Background(), "user-1", DateRange{}, after, 2)
+		if err != nil {
+			t.Fatalf("GetOrdersPage failed: %v", err)
+		}
+		for _, o := range orders {
+			got = append(got, o.OrderID)
+		}
+		if len(orders) < 2 {
+			break
+		}
+		last := orders[len(orders)-1]
+		after = &OrderCursor{OrderDate: last.OrderDate, OrderID: last.OrderID}
+	}
+
+	want := []string{"order-e", "order-a", "order-d", "order-c", "order-b"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected orders %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected orders %v, got %v", want, got)
+		}
+	}
+}
+
+func TestIntegrationGetOrdersPageDateRange(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	for _, id := range []string{"order-dec", "order-jan", "order-feb"} {
+		order := &models.Order{OrderID: id, UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+		if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+			t.Fatalf("SaveOrder(%s) failed: %v", id, err)
+		}
+	}
+	if _, err := c.DB.Exec(`UPDATE order_history SET order_date = CASE order_id
+		WHEN 'order-dec' THEN TIMESTAMP '2024-12-31 23:59:59'
+		WHEN 'order-jan' THEN TIMESTAMP '2025-01-15 12:00:00'
+		ELSE TIMESTAMP '2025-02-01 00:00:00' END`); err != nil {
+		t.Fatal(err)
+	}
+
+	// The range is given in another time zone to check it is compared in UTC.
+	cet := time.FixedZone("CET", 60*60)
+	dates := DateRange{
+		From: time.Date(2025, 1, 1, 1, 0, 0, 0, cet),
+		To:   time.Date(2025, 2, 1, 1, 0, 0, 0, cet),
+	}
+	orders, err := c.GetOrdersPage(context.Background(), "user-1", dates, nil, 10)
+	if err != nil {
+		t.Fatalf("GetOrdersPage failed: %v", err)
+	}
+	if len(orders) != 1 || orders[0].OrderID != "order-jan" {
+		t.Errorf("Expected only order-jan, got %v", orders)
+	}
+
+	orders, err = c.GetOrdersPage(context.Background(), "user-1", DateRange{From: dates.From}, nil, 10)
+	if err != nil {
+		t.Fatalf("GetOrdersPage failed: %v", err)
+	}
+	if len(orders) != 2 || orders[0].OrderID != "order-feb" {
+		t.Errorf("Expected order-feb and order-jan, got %v", orders)
+	}
+}
+
+func TestIntegrationGetOrderByID(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", Email: "user@example.com",
+		TotalAmountCurrency: "USD", TotalAmountUnits: 5, Status: models.StatusPaid}
+	if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	got, err := c.GetOrderByID(context.Background(), "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderByID failed: %v", err)
+	}
+	if got.UserID != "user-1" || got.Email != "user@example.com" || got.TotalAmountUnits != 5 || got.OrderDate.IsZero() {
+		t.Errorf("Expected order %+v, got %+v", order, got)
+	}
+
+	if _, err := c.GetOrderByID(context.Background(), "order-missing"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestIntegrationGetOrderByTrackingID(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	for _, order := range []*models.Order{
+		{OrderID: "order-old", UserID: "user-1", ShippingTrackingID: "TRACK-1", Status: models.StatusPaid},
+		{OrderID: "order-new", UserID: "user-2", ShippingTrackingID: "TRACK-1", Status: models.StatusPaid},
+		{OrderID: "order-other", UserID: "user-1", ShippingTrackingID: "TRACK-2", Status: models.StatusPaid},
+	} {
+		if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+	}
+
+	got, err := c.GetOrderByTrackingID(context.Background(), "TRACK-2")
+	if err != nil {
+		t.Fatalf("GetOrderByTrackingID failed: %v", err)
+	}
+	if got.OrderID != "order-other" {
+		t.Errorf("Expected order-other, got %s", got.OrderID)
+	}
+	// A tracking ID shared by several orders finds the latest.
+	if got, err := c.GetOrderByTrackingID(context.Background(), "TRACK-1"); err != nil || got.OrderID != "order-new" {
+		t.Errorf("Expected order-new, got %v, %v", got, err)
+	}
+
+	if _, err := c.GetOrderByTrackingID(context.Background(), "TRACK-MISSING"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestIntegrationGetUserOrderStats(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	item := func(productID string, quantity int32) models.OrderItem {
+		return models.OrderItem{ProductID: productID, Quantity: quantity, UnitPriceCurrency: "USD", TotalPriceCurrency: "USD"}
+	}
+	for _, o := range []struct {
+		order *models.Order
+		items []models.OrderItem
+	}{
+		{&models.Order{OrderID: "order-1", UserID: "user-1", TotalAmountCurrency: "USD", TotalAmountUnits: 10,
+			TotalAmountNanos: 600000000, Status: models.StatusPaid}, []models.OrderItem{item("p1", 1), item("p2", 3)}},
+		{&models.Order{OrderID: "order-2", UserID: "user-1", TotalAmountCurrency: "USD", TotalAmountUnits: 5,
+			TotalAmountNanos: 500000000, Status: models.StatusPaid}, []models.OrderItem{item("p1", 4)}},
+		{&models.Order{OrderID: "order-3", UserID: "user-1", TotalAmountCurrency: "EUR", TotalAmountUnits: 7,
+			Status: models.StatusPaid}, []models.OrderItem{item("p3", 1)}},
+		{&models.Order{OrderID: "order-cancelled", UserID: "user-1", TotalAmountCurrency: "USD", TotalAmountUnits: 100,
+			Status: models.StatusCancelled}, []models.OrderItem{item("p4", 10)}},
+		{&models.Order{OrderID: "order-other", UserID: "user-2", TotalAmountCurrency: "USD", TotalAmountUnits: 100,
+			Status: models.StatusPaid}, []models.OrderItem{item("p4", 10)}},
+	} {
+		if err := c.SaveOrder(ctx, o.order, o.items); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+	}
+
+	stats, err := c.GetUserOrderStats(ctx, "user-1", 2)
+	if err != nil {
+		t.Fatalf("GetUserOrderStats failed: %v", err)
+	}
+	if stats.TotalOrders != 3 || stats.FirstOrderDate.IsZero() || stats.LastOrderDate.Before(stats.FirstOrderDate) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	wantSpend := []models.CurrencySpend{{Currency: "EUR", Units: 7}, {Currency: "USD", Units: 16, Nanos: 100000000}}
+	if len(stats.Spend) != 2 || stats.Spend[0] != wantSpend[0] || stats.Spend[1] != wantSpend[1] {
+		t.Errorf("Expected spend %+v, got %+v", wantSpend, stats.Spend)
+	}
+	wantTop := []models.ProductStats{{ProductID: "p1", Quantity: 5, Orders: 2}, {ProductID: "p2", Quantity: 3, Orders: 1}}
+	if len(stats.TopProducts) != 2 || stats.TopProducts[0] != wantTop[0] || stats.TopProducts[1] != wantTop[1] {
+		t.Errorf("Expected top products %+v, got %+v", wantTop, stats.TopProducts)
+	}
+
+	stats, err = c.GetUserOrderStats(ctx, "user-without-orders", 5)
+	if err != nil {
+		t.Fatalf("GetUserOrderStats failed: %v", err)
+	}
+	if stats.TotalOrders != 0 || len(stats.Spend) != 0 || len(stats.TopProducts) != 0 || !stats.FirstOrderDate.IsZero() {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+}
+
+func TestIntegrationAnonymizeUserData(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	for _, order := range []*models.Order{
+		{OrderID: "order-1", UserID: "user-1", Email: "user@example.com", ShippingAddress: "1 Main St",
+			TotalAmountCurrency: "USD", TotalAmountUnits: 12, Status: models.StatusPaid},
+		{OrderID: "order-2", UserID: "user-1", Email: "user@example.com", ShippingAddress: "1 Main St",
+			TotalAmountCurrency: "USD", TotalAmountUnits: 5, Status: models.StatusPaid},
+		{OrderID: "order-other", UserID: "user-2", Email: "other@example.com", ShippingAddress: "2 Side St",
+			TotalAmountCurrency: "USD", Status: models.StatusPaid},
+	} {
+		if err := c.SaveOrder(ctx, order, []models.OrderItem{{ProductID: "p1", Quantity: 1}}); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+		if err := c.EnqueueConfirmation(ctx, order.OrderID, order.Email, []byte(`{}`)); err != nil {
+			t.Fatalf("EnqueueConfirmation failed: %v", err)
+		}
+	}
+	if _, err := c.CancelOrder(ctx, "user-1", "order-2", "moving to 1 Main St"); err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+
+	n, err := c.AnonymizeUserData(ctx, "user-1", "deleted-1")
+	if err != nil || n != 2 {
+		t.Fatalf("AnonymizeUserData = %d, %v; want 2", n, err)
+	}
+
+	got, err := c.GetOrderByID(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderByID failed: %v", err)
+	}
+	if got.UserID != "deleted-1" || got.Email != "" || got.ShippingAddress != "" || got.TotalAmountUnits != 12 {
+		t.Errorf("Expected an anonymized order with its total, got %+v", got)
+	}
+	if items, err := c.GetOrderItems(ctx, "order-1"); err != nil || len(items) != 1 {
+		t.Errorf("Expected the items to be kept, got %v, %v", items, err)
+	}
+
+	var confirmations, reasons int
+	if err := c.DB.QueryRow(`SELECT COUNT(*) FROM order_confirmations`).Scan(&confirmations); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DB.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM order_status_history WHERE reason <> '' AND order_id = 'order-2') +
+		(SELECT COUNT(*) FROM order_events WHERE reason <> '' AND order_id = 'order-2')`).Scan(&reasons); err != nil {
+		t.Fatal(err)
+	}
+	if confirmations != 1 || reasons != 0 {
+		t.Errorf("Expected only user-2's confirmation and no reasons left, got %d and %d", confirmations, reasons)
+	}
+	if other, err := c.GetOrderByID(ctx, "order-other"); err != nil || other.Email != "other@example.com" {
+		t.Errorf("Expected other users' orders to be untouched, got %+v, %v", other, err)
+	}
+}
+
+func TestIntegrationCompleteOrder(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"order-1", "order-2"} {
+		order := &models.Order{OrderID: id, UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusPending}
+		items := []models.OrderItem{{OrderID: id, ProductID: "p1", Quantity: 1, UnitPriceCurrency: "USD", TotalPriceCurrency: "USD"}}
+		if err := c.SaveOrder(ctx, order, items); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+	}
+
+	got, err := c.CompleteOrder(ctx, "order-1", models.StatusPaid, "TRACK-1", nil)
+	if err != nil {
+		t.Fatalf("CompleteOrder failed: %v", err)
+	}
+	if got.Status != models.StatusPaid || got.ShippingTrackingID != "TRACK-1" {
+		t.Errorf("Unexpected completed order %+v", got)
+	}
+	// Completing it again, as a retry whose commit was lost does, returns
+	// the order; completing it differently fails.
+	if got, err := c.CompleteOrder(ctx, "order-1", models.StatusPaid, "TRACK-1", nil); err != nil || got.Status != models.StatusPaid {
+		t.Errorf("Expected completing again to return the paid order, got %+v, %v", got, err)
+	}
+	if _, err := c.CompleteOrder(ctx, "order-1", models.StatusPaid, "TRACK-2", nil); !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected completing with another tracking ID to fail with ErrInvalidStatusTransition, got %v", err)
+	}
+
+	// The pending order is left out of history and search.
+	if orders, _, err := c.GetOrdersByUser(ctx, "user-1"); err != nil || len(orders) != 1 || orders[0].OrderID != "order-1" {
+		t.Errorf("Expected only the paid order in history, got %+v, %v", orders, err)
+	}
+	if orders, err := c.GetOrdersPage(ctx, "user-1", DateRange{}, nil, 10); err != nil || len(orders) != 1 || orders[0].OrderID != "order-1" {
+		t.Errorf("Expected only the paid order in a history page, got %+v, %v", orders, err)
+	}
+	if orders, err := c.SearchOrders(ctx, OrderSearch{}, nil, 10); err != nil || len(orders) != 1 || orders[0].OrderID != "order-1" {
+		t.Errorf("Expected only the paid order in search, got %+v, %v", orders, err)
+	}
+
+	// Only pending orders are dropped.
+	for _, id := range []string{"order-1", "order-2"} {
+		if err := c.DeletePendingOrder(ctx, id); err != nil {
+			t.Fatalf("DeletePendingOrder(%s) failed: %v", id, err)
+		}
+	}
+	if order, items, err := c.GetPlacedOrder(ctx, "order-1"); err != nil || order.Status != models.StatusPaid || len(items) != 1 {
+		t.Errorf("Expected the paid order to be kept, got %+v, %v, %v", order, items, err)
+	}
+	if _, _, err := c.GetPlacedOrder(ctx, "order-2"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected the pending order to be dropped, got %v", err)
+	}
+
+	var events int
+	if err := c.DB.QueryRow(`SELECT COUNT(*) FROM order_events WHERE event_type = $1`, models.EventOrderPlaced).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if events != 1 {
+		t.Errorf("Expected one order_placed event, for the completed order, got %d", events)
+	}
+}
+
+func TestIntegrationWritePathSpans(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	ctx := context.Background()
+
+	for _, id := range []string{"order-1", "order-2"} {
+		order := &models.Order{OrderID: id, UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusPending}
+		if err := c.SaveOrder(ctx, order, nil); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+	}
+	if _, err := c.CompleteOrder(ctx, "order-1", models.StatusPaid, "TRACK-1", nil); err != nil {
+		t.Fatalf("CompleteOrder failed: %v", err)
+	}
+	if err := c.EnqueueConfirmation(ctx, "order-1", "a@example.com", []byte(`{}`)); err != nil {
+		t.Fatalf("EnqueueConfirmation failed: %v", err)
+	}
+	if err := c.DeletePendingOrder(ctx, "order-2"); err != nil {
+		t.Fatalf("DeletePendingOrder failed: %v", err)
+	}
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	want := "postgres ReserveOrder, postgres ReserveOrder, postgres CompleteOrder, postgres EnqueueConfirmation, postgres DeletePendingOrder"
+	if got := strings.Join(names, ", "); got != want {
+		t.Errorf("Expected spans %s, got %s", want, got)
+	}
+}
+
+func TestIntegrationDeleteStalePendingOrders(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	for id, order := range map[string]*models.Order{
+		"stale":  {Status: models.StatusPending, OrderDate: time.Now().Add(-time.Hour)},
+		"recent": {Status: models.StatusPending},
+		"paid":   {Status: models.StatusPaid, OrderDate: time.Now().Add(-time.Hour)},
+	} {
+		order.OrderID = id
+		order.UserID = "user-1"
+		order.TotalAmountCurrency = "USD"
+		items := []models.OrderItem{{OrderID: id, ProductID: "p1", Quantity: 1, UnitPriceCurrency: "USD", TotalPriceCurrency: "USD"}}
+		if err := c.SaveOrder(ctx, order, items); err != nil {
+			t.Fatalf("SaveOrder(%s) failed: %v", id, err)
+		}
+	}
+
+	deleted, err := c.DeleteStalePendingOrders(ctx, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("DeleteStalePendingOrders failed: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].OrderID != "stale" || deleted[0].UserID != "user-1" {
+		t.Errorf("Expected only the stale order to be deleted, got %+v", deleted)
+	}
+	for _, id := range []string{"recent", "paid"} {
+		if _, _, err := c.GetPlacedOrder(ctx, id); err != nil {
+			t.Errorf("Expected order %s to be kept, got %v", id, err)
+		}
+	}
+}
+
+func TestIntegrationOrderHolds(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusPending}
+	if err := c.SaveOrder(ctx, order, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+	hold := &models.OrderHold{OrderID: "order-1", TransactionID: "tx-1", Address: &pb.Address{City: "Berlin", Country: "Germany"}}
+	if _, err := c.CompleteOrder(ctx, "order-1", models.StatusUnderReview, "", hold); err != nil {
+		t.Fatalf("CompleteOrder failed: %v", err)
+	}
+
+	got, err := c.TakeOrderHold(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("TakeOrderHold failed: %v", err)
+	}
+	if got.TransactionID != "tx-1" || got.Address.GetCity() != "Berlin" {
+		t.Errorf("Unexpected hold %+v", got)
+	}
+	if _, err := c.TakeOrderHold(ctx, "order-1"); !errors.Is(err, ErrNoOrderHold) {
+		t.Errorf("Expected a taken hold to be gone, got %v", err)
+	}
+	if err := c.PutOrderHold(ctx, got); err != nil {
+		t.Fatalf("PutOrderHold failed: %v", err)
+	}
+	if _, err := c.TakeOrderHold(ctx, "order-1"); err != nil {
+		t.Errorf("Expected the hold to be back, got %v", err)
+	}
+
+	released, err := c.ReleaseOrder(ctx, "order-1", "TRACK-1", "looks fine")
+	if err != nil {
+		t.Fatalf("ReleaseOrder failed: %v", err)
+	}
+	if released.Status != models.StatusPaid || released.ShippingTrackingID != "TRACK-1" {
+		t.Errorf("Unexpected released order %+v", released)
+	}
+	if _, err := c.ReleaseOrder(ctx, "order-1", "TRACK-1", ""); !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected releasing twice to fail with ErrInvalidStatusTransition, got %v", err)
+	}
+
+	// Holds of orders no longer under review can't be taken.
+	if err := c.PutOrderHold(ctx, got); err != nil {
+		t.Fatalf("PutOrderHold failed: %v", err)
+	}
+	if _, err := c.TakeOrderHold(ctx, "order-1"); !errors.Is(err, ErrNoOrderHold) {
+		t.Errorf("Expected the hold of a paid order not to be taken, got %v", err)
+	}
+}
+
+func TestIntegrationUpdateOrderStatus(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+	if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	got, err := c.UpdateOrderStatus(context.Background(), "order-1", models.StatusShipped, "handed to carrier")
+	if err != nil {
+		t.Fatalf("UpdateOrderStatus failed: %v", err)
+	}
+	if got.Status != models.StatusShipped || got.UserID != "user-1" {
+		t.Errorf("Expected shipped order of user-1, got %+v", got)
+	}
+	if _, err := c.UpdateOrderStatus(context.Background(), "order-1", models.StatusPending, ""); !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+	if _, err := c.UpdateOrderStatus(context.Background(), "order-missing", models.StatusShipped, ""); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+
+	rows, err := c.DB.Query(`SELECT COALESCE(from_status, ''), to_status, reason
+		FROM order_status_history WHERE order_id = 'order-1' ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type statusChange struct{ from, to, reason string }
+	var history []statusChange
+	for rows.Next() {
+		var change statusChange
+		if err := rows.Scan(&change.from, &change.to, &change.reason); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, change)
+	}
+	want := []statusChange{
+		{"", models.StatusPaid, ""},
+		{models.StatusPaid, models.StatusShipped, "handed to carrier"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("Expected status history %+v, got %+v", want, history)
+	}
+	for i := range want {
+		if history[i] != want[i] {
+			t.Errorf("Status change %d: expected %+v, got %+v", i, want[i], history[i])
+		}
+	}
+}
+
+// TestIntegrationMigrateUnversionedDatabase migrates a database created
+// before versioned migrations, holding orders from before the status
+// lifecycle.
+func TestIntegrationMigrateUnversionedDatabase(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	if _, err := c.DB.Exec(`DROP TABLE schema_migrations`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DB.Exec(`INSERT INTO order_history (order_id, user_id, status) VALUES ('order-old', 'user-1', 'completed')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.migrate(context.Background()); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	got, err := c.GetOrderByID(context.Background(), "order-old")
+	if err != nil {
+		t.Fatalf("GetOrderByID failed: %v", err)
+	}
+	if got.Status != models.StatusPaid {
+		t.Errorf("Expected legacy order to be paid, got %s", got.Status)
+	}
+}
+
+func TestIntegrationMigrateTwice(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.migrate(context.Background()); err != nil {
+		t.Fatalf("second migrate failed: %v", err)
+	}
+
+	var count, latest int
+	if err := c.DB.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&count, &latest); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(migrations) || latest != migrations[len(migrations)-1].version {
+		t.Errorf("Expected %d migrations applied once, got %d up to version %d", len(migrations), count, latest)
+	}
+}
+
+func TestIntegrationCancelOrder(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	for _, id := range []string{"order-1", "order-2"} {
+		order := &models.Order{OrderID: id, UserID: "user-1", TotalAmountCurrency: "USD", TotalAmountUnits: 10, Status: models.StatusPaid}
+		if err := c.SaveOrder(context.Background(), order, nil); err != nil {
+			t.Fatalf("SaveOrder(%s) failed: %v", id, err)
+		}
+	}
+
+	if _, err := c.CancelOrder(context.Background(), "user-2", "order-1", "not mine"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+	got, err := c.CancelOrder(context.Background(), "user-1", "order-1", "changed my mind")
+	if err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+	if got.Status != models.StatusCancelled {
+		t.Errorf("Expected cancelled order, got %+v", got)
+	}
+	if _, err := c.CancelOrder(context.Background(), "user-1", "order-1", "again"); !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+	if _, err := c.CancelOrder(context.Background(), "user-1", "order-2", "changed my mind"); err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+
+	// A failed publish leaves the events in the outbox.
+	failed := errors.New("pubsub down")
+	if _, err := c.PublishOrderEvents(context.Background(), 10, time.Minute, func([]models.OrderEvent) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("Expected %v, got %v", failed, err)
+	}
+
+	var published []models.OrderEvent
+	for {
+		n, err := c.PublishOrderEvents(context.Background(), 1, time.Minute, func(events []models.OrderEvent) error {
+			for _, e := range events {
+				if e.Type == models.EventOrderCancelled {
+					published = append(published, e)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("PublishOrderEvents failed: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if len(published) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", published)
+	}
+	e := published[0]
+	if e.Type != models.EventOrderCancelled || e.FromStatus != models.StatusPaid || e.Reason != "changed my mind" ||
+		e.Order.OrderID != "order-1" || e.Order.TotalAmountUnits != 10 || e.CreatedAt.IsZero() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if published[1].Order.OrderID != "order-2" {
+		t.Errorf("Expected the second event to be for order-2, got %+v", published[1])
+	}
+}
+
+func TestIntegrationReturns(t *testing.T) {
+	c := setupIntegrationConnection(t)
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusDelivered}
+	items := []models.OrderItem{
+		{OrderID: "order-1", ProductID: "PRODUCT-1", Quantity: 2, UnitPriceCurrency: "USD", UnitPriceUnits: 15, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 31, TotalPriceNanos: 980000000},
+		{OrderID: "order-1", ProductID: "PRODUCT-2", Quantity: 1, UnitPriceCurrency: "USD", UnitPriceUnits: 9, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 9, TotalPriceNanos: 990000000},
+	}
+	if err := c.SaveOrder(context.Background(), order, items); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	ret := &models.OrderReturn{ReturnID: "return-1", OrderID: "order-1", UserID: "user-1", Reason: "too small",
+		Items: []models.ReturnItem{{ProductID: "PRODUCT-1", Quantity: 1}}}
+	if err := c.CreateReturn(context.Background(), ret); err != nil {
+		t.Fatalf("CreateReturn failed: %v", err)
+	}
+	var orderItemID int
+	if err := c.DB.QueryRow(`SELECT id FROM order_items WHERE order_id = 'order-1' AND product_id = 'PRODUCT-1'`).Scan(&orderItemID); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Items[0].OrderItemID != orderItemID || ret.Status != models.ReturnRequested || ret.CreatedAt.IsZero() {
+		t.Errorf("Expected a requested return of order item %d, got %+v", orderItemID, ret)
+	}
+
+	// Only one PRODUCT-1 is left to return.
+	over := &models.OrderReturn{ReturnID: "return-2", OrderID: "order-1", UserID: "user-1",
+		Items: []models.ReturnItem{{ProductID: "PRODUCT-1", Quantity: 2}}}
+	if err := c.CreateReturn(context.Background(), over); !errors.Is(err, models.ErrInvalidReturn) {
+		t.Errorf("Expected ErrInvalidReturn, got %v", err)
+	}
+	other := &models.OrderReturn{ReturnID: "return-3", OrderID: "order-1", UserID: "user-2",
+		Items: []models.ReturnItem{{ProductID: "PRODUCT-2", Quantity: 1}}}
+	if err := c.CreateReturn(context.Background(), other); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+
+	approved, err := c.ApproveReturn(context.Background(), "return-1", func(ret *models.OrderReturn) (models.Refund, error) {
+		if ret.Status != models.ReturnRequested || len(ret.Items) != 1 {
+			t.Errorf("Expected the requested return with its item, got %+v", ret)
+		}
+		return models.Refund{AmountCurrency: "USD", AmountUnits: 15, AmountNanos: 990000000}, nil
+	})
+	if err != nil {
+		t.Fatalf("ApproveReturn failed: %v", err)
+	}
+	if approved.Status != models.ReturnApproved || approved.Refund == nil || approved.Refund.AmountUnits != 15 ||
+		approved.Refund.OrderID != "order-1" || len(approved.Items) != 1 || approved.Items[0].UnitPriceUnits != 15 {
+		t.Errorf("Unexpected approved return %+v", approved)
+	}
+	refundNothing := func(*models.OrderReturn) (models.Refund, error) { return models.Refund{AmountCurrency: "USD"}, nil }
+	if _, err := c.ApproveReturn(context.Background(), "return-1", refundNothing); !errors.Is(err, models.ErrNotReturnable) {
+		t.Errorf("Expected ErrNotReturnable, got %v", err)
+	}
+	if _, err := c.GetReturn(context.Background(), "return-missing"); !errors.Is(err, ErrReturnNotFound) {
+		t.Errorf("Expected ErrReturnNotFound, got %v", err)
+	}
+}
+
+func TestIntegrationAddresses(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	home := &models.SavedAddress{AddressID: "addr-home", UserID: "user-1", StreetAddress: "1 Main St", City: "Springfield", Country: "US"}
+	work := &models.SavedAddress{AddressID: "addr-work", UserID: "user-1", StreetAddress: "2 Side St", City: "Springfield", Country: "US"}
+	for _, addr := range []*models.SavedAddress{home, work} {
+		if err := c.AddAddress(ctx, addr); err != nil {
+			t.Fatalf("AddAddress failed: %v", err)
+		}
+	}
+	if !home.IsDefault || work.IsDefault || home.CreatedAt.IsZero() {
+		t.Errorf("Expected only the first address to be the default, got %+v and %+v", home, work)
+	}
+
+	if _, err := c.SetDefaultAddress(ctx, "user-2", "addr-work"); !errors.Is(err, ErrAddressNotFound) {
+		t.Errorf("Expected ErrAddressNotFound for another user's address, got %v", err)
+	}
+	if _, err := c.SetDefaultAddress(ctx, "user-1", "addr-work"); err != nil {
+		t.Fatalf("SetDefaultAddress failed: %v", err)
+	}
+	addrs, err := c.ListAddresses(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("ListAddresses failed: %v", err)
+	}
+	if len(addrs) != 2 || addrs[0].AddressID != "addr-work" || !addrs[0].IsDefault || addrs[1].IsDefault {
+		t.Errorf("Expected the work address first as the only default, got %+v", addrs)
+	}
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", AddressID: "addr-work", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+	if err := c.SaveOrder(ctx, order, []models.OrderItem{{ProductID: "p1", Quantity: 1}}); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+	if got, err := c.GetOrderByID(ctx, "order-1"); err != nil || got.AddressID != "addr-work" {
+		t.Errorf("Expected the order to link to its address, got %+v, %v", got, err)
+	}
+
+	if err := c.DeleteAddress(ctx, "user-1", "addr-work"); err != nil {
+		t.Fatalf("DeleteAddress failed: %v", err)
+	}
+	if got, err := c.GetOrderByID(ctx, "order-1"); err != nil || got.AddressID != "" {
+		t.Errorf("Expected the order to lose the link to the deleted address, got %+v, %v", got, err)
+	}
+	if got, err := c.GetAddress(ctx, "user-1", "addr-home"); err != nil || !got.IsDefault {
+		t.Errorf("Expected the remaining address to become the default, got %+v, %v", got, err)
+	}
+	if err := c.DeleteAddress(ctx, "user-1", "addr-work"); !errors.Is(err, ErrAddressNotFound) {
+		t.Errorf("Expected ErrAddressNotFound deleting twice, got %v", err)
+	}
+
+	// An address deleted while the order was placed is dropped from it.
+	order = &models.Order{OrderID: "order-2", UserID: "user-1", AddressID: "addr-work", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+	if err := c.SaveOrder(ctx, order, []models.OrderItem{{ProductID: "p1", Quantity: 1}}); err != nil {
+		t.Fatalf("SaveOrder with a deleted address failed: %v", err)
+	}
+	if got, err := c.GetOrderByID(ctx, "order-2"); err != nil || got.AddressID != "" {
+		t.Errorf("Expected no address link, got %+v, %v", got, err)
+	}
+}
+
+func TestIntegrationShipments(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", TotalAmountCurrency: "USD", Status: models.StatusPaid}
+	items := []models.OrderItem{
+		{OrderID: "order-1", ProductID: "PRODUCT-1", Quantity: 2, UnitPriceCurrency: "USD", UnitPriceUnits: 15, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 31, TotalPriceNanos: 980000000},
+		{OrderID: "order-1", ProductID: "PRODUCT-2", Quantity: 1, UnitPriceCurrency: "USD", UnitPriceUnits: 9, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 9, TotalPriceNanos: 990000000},
+	}
+	if err := c.SaveOrder(ctx, order, items); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+
+	first := &models.Shipment{ShipmentID: "shipment-1", OrderID: "order-1", TrackingID: "TRACK-1", Carrier: "UPS",
+		Items: []models.ShipmentItem{{ProductID: "PRODUCT-1", Quantity: 1}, {ProductID: "PRODUCT-2", Quantity: 1}}}
+	if err := c.CreateShipment(ctx, first); err != nil {
+		t.Fatalf("CreateShipment failed: %v", err)
+	}
+	var orderItemID int
+	if err := c.DB.QueryRow(`SELECT id FROM order_items WHERE order_id = 'order-1' AND product_id = 'PRODUCT-1'`).Scan(&orderItemID); err != nil {
+		t.Fatal(err)
+	}
+	if first.Items[0].OrderItemID != orderItemID || first.Status != models.ShipmentShipped || first.CreatedAt.IsZero() {
+		t.Errorf("Expected a shipment of order item %d, got %+v", orderItemID, first)
+	}
+
+	// Only one PRODUCT-1 is left to ship.
+	over := &models.Shipment{ShipmentID: "shipment-2", OrderID: "order-1", TrackingID: "TRACK-2",
+		Items: []models.ShipmentItem{{ProductID: "PRODUCT-1", Quantity: 2}}}
+	if err := c.CreateShipment(ctx, over); !errors.Is(err, models.ErrInvalidShipment) {
+		t.Errorf("Expected ErrInvalidShipment shipping more than is left, got %v", err)
+	}
+	over.Items = []models.ShipmentItem{{ProductID: "PRODUCT-1", Quantity: 1}}
+	if err := c.CreateShipment(ctx, over); err != nil {
+		t.Fatalf("CreateShipment failed: %v", err)
+	}
+
+	delivered, err := c.UpdateShipmentStatus(ctx, "shipment-1", models.ShipmentDelivered)
+	if err != nil {
+		t.Fatalf("UpdateShipmentStatus failed: %v", err)
+	}
+	if delivered.Status != models.ShipmentDelivered || len(delivered.Items) != 2 || delivered.UpdatedAt.Before(delivered.CreatedAt) {
+		t.Errorf("Expected the delivered shipment with its items, got %+v", delivered)
+	}
+	if _, err := c.UpdateShipmentStatus(ctx, "shipment-1", models.ShipmentDelivered); !errors.Is(err, models.ErrNotShippable) {
+		t.Errorf("Expected ErrNotShippable delivering twice, got %v", err)
+	}
+	if _, err := c.UpdateShipmentStatus(ctx, "shipment-9", models.ShipmentDelivered); !errors.Is(err, ErrShipmentNotFound) {
+		t.Errorf("Expected ErrShipmentNotFound, got %v", err)
+	}
+
+	shipments, err := c.GetShipments(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("GetShipments failed: %v", err)
+	}
+	if len(shipments) != 2 || shipments[0].ShipmentID != "shipment-1" || len(shipments[1].Items) != 1 {
+		t.Fatalf("Unexpected shipments %+v", shipments)
+	}
+	stored, err := c.GetOrderItems(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("GetOrderItems failed: %v", err)
+	}
+	fulfillment := models.Fulfillment(stored, shipments)
+	if fulfillment[0].Status() != models.FulfillmentShipped || fulfillment[1].Status() != models.FulfillmentDelivered {
+		t.Errorf("Unexpected fulfillment %+v", fulfillment)
+	}
+}
+
+func TestIntegrationClaimGuestOrders(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	for _, order := range []*models.Order{
+		{OrderID: "guest-1", UserID: "", Email: "Guest@Example.com", TotalAmountCurrency: "USD", Status: models.StatusPaid},
+		{OrderID: "guest-2", UserID: "", Email: "other@example.com", TotalAmountCurrency: "USD", Status: models.StatusPaid},
+		{OrderID: "user-order", UserID: "user-2", Email: "guest@example.com", TotalAmountCurrency: "USD", Status: models.StatusPaid},
+	} {
+		if err := c.SaveOrder(ctx, order, []models.OrderItem{{ProductID: "p1", Quantity: 1}}); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+	}
+
+	orderIDs, err := c.ClaimGuestOrders(ctx, "user-1", "guest@example.com")
+	if err != nil {
+		t.Fatalf("ClaimGuestOrders failed: %v", err)
+	}
+	if len(orderIDs) != 1 || orderIDs[0] != "guest-1" {
+		t.Fatalf("Expected guest-1 to be claimed, got %v", orderIDs)
+	}
+	for orderID, userID := range map[string]string{"guest-1": "user-1", "guest-2": "", "user-order": "user-2"} {
+		if got, err := c.GetOrderByID(ctx, orderID); err != nil || got.UserID != userID {
+			t.Errorf("Expected order %s to belong to %q, got %+v, %v", orderID, userID, got, err)
+		}
+	}
+
+	if orderIDs, err := c.ClaimGuestOrders(ctx, "user-3", "guest@example.com"); err != nil || len(orderIDs) != 0 {
+		t.Errorf("Expected nothing left to claim, got %v, %v", orderIDs, err)
+	}
+}
+
+func TestIntegrationSearchOrders(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	ctx := context.Background()
+
+	date := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"order-a", "order-b", "order-c"} {
+		order := &models.Order{OrderID: id, UserID: "user-" + id, Email: "customer@example.com",
+			TotalAmountCurrency: "USD", TotalAmountUnits: int64(10 * (i + 1)), OrderDate: date.AddDate(0, 0, i), Status: models.StatusPaid}
+		product := "PRODUCT-2"
+		if i == 0 {
+			order.Email, product = "Other@Example.com", "PRODUCT-1"
+		}
+		if err := c.SaveOrder(ctx, order, []models.OrderItem{{ProductID: product, Quantity: 1}}); err != nil {
+			t.Fatalf("SaveOrder failed: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		search OrderSearch
+		after  *SearchCursor
+		want   string
+	}{
+		{"all", OrderSearch{}, nil, "[order-c order-b order-a]"},
+		{"email", OrderSearch{Email: "OTHER@example.com"}, nil, "[order-a]"},
+		{"product", OrderSearch{ProductID: "PRODUCT-2", Status: models.StatusPaid}, nil, "[order-c order-b]"},
+		{"dates", OrderSearch{Dates: DateRange{From: date.AddDate(0, 0, 1)}}, nil, "[order-c order-b]"},
+		{"total", OrderSearch{Currency: "USD", MinTotal: &Amount{Units: 15}, MaxTotal: &Amount{Units: 30}, SortBy: SortByTotal, Ascending: true}, nil, "[order-b order-c]"},
+		{"after date", OrderSearch{}, &SearchCursor{OrderDate: date.AddDate(0, 0, 2), OrderID: "order-c"}, "[order-b order-a]"},
+		{"after total", OrderSearch{SortBy: SortByTotal}, &SearchCursor{Total: Amount{Units: 20}, OrderID: "order-b"}, "[order-a]"},
+	} {
+		orders, err := c.SearchOrders(ctx, tc.search, tc.after, 10)
+		if err != nil {
+			t.Fatalf("%s: SearchOrders failed: %v", tc.name, err)
+		}
+		ids := make([]string, len(orders))
+		for i, order := range orders {
+			ids[i] = order.OrderID
+		}
+		if got := fmt.Sprint(ids); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIntegrationSkipPublish(t *testing.T) {
+	c := setupIntegrationConnection(t)
+	c.config.SkipPublish = true
+	c.config.SkipWebhooks = true
+	ctx := context.Background()
+
+	if err := c.SaveOrder(ctx, &models.Order{OrderID: "order-1", UserID: "user-1", Status: models.StatusPaid}, nil); err != nil {
+		t.Fatalf("SaveOrder failed: %v", err)
+	}
+	n, err := c.PublishOrderEvents(ctx, 10, time.Minute, func(events []models.OrderEvent) error {
+		t.Errorf("Expected no events to publish without a topic, got %+v", events)
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Errorf("PublishOrderEvents = %d, %v; want 0, nil", n, err)
+	}
+	if n, err := c.QueueWebhooks(ctx, []string{"https://a.example.com"}, 10); err != nil || n != 0 {
+		t.Errorf("QueueWebhooks = %d, %v; want no events queued", n, err)
+	}
+	var publishSkipped, webhooksSkipped bool
+	err = c.DB.QueryRow(`SELECT publish_skipped, webhooks_skipped FROM order_events WHERE order_id = 'order-1'`).Scan(&publishSkipped, &webhooksSkipped)
+	if err != nil || !publishSkipped || !webhooksSkipped {
+		t.Errorf("Expected the event marked skipped, got %v, %v, %v", publishSkipped, webhooksSkipped, err)
+	}
+}
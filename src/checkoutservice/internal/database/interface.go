@@ -1,14 +1,49 @@
 package database
 
 import (
+	"context"
+	"time"
+
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
 )
 
 // DatabaseInterface defines the contract for database operations
 type DatabaseInterface interface {
-	SaveOrder(order *models.Order, items []models.OrderItem) error
-	GetOrdersByUser(userID string) ([]models.Order, error)
-	GetOrderItems(orderID string) ([]models.OrderItem, error)
+	SaveOrder(ctx context.Context, order *models.Order, items []models.OrderItem) error
+	CompleteOrder(ctx context.Context, orderID, status, trackingID string, hold *models.OrderHold) (*models.Order, error)
+	TakeOrderHold(ctx context.Context, orderID string) (*models.OrderHold, error)
+	PutOrderHold(ctx context.Context, hold *models.OrderHold) error
+	ReleaseOrder(ctx context.Context, orderID, trackingID, reason string) (*models.Order, error)
+	DeletePendingOrder(ctx context.Context, orderID string) error
+	DeleteStalePendingOrders(ctx context.Context, olderThan time.Duration) ([]models.Order, error)
+	GetPlacedOrder(ctx context.Context, orderID string) (*models.Order, []models.OrderItem, error)
+	GetOrdersByUser(ctx context.Context, userID string) (orders []models.Order, truncated bool, err error)
+	GetOrdersPage(ctx context.Context, userID string, dates DateRange, after *OrderCursor, limit int) ([]models.Order, error)
+	SearchOrders(ctx context.Context, search OrderSearch, after *SearchCursor, limit int) ([]models.Order, error)
+	GetOrderByID(ctx context.Context, orderID string) (*models.Order, error)
+	GetOrderByTrackingID(ctx context.Context, trackingID string) (*models.Order, error)
+	GetUserOrderStats(ctx context.Context, userID string, topProducts int) (*models.UserOrderStats, error)
+	GetOrderItems(ctx context.Context, orderID string) ([]models.OrderItem, error)
+	UpdateOrderStatus(ctx context.Context, orderID, status, reason string) (*models.Order, error)
+	CancelOrder(ctx context.Context, userID, orderID, reason string) (*models.Order, error)
+	PublishOrderEvents(ctx context.Context, limit int, lease time.Duration, publish func([]models.OrderEvent) error) (int, error)
+	EnqueueConfirmation(ctx context.Context, orderID, email string, order []byte) error
+	DeliverConfirmations(ctx context.Context, limit int, lease time.Duration, deliver func(models.Confirmation) error, retryIn func(attempts int) (time.Duration, bool)) (int, error)
+	QueueWebhooks(ctx context.Context, endpoints []string, limit int) (int, error)
+	DeliverWebhooks(ctx context.Context, limit int, lease time.Duration, deliver func(models.WebhookDelivery) error, retryIn func(attempts int) (time.Duration, bool)) (int, error)
+	AnonymizeUserData(ctx context.Context, userID, pseudonym string) (int, error)
+	ClaimGuestOrders(ctx context.Context, userID, email string) ([]string, error)
+	CreateReturn(ctx context.Context, ret *models.OrderReturn) error
+	GetReturn(ctx context.Context, returnID string) (*models.OrderReturn, error)
+	ApproveReturn(ctx context.Context, returnID string, refundFor func(*models.OrderReturn) (models.Refund, error)) (*models.OrderReturn, error)
+	AddAddress(ctx context.Context, addr *models.SavedAddress) error
+	ListAddresses(ctx context.Context, userID string) ([]models.SavedAddress, error)
+	GetAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error)
+	DeleteAddress(ctx context.Context, userID, addressID string) error
+	SetDefaultAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error)
+	CreateShipment(ctx context.Context, s *models.Shipment) error
+	GetShipments(ctx context.Context, orderID string) ([]models.Shipment, error)
+	UpdateShipmentStatus(ctx context.Context, shipmentID, status string) (*models.Shipment, error)
 	Close() error
 }
 
@@ -1,58 +1,235 @@
 package database
 
-import "fmt"
-
-// createTables creates the required database tables and indexes
-func (c *Connection) createTables() error {
-	// Create order_history table
-	orderHistorySQL := `
-	CREATE TABLE IF NOT EXISTS order_history (
-		order_id VARCHAR(255) PRIMARY KEY,
-		user_id VARCHAR(255) NOT NULL,
-		email VARCHAR(255),
-		total_amount_currency VARCHAR(10),
-		total_amount_units BIGINT,
-		total_amount_nanos INTEGER,
-		shipping_tracking_id VARCHAR(255),
-		shipping_address TEXT,
-		order_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		status VARCHAR(50) DEFAULT 'completed'
-	);`
-
-	if _, err := c.DB.Exec(orderHistorySQL); err != nil {
-		return fmt.Errorf("failed to create order_history table: %v", err)
-	}
-
-	// Create order_items table
-	orderItemsSQL := `
-	CREATE TABLE IF NOT EXISTS order_items (
-		id SERIAL PRIMARY KEY,
-		order_id VARCHAR(255) REFERENCES order_history(order_id) ON DELETE CASCADE,
-		product_id VARCHAR(255) NOT NULL,
-		quantity INTEGER NOT NULL,
-		unit_price_currency VARCHAR(10),
-		unit_price_units BIGINT,
-		unit_price_nanos INTEGER,
-		total_price_currency VARCHAR(10),
-		total_price_units BIGINT,
-		total_price_nanos INTEGER
-	);`
-
-	if _, err := c.DB.Exec(orderItemsSQL); err != nil {
-		return fmt.Errorf("failed to create order_items table: %v", err)
-	}
-
-	// Create indexes for performance
-	indexSQL := `
-	CREATE INDEX IF NOT EXISTS idx_order_history_user_id ON order_history(user_id);
-	CREATE INDEX IF NOT EXISTS idx_order_history_date ON order_history(order_date);
-	CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
-	CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items(product_id);`
-
-	if _, err := c.DB.Exec(indexSQL); err != nil {
-		return fmt.Errorf("failed to create indexes: %v", err)
-	}
-
-	c.log.Info("Database tables created successfully")
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the schema migrations, named NNNN_description.sql.
+// Applied migrations must not be edited; change the schema with a new file.
+// A migration whose first line is noTransactionMarker runs outside a
+// transaction, one statement at a time, as CREATE INDEX CONCURRENTLY needs.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// noTransactionMarker opens migrations that run outside a transaction. Their
+// statements are split at semicolons, so they must not contain any.
+const noTransactionMarker = "-- migrate: no-transaction"
+
+// migration is one versioned schema change.
+type migration struct {
+	version       int
+	name          string
+	sql           string
+	noTransaction bool
+}
+
+// statements splits the SQL of m into statements, leaving out comments.
+func (m migration) statements() []string {
+	var lines []string
+	for _, line := range strings.Split(m.sql, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+const (
+	createSchemaMigrationsSQL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	// Migrations may wait for another replica and rebuild large tables, so
+	// they run without the statement timeout.
+	noStatementTimeoutSQL = `SET LOCAL statement_timeout = 0`
+
+	// Replicas starting together take turns, so each migration is applied
+	// once.
+	lockSchemaMigrationsSQL = `
+	SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`
+
+	// Migrations outside a transaction hold the same lock for the session
+	// instead, and release it when they are done.
+	lockSchemaMigrationsSessionSQL = `
+	SELECT pg_advisory_lock(hashtext('schema_migrations'))`
+	unlockSchemaMigrationsSessionSQL = `
+	SELECT pg_advisory_unlock(hashtext('schema_migrations'))`
+	noSessionStatementTimeoutSQL    = `SET statement_timeout = 0`
+	resetSessionStatementTimeoutSQL = `RESET statement_timeout`
+
+	migrationAppliedSQL = `
+	SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`
+
+	insertMigrationSQL = `
+	INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+
+	latestMigrationSQL = `
+	SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+)
+
+// loadMigrations reads the migrations in dir of fsys, ordered by version.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %v", err)
+	}
+
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.sql", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, name)
+		}
+		seen[version] = name
+
+		sql, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", name, err)
+		}
+		migrations = append(migrations, migration{
+			version:       version,
+			name:          strings.TrimSuffix(name, ".sql"),
+			sql:           string(sql),
+			noTransaction: strings.HasPrefix(string(sql), noTransactionMarker+"\n"),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// migrate applies the embedded migrations the database has not applied yet,
+// in order, recording each in schema_migrations. Each migration runs in its
+// own transaction, so a failed one leaves the schema at the previous
+// version, unless it is marked to run outside one.
+func (c *Connection) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.DB.ExecContext(ctx, createSchemaMigrationsSQL); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	for _, m := range migrations {
+		if err := c.applyMigration(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	var latest int
+	if err := c.DB.QueryRowContext(ctx, latestMigrationSQL).Scan(&latest); err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if known := migrations[len(migrations)-1].version; latest > known {
+		c.log.Warnf("Database schema is at version %d, newer than this build's %d", latest, known)
+	}
+	c.log.Infof("Database schema is at version %d", latest)
+	return nil
+}
+
+// applyMigration applies m unless it has been applied already.
+func (c *Connection) applyMigration(ctx context.Context, m migration) error {
+	if m.noTransaction {
+		return c.applyMigrationWithoutTransaction(ctx, m)
+	}
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, noStatementTimeoutSQL); err != nil {
+		return fmt.Errorf("failed to lift statement timeout: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, lockSchemaMigrationsSQL); err != nil {
+		return fmt.Errorf("failed to lock schema_migrations: %v", err)
+	}
+	var applied bool
+	if err := tx.QueryRowContext(ctx, migrationAppliedSQL, m.version).Scan(&applied); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return fmt.Errorf("failed to apply migration %s: %v", m.name, err)
+	}
+	if _, err := tx.ExecContext(ctx, insertMigrationSQL, m.version, m.name); err != nil {
+		return fmt.Errorf("failed to record migration %s: %v", m.name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %v", m.name, err)
+	}
+	c.log.Infof("Applied database migration %s", m.name)
+	return nil
+}
+
+// applyMigrationWithoutTransaction applies m, statement by statement, unless
+// it has been applied already. A statement that fails leaves the ones before
+// it applied, so each must be safe to run again, such as CREATE INDEX
+// CONCURRENTLY IF NOT EXISTS after dropping an index a failed build left
+// invalid.
+func (c *Connection) applyMigrationWithoutTransaction(ctx context.Context, m migration) error {
+	conn, err := c.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a connection: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, noSessionStatementTimeoutSQL); err != nil {
+		return fmt.Errorf("failed to lift statement timeout: %v", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), resetSessionStatementTimeoutSQL)
+	if _, err := conn.ExecContext(ctx, lockSchemaMigrationsSessionSQL); err != nil {
+		return fmt.Errorf("failed to lock schema_migrations: %v", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), unlockSchemaMigrationsSessionSQL)
+
+	var applied bool
+	if err := conn.QueryRowContext(ctx, migrationAppliedSQL, m.version).Scan(&applied); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	if applied {
+		return nil
+	}
+	for _, stmt := range m.statements() {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %v", m.name, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, insertMigrationSQL, m.version, m.name); err != nil {
+		return fmt.Errorf("failed to record migration %s: %v", m.name, err)
+	}
+	c.log.Infof("Applied database migration %s", m.name)
 	return nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,16 @@
+-- The audit trail of status changes.
+CREATE TABLE IF NOT EXISTS order_status_history (
+	id SERIAL PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL REFERENCES order_history(order_id) ON DELETE CASCADE,
+	from_status VARCHAR(50),
+	to_status VARCHAR(50) NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history(order_id);
+
+-- Orders stored before the status lifecycle are "completed", which meant
+-- paid.
+ALTER TABLE order_history ALTER COLUMN status SET DEFAULT 'paid';
+UPDATE order_history SET status = 'paid' WHERE status = 'completed';
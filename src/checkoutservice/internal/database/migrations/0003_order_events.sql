@@ -0,0 +1,12 @@
+-- The outbox of events waiting to be published.
+CREATE TABLE IF NOT EXISTS order_events (
+	id BIGSERIAL PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL REFERENCES order_history(order_id) ON DELETE CASCADE,
+	event_type VARCHAR(50) NOT NULL,
+	from_status VARCHAR(50) NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_unpublished ON order_events(id) WHERE published_at IS NULL;
@@ -0,0 +1,31 @@
+-- Returns and their refunds. return_items links each returned quantity to
+-- the order_items row it returns.
+CREATE TABLE IF NOT EXISTS return_requests (
+	return_id VARCHAR(255) PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL REFERENCES order_history(order_id) ON DELETE CASCADE,
+	user_id VARCHAR(255) NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	status VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	decided_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS return_items (
+	return_id VARCHAR(255) NOT NULL REFERENCES return_requests(return_id) ON DELETE CASCADE,
+	order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+	quantity INTEGER NOT NULL CHECK (quantity > 0),
+	PRIMARY KEY (return_id, order_item_id)
+);
+
+CREATE TABLE IF NOT EXISTS refunds (
+	id SERIAL PRIMARY KEY,
+	return_id VARCHAR(255) NOT NULL UNIQUE REFERENCES return_requests(return_id) ON DELETE CASCADE,
+	order_id VARCHAR(255) NOT NULL REFERENCES order_history(order_id) ON DELETE CASCADE,
+	amount_currency VARCHAR(10) NOT NULL,
+	amount_units BIGINT NOT NULL,
+	amount_nanos INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_return_requests_order_id ON return_requests(order_id);
+CREATE INDEX IF NOT EXISTS idx_return_items_order_item_id ON return_items(order_item_id);
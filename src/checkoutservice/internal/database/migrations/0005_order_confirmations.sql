@@ -0,0 +1,17 @@
+-- The queue of order confirmation emails. Their delivery status is copied
+-- to order_history so order reads don't need a join.
+CREATE TABLE order_confirmations (
+	order_id VARCHAR(255) PRIMARY KEY REFERENCES order_history(order_id) ON DELETE CASCADE,
+	email VARCHAR(255) NOT NULL,
+	order_result JSONB NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_order_confirmations_due ON order_confirmations(next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE order_history ADD COLUMN confirmation_status VARCHAR(20);
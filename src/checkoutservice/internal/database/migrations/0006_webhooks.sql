@@ -0,0 +1,21 @@
+-- Webhook deliveries, one per order event and endpoint. Events are fanned out
+-- to the configured endpoints once; webhooks_queued_at marks those that were.
+-- Events recorded before webhooks existed are not delivered.
+ALTER TABLE order_events ADD COLUMN webhooks_queued_at TIMESTAMP;
+UPDATE order_events SET webhooks_queued_at = NOW();
+CREATE INDEX idx_order_events_webhooks_unqueued ON order_events(id) WHERE webhooks_queued_at IS NULL;
+
+CREATE TABLE webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	event_id BIGINT NOT NULL REFERENCES order_events(id) ON DELETE CASCADE,
+	endpoint TEXT NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	delivered_at TIMESTAMP,
+	UNIQUE (event_id, endpoint)
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
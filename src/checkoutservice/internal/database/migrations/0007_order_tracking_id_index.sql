@@ -0,0 +1,6 @@
+-- migrate: no-transaction
+-- Support looks orders up by the tracking ID on their shipping label. The
+-- index is built without blocking order writes; a build that failed left it
+-- invalid, so it is dropped first.
+DROP INDEX CONCURRENTLY IF EXISTS idx_order_history_tracking_id;
+CREATE INDEX CONCURRENTLY idx_order_history_tracking_id ON order_history(shipping_tracking_id);
@@ -0,0 +1,3 @@
+-- When a user's personal data was erased from the order. The order itself,
+-- with its totals and items, is kept as a financial record.
+ALTER TABLE order_history ADD COLUMN anonymized_at TIMESTAMP;
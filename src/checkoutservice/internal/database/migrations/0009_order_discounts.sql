@@ -0,0 +1,11 @@
+-- The discount code of an order, the amount it saved, and the items'
+-- subtotal before it, for reconciling promotions. Orders saved earlier have
+-- NULLs.
+ALTER TABLE order_history
+	ADD COLUMN discount_code VARCHAR(255),
+	ADD COLUMN discount_amount_currency VARCHAR(10),
+	ADD COLUMN discount_amount_units BIGINT,
+	ADD COLUMN discount_amount_nanos INTEGER,
+	ADD COLUMN subtotal_amount_currency VARCHAR(10),
+	ADD COLUMN subtotal_amount_units BIGINT,
+	ADD COLUMN subtotal_amount_nanos INTEGER;
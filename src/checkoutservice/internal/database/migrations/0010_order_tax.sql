@@ -0,0 +1,8 @@
+-- The tax included in an order's total, and its breakdown by jurisdiction
+-- as a JSON array of {"jurisdiction", "currency", "units", "nanos"}
+-- objects. Orders saved earlier have NULLs.
+ALTER TABLE order_history
+	ADD COLUMN tax_amount_currency VARCHAR(10),
+	ADD COLUMN tax_amount_units BIGINT,
+	ADD COLUMN tax_amount_nanos INTEGER,
+	ADD COLUMN tax_breakdown JSONB;
@@ -0,0 +1,20 @@
+-- Users' saved shipping addresses. A user has at most one default address.
+-- Orders link to the saved address they were shipped to, if any; the link
+-- is cleared when the address is deleted, as orders keep their own copy.
+CREATE TABLE addresses (
+	address_id VARCHAR(255) PRIMARY KEY,
+	user_id VARCHAR(255) NOT NULL,
+	street_address TEXT NOT NULL,
+	city VARCHAR(255) NOT NULL,
+	state VARCHAR(255) NOT NULL DEFAULT '',
+	country VARCHAR(255) NOT NULL,
+	zip_code INTEGER NOT NULL DEFAULT 0,
+	is_default BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_addresses_user_id ON addresses(user_id);
+CREATE UNIQUE INDEX idx_addresses_user_default ON addresses(user_id) WHERE is_default;
+
+ALTER TABLE order_history
+	ADD COLUMN address_id VARCHAR(255) REFERENCES addresses(address_id) ON DELETE SET NULL;
@@ -0,0 +1,21 @@
+-- Shipments of orders, which may be split across warehouses. shipment_items
+-- links each shipped quantity to the order_items row it ships.
+CREATE TABLE shipments (
+	shipment_id VARCHAR(255) PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL REFERENCES order_history(order_id) ON DELETE CASCADE,
+	tracking_id VARCHAR(255) NOT NULL,
+	carrier VARCHAR(255) NOT NULL DEFAULT '',
+	status VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE shipment_items (
+	shipment_id VARCHAR(255) NOT NULL REFERENCES shipments(shipment_id) ON DELETE CASCADE,
+	order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+	quantity INTEGER NOT NULL CHECK (quantity > 0),
+	PRIMARY KEY (shipment_id, order_item_id)
+);
+
+CREATE INDEX idx_shipments_order_id ON shipments(order_id);
+CREATE INDEX idx_shipment_items_order_item_id ON shipment_items(order_item_id);
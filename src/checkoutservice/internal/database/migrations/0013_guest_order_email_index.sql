@@ -0,0 +1,6 @@
+-- migrate: no-transaction
+-- Guest orders, placed without a user ID, are claimed by email. The index is
+-- built without blocking order writes; a build that failed left it invalid,
+-- so it is dropped first.
+DROP INDEX CONCURRENTLY IF EXISTS idx_order_history_guest_email;
+CREATE INDEX CONCURRENTLY idx_order_history_guest_email ON order_history(LOWER(email)) WHERE user_id = '';
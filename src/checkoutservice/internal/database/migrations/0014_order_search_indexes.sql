@@ -0,0 +1,17 @@
+-- migrate: no-transaction
+-- Support searches orders of all users by email, status, date and total,
+-- and pages through them by date or total with the order ID breaking ties.
+-- Searches by product use idx_order_items_product_id.
+-- The indexes are built without blocking order writes; a build that failed
+-- left its index invalid, so each is dropped first.
+DROP INDEX CONCURRENTLY IF EXISTS idx_order_history_email_date;
+CREATE INDEX CONCURRENTLY idx_order_history_email_date ON order_history(LOWER(email), order_date DESC, order_id DESC);
+DROP INDEX CONCURRENTLY IF EXISTS idx_order_history_status_date;
+CREATE INDEX CONCURRENTLY idx_order_history_status_date ON order_history(status, order_date DESC, order_id DESC);
+DROP INDEX CONCURRENTLY IF EXISTS idx_order_history_total;
+CREATE INDEX CONCURRENTLY idx_order_history_total ON order_history(total_amount_currency, total_amount_units, total_amount_nanos, order_id);
+
+-- Replaces idx_order_history_date, of which it is a prefix.
+DROP INDEX CONCURRENTLY IF EXISTS idx_order_history_date_id;
+CREATE INDEX CONCURRENTLY idx_order_history_date_id ON order_history(order_date DESC, order_id DESC);
+DROP INDEX CONCURRENTLY IF EXISTS idx_order_history_date;
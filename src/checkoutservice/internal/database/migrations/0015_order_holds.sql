@@ -0,0 +1,8 @@
+-- Orders held for review by fraud screening, until they are approved: the
+-- authorized payment transaction to capture and the address to ship to.
+CREATE TABLE order_holds (
+	order_id VARCHAR(255) PRIMARY KEY REFERENCES order_history(order_id) ON DELETE CASCADE,
+	transaction_id VARCHAR(255) NOT NULL,
+	address JSONB NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
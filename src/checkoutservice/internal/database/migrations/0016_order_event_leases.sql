@@ -0,0 +1,4 @@
+-- Order events are claimed until publish_lease_until while they are
+-- published, so the publish runs outside a transaction and other replicas
+-- skip them meanwhile.
+ALTER TABLE order_events ADD COLUMN publish_lease_until TIMESTAMP;
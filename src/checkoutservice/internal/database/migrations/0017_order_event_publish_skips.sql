@@ -0,0 +1,3 @@
+-- Events recorded while no Pub/Sub topic is configured are marked skipped
+-- rather than left waiting in the outbox.
+ALTER TABLE order_events ADD COLUMN publish_skipped BOOLEAN NOT NULL DEFAULT FALSE;
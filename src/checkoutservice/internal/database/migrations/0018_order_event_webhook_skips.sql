@@ -0,0 +1,3 @@
+-- Events recorded while no webhook endpoints are configured are marked
+-- skipped rather than queued for endpoints added later.
+ALTER TABLE order_events ADD COLUMN webhooks_skipped BOOLEAN NOT NULL DEFAULT FALSE;
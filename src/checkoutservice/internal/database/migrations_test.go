@@ -0,0 +1,85 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_status.sql": {Data: []byte("ALTER TABLE t ADD COLUMN status TEXT;")},
+		"m/0010_add_index.sql":  {Data: []byte("CREATE INDEX i ON t(status);")},
+		"m/0001_create_t.sql":   {Data: []byte("CREATE TABLE t (id INTEGER);")},
+		"m/README.md":           {Data: []byte("not a migration")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []migration{
+		{1, "0001_create_t", "CREATE TABLE t (id INTEGER);", false},
+		{2, "0002_add_status", "ALTER TABLE t ADD COLUMN status TEXT;", false},
+		{10, "0010_add_index", "CREATE INDEX i ON t(status);", false},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("Expected %d migrations, got %+v", len(want), migrations)
+	}
+	for i := range want {
+		if migrations[i] != want[i] {
+			t.Errorf("Migration %d: expected %+v, got %+v", i, want[i], migrations[i])
+		}
+	}
+}
+
+func TestLoadMigrationsWithoutTransaction(t *testing.T) {
+	sql := noTransactionMarker + `
+-- Built without blocking writes.
+DROP INDEX CONCURRENTLY IF EXISTS i;
+CREATE INDEX CONCURRENTLY i
+	ON t(status);
+`
+	migrations, err := loadMigrations(fstest.MapFS{"m/0001_add_index.sql": {Data: []byte(sql)}}, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 1 || !migrations[0].noTransaction {
+		t.Fatalf("Expected one migration outside a transaction, got %+v", migrations)
+	}
+	want := []string{"DROP INDEX CONCURRENTLY IF EXISTS i", "CREATE INDEX CONCURRENTLY i\n\tON t(status)"}
+	if got := migrations[0].statements(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected statements %q, got %q", want, got)
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"unnumbered": {"m/create_t.sql": {}},
+		"zero":       {"m/0000_create_t.sql": {}},
+		"duplicate":  {"m/0001_create_t.sql": {}, "m/1_create_u.sql": {}},
+	} {
+		if _, err := loadMigrations(fsys, "m"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("Expected migration %s to be version %d", m.name, i+1)
+		}
+		if strings.TrimSpace(m.sql) == "" {
+			t.Errorf("Migration %s is empty", m.name)
+		}
+		if strings.Contains(m.sql, "CONCURRENTLY") && !m.noTransaction {
+			t.Errorf("Migration %s builds an index concurrently inside a transaction", m.name)
+		}
+	}
+}
@@ -1,16 +1,35 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
 	"github.com/sirupsen/logrus"
 )
 
+// errMock is returned by every MockConnection method once SetShouldError is
+// set, as if the database were down.
+var errMock = &classifiedError{class: ErrUnavailable, err: errors.New("mock database error")}
+
 // MockConnection implements a mock database for testing
 type MockConnection struct {
 	orders      map[string]*models.Order
 	orderItems  map[string][]models.OrderItem
 	userOrders  map[string][]string // userID -> orderIDs
+	events      []models.OrderEvent // unpublished
+	lastEventID int64
+	returns     map[string]*models.OrderReturn
+	queued      []*mockConfirmation // confirmation emails, in the order queued
+	unqueued    []models.OrderEvent // not yet queued for webhooks
+	deliveries  []*mockDelivery     // webhook deliveries, in the order queued
+	addresses   map[string]*models.SavedAddress
+	shipments   []*models.Shipment // in the order created
+	holds       map[string]*models.OrderHold
 	log         *logrus.Logger
 	shouldError bool
 }
@@ -21,6 +40,9 @@ func NewMockConnection(log *logrus.Logger) *MockConnection {
 		orders:     make(map[string]*models.Order),
 		orderItems: make(map[string][]models.OrderItem),
 		userOrders: make(map[string][]string),
+		returns:    make(map[string]*models.OrderReturn),
+		addresses:  make(map[string]*models.SavedAddress),
+		holds:      make(map[string]*models.OrderHold),
 		log:        log,
 	}
 }
@@ -31,52 +53,429 @@ func (mc *MockConnection) SetShouldError(shouldError bool) {
 }
 
 // SaveOrder saves an order to the mock database
-func (mc *MockConnection) SaveOrder(order *models.Order, items []models.OrderItem) error {
+func (mc *MockConnection) SaveOrder(ctx context.Context, order *models.Order, items []models.OrderItem) error {
 	if mc.shouldError {
-		return fmt.Errorf("mock database error")
+		return errMock
 	}
 
-	// Store order
-	mc.orders[order.OrderID] = order
+	if _, exists := mc.orders[order.OrderID]; exists {
+		return ErrDuplicateOrder
+	}
 
-	// Store order items
-	mc.orderItems[order.OrderID] = items
+	// Store a copy stamped with the order date, as the database does
+	stored := *order
+	if stored.OrderDate.IsZero() {
+		stored.OrderDate = time.Now().UTC()
+	}
+	if addr, ok := mc.addresses[stored.AddressID]; !ok || addr.UserID != stored.UserID {
+		stored.AddressID = ""
+	}
+	mc.orders[order.OrderID] = &stored
+
+	// Store order items, numbered from 1 within the order
+	numbered := make([]models.OrderItem, len(items))
+	for i, item := range items {
+		item.ID = i + 1
+		numbered[i] = item
+	}
+	mc.orderItems[order.OrderID] = numbered
 
 	// Update user orders index
 	mc.userOrders[order.UserID] = append(mc.userOrders[order.UserID], order.OrderID)
 
+	if order.Status != models.StatusPending {
+		mc.recordEvent(models.EventOrderPlaced, order.OrderID, "", order.StatusReason)
+	}
+
 	mc.log.Infof("Mock: Saved order %s for user %s with %d items", 
 		order.OrderID, order.UserID, len(items))
 
 	return nil
 }
 
+// CompleteOrder moves a pending order in the mock database to status with a
+// tracking ID and hold, and records the order_placed event
+func (mc *MockConnection) CompleteOrder(ctx context.Context, orderID, status, trackingID string, hold *models.OrderHold) (*models.Order, error) {
+	return mc.finishOrder(orderID, models.StatusPending, status, trackingID, "", models.EventOrderPlaced, hold)
+}
+
+// ReleaseOrder moves an order under review in the mock database to paid with
+// a tracking ID
+func (mc *MockConnection) ReleaseOrder(ctx context.Context, orderID, trackingID, reason string) (*models.Order, error) {
+	return mc.finishOrder(orderID, models.StatusUnderReview, models.StatusPaid, trackingID, reason, models.StatusEvent(models.StatusPaid), nil)
+}
+
+func (mc *MockConnection) finishOrder(orderID, from, to, trackingID, reason, event string, hold *models.OrderHold) (*models.Order, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	order, exists := mc.orders[orderID]
+	if !exists {
+		return nil, ErrOrderNotFound
+	}
+	if order.Status == to && from != to && order.ShippingTrackingID == trackingID {
+		o := *order
+		return &o, nil
+	}
+	if order.Status != from {
+		return nil, fmt.Errorf("%w: order %s is %s, not %s", models.ErrInvalidStatusTransition, orderID, order.Status, from)
+	}
+	if err := models.CheckStatusTransition(from, to); err != nil {
+		return nil, err
+	}
+	order.Status = to
+	order.ShippingTrackingID = trackingID
+	if event == models.EventOrderPlaced {
+		mc.recordEvent(event, orderID, "", reason)
+	} else if event != "" {
+		mc.recordEvent(event, orderID, from, reason)
+	}
+	if hold != nil {
+		if _, held := mc.holds[orderID]; !held {
+			h := *hold
+			mc.holds[orderID] = &h
+		}
+	}
+
+	o := *order
+	return &o, nil
+}
+
+// TakeOrderHold deletes and returns the hold of an order under review from
+// mock database
+func (mc *MockConnection) TakeOrderHold(ctx context.Context, orderID string) (*models.OrderHold, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	hold, held := mc.holds[orderID]
+	if order, exists := mc.orders[orderID]; !held || !exists || order.Status != models.StatusUnderReview {
+		return nil, ErrNoOrderHold
+	}
+	delete(mc.holds, orderID)
+	return hold, nil
+}
+
+// PutOrderHold stores the hold of an order in mock database
+func (mc *MockConnection) PutOrderHold(ctx context.Context, hold *models.OrderHold) error {
+	if mc.shouldError {
+		return errMock
+	}
+
+	if _, held := mc.holds[hold.OrderID]; !held {
+		h := *hold
+		mc.holds[hold.OrderID] = &h
+	}
+	return nil
+}
+
+// DeletePendingOrder deletes a pending order from the mock database
+func (mc *MockConnection) DeletePendingOrder(ctx context.Context, orderID string) error {
+	if mc.shouldError {
+		return errMock
+	}
+
+	order, exists := mc.orders[orderID]
+	if !exists || order.Status != models.StatusPending {
+		return nil
+	}
+	delete(mc.orders, orderID)
+	delete(mc.orderItems, orderID)
+	ids := mc.userOrders[order.UserID]
+	for i, id := range ids {
+		if id == orderID {
+			mc.userOrders[order.UserID] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// DeleteStalePendingOrders deletes the pending orders of the mock database
+// placed before olderThan ago
+func (mc *MockConnection) DeleteStalePendingOrders(ctx context.Context, olderThan time.Duration) ([]models.Order, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	var stale []models.Order
+	for _, order := range mc.orders {
+		if order.Status == models.StatusPending && time.Since(order.OrderDate) > olderThan {
+			stale = append(stale, *order)
+		}
+	}
+	for _, order := range stale {
+		mc.DeletePendingOrder(ctx, order.OrderID)
+	}
+	return stale, nil
+}
+
 // GetOrdersByUser retrieves all orders for a specific user from mock database
-func (mc *MockConnection) GetOrdersByUser(userID string) ([]models.Order, error) {
+func (mc *MockConnection) GetOrdersByUser(ctx context.Context, userID string) ([]models.Order, bool, error) {
 	if mc.shouldError {
-		return nil, fmt.Errorf("mock database error")
+		return nil, false, errMock
 	}
 
 	orderIDs, exists := mc.userOrders[userID]
 	if !exists {
-		return []models.Order{}, nil
+		return []models.Order{}, false, nil
 	}
 
-	var orders []models.Order
+	truncated := false
+	if len(orderIDs) > MaxOrdersPerUser {
+		orderIDs = orderIDs[len(orderIDs)-MaxOrdersPerUser:]
+		truncated = true
+	}
+
+	orders := make([]models.Order, 0, len(orderIDs))
 	for _, orderID := range orderIDs {
-		if order, exists := mc.orders[orderID]; exists {
+		if order, exists := mc.orders[orderID]; exists && order.Status != models.StatusPending {
 			orders = append(orders, *order)
 		}
 	}
 
 	mc.log.Infof("Mock: Retrieved %d orders for user %s", len(orders), userID)
-	return orders, nil
+	return orders, truncated, nil
+}
+
+// GetOrdersPage retrieves a page of a user's orders, newest first, from mock database
+func (mc *MockConnection) GetOrdersPage(ctx context.Context, userID string, dates DateRange, after *OrderCursor, limit int) ([]models.Order, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	var orders []models.Order
+	for _, orderID := range mc.userOrders[userID] {
+		if order, exists := mc.orders[orderID]; exists && order.Status != models.StatusPending && dates.Contains(order.OrderDate) {
+			orders = append(orders, *order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return newerThan(cursorOf(orders[i]), cursorOf(orders[j]))
+	})
+
+	page := make([]models.Order, 0, limit)
+	for _, order := range orders {
+		if len(page) == limit {
+			break
+		}
+		if after == nil || newerThan(*after, cursorOf(order)) {
+			page = append(page, order)
+		}
+	}
+	return page, nil
+}
+
+func cursorOf(order models.Order) OrderCursor {
+	return OrderCursor{OrderDate: order.OrderDate, OrderID: order.OrderID}
+}
+
+// newerThan reports whether a sorts before b when listing newest first.
+func newerThan(a, b OrderCursor) bool {
+	if !a.OrderDate.Equal(b.OrderDate) {
+		return a.OrderDate.After(b.OrderDate)
+	}
+	return a.OrderID > b.OrderID
+}
+
+// SearchOrders retrieves a page of the orders of any user that match search
+// from the mock database
+func (mc *MockConnection) SearchOrders(ctx context.Context, search OrderSearch, after *SearchCursor, limit int) ([]models.Order, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	var orders []models.Order
+	for _, order := range mc.orders {
+		if mc.matches(*order, search) {
+			orders = append(orders, *order)
+		}
+	}
+	// before reports whether a sorts before b.
+	before := func(a, b SearchCursor) bool {
+		var less, greater bool
+		switch {
+		case search.SortBy == SortByTotal && a.Total != b.Total:
+			less = a.Total.Units < b.Total.Units || a.Total.Units == b.Total.Units && a.Total.Nanos < b.Total.Nanos
+			greater = !less
+		case search.SortBy != SortByTotal && !a.OrderDate.Equal(b.OrderDate):
+			less, greater = a.OrderDate.Before(b.OrderDate), a.OrderDate.After(b.OrderDate)
+		default:
+			less, greater = a.OrderID < b.OrderID, a.OrderID > b.OrderID
+		}
+		if search.Ascending {
+			return less
+		}
+		return greater
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return before(searchCursorOf(orders[i]), searchCursorOf(orders[j]))
+	})
+
+	page := make([]models.Order, 0, limit)
+	for _, order := range orders {
+		if len(page) == limit {
+			break
+		}
+		if after == nil || before(*after, searchCursorOf(order)) {
+			page = append(page, order)
+		}
+	}
+	return page, nil
+}
+
+// matches reports whether an order passes the filters of search.
+func (mc *MockConnection) matches(order models.Order, search OrderSearch) bool {
+	total := Amount{Units: order.TotalAmountUnits, Nanos: order.TotalAmountNanos}
+	atLeast := func(a, b Amount) bool { return a.Units > b.Units || a.Units == b.Units && a.Nanos >= b.Nanos }
+	switch {
+	case search.Email != "" && !strings.EqualFold(order.Email, search.Email),
+		search.Status != "" && order.Status != search.Status,
+		search.Status == "" && order.Status == models.StatusPending,
+		!search.Dates.Contains(order.OrderDate),
+		search.Currency != "" && order.TotalAmountCurrency != search.Currency,
+		search.MinTotal != nil && !atLeast(total, *search.MinTotal),
+		search.MaxTotal != nil && !atLeast(*search.MaxTotal, total):
+		return false
+	}
+	if search.ProductID == "" {
+		return true
+	}
+	for _, item := range mc.orderItems[order.OrderID] {
+		if item.ProductID == search.ProductID {
+			return true
+		}
+	}
+	return false
+}
+
+func searchCursorOf(order models.Order) SearchCursor {
+	return SearchCursor{
+		OrderDate: order.OrderDate,
+		Total:     Amount{Units: order.TotalAmountUnits, Nanos: order.TotalAmountNanos},
+		OrderID:   order.OrderID,
+	}
+}
+
+// GetOrderByID retrieves a single order from mock database
+func (mc *MockConnection) GetOrderByID(ctx context.Context, orderID string) (*models.Order, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	order, exists := mc.orders[orderID]
+	if !exists {
+		return nil, ErrOrderNotFound
+	}
+	o := *order
+	return &o, nil
+}
+
+// GetPlacedOrder retrieves an order and its items from mock database
+func (mc *MockConnection) GetPlacedOrder(ctx context.Context, orderID string) (*models.Order, []models.OrderItem, error) {
+	order, err := mc.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, mc.orderItems[orderID], nil
+}
+
+// GetOrderByTrackingID retrieves the latest order with a tracking ID from mock
+// database
+func (mc *MockConnection) GetOrderByTrackingID(ctx context.Context, trackingID string) (*models.Order, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	var found *models.Order
+	for _, order := range mc.orders {
+		if order.ShippingTrackingID != trackingID {
+			continue
+		}
+		if found == nil || newerThan(OrderCursor{order.OrderDate, order.OrderID}, OrderCursor{found.OrderDate, found.OrderID}) {
+			found = order
+		}
+	}
+	if found == nil {
+		return nil, ErrOrderNotFound
+	}
+	o := *found
+	return &o, nil
+}
+
+// GetUserOrderStats summarizes a user's orders from mock database
+func (mc *MockConnection) GetUserOrderStats(ctx context.Context, userID string, topProducts int) (*models.UserOrderStats, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	stats := &models.UserOrderStats{UserID: userID}
+	nanos := make(map[string]int64) // leftover nanos per currency
+	spend := make(map[string]*models.CurrencySpend)
+	products := make(map[string]*models.ProductStats)
+	for _, orderID := range mc.userOrders[userID] {
+		order := mc.orders[orderID]
+		if order.Status == models.StatusCancelled || order.Status == models.StatusRefunded {
+			continue
+		}
+		stats.TotalOrders++
+		if stats.FirstOrderDate.IsZero() || order.OrderDate.Before(stats.FirstOrderDate) {
+			stats.FirstOrderDate = order.OrderDate
+		}
+		if order.OrderDate.After(stats.LastOrderDate) {
+			stats.LastOrderDate = order.OrderDate
+		}
+		cs, ok := spend[order.TotalAmountCurrency]
+		if !ok {
+			cs = &models.CurrencySpend{Currency: order.TotalAmountCurrency}
+			spend[order.TotalAmountCurrency] = cs
+		}
+		cs.Units += order.TotalAmountUnits
+		nanos[cs.Currency] += int64(order.TotalAmountNanos)
+		for _, ret := range mc.returns {
+			if ret.OrderID == orderID && ret.Refund != nil {
+				cs.Units -= ret.Refund.AmountUnits
+				nanos[cs.Currency] -= int64(ret.Refund.AmountNanos)
+			}
+		}
+		for _, item := range mc.orderItems[orderID] {
+			p, ok := products[item.ProductID]
+			if !ok {
+				p = &models.ProductStats{ProductID: item.ProductID}
+				products[item.ProductID] = p
+			}
+			p.Quantity += int64(item.Quantity)
+			p.Orders++
+		}
+	}
+	for currency, cs := range spend {
+		total := cs.Units*1e9 + nanos[currency]
+		cs.Units = total / 1e9
+		cs.Nanos = int32(total % 1e9)
+		stats.Spend = append(stats.Spend, *cs)
+	}
+	sort.Slice(stats.Spend, func(i, j int) bool { return stats.Spend[i].Currency < stats.Spend[j].Currency })
+	for _, p := range products {
+		stats.TopProducts = append(stats.TopProducts, *p)
+	}
+	sort.Slice(stats.TopProducts, func(i, j int) bool {
+		a, b := stats.TopProducts[i], stats.TopProducts[j]
+		if a.Quantity != b.Quantity {
+			return a.Quantity > b.Quantity
+		}
+		return a.ProductID < b.ProductID
+	})
+	if len(stats.TopProducts) > topProducts {
+		stats.TopProducts = stats.TopProducts[:topProducts]
+	}
+	return stats, nil
 }
 
 // GetOrderItems retrieves all items for a specific order from mock database
-func (mc *MockConnection) GetOrderItems(orderID string) ([]models.OrderItem, error) {
+func (mc *MockConnection) GetOrderItems(ctx context.Context, orderID string) ([]models.OrderItem, error) {
 	if mc.shouldError {
-		return nil, fmt.Errorf("mock database error")
+		return nil, errMock
 	}
 
 	items, exists := mc.orderItems[orderID]
@@ -88,6 +487,598 @@ func (mc *MockConnection) GetOrderItems(orderID string) ([]models.OrderItem, err
 	return items, nil
 }
 
+// UpdateOrderStatus moves an order in the mock database to a new status
+func (mc *MockConnection) UpdateOrderStatus(ctx context.Context, orderID, status, reason string) (*models.Order, error) {
+	return mc.changeOrderStatus(ctx, orderID, "", status, reason, models.StatusEvent(status))
+}
+
+// CancelOrder cancels an order of the user in the mock database and records
+// an event
+func (mc *MockConnection) CancelOrder(ctx context.Context, userID, orderID, reason string) (*models.Order, error) {
+	return mc.changeOrderStatus(ctx, orderID, userID, models.StatusCancelled, reason, models.EventOrderCancelled)
+}
+
+func (mc *MockConnection) changeOrderStatus(ctx context.Context, orderID, userID, status, reason, event string) (*models.Order, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	order, exists := mc.orders[orderID]
+	if !exists || (userID != "" && order.UserID != userID) {
+		return nil, ErrOrderNotFound
+	}
+	if err := models.CheckStatusTransition(order.Status, status); err != nil {
+		return nil, err
+	}
+	from := order.Status
+	order.Status = status
+	if event != "" {
+		mc.recordEvent(event, orderID, from, reason)
+	}
+
+	mc.log.Infof("Mock: Order %s is now %s (%s)", orderID, status, reason)
+	o := *order
+	return &o, nil
+}
+
+// recordEvent adds an event to the Pub/Sub outbox and the webhook queue
+func (mc *MockConnection) recordEvent(event, orderID, from, reason string) {
+	mc.lastEventID++
+	e := models.OrderEvent{
+		ID:         mc.lastEventID,
+		Type:       event,
+		Order:      models.Order{OrderID: orderID},
+		FromStatus: from,
+		Reason:     reason,
+		CreatedAt:  time.Now().UTC(),
+	}
+	mc.events = append(mc.events, e)
+	mc.unqueued = append(mc.unqueued, e)
+}
+
+// PublishOrderEvents passes the unpublished events of the mock database to
+// publish and drops them if it succeeds, without a lease like
+// DeliverConfirmations
+func (mc *MockConnection) PublishOrderEvents(ctx context.Context, limit int, lease time.Duration, publish func([]models.OrderEvent) error) (int, error) {
+	if mc.shouldError {
+		return 0, errMock
+	}
+
+	events := mc.events[:min(limit, len(mc.events))]
+	if len(events) == 0 {
+		return 0, nil
+	}
+	batch := make([]models.OrderEvent, len(events))
+	for i, e := range events {
+		e.Order = *mc.orders[e.Order.OrderID]
+		batch[i] = e
+	}
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+	mc.events = mc.events[len(events):]
+	return len(events), nil
+}
+
+type mockConfirmation struct {
+	models.Confirmation
+	status      string
+	nextAttempt time.Time
+}
+
+// EnqueueConfirmation queues a confirmation email in the mock database
+func (mc *MockConnection) EnqueueConfirmation(ctx context.Context, orderID, email string, order []byte) error {
+	if mc.shouldError {
+		return errMock
+	}
+
+	stored, exists := mc.orders[orderID]
+	if !exists {
+		return fmt.Errorf("failed to insert confirmation: order %s does not exist", orderID)
+	}
+	for _, conf := range mc.queued {
+		if conf.OrderID == orderID {
+			return nil
+		}
+	}
+	mc.queued = append(mc.queued, &mockConfirmation{
+		Confirmation: models.Confirmation{OrderID: orderID, Email: email, Order: order, CreatedAt: time.Now().UTC()},
+		status:       models.ConfirmationPending,
+	})
+	stored.ConfirmationStatus = models.ConfirmationPending
+	return nil
+}
+
+// DeliverConfirmations passes the due confirmations of the mock database to
+// deliver and records the outcomes. Nothing else runs meanwhile, so there is
+// no lease.
+func (mc *MockConnection) DeliverConfirmations(ctx context.Context, limit int, lease time.Duration, deliver func(models.Confirmation) error, retryIn func(attempts int) (time.Duration, bool)) (int, error) {
+	if mc.shouldError {
+		return 0, errMock
+	}
+
+	now := time.Now()
+	sent, tried := 0, 0
+	for _, conf := range mc.queued {
+		if tried == limit {
+			break
+		}
+		if conf.status != models.ConfirmationPending || conf.nextAttempt.After(now) {
+			continue
+		}
+		tried++
+		conf.Attempts++
+		if err := deliver(conf.Confirmation); err == nil {
+			conf.status = models.ConfirmationSent
+			sent++
+		} else if delay, retry := retryIn(conf.Attempts); retry {
+			conf.nextAttempt = now.Add(delay)
+		} else {
+			conf.status = models.ConfirmationFailed
+		}
+		mc.orders[conf.OrderID].ConfirmationStatus = conf.status
+	}
+	return sent, nil
+}
+
+type mockDelivery struct {
+	models.WebhookDelivery
+	status      string
+	nextAttempt time.Time
+}
+
+// QueueWebhooks queues the mock database's events for delivery to endpoints
+func (mc *MockConnection) QueueWebhooks(ctx context.Context, endpoints []string, limit int) (int, error) {
+	if mc.shouldError {
+		return 0, errMock
+	}
+
+	events := mc.unqueued[:min(limit, len(mc.unqueued))]
+	for _, e := range events {
+		for _, endpoint := range endpoints {
+			mc.deliveries = append(mc.deliveries, &mockDelivery{
+				WebhookDelivery: models.WebhookDelivery{ID: int64(len(mc.deliveries) + 1), Endpoint: endpoint, Event: e},
+				status:          models.WebhookPending,
+			})
+		}
+	}
+	mc.unqueued = mc.unqueued[len(events):]
+	return len(events), nil
+}
+
+// DeliverWebhooks passes the due webhook deliveries of the mock database to
+// deliver and records the outcomes, without a lease like
+// DeliverConfirmations
+func (mc *MockConnection) DeliverWebhooks(ctx context.Context, limit int, lease time.Duration, deliver func(models.WebhookDelivery) error, retryIn func(attempts int) (time.Duration, bool)) (int, error) {
+	if mc.shouldError {
+		return 0, errMock
+	}
+
+	now := time.Now()
+	delivered, tried := 0, 0
+	for _, d := range mc.deliveries {
+		if tried == limit {
+			break
+		}
+		if d.status != models.WebhookPending || d.nextAttempt.After(now) {
+			continue
+		}
+		tried++
+		attempt := d.WebhookDelivery
+		attempt.Event.Order = *mc.orders[d.Event.Order.OrderID]
+		d.Attempts++
+		if err := deliver(attempt); err == nil {
+			d.status = models.WebhookDelivered
+			delivered++
+		} else if delay, retry := retryIn(d.Attempts); retry {
+			d.nextAttempt = now.Add(delay)
+		} else {
+			d.status = models.WebhookFailed
+		}
+	}
+	return delivered, nil
+}
+
+// AnonymizeUserData erases a user's personal data from their orders in the
+// mock database
+func (mc *MockConnection) AnonymizeUserData(ctx context.Context, userID, pseudonym string) (int, error) {
+	if mc.shouldError {
+		return 0, errMock
+	}
+
+	orderIDs := mc.userOrders[userID]
+	anonymized := make(map[string]bool)
+	for _, orderID := range orderIDs {
+		order := mc.orders[orderID]
+		order.UserID = pseudonym
+		order.Email = ""
+		order.ShippingAddress = ""
+		anonymized[orderID] = true
+	}
+	mc.userOrders[pseudonym] = append(mc.userOrders[pseudonym], orderIDs...)
+	delete(mc.userOrders, userID)
+
+	for _, events := range [][]models.OrderEvent{mc.events, mc.unqueued} {
+		for i := range events {
+			if anonymized[events[i].Order.OrderID] {
+				events[i].Reason = ""
+			}
+		}
+	}
+	queued := mc.queued[:0]
+	for _, conf := range mc.queued {
+		if !anonymized[conf.OrderID] {
+			queued = append(queued, conf)
+		}
+	}
+	mc.queued = queued
+	for _, ret := range mc.returns {
+		if ret.UserID == userID {
+			ret.UserID = pseudonym
+			ret.Reason = ""
+		}
+	}
+
+	for id, addr := range mc.addresses {
+		if addr.UserID == userID {
+			delete(mc.addresses, id)
+		}
+	}
+
+	mc.log.Infof("Mock: Anonymized %d orders of user %s", len(orderIDs), userID)
+	return len(orderIDs), nil
+}
+
+// ClaimGuestOrders moves the orders placed without a user ID with email to
+// userID in the mock database
+func (mc *MockConnection) ClaimGuestOrders(ctx context.Context, userID, email string) ([]string, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	var claimed, kept []string
+	for _, orderID := range mc.userOrders[""] {
+		order := mc.orders[orderID]
+		if order.Email != "" && strings.EqualFold(order.Email, email) {
+			order.UserID = userID
+			claimed = append(claimed, orderID)
+		} else {
+			kept = append(kept, orderID)
+		}
+	}
+	mc.userOrders[""] = kept
+	mc.userOrders[userID] = append(mc.userOrders[userID], claimed...)
+
+	mc.log.Infof("Mock: Claimed %d guest orders for user %s", len(claimed), userID)
+	return claimed, nil
+}
+
+// CreateReturn stores a return in the mock database, validating it like the
+// database does. Order items are numbered from 1 in the order they were saved.
+func (mc *MockConnection) CreateReturn(ctx context.Context, ret *models.OrderReturn) error {
+	if mc.shouldError {
+		return errMock
+	}
+
+	order, exists := mc.orders[ret.OrderID]
+	if !exists || order.UserID != ret.UserID {
+		return ErrOrderNotFound
+	}
+	if order.Status != models.StatusDelivered {
+		return fmt.Errorf("%w: order %s is %s, not delivered", models.ErrNotReturnable, ret.OrderID, order.Status)
+	}
+
+	returned := make(map[int]int32)
+	for _, r := range mc.returns {
+		for _, item := range r.Items {
+			returned[item.OrderItemID] += item.Quantity
+		}
+	}
+	if len(ret.Items) == 0 {
+		return fmt.Errorf("%w: no items", models.ErrInvalidReturn)
+	}
+	items := make([]models.ReturnItem, len(ret.Items))
+	listed := make(map[string]bool)
+	for i, item := range ret.Items {
+		if listed[item.ProductID] {
+			return fmt.Errorf("%w: product %s is listed twice", models.ErrInvalidReturn, item.ProductID)
+		}
+		listed[item.ProductID] = true
+		found := false
+		for j, orderItem := range mc.orderItems[ret.OrderID] {
+			if orderItem.ProductID != item.ProductID {
+				continue
+			}
+			if available := orderItem.Quantity - returned[j+1]; item.Quantity <= 0 || item.Quantity > available {
+				return fmt.Errorf("%w: %d of product %s requested, %d can be returned",
+					models.ErrInvalidReturn, item.Quantity, item.ProductID, available)
+			}
+			items[i] = models.ReturnItem{
+				ReturnID:          ret.ReturnID,
+				OrderItemID:       j + 1,
+				ProductID:         item.ProductID,
+				Quantity:          item.Quantity,
+				UnitPriceCurrency: orderItem.UnitPriceCurrency,
+				UnitPriceUnits:    orderItem.UnitPriceUnits,
+				UnitPriceNanos:    orderItem.UnitPriceNanos,
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("%w: product %s is not in order %s", models.ErrInvalidReturn, item.ProductID, ret.OrderID)
+		}
+	}
+
+	ret.Items = items
+	ret.Status = models.ReturnRequested
+	ret.CreatedAt = time.Now().UTC()
+	stored := *ret
+	mc.returns[ret.ReturnID] = &stored
+	return nil
+}
+
+// GetReturn retrieves a return from mock database
+func (mc *MockConnection) GetReturn(ctx context.Context, returnID string) (*models.OrderReturn, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	ret, exists := mc.returns[returnID]
+	if !exists {
+		return nil, ErrReturnNotFound
+	}
+	r := *ret
+	return &r, nil
+}
+
+// ApproveReturn approves a return in the mock database and records its refund
+func (mc *MockConnection) ApproveReturn(ctx context.Context, returnID string, refundFor func(*models.OrderReturn) (models.Refund, error)) (*models.OrderReturn, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	ret, exists := mc.returns[returnID]
+	if !exists {
+		return nil, ErrReturnNotFound
+	}
+	if ret.Status != models.ReturnRequested {
+		return nil, fmt.Errorf("%w: return %s is already %s", models.ErrNotReturnable, returnID, ret.Status)
+	}
+	requested := *ret
+	refund, err := refundFor(&requested)
+	if err != nil {
+		return nil, err
+	}
+	refund.ReturnID = returnID
+	refund.OrderID = ret.OrderID
+	refund.CreatedAt = time.Now().UTC()
+	ret.Status = models.ReturnApproved
+	ret.Refund = &refund
+
+	r := *ret
+	return &r, nil
+}
+
+// CreateShipment stores a shipment in the mock database, validating it like
+// the database does. Order items are numbered from 1 in the order they were
+// saved.
+func (mc *MockConnection) CreateShipment(ctx context.Context, s *models.Shipment) error {
+	if mc.shouldError {
+		return errMock
+	}
+
+	order, exists := mc.orders[s.OrderID]
+	if !exists {
+		return ErrOrderNotFound
+	}
+	if order.Status != models.StatusPaid && order.Status != models.StatusShipped {
+		return fmt.Errorf("%w: order %s is %s", models.ErrNotShippable, s.OrderID, order.Status)
+	}
+
+	shipped := make(map[int]int32)
+	for _, shipment := range mc.shipments {
+		if shipment.OrderID != s.OrderID {
+			continue
+		}
+		for _, item := range shipment.Items {
+			shipped[item.OrderItemID] += item.Quantity
+		}
+	}
+	if len(s.Items) == 0 {
+		return fmt.Errorf("%w: no items", models.ErrInvalidShipment)
+	}
+	items := make([]models.ShipmentItem, len(s.Items))
+	listed := make(map[string]bool)
+	for i, item := range s.Items {
+		if listed[item.ProductID] {
+			return fmt.Errorf("%w: product %s is listed twice", models.ErrInvalidShipment, item.ProductID)
+		}
+		listed[item.ProductID] = true
+		found := false
+		for j, orderItem := range mc.orderItems[s.OrderID] {
+			if orderItem.ProductID != item.ProductID {
+				continue
+			}
+			if available := orderItem.Quantity - shipped[j+1]; item.Quantity <= 0 || item.Quantity > available {
+				return fmt.Errorf("%w: %d of product %s requested, %d left to ship",
+					models.ErrInvalidShipment, item.Quantity, item.ProductID, available)
+			}
+			items[i] = models.ShipmentItem{ShipmentID: s.ShipmentID, OrderItemID: j + 1, ProductID: item.ProductID, Quantity: item.Quantity}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("%w: product %s is not in order %s", models.ErrInvalidShipment, item.ProductID, s.OrderID)
+		}
+	}
+
+	s.Items = items
+	s.Status = models.ShipmentShipped
+	s.CreatedAt = time.Now().UTC()
+	s.UpdatedAt = s.CreatedAt
+	stored := *s
+	mc.shipments = append(mc.shipments, &stored)
+	return nil
+}
+
+// GetShipments retrieves the shipments of an order from the mock database
+func (mc *MockConnection) GetShipments(ctx context.Context, orderID string) ([]models.Shipment, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	var shipments []models.Shipment
+	for _, s := range mc.shipments {
+		if s.OrderID == orderID {
+			shipments = append(shipments, *s)
+		}
+	}
+	return shipments, nil
+}
+
+// UpdateShipmentStatus moves a shipment to status in the mock database
+func (mc *MockConnection) UpdateShipmentStatus(ctx context.Context, shipmentID, status string) (*models.Shipment, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	for _, s := range mc.shipments {
+		if s.ShipmentID != shipmentID {
+			continue
+		}
+		if s.Status != models.ShipmentShipped || status != models.ShipmentDelivered {
+			return nil, fmt.Errorf("%w: shipment %s cannot move from %s to %s", models.ErrNotShippable, shipmentID, s.Status, status)
+		}
+		s.Status = status
+		s.UpdatedAt = time.Now().UTC()
+		shipment := *s
+		return &shipment, nil
+	}
+	return nil, ErrShipmentNotFound
+}
+
+// AddAddress saves an address to a user's address book in the mock database
+func (mc *MockConnection) AddAddress(ctx context.Context, addr *models.SavedAddress) error {
+	if mc.shouldError {
+		return errMock
+	}
+
+	if addr.IsDefault || mc.defaultAddress(addr.UserID) == nil {
+		mc.clearDefaultAddress(addr.UserID)
+		addr.IsDefault = true
+	}
+	addr.CreatedAt = time.Now().UTC()
+	stored := *addr
+	mc.addresses[addr.AddressID] = &stored
+
+	mc.log.Infof("Mock: Saved address %s for user %s", addr.AddressID, addr.UserID)
+	return nil
+}
+
+// ListAddresses retrieves a user's saved addresses from the mock database,
+// the default first and then newest first
+func (mc *MockConnection) ListAddresses(ctx context.Context, userID string) ([]models.SavedAddress, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	var addrs []models.SavedAddress
+	for _, addr := range mc.addresses {
+		if addr.UserID == userID {
+			addrs = append(addrs, *addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].IsDefault != addrs[j].IsDefault {
+			return addrs[i].IsDefault
+		}
+		if !addrs[i].CreatedAt.Equal(addrs[j].CreatedAt) {
+			return addrs[i].CreatedAt.After(addrs[j].CreatedAt)
+		}
+		return addrs[i].AddressID < addrs[j].AddressID
+	})
+	return addrs, nil
+}
+
+// GetAddress retrieves one of a user's saved addresses from the mock database
+func (mc *MockConnection) GetAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	addr, exists := mc.addresses[addressID]
+	if !exists || addr.UserID != userID {
+		return nil, ErrAddressNotFound
+	}
+	a := *addr
+	return &a, nil
+}
+
+// DeleteAddress deletes one of a user's saved addresses from the mock
+// database, making the newest remaining one the default if it was
+func (mc *MockConnection) DeleteAddress(ctx context.Context, userID, addressID string) error {
+	if mc.shouldError {
+		return errMock
+	}
+
+	addr, exists := mc.addresses[addressID]
+	if !exists || addr.UserID != userID {
+		return ErrAddressNotFound
+	}
+	delete(mc.addresses, addressID)
+	for _, order := range mc.orders {
+		if order.AddressID == addressID {
+			order.AddressID = ""
+		}
+	}
+	if addr.IsDefault {
+		var newest *models.SavedAddress
+		for _, a := range mc.addresses {
+			if a.UserID == userID && (newest == nil || a.CreatedAt.After(newest.CreatedAt) ||
+				a.CreatedAt.Equal(newest.CreatedAt) && a.AddressID < newest.AddressID) {
+				newest = a
+			}
+		}
+		if newest != nil {
+			newest.IsDefault = true
+		}
+	}
+	return nil
+}
+
+// SetDefaultAddress makes one of a user's saved addresses the default in the
+// mock database
+func (mc *MockConnection) SetDefaultAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error) {
+	if mc.shouldError {
+		return nil, errMock
+	}
+
+	addr, exists := mc.addresses[addressID]
+	if !exists || addr.UserID != userID {
+		return nil, ErrAddressNotFound
+	}
+	mc.clearDefaultAddress(userID)
+	addr.IsDefault = true
+	a := *addr
+	return &a, nil
+}
+
+// defaultAddress returns the default address of a user, or nil if they have
+// none
+func (mc *MockConnection) defaultAddress(userID string) *models.SavedAddress {
+	for _, addr := range mc.addresses {
+		if addr.UserID == userID && addr.IsDefault {
+			return addr
+		}
+	}
+	return nil
+}
+
+func (mc *MockConnection) clearDefaultAddress(userID string) {
+	if addr := mc.defaultAddress(userID); addr != nil {
+		addr.IsDefault = false
+	}
+}
+
 // Close is a no-op for the mock database
 func (mc *MockConnection) Close() error {
 	mc.log.Info("Mock: Database connection closed")
@@ -99,5 +1090,12 @@ func (mc *MockConnection) ClearData() {
 	mc.orders = make(map[string]*models.Order)
 	mc.orderItems = make(map[string][]models.OrderItem)
 	mc.userOrders = make(map[string][]string)
+	mc.events = nil
+	mc.returns = make(map[string]*models.OrderReturn)
+	mc.queued = nil
+	mc.unqueued = nil
+	mc.deliveries = nil
+	mc.addresses = make(map[string]*models.SavedAddress)
+	mc.shipments = nil
 	mc.log.Info("Mock: Database data cleared")
 } 
\ No newline at end of file
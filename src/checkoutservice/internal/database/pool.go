@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pool holds the connection pool and timeout settings of each database
+// handle: the primary and every read endpoint get a pool of their own.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration // age after which a connection is replaced
+	ConnMaxIdleTime time.Duration // idle time after which a connection is closed
+	// ConnectTimeout bounds opening a connection, and the ping in Connect.
+	ConnectTimeout time.Duration
+	// StatementTimeout is the Postgres statement_timeout; 0 means none.
+	StatementTimeout time.Duration
+}
+
+func (p Pool) String() string {
+	return fmt.Sprintf("max open %d, max idle %d, max lifetime %v, max idle time %v, connect timeout %v, statement timeout %v",
+		p.MaxOpenConns, p.MaxIdleConns, p.ConnMaxLifetime, p.ConnMaxIdleTime, p.ConnectTimeout, p.StatementTimeout)
+}
+
+// loadPool reads the pool settings from the environment:
+//
+//   - CLOUDSQL_MAX_OPEN_CONNS is the number of connections per handle (default 10).
+//   - CLOUDSQL_MAX_IDLE_CONNS is the number of idle connections kept (default 5).
+//   - CLOUDSQL_CONN_MAX_LIFETIME replaces connections this old (default 30m).
+//   - CLOUDSQL_CONN_MAX_IDLE_TIME closes connections idle this long (default 5m).
+//   - CLOUDSQL_CONNECT_TIMEOUT bounds opening a connection (default 10s).
+//   - CLOUDSQL_STATEMENT_TIMEOUT cancels statements running longer
+//     (default 30s); 0 turns it off.
+func loadPool() (Pool, error) {
+	p := Pool{
+		MaxOpenConns:     10,
+		MaxIdleConns:     5,
+		ConnMaxLifetime:  30 * time.Minute,
+		ConnMaxIdleTime:  5 * time.Minute,
+		ConnectTimeout:   10 * time.Second,
+		StatementTimeout: 30 * time.Second,
+	}
+	for _, n := range []struct {
+		env    string
+		target *int
+		min    int
+	}{
+		{"CLOUDSQL_MAX_OPEN_CONNS", &p.MaxOpenConns, 1},
+		{"CLOUDSQL_MAX_IDLE_CONNS", &p.MaxIdleConns, 0},
+	} {
+		if s := os.Getenv(n.env); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < n.min {
+				return Pool{}, fmt.Errorf("%s (%s) must be an integer of at least %d", n.env, s, n.min)
+			}
+			*n.target = v
+		}
+	}
+	for _, d := range []struct {
+		env    string
+		target *time.Duration
+		min    time.Duration
+	}{
+		{"CLOUDSQL_CONN_MAX_LIFETIME", &p.ConnMaxLifetime, 1},
+		{"CLOUDSQL_CONN_MAX_IDLE_TIME", &p.ConnMaxIdleTime, 1},
+		{"CLOUDSQL_CONNECT_TIMEOUT", &p.ConnectTimeout, 1},
+		{"CLOUDSQL_STATEMENT_TIMEOUT", &p.StatementTimeout, 0},
+	} {
+		if s := os.Getenv(d.env); s != "" {
+			v, err := time.ParseDuration(s)
+			if err != nil || v < d.min {
+				kind := "positive"
+				if d.min == 0 {
+					kind = "non-negative"
+				}
+				return Pool{}, fmt.Errorf("failed to parse %s (%s) as a %s time.Duration", d.env, s, kind)
+			}
+			*d.target = v
+		}
+	}
+	if p.MaxIdleConns > p.MaxOpenConns {
+		// database/sql would lower it silently; say so instead.
+		return Pool{}, fmt.Errorf("CLOUDSQL_MAX_IDLE_CONNS (%d) is above CLOUDSQL_MAX_OPEN_CONNS (%d)", p.MaxIdleConns, p.MaxOpenConns)
+	}
+	return p, nil
+}
+
+// params returns the DSN parameters of the timeouts. libpq counts
+// connect_timeout in whole seconds, so it is rounded up; statement_timeout
+// is sent to the server as a run-time parameter, in milliseconds.
+func (p Pool) params() string {
+	var params []string
+	if p.ConnectTimeout > 0 {
+		params = append(params, fmt.Sprintf("connect_timeout=%d", int(math.Ceil(p.ConnectTimeout.Seconds()))))
+	}
+	if p.StatementTimeout > 0 {
+		params = append(params, fmt.Sprintf("statement_timeout=%d", p.StatementTimeout.Milliseconds()))
+	}
+	return strings.Join(params, " ")
+}
+
+// apply sizes the pool of db.
+func (p Pool) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
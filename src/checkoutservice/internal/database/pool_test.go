@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadPool(t *testing.T) {
+	p, err := loadPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxOpenConns != 10 || p.MaxIdleConns != 5 || p.ConnMaxLifetime != 30*time.Minute || p.ConnMaxIdleTime != 5*time.Minute {
+		t.Errorf("loadPool() = %+v; want the default pool", p)
+	}
+	if got := p.params(); got != "connect_timeout=10 statement_timeout=30000" {
+		t.Errorf("default params = %q", got)
+	}
+
+	t.Setenv("CLOUDSQL_MAX_OPEN_CONNS", "4")
+	t.Setenv("CLOUDSQL_MAX_IDLE_CONNS", "0")
+	t.Setenv("CLOUDSQL_CONN_MAX_LIFETIME", "1h")
+	t.Setenv("CLOUDSQL_CONN_MAX_IDLE_TIME", "1m")
+	t.Setenv("CLOUDSQL_CONNECT_TIMEOUT", "1500ms")
+	t.Setenv("CLOUDSQL_STATEMENT_TIMEOUT", "0")
+	want := Pool{MaxOpenConns: 4, ConnMaxLifetime: time.Hour, ConnMaxIdleTime: time.Minute, ConnectTimeout: 1500 * time.Millisecond}
+	if p, err = loadPool(); err != nil || p != want {
+		t.Errorf("loadPool() = %+v, %v; want %+v", p, err, want)
+	}
+	// connect_timeout is rounded up to whole seconds.
+	if got := p.params(); got != "connect_timeout=2" {
+		t.Errorf("params = %q", got)
+	}
+
+	for env, value := range map[string]string{
+		"CLOUDSQL_MAX_OPEN_CONNS":     "0",
+		"CLOUDSQL_MAX_IDLE_CONNS":     "5",
+		"CLOUDSQL_CONN_MAX_LIFETIME":  "0s",
+		"CLOUDSQL_CONNECT_TIMEOUT":    "soon",
+		"CLOUDSQL_STATEMENT_TIMEOUT":  "-1s",
+		"CLOUDSQL_CONN_MAX_IDLE_TIME": "forever",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := loadPool(); err == nil {
+				t.Errorf("Expected an error for %s=%s", env, value)
+			}
+		})
+	}
+}
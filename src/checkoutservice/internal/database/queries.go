@@ -1,52 +1,257 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
+
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/lib/pq"
 )
 
+// MaxOrdersPerUser caps how many orders GetOrdersByUser loads for one user so
+// a very long history can't exhaust memory. Newer orders are kept.
+const MaxOrdersPerUser = 500
+
+// ErrDuplicateOrder is returned by SaveOrder for an order ID that is already
+// stored, for example by an earlier attempt of a retried PlaceOrder.
+var ErrDuplicateOrder error = &classifiedError{class: ErrDuplicate, err: errors.New("order already saved")}
+
+// ErrOrderNotFound is returned by GetOrderByID for an unknown order ID, and by
+// GetOrderByTrackingID for an unknown tracking ID.
+var ErrOrderNotFound error = &classifiedError{class: ErrNotFound, err: errors.New("order not found")}
+
+// DateRange restricts orders to those placed at or after From and before To.
+// A zero bound leaves that side of the range open.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains reports whether t falls within the range.
+func (r DateRange) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// OrderCursor marks the last order of a page of GetOrdersPage. Orders sort by
+// date, newest first, and by ID among orders placed at the same time.
+type OrderCursor struct {
+	OrderDate time.Time
+	OrderID   string
+}
+
 const (
-	// SQL queries for order operations
+	// SQL queries for order operations. An order is dated now unless it
+	// has an order_date, as one saved late from the order buffer does. Its
+	// address_id is dropped if the address was deleted while the order was
+	// placed, rather than failing the save of a charged order.
 	insertOrderSQL = `
 	INSERT INTO order_history (
 		order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
-		shipping_tracking_id, shipping_address, order_date, status
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), 'completed')`
+		shipping_tracking_id, shipping_address, order_date, status,
+		discount_code, discount_amount_currency, discount_amount_units, discount_amount_nanos,
+		subtotal_amount_currency, subtotal_amount_units, subtotal_amount_nanos,
+		tax_amount_currency, tax_amount_units, tax_amount_nanos, tax_breakdown, address_id
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($10, NOW()), $9,
+		NULLIF($11, ''), $12, $13, $14, $15, $16, $17, $18, $19, $20, $21,
+		(SELECT address_id FROM addresses WHERE address_id = $22 AND user_id = $2))
+	ON CONFLICT (order_id) DO NOTHING`
 
-	insertOrderItemSQL = `
+	// insertOrderItemsSQL inserts all items of an order in one statement,
+	// taking each column as an array. Items get IDs in the order listed.
+	insertOrderItemsSQL = `
 	INSERT INTO order_items (
 		order_id, product_id, quantity, unit_price_currency, unit_price_units, unit_price_nanos,
 		total_price_currency, total_price_units, total_price_nanos
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	)
+	SELECT $1, i.product_id, i.quantity, i.unit_price_currency, i.unit_price_units, i.unit_price_nanos,
+		   i.total_price_currency, i.total_price_units, i.total_price_nanos
+	FROM unnest($2::varchar[], $3::integer[], $4::varchar[], $5::bigint[], $6::integer[],
+				$7::varchar[], $8::bigint[], $9::integer[])
+		WITH ORDINALITY AS i(product_id, quantity, unit_price_currency, unit_price_units, unit_price_nanos,
+							 total_price_currency, total_price_units, total_price_nanos, n)
+	ORDER BY i.n`
+
+	completeOrderSQL = `
+	UPDATE order_history SET status = $2, shipping_tracking_id = $3
+	WHERE order_id = $1
+	RETURNING order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')`
+
+	deletePendingOrderSQL = `
+	DELETE FROM order_history WHERE order_id = $1 AND status = 'pending'`
+
+	getOrderOwnerSQL = `
+	SELECT user_id FROM order_history WHERE order_id = $1`
+
+	// deleteStalePendingOrdersSQL takes the age in milliseconds.
+	deleteStalePendingOrdersSQL = `
+	DELETE FROM order_history
+	WHERE status = 'pending' AND order_date < NOW() - $1::float8 * INTERVAL '1 millisecond'
+	RETURNING order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')`
+
+	insertStatusChangeSQL = `
+	INSERT INTO order_status_history (order_id, from_status, to_status, reason)
+	VALUES ($1, NULLIF($2, ''), $3, $4)`
+
+	lockOrderStatusSQL = `
+	SELECT user_id, status FROM order_history WHERE order_id = $1 FOR UPDATE`
+
+	updateOrderStatusSQL = `
+	UPDATE order_history SET status = $2
+	WHERE order_id = $1
+	RETURNING order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')`
+
+	// insertOrderEventSQL records an event, marked published and skipped if
+	// $5 is true, and queued for webhooks and skipped if $6 is.
+	insertOrderEventSQL = `
+	INSERT INTO order_events (order_id, event_type, from_status, reason, published_at, publish_skipped, webhooks_queued_at, webhooks_skipped)
+	VALUES ($1, $2, $3, $4, CASE WHEN $5::bool THEN NOW() END, $5::bool, CASE WHEN $6::bool THEN NOW() END, $6::bool)`
+
+	// Events locked by another replica's publisher are skipped, so each is
+	// published by one replica at a time.
+	// claimPendingOrderEventsSQL leases unpublished events, like
+	// claimDueConfirmationsSQL, until publish_lease_until.
+	claimPendingOrderEventsSQL = `
+	WITH pending AS (
+		SELECT id FROM order_events
+		WHERE published_at IS NULL AND (publish_lease_until IS NULL OR publish_lease_until <= NOW())
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	), claimed AS (
+		UPDATE order_events e SET publish_lease_until = NOW() + $2::float8 * INTERVAL '1 millisecond'
+		FROM pending WHERE e.id = pending.id
+		RETURNING e.id, e.order_id, e.event_type, e.from_status, e.reason, e.created_at
+	)
+	SELECT e.id, e.event_type, e.from_status, e.reason, e.created_at,
+		   o.order_id, o.user_id, o.email, o.total_amount_currency, o.total_amount_units, o.total_amount_nanos,
+		   o.shipping_tracking_id, o.shipping_address, o.order_date, o.status, COALESCE(o.confirmation_status, '')
+	FROM claimed e JOIN order_history o ON o.order_id = e.order_id
+	ORDER BY e.id`
+
+	markOrderEventsPublishedSQL = `
+	UPDATE order_events SET published_at = NOW(), publish_lease_until = NULL WHERE id = ANY($1)`
+
+	// releaseOrderEventsSQL ends the lease of events that failed to publish,
+	// so they are tried again at the next check.
+	releaseOrderEventsSQL = `
+	UPDATE order_events SET publish_lease_until = NULL WHERE id = ANY($1) AND published_at IS NULL`
 
 	getOrdersByUserSQL = `
 	SELECT order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
-		   shipping_tracking_id, shipping_address, order_date, status
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')
+	FROM order_history
+	WHERE user_id = $1 AND status <> 'pending'
+	ORDER BY order_date DESC
+	LIMIT $2`
+
+	getOrdersPageSQL = `
+	SELECT order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')
 	FROM order_history
-	WHERE user_id = $1
-	ORDER BY order_date DESC`
+	WHERE user_id = $1 AND status <> 'pending'
+	  AND ($2::timestamp IS NULL OR (order_date, order_id) < ($2::timestamp, $3))
+	  AND ($4::timestamp IS NULL OR order_date >= $4::timestamp)
+	  AND ($5::timestamp IS NULL OR order_date < $5::timestamp)
+	ORDER BY order_date DESC, order_id DESC
+	LIMIT $6`
+
+	getOrderByIDSQL = `
+	SELECT order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')
+	FROM order_history
+	WHERE order_id = $1`
+
+	// Tracking IDs are not unique in the table, so the latest order wins.
+	getOrderByTrackingIDSQL = `
+	SELECT order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')
+	FROM order_history
+	WHERE shipping_tracking_id = $1
+	ORDER BY order_date DESC, order_id DESC
+	LIMIT 1`
 
 	getOrderItemsSQL = `
 	SELECT id, order_id, product_id, quantity, unit_price_currency, unit_price_units, unit_price_nanos,
 		   total_price_currency, total_price_units, total_price_nanos
 	FROM order_items
-	WHERE order_id = $1`
+	WHERE order_id = $1
+	ORDER BY id`
 )
 
-// SaveOrder saves an order and its items to the database
-func (c *Connection) SaveOrder(order *models.Order, items []models.OrderItem) error {
+// SaveOrder saves an order and its items to the database and records a
+// models.EventOrderPlaced event, unless the order is pending. It returns
+// ErrDuplicateOrder, leaving the stored order as it is, if the order ID is
+// taken. Transient failures are retried, and a retry that finds the order ID
+// taken by the same user succeeds, since an attempt whose commit was not
+// acknowledged saved the order.
+func (c *Connection) SaveOrder(ctx context.Context, order *models.Order, items []models.OrderItem) error {
 	if c.DB == nil {
-		return fmt.Errorf("database connection not initialized")
+		return errNotInitialized
 	}
+	// A pending order is PlaceOrder reserving it before the charge.
+	op := "SaveOrder"
+	if order.Status == models.StatusPending {
+		op = "ReserveOrder"
+	}
+	ctx, span := c.startSpan(ctx, op, insertOrderSQL)
+	retried := false
+	err := c.writeRetry().retry(ctx, c.log, "save order "+order.OrderID, func() error {
+		err := c.saveOrder(ctx, order, items, retried)
+		retried = true
+		return err
+	})
+	// The order row and its items.
+	endSpan(span, 1+len(items), err)
+	return err
+}
 
-	tx, err := c.DB.Begin()
+// saveOrder makes one attempt of SaveOrder. A retried attempt takes an order
+// of the same user already stored under the ID as its own.
+func (c *Connection) saveOrder(ctx context.Context, order *models.Order, items []models.OrderItem, retried bool) error {
+	tx, err := c.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
 	}
 	defer tx.Rollback()
 
+	taxBreakdown, err := json.Marshal(order.TaxBreakdown)
+	if err != nil {
+		return fmt.Errorf("failed to encode tax breakdown: %w", err)
+	}
+	if order.TaxBreakdown == nil {
+		taxBreakdown = []byte("[]")
+	}
+
 	// Insert order
-	_, err = tx.Exec(insertOrderSQL,
+	res, err := tx.ExecContext(ctx, insertOrderSQL,
 		order.OrderID,
 		order.UserID,
 		order.Email,
@@ -55,85 +260,568 @@ func (c *Connection) SaveOrder(order *models.Order, items []models.OrderItem) er
 		order.TotalAmountNanos,
 		order.ShippingTrackingID,
 		order.ShippingAddress,
+		order.Status,
+		sql.NullTime{Time: order.OrderDate, Valid: !order.OrderDate.IsZero()},
+		order.DiscountCode,
+		order.DiscountAmountCurrency,
+		order.DiscountAmountUnits,
+		order.DiscountAmountNanos,
+		order.SubtotalAmountCurrency,
+		order.SubtotalAmountUnits,
+		order.SubtotalAmountNanos,
+		order.TaxAmountCurrency,
+		order.TaxAmountUnits,
+		order.TaxAmountNanos,
+		// As a string: lib/pq would send a []byte as bytea.
+		string(taxBreakdown),
+		order.AddressID,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert order: %v", err)
-	}
-
-	// Insert order items
-	for _, item := range items {
-		_, err = tx.Exec(insertOrderItemSQL,
-			item.OrderID,
-			item.ProductID,
-			item.Quantity,
-			item.UnitPriceCurrency,
-			item.UnitPriceUnits,
-			item.UnitPriceNanos,
-			item.TotalPriceCurrency,
-			item.TotalPriceUnits,
-			item.TotalPriceNanos,
-		)
+		return fmt.Errorf("failed to insert order: %w", classify(err))
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if !retried {
+			return ErrDuplicateOrder
+		}
+		var owner string
+		if err := tx.QueryRowContext(ctx, getOrderOwnerSQL, order.OrderID).Scan(&owner); err != nil {
+			return fmt.Errorf("failed to read order owner: %w", classify(err))
+		}
+		if owner != order.UserID {
+			return ErrDuplicateOrder
+		}
+		return nil
+	}
+
+	// Record the initial status and the order_placed event. A pending
+	// order's event is recorded by CompleteOrder.
+	if _, err := tx.ExecContext(ctx, insertStatusChangeSQL, order.OrderID, "", order.Status, order.StatusReason); err != nil {
+		return fmt.Errorf("failed to insert order status: %w", classify(err))
+	}
+	if order.Status != models.StatusPending {
+		if err := c.insertOrderEvent(ctx, tx, order.OrderID, models.EventOrderPlaced, "", order.StatusReason); err != nil {
+			return fmt.Errorf("failed to insert order event: %w", classify(err))
+		}
+	}
+
+	// Insert order items in one round trip
+	if len(items) > 0 {
+		if _, err := tx.ExecContext(ctx, insertOrderItemsSQL, orderItemsArgs(order.OrderID, items)...); err != nil {
+			return fmt.Errorf("failed to insert order items: %w", classify(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit order: %w", classify(err))
+	}
+	return nil
+}
+
+// CompleteOrder moves a pending order saved by SaveOrder to status, sets its
+// shipping tracking ID, and records the status change and a
+// models.EventOrderPlaced event. An order held for review is stored with its
+// hold, which may be nil otherwise. It returns ErrOrderNotFound for an
+// unknown order, and an error wrapping models.ErrInvalidStatusTransition if
+// the order is no longer pending or may not move to status. Transient
+// failures are retried, since the card is already charged.
+func (c *Connection) CompleteOrder(ctx context.Context, orderID, status, trackingID string, hold *models.OrderHold) (*models.Order, error) {
+	return c.finishOrder(ctx, "CompleteOrder", orderID, models.StatusPending, status, trackingID, "", models.EventOrderPlaced, hold)
+}
+
+// finishOrder moves an order from status from to status to, sets its
+// shipping tracking ID, and records the status change with reason, an event
+// of type event and hold unless it is nil. Transient failures are retried,
+// all under one span for operation op. An order already in status to with
+// trackingID is returned as it is, since an attempt whose commit was not
+// acknowledged moved it.
+func (c *Connection) finishOrder(ctx context.Context, op, orderID, from, to, trackingID, reason, event string, hold *models.OrderHold) (*models.Order, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+	ctx, span := c.startSpan(ctx, op, completeOrderSQL)
+	var order *models.Order
+	err := c.writeRetry().retry(ctx, c.log, "move order "+orderID+" to "+to, func() error {
+		var err error
+		order, err = c.finishOrderOnce(ctx, orderID, from, to, trackingID, reason, event, hold)
+		return err
+	})
+	endSpan(span, 1, err)
+	return order, err
+}
+
+// finishOrderOnce makes one attempt of finishOrder.
+func (c *Connection) finishOrderOnce(ctx context.Context, orderID, from, to, trackingID, reason, event string, hold *models.OrderHold) (*models.Order, error) {
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var owner, status string
+	err = tx.QueryRowContext(ctx, lockOrderStatusSQL, orderID).Scan(&owner, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order status: %w", classify(err))
+	}
+	if status == to && from != to {
+		order, err := scanOrder(tx.QueryRowContext(ctx, getOrderByIDSQL, orderID))
 		if err != nil {
-			return fmt.Errorf("failed to insert order item: %v", err)
+			return nil, fmt.Errorf("failed to read order: %w", classify(err))
+		}
+		if order.ShippingTrackingID == trackingID {
+			return &order, nil
 		}
 	}
+	if status != from {
+		return nil, fmt.Errorf("%w: order %s is %s, not %s", models.ErrInvalidStatusTransition, orderID, status, from)
+	}
+	if err := models.CheckStatusTransition(from, to); err != nil {
+		return nil, err
+	}
 
-	return tx.Commit()
+	order, err := scanOrder(tx.QueryRowContext(ctx, completeOrderSQL, orderID, to, trackingID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete order: %w", classify(err))
+	}
+	if _, err := tx.ExecContext(ctx, insertStatusChangeSQL, orderID, from, to, reason); err != nil {
+		return nil, fmt.Errorf("failed to insert order status: %w", classify(err))
+	}
+	if event != "" {
+		// A placed order had no status before, as far as consumers know.
+		eventFrom := from
+		if event == models.EventOrderPlaced {
+			eventFrom = ""
+		}
+		if err := c.insertOrderEvent(ctx, tx, orderID, event, eventFrom, reason); err != nil {
+			return nil, fmt.Errorf("failed to insert order event: %w", classify(err))
+		}
+	}
+	if hold != nil {
+		if err := putOrderHold(ctx, tx, hold); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit order: %w", classify(err))
+	}
+	return &order, nil
 }
 
-// GetOrdersByUser retrieves all orders for a specific user
-func (c *Connection) GetOrdersByUser(userID string) ([]models.Order, error) {
+// DeletePendingOrder deletes an order saved by SaveOrder that is still
+// pending, with its items. Orders in any other status are kept.
+func (c *Connection) DeletePendingOrder(ctx context.Context, orderID string) (err error) {
 	if c.DB == nil {
-		return nil, fmt.Errorf("database connection not initialized")
+		return errNotInitialized
 	}
+	ctx, span := c.startSpan(ctx, "DeletePendingOrder", deletePendingOrderSQL)
+	var deleted int64
+	defer func() { endSpan(span, int(deleted), err) }()
+	res, err := c.DB.ExecContext(ctx, deletePendingOrderSQL, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to delete pending order: %w", classify(err))
+	}
+	deleted, _ = res.RowsAffected()
+	return nil
+}
 
-	rows, err := c.DB.Query(getOrdersByUserSQL, userID)
+// DeleteStalePendingOrders deletes the orders saved by SaveOrder that are
+// still pending after olderThan, with their items, and returns them. Their
+// PlaceOrder stopped without completing or dropping them, so they would
+// otherwise block every retry of the order.
+func (c *Connection) DeleteStalePendingOrders(ctx context.Context, olderThan time.Duration) ([]models.Order, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+	rows, err := c.DB.QueryContext(ctx, deleteStalePendingOrdersSQL, olderThan.Milliseconds())
 	if err != nil {
-		return nil, fmt.Errorf("failed to query orders: %v", err)
+		return nil, fmt.Errorf("failed to delete stale pending orders: %w", classify(err))
 	}
 	defer rows.Close()
-
 	var orders []models.Order
 	for rows.Next() {
-		var order models.Order
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stale pending order: %w", classify(err))
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	return orders, nil
+}
+
+// orderItemsArgs returns the arguments of insertOrderItemsSQL: the order ID
+// followed by each item column as an array with one element per item.
+func orderItemsArgs(orderID string, items []models.OrderItem) []any {
+	var (
+		productIDs         = make([]string, len(items))
+		quantities         = make([]int64, len(items))
+		unitPriceCurrency  = make([]string, len(items))
+		unitPriceUnits     = make([]int64, len(items))
+		unitPriceNanos     = make([]int64, len(items))
+		totalPriceCurrency = make([]string, len(items))
+		totalPriceUnits    = make([]int64, len(items))
+		totalPriceNanos    = make([]int64, len(items))
+	)
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+		quantities[i] = int64(item.Quantity)
+		unitPriceCurrency[i] = item.UnitPriceCurrency
+		unitPriceUnits[i] = item.UnitPriceUnits
+		unitPriceNanos[i] = int64(item.UnitPriceNanos)
+		totalPriceCurrency[i] = item.TotalPriceCurrency
+		totalPriceUnits[i] = item.TotalPriceUnits
+		totalPriceNanos[i] = int64(item.TotalPriceNanos)
+	}
+	return []any{
+		orderID,
+		pq.Array(productIDs),
+		pq.Array(quantities),
+		pq.Array(unitPriceCurrency),
+		pq.Array(unitPriceUnits),
+		pq.Array(unitPriceNanos),
+		pq.Array(totalPriceCurrency),
+		pq.Array(totalPriceUnits),
+		pq.Array(totalPriceNanos),
+	}
+}
+
+// UpdateOrderStatus moves an order to a new status and records the change and
+// its reason in order_status_history, and a models.EventOrderShipped event
+// when the order ships. It returns the updated order, ErrOrderNotFound for an
+// unknown order, or an error from models.CheckStatusTransition if the order
+// may not move to the status.
+func (c *Connection) UpdateOrderStatus(ctx context.Context, orderID, status, reason string) (*models.Order, error) {
+	return c.changeOrderStatus(ctx, orderID, "", status, reason, models.StatusEvent(status))
+}
+
+// CancelOrder cancels an order of the user like UpdateOrderStatus and records
+// a models.EventOrderCancelled event for PublishOrderEvents in the same
+// transaction. The order of another user is ErrOrderNotFound.
+func (c *Connection) CancelOrder(ctx context.Context, userID, orderID, reason string) (*models.Order, error) {
+	return c.changeOrderStatus(ctx, orderID, userID, models.StatusCancelled, reason, models.EventOrderCancelled)
+}
+
+// changeOrderStatus moves an order to status, checking that it belongs to
+// userID unless that is empty, and records an event of type event unless
+// that is empty.
+func (c *Connection) changeOrderStatus(ctx context.Context, orderID, userID, status, reason, event string) (*models.Order, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var owner, from string
+	err = tx.QueryRowContext(ctx, lockOrderStatusSQL, orderID).Scan(&owner, &from)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && userID != "" && owner != userID) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order status: %w", classify(err))
+	}
+	if err := models.CheckStatusTransition(from, status); err != nil {
+		return nil, err
+	}
+
+	order, err := scanOrder(tx.QueryRowContext(ctx, updateOrderStatusSQL, orderID, status))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order status: %w", classify(err))
+	}
+	if _, err := tx.ExecContext(ctx, insertStatusChangeSQL, orderID, from, status, reason); err != nil {
+		return nil, fmt.Errorf("failed to insert order status: %w", classify(err))
+	}
+	if event != "" {
+		if err := c.insertOrderEvent(ctx, tx, orderID, event, from, reason); err != nil {
+			return nil, fmt.Errorf("failed to insert order event: %w", classify(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit order status: %w", classify(err))
+	}
+	return &order, nil
+}
+
+// insertOrderEvent records an event of an order in the outbox within tx.
+// Without a Pub/Sub topic or webhook endpoints the event is marked skipped by
+// them, so it doesn't wait for them forever.
+func (c *Connection) insertOrderEvent(ctx context.Context, tx *sql.Tx, orderID, event, from, reason string) error {
+	_, err := tx.ExecContext(ctx, insertOrderEventSQL, orderID, event, from, reason, c.config.SkipPublish, c.config.SkipWebhooks)
+	return err
+}
+
+// PublishOrderEvents claims up to limit unpublished events, oldest first,
+// for lease and passes them to publish, with no transaction open. It then
+// marks them published if publish succeeds, or releases them to be tried
+// again if it fails. Replicas publishing concurrently skip claimed events,
+// and events whose outcome can't be saved are published again once the
+// lease is over. It returns how many events were published.
+func (c *Connection) PublishOrderEvents(ctx context.Context, limit int, lease time.Duration, publish func([]models.OrderEvent) error) (int, error) {
+	if c.DB == nil {
+		return 0, errNotInitialized
+	}
+
+	rows, err := c.DB.QueryContext(ctx, claimPendingOrderEventsSQL, limit, lease.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim order events: %w", classify(err))
+	}
+	var events []models.OrderEvent
+	var ids []int64
+	for rows.Next() {
+		var e models.OrderEvent
 		err := rows.Scan(
-			&order.OrderID,
-			&order.UserID,
-			&order.Email,
-			&order.TotalAmountCurrency,
-			&order.TotalAmountUnits,
-			&order.TotalAmountNanos,
-			&order.ShippingTrackingID,
-			&order.ShippingAddress,
-			&order.OrderDate,
-			&order.Status,
+			&e.ID,
+			&e.Type,
+			&e.FromStatus,
+			&e.Reason,
+			&e.CreatedAt,
+			&e.Order.OrderID,
+			&e.Order.UserID,
+			&e.Order.Email,
+			&e.Order.TotalAmountCurrency,
+			&e.Order.TotalAmountUnits,
+			&e.Order.TotalAmountNanos,
+			&e.Order.ShippingTrackingID,
+			&e.Order.ShippingAddress,
+			&e.Order.OrderDate,
+			&e.Order.Status,
+			&e.Order.ConfirmationStatus,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %v", err)
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan order event: %w", classify(err))
+		}
+		events = append(events, e)
+		ids = append(ids, e.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(events); err != nil {
+		if _, releaseErr := c.DB.ExecContext(ctx, releaseOrderEventsSQL, pq.Array(ids)); releaseErr != nil {
+			c.log.Warnf("failed to release %d order events: %v", len(ids), releaseErr)
+		}
+		return 0, err
+	}
+	if _, err := c.DB.ExecContext(ctx, markOrderEventsPublishedSQL, pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("failed to mark order events published: %w", classify(err))
+	}
+	return len(events), nil
+}
+
+// GetOrdersByUser retrieves the most recent orders for a specific user, at most
+// MaxOrdersPerUser of them. truncated reports whether older orders were left out.
+// Pending orders, which are still being placed, are left out too.
+func (c *Connection) GetOrdersByUser(ctx context.Context, userID string) (orders []models.Order, truncated bool, err error) {
+	if c.DB == nil {
+		return nil, false, errNotInitialized
+	}
+	ctx, span := c.startSpan(ctx, "GetOrdersByUser", getOrdersByUserSQL)
+	defer func() { endSpan(span, len(orders), err) }()
+
+	// Fetch one extra row to learn whether the history was cut off.
+	rows, err := c.readDB().QueryContext(ctx, getOrdersByUserSQL, userID, MaxOrdersPerUser+1)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query orders: %w", classify(err))
+	}
+	defer rows.Close()
+
+	orders = make([]models.Order, 0, 16)
+	for rows.Next() {
+		if len(orders) == MaxOrdersPerUser {
+			truncated = true
+			break
+		}
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+
+	return orders, truncated, nil
+}
+
+// GetOrdersPage retrieves up to limit orders of a user placed within dates,
+// newest first, that come after the cursor. A nil cursor starts at the newest
+// order. Pending orders, which are still being placed, are left out.
+func (c *Connection) GetOrdersPage(ctx context.Context, userID string, dates DateRange, after *OrderCursor, limit int) ([]models.Order, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	var afterDate sql.NullTime
+	var afterID string
+	if after != nil {
+		afterDate = nullTime(after.OrderDate)
+		afterID = after.OrderID
+	}
+	rows, err := c.readDB().QueryContext(ctx, getOrdersPageSQL, userID, afterDate, afterID,
+		nullTime(dates.From), nullTime(dates.To), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", classify(err))
+	}
+	defer rows.Close()
+
+	orders := make([]models.Order, 0, limit)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
 		}
 		orders = append(orders, order)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %v", err)
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
 	}
 
 	return orders, nil
 }
 
-// GetOrderItems retrieves all items for a specific order
-func (c *Connection) GetOrderItems(orderID string) ([]models.OrderItem, error) {
+// GetOrderByID retrieves a single order without its items. It returns
+// ErrOrderNotFound if there is no order with the ID.
+func (c *Connection) GetOrderByID(ctx context.Context, orderID string) (*models.Order, error) {
 	if c.DB == nil {
-		return nil, fmt.Errorf("database connection not initialized")
+		return nil, errNotInitialized
+	}
+
+	order, err := scanOrder(c.readDB().QueryRowContext(ctx, getOrderByIDSQL, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetPlacedOrder retrieves an order and its items from the primary, where an
+// order saved by SaveOrder is visible at once. It returns ErrOrderNotFound if
+// there is no order with the ID.
+func (c *Connection) GetPlacedOrder(ctx context.Context, orderID string) (*models.Order, []models.OrderItem, error) {
+	if c.DB == nil {
+		return nil, nil, errNotInitialized
+	}
+
+	order, err := scanOrder(c.DB.QueryRowContext(ctx, getOrderByIDSQL, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query order: %w", classify(err))
 	}
+	items, err := getOrderItems(ctx, c.DB, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &order, items, nil
+}
+
+// GetOrderByTrackingID retrieves the order shipped with a tracking ID, without
+// its items. It returns ErrOrderNotFound if no order has the tracking ID.
+func (c *Connection) GetOrderByTrackingID(ctx context.Context, trackingID string) (*models.Order, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	order, err := scanOrder(c.readDB().QueryRowContext(ctx, getOrderByTrackingIDSQL, trackingID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// nullTime maps the zero time to NULL. Other times are converted to UTC, the
+// time zone order_date is stored in, since the timestamp columns drop offsets.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// scanOrder reads the order_history columns selected by the order queries.
+func scanOrder(row interface{ Scan(...any) error }) (models.Order, error) {
+	var order models.Order
+	var taxBreakdown []byte
+	err := row.Scan(
+		&order.OrderID,
+		&order.UserID,
+		&order.Email,
+		&order.TotalAmountCurrency,
+		&order.TotalAmountUnits,
+		&order.TotalAmountNanos,
+		&order.ShippingTrackingID,
+		&order.ShippingAddress,
+		&order.OrderDate,
+		&order.Status,
+		&order.ConfirmationStatus,
+		&order.DiscountCode,
+		&order.DiscountAmountCurrency,
+		&order.DiscountAmountUnits,
+		&order.DiscountAmountNanos,
+		&order.SubtotalAmountCurrency,
+		&order.SubtotalAmountUnits,
+		&order.SubtotalAmountNanos,
+		&order.TaxAmountCurrency,
+		&order.TaxAmountUnits,
+		&order.TaxAmountNanos,
+		&taxBreakdown,
+		&order.AddressID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return order, err
+	}
+	if err != nil {
+		return order, fmt.Errorf("failed to scan order: %w", classify(err))
+	}
+	if taxBreakdown != nil {
+		if err := json.Unmarshal(taxBreakdown, &order.TaxBreakdown); err != nil {
+			return order, fmt.Errorf("failed to decode tax breakdown of order %s: %w", order.OrderID, err)
+		}
+	}
+	return order, nil
+}
+
+// GetOrderItems retrieves all items for a specific order, in the order they
+// were saved
+func (c *Connection) GetOrderItems(ctx context.Context, orderID string) (items []models.OrderItem, err error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+	ctx, span := c.startSpan(ctx, "GetOrderItems", getOrderItemsSQL)
+	defer func() { endSpan(span, len(items), err) }()
+
+	return getOrderItems(ctx, c.readDB(), orderID)
+}
 
-	rows, err := c.DB.Query(getOrderItemsSQL, orderID)
+// getOrderItems queries the items of an order with q.
+func getOrderItems(ctx context.Context, q querier, orderID string) (items []models.OrderItem, err error) {
+	rows, err := q.QueryContext(ctx, getOrderItemsSQL, orderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query order items: %v", err)
+		return nil, fmt.Errorf("failed to query order items: %w", classify(err))
 	}
 	defer rows.Close()
 
-	var items []models.OrderItem
 	for rows.Next() {
 		var item models.OrderItem
 		err := rows.Scan(
@@ -149,13 +837,13 @@ func (c *Connection) GetOrderItems(orderID string) ([]models.OrderItem, error) {
 			&item.TotalPriceNanos,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order item: %v", err)
+			return nil, fmt.Errorf("failed to scan order item: %w", classify(err))
 		}
 		items = append(items, item)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %v", err)
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
 	}
 
 	return items, nil
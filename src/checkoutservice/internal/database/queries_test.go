@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+func TestDateRangeContains(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		r    DateRange
+		t    time.Time
+		want bool
+	}{
+		{DateRange{}, from, true},
+		{DateRange{From: from, To: to}, from, true},
+		{DateRange{From: from, To: to}, to.Add(-time.Nanosecond), true},
+		{DateRange{From: from, To: to}, to, false},
+		{DateRange{From: from, To: to}, from.Add(-time.Nanosecond), false},
+		{DateRange{From: from}, to.AddDate(1, 0, 0), true},
+		{DateRange{To: to}, from.AddDate(-1, 0, 0), true},
+	} {
+		if got := tc.r.Contains(tc.t); got != tc.want {
+			t.Errorf("%+v.Contains(%v) = %v, want %v", tc.r, tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestNullTime(t *testing.T) {
+	if nullTime(time.Time{}).Valid {
+		t.Error("Expected the zero time to be NULL")
+	}
+	local := time.Date(2025, 1, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	got := nullTime(local)
+	if !got.Valid || got.Time.Location() != time.UTC || got.Time.Hour() != 0 {
+		t.Errorf("Expected %v in UTC, got %+v", local, got)
+	}
+}
+
+func TestOrderItemsArgs(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: "PRODUCT-1", Quantity: 2, UnitPriceCurrency: "USD", UnitPriceUnits: 15, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 31, TotalPriceNanos: 980000000},
+		{ProductID: "PRODUCT-2", Quantity: 1, UnitPriceCurrency: "USD", UnitPriceUnits: 9, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 9, TotalPriceNanos: 990000000},
+	}
+
+	args := orderItemsArgs("order-1", items)
+	want := []any{
+		"order-1",
+		`{"PRODUCT-1","PRODUCT-2"}`,
+		"{2,1}",
+		`{"USD","USD"}`,
+		"{15,9}",
+		"{990000000,990000000}",
+		`{"USD","USD"}`,
+		"{31,9}",
+		"{980000000,990000000}",
+	}
+	if len(args) != len(want) {
+		t.Fatalf("Expected %d args, got %d", len(want), len(args))
+	}
+	for i, arg := range args {
+		if v, ok := arg.(driver.Valuer); ok {
+			var err error
+			if arg, err = v.Value(); err != nil {
+				t.Fatalf("arg %d: %v", i+1, err)
+			}
+		}
+		if s, ok := arg.([]byte); ok {
+			arg = string(s)
+		}
+		if arg != want[i] {
+			t.Errorf("arg %d = %v, want %v", i+1, arg, want[i])
+		}
+	}
+}
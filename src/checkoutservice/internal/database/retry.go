@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// maxWriteBackoff caps the delay between attempts of a write.
+const maxWriteBackoff = 2 * time.Second
+
+// WriteRetry configures retrying order writes that fail transiently, such as
+// during a Cloud SQL failover.
+type WriteRetry struct {
+	MaxAttempts int           // attempts in all; 1 disables retries
+	Backoff     time.Duration // delay after the first failed attempt, doubled after each one
+}
+
+// loadWriteRetry reads the write retry settings from the environment:
+//
+//   - CLOUDSQL_WRITE_MAX_ATTEMPTS is the number of attempts of a write (default 4).
+//   - CLOUDSQL_WRITE_BACKOFF is the delay after the first failed attempt
+//     (default 100ms), doubled after each one up to 2s.
+func loadWriteRetry() (WriteRetry, error) {
+	r := WriteRetry{MaxAttempts: 4, Backoff: 100 * time.Millisecond}
+	if s := os.Getenv("CLOUDSQL_WRITE_MAX_ATTEMPTS"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return WriteRetry{}, fmt.Errorf("CLOUDSQL_WRITE_MAX_ATTEMPTS (%s) must be a positive integer", s)
+		}
+		r.MaxAttempts = v
+	}
+	if s := os.Getenv("CLOUDSQL_WRITE_BACKOFF"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return WriteRetry{}, fmt.Errorf("failed to parse CLOUDSQL_WRITE_BACKOFF (%s) as a positive time.Duration", s)
+		}
+		r.Backoff = v
+	}
+	return r, nil
+}
+
+// IsTransient reports whether err may go away if the operation is retried:
+// the database was unavailable, or the transaction was rolled back by a
+// serialization failure or deadlock.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrUnavailable) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Class() == "40" // transaction_rollback
+}
+
+// retry runs fn until it succeeds, fails with an error that is not
+// transient, or has had r.MaxAttempts, waiting with exponential backoff in
+// between. fn must be safe to run again after a failure that may have
+// committed, such as a connection lost during COMMIT. It returns fn's last
+// error, or ctx's error if ctx is done while waiting.
+func (r WriteRetry) retry(ctx context.Context, log *logrus.Logger, op string, fn func() error) error {
+	delay := r.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.MaxAttempts || !IsTransient(err) {
+			return err
+		}
+		log.Warnf("failed to %s (attempt %d of %d), retrying in %v: %v", op, attempt, r.MaxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxWriteBackoff)
+	}
+}
+
+// writeRetry returns the connection's write retry settings. Connections
+// without a Config try writes once.
+func (c *Connection) writeRetry() WriteRetry {
+	if c.config == nil {
+		return WriteRetry{MaxAttempts: 1}
+	}
+	return c.config.WriteRetry
+}
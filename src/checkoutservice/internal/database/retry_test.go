@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoadWriteRetry(t *testing.T) {
+	r, err := loadWriteRetry()
+	if err != nil || r != (WriteRetry{MaxAttempts: 4, Backoff: 100 * time.Millisecond}) {
+		t.Errorf("loadWriteRetry() = %+v, %v; want the defaults", r, err)
+	}
+
+	t.Setenv("CLOUDSQL_WRITE_MAX_ATTEMPTS", "1")
+	t.Setenv("CLOUDSQL_WRITE_BACKOFF", "1s")
+	if r, err := loadWriteRetry(); err != nil || r != (WriteRetry{MaxAttempts: 1, Backoff: time.Second}) {
+		t.Errorf("loadWriteRetry() = %+v, %v", r, err)
+	}
+
+	for env, value := range map[string]string{"CLOUDSQL_WRITE_MAX_ATTEMPTS": "0", "CLOUDSQL_WRITE_BACKOFF": "soon"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := loadWriteRetry(); err == nil {
+				t.Errorf("Expected an error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for err, want := range map[error]bool{
+		classify(&pq.Error{Code: "40001"}):    true, // serialization_failure
+		classify(&pq.Error{Code: "40P01"}):    true, // deadlock_detected
+		classify(&pq.Error{Code: "08006"}):    true,
+		classify(io.ErrUnexpectedEOF):         true,
+		classify(&pq.Error{Code: "23505"}):    false,
+		ErrDuplicateOrder:                     false,
+		ErrOrderNotFound:                      false,
+		errors.New("invalid input"):           false,
+		fmt.Errorf("x: %w", context.Canceled): false,
+	} {
+		if got := IsTransient(fmt.Errorf("failed to insert order: %w", err)); got != want {
+			t.Errorf("IsTransient(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestWriteRetry(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	r := WriteRetry{MaxAttempts: 3, Backoff: time.Millisecond}
+	transient := classify(&pq.Error{Code: "40001"})
+
+	tests := []struct {
+		name         string
+		errs         []error // returned by successive attempts
+		wantAttempts int
+		wantErr      error
+	}{
+		{"succeeds", []error{nil}, 1, nil},
+		{"recovers", []error{transient, transient, nil}, 3, nil},
+		{"gives up", []error{transient, transient, transient}, 3, transient},
+		{"permanent error", []error{ErrDuplicateOrder}, 1, ErrDuplicateOrder},
+		{"duplicate after retry", []error{transient, ErrDuplicateOrder}, 2, ErrDuplicateOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := r.retry(context.Background(), logger, "save order", func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+			if attempts != tt.wantAttempts || err != tt.wantErr {
+				t.Errorf("retry made %d attempts and returned %v; want %d and %v", attempts, err, tt.wantAttempts, tt.wantErr)
+			}
+		})
+	}
+
+	// Waiting stops with the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := WriteRetry{MaxAttempts: 3, Backoff: time.Hour}
+	err := slow.retry(ctx, logger, "save order", func() error {
+		cancel()
+		return transient
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
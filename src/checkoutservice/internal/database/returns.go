@@ -0,0 +1,298 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+// ErrReturnNotFound is returned for an unknown return ID.
+var ErrReturnNotFound error = &classifiedError{class: ErrNotFound, err: errors.New("return not found")}
+
+const (
+	// SQL queries for returns and refunds
+
+	// getReturnableItemsSQL lists the items of an order with the quantity
+	// not yet returned.
+	getReturnableItemsSQL = `
+	SELECT i.id, i.product_id,
+		   i.quantity - COALESCE((SELECT SUM(ri.quantity) FROM return_items ri WHERE ri.order_item_id = i.id), 0),
+		   i.unit_price_currency, i.unit_price_units, i.unit_price_nanos
+	FROM order_items i
+	WHERE i.order_id = $1`
+
+	insertReturnSQL = `
+	INSERT INTO return_requests (return_id, order_id, user_id, reason, status)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING created_at`
+
+	insertReturnItemSQL = `
+	INSERT INTO return_items (return_id, order_item_id, quantity) VALUES ($1, $2, $3)`
+
+	getReturnSQL = `
+	SELECT r.return_id, r.order_id, r.user_id, r.reason, r.status, r.created_at,
+		   f.id, f.amount_currency, f.amount_units, f.amount_nanos, f.created_at
+	FROM return_requests r LEFT JOIN refunds f ON f.return_id = r.return_id
+	WHERE r.return_id = $1`
+
+	getReturnItemsSQL = `
+	SELECT ri.order_item_id, i.product_id, ri.quantity,
+		   i.unit_price_currency, i.unit_price_units, i.unit_price_nanos
+	FROM return_items ri JOIN order_items i ON i.id = ri.order_item_id
+	WHERE ri.return_id = $1
+	ORDER BY ri.order_item_id`
+
+	lockReturnSQL = `
+	SELECT status FROM return_requests WHERE return_id = $1 FOR UPDATE`
+
+	approveReturnSQL = `
+	UPDATE return_requests SET status = $2, decided_at = NOW() WHERE return_id = $1`
+
+	insertRefundSQL = `
+	INSERT INTO refunds (return_id, order_id, amount_currency, amount_units, amount_nanos)
+	SELECT return_id, order_id, $2::varchar, $3::bigint, $4::integer FROM return_requests WHERE return_id = $1`
+)
+
+// querier is what the return queries need of a *sql.DB or *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// CreateReturn stores a return of ret.Items, identified by product, of one of
+// ret.UserID's orders. It fills in the order item each returned item links
+// to, its unit price, the status and the creation time. It returns
+// ErrOrderNotFound for an unknown order or one of another user, an error
+// wrapping models.ErrNotReturnable if the order has not been delivered, and
+// one wrapping models.ErrInvalidReturn if an item is not in the order or more
+// would be returned than was ordered.
+func (c *Connection) CreateReturn(ctx context.Context, ret *models.OrderReturn) error {
+	if c.DB == nil {
+		return errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	// Locking the order serializes returns of its items.
+	var owner, status string
+	err = tx.QueryRowContext(ctx, lockOrderStatusSQL, ret.OrderID).Scan(&owner, &status)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && owner != ret.UserID) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read order status: %w", classify(err))
+	}
+	if status != models.StatusDelivered {
+		return fmt.Errorf("%w: order %s is %s, not delivered", models.ErrNotReturnable, ret.OrderID, status)
+	}
+
+	returnable, err := returnableItems(ctx, tx, ret.OrderID)
+	if err != nil {
+		return err
+	}
+	if len(ret.Items) == 0 {
+		return fmt.Errorf("%w: no items", models.ErrInvalidReturn)
+	}
+	listed := make(map[string]bool)
+	for i, item := range ret.Items {
+		if listed[item.ProductID] {
+			return fmt.Errorf("%w: product %s is listed twice", models.ErrInvalidReturn, item.ProductID)
+		}
+		listed[item.ProductID] = true
+		available, ok := returnable[item.ProductID]
+		if !ok {
+			return fmt.Errorf("%w: product %s is not in order %s", models.ErrInvalidReturn, item.ProductID, ret.OrderID)
+		}
+		if item.Quantity <= 0 || item.Quantity > available.Quantity {
+			return fmt.Errorf("%w: %d of product %s requested, %d can be returned",
+				models.ErrInvalidReturn, item.Quantity, item.ProductID, available.Quantity)
+		}
+
+		ret.Items[i].ReturnID = ret.ReturnID
+		ret.Items[i].OrderItemID = available.OrderItemID
+		ret.Items[i].UnitPriceCurrency = available.UnitPriceCurrency
+		ret.Items[i].UnitPriceUnits = available.UnitPriceUnits
+		ret.Items[i].UnitPriceNanos = available.UnitPriceNanos
+	}
+
+	ret.Status = models.ReturnRequested
+	err = tx.QueryRowContext(ctx, insertReturnSQL, ret.ReturnID, ret.OrderID, ret.UserID, ret.Reason, ret.Status).Scan(&ret.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert return: %w", classify(err))
+	}
+	for _, item := range ret.Items {
+		if _, err := tx.ExecContext(ctx, insertReturnItemSQL, ret.ReturnID, item.OrderItemID, item.Quantity); err != nil {
+			return fmt.Errorf("failed to insert return item: %w", classify(err))
+		}
+	}
+
+	return tx.Commit()
+}
+
+// returnableItems maps the products of an order to their order item, with
+// Quantity set to how many have not been returned yet.
+func returnableItems(ctx context.Context, q querier, orderID string) (map[string]models.ReturnItem, error) {
+	rows, err := q.QueryContext(ctx, getReturnableItemsSQL, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order items: %w", classify(err))
+	}
+	defer rows.Close()
+
+	items := make(map[string]models.ReturnItem)
+	for rows.Next() {
+		var item models.ReturnItem
+		err := rows.Scan(
+			&item.OrderItemID,
+			&item.ProductID,
+			&item.Quantity,
+			&item.UnitPriceCurrency,
+			&item.UnitPriceUnits,
+			&item.UnitPriceNanos,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", classify(err))
+		}
+		items[item.ProductID] = item
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	return items, nil
+}
+
+// GetReturn retrieves a return with its items and, once approved, its refund.
+// It returns ErrReturnNotFound for an unknown return.
+func (c *Connection) GetReturn(ctx context.Context, returnID string) (*models.OrderReturn, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+	return getReturn(ctx, c.readDB(), returnID)
+}
+
+func getReturn(ctx context.Context, q querier, returnID string) (*models.OrderReturn, error) {
+	var ret models.OrderReturn
+	var refundID sql.NullInt64
+	var refundCurrency sql.NullString
+	var refundUnits sql.NullInt64
+	var refundNanos sql.NullInt32
+	var refundedAt sql.NullTime
+	err := q.QueryRowContext(ctx, getReturnSQL, returnID).Scan(
+		&ret.ReturnID,
+		&ret.OrderID,
+		&ret.UserID,
+		&ret.Reason,
+		&ret.Status,
+		&ret.CreatedAt,
+		&refundID,
+		&refundCurrency,
+		&refundUnits,
+		&refundNanos,
+		&refundedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query return: %w", classify(err))
+	}
+	if refundID.Valid {
+		ret.Refund = &models.Refund{
+			ID:             int(refundID.Int64),
+			ReturnID:       ret.ReturnID,
+			OrderID:        ret.OrderID,
+			AmountCurrency: refundCurrency.String,
+			AmountUnits:    refundUnits.Int64,
+			AmountNanos:    refundNanos.Int32,
+			CreatedAt:      refundedAt.Time,
+		}
+	}
+
+	rows, err := q.QueryContext(ctx, getReturnItemsSQL, returnID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query return items: %w", classify(err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := models.ReturnItem{ReturnID: returnID}
+		err := rows.Scan(
+			&item.OrderItemID,
+			&item.ProductID,
+			&item.Quantity,
+			&item.UnitPriceCurrency,
+			&item.UnitPriceUnits,
+			&item.UnitPriceNanos,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan return item: %w", classify(err))
+		}
+		ret.Items = append(ret.Items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	return &ret, nil
+}
+
+// ApproveReturn approves a requested return and records its refund of the
+// amount refundFor returns for it. refundFor is called with the return read
+// on the primary under the approval's lock, and its error aborts the
+// approval. It returns the approved return, ErrReturnNotFound for an unknown
+// return, or an error wrapping models.ErrNotReturnable if the return is no
+// longer requested.
+func (c *Connection) ApproveReturn(ctx context.Context, returnID string, refundFor func(*models.OrderReturn) (models.Refund, error)) (*models.OrderReturn, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, lockReturnSQL, returnID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read return status: %w", classify(err))
+	}
+	if status != models.ReturnRequested {
+		return nil, fmt.Errorf("%w: return %s is already %s", models.ErrNotReturnable, returnID, status)
+	}
+	requested, err := getReturn(ctx, tx, returnID)
+	if err != nil {
+		return nil, err
+	}
+	refund, err := refundFor(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, approveReturnSQL, returnID, models.ReturnApproved); err != nil {
+		return nil, fmt.Errorf("failed to approve return: %w", classify(err))
+	}
+	_, err = tx.ExecContext(ctx, insertRefundSQL, returnID, refund.AmountCurrency, refund.AmountUnits, refund.AmountNanos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert refund: %w", classify(err))
+	}
+	ret, err := getReturn(ctx, tx, returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit return approval: %w", classify(err))
+	}
+	return ret, nil
+}
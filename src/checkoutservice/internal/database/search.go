@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+// OrderSort is the order SearchOrders returns orders in. Ties sort by order
+// ID in the same direction.
+type OrderSort int
+
+const (
+	// SortByDate sorts orders by the time they were placed.
+	SortByDate OrderSort = iota
+	// SortByTotal sorts orders by the amount of their total, whatever its
+	// currency.
+	SortByTotal
+)
+
+// Amount is an amount of money in units and nanos, of a currency given
+// alongside it.
+type Amount struct {
+	Units int64
+	Nanos int32
+}
+
+// OrderSearch filters and sorts the orders of SearchOrders. Zero fields
+// don't filter.
+type OrderSearch struct {
+	// Email is matched case-insensitively.
+	Email     string
+	Status    string
+	Dates     DateRange
+	ProductID string
+	// Currency restricts orders to those totalled in it, and MinTotal and
+	// MaxTotal, in that currency, bound their total inclusively.
+	Currency  string
+	MinTotal  *Amount
+	MaxTotal  *Amount
+	SortBy    OrderSort
+	Ascending bool
+}
+
+// SearchCursor marks the last order of a page of SearchOrders by the key it
+// was sorted by: its date or its total, and its ID.
+type SearchCursor struct {
+	OrderDate time.Time
+	Total     Amount
+	OrderID   string
+}
+
+// searchOrdersSQL selects the orders of SearchOrders; searchOrdersQuery
+// appends the conditions, sorting and limit.
+const searchOrdersSQL = `
+	SELECT order_id, user_id, email, total_amount_currency, total_amount_units, total_amount_nanos,
+		   shipping_tracking_id, shipping_address, order_date, status, COALESCE(confirmation_status, ''),
+		   COALESCE(discount_code, ''), COALESCE(discount_amount_currency, ''), COALESCE(discount_amount_units, 0), COALESCE(discount_amount_nanos, 0),
+		   COALESCE(subtotal_amount_currency, ''), COALESCE(subtotal_amount_units, 0), COALESCE(subtotal_amount_nanos, 0),
+		   COALESCE(tax_amount_currency, ''), COALESCE(tax_amount_units, 0), COALESCE(tax_amount_nanos, 0), tax_breakdown, COALESCE(address_id, '')
+	FROM order_history o`
+
+// SearchOrders retrieves up to limit orders of any user that match search,
+// in its sort order, that come after the cursor. A nil cursor starts at the
+// first order.
+func (c *Connection) SearchOrders(ctx context.Context, search OrderSearch, after *SearchCursor, limit int) ([]models.Order, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	query, args := searchOrdersQuery(search, after, limit)
+	rows, err := c.readDB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search orders: %w", classify(err))
+	}
+	defer rows.Close()
+
+	orders := make([]models.Order, 0, limit)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+
+	return orders, nil
+}
+
+// searchOrdersQuery builds the query of SearchOrders with only the
+// conditions that filter, so Postgres can pick the index that fits them.
+func searchOrdersQuery(search OrderSearch, after *SearchCursor, limit int) (string, []any) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if search.Email != "" {
+		where = append(where, "LOWER(o.email) = LOWER("+arg(search.Email)+")")
+	}
+	if search.Status != "" {
+		where = append(where, "o.status = "+arg(search.Status))
+	} else {
+		where = append(where, "o.status <> 'pending'")
+	}
+	if !search.Dates.From.IsZero() {
+		where = append(where, "o.order_date >= "+arg(search.Dates.From.UTC()))
+	}
+	if !search.Dates.To.IsZero() {
+		where = append(where, "o.order_date < "+arg(search.Dates.To.UTC()))
+	}
+	if search.ProductID != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM order_items i WHERE i.order_id = o.order_id AND i.product_id = "+arg(search.ProductID)+")")
+	}
+	if search.Currency != "" {
+		where = append(where, "o.total_amount_currency = "+arg(search.Currency))
+	}
+	if m := search.MinTotal; m != nil {
+		where = append(where, fmt.Sprintf("(o.total_amount_units, o.total_amount_nanos) >= (%s, %s)", arg(m.Units), arg(m.Nanos)))
+	}
+	if m := search.MaxTotal; m != nil {
+		where = append(where, fmt.Sprintf("(o.total_amount_units, o.total_amount_nanos) <= (%s, %s)", arg(m.Units), arg(m.Nanos)))
+	}
+
+	cmp, dir := "<", "DESC"
+	if search.Ascending {
+		cmp, dir = ">", "ASC"
+	}
+	var orderBy string
+	switch search.SortBy {
+	case SortByTotal:
+		if after != nil {
+			where = append(where, fmt.Sprintf("(o.total_amount_units, o.total_amount_nanos, o.order_id) %s (%s, %s, %s)",
+				cmp, arg(after.Total.Units), arg(after.Total.Nanos), arg(after.OrderID)))
+		}
+		orderBy = fmt.Sprintf("o.total_amount_units %[1]s, o.total_amount_nanos %[1]s, o.order_id %[1]s", dir)
+	default:
+		if after != nil {
+			where = append(where, fmt.Sprintf("(o.order_date, o.order_id) %s (%s, %s)", cmp, arg(after.OrderDate.UTC()), arg(after.OrderID)))
+		}
+		orderBy = fmt.Sprintf("o.order_date %[1]s, o.order_id %[1]s", dir)
+	}
+
+	query := searchOrdersSQL
+	if len(where) > 0 {
+		query += "\n\tWHERE " + strings.Join(where, "\n\t  AND ")
+	}
+	query += "\n\tORDER BY " + orderBy + "\n\tLIMIT " + arg(limit)
+	return query, args
+}
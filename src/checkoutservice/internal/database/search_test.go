@@ -0,0 +1,52 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchOrdersQuery(t *testing.T) {
+	query, args := searchOrdersQuery(OrderSearch{}, nil, 21)
+	if !strings.Contains(query, "WHERE o.status <> 'pending'\n") || !strings.HasSuffix(query, "ORDER BY o.order_date DESC, o.order_id DESC\n\tLIMIT $1") {
+		t.Errorf("Expected only placed orders, newest first, got %s", query)
+	}
+	if len(args) != 1 || args[0] != 21 {
+		t.Errorf("Expected only the limit as argument, got %v", args)
+	}
+
+	search := OrderSearch{
+		Email:     "User@Example.com",
+		Status:    "paid",
+		Dates:     DateRange{From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		ProductID: "PRODUCT-1",
+		Currency:  "USD",
+		MinTotal:  &Amount{Units: 10},
+		MaxTotal:  &Amount{Units: 99, Nanos: 990000000},
+		SortBy:    SortByTotal,
+		Ascending: true,
+	}
+	query, args = searchOrdersQuery(search, &SearchCursor{Total: Amount{Units: 12, Nanos: 500000000}, OrderID: "order-1"}, 11)
+	for _, want := range []string{
+		"LOWER(o.email) = LOWER($1)",
+		"o.status = $2",
+		"o.order_date >= $3",
+		"i.product_id = $4",
+		"o.total_amount_currency = $5",
+		"(o.total_amount_units, o.total_amount_nanos) >= ($6, $7)",
+		"(o.total_amount_units, o.total_amount_nanos) <= ($8, $9)",
+		"(o.total_amount_units, o.total_amount_nanos, o.order_id) > ($10, $11, $12)",
+		"ORDER BY o.total_amount_units ASC, o.total_amount_nanos ASC, o.order_id ASC",
+		"LIMIT $13",
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("Expected %q in query %s", want, query)
+		}
+	}
+	if strings.Contains(query, "order_date <") {
+		t.Errorf("Expected no end of the date range in query %s", query)
+	}
+	if len(args) != 13 || args[0] != "User@Example.com" || args[9] != int64(12) || args[11] != "order-1" {
+		t.Errorf("Unexpected arguments %v", args)
+	}
+}
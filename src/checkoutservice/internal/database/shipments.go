@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+// ErrShipmentNotFound is returned for an unknown shipment ID.
+var ErrShipmentNotFound error = &classifiedError{class: ErrNotFound, err: errors.New("shipment not found")}
+
+const (
+	// SQL queries for shipments
+
+	// getShippableItemsSQL lists the items of an order with the quantity
+	// not yet shipped.
+	getShippableItemsSQL = `
+	SELECT i.id, i.product_id,
+		   i.quantity - COALESCE((SELECT SUM(si.quantity) FROM shipment_items si WHERE si.order_item_id = i.id), 0)
+	FROM order_items i
+	WHERE i.order_id = $1`
+
+	insertShipmentSQL = `
+	INSERT INTO shipments (shipment_id, order_id, tracking_id, carrier, status)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING created_at, updated_at`
+
+	insertShipmentItemSQL = `
+	INSERT INTO shipment_items (shipment_id, order_item_id, quantity) VALUES ($1, $2, $3)`
+
+	getShipmentSQL = `
+	SELECT shipment_id, order_id, tracking_id, carrier, status, created_at, updated_at
+	FROM shipments
+	WHERE shipment_id = $1`
+
+	getOrderShipmentsSQL = `
+	SELECT shipment_id, order_id, tracking_id, carrier, status, created_at, updated_at
+	FROM shipments
+	WHERE order_id = $1
+	ORDER BY created_at, shipment_id`
+
+	getOrderShipmentItemsSQL = `
+	SELECT si.shipment_id, si.order_item_id, i.product_id, si.quantity
+	FROM shipment_items si JOIN shipments s ON s.shipment_id = si.shipment_id
+	JOIN order_items i ON i.id = si.order_item_id
+	WHERE s.order_id = $1
+	ORDER BY si.order_item_id`
+
+	lockShipmentSQL = `
+	SELECT order_id, status FROM shipments WHERE shipment_id = $1 FOR UPDATE`
+
+	updateShipmentStatusSQL = `
+	UPDATE shipments SET status = $2, updated_at = NOW() WHERE shipment_id = $1`
+)
+
+// CreateShipment stores a shipment of s.Items, identified by product, of an
+// order. It fills in the order item each shipped item links to, the status
+// and the creation time. It returns ErrOrderNotFound for an unknown order, an
+// error wrapping models.ErrNotShippable if the order is not paid or shipped,
+// and one wrapping models.ErrInvalidShipment if an item is not in the order
+// or more would be shipped than was ordered.
+func (c *Connection) CreateShipment(ctx context.Context, s *models.Shipment) error {
+	if c.DB == nil {
+		return errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	// Locking the order serializes shipments of its items.
+	var owner, status string
+	err = tx.QueryRowContext(ctx, lockOrderStatusSQL, s.OrderID).Scan(&owner, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read order status: %w", classify(err))
+	}
+	if status != models.StatusPaid && status != models.StatusShipped {
+		return fmt.Errorf("%w: order %s is %s", models.ErrNotShippable, s.OrderID, status)
+	}
+
+	shippable, err := shippableItems(ctx, tx, s.OrderID)
+	if err != nil {
+		return err
+	}
+	if len(s.Items) == 0 {
+		return fmt.Errorf("%w: no items", models.ErrInvalidShipment)
+	}
+	listed := make(map[string]bool)
+	for i, item := range s.Items {
+		if listed[item.ProductID] {
+			return fmt.Errorf("%w: product %s is listed twice", models.ErrInvalidShipment, item.ProductID)
+		}
+		listed[item.ProductID] = true
+		available, ok := shippable[item.ProductID]
+		if !ok {
+			return fmt.Errorf("%w: product %s is not in order %s", models.ErrInvalidShipment, item.ProductID, s.OrderID)
+		}
+		if item.Quantity <= 0 || item.Quantity > available.Quantity {
+			return fmt.Errorf("%w: %d of product %s requested, %d left to ship",
+				models.ErrInvalidShipment, item.Quantity, item.ProductID, available.Quantity)
+		}
+
+		s.Items[i].ShipmentID = s.ShipmentID
+		s.Items[i].OrderItemID = available.OrderItemID
+	}
+
+	s.Status = models.ShipmentShipped
+	err = tx.QueryRowContext(ctx, insertShipmentSQL, s.ShipmentID, s.OrderID, s.TrackingID, s.Carrier, s.Status).Scan(&s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert shipment: %w", classify(err))
+	}
+	for _, item := range s.Items {
+		if _, err := tx.ExecContext(ctx, insertShipmentItemSQL, s.ShipmentID, item.OrderItemID, item.Quantity); err != nil {
+			return fmt.Errorf("failed to insert shipment item: %w", classify(err))
+		}
+	}
+
+	return tx.Commit()
+}
+
+// shippableItems maps the products of an order to their order item, with
+// Quantity set to how many have not been shipped yet.
+func shippableItems(ctx context.Context, q querier, orderID string) (map[string]models.ShipmentItem, error) {
+	rows, err := q.QueryContext(ctx, getShippableItemsSQL, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order items: %w", classify(err))
+	}
+	defer rows.Close()
+
+	items := make(map[string]models.ShipmentItem)
+	for rows.Next() {
+		var item models.ShipmentItem
+		if err := rows.Scan(&item.OrderItemID, &item.ProductID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", classify(err))
+		}
+		items[item.ProductID] = item
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	return items, nil
+}
+
+// GetShipments retrieves the shipments of an order with their items, oldest
+// first.
+func (c *Connection) GetShipments(ctx context.Context, orderID string) ([]models.Shipment, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+	return getShipments(ctx, c.readDB(), getOrderShipmentsSQL, orderID)
+}
+
+// getShipments runs query, one of the shipment queries, and loads the items
+// of the shipments it finds.
+func getShipments(ctx context.Context, q querier, query string, arg string) ([]models.Shipment, error) {
+	rows, err := q.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shipments: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var shipments []models.Shipment
+	index := make(map[string]int)
+	for rows.Next() {
+		var s models.Shipment
+		if err := rows.Scan(&s.ShipmentID, &s.OrderID, &s.TrackingID, &s.Carrier, &s.Status, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan shipment: %w", classify(err))
+		}
+		index[s.ShipmentID] = len(shipments)
+		shipments = append(shipments, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	if len(shipments) == 0 {
+		return nil, nil
+	}
+
+	itemRows, err := q.QueryContext(ctx, getOrderShipmentItemsSQL, shipments[0].OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shipment items: %w", classify(err))
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var item models.ShipmentItem
+		if err := itemRows.Scan(&item.ShipmentID, &item.OrderItemID, &item.ProductID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan shipment item: %w", classify(err))
+		}
+		if i, ok := index[item.ShipmentID]; ok {
+			shipments[i].Items = append(shipments[i].Items, item)
+		}
+	}
+
+	if err = itemRows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	return shipments, nil
+}
+
+// UpdateShipmentStatus moves a shipment to status and returns it. It returns
+// ErrShipmentNotFound for an unknown shipment, and an error wrapping
+// models.ErrNotShippable unless the shipment moves from shipped to
+// delivered.
+func (c *Connection) UpdateShipmentStatus(ctx context.Context, shipmentID, status string) (*models.Shipment, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var orderID, from string
+	err = tx.QueryRowContext(ctx, lockShipmentSQL, shipmentID).Scan(&orderID, &from)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shipment status: %w", classify(err))
+	}
+	if from != models.ShipmentShipped || status != models.ShipmentDelivered {
+		return nil, fmt.Errorf("%w: shipment %s cannot move from %s to %s", models.ErrNotShippable, shipmentID, from, status)
+	}
+
+	if _, err := tx.ExecContext(ctx, updateShipmentStatusSQL, shipmentID, status); err != nil {
+		return nil, fmt.Errorf("failed to update shipment status: %w", classify(err))
+	}
+	shipments, err := getShipments(ctx, tx, getShipmentSQL, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit shipment status: %w", classify(err))
+	}
+	return &shipments[0], nil
+}
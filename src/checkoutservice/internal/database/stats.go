@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	// SQL queries for order statistics. Each takes the user ID and the
+	// statuses of orders to leave out.
+
+	orderStatsSQL = `
+	SELECT COUNT(*), MIN(order_date), MAX(order_date)
+	FROM order_history
+	WHERE user_id = $1 AND status <> ALL($2)`
+
+	// Totals, less the refunds of returned items, are summed in nanos as
+	// numeric, which cannot overflow, and split back into units and nanos.
+	// A refund is in the currency of its order.
+	orderSpendSQL = `
+	SELECT currency, div(s, 1000000000)::bigint, mod(s, 1000000000)::integer
+	FROM (
+		SELECT currency, SUM(amount) AS s
+		FROM (
+			SELECT total_amount_currency AS currency,
+				   total_amount_units::numeric * 1000000000 + total_amount_nanos AS amount
+			FROM order_history
+			WHERE user_id = $1 AND status <> ALL($2)
+			UNION ALL
+			SELECT f.amount_currency, -(f.amount_units::numeric * 1000000000 + f.amount_nanos)
+			FROM refunds f JOIN order_history o ON o.order_id = f.order_id
+			WHERE o.user_id = $1 AND o.status <> ALL($2)
+		) amounts
+		GROUP BY currency
+	) spend
+	ORDER BY currency`
+
+	topProductsSQL = `
+	SELECT i.product_id, SUM(i.quantity), COUNT(DISTINCT i.order_id)
+	FROM order_items i JOIN order_history o ON o.order_id = i.order_id
+	WHERE o.user_id = $1 AND o.status <> ALL($2)
+	GROUP BY i.product_id
+	ORDER BY SUM(i.quantity) DESC, i.product_id
+	LIMIT $3`
+)
+
+// GetUserOrderStats summarizes a user's orders, leaving out cancelled and
+// refunded ones, with up to topProducts of the products ordered most. The
+// spend is net of the refunds of approved returns. The
+// queries read one snapshot, so the figures agree with each other.
+func (c *Connection) GetUserOrderStats(ctx context.Context, userID string, topProducts int) (*models.UserOrderStats, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	tx, err := c.readDB().BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	excluded := pq.Array([]string{models.StatusCancelled, models.StatusRefunded})
+	stats := &models.UserOrderStats{UserID: userID}
+	var first, last sql.NullTime
+	if err := tx.QueryRowContext(ctx, orderStatsSQL, userID, excluded).Scan(&stats.TotalOrders, &first, &last); err != nil {
+		return nil, fmt.Errorf("failed to count orders: %w", classify(err))
+	}
+	stats.FirstOrderDate, stats.LastOrderDate = first.Time, last.Time
+
+	rows, err := tx.QueryContext(ctx, orderSpendSQL, userID, excluded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum order totals: %w", classify(err))
+	}
+	for rows.Next() {
+		var spend models.CurrencySpend
+		if err := rows.Scan(&spend.Currency, &spend.Units, &spend.Nanos); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan order totals: %w", classify(err))
+		}
+		stats.Spend = append(stats.Spend, spend)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+
+	rows, err = tx.QueryContext(ctx, topProductsSQL, userID, excluded, topProducts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top products: %w", classify(err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p models.ProductStats
+		if err := rows.Scan(&p.ProductID, &p.Quantity, &p.Orders); err != nil {
+			return nil, fmt.Errorf("failed to scan top product: %w", classify(err))
+		}
+		stats.TopProducts = append(stats.TopProducts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+
+	return stats, nil
+}
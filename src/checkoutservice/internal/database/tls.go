@@ -0,0 +1,15 @@
+package database
+
+import "github.com/GoogleCloudPlatform/microservices-demo/src/dbtls"
+
+// TLS holds the libpq TLS parameters of database connections; see dbtls.
+type TLS = dbtls.Settings
+
+// tlsModes are the sslmodes lib/pq supports.
+var tlsModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// loadTLS reads the TLS settings from the environment, as dbtls.FromEnv
+// does; CLOUDSQL_SSL_MODE is disable by default.
+func loadTLS() (TLS, error) {
+	return dbtls.FromEnv("disable", tlsModes...)
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTLS(t *testing.T) {
+	tls, err := loadTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tls.Params() != "sslmode=disable" {
+		t.Errorf("default params = %q", tls.Params())
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "verify-full")
+	if _, err := loadTLS(); err == nil {
+		t.Error("verify-full without CLOUDSQL_SSL_ROOT_CERT succeeded, want error")
+	}
+
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "server-ca.pem")
+	if err := os.WriteFile(ca, []byte("pem"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLOUDSQL_SSL_ROOT_CERT", ca)
+	tls, err = loadTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sslmode=verify-full sslrootcert=" + ca; tls.Params() != want {
+		t.Errorf("params = %q, want %q", tls.Params(), want)
+	}
+
+	t.Setenv("CLOUDSQL_SSL_CERT", filepath.Join(dir, "client-cert.pem"))
+	if _, err := loadTLS(); err == nil {
+		t.Error("client certificate without key succeeded, want error")
+	}
+	t.Setenv("CLOUDSQL_SSL_KEY", filepath.Join(dir, "client-key.pem"))
+	if _, err := loadTLS(); err == nil {
+		t.Error("missing client certificate files succeeded, want error")
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "prefer")
+	if _, err := loadTLS(); err == nil {
+		t.Error("CLOUDSQL_SSL_MODE=prefer succeeded, want error")
+	}
+}
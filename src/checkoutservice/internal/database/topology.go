@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultProbeInterval = 10 * time.Second
+	probeTimeout         = 2 * time.Second
+
+	// unreachable is the latency recorded for endpoints whose last probe
+	// failed, so they are only picked when nothing else is up.
+	unreachable = int64(math.MaxInt64)
+)
+
+// Topology describes where the order database lives across regions. Writes
+// always go to the primary; reads go to whichever of the primary and the
+// regional read endpoints currently answers fastest.
+type Topology struct {
+	PrimaryRegion string
+	PrimaryHost   string
+	// ReadHosts maps a region to the host of its read endpoint.
+	ReadHosts map[string]string
+	// ProbeInterval is how often read endpoint latency is measured.
+	ProbeInterval time.Duration
+}
+
+// loadTopology reads the topology from the environment:
+//
+//   - CLOUDSQL_HOST is the primary, in CLOUDSQL_PRIMARY_REGION.
+//   - CLOUDSQL_READ_HOSTS lists read endpoints as "region=host,...".
+//   - CLOUDSQL_FAILOVER_REGION, when set, promotes the read endpoint of that
+//     region to primary, e.g. after the old primary region went down.
+//   - CLOUDSQL_READ_PROBE_INTERVAL sets how often latency is probed (10s).
+func loadTopology() (*Topology, error) {
+	t := &Topology{
+		PrimaryRegion: os.Getenv("CLOUDSQL_PRIMARY_REGION"),
+		PrimaryHost:   os.Getenv("CLOUDSQL_HOST"),
+		ProbeInterval: defaultProbeInterval,
+	}
+
+	hosts, err := parseReadHosts(os.Getenv("CLOUDSQL_READ_HOSTS"))
+	if err != nil {
+		return nil, err
+	}
+	t.ReadHosts = hosts
+
+	if region := os.Getenv("CLOUDSQL_FAILOVER_REGION"); region != "" && region != t.PrimaryRegion {
+		host, ok := t.ReadHosts[region]
+		if !ok {
+			return nil, fmt.Errorf("CLOUDSQL_FAILOVER_REGION %q has no entry in CLOUDSQL_READ_HOSTS", region)
+		}
+		delete(t.ReadHosts, region)
+		t.PrimaryRegion, t.PrimaryHost = region, host
+	}
+
+	if s := os.Getenv("CLOUDSQL_READ_PROBE_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("failed to parse CLOUDSQL_READ_PROBE_INTERVAL (%s) as a positive time.Duration", s)
+		}
+		t.ProbeInterval = v
+	}
+	return t, nil
+}
+
+// parseReadHosts parses a "region=host,region=host" list.
+func parseReadHosts(s string) (map[string]string, error) {
+	hosts := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		region, host, ok := strings.Cut(entry, "=")
+		region, host = strings.TrimSpace(region), strings.TrimSpace(host)
+		if !ok || region == "" || host == "" {
+			return nil, fmt.Errorf("invalid CLOUDSQL_READ_HOSTS entry %q, want region=host", entry)
+		}
+		if _, dup := hosts[region]; dup {
+			return nil, fmt.Errorf("duplicate region %q in CLOUDSQL_READ_HOSTS", region)
+		}
+		hosts[region] = host
+	}
+	return hosts, nil
+}
+
+// readEndpoint is a database handle reads may be routed to, with its
+// smoothed probe latency in nanoseconds.
+type readEndpoint struct {
+	region  string
+	db      *sql.DB
+	latency atomic.Int64
+}
+
+// observe folds a probe result into the endpoint's latency estimate.
+func (e *readEndpoint) observe(d time.Duration, err error) {
+	if err != nil {
+		e.latency.Store(unreachable)
+		return
+	}
+	sample := int64(d)
+	prev := e.latency.Load()
+	if prev == unreachable {
+		e.latency.Store(sample)
+		return
+	}
+	// Exponentially weighted so a single slow probe does not flip routing.
+	e.latency.Store((prev*7 + sample*3) / 10)
+}
+
+// readRouter picks the lowest-latency reachable endpoint for reads.
+type readRouter struct {
+	endpoints []*readEndpoint
+	log       *logrus.Logger
+}
+
+// newReadRouter returns a router over the given endpoints. Endpoints start
+// out unprobed and are ranked after the first probe.
+func newReadRouter(log *logrus.Logger, endpoints ...*readEndpoint) *readRouter {
+	for _, e := range endpoints {
+		e.latency.Store(unreachable)
+	}
+	return &readRouter{endpoints: endpoints, log: log}
+}
+
+// pick returns the endpoint reads should use. The first endpoint, the
+// primary, wins ties and is used when no endpoint is reachable.
+func (r *readRouter) pick() *readEndpoint {
+	best := r.endpoints[0]
+	for _, e := range r.endpoints[1:] {
+		if e.latency.Load() < best.latency.Load() {
+			best = e
+		}
+	}
+	return best
+}
+
+// probe pings every endpoint concurrently and records the latencies.
+func (r *readRouter) probe(ctx context.Context) {
+	done := make(chan struct{}, len(r.endpoints))
+	for _, e := range r.endpoints {
+		go func(e *readEndpoint) {
+			defer func() { done <- struct{}{} }()
+			ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			start := time.Now()
+			err := e.db.PingContext(ctx)
+			if err != nil && e.latency.Load() != unreachable {
+				r.log.Warnf("read endpoint in region %q is unreachable: %v", e.region, err)
+			}
+			e.observe(time.Since(start), err)
+		}(e)
+	}
+	for range r.endpoints {
+		<-done
+	}
+}
+
+// run probes the endpoints every interval until ctx is done.
+func (r *readRouter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.probe(ctx)
+		}
+	}
+}
+
+// regions lists the endpoint regions in routing order, for logging.
+func (r *readRouter) regions() []string {
+	eps := append([]*readEndpoint(nil), r.endpoints...)
+	sort.SliceStable(eps, func(i, j int) bool { return eps[i].latency.Load() < eps[j].latency.Load() })
+	regions := make([]string, len(eps))
+	for i, e := range eps {
+		regions[i] = e.region
+	}
+	return regions
+}
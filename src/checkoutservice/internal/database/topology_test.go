@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseReadHosts(t *testing.T) {
+	hosts, err := parseReadHosts(" us-east1=10.0.0.2, europe-west1=10.1.0.2 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts["us-east1"] != "10.0.0.2" || hosts["europe-west1"] != "10.1.0.2" {
+		t.Errorf("parseReadHosts = %v", hosts)
+	}
+
+	for _, bad := range []string{"10.0.0.2", "=10.0.0.2", "us-east1=", "a=1,a=2"} {
+		if _, err := parseReadHosts(bad); err == nil {
+			t.Errorf("parseReadHosts(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestLoadTopologyFailover(t *testing.T) {
+	t.Setenv("CLOUDSQL_HOST", "10.0.0.1")
+	t.Setenv("CLOUDSQL_PRIMARY_REGION", "us-central1")
+	t.Setenv("CLOUDSQL_READ_HOSTS", "us-east1=10.0.0.2,europe-west1=10.1.0.2")
+	t.Setenv("CLOUDSQL_FAILOVER_REGION", "us-east1")
+
+	topo, err := loadTopology()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topo.PrimaryRegion != "us-east1" || topo.PrimaryHost != "10.0.0.2" {
+		t.Errorf("primary = %s/%s, want us-east1/10.0.0.2", topo.PrimaryRegion, topo.PrimaryHost)
+	}
+	if _, ok := topo.ReadHosts["us-east1"]; ok || len(topo.ReadHosts) != 1 {
+		t.Errorf("ReadHosts = %v, want only europe-west1", topo.ReadHosts)
+	}
+
+	t.Setenv("CLOUDSQL_FAILOVER_REGION", "asia-east1")
+	if _, err := loadTopology(); err == nil {
+		t.Error("expected error for failover region without a read endpoint")
+	}
+}
+
+func TestReadRouterPick(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	primary := &readEndpoint{region: "us-central1"}
+	near := &readEndpoint{region: "us-east1"}
+	far := &readEndpoint{region: "europe-west1"}
+	r := newReadRouter(log, primary, near, far)
+
+	if got := r.pick(); got != primary {
+		t.Errorf("before probing pick = %s, want primary", got.region)
+	}
+
+	primary.observe(40*time.Millisecond, nil)
+	near.observe(5*time.Millisecond, nil)
+	far.observe(90*time.Millisecond, nil)
+	if got := r.pick(); got != near {
+		t.Errorf("pick = %s, want us-east1", got.region)
+	}
+
+	near.observe(0, errors.New("connection refused"))
+	if got := r.pick(); got != primary {
+		t.Errorf("after us-east1 failed pick = %s, want primary", got.region)
+	}
+}
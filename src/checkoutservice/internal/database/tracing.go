@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of database operations. It records nothing until
+// tracing sets a global TracerProvider.
+var tracer = otel.Tracer("github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database")
+
+// rowsKey is the number of rows an operation read or wrote.
+const rowsKey = attribute.Key("db.rows")
+
+// startSpan starts a client span for operation op, which runs statement,
+// as a child of the span in ctx, such as the PlaceOrder call's. Statements
+// carry placeholders only, so no order data ends up in traces.
+func (c *Connection) startSpan(ctx context.Context, op, statement string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperation(op),
+		semconv.DBStatement(strings.Join(strings.Fields(statement), " ")),
+	}
+	if c.config != nil {
+		attrs = append(attrs, semconv.DBName(c.config.DatabaseName))
+	}
+	return tracer.Start(ctx, "postgres "+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records the rows and error of an operation on span and ends it.
+func endSpan(span trace.Span, rows int, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(rowsKey.Int(rows))
+	}
+	span.End()
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	c := &Connection{config: &Config{DatabaseName: "orders"}}
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "PlaceOrder")
+
+	_, span := c.startSpan(parentCtx, "GetOrderItems", getOrderItemsSQL)
+	endSpan(span, 3, nil)
+	_, span = c.startSpan(parentCtx, "SaveOrder", insertOrderSQL)
+	endSpan(span, 0, errors.New("connection refused"))
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	read, write := spans[0], spans[1]
+	if read.Name() != "postgres GetOrderItems" || read.SpanKind() != trace.SpanKindClient {
+		t.Errorf("Unexpected span %q of kind %v", read.Name(), read.SpanKind())
+	}
+	if read.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the span to be a child of the PlaceOrder span")
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range read.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["db.statement"].AsString(); got != "SELECT id, order_id, product_id, quantity, unit_price_currency, unit_price_units, unit_price_nanos, total_price_currency, total_price_units, total_price_nanos FROM order_items WHERE order_id = $1 ORDER BY id" {
+		t.Errorf("db.statement = %q", got)
+	}
+	if attrs["db.system"].AsString() != "postgresql" || attrs["db.name"].AsString() != "orders" || attrs[rowsKey].AsInt64() != 3 {
+		t.Errorf("Unexpected attributes %v", read.Attributes())
+	}
+
+	if write.Status().Code != codes.Error || len(write.Events()) != 1 {
+		t.Errorf("Expected the failed write to record its error, got status %v and %d events", write.Status(), len(write.Events()))
+	}
+	for _, kv := range write.Attributes() {
+		if kv.Key == rowsKey {
+			t.Error("Expected no row count on a failed operation")
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// SQL queries for erasing a user's personal data. Each takes the user ID.
+
+	anonymizeStatusReasonsSQL = `
+	UPDATE order_status_history SET reason = ''
+	WHERE order_id IN (SELECT order_id FROM order_history WHERE user_id = $1)`
+
+	anonymizeEventReasonsSQL = `
+	UPDATE order_events SET reason = ''
+	WHERE order_id IN (SELECT order_id FROM order_history WHERE user_id = $1)`
+
+	deleteUserConfirmationsSQL = `
+	DELETE FROM order_confirmations
+	WHERE order_id IN (SELECT order_id FROM order_history WHERE user_id = $1)`
+
+	deleteUserAddressesSQL = `
+	DELETE FROM addresses WHERE user_id = $1`
+
+	anonymizeReturnsSQL = `
+	UPDATE return_requests SET user_id = $2, reason = '' WHERE user_id = $1`
+
+	// Runs last, since the statements above find the orders by user ID.
+	anonymizeOrdersSQL = `
+	UPDATE order_history
+	SET user_id = $2, email = '', shipping_address = '', anonymized_at = NOW()
+	WHERE user_id = $1`
+
+	// claimGuestOrdersSQL moves the guest orders with an email, those
+	// placed without a user ID, to a user.
+	claimGuestOrdersSQL = `
+	UPDATE order_history SET user_id = $1
+	WHERE user_id = '' AND LOWER(email) = LOWER($2)
+	RETURNING order_id`
+)
+
+// AnonymizeUserData erases a user's personal data from their orders while
+// keeping the orders, their totals and items as financial records. The
+// orders and returns are moved to pseudonym, which must not be a user ID, and
+// lose their email and shipping address. Free-text reasons are cleared, and
+// queued or sent confirmation emails and saved addresses are deleted. It
+// returns how many orders were anonymized.
+func (c *Connection) AnonymizeUserData(ctx context.Context, userID, pseudonym string) (int, error) {
+	if c.DB == nil {
+		return 0, errNotInitialized
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{anonymizeStatusReasonsSQL, anonymizeEventReasonsSQL, deleteUserConfirmationsSQL, deleteUserAddressesSQL} {
+		if _, err := tx.ExecContext(ctx, stmt, userID); err != nil {
+			return 0, fmt.Errorf("failed to anonymize user data: %w", classify(err))
+		}
+	}
+	if _, err := tx.ExecContext(ctx, anonymizeReturnsSQL, userID, pseudonym); err != nil {
+		return 0, fmt.Errorf("failed to anonymize returns: %w", classify(err))
+	}
+	res, err := tx.ExecContext(ctx, anonymizeOrdersSQL, userID, pseudonym)
+	if err != nil {
+		return 0, fmt.Errorf("failed to anonymize orders: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count anonymized orders: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit anonymization: %w", classify(err))
+	}
+	return int(n), nil
+}
+
+// ClaimGuestOrders moves the orders placed without a user ID with email,
+// matched case-insensitively, to userID. It returns the IDs of the orders
+// claimed.
+func (c *Connection) ClaimGuestOrders(ctx context.Context, userID, email string) ([]string, error) {
+	if c.DB == nil {
+		return nil, errNotInitialized
+	}
+
+	rows, err := c.DB.QueryContext(ctx, claimGuestOrdersSQL, userID, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim guest orders: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var orderIDs []string
+	for rows.Next() {
+		var orderID string
+		if err := rows.Scan(&orderID); err != nil {
+			return nil, fmt.Errorf("failed to scan claimed order: %w", classify(err))
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+	return orderIDs, nil
+}
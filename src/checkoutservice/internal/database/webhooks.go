@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	// SQL queries for webhook deliveries
+
+	// queueWebhooksSQL fans events out to one delivery per endpoint and
+	// marks them queued. Events locked by another replica are skipped.
+	queueWebhooksSQL = `
+	WITH events AS (
+		SELECT id FROM order_events
+		WHERE webhooks_queued_at IS NULL
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	), deliveries AS (
+		INSERT INTO webhook_deliveries (event_id, endpoint, status)
+		SELECT events.id, endpoint, $3 FROM events, unnest($1::text[]) AS endpoint
+		ON CONFLICT (event_id, endpoint) DO NOTHING
+	)
+	UPDATE order_events SET webhooks_queued_at = NOW() WHERE id IN (SELECT id FROM events)`
+
+	// claimDueWebhooksSQL leases due deliveries like
+	// claimDueConfirmationsSQL.
+	claimDueWebhooksSQL = `
+	WITH due AS (
+		SELECT id, next_attempt_at FROM webhook_deliveries
+		WHERE status = $1 AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at, id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	), claimed AS (
+		UPDATE webhook_deliveries d SET next_attempt_at = NOW() + $3::float8 * INTERVAL '1 millisecond'
+		FROM due WHERE d.id = due.id
+		RETURNING d.id, d.endpoint, d.attempts, d.event_id, due.next_attempt_at AS due_at
+	)
+	SELECT d.id, d.endpoint, d.attempts,
+		   e.id, e.event_type, e.from_status, e.reason, e.created_at,
+		   o.order_id, o.user_id, o.email, o.total_amount_currency, o.total_amount_units, o.total_amount_nanos,
+		   o.shipping_tracking_id, o.shipping_address, o.order_date, o.status, COALESCE(o.confirmation_status, '')
+	FROM claimed d
+	JOIN order_events e ON e.id = d.event_id
+	JOIN order_history o ON o.order_id = e.order_id
+	ORDER BY d.due_at, d.id`
+
+	markWebhookDeliveredSQL = `
+	UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, last_error = '', delivered_at = NOW()
+	WHERE id = $1`
+
+	markWebhookFailedSQL = `
+	UPDATE webhook_deliveries
+	SET status = $2, attempts = attempts + 1, last_error = $3,
+		next_attempt_at = NOW() + $4::float8 * INTERVAL '1 millisecond'
+	WHERE id = $1`
+)
+
+// QueueWebhooks queues up to limit order events, oldest first, that have not
+// been queued yet for delivery to each of endpoints. It returns how many
+// events were queued.
+func (c *Connection) QueueWebhooks(ctx context.Context, endpoints []string, limit int) (int, error) {
+	if c.DB == nil {
+		return 0, errNotInitialized
+	}
+
+	res, err := c.DB.ExecContext(ctx, queueWebhooksSQL, pq.Array(endpoints), limit, models.WebhookPending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue webhooks: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count queued webhooks: %w", classify(err))
+	}
+	return int(n), nil
+}
+
+// DeliverWebhooks claims up to limit due webhook deliveries, oldest first,
+// for lease, passes them to deliver one at a time and records each outcome,
+// like DeliverConfirmations. Each delivery's event holds the order as it is
+// now. It returns how many were delivered.
+func (c *Connection) DeliverWebhooks(ctx context.Context, limit int, lease time.Duration, deliver func(models.WebhookDelivery) error, retryIn func(attempts int) (time.Duration, bool)) (int, error) {
+	if c.DB == nil {
+		return 0, errNotInitialized
+	}
+
+	rows, err := c.DB.QueryContext(ctx, claimDueWebhooksSQL, models.WebhookPending, limit, lease.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim webhook deliveries: %w", classify(err))
+	}
+	var due []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(
+			&d.ID,
+			&d.Endpoint,
+			&d.Attempts,
+			&d.Event.ID,
+			&d.Event.Type,
+			&d.Event.FromStatus,
+			&d.Event.Reason,
+			&d.Event.CreatedAt,
+			&d.Event.Order.OrderID,
+			&d.Event.Order.UserID,
+			&d.Event.Order.Email,
+			&d.Event.Order.TotalAmountCurrency,
+			&d.Event.Order.TotalAmountUnits,
+			&d.Event.Order.TotalAmountNanos,
+			&d.Event.Order.ShippingTrackingID,
+			&d.Event.Order.ShippingAddress,
+			&d.Event.Order.OrderDate,
+			&d.Event.Order.Status,
+			&d.Event.Order.ConfirmationStatus,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan webhook delivery: %w", classify(err))
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("row iteration error: %w", classify(err))
+	}
+
+	delivered := 0
+	var errs []error
+	for _, d := range due {
+		if sendErr := deliver(d); sendErr == nil {
+			_, err = c.DB.ExecContext(ctx, markWebhookDeliveredSQL, d.ID, models.WebhookDelivered)
+			delivered++
+		} else {
+			delay, retry := retryIn(d.Attempts + 1)
+			status := models.WebhookPending
+			if !retry {
+				status = models.WebhookFailed
+			}
+			c.log.Warnf("failed to deliver webhook %d to %s (attempt %d): %v", d.ID, d.Endpoint, d.Attempts+1, sendErr)
+			_, err = c.DB.ExecContext(ctx, markWebhookFailedSQL, d.ID, status, sendErr.Error(), delay.Milliseconds())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to record outcome of webhook %d: %w", d.ID, classify(err)))
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
@@ -0,0 +1,85 @@
+// Package delivery holds the schedule shared by the background senders that
+// drain a queue table, such as confirmation emails and webhooks: how often
+// the queue is checked, how much is sent at a time, and how failed sends are
+// retried.
+package delivery
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxBatchSize caps BatchSize.
+	maxBatchSize = 100
+	// maxBackoff caps the delay between attempts.
+	maxBackoff = time.Hour
+)
+
+// Schedule holds the settings of a sender.
+type Schedule struct {
+	Interval    time.Duration // how often the queue is checked
+	BatchSize   int           // items sent per check
+	MaxAttempts int           // attempts before an item is marked failed
+	Backoff     time.Duration // delay after the first failed attempt, doubled after each one
+}
+
+func (s Schedule) String() string {
+	return fmt.Sprintf("interval=%v, batch=%d, attempts=%d, backoff=%v", s.Interval, s.BatchSize, s.MaxAttempts, s.Backoff)
+}
+
+// ScheduleFromEnv overrides the settings of defaults from the environment:
+//
+//	<prefix>_INTERVAL      how often the queue is checked
+//	<prefix>_BATCH_SIZE    items sent per check, at most 100
+//	<prefix>_MAX_ATTEMPTS  attempts before an item is marked failed
+//	<prefix>_BACKOFF       delay after the first failed attempt
+func ScheduleFromEnv(prefix string, defaults Schedule) (Schedule, error) {
+	s := defaults
+	for _, d := range []struct {
+		env    string
+		target *time.Duration
+	}{
+		{prefix + "_INTERVAL", &s.Interval},
+		{prefix + "_BACKOFF", &s.Backoff},
+	} {
+		if v := os.Getenv(d.env); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return Schedule{}, fmt.Errorf("failed to parse %s (%s) as a positive time.Duration", d.env, v)
+			}
+			*d.target = parsed
+		}
+	}
+	if v := os.Getenv(prefix + "_BATCH_SIZE"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 || parsed > maxBatchSize {
+			return Schedule{}, fmt.Errorf("%s_BATCH_SIZE (%s) must be an integer from 1 to %d", prefix, v, maxBatchSize)
+		}
+		s.BatchSize = parsed
+	}
+	if v := os.Getenv(prefix + "_MAX_ATTEMPTS"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			return Schedule{}, fmt.Errorf("%s_MAX_ATTEMPTS (%s) must be a positive integer", prefix, v)
+		}
+		s.MaxAttempts = parsed
+	}
+	return s, nil
+}
+
+// RetryIn returns how long to wait before trying an item again after its
+// attempts so far failed, or false once it has had MaxAttempts. The delay
+// doubles after each attempt, up to an hour.
+func (s Schedule) RetryIn(attempts int) (time.Duration, bool) {
+	if attempts >= s.MaxAttempts {
+		return 0, false
+	}
+	delay := s.Backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff), true
+}
@@ -0,0 +1,56 @@
+package delivery
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleFromEnv(t *testing.T) {
+	defaults := Schedule{Interval: 5 * time.Second, BatchSize: 10, MaxAttempts: 5, Backoff: 30 * time.Second}
+	s, err := ScheduleFromEnv("TEST_QUEUE", defaults)
+	if err != nil || s != defaults {
+		t.Errorf("ScheduleFromEnv() = %+v, %v; want the defaults", s, err)
+	}
+
+	t.Setenv("TEST_QUEUE_INTERVAL", "1s")
+	t.Setenv("TEST_QUEUE_BATCH_SIZE", "50")
+	t.Setenv("TEST_QUEUE_MAX_ATTEMPTS", "3")
+	t.Setenv("TEST_QUEUE_BACKOFF", "1m")
+	want := Schedule{Interval: time.Second, BatchSize: 50, MaxAttempts: 3, Backoff: time.Minute}
+	if s, err = ScheduleFromEnv("TEST_QUEUE", defaults); err != nil || s != want {
+		t.Errorf("ScheduleFromEnv() = %+v, %v; want %+v", s, err, want)
+	}
+
+	for env, value := range map[string]string{
+		"TEST_QUEUE_INTERVAL":     "soon",
+		"TEST_QUEUE_BATCH_SIZE":   "101",
+		"TEST_QUEUE_MAX_ATTEMPTS": "0",
+		"TEST_QUEUE_BACKOFF":      "-1s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := ScheduleFromEnv("TEST_QUEUE", defaults); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("ScheduleFromEnv() error = %v, want one naming %s", err, env)
+			}
+		})
+	}
+}
+
+func TestRetryIn(t *testing.T) {
+	s := Schedule{MaxAttempts: 10, Backoff: 10 * time.Minute}
+	for attempts, want := range map[int]time.Duration{
+		1: 10 * time.Minute,
+		2: 20 * time.Minute,
+		3: 40 * time.Minute,
+		4: time.Hour,
+		9: time.Hour,
+	} {
+		if got, ok := s.RetryIn(attempts); !ok || got != want {
+			t.Errorf("RetryIn(%d) = %v, %v; want %v, true", attempts, got, ok, want)
+		}
+	}
+	if _, ok := s.RetryIn(10); ok {
+		t.Error("Expected no retry after MaxAttempts")
+	}
+}
@@ -0,0 +1,85 @@
+// Package discounts resolves the discount codes customers enter at checkout.
+// Codes take a percentage off the items of an order; shipping is not
+// discounted.
+package discounts
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+// ErrUnknownCode is returned by Discount for a code that is not configured.
+var ErrUnknownCode = errors.New("unknown discount code")
+
+// centNanos is a cent in nanos; discounts are rounded down to whole cents.
+const centNanos = 10000000
+
+// Config maps discount codes, in upper case, to the percentage they take off.
+type Config struct {
+	Percent map[string]int
+}
+
+func (c *Config) String() string {
+	codes := make([]string, 0, len(c.Percent))
+	for code, percent := range c.Percent {
+		codes = append(codes, fmt.Sprintf("%s=%d%%", code, percent))
+	}
+	sort.Strings(codes)
+	return strings.Join(codes, ", ")
+}
+
+// FromEnv builds a Config from DISCOUNT_CODES, a comma-separated list of
+// CODE=PERCENT entries such as "WELCOME10=10,SPRING25=25", or returns nil
+// when it is unset and every code is unknown. Percentages are integers from
+// 1 to 100.
+func FromEnv() (*Config, error) {
+	s := os.Getenv("DISCOUNT_CODES")
+	if s == "" {
+		return nil, nil
+	}
+	c := &Config{Percent: make(map[string]int)}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		code, p, ok := strings.Cut(entry, "=")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		percent, err := strconv.Atoi(strings.TrimSpace(p))
+		if !ok || code == "" || err != nil || percent < 1 || percent > 100 {
+			return nil, fmt.Errorf("DISCOUNT_CODES entry %q must be CODE=PERCENT with a percentage from 1 to 100", entry)
+		}
+		c.Percent[code] = percent
+	}
+	return c, nil
+}
+
+// Discount returns the amount code takes off an order whose items come to
+// subtotal, in the currency of subtotal. Codes are case-insensitive. It
+// returns ErrUnknownCode for a code c does not have, which is every code when
+// c is nil.
+func (c *Config) Discount(code string, subtotal *pb.Money) (*pb.Money, error) {
+	var percent int
+	if c != nil {
+		percent = c.Percent[strings.ToUpper(strings.TrimSpace(code))]
+	}
+	if percent == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCode, code)
+	}
+	return percentOf(subtotal, int64(percent)), nil
+}
+
+// percentOf returns percent of m, rounded towards zero to whole cents. The
+// units and nanos are scaled separately, so large amounts do not overflow.
+func percentOf(m *pb.Money, percent int64) *pb.Money {
+	units := m.GetUnits() * percent
+	nanos := (units%100*1e9 + int64(m.GetNanos())*percent) / 100
+	units /= 100
+	units, nanos = units+nanos/1e9, nanos%1e9
+	return &pb.Money{CurrencyCode: m.GetCurrencyCode(), Units: units, Nanos: int32(nanos - nanos%centNanos)}
+}
@@ -0,0 +1,64 @@
+package discounts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+func TestFromEnv(t *testing.T) {
+	c, err := FromEnv()
+	if err != nil || c != nil {
+		t.Fatalf("FromEnv() = %v, %v; want nil without DISCOUNT_CODES", c, err)
+	}
+
+	t.Setenv("DISCOUNT_CODES", "welcome10=10, SPRING25 = 25,")
+	if c, err = FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.String(); got != "SPRING25=25%, WELCOME10=10%" {
+		t.Errorf("FromEnv() = %s", got)
+	}
+
+	for _, value := range []string{"WELCOME", "=10", "FREE=0", "DOUBLE=200", "HALF=one"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("DISCOUNT_CODES", value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), "DISCOUNT_CODES") {
+				t.Errorf("FromEnv() error = %v, want one naming DISCOUNT_CODES", err)
+			}
+		})
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	c := &Config{Percent: map[string]int{"WELCOME10": 10, "SPRING25": 25, "FREE": 100}}
+	for _, tc := range []struct {
+		code     string
+		subtotal *pb.Money
+		want     *pb.Money
+	}{
+		{"WELCOME10", &pb.Money{CurrencyCode: "USD", Units: 61, Nanos: 970000000}, &pb.Money{CurrencyCode: "USD", Units: 6, Nanos: 190000000}},
+		{"spring25", &pb.Money{CurrencyCode: "EUR", Units: 15, Nanos: 990000000}, &pb.Money{CurrencyCode: "EUR", Units: 3, Nanos: 990000000}},
+		{"FREE", &pb.Money{CurrencyCode: "USD", Units: 19, Nanos: 990000000}, &pb.Money{CurrencyCode: "USD", Units: 19, Nanos: 990000000}},
+		{"WELCOME10", &pb.Money{CurrencyCode: "JPY", Units: 90000000000000000}, &pb.Money{CurrencyCode: "JPY", Units: 9000000000000000}},
+	} {
+		got, err := c.Discount(tc.code, tc.subtotal)
+		if err != nil {
+			t.Fatalf("Discount(%s, %v) = %v", tc.code, tc.subtotal.String(), err)
+		}
+		if got.CurrencyCode != tc.want.CurrencyCode || got.Units != tc.want.Units || got.Nanos != tc.want.Nanos {
+			t.Errorf("Discount(%s, %v) = %v, want %v", tc.code, tc.subtotal.String(), got.String(), tc.want.String())
+		}
+	}
+
+	subtotal := &pb.Money{CurrencyCode: "USD", Units: 10}
+	if _, err := c.Discount("BOGUS", subtotal); !errors.Is(err, ErrUnknownCode) {
+		t.Errorf("Discount(BOGUS) = %v, want ErrUnknownCode", err)
+	}
+	var none *Config
+	if _, err := none.Discount("WELCOME10", subtotal); !errors.Is(err, ErrUnknownCode) {
+		t.Errorf("Discount without codes = %v, want ErrUnknownCode", err)
+	}
+}
@@ -0,0 +1,47 @@
+package emailclaims
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	c := &Config{Secret: "s3cret"}
+	now := time.Unix(1700000000, 0)
+	token := Sign(c.Secret, "user-1", "Someone@Example.com", now.Add(time.Hour))
+
+	if err := c.Verify(token, "user-1", " someone@example.com", now); err != nil {
+		t.Errorf("Verify of a valid token = %v", err)
+	}
+	for _, tt := range []struct {
+		name, token, userID, email string
+		now                        time.Time
+		want                       error
+	}{
+		{"empty", "", "user-1", "someone@example.com", now, ErrInvalidToken},
+		{"malformed", "tomorrow", "user-1", "someone@example.com", now, ErrInvalidToken},
+		{"other user", token, "user-2", "someone@example.com", now, ErrInvalidToken},
+		{"other email", token, "user-1", "victim@example.com", now, ErrInvalidToken},
+		{"other secret", Sign("guess", "user-1", "someone@example.com", now.Add(time.Hour)), "user-1", "someone@example.com", now, ErrInvalidToken},
+		{"extended expiry", "1800000000" + token[len("1700003600"):], "user-1", "someone@example.com", now, ErrInvalidToken},
+		{"expired", token, "user-1", "someone@example.com", now.Add(time.Hour), ErrExpiredToken},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.Verify(tt.token, tt.userID, tt.email, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("EMAIL_CLAIM_SECRET", "")
+	if c, err := FromEnv(); c != nil || err != nil {
+		t.Errorf("FromEnv without a secret = %v, %v, want nil", c, err)
+	}
+	t.Setenv("EMAIL_CLAIM_SECRET", "s3cret")
+	if c, err := FromEnv(); err != nil || c.Secret != "s3cret" {
+		t.Errorf("FromEnv = %v, %v", c, err)
+	}
+}
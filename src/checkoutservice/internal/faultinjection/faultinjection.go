@@ -0,0 +1,145 @@
+package faultinjection
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Injector injects latency and errors into RPCs for resilience testing.
+// The zero value injects nothing.
+type Injector struct {
+	latency      time.Duration
+	distribution string // "fixed", "uniform" or "exponential"
+	errorRate    float64
+	errorCode    codes.Code
+	methods      map[string]bool // short method names; empty targets every method
+	rand         func() float64
+}
+
+// FromEnv builds an Injector from the environment:
+//
+//	EXTRA_LATENCY               base latency added to each targeted RPC
+//	FAULT_LATENCY_DISTRIBUTION  fixed (default), uniform in [0, 2*EXTRA_LATENCY], or exponential with mean EXTRA_LATENCY
+//	FAULT_ERROR_RATE            fraction of targeted RPCs in [0, 1] that fail
+//	FAULT_ERROR_CODE            gRPC status code returned on failure (default UNAVAILABLE)
+//	FAULT_METHODS               comma-separated RPC names to target, e.g. "PlaceOrder"
+func FromEnv() (*Injector, error) {
+	f := &Injector{distribution: "fixed", errorCode: codes.Unavailable, rand: rand.Float64}
+
+	if s := os.Getenv("EXTRA_LATENCY"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EXTRA_LATENCY (%s) as time.Duration: %+v", s, err)
+		}
+		f.latency = v
+	}
+	if s := os.Getenv("FAULT_LATENCY_DISTRIBUTION"); s != "" {
+		switch s {
+		case "fixed", "uniform", "exponential":
+			f.distribution = s
+		default:
+			return nil, fmt.Errorf("unknown FAULT_LATENCY_DISTRIBUTION %q", s)
+		}
+	}
+	if s := os.Getenv("FAULT_ERROR_RATE"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 || v > 1 {
+			return nil, fmt.Errorf("FAULT_ERROR_RATE must be a number between 0 and 1, got %q", s)
+		}
+		f.errorRate = v
+	}
+	if s := os.Getenv("FAULT_ERROR_CODE"); s != "" {
+		if err := f.errorCode.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(s)))); err != nil {
+			return nil, fmt.Errorf("invalid FAULT_ERROR_CODE %q: %v", s, err)
+		}
+	}
+	if s := os.Getenv("FAULT_METHODS"); s != "" {
+		f.methods = make(map[string]bool)
+		for _, m := range strings.Split(s, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				f.methods[m] = true
+			}
+		}
+	}
+	return f, nil
+}
+
+// Enabled reports whether any fault is configured.
+func (f *Injector) Enabled() bool {
+	return f != nil && (f.latency > 0 || f.errorRate > 0)
+}
+
+// String summarizes the configuration for logging.
+func (f *Injector) String() string {
+	return fmt.Sprintf("latency: %v %s, error rate: %v, error code: %s",
+		f.latency, f.distribution, f.errorRate, f.errorCode)
+}
+
+// inject applies the configured faults to a call of fullMethod.
+func (f *Injector) inject(ctx context.Context, fullMethod string) error {
+	if !f.Enabled() {
+		return nil
+	}
+	method := path.Base(fullMethod)
+	if len(f.methods) > 0 && !f.methods[method] {
+		return nil
+	}
+
+	if d := f.delay(); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if f.errorRate > 0 && f.rand() < f.errorRate {
+		return status.Errorf(f.errorCode, "injected fault in %s", method)
+	}
+	return nil
+}
+
+// delay samples the configured latency distribution.
+func (f *Injector) delay() time.Duration {
+	switch f.distribution {
+	case "uniform":
+		return time.Duration(f.rand() * 2 * float64(f.latency))
+	case "exponential":
+		return time.Duration(rand.ExpFloat64() * float64(f.latency))
+	default:
+		return f.latency
+	}
+}
+
+// UnaryServerInterceptor injects faults into unary RPCs of the given service.
+func (f *Injector) UnaryServerInterceptor(service string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, "/"+service+"/") {
+			if err := f.inject(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor injects faults into streaming RPCs of the given service.
+func (f *Injector) StreamServerInterceptor(service string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, "/"+service+"/") {
+			if err := f.inject(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
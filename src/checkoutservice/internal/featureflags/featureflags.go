@@ -0,0 +1,141 @@
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OrderPersistence gates writing placed orders to the order history database.
+	OrderPersistence = "order-persistence"
+)
+
+var client = openfeature.NewClient("checkoutservice")
+
+// flagDefinition is the on-disk representation of a boolean feature flag.
+// RolloutPercent, when set, enables the flag only for that share of
+// targeting keys, bucketed deterministically.
+type flagDefinition struct {
+	Enabled        bool `json:"enabled"`
+	RolloutPercent *int `json:"rolloutPercent,omitempty"`
+}
+
+// Init installs an OpenFeature provider backed by the JSON file named in
+// FEATURE_FLAGS_FILE and reloads it whenever the file changes. When the
+// variable is unset every flag evaluates to its code default.
+func Init(log *logrus.Logger) error {
+	path := os.Getenv("FEATURE_FLAGS_FILE")
+	if path == "" {
+		log.Info("FEATURE_FLAGS_FILE not set, using default feature flag values")
+		return nil
+	}
+
+	refresh := 30 * time.Second
+	if s := os.Getenv("FEATURE_FLAGS_REFRESH_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("failed to parse FEATURE_FLAGS_REFRESH_INTERVAL (%s) as time.Duration: %v", s, err)
+		}
+		refresh = v
+	}
+
+	modTime, err := load(path, log)
+	if err != nil {
+		log.Warnf("failed to load feature flags from %s: %v", path, err)
+	}
+	go func() {
+		for range time.Tick(refresh) {
+			fi, err := os.Stat(path)
+			if err != nil || !fi.ModTime().After(modTime) {
+				continue
+			}
+			if modTime, err = load(path, log); err != nil {
+				log.Warnf("failed to reload feature flags from %s: %v", path, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// load parses the flag file and swaps in a fresh provider.
+func load(path string, log *logrus.Logger) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	flags, err := Parse(data)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	if err := openfeature.SetProvider(memprovider.NewInMemoryProvider(flags)); err != nil {
+		return fi.ModTime(), err
+	}
+	log.Infof("loaded %d feature flags from %s", len(flags), path)
+	return fi.ModTime(), nil
+}
+
+// Parse converts a JSON flag file into in-memory provider flags.
+func Parse(data []byte) (map[string]memprovider.InMemoryFlag, error) {
+	var defs map[string]flagDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse feature flags: %v", err)
+	}
+
+	flags := make(map[string]memprovider.InMemoryFlag, len(defs))
+	for key, def := range defs {
+		flag := memprovider.InMemoryFlag{
+			Key:            key,
+			State:          memprovider.Enabled,
+			DefaultVariant: "off",
+			Variants:       map[string]interface{}{"on": true, "off": false},
+		}
+		if def.Enabled {
+			flag.DefaultVariant = "on"
+		}
+		if def.Enabled && def.RolloutPercent != nil {
+			percent := *def.RolloutPercent
+			if percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("flag %q: rolloutPercent must be between 0 and 100, got %d", key, percent)
+			}
+			evaluator := func(this memprovider.InMemoryFlag, evalCtx openfeature.FlattenedContext) (interface{}, openfeature.ProviderResolutionDetail) {
+				targetingKey, _ := evalCtx[openfeature.TargetingKey].(string)
+				variant := "off"
+				if rolloutBucket(this.Key, targetingKey) < percent {
+					variant = "on"
+				}
+				return this.Variants[variant], openfeature.ProviderResolutionDetail{
+					Reason:  openfeature.TargetingMatchReason,
+					Variant: variant,
+				}
+			}
+			flag.ContextEvaluator = &evaluator
+		}
+		flags[key] = flag
+	}
+	return flags, nil
+}
+
+// rolloutBucket deterministically maps a targeting key to a bucket in [0, 100).
+func rolloutBucket(flagKey, targetingKey string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flagKey + "/" + targetingKey))
+	return int(h.Sum32() % 100)
+}
+
+// Enabled evaluates a boolean flag for the given targeting key, returning
+// defaultValue if no provider is configured or the flag is unknown.
+func Enabled(ctx context.Context, flag, targetingKey string, defaultValue bool) bool {
+	return client.Boolean(ctx, flag, defaultValue, openfeature.NewEvaluationContext(targetingKey, nil))
+}
@@ -0,0 +1,315 @@
+// Package fraud screens orders for fraud before they are charged. The
+// Checker is pluggable: Velocity flags users who place many orders in a short
+// time, CountryMismatch flags orders shipped to another country than the
+// user's default address, Remote asks an external fraud API, and All combines
+// checkers. A flagged order is saved under review instead of paid, unless
+// screening runs in shadow mode, where verdicts are only logged.
+package fraud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+// Order is what a Checker is told of an order being placed.
+type Order struct {
+	OrderID string
+	UserID  string
+	Email   string
+	Address *pb.Address
+	Total   *pb.Money
+}
+
+// Verdict is the outcome of checking an order. An order with reasons should
+// be reviewed before it is fulfilled.
+type Verdict struct {
+	Reasons []string
+}
+
+// Review reports whether the order should be held for review.
+func (v Verdict) Review() bool { return len(v.Reasons) > 0 }
+
+// Checker checks an order before it is charged and saved.
+type Checker interface {
+	Check(ctx context.Context, order *Order) (Verdict, error)
+}
+
+// None flags no order.
+type None struct{}
+
+// Check returns an empty Verdict.
+func (None) Check(context.Context, *Order) (Verdict, error) { return Verdict{}, nil }
+
+func (None) String() string { return "none" }
+
+// History holds the past orders and saved addresses of users.
+type History interface {
+	// RecentOrderCount counts, up to limit, the orders placed since a time
+	// by a user or, for guests without a user ID, with an email.
+	RecentOrderCount(ctx context.Context, userID, email string, since time.Time, limit int) (int, error)
+	// DefaultCountry returns the country of the user's default saved
+	// address, or "" if they have none.
+	DefaultCountry(ctx context.Context, userID string) (string, error)
+}
+
+// Velocity flags an order when the user has already placed MaxOrders orders
+// within Window.
+type Velocity struct {
+	History   History
+	MaxOrders int
+	Window    time.Duration
+}
+
+// Check counts the user's recent orders.
+func (v *Velocity) Check(ctx context.Context, order *Order) (Verdict, error) {
+	if order.UserID == "" && order.Email == "" {
+		return Verdict{}, nil
+	}
+	n, err := v.History.RecentOrderCount(ctx, order.UserID, order.Email, time.Now().Add(-v.Window), v.MaxOrders)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to count recent orders: %w", err)
+	}
+	if n < v.MaxOrders {
+		return Verdict{}, nil
+	}
+	return Verdict{Reasons: []string{fmt.Sprintf("%d orders placed in the last %v", n, v.Window)}}, nil
+}
+
+// CountryMismatch flags an order shipped to another country than the user's
+// default saved address. Users without one are not flagged.
+type CountryMismatch struct {
+	History History
+}
+
+// Check compares the shipping country with the default address's.
+func (c *CountryMismatch) Check(ctx context.Context, order *Order) (Verdict, error) {
+	if order.UserID == "" {
+		return Verdict{}, nil
+	}
+	country, err := c.History.DefaultCountry(ctx, order.UserID)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to look up the default address: %w", err)
+	}
+	shipTo := strings.TrimSpace(order.Address.GetCountry())
+	if country == "" || strings.EqualFold(strings.TrimSpace(country), shipTo) {
+		return Verdict{}, nil
+	}
+	return Verdict{Reasons: []string{fmt.Sprintf("shipped to %q, but the default address is in %q", shipTo, country)}}, nil
+}
+
+// remoteRequest is the JSON body Remote POSTs.
+type remoteRequest struct {
+	OrderID  string `json:"order_id"`
+	UserID   string `json:"user_id"`
+	Email    string `json:"email"`
+	Country  string `json:"country"`
+	Currency string `json:"currency_code"`
+	Units    int64  `json:"units"`
+	Nanos    int32  `json:"nanos"`
+}
+
+// remoteResponse is the JSON body Remote expects back.
+type remoteResponse struct {
+	Review  bool     `json:"review"`
+	Reasons []string `json:"reasons"`
+}
+
+// Remote asks an external fraud API about each order with a POST of the
+// order as JSON to URL. The API answers with {"review": bool, "reasons":
+// [...]}; any status but 200 is an error.
+type Remote struct {
+	URL    string
+	Client *http.Client
+}
+
+// Check POSTs the order to the API.
+func (r *Remote) Check(ctx context.Context, order *Order) (Verdict, error) {
+	body, err := json.Marshal(remoteRequest{
+		OrderID:  order.OrderID,
+		UserID:   order.UserID,
+		Email:    order.Email,
+		Country:  order.Address.GetCountry(),
+		Currency: order.Total.GetCurrencyCode(),
+		Units:    order.Total.GetUnits(),
+		Nanos:    order.Total.GetNanos(),
+	})
+	if err != nil {
+		return Verdict{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("fraud API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return Verdict{}, fmt.Errorf("fraud API answered %s", resp.Status)
+	}
+	var answer remoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return Verdict{}, fmt.Errorf("fraud API: invalid response: %w", err)
+	}
+	if !answer.Review {
+		return Verdict{}, nil
+	}
+	if len(answer.Reasons) == 0 {
+		answer.Reasons = []string{"flagged by the fraud API"}
+	}
+	return Verdict{Reasons: answer.Reasons}, nil
+}
+
+// All runs every checker and flags an order if any of them does. A checker
+// that fails doesn't stop the others: the verdict of those that succeeded
+// is returned with the joined errors.
+type All []Checker
+
+// Check runs the checkers in order.
+func (a All) Check(ctx context.Context, order *Order) (Verdict, error) {
+	var v Verdict
+	var errs []error
+	for _, c := range a {
+		cv, err := c.Check(ctx, order)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v.Reasons = append(v.Reasons, cv.Reasons...)
+	}
+	return v, errors.Join(errs...)
+}
+
+// Checks that FRAUD_CHECKS may list.
+const (
+	CheckVelocity = "velocity"
+	CheckCountry  = "country"
+	CheckRemote   = "remote"
+)
+
+// Config holds the fraud screening settings.
+type Config struct {
+	Checks     []string      // checks run on every order, in order
+	MaxOrders  int           // orders a user may place within Window before more are flagged
+	Window     time.Duration // period of the velocity check
+	APIURL     string        // URL of the remote check
+	APITimeout time.Duration // bound on one call of the remote check
+	Shadow     bool          // only log verdicts; orders are never held
+}
+
+func (c *Config) String() string {
+	if c == nil {
+		return "disabled"
+	}
+	s := fmt.Sprintf("checks=%s", strings.Join(c.Checks, ","))
+	for _, check := range c.Checks {
+		switch check {
+		case CheckVelocity:
+			s += fmt.Sprintf(", velocity=%d/%v", c.MaxOrders, c.Window)
+		case CheckRemote:
+			s += fmt.Sprintf(", api=%s, timeout=%v", c.APIURL, c.APITimeout)
+		}
+	}
+	if c.Shadow {
+		s += ", shadow mode"
+	}
+	return s
+}
+
+// Checker returns a Checker running c's checks, looking up past orders and
+// addresses in history.
+func (c *Config) Checker(history History) Checker {
+	var all All
+	for _, check := range c.Checks {
+		switch check {
+		case CheckVelocity:
+			all = append(all, &Velocity{History: history, MaxOrders: c.MaxOrders, Window: c.Window})
+		case CheckCountry:
+			all = append(all, &CountryMismatch{History: history})
+		case CheckRemote:
+			all = append(all, &Remote{URL: c.APIURL, Client: &http.Client{Timeout: c.APITimeout}})
+		}
+	}
+	return all
+}
+
+// FromEnv builds a Config from the environment:
+//
+//	FRAUD_CHECKS               comma-separated checks: velocity, country, remote (default none)
+//	FRAUD_VELOCITY_MAX_ORDERS  orders a user may place within the window (default 5)
+//	FRAUD_VELOCITY_WINDOW      period of the velocity check (default 1h)
+//	FRAUD_API_URL              http(s) URL of the fraud API, required with remote
+//	FRAUD_API_TIMEOUT          bound on one call of the fraud API (default 2s)
+//	FRAUD_SHADOW_MODE          1 to only log verdicts and never hold orders
+//
+// Without checks it returns nil and orders are not screened.
+func FromEnv() (*Config, error) {
+	c := &Config{
+		MaxOrders:  5,
+		Window:     time.Hour,
+		APITimeout: 2 * time.Second,
+		Shadow:     os.Getenv("FRAUD_SHADOW_MODE") == "1",
+	}
+	seen := make(map[string]bool)
+	for _, check := range strings.Split(os.Getenv("FRAUD_CHECKS"), ",") {
+		if check = strings.ToLower(strings.TrimSpace(check)); check == "" || seen[check] {
+			continue
+		}
+		switch check {
+		case CheckVelocity, CheckCountry, CheckRemote:
+		default:
+			return nil, fmt.Errorf("FRAUD_CHECKS: unknown check %q, want velocity, country or remote", check)
+		}
+		seen[check] = true
+		c.Checks = append(c.Checks, check)
+	}
+	if len(c.Checks) == 0 {
+		return nil, nil
+	}
+
+	if s := os.Getenv("FRAUD_VELOCITY_MAX_ORDERS"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("FRAUD_VELOCITY_MAX_ORDERS (%s) must be a positive integer", s)
+		}
+		c.MaxOrders = v
+	}
+	for _, d := range []struct {
+		env    string
+		target *time.Duration
+	}{
+		{"FRAUD_VELOCITY_WINDOW", &c.Window},
+		{"FRAUD_API_TIMEOUT", &c.APITimeout},
+	} {
+		if s := os.Getenv(d.env); s != "" {
+			v, err := time.ParseDuration(s)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("failed to parse %s (%s) as a positive time.Duration", d.env, s)
+			}
+			*d.target = v
+		}
+	}
+	if seen[CheckRemote] {
+		c.APIURL = os.Getenv("FRAUD_API_URL")
+		u, err := url.Parse(c.APIURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("FRAUD_CHECKS=remote needs FRAUD_API_URL, an http(s) URL, got %q", c.APIURL)
+		}
+	}
+	return c, nil
+}
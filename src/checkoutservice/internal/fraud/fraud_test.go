@@ -0,0 +1,158 @@
+package fraud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("FRAUD_CHECKS", "")
+	if c, err := FromEnv(); c != nil || err != nil {
+		t.Errorf("FromEnv() = %v, %v; want nil, nil", c, err)
+	}
+
+	t.Setenv("FRAUD_CHECKS", "Velocity, country,velocity")
+	t.Setenv("FRAUD_SHADOW_MODE", "1")
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Checks) != 2 || c.Checks[0] != CheckVelocity || c.Checks[1] != CheckCountry ||
+		c.MaxOrders != 5 || c.Window != time.Hour || c.APITimeout != 2*time.Second || !c.Shadow {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+	if got := c.String(); got != "checks=velocity,country, velocity=5/1h0m0s, shadow mode" {
+		t.Errorf("String() = %q", got)
+	}
+
+	t.Setenv("FRAUD_CHECKS", "remote")
+	t.Setenv("FRAUD_API_URL", "https://fraud.example.com/check")
+	if c, err = FromEnv(); err != nil || c.APIURL != "https://fraud.example.com/check" {
+		t.Errorf("FromEnv() = %+v, %v", c, err)
+	}
+
+	for env, value := range map[string]string{
+		"FRAUD_CHECKS":              "remote,geoip",
+		"FRAUD_API_URL":             "fraud.example.com",
+		"FRAUD_VELOCITY_MAX_ORDERS": "0",
+		"FRAUD_VELOCITY_WINDOW":     "hourly",
+		"FRAUD_API_TIMEOUT":         "-1s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("FromEnv() error = %v, want one naming %s", err, env)
+			}
+		})
+	}
+}
+
+type fakeHistory struct {
+	orders  int
+	country string
+	err     error
+}
+
+func (h *fakeHistory) RecentOrderCount(_ context.Context, _, _ string, _ time.Time, limit int) (int, error) {
+	return min(h.orders, limit), h.err
+}
+
+func (h *fakeHistory) DefaultCountry(context.Context, string) (string, error) {
+	return h.country, h.err
+}
+
+func TestVelocity(t *testing.T) {
+	order := &Order{UserID: "user-1"}
+	for orders, review := range map[int]bool{0: false, 2: false, 3: true, 7: true} {
+		v := &Velocity{History: &fakeHistory{orders: orders}, MaxOrders: 3, Window: time.Hour}
+		verdict, err := v.Check(context.Background(), order)
+		if err != nil || verdict.Review() != review {
+			t.Errorf("Check() with %d recent orders = %+v, %v; want review %v", orders, verdict, err, review)
+		}
+	}
+
+	v := &Velocity{History: &fakeHistory{err: errors.New("boom")}, MaxOrders: 3, Window: time.Hour}
+	if _, err := v.Check(context.Background(), order); err == nil {
+		t.Error("Expected the history error")
+	}
+}
+
+func TestCountryMismatch(t *testing.T) {
+	order := &Order{UserID: "user-1", Address: &pb.Address{Country: " united states"}}
+	for country, review := range map[string]bool{"": false, "United States": false, "Germany": true} {
+		c := &CountryMismatch{History: &fakeHistory{country: country}}
+		verdict, err := c.Check(context.Background(), order)
+		if err != nil || verdict.Review() != review {
+			t.Errorf("Check() with default country %q = %+v, %v; want review %v", country, verdict, err, review)
+		}
+	}
+
+	c := &CountryMismatch{History: &fakeHistory{country: "Germany"}}
+	if verdict, _ := c.Check(context.Background(), &Order{Address: order.Address}); verdict.Review() {
+		t.Error("Expected guests not to be flagged")
+	}
+}
+
+func TestRemote(t *testing.T) {
+	var got remoteRequest
+	answer := `{"review": true, "reasons": ["card velocity"]}`
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Invalid request body: %v", err)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(answer))
+	}))
+	defer srv.Close()
+	r := &Remote{URL: srv.URL, Client: srv.Client()}
+	order := &Order{OrderID: "order-1", UserID: "user-1", Email: "a@example.com",
+		Address: &pb.Address{Country: "Germany"}, Total: &pb.Money{CurrencyCode: "EUR", Units: 12, Nanos: 500000000}}
+
+	verdict, err := r.Check(context.Background(), order)
+	if err != nil || len(verdict.Reasons) != 1 || verdict.Reasons[0] != "card velocity" {
+		t.Errorf("Check() = %+v, %v", verdict, err)
+	}
+	if got.OrderID != "order-1" || got.Country != "Germany" || got.Currency != "EUR" || got.Units != 12 || got.Nanos != 500000000 {
+		t.Errorf("Unexpected request %+v", got)
+	}
+
+	answer = `{"review": true}`
+	if verdict, _ = r.Check(context.Background(), order); !verdict.Review() {
+		t.Error("Expected a review without reasons to still flag the order")
+	}
+	answer = `{"review": false}`
+	if verdict, _ = r.Check(context.Background(), order); verdict.Review() {
+		t.Errorf("Check() = %+v, want no review", verdict)
+	}
+	status = http.StatusInternalServerError
+	if _, err = r.Check(context.Background(), order); err == nil {
+		t.Error("Expected an error for a 500")
+	}
+}
+
+func TestAll(t *testing.T) {
+	history := &fakeHistory{orders: 5, country: "Germany"}
+	failing := &Velocity{History: &fakeHistory{err: errors.New("boom")}, MaxOrders: 1}
+	all := All{&Velocity{History: history, MaxOrders: 5}, failing, &CountryMismatch{History: history}}
+
+	verdict, err := all.Check(context.Background(), &Order{UserID: "user-1", Address: &pb.Address{Country: "France"}})
+	if err == nil {
+		t.Error("Expected the failing checker's error")
+	}
+	if len(verdict.Reasons) != 2 {
+		t.Errorf("Expected the reasons of both other checkers, got %v", verdict.Reasons)
+	}
+
+	if verdict, err := (All{None{}}).Check(context.Background(), &Order{}); err != nil || verdict.Review() {
+		t.Errorf("Check() = %+v, %v", verdict, err)
+	}
+}
@@ -0,0 +1,163 @@
+package grpcopts
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// MinClientKeepaliveTime is the shortest ping interval of client connections.
+// Servers that keep the gRPC default enforcement policy, as the other
+// services do, close connections that ping more often than every 5 minutes,
+// or at all without active streams, with GOAWAY "too_many_pings".
+const MinClientKeepaliveTime = 5 * time.Minute
+
+// Config holds keepalive, connection lifetime and message size settings for
+// gRPC servers and client connections. Zero durations and sizes leave the gRPC
+// defaults in place.
+type Config struct {
+	KeepaliveTime         time.Duration // ping interval on idle server connections
+	KeepaliveTimeout      time.Duration // how long to wait for a ping ack
+	KeepaliveMinTime      time.Duration // shortest client ping interval the server accepts
+	ClientKeepaliveTime   time.Duration // ping interval of client connections with active streams
+	MaxConnectionIdle     time.Duration
+	MaxConnectionAge      time.Duration
+	MaxConnectionAgeGrace time.Duration
+	MaxRecvMsgSize        int
+	MaxSendMsgSize        int
+}
+
+// FromEnv builds a Config from the environment:
+//
+//	GRPC_KEEPALIVE_TIME              ping interval on idle server connections (default 30s)
+//	GRPC_KEEPALIVE_TIMEOUT           wait for a ping ack before closing the connection (default 10s)
+//	GRPC_KEEPALIVE_MIN_TIME          shortest client ping interval the server allows (default 10s)
+//	GRPC_CLIENT_KEEPALIVE_TIME       ping interval of client connections (default and minimum 5m)
+//	GRPC_MAX_CONNECTION_IDLE         close server connections idle for this long
+//	GRPC_MAX_CONNECTION_AGE          close server connections older than this, forcing clients to rebalance
+//	GRPC_MAX_CONNECTION_AGE_GRACE    time allowed for in-flight RPCs after GRPC_MAX_CONNECTION_AGE
+//	GRPC_MAX_RECV_MSG_SIZE           largest message accepted, in bytes
+//	GRPC_MAX_SEND_MSG_SIZE           largest message sent, in bytes
+//
+// The server keepalive defaults are shorter than the idle timeouts of common
+// cloud load balancers, so idle connections are not dropped silently. Client
+// connections ping no more often than the services they call allow; see
+// MinClientKeepaliveTime.
+func FromEnv() (Config, error) {
+	c := Config{
+		KeepaliveTime:       30 * time.Second,
+		KeepaliveTimeout:    10 * time.Second,
+		KeepaliveMinTime:    10 * time.Second,
+		ClientKeepaliveTime: MinClientKeepaliveTime,
+	}
+	durations := []struct {
+		env    string
+		target *time.Duration
+	}{
+		{"GRPC_KEEPALIVE_TIME", &c.KeepaliveTime},
+		{"GRPC_KEEPALIVE_TIMEOUT", &c.KeepaliveTimeout},
+		{"GRPC_KEEPALIVE_MIN_TIME", &c.KeepaliveMinTime},
+		{"GRPC_CLIENT_KEEPALIVE_TIME", &c.ClientKeepaliveTime},
+		{"GRPC_MAX_CONNECTION_IDLE", &c.MaxConnectionIdle},
+		{"GRPC_MAX_CONNECTION_AGE", &c.MaxConnectionAge},
+		{"GRPC_MAX_CONNECTION_AGE_GRACE", &c.MaxConnectionAgeGrace},
+	}
+	for _, d := range durations {
+		s := os.Getenv(d.env)
+		if s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil || v < 0 {
+			return Config{}, fmt.Errorf("failed to parse %s (%s) as a non-negative time.Duration", d.env, s)
+		}
+		*d.target = v
+	}
+	if c.ClientKeepaliveTime < MinClientKeepaliveTime {
+		return Config{}, fmt.Errorf("GRPC_CLIENT_KEEPALIVE_TIME (%v) must be at least %v, the interval downstream servers enforce", c.ClientKeepaliveTime, MinClientKeepaliveTime)
+	}
+	sizes := []struct {
+		env    string
+		target *int
+	}{
+		{"GRPC_MAX_RECV_MSG_SIZE", &c.MaxRecvMsgSize},
+		{"GRPC_MAX_SEND_MSG_SIZE", &c.MaxSendMsgSize},
+	}
+	for _, sz := range sizes {
+		s := os.Getenv(sz.env)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return Config{}, fmt.Errorf("%s must be a non-negative number of bytes, got %q", sz.env, s)
+		}
+		*sz.target = v
+	}
+	return c, nil
+}
+
+// ServerOptions returns the grpc.ServerOptions for c.
+func (c Config) ServerOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  c.KeepaliveTime,
+			Timeout:               c.KeepaliveTimeout,
+			MaxConnectionIdle:     c.MaxConnectionIdle,
+			MaxConnectionAge:      c.MaxConnectionAge,
+			MaxConnectionAgeGrace: c.MaxConnectionAgeGrace,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.KeepaliveMinTime,
+			PermitWithoutStream: true,
+		}),
+	}
+	if c.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsgSize))
+	}
+	return opts
+}
+
+// clientParameters returns the keepalive parameters of client connections.
+// They only ping while streams are active, since servers with the default
+// enforcement policy treat pings without streams as abuse.
+func (c Config) clientParameters() keepalive.ClientParameters {
+	return keepalive.ClientParameters{
+		Time:                max(c.ClientKeepaliveTime, MinClientKeepaliveTime),
+		Timeout:             c.KeepaliveTimeout,
+		PermitWithoutStream: false,
+	}
+}
+
+// DialOptions returns the grpc.DialOptions for long-lived client connections.
+func (c Config) DialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithKeepaliveParams(c.clientParameters()),
+	}
+	var callOpts []grpc.CallOption
+	if c.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(c.MaxSendMsgSize))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	return opts
+}
+
+// String summarizes the configuration for logging.
+func (c Config) String() string {
+	return fmt.Sprintf("keepalive: %v/%v (min %v, client %v), max connection idle: %v, age: %v (grace %v), max message size: recv %d send %d",
+		c.KeepaliveTime, c.KeepaliveTimeout, c.KeepaliveMinTime, c.ClientKeepaliveTime,
+		c.MaxConnectionIdle, c.MaxConnectionAge, c.MaxConnectionAgeGrace,
+		c.MaxRecvMsgSize, c.MaxSendMsgSize)
+}
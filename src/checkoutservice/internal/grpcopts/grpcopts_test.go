@@ -0,0 +1,109 @@
+package grpcopts
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestFromEnv(t *testing.T) {
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.KeepaliveTime != 30*time.Second || c.KeepaliveMinTime != 10*time.Second || c.ClientKeepaliveTime != MinClientKeepaliveTime {
+		t.Errorf("FromEnv defaults = %+v", c)
+	}
+
+	t.Setenv("GRPC_CLIENT_KEEPALIVE_TIME", "10m")
+	t.Setenv("GRPC_MAX_RECV_MSG_SIZE", "1024")
+	if c, err = FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ClientKeepaliveTime != 10*time.Minute || c.MaxRecvMsgSize != 1024 {
+		t.Errorf("FromEnv = %+v", c)
+	}
+}
+
+func TestFromEnvRejectsInvalidValues(t *testing.T) {
+	for env, value := range map[string]string{
+		"GRPC_KEEPALIVE_TIME":        "soon",
+		"GRPC_CLIENT_KEEPALIVE_TIME": "30s",
+		"GRPC_MAX_SEND_MSG_SIZE":     "-1",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("FromEnv with %s=%s = %v, want an error naming it", env, value, err)
+			}
+		})
+	}
+}
+
+// TestDialOptionsKeepalive checks the client keepalive stays within the gRPC
+// default enforcement policy the other services run with.
+func TestDialOptionsKeepalive(t *testing.T) {
+	for _, c := range []Config{{}, {ClientKeepaliveTime: time.Second, KeepaliveTimeout: 10 * time.Second}, {ClientKeepaliveTime: time.Hour}} {
+		p := c.clientParameters()
+		if p.Time < MinClientKeepaliveTime {
+			t.Errorf("clientParameters(%+v).Time = %v, want at least %v", c, p.Time, MinClientKeepaliveTime)
+		}
+		if p.PermitWithoutStream {
+			t.Errorf("clientParameters(%+v) pings without active streams", c)
+		}
+	}
+}
+
+// dial connects to a health server that keeps the default keepalive
+// enforcement policy using the dial options of c.
+func dial(t *testing.T, c Config) healthpb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	opts := append(c.DialOptions(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient("passthrough:///bufconn", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestDialOptions(t *testing.T) {
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dial(t, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+}
+
+func TestDialOptionsMessageSize(t *testing.T) {
+	client := dial(t, Config{MaxSendMsgSize: 16})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: strings.Repeat("x", 64)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Check with an oversized request = %v, want ResourceExhausted", err)
+	}
+}
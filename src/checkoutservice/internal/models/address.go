@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrInvalidAddress is returned for an address that lacks its street
+// address, city or country.
+var ErrInvalidAddress = errors.New("invalid address")
+
+// SavedAddress represents a shipping address in a user's address book
+type SavedAddress struct {
+	AddressID     string    `db:"address_id" json:"address_id"`
+	UserID        string    `db:"user_id" json:"user_id"`
+	StreetAddress string    `db:"street_address" json:"street_address"`
+	City          string    `db:"city" json:"city"`
+	State         string    `db:"state" json:"state"`
+	Country       string    `db:"country" json:"country"`
+	ZipCode       int32     `db:"zip_code" json:"zip_code"`
+	IsDefault     bool      `db:"is_default" json:"is_default"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// NewSavedAddressFromProto creates a SavedAddress of a user from a protobuf
+// Address.
+func NewSavedAddressFromProto(addressID, userID string, address *pb.Address, isDefault bool) *SavedAddress {
+	return &SavedAddress{
+		AddressID:     addressID,
+		UserID:        userID,
+		StreetAddress: address.GetStreetAddress(),
+		City:          address.GetCity(),
+		State:         address.GetState(),
+		Country:       address.GetCountry(),
+		ZipCode:       address.GetZipCode(),
+		IsDefault:     isDefault,
+	}
+}
+
+// Address returns the address as a protobuf Address, as PlaceOrder takes it.
+func (a *SavedAddress) Address() *pb.Address {
+	return &pb.Address{
+		StreetAddress: a.StreetAddress,
+		City:          a.City,
+		State:         a.State,
+		Country:       a.Country,
+		ZipCode:       a.ZipCode,
+	}
+}
+
+// ToProto converts the saved address to protobuf
+func (a *SavedAddress) ToProto() *pb.SavedAddress {
+	return &pb.SavedAddress{
+		AddressId:  a.AddressID,
+		UserId:     a.UserID,
+		Address:    a.Address(),
+		IsDefault:  a.IsDefault,
+		CreateTime: timestamppb.New(a.CreatedAt),
+	}
+}
@@ -1,9 +1,12 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"time"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/money"
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Order represents an order in the database
@@ -18,6 +21,37 @@ type Order struct {
 	ShippingAddress      string    `db:"shipping_address" json:"shipping_address"`
 	OrderDate            time.Time `db:"order_date" json:"order_date"`
 	Status               string    `db:"status" json:"status"`
+	ConfirmationStatus   string    `db:"confirmation_status" json:"confirmation_status"`
+	// The discount code applied and the amount it took off the subtotal,
+	// which is the items before the discount. Shipping is only in the total.
+	// All are empty for orders saved before discounts were recorded.
+	DiscountCode           string `db:"discount_code" json:"discount_code"`
+	DiscountAmountCurrency string `db:"discount_amount_currency" json:"discount_amount_currency"`
+	DiscountAmountUnits    int64  `db:"discount_amount_units" json:"discount_amount_units"`
+	DiscountAmountNanos    int32  `db:"discount_amount_nanos" json:"discount_amount_nanos"`
+	SubtotalAmountCurrency string `db:"subtotal_amount_currency" json:"subtotal_amount_currency"`
+	SubtotalAmountUnits    int64  `db:"subtotal_amount_units" json:"subtotal_amount_units"`
+	SubtotalAmountNanos    int32  `db:"subtotal_amount_nanos" json:"subtotal_amount_nanos"`
+	// The tax included in the total and its breakdown by jurisdiction. All
+	// are empty for orders saved before tax was recorded.
+	TaxAmountCurrency string    `db:"tax_amount_currency" json:"tax_amount_currency"`
+	TaxAmountUnits    int64     `db:"tax_amount_units" json:"tax_amount_units"`
+	TaxAmountNanos    int32     `db:"tax_amount_nanos" json:"tax_amount_nanos"`
+	TaxBreakdown      []TaxLine `db:"tax_breakdown" json:"tax_breakdown"`
+	// AddressID is the saved address the order was shipped to; empty if none
+	// was picked or it was deleted since.
+	AddressID string `db:"address_id" json:"address_id"`
+	// StatusReason is recorded with the status an order is saved with. It is
+	// not read back.
+	StatusReason string `db:"-" json:"-"`
+}
+
+// TaxLine is the tax of one jurisdiction on an order.
+type TaxLine struct {
+	Jurisdiction string `json:"jurisdiction"`
+	Currency     string `json:"currency"`
+	Units        int64  `json:"units"`
+	Nanos        int32  `json:"nanos"`
 }
 
 // OrderItem represents an item in an order
@@ -34,9 +68,33 @@ type OrderItem struct {
 	TotalPriceNanos      int32  `db:"total_price_nanos" json:"total_price_nanos"`
 }
 
-// NewOrderFromProto creates an Order from protobuf OrderResult
+// NewOrderFromProto creates an Order from protobuf OrderResult. An order
+// without a discount or tax gets a zero one in the currency of its total,
+// and one without a status is paid. The subtotal is left for the caller to
+// set from the items.
 func NewOrderFromProto(orderResult *pb.OrderResult, email, userID string, total *pb.Money) *Order {
 	shippingAddressStr := formatShippingAddress(orderResult.ShippingAddress)
+	discountCurrency := total.CurrencyCode
+	if d := orderResult.GetDiscount(); d != nil {
+		discountCurrency = d.GetCurrencyCode()
+	}
+	taxCurrency := total.CurrencyCode
+	if t := orderResult.GetTax(); t != nil {
+		taxCurrency = t.GetCurrencyCode()
+	}
+	var taxLines []TaxLine
+	for _, line := range orderResult.GetTaxLines() {
+		taxLines = append(taxLines, TaxLine{
+			Jurisdiction: line.GetJurisdiction(),
+			Currency:     line.GetAmount().GetCurrencyCode(),
+			Units:        line.GetAmount().GetUnits(),
+			Nanos:        line.GetAmount().GetNanos(),
+		})
+	}
+	status := orderResult.GetStatus()
+	if status == "" {
+		status = StatusPaid
+	}
 	
 	return &Order{
 		OrderID:              orderResult.OrderId,
@@ -47,40 +105,181 @@ func NewOrderFromProto(orderResult *pb.OrderResult, email, userID string, total
 		TotalAmountNanos:     total.Nanos,
 		ShippingTrackingID:   orderResult.ShippingTrackingId,
 		ShippingAddress:      shippingAddressStr,
-		Status:               "completed",
+		Status:               status,
+		DiscountCode:           orderResult.GetDiscountCode(),
+		DiscountAmountCurrency: discountCurrency,
+		DiscountAmountUnits:    orderResult.GetDiscount().GetUnits(),
+		DiscountAmountNanos:    orderResult.GetDiscount().GetNanos(),
+		TaxAmountCurrency:      taxCurrency,
+		TaxAmountUnits:         orderResult.GetTax().GetUnits(),
+		TaxAmountNanos:         orderResult.GetTax().GetNanos(),
+		TaxBreakdown:           taxLines,
+		AddressID:              orderResult.GetAddressId(),
 	}
 }
 
-// NewOrderItemsFromProto creates OrderItems from protobuf OrderItems
-func NewOrderItemsFromProto(orderID string, protoItems []*pb.OrderItem) []OrderItem {
+// ErrCurrencyMismatch is returned for an order whose items or shipping are
+// priced in a currency other than its total's.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// NewOrderItemsFromProto creates OrderItems from protobuf OrderItems of an
+// order totalled in currency. It returns an error if an item has an invalid
+// cost, its total does not fit in a Money value, or it is priced in another
+// currency (ErrCurrencyMismatch). An empty currency accepts items priced in
+// any currency.
+func NewOrderItemsFromProto(orderID, currency string, protoItems []*pb.OrderItem) ([]OrderItem, error) {
 	items := make([]OrderItem, len(protoItems))
 	
 	for i, item := range protoItems {
+		cost := item.GetCost()
+		quantity := item.GetItem().GetQuantity()
+		if currency != "" && cost.GetCurrencyCode() != currency {
+			return nil, fmt.Errorf("%w: product %s is priced in %q, the order total in %q",
+				ErrCurrencyMismatch, item.GetItem().GetProductId(), cost.GetCurrencyCode(), currency)
+		}
+
 		// Calculate total price for this item
-		totalUnits := item.Cost.Units * int64(item.GetItem().GetQuantity())
-		totalNanos := int64(item.Cost.Nanos) * int64(item.GetItem().GetQuantity())
-		
-		// Handle nano overflow (1 billion nanos = 1 unit)
-		if totalNanos >= 1000000000 {
-			extraUnits := totalNanos / 1000000000
-			totalUnits += extraUnits
-			totalNanos = totalNanos % 1000000000
+		if err := money.Validate(cost); err != nil {
+			return nil, fmt.Errorf("invalid price for product %s: %v", item.GetItem().GetProductId(), err)
+		}
+		total, err := money.Multiply(cost, int64(quantity))
+		if err != nil {
+			return nil, fmt.Errorf("invalid total for product %s: %v", item.GetItem().GetProductId(), err)
 		}
 		
 		items[i] = OrderItem{
 			OrderID:              orderID,
 			ProductID:            item.GetItem().GetProductId(),
-			Quantity:             item.GetItem().GetQuantity(),
-			UnitPriceCurrency:    item.Cost.CurrencyCode,
-			UnitPriceUnits:       item.Cost.Units,
-			UnitPriceNanos:       item.Cost.Nanos,
-			TotalPriceCurrency:   item.Cost.CurrencyCode,
-			TotalPriceUnits:      totalUnits,
-			TotalPriceNanos:      int32(totalNanos),
+			Quantity:             quantity,
+			UnitPriceCurrency:    cost.GetCurrencyCode(),
+			UnitPriceUnits:       cost.GetUnits(),
+			UnitPriceNanos:       cost.GetNanos(),
+			TotalPriceCurrency:   cost.GetCurrencyCode(),
+			TotalPriceUnits:      total.GetUnits(),
+			TotalPriceNanos:      total.GetNanos(),
 		}
 	}
 	
-	return items
+	return items, nil
+}
+
+// ToProto converts the order and its items, which may be nil, to protobuf.
+func (o *Order) ToProto(items []OrderItem) *pb.Order {
+	order := &pb.Order{
+		OrderId: o.OrderID,
+		UserId:  o.UserID,
+		Email:   o.Email,
+		Total: &pb.Money{
+			CurrencyCode: o.TotalAmountCurrency,
+			Units:        o.TotalAmountUnits,
+			Nanos:        o.TotalAmountNanos,
+		},
+		ShippingTrackingId: o.ShippingTrackingID,
+		ShippingAddress:    o.ShippingAddress,
+		OrderTime:          timestamppb.New(o.OrderDate),
+		Status:             o.Status,
+		ConfirmationStatus: o.ConfirmationStatus,
+		DiscountCode:       o.DiscountCode,
+		AddressId:          o.AddressID,
+	}
+	if o.DiscountAmountCurrency != "" {
+		order.Discount = o.discount()
+	}
+	if o.SubtotalAmountCurrency != "" {
+		order.Subtotal = &pb.Money{
+			CurrencyCode: o.SubtotalAmountCurrency,
+			Units:        o.SubtotalAmountUnits,
+			Nanos:        o.SubtotalAmountNanos,
+		}
+	}
+	if o.TaxAmountCurrency != "" {
+		order.Tax, order.TaxLines = o.tax()
+	}
+	for _, item := range items {
+		order.Items = append(order.Items, item.ToProto())
+	}
+	return order
+}
+
+// tax returns the tax of the order and its lines as protobuf.
+func (o *Order) tax() (*pb.Money, []*pb.TaxLine) {
+	var lines []*pb.TaxLine
+	for _, line := range o.TaxBreakdown {
+		lines = append(lines, &pb.TaxLine{
+			Jurisdiction: line.Jurisdiction,
+			Amount:       &pb.Money{CurrencyCode: line.Currency, Units: line.Units, Nanos: line.Nanos},
+		})
+	}
+	return &pb.Money{CurrencyCode: o.TaxAmountCurrency, Units: o.TaxAmountUnits, Nanos: o.TaxAmountNanos}, lines
+}
+
+// discount returns the discount of the order as Money.
+func (o *Order) discount() *pb.Money {
+	return &pb.Money{
+		CurrencyCode: o.DiscountAmountCurrency,
+		Units:        o.DiscountAmountUnits,
+		Nanos:        o.DiscountAmountNanos,
+	}
+}
+
+// ToOrderResult rebuilds the result PlaceOrder returned for the order from
+// the stored order and its items. The address is not stored in structured
+// form, so it is passed in. The shipping cost is the total less the items
+// and the tax, and plus the discount.
+func (o *Order) ToOrderResult(items []OrderItem, address *pb.Address) (*pb.OrderResult, error) {
+	shipping := &pb.Money{CurrencyCode: o.TotalAmountCurrency, Units: o.TotalAmountUnits, Nanos: o.TotalAmountNanos}
+	result := &pb.OrderResult{
+		OrderId:            o.OrderID,
+		ShippingTrackingId: o.ShippingTrackingID,
+		ShippingAddress:    address,
+		DiscountCode:       o.DiscountCode,
+		AddressId:          o.AddressID,
+		Status:             o.Status,
+	}
+	if o.DiscountAmountCurrency != "" {
+		result.Discount = o.discount()
+		var err error
+		if shipping, err = money.Sum(shipping, result.Discount); err != nil {
+			return nil, fmt.Errorf("invalid discount: %v", err)
+		}
+	}
+	if o.TaxAmountCurrency != "" {
+		result.Tax, result.TaxLines = o.tax()
+		var err error
+		if shipping, err = money.Sum(shipping, money.Negate(result.Tax)); err != nil {
+			return nil, fmt.Errorf("invalid tax: %v", err)
+		}
+	}
+	for _, item := range items {
+		var err error
+		shipping, err = money.Sum(shipping, money.Negate(&pb.Money{
+			CurrencyCode: item.TotalPriceCurrency,
+			Units:        item.TotalPriceUnits,
+			Nanos:        item.TotalPriceNanos,
+		}))
+		if err != nil {
+			return nil, fmt.Errorf("invalid total for product %s: %v", item.ProductID, err)
+		}
+		result.Items = append(result.Items, item.ToProto())
+	}
+	result.ShippingCost = shipping
+	return result, nil
+}
+
+// ToProto converts the item to a protobuf OrderItem whose cost is the unit
+// price, as in a placed order.
+func (i *OrderItem) ToProto() *pb.OrderItem {
+	return &pb.OrderItem{
+		Item: &pb.CartItem{
+			ProductId: i.ProductID,
+			Quantity:  i.Quantity,
+		},
+		Cost: &pb.Money{
+			CurrencyCode: i.UnitPriceCurrency,
+			Units:        i.UnitPriceUnits,
+			Nanos:        i.UnitPriceNanos,
+		},
+	}
 }
 
 // formatShippingAddress formats the shipping address as a string
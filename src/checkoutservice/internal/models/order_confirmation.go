@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Delivery statuses of an order's confirmation email.
+const (
+	ConfirmationPending = "pending"
+	ConfirmationSent    = "sent"
+	// ConfirmationFailed is final: every attempt to send the email failed.
+	ConfirmationFailed = "failed"
+)
+
+// Confirmation is an order confirmation email waiting in the
+// order_confirmations queue to be sent.
+type Confirmation struct {
+	OrderID string `db:"order_id" json:"order_id"`
+	Email   string `db:"email" json:"email"`
+	// Order is the pb.OrderResult the email is rendered from, as protojson.
+	Order     []byte    `db:"order_result" json:"order_result"`
+	Attempts  int       `db:"attempts" json:"attempts"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Types of the events recorded when an order is placed, shipped or
+// cancelled.
+const (
+	EventOrderPlaced    = "order_placed"
+	EventOrderShipped   = "order_shipped"
+	EventOrderCancelled = "order_cancelled"
+)
+
+// StatusEvent returns the type of the event recorded when an order moves to
+// status by UpdateOrderStatus, or "" if none is.
+func StatusEvent(status string) string {
+	if status == StatusShipped {
+		return EventOrderShipped
+	}
+	return ""
+}
+
+// OrderEvent is an order event waiting in the order_events outbox to be
+// published. Events are recorded in the transaction that changes the order,
+// so none are lost if publishing fails.
+type OrderEvent struct {
+	ID         int64     `db:"id" json:"id"`
+	Type       string    `db:"event_type" json:"event_type"`
+	FromStatus string    `db:"from_status" json:"from_status"`
+	Reason     string    `db:"reason" json:"reason"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	// Order is the order as it is when the event is read.
+	Order Order `json:"order"`
+}
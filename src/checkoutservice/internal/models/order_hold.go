@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+// OrderHold keeps what is needed to release an order held for review: the
+// payment transaction that authorized its total, to be captured, and the
+// address to ship it to. An order under review is neither charged nor
+// shipped until it is approved.
+type OrderHold struct {
+	OrderID       string      `db:"order_id" json:"order_id"`
+	TransactionID string      `db:"transaction_id" json:"transaction_id"`
+	Address       *pb.Address `db:"address" json:"address"`
+	CreatedAt     time.Time   `db:"created_at" json:"created_at"`
+}
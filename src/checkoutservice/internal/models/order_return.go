@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Return statuses. A return is requested by the customer and approved, with
+// its refund, by the shop.
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+)
+
+// ErrInvalidReturn is returned for a return of items that are not in the
+// order or of more than was ordered.
+var ErrInvalidReturn = errors.New("invalid return")
+
+// ErrNotReturnable is returned for a return of an order that has not been
+// delivered, and for approving a return that is no longer requested.
+var ErrNotReturnable = errors.New("not returnable")
+
+// OrderReturn represents a return request in the database
+type OrderReturn struct {
+	ReturnID  string       `db:"return_id" json:"return_id"`
+	OrderID   string       `db:"order_id" json:"order_id"`
+	UserID    string       `db:"user_id" json:"user_id"`
+	Reason    string       `db:"reason" json:"reason"`
+	Status    string       `db:"status" json:"status"`
+	CreatedAt time.Time    `db:"created_at" json:"created_at"`
+	Items     []ReturnItem `json:"items"`
+	Refund    *Refund      `json:"refund,omitempty"` // set once approved
+}
+
+// ReturnItem is an order item, or part of its quantity, being returned. It
+// links to the order_items row it returns.
+type ReturnItem struct {
+	ReturnID          string `db:"return_id" json:"return_id"`
+	OrderItemID       int    `db:"order_item_id" json:"order_item_id"`
+	ProductID         string `db:"product_id" json:"product_id"`
+	Quantity          int32  `db:"quantity" json:"quantity"`
+	UnitPriceCurrency string `db:"unit_price_currency" json:"unit_price_currency"`
+	UnitPriceUnits    int64  `db:"unit_price_units" json:"unit_price_units"`
+	UnitPriceNanos    int32  `db:"unit_price_nanos" json:"unit_price_nanos"`
+}
+
+// Refund represents money refunded for a return
+type Refund struct {
+	ID             int       `db:"id" json:"id"`
+	ReturnID       string    `db:"return_id" json:"return_id"`
+	OrderID        string    `db:"order_id" json:"order_id"`
+	AmountCurrency string    `db:"amount_currency" json:"amount_currency"`
+	AmountUnits    int64     `db:"amount_units" json:"amount_units"`
+	AmountNanos    int32     `db:"amount_nanos" json:"amount_nanos"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+// ToProto converts the return to protobuf
+func (r *OrderReturn) ToProto() *pb.OrderReturn {
+	ret := &pb.OrderReturn{
+		ReturnId:   r.ReturnID,
+		OrderId:    r.OrderID,
+		UserId:     r.UserID,
+		Reason:     r.Reason,
+		Status:     r.Status,
+		CreateTime: timestamppb.New(r.CreatedAt),
+	}
+	for _, item := range r.Items {
+		ret.Items = append(ret.Items, &pb.ReturnItem{ProductId: item.ProductID, Quantity: item.Quantity})
+	}
+	if r.Refund != nil {
+		ret.Refund = &pb.Money{
+			CurrencyCode: r.Refund.AmountCurrency,
+			Units:        r.Refund.AmountUnits,
+			Nanos:        r.Refund.AmountNanos,
+		}
+	}
+	return ret
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserOrderStats summarizes a user's orders. Cancelled and refunded orders
+// are left out.
+type UserOrderStats struct {
+	UserID         string
+	TotalOrders    int
+	Spend          []CurrencySpend // one per currency, by currency code
+	FirstOrderDate time.Time       // zero without orders
+	LastOrderDate  time.Time       // zero without orders
+	TopProducts    []ProductStats  // most units ordered first
+}
+
+// CurrencySpend is the total of a user's orders in one currency, less their
+// refunds.
+type CurrencySpend struct {
+	Currency string
+	Units    int64
+	Nanos    int32
+}
+
+// ProductStats counts how much of a product a user ordered.
+type ProductStats struct {
+	ProductID string
+	Quantity  int64 // units across all orders
+	Orders    int   // orders containing the product
+}
+
+// ToProto converts the stats to protobuf.
+func (s *UserOrderStats) ToProto() *pb.UserOrderStats {
+	stats := &pb.UserOrderStats{
+		UserId:      s.UserID,
+		TotalOrders: int64(s.TotalOrders),
+	}
+	if !s.FirstOrderDate.IsZero() {
+		stats.FirstOrderTime = timestamppb.New(s.FirstOrderDate)
+		stats.LastOrderTime = timestamppb.New(s.LastOrderDate)
+	}
+	for _, spend := range s.Spend {
+		stats.LifetimeSpend = append(stats.LifetimeSpend, &pb.Money{
+			CurrencyCode: spend.Currency,
+			Units:        spend.Units,
+			Nanos:        spend.Nanos,
+		})
+	}
+	for _, p := range s.TopProducts {
+		stats.TopProducts = append(stats.TopProducts, &pb.ProductOrderStats{
+			ProductId: p.ProductID,
+			Quantity:  p.Quantity,
+			Orders:    int64(p.Orders),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Order statuses. PlaceOrder saves an order as pending before it charges the
+// card and completes it as paid once the card is charged and the order
+// shipped, or as under review when fraud screening flagged it. From there it
+// moves through the lifecycle with UpdateOrderStatus.
+const (
+	StatusPending     = "pending"
+	StatusPaid        = "paid"
+	StatusUnderReview = "under_review"
+	StatusShipped     = "shipped"
+	StatusDelivered   = "delivered"
+	StatusCancelled   = "cancelled"
+	StatusRefunded    = "refunded"
+
+	// StatusCompleted is the status of orders stored before the lifecycle
+	// existed. The order history migration renames it to StatusPaid.
+	StatusCompleted = "completed"
+)
+
+// statusTransitions lists the statuses each status may move to. Cancelled and
+// refunded orders are final. A pending order is still being placed, and may
+// be charged at any moment, so it can't be cancelled; PlaceOrder drops it if
+// it fails.
+var statusTransitions = map[string][]string{
+	StatusPending:     {StatusPaid, StatusUnderReview},
+	StatusPaid:        {StatusShipped, StatusCancelled, StatusRefunded},
+	StatusUnderReview: {StatusPaid, StatusCancelled, StatusRefunded},
+	StatusShipped:     {StatusDelivered, StatusRefunded},
+	StatusDelivered:   {StatusRefunded},
+	StatusCancelled:   nil,
+	StatusRefunded:    nil,
+}
+
+// ErrUnknownStatus is returned for a status outside the order lifecycle.
+var ErrUnknownStatus = errors.New("unknown order status")
+
+// ErrInvalidStatusTransition is returned when an order may not move from its
+// current status to the requested one.
+var ErrInvalidStatusTransition = errors.New("invalid order status transition")
+
+// ValidStatus reports whether status is part of the order lifecycle.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CheckStatusTransition returns an error wrapping ErrUnknownStatus or
+// ErrInvalidStatusTransition unless an order may move from one status to
+// the other.
+func CheckStatusTransition(from, to string) error {
+	if !ValidStatus(to) {
+		return fmt.Errorf("%w %q", ErrUnknownStatus, to)
+	}
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w from %s to %s", ErrInvalidStatusTransition, from, to)
+}
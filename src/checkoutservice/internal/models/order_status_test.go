@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckStatusTransition(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		want     error
+	}{
+		{StatusPending, StatusPaid, nil},
+		{StatusPending, StatusUnderReview, nil},
+		{StatusPaid, StatusShipped, nil},
+		{StatusPaid, StatusCancelled, nil},
+		{StatusPaid, StatusRefunded, nil},
+		{StatusShipped, StatusDelivered, nil},
+		{StatusShipped, StatusRefunded, nil},
+		{StatusDelivered, StatusRefunded, nil},
+		{StatusUnderReview, StatusPaid, nil},
+		{StatusUnderReview, StatusCancelled, nil},
+		{StatusUnderReview, StatusRefunded, nil},
+		{StatusUnderReview, StatusShipped, ErrInvalidStatusTransition},
+		{StatusPaid, StatusUnderReview, ErrInvalidStatusTransition},
+		{StatusPending, StatusShipped, ErrInvalidStatusTransition},
+		{StatusPending, StatusCancelled, ErrInvalidStatusTransition},
+		{StatusShipped, StatusCancelled, ErrInvalidStatusTransition},
+		{StatusDelivered, StatusShipped, ErrInvalidStatusTransition},
+		{StatusPaid, StatusPaid, ErrInvalidStatusTransition},
+		{StatusCancelled, StatusPaid, ErrInvalidStatusTransition},
+		{StatusRefunded, StatusDelivered, ErrInvalidStatusTransition},
+		{StatusPaid, StatusCompleted, ErrUnknownStatus},
+		{StatusPaid, "lost", ErrUnknownStatus},
+	} {
+		err := CheckStatusTransition(tc.from, tc.to)
+		if tc.want == nil && err != nil {
+			t.Errorf("%s -> %s: expected no error, got %v", tc.from, tc.to, err)
+		}
+		if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s -> %s: expected %v, got %v", tc.from, tc.to, tc.want, err)
+		}
+	}
+}
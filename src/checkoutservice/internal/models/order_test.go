@@ -1,7 +1,11 @@
 package models
 
 import (
+	"errors"
+	"math"
+	"math/big"
 	"testing"
+	"time"
 
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
 )
@@ -52,8 +56,12 @@ func TestNewOrderFromProto(t *testing.T) {
 	if order.ShippingTrackingID != orderResult.ShippingTrackingId {
 		t.Errorf("Expected Tracking ID %s, got %s", orderResult.ShippingTrackingId, order.ShippingTrackingID)
 	}
-	if order.Status != "completed" {
-		t.Errorf("Expected Status 'completed', got %s", order.Status)
+	if order.Status != StatusPaid {
+		t.Errorf("Expected Status 'paid', got %s", order.Status)
+	}
+	orderResult.Status = StatusUnderReview
+	if held := NewOrderFromProto(orderResult, email, userID, total); held.Status != StatusUnderReview {
+		t.Errorf("Expected Status 'under_review', got %s", held.Status)
 	}
 
 	// Test shipping address formatting
@@ -83,14 +91,17 @@ func TestNewOrderItemsFromProto(t *testing.T) {
 				Quantity:  1,
 			},
 			Cost: &pb.Money{
-				CurrencyCode: "EUR",
+				CurrencyCode: "USD",
 				Units:        25,
-				Nanos:        500000000, // €25.50
+				Nanos:        500000000, // $25.50
 			},
 		},
 	}
 
-	items := NewOrderItemsFromProto(orderID, protoItems)
+	items, err := NewOrderItemsFromProto(orderID, "USD", protoItems)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
 
 	if len(items) != len(protoItems) {
 		t.Fatalf("Expected %d items, got %d", len(protoItems), len(items))
@@ -135,11 +146,11 @@ func TestNewOrderItemsFromProto(t *testing.T) {
 	if item2.Quantity != 1 {
 		t.Errorf("Item 2: Expected Quantity 1, got %d", item2.Quantity)
 	}
-	if item2.UnitPriceCurrency != "EUR" {
-		t.Errorf("Item 2: Expected Currency 'EUR', got %s", item2.UnitPriceCurrency)
+	if item2.UnitPriceCurrency != "USD" {
+		t.Errorf("Item 2: Expected Currency 'USD', got %s", item2.UnitPriceCurrency)
 	}
 
-	// Test total price calculation (1 * €25.50 = €25.50)
+	// Test total price calculation (1 * $25.50 = $25.50)
 	expectedTotalUnits2 := int64(25)
 	expectedTotalNanos2 := int32(500000000)
 	if item2.TotalPriceUnits != expectedTotalUnits2 {
@@ -166,7 +177,10 @@ func TestNewOrderItemsFromProto_NanoOverflow(t *testing.T) {
 		},
 	}
 
-	items := NewOrderItemsFromProto(orderID, protoItems)
+	items, err := NewOrderItemsFromProto(orderID, "USD", protoItems)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
 
 	if len(items) != 1 {
 		t.Fatalf("Expected 1 item, got %d", len(items))
@@ -187,6 +201,237 @@ func TestNewOrderItemsFromProto_NanoOverflow(t *testing.T) {
 	}
 }
 
+func TestNewOrderItemsFromProto_NegativeNanos(t *testing.T) {
+	protoItems := []*pb.OrderItem{
+		{
+			Item: &pb.CartItem{ProductId: "PRODUCT-REFUND", Quantity: 5},
+			Cost: &pb.Money{CurrencyCode: "USD", Units: -1, Nanos: -999999999},
+		},
+	}
+
+	items, err := NewOrderItemsFromProto("test-order-negative", "USD", protoItems)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// 5 * -$1.999999999 = -$9.999999995
+	if items[0].TotalPriceUnits != -9 {
+		t.Errorf("Expected Total Units -9, got %d", items[0].TotalPriceUnits)
+	}
+	if items[0].TotalPriceNanos != -999999995 {
+		t.Errorf("Expected Total Nanos -999999995, got %d", items[0].TotalPriceNanos)
+	}
+}
+
+func TestNewOrderItemsFromProto_LargeQuantity(t *testing.T) {
+	protoItems := []*pb.OrderItem{
+		{
+			Item: &pb.CartItem{ProductId: "PRODUCT-BULK", Quantity: math.MaxInt32},
+			Cost: &pb.Money{CurrencyCode: "USD", Units: 0, Nanos: 999999999},
+		},
+	}
+
+	items, err := NewOrderItemsFromProto("test-order-bulk", "USD", protoItems)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// 2147483647 * $0.999999999 = $2147483644.852516353
+	if items[0].TotalPriceUnits != 2147483644 {
+		t.Errorf("Expected Total Units 2147483644, got %d", items[0].TotalPriceUnits)
+	}
+	if items[0].TotalPriceNanos != 852516353 {
+		t.Errorf("Expected Total Nanos 852516353, got %d", items[0].TotalPriceNanos)
+	}
+}
+
+func TestNewOrderItemsFromProto_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cost *pb.Money
+	}{
+		{"mixed signs", &pb.Money{CurrencyCode: "USD", Units: 1, Nanos: -500000000}},
+		{"nanos out of range", &pb.Money{CurrencyCode: "USD", Units: 1, Nanos: 1000000000}},
+		{"total overflows", &pb.Money{CurrencyCode: "USD", Units: math.MaxInt64 / 2, Nanos: 0}},
+		{"other currency", &pb.Money{CurrencyCode: "EUR", Units: 25, Nanos: 500000000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protoItems := []*pb.OrderItem{
+				{Item: &pb.CartItem{ProductId: "PRODUCT-BAD", Quantity: 3}, Cost: tt.cost},
+			}
+			_, err := NewOrderItemsFromProto("test-order-bad", "USD", protoItems)
+			if err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if got, want := errors.Is(err, ErrCurrencyMismatch), tt.cost.CurrencyCode != "USD"; got != want {
+				t.Errorf("errors.Is(%v, ErrCurrencyMismatch) = %v, want %v", err, got, want)
+			}
+		})
+	}
+}
+
+func FuzzNewOrderItemsFromProto(f *testing.F) {
+	f.Add(int64(15), int32(990000000), int32(2))
+	f.Add(int64(-1), int32(-999999999), int32(5))
+	f.Add(int64(0), int32(999999999), int32(math.MaxInt32))
+	f.Add(int64(1), int32(-500000000), int32(1))
+	f.Fuzz(func(t *testing.T, units int64, nanos int32, quantity int32) {
+		protoItems := []*pb.OrderItem{
+			{
+				Item: &pb.CartItem{ProductId: "PRODUCT-FUZZ", Quantity: quantity},
+				Cost: &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos},
+			},
+		}
+		items, err := NewOrderItemsFromProto("test-order-fuzz", "USD", protoItems)
+		if err != nil {
+			return
+		}
+
+		total := items[0]
+		if total.TotalPriceNanos <= -1000000000 || total.TotalPriceNanos >= 1000000000 {
+			t.Fatalf("Total Nanos %d out of range", total.TotalPriceNanos)
+		}
+		if total.TotalPriceUnits != 0 && total.TotalPriceNanos != 0 &&
+			(total.TotalPriceUnits < 0) != (total.TotalPriceNanos < 0) {
+			t.Fatalf("Total %d/%d has mismatched signs", total.TotalPriceUnits, total.TotalPriceNanos)
+		}
+
+		want := new(big.Int).Mul(big.NewInt(units), big.NewInt(1000000000))
+		want.Add(want, big.NewInt(int64(nanos)))
+		want.Mul(want, big.NewInt(int64(quantity)))
+		got := new(big.Int).Mul(big.NewInt(total.TotalPriceUnits), big.NewInt(1000000000))
+		got.Add(got, big.NewInt(int64(total.TotalPriceNanos)))
+		if got.Cmp(want) != 0 {
+			t.Fatalf("%d/%d x %d: expected %v nanos, got %v", units, nanos, quantity, want, got)
+		}
+	})
+}
+
+func TestOrderToProto(t *testing.T) {
+	orderDate := time.Date(2025, 3, 14, 15, 9, 26, 535000000, time.UTC)
+	order := &Order{
+		OrderID:             "order-1",
+		UserID:              "user-1",
+		Email:               "user@example.com",
+		TotalAmountCurrency: "USD",
+		TotalAmountUnits:    41,
+		TotalAmountNanos:    970000000,
+		ShippingTrackingID:  "TRACK-1",
+		ShippingAddress:     "456 Oak Ave, Springfield, IL 62701, United States",
+		OrderDate:           orderDate,
+		Status:              "completed",
+	}
+	items := []OrderItem{{
+		OrderID: "order-1", ProductID: "PRODUCT-1", Quantity: 2,
+		UnitPriceCurrency: "USD", UnitPriceUnits: 15, UnitPriceNanos: 990000000,
+		TotalPriceCurrency: "USD", TotalPriceUnits: 31, TotalPriceNanos: 980000000,
+	}}
+
+	got := order.ToProto(items)
+	if got.OrderId != "order-1" || got.UserId != "user-1" || got.Email != "user@example.com" ||
+		got.ShippingTrackingId != "TRACK-1" || got.ShippingAddress != order.ShippingAddress || got.Status != "completed" {
+		t.Errorf("Unexpected order fields: %v", got)
+	}
+	if got.Total.CurrencyCode != "USD" || got.Total.Units != 41 || got.Total.Nanos != 970000000 {
+		t.Errorf("Expected total USD 41.97, got %v", got.Total)
+	}
+	if !got.OrderTime.AsTime().Equal(orderDate) {
+		t.Errorf("Expected order time %v, got %v", orderDate, got.OrderTime.AsTime())
+	}
+	if len(got.Items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(got.Items))
+	}
+	item := got.Items[0]
+	if item.Item.ProductId != "PRODUCT-1" || item.Item.Quantity != 2 {
+		t.Errorf("Unexpected item %v", item.Item)
+	}
+	if item.Cost.Units != 15 || item.Cost.Nanos != 990000000 {
+		t.Errorf("Expected cost to be the unit price, got %v", item.Cost)
+	}
+
+	if items := order.ToProto(nil).Items; len(items) != 0 {
+		t.Errorf("Expected no items, got %d", len(items))
+	}
+	if got.Discount != nil || got.Subtotal != nil || got.Tax != nil {
+		t.Errorf("Expected no discount, subtotal or tax for an order saved without them, got %v, %v and %v", got.Discount, got.Subtotal, got.Tax)
+	}
+
+	order.DiscountCode = "WELCOME10"
+	order.DiscountAmountCurrency, order.DiscountAmountUnits, order.DiscountAmountNanos = "USD", 3, 190000000
+	order.SubtotalAmountCurrency, order.SubtotalAmountUnits, order.SubtotalAmountNanos = "USD", 31, 980000000
+	got = order.ToProto(items)
+	if got.DiscountCode != "WELCOME10" || got.Discount.GetUnits() != 3 || got.Discount.GetNanos() != 190000000 ||
+		got.Subtotal.GetCurrencyCode() != "USD" || got.Subtotal.GetUnits() != 31 || got.Subtotal.GetNanos() != 980000000 {
+		t.Errorf("Unexpected discount %v or subtotal %v", got.Discount, got.Subtotal)
+	}
+
+	order.TaxAmountCurrency, order.TaxAmountUnits, order.TaxAmountNanos = "USD", 2, 290000000
+	order.TaxBreakdown = []TaxLine{{Jurisdiction: "germany", Currency: "USD", Units: 2, Nanos: 290000000}}
+	got = order.ToProto(nil)
+	if got.Tax.GetUnits() != 2 || got.Tax.GetNanos() != 290000000 || len(got.TaxLines) != 1 ||
+		got.TaxLines[0].Jurisdiction != "germany" || got.TaxLines[0].Amount.GetUnits() != 2 {
+		t.Errorf("Unexpected tax %v with lines %v", got.Tax, got.TaxLines)
+	}
+}
+
+func TestOrderToOrderResult(t *testing.T) {
+	// $31.98 + $9.99 of items and $5.00 of shipping
+	order := &Order{OrderID: "order-1", TotalAmountCurrency: "USD", TotalAmountUnits: 46, TotalAmountNanos: 970000000, ShippingTrackingID: "TRACK-1"}
+	items := []OrderItem{
+		{ProductID: "PRODUCT-1", Quantity: 2, UnitPriceCurrency: "USD", UnitPriceUnits: 15, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 31, TotalPriceNanos: 980000000},
+		{ProductID: "PRODUCT-2", Quantity: 1, UnitPriceCurrency: "USD", UnitPriceUnits: 9, UnitPriceNanos: 990000000,
+			TotalPriceCurrency: "USD", TotalPriceUnits: 9, TotalPriceNanos: 990000000},
+	}
+	address := &pb.Address{City: "Springfield"}
+
+	result, err := order.ToOrderResult(items, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OrderId != "order-1" || result.ShippingTrackingId != "TRACK-1" || result.ShippingAddress != address || len(result.Items) != 2 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if c := result.ShippingCost; c.CurrencyCode != "USD" || c.Units != 5 || c.Nanos != 0 {
+		t.Errorf("Expected shipping cost USD 5.00, got %v", c)
+	}
+	held := *order
+	held.Status = StatusUnderReview
+	if result, err := held.ToOrderResult(items, address); err != nil || result.Status != StatusUnderReview {
+		t.Errorf("Expected the status of the order, got %v, %v", result.GetStatus(), err)
+	}
+
+	// A $4.19 discount on the items leaves the shipping cost as it is.
+	discounted := *order
+	discounted.TotalAmountUnits, discounted.TotalAmountNanos = 42, 780000000
+	discounted.DiscountCode = "WELCOME10"
+	discounted.DiscountAmountCurrency, discounted.DiscountAmountUnits, discounted.DiscountAmountNanos = "USD", 4, 190000000
+	if result, err = discounted.ToOrderResult(items, address); err != nil {
+		t.Fatal(err)
+	}
+	if c := result.ShippingCost; c.Units != 5 || c.Nanos != 0 || result.DiscountCode != "WELCOME10" || result.Discount.GetUnits() != 4 {
+		t.Errorf("Unexpected discounted result %v", result)
+	}
+
+	// So does $3.00 of tax.
+	taxed := *order
+	taxed.TotalAmountUnits = 49
+	taxed.TaxAmountCurrency, taxed.TaxAmountUnits = "USD", 3
+	taxed.TaxBreakdown = []TaxLine{{Jurisdiction: "germany", Currency: "USD", Units: 3}}
+	if result, err = taxed.ToOrderResult(items, address); err != nil {
+		t.Fatal(err)
+	}
+	if c := result.ShippingCost; c.Units != 5 || c.Nanos != 0 || result.Tax.GetUnits() != 3 || len(result.TaxLines) != 1 {
+		t.Errorf("Unexpected taxed result %v", result)
+	}
+
+	items[1].TotalPriceCurrency = "EUR"
+	if _, err := order.ToOrderResult(items, address); err == nil {
+		t.Error("Expected an error for items in another currency")
+	}
+}
+
 func TestFormatShippingAddress_NilAddress(t *testing.T) {
 	address := formatShippingAddress(nil)
 	if address != "" {
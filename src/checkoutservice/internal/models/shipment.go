@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Shipment statuses. A shipment is recorded once it has left the warehouse
+// and moves to delivered when the carrier hands it over.
+const (
+	ShipmentShipped   = "shipped"
+	ShipmentDelivered = "delivered"
+)
+
+// Fulfillment statuses of an order item, from its shipments.
+const (
+	FulfillmentUnshipped        = "unshipped"
+	FulfillmentPartiallyShipped = "partially_shipped"
+	FulfillmentShipped          = "shipped"
+	FulfillmentDelivered        = "delivered"
+)
+
+// ErrInvalidShipment is returned for a shipment without a tracking ID, of
+// items that are not in the order or of more than is left to ship.
+var ErrInvalidShipment = errors.New("invalid shipment")
+
+// ErrNotShippable is returned for a shipment of an order that is not paid or
+// shipped, and for a status change a shipment may not make.
+var ErrNotShippable = errors.New("not shippable")
+
+// Shipment represents a shipment of order items in the database
+type Shipment struct {
+	ShipmentID string         `db:"shipment_id" json:"shipment_id"`
+	OrderID    string         `db:"order_id" json:"order_id"`
+	TrackingID string         `db:"tracking_id" json:"tracking_id"`
+	Carrier    string         `db:"carrier" json:"carrier"`
+	Status     string         `db:"status" json:"status"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time      `db:"updated_at" json:"updated_at"`
+	Items      []ShipmentItem `json:"items"`
+}
+
+// ShipmentItem is an order item, or part of its quantity, in a shipment. It
+// links to the order_items row it ships.
+type ShipmentItem struct {
+	ShipmentID  string `db:"shipment_id" json:"shipment_id"`
+	OrderItemID int    `db:"order_item_id" json:"order_item_id"`
+	ProductID   string `db:"product_id" json:"product_id"`
+	Quantity    int32  `db:"quantity" json:"quantity"`
+}
+
+// ItemFulfillment is how much of an order item has been shipped and
+// delivered.
+type ItemFulfillment struct {
+	OrderItemID int    `json:"order_item_id"`
+	ProductID   string `json:"product_id"`
+	Quantity    int32  `json:"quantity"`
+	Shipped     int32  `json:"shipped_quantity"`
+	Delivered   int32  `json:"delivered_quantity"`
+}
+
+// Fulfillment sums the shipments of an order per order item, in the order
+// of items.
+func Fulfillment(items []OrderItem, shipments []Shipment) []ItemFulfillment {
+	index := make(map[int]int, len(items))
+	fulfillment := make([]ItemFulfillment, len(items))
+	for i, item := range items {
+		index[item.ID] = i
+		fulfillment[i] = ItemFulfillment{OrderItemID: item.ID, ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+	for _, s := range shipments {
+		for _, item := range s.Items {
+			i, ok := index[item.OrderItemID]
+			if !ok {
+				continue
+			}
+			fulfillment[i].Shipped += item.Quantity
+			if s.Status == ShipmentDelivered {
+				fulfillment[i].Delivered += item.Quantity
+			}
+		}
+	}
+	return fulfillment
+}
+
+// Status is the fulfillment status of the item.
+func (f ItemFulfillment) Status() string {
+	switch {
+	case f.Delivered >= f.Quantity:
+		return FulfillmentDelivered
+	case f.Shipped >= f.Quantity:
+		return FulfillmentShipped
+	case f.Shipped > 0:
+		return FulfillmentPartiallyShipped
+	default:
+		return FulfillmentUnshipped
+	}
+}
+
+// ToProto converts the item fulfillment to protobuf
+func (f ItemFulfillment) ToProto() *pb.ItemFulfillment {
+	return &pb.ItemFulfillment{
+		ProductId:         f.ProductID,
+		Quantity:          f.Quantity,
+		ShippedQuantity:   f.Shipped,
+		DeliveredQuantity: f.Delivered,
+		Status:            f.Status(),
+	}
+}
+
+// ToProto converts the shipment to protobuf
+func (s *Shipment) ToProto() *pb.Shipment {
+	shipment := &pb.Shipment{
+		ShipmentId: s.ShipmentID,
+		OrderId:    s.OrderID,
+		TrackingId: s.TrackingID,
+		Carrier:    s.Carrier,
+		Status:     s.Status,
+		CreateTime: timestamppb.New(s.CreatedAt),
+		UpdateTime: timestamppb.New(s.UpdatedAt),
+	}
+	for _, item := range s.Items {
+		shipment.Items = append(shipment.Items, &pb.ShipmentItem{ProductId: item.ProductID, Quantity: item.Quantity})
+	}
+	return shipment
+}
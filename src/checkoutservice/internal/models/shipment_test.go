@@ -0,0 +1,36 @@
+package models
+
+import "testing"
+
+func TestFulfillment(t *testing.T) {
+	items := []OrderItem{
+		{ID: 1, ProductID: "PRODUCT-1", Quantity: 3},
+		{ID: 2, ProductID: "PRODUCT-2", Quantity: 1},
+		{ID: 3, ProductID: "PRODUCT-3", Quantity: 2},
+		{ID: 4, ProductID: "PRODUCT-4", Quantity: 1},
+	}
+	shipments := []Shipment{
+		{Status: ShipmentDelivered, Items: []ShipmentItem{{OrderItemID: 1, Quantity: 1}, {OrderItemID: 2, Quantity: 1}}},
+		{Status: ShipmentShipped, Items: []ShipmentItem{{OrderItemID: 1, Quantity: 2}, {OrderItemID: 3, Quantity: 1}}},
+	}
+
+	got := Fulfillment(items, shipments)
+	want := []struct {
+		shipped, delivered int32
+		status             string
+	}{
+		{3, 1, FulfillmentShipped},
+		{1, 1, FulfillmentDelivered},
+		{1, 0, FulfillmentPartiallyShipped},
+		{0, 0, FulfillmentUnshipped},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Fulfillment() returned %d items, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].ProductID != items[i].ProductID || got[i].Shipped != w.shipped || got[i].Delivered != w.delivered || got[i].Status() != w.status {
+			t.Errorf("item %d = %+v (%s), want shipped %d, delivered %d, %s",
+				i, got[i], got[i].Status(), w.shipped, w.delivered, w.status)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+// Delivery statuses of a webhook.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	// WebhookFailed is final: every attempt to deliver the webhook failed.
+	WebhookFailed = "failed"
+)
+
+// WebhookDelivery is an order event waiting in webhook_deliveries to be
+// POSTed to one endpoint.
+type WebhookDelivery struct {
+	ID       int64      `db:"id" json:"id"`
+	Endpoint string     `db:"endpoint" json:"endpoint"`
+	Attempts int        `db:"attempts" json:"attempts"`
+	Event    OrderEvent `json:"event"`
+}
@@ -0,0 +1,407 @@
+// Package orderbuffer is an outbox for the orders placed while the order
+// database is unavailable. Each order is written to a directory on a
+// persistent volume before its card is charged, and saved to the database
+// once it is back, so it survives a restart or reschedule of the pod.
+package orderbuffer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrFull is returned by Reserve when the buffer holds MaxOrders orders.
+	ErrFull = errors.New("order buffer is full")
+	// ErrDuplicate is returned by Reserve for an order already buffered.
+	ErrDuplicate = errors.New("order is already buffered")
+	// ErrNotReserved is returned by Complete for an order that is not
+	// reserved in the buffer.
+	ErrNotReserved = errors.New("order is not reserved in the buffer")
+)
+
+// Config holds the order buffer settings.
+type Config struct {
+	MaxOrders int           // orders held at most
+	Dir       string        // where orders are written
+	Interval  time.Duration // how often saving the buffered orders is attempted
+}
+
+func (c *Config) String() string {
+	return fmt.Sprintf("max=%d, dir=%s, interval=%v", c.MaxOrders, c.Dir, c.Interval)
+}
+
+// FromEnv builds a Config from the environment, or returns nil when orders
+// are not buffered:
+//
+//	ORDER_BUFFER_DIR            directory on a persistent volume orders are written to (default: off)
+//	ORDER_BUFFER_MAX_ORDERS     orders held at most; 0 turns buffering off (default 1000)
+//	ORDER_BUFFER_FLUSH_INTERVAL how often saving buffered orders is attempted (default 5s)
+func FromEnv() (*Config, error) {
+	c := &Config{MaxOrders: 1000, Dir: os.Getenv("ORDER_BUFFER_DIR"), Interval: 5 * time.Second}
+	if s := os.Getenv("ORDER_BUFFER_MAX_ORDERS"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("ORDER_BUFFER_MAX_ORDERS (%s) must be a non-negative integer", s)
+		}
+		c.MaxOrders = v
+	}
+	if s := os.Getenv("ORDER_BUFFER_FLUSH_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("failed to parse ORDER_BUFFER_FLUSH_INTERVAL (%s) as a positive time.Duration", s)
+		}
+		c.Interval = v
+	}
+	if c.Dir == "" || c.MaxOrders == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// Order is a buffered order, with the arguments of
+// services.OrderService.SaveBufferedOrder. It is pending from Reserve until
+// Complete, and is not changed once buffered.
+type Order struct {
+	Result        *pb.OrderResult
+	Email         string
+	UserID        string
+	Total         *pb.Money
+	TransactionID string // the payment of the order; set by Complete
+	PlacedAt      time.Time
+}
+
+// Pending reports whether the order is still being placed.
+func (o *Order) Pending() bool {
+	return o.Result.GetStatus() == models.StatusPending
+}
+
+// record is how an Order is written to a file, with the messages in their
+// JSON encoding.
+type record struct {
+	Result        json.RawMessage `json:"result"`
+	Email         string          `json:"email"`
+	UserID        string          `json:"user_id"`
+	Total         json.RawMessage `json:"total"`
+	TransactionID string          `json:"transaction_id,omitempty"`
+	PlacedAt      time.Time       `json:"placed_at"`
+}
+
+// SaveFunc saves a completed buffered order. A transient error, for which
+// database.IsTransient is true, or a context error keeps the order buffered.
+type SaveFunc func(ctx context.Context, order *Order) error
+
+// Buffer holds orders, oldest first, until they are saved. It is safe for
+// concurrent use, but only one Buffer may use a directory at a time.
+type Buffer struct {
+	config *Config
+	log    *logrus.Logger
+
+	mu      sync.Mutex
+	orders  []*Order
+	saved   int64
+	dropped int64
+}
+
+// New returns a Buffer for config, which must not be nil, holding the orders
+// left in config.Dir by a previous run.
+func New(config *Config, log *logrus.Logger) (*Buffer, error) {
+	b := &Buffer{config: config, log: log}
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create order buffer directory: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(config.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		order, err := readOrder(file)
+		if err != nil {
+			log.Errorf("skipping buffered order %s: %v", file, err)
+			continue
+		}
+		b.orders = append(b.orders, order)
+	}
+	sort.SliceStable(b.orders, func(i, j int) bool { return b.orders[i].PlacedAt.Before(b.orders[j].PlacedAt) })
+	if len(b.orders) > 0 {
+		log.Infof("loaded %d buffered orders from %s", len(b.orders), config.Dir)
+	}
+	return b, nil
+}
+
+// Reserve buffers a copy of order, whose result must be pending, once it is
+// written to the directory. It returns ErrFull when the buffer holds
+// MaxOrders orders, and ErrDuplicate if an order with its ID is buffered.
+// Complete completes the order, Cancel drops it.
+func (b *Buffer) Reserve(order *Order) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.find(order.Result.GetOrderId()) >= 0 {
+		return ErrDuplicate
+	}
+	if len(b.orders) >= b.config.MaxOrders {
+		return ErrFull
+	}
+	o := *order
+	o.Result = proto.Clone(order.Result).(*pb.OrderResult)
+	if err := b.write(&o); err != nil {
+		return err
+	}
+	b.orders = append(b.orders, &o)
+	return nil
+}
+
+// Complete replaces the result of an order reserved by Reserve with
+// orderResult, paid with transactionID, so that it is saved by the next
+// Flush. It returns ErrNotReserved if the order is not pending in the
+// buffer.
+func (b *Buffer) Complete(orderResult *pb.OrderResult, transactionID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.find(orderResult.GetOrderId())
+	if i < 0 || !b.orders[i].Pending() {
+		return ErrNotReserved
+	}
+	o := *b.orders[i]
+	o.Result = proto.Clone(orderResult).(*pb.OrderResult)
+	o.TransactionID = transactionID
+	if err := b.write(&o); err != nil {
+		return err
+	}
+	b.orders[i] = &o
+	return nil
+}
+
+// Cancel drops an order reserved by Reserve whose card could not be charged
+// or that could not be shipped. Orders that are no longer pending are left
+// alone.
+func (b *Buffer) Cancel(orderID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if i := b.find(orderID); i >= 0 && b.orders[i].Pending() {
+		b.removeLocked(i)
+	}
+}
+
+// Get returns the buffered order with orderID, or nil.
+func (b *Buffer) Get(orderID string) *Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if i := b.find(orderID); i >= 0 {
+		return b.orders[i]
+	}
+	return nil
+}
+
+// Stats describes the buffer for metrics.
+type Stats struct {
+	Orders  int       // orders buffered
+	Oldest  time.Time // when the oldest buffered order was placed; zero if there is none
+	Saved   int64     // orders saved from the buffer
+	Dropped int64     // orders that were buffered but could not be saved
+}
+
+// Stats returns the buffer's current Stats.
+func (b *Buffer) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Stats{Orders: len(b.orders), Saved: b.saved, Dropped: b.dropped}
+	if len(b.orders) > 0 {
+		s.Oldest = b.orders[0].PlacedAt
+	}
+	return s
+}
+
+// Run runs Flush every interval until ctx is done.
+func (b *Buffer) Run(ctx context.Context, save SaveFunc, reservationTimeout time.Duration) {
+	ticker := time.NewTicker(b.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := b.Flush(ctx, save, reservationTimeout); err != nil {
+			b.log.Warnf("%d orders remain buffered: %v", b.Stats().Orders, err)
+		}
+	}
+}
+
+// Flush saves the completed orders with save, oldest first, and removes
+// those saved. It stops at the first transient failure or timeout, leaving
+// that order and the rest buffered, and returns its error. An order that
+// fails otherwise can never be saved; it is logged and dropped.
+//
+// Pending orders are skipped, unless they have been pending for longer than
+// reservationTimeout: their PlaceOrder stopped between reserving and
+// completing them, possibly after charging the card, so they are dropped as
+// the reservation sweep drops those in the database, and the order can be
+// placed again.
+func (b *Buffer) Flush(ctx context.Context, save SaveFunc, reservationTimeout time.Duration) error {
+	b.mu.Lock()
+	orders := append([]*Order(nil), b.orders...)
+	b.mu.Unlock()
+
+	saved := 0
+	defer func() {
+		if saved > 0 {
+			b.log.Infof("saved %d buffered orders", saved)
+		}
+	}()
+	for _, order := range orders {
+		if order.Pending() {
+			if time.Since(order.PlacedAt) > reservationTimeout {
+				b.log.Warnf("dropping buffered order %s of user %q, still pending since %s", order.Result.GetOrderId(), order.UserID, order.PlacedAt.Format(time.RFC3339))
+				b.remove(order, false)
+			}
+			continue
+		}
+		err := save(ctx, order)
+		if err != nil && retryable(err) {
+			return err
+		}
+		if err != nil {
+			b.log.Errorf("dropping buffered order %s of user %q: %v", order.Result.GetOrderId(), order.UserID, err)
+		} else {
+			saved++
+		}
+		b.remove(order, err == nil)
+	}
+	return nil
+}
+
+// retryable reports whether saving an order that failed with err may
+// succeed later.
+func retryable(err error) bool {
+	return database.IsTransient(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// find returns the index of the order with orderID, or -1. b.mu must be
+// held.
+func (b *Buffer) find(orderID string) int {
+	for i, o := range b.orders {
+		if o.Result.GetOrderId() == orderID {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove takes order out of the buffer, counting it as saved or dropped,
+// unless Complete replaced it meanwhile.
+func (b *Buffer) remove(order *Order, saved bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.find(order.Result.GetOrderId())
+	if i < 0 || b.orders[i] != order {
+		return
+	}
+	if saved {
+		b.saved++
+	} else {
+		b.dropped++
+	}
+	b.removeLocked(i)
+}
+
+// removeLocked takes the order at index i out of the buffer and its
+// directory. b.mu must be held.
+func (b *Buffer) removeLocked(i int) {
+	orderID := b.orders[i].Result.GetOrderId()
+	b.orders = append(b.orders[:i], b.orders[i+1:]...)
+	if err := os.Remove(b.path(orderID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		b.log.Warnf("failed to remove buffered order file: %v", err)
+	}
+}
+
+// path returns the file of the order with orderID, which is a UUID.
+func (b *Buffer) path(orderID string) string {
+	return filepath.Join(b.config.Dir, filepath.Base(orderID)+".json")
+}
+
+// write writes order to its file through a temporary file, so a crash
+// leaves either the whole order or its previous version, and syncs the
+// directory so the rename is durable.
+func (b *Buffer) write(order *Order) error {
+	if err := writeOrder(b.path(order.Result.GetOrderId()), order); err != nil {
+		return fmt.Errorf("failed to write buffered order: %w", err)
+	}
+	dir, err := os.Open(b.config.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to sync order buffer directory: %w", err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync order buffer directory: %w", err)
+	}
+	return nil
+}
+
+// writeOrder writes order to path through a temporary file.
+func writeOrder(path string, order *Order) error {
+	result, err := protojson.Marshal(order.Result)
+	if err != nil {
+		return err
+	}
+	total, err := protojson.Marshal(order.Total)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record{Result: result, Email: order.Email, UserID: order.UserID, Total: total, TransactionID: order.TransactionID, PlacedAt: order.PlacedAt})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".order-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readOrder reads an order written by writeOrder.
+func readOrder(path string) (*Order, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	order := &Order{Result: &pb.OrderResult{}, Email: r.Email, UserID: r.UserID, Total: &pb.Money{}, TransactionID: r.TransactionID, PlacedAt: r.PlacedAt}
+	if err := protojson.Unmarshal(r.Result, order.Result); err != nil {
+		return nil, fmt.Errorf("invalid order: %w", err)
+	}
+	if err := protojson.Unmarshal(r.Total, order.Total); err != nil {
+		return nil, fmt.Errorf("invalid total: %w", err)
+	}
+	return order, nil
+}
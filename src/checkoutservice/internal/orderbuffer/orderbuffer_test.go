@@ -0,0 +1,288 @@
+package orderbuffer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+func testBuffer(t *testing.T, maxOrders int) *Buffer {
+	t.Helper()
+	b, err := New(&Config{MaxOrders: maxOrders, Dir: t.TempDir(), Interval: time.Second}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testOrder(id string, placedAt time.Time) *Order {
+	return &Order{
+		Result: &pb.OrderResult{
+			OrderId: id,
+			Items:   []*pb.OrderItem{{Item: &pb.CartItem{ProductId: "PRODUCT-1", Quantity: 2}}},
+			Status:  models.StatusPending,
+		},
+		Email:    "user@example.com",
+		UserID:   "user-1",
+		Total:    &pb.Money{CurrencyCode: "USD", Units: 31, Nanos: 980000000},
+		PlacedAt: placedAt,
+	}
+}
+
+// placed reserves and completes an order in b, as PlaceOrder does.
+func placed(t *testing.T, b *Buffer, id string, placedAt time.Time) {
+	t.Helper()
+	order := testOrder(id, placedAt)
+	if err := b.Reserve(order); err != nil {
+		t.Fatalf("Reserve(%s) = %v", id, err)
+	}
+	order.Result.Status = models.StatusPaid
+	order.Result.ShippingTrackingId = "TRACK-" + id
+	if err := b.Complete(order.Result, "tx-"+id); err != nil {
+		t.Fatalf("Complete(%s) = %v", id, err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	c, err := FromEnv()
+	if err != nil || c != nil {
+		t.Errorf("FromEnv() = %+v, %v; want nil without ORDER_BUFFER_DIR", c, err)
+	}
+
+	t.Setenv("ORDER_BUFFER_DIR", "/var/lib/checkout/order-buffer")
+	if c, err = FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxOrders != 1000 || c.Dir != "/var/lib/checkout/order-buffer" || c.Interval != 5*time.Second {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+
+	t.Setenv("ORDER_BUFFER_MAX_ORDERS", "50")
+	t.Setenv("ORDER_BUFFER_FLUSH_INTERVAL", "1s")
+	if c, err = FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxOrders != 50 || c.Interval != time.Second {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+
+	t.Setenv("ORDER_BUFFER_MAX_ORDERS", "0")
+	if c, err = FromEnv(); err != nil || c != nil {
+		t.Errorf("FromEnv() = %+v, %v; want nil with buffering off", c, err)
+	}
+
+	for env, value := range map[string]string{
+		"ORDER_BUFFER_MAX_ORDERS":     "-1",
+		"ORDER_BUFFER_FLUSH_INTERVAL": "0s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("FromEnv() error = %v, want one naming %s", err, env)
+			}
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	b := testBuffer(t, 2)
+	now := time.Now()
+	for _, id := range []string{"order-1", "order-2"} {
+		if err := b.Reserve(testOrder(id, now)); err != nil {
+			t.Fatalf("Reserve(%s) = %v", id, err)
+		}
+	}
+	if err := b.Reserve(testOrder("order-1", now)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Reserve of a buffered order = %v, want ErrDuplicate", err)
+	}
+	if err := b.Reserve(testOrder("order-3", now)); !errors.Is(err, ErrFull) {
+		t.Errorf("Reserve to a full buffer = %v, want ErrFull", err)
+	}
+
+	if order := b.Get("order-2"); order == nil || !order.Pending() {
+		t.Errorf("Get(order-2) = %+v, want it pending", order)
+	}
+	if order := b.Get("order-3"); order != nil {
+		t.Errorf("Get(order-3) = %+v, want nil", order)
+	}
+	if s := b.Stats(); s.Orders != 2 || s.Dropped != 0 || !s.Oldest.Equal(now) {
+		t.Errorf("Stats() = %+v", s)
+	}
+
+	// A cancelled reservation frees its place, and is not counted as
+	// dropped since it was never charged.
+	b.Cancel("order-1")
+	if err := b.Reserve(testOrder("order-3", now)); err != nil {
+		t.Errorf("Reserve after Cancel = %v", err)
+	}
+	if s := b.Stats(); s.Orders != 2 || s.Dropped != 0 {
+		t.Errorf("Stats() after Cancel = %+v", s)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	b := testBuffer(t, 10)
+	order := testOrder("order-1", time.Now())
+	if err := b.Reserve(order); err != nil {
+		t.Fatal(err)
+	}
+
+	// The buffer keeps its own copy of the reserved order.
+	order.Result.Status = models.StatusPaid
+	order.Result.ShippingTrackingId = "TRACK-1"
+	if !b.Get("order-1").Pending() {
+		t.Fatal("Expected the buffered order to stay pending until Complete")
+	}
+	if err := b.Complete(order.Result, "tx-1"); err != nil {
+		t.Fatal(err)
+	}
+	got := b.Get("order-1")
+	if got.Pending() || got.Result.ShippingTrackingId != "TRACK-1" || got.TransactionID != "tx-1" {
+		t.Errorf("Get after Complete = %+v", got)
+	}
+
+	// A completed order can't be completed or cancelled again.
+	if err := b.Complete(order.Result, "tx-2"); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("Complete twice = %v, want ErrNotReserved", err)
+	}
+	b.Cancel("order-1")
+	if b.Get("order-1") == nil {
+		t.Error("Expected Cancel to leave a completed order buffered")
+	}
+	if err := b.Complete(&pb.OrderResult{OrderId: "order-2"}, "tx-2"); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("Complete of an unknown order = %v, want ErrNotReserved", err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	b := testBuffer(t, 10)
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		placed(t, b, fmt.Sprintf("order-%d", i), now)
+	}
+
+	// order-2 can never be saved and is dropped; order-3 hits an outage,
+	// which stops the flush.
+	var tried []string
+	err := b.Flush(context.Background(), func(ctx context.Context, order *Order) error {
+		id := order.Result.OrderId
+		tried = append(tried, id)
+		switch id {
+		case "order-2":
+			return errors.New("invalid order")
+		case "order-3":
+			return fmt.Errorf("failed to save order: %w", database.ErrUnavailable)
+		}
+		return nil
+	}, time.Minute)
+	if !errors.Is(err, database.ErrUnavailable) {
+		t.Errorf("Flush() = %v, want ErrUnavailable", err)
+	}
+	if strings.Join(tried, ",") != "order-1,order-2,order-3" {
+		t.Errorf("Flush tried %v", tried)
+	}
+	if s := b.Stats(); s.Orders != 2 || s.Saved != 1 || s.Dropped != 1 {
+		t.Errorf("Stats() after an outage = %+v", s)
+	}
+
+	if err := b.Flush(context.Background(), func(context.Context, *Order) error { return nil }, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.Stats(); s.Orders != 0 || s.Saved != 3 || !s.Oldest.IsZero() {
+		t.Errorf("Stats() after recovery = %+v", s)
+	}
+}
+
+func TestFlushSkipsPendingOrders(t *testing.T) {
+	b := testBuffer(t, 10)
+	now := time.Now()
+	if err := b.Reserve(testOrder("order-1", now)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Reserve(testOrder("order-2", now.Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	// order-1 is still being placed; order-2 was abandoned an hour ago.
+	save := func(ctx context.Context, order *Order) error {
+		t.Errorf("Flush saved pending order %s", order.Result.OrderId)
+		return nil
+	}
+	if err := b.Flush(context.Background(), save, 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if b.Get("order-1") == nil || b.Get("order-2") != nil {
+		t.Errorf("Expected only the abandoned order dropped, buffered %+v and %+v", b.Get("order-1"), b.Get("order-2"))
+	}
+	if s := b.Stats(); s.Orders != 1 || s.Dropped != 1 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestFlushKeepsOrdersOnContextErrors(t *testing.T) {
+	b := testBuffer(t, 10)
+	placed(t, b, "order-1", time.Now())
+	err := b.Flush(context.Background(), func(context.Context, *Order) error { return context.DeadlineExceeded }, time.Minute)
+	if !errors.Is(err, context.DeadlineExceeded) || b.Get("order-1") == nil {
+		t.Errorf("Flush() = %v; want the order kept", err)
+	}
+}
+
+func TestDirSurvivesRestart(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "orders")
+	config := &Config{MaxOrders: 10, Dir: dir, Interval: time.Second}
+	b, err := New(config, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	placed(t, b, "order-2", first.Add(time.Minute))
+	placed(t, b, "order-1", first)
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new Buffer loads the orders, oldest first, skipping the broken file.
+	b, err = New(config, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	err = b.Flush(context.Background(), func(ctx context.Context, order *Order) error {
+		ids = append(ids, order.Result.OrderId)
+		if order.Email != "user@example.com" || order.Total.Units != 31 || order.TransactionID != "tx-"+order.Result.OrderId ||
+			order.Result.Status != models.StatusPaid || order.Result.Items[0].Item.Quantity != 2 {
+			t.Errorf("Loaded order %+v", order)
+		}
+		return nil
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "order-1,order-2" {
+		t.Errorf("Flushed %v, want order-1,order-2", ids)
+	}
+
+	// Saved orders are removed from the directory.
+	files, _ := filepath.Glob(filepath.Join(dir, "order-*"))
+	if len(files) != 0 {
+		t.Errorf("Expected saved orders to be removed, found %v", files)
+	}
+}
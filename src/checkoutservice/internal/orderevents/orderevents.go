@@ -0,0 +1,246 @@
+// Package orderevents publishes the events in the order_events outbox, such
+// as OrderCancelled, to a Pub/Sub topic so payment and shipping can react to
+// them.
+package orderevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// publishTimeout bounds one publish request.
+	publishTimeout = 30 * time.Second
+	// lease is how long a batch of events is claimed for while it is
+	// published.
+	lease = publishTimeout + time.Minute
+)
+
+// Config holds the order event publishing settings.
+type Config struct {
+	Topic     string        // projects/P/topics/T
+	Interval  time.Duration // how often the outbox is checked
+	BatchSize int           // events sent in one publish request
+}
+
+func (c *Config) String() string {
+	if c == nil {
+		return "disabled"
+	}
+	return fmt.Sprintf("%s, interval=%v, batch=%d", c.Topic, c.Interval, c.BatchSize)
+}
+
+// FromEnv builds a Config from the environment:
+//
+//	ORDER_EVENTS_TOPIC       Pub/Sub topic, a name in PROJECT_ID or projects/P/topics/T (default none)
+//	ORDER_EVENTS_INTERVAL    how often the outbox is checked for new events (default 5s)
+//	ORDER_EVENTS_BATCH_SIZE  events sent in one publish request, at most 1000 (default 100)
+//
+// Without a topic it returns nil and events stay in the outbox.
+func FromEnv() (*Config, error) {
+	topic := os.Getenv("ORDER_EVENTS_TOPIC")
+	if topic == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(topic, "projects/") {
+		projectID := os.Getenv("PROJECT_ID")
+		if projectID == "" {
+			return nil, fmt.Errorf("ORDER_EVENTS_TOPIC (%s) needs PROJECT_ID or a projects/P/topics/T name", topic)
+		}
+		topic = fmt.Sprintf("projects/%s/topics/%s", projectID, topic)
+	}
+	if parts := strings.Split(topic, "/"); len(parts) != 4 || parts[2] != "topics" || parts[1] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("ORDER_EVENTS_TOPIC (%s) is not a topic name or projects/P/topics/T", topic)
+	}
+
+	c := &Config{Topic: topic, Interval: 5 * time.Second, BatchSize: 100}
+	if s := os.Getenv("ORDER_EVENTS_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("failed to parse ORDER_EVENTS_INTERVAL (%s) as a positive time.Duration", s)
+		}
+		c.Interval = v
+	}
+	if s := os.Getenv("ORDER_EVENTS_BATCH_SIZE"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > 1000 {
+			return nil, fmt.Errorf("ORDER_EVENTS_BATCH_SIZE (%s) must be an integer from 1 to 1000", s)
+		}
+		c.BatchSize = v
+	}
+	return c, nil
+}
+
+// Outbox holds the events waiting to be published.
+type Outbox interface {
+	PublishOrderEvents(ctx context.Context, limit int, lease time.Duration, publish func([]models.OrderEvent) error) (int, error)
+}
+
+// Publisher moves events from an Outbox to Pub/Sub. Delivery is at least
+// once: an event whose publish succeeded but could not be marked published
+// is sent again, so consumers should ignore repeated order IDs.
+type Publisher struct {
+	config *Config
+	log    *logrus.Logger
+	url    string
+
+	mu     sync.Mutex
+	client *http.Client
+}
+
+// NewPublisher returns a Publisher for config, which must not be nil.
+func NewPublisher(config *Config, log *logrus.Logger) *Publisher {
+	return &Publisher{
+		config: config,
+		log:    log,
+		url:    "https://pubsub.googleapis.com/v1/" + config.Topic + ":publish",
+	}
+}
+
+// Run publishes the outbox's events every interval until ctx is done. Events
+// that fail to publish stay in the outbox and are retried next time.
+func (p *Publisher) Run(ctx context.Context, outbox Outbox) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.Drain(ctx, outbox); err != nil {
+			p.log.Warnf("failed to publish order events: %v", err)
+		}
+	}
+}
+
+// Drain publishes batches of events until the outbox has no more.
+func (p *Publisher) Drain(ctx context.Context, outbox Outbox) error {
+	for {
+		n, err := outbox.PublishOrderEvents(ctx, p.config.BatchSize, lease, func(events []models.OrderEvent) error {
+			return p.publish(ctx, events)
+		})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			p.log.Infof("published %d order events to %s", n, p.config.Topic)
+		}
+		if n < p.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+type pubsubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// publish sends events to the topic in one request, within publishTimeout.
+// Placed and shipped events are only delivered by webhooks and skipped.
+// Events of an unknown type are logged and skipped so they don't hold up the
+// rest.
+func (p *Publisher) publish(ctx context.Context, events []models.OrderEvent) error {
+	var messages []pubsubMessage
+	for _, e := range events {
+		if e.Type == models.EventOrderPlaced || e.Type == models.EventOrderShipped {
+			continue
+		}
+		msg, err := message(e)
+		if err != nil {
+			p.log.Errorf("skipping order event %d: %v", e.ID, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]any{"messages": messages})
+	if err != nil {
+		return fmt.Errorf("failed to marshal publish request: %v", err)
+	}
+	client, err := p.httpClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Pub/Sub: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Pub/Sub returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// httpClient returns a client authorized with the application default
+// credentials, creating it on first use.
+func (p *Publisher) httpClient() (*http.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
+	client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/pubsub")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find credentials for Pub/Sub: %v", err)
+	}
+	p.client = client
+	return client, nil
+}
+
+// message encodes an event as a Pub/Sub message whose data is the event's
+// protobuf message in JSON.
+func message(e models.OrderEvent) (pubsubMessage, error) {
+	switch e.Type {
+	case models.EventOrderCancelled:
+		data, err := protojson.Marshal(&pb.OrderCancelled{
+			OrderId:        e.Order.OrderID,
+			UserId:         e.Order.UserID,
+			PreviousStatus: e.FromStatus,
+			Reason:         e.Reason,
+			Total: &pb.Money{
+				CurrencyCode: e.Order.TotalAmountCurrency,
+				Units:        e.Order.TotalAmountUnits,
+				Nanos:        e.Order.TotalAmountNanos,
+			},
+			ShippingTrackingId: e.Order.ShippingTrackingID,
+			CancelTime:         timestamppb.New(e.CreatedAt),
+		})
+		if err != nil {
+			return pubsubMessage{}, err
+		}
+		return pubsubMessage{
+			Data:       data,
+			Attributes: map[string]string{"event_type": e.Type, "order_id": e.Order.OrderID},
+		}, nil
+	default:
+		return pubsubMessage{}, fmt.Errorf("unknown event type %q", e.Type)
+	}
+}
@@ -0,0 +1,178 @@
+package orderevents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("ORDER_EVENTS_TOPIC", "")
+	if c, err := FromEnv(); c != nil || err != nil {
+		t.Errorf("FromEnv() = %v, %v; want nil, nil", c, err)
+	}
+
+	t.Setenv("ORDER_EVENTS_TOPIC", "order-events")
+	t.Setenv("PROJECT_ID", "shop")
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Topic != "projects/shop/topics/order-events" || c.Interval != 5*time.Second || c.BatchSize != 100 {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+
+	t.Setenv("ORDER_EVENTS_TOPIC", "projects/other/topics/orders")
+	t.Setenv("ORDER_EVENTS_INTERVAL", "1s")
+	t.Setenv("ORDER_EVENTS_BATCH_SIZE", "10")
+	if c, err = FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Topic != "projects/other/topics/orders" || c.Interval != time.Second || c.BatchSize != 10 {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+
+	for env, value := range map[string]string{
+		"ORDER_EVENTS_TOPIC":      "projects/other/subscriptions/orders",
+		"ORDER_EVENTS_INTERVAL":   "0s",
+		"ORDER_EVENTS_BATCH_SIZE": "1001",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("FromEnv() error = %v, want one naming %s", err, env)
+			}
+		})
+	}
+
+	t.Setenv("ORDER_EVENTS_TOPIC", "order-events")
+	t.Setenv("PROJECT_ID", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("Expected an error for a topic name without PROJECT_ID")
+	}
+}
+
+// fakeOutbox hands out its events in batches like the database outbox.
+type fakeOutbox struct {
+	events    []models.OrderEvent
+	published []models.OrderEvent
+}
+
+func (f *fakeOutbox) PublishOrderEvents(ctx context.Context, limit int, lease time.Duration, publish func([]models.OrderEvent) error) (int, error) {
+	batch := f.events[:min(limit, len(f.events))]
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+	f.published = append(f.published, batch...)
+	f.events = f.events[len(batch):]
+	return len(batch), nil
+}
+
+func cancelled(orderID string) models.OrderEvent {
+	return models.OrderEvent{
+		Type:       models.EventOrderCancelled,
+		FromStatus: models.StatusPaid,
+		Reason:     "changed my mind",
+		CreatedAt:  time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC),
+		Order: models.Order{
+			OrderID: orderID, UserID: "user-1", TotalAmountCurrency: "USD", TotalAmountUnits: 41,
+			TotalAmountNanos: 970000000, ShippingTrackingID: "TRACK-1", Status: models.StatusCancelled,
+		},
+	}
+}
+
+func testPublisher(t *testing.T, handler http.HandlerFunc) *Publisher {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p := NewPublisher(&Config{Topic: "projects/shop/topics/orders", Interval: time.Second, BatchSize: 2}, logger)
+	p.url = srv.URL
+	p.client = srv.Client()
+	return p
+}
+
+func TestDrain(t *testing.T) {
+	var requests [][]pubsubMessage
+	p := testPublisher(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Messages []pubsubMessage }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		requests = append(requests, req.Messages)
+		w.Write([]byte(`{"messageIds": []}`))
+	})
+
+	outbox := &fakeOutbox{events: []models.OrderEvent{
+		cancelled("order-1"), cancelled("order-2"), {Type: "order_lost"}, {Type: models.EventOrderPlaced}, cancelled("order-3"),
+	}}
+	if err := p.Drain(context.Background(), outbox); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outbox.events) != 0 || len(outbox.published) != 5 {
+		t.Errorf("Expected every event to leave the outbox, %d left", len(outbox.events))
+	}
+	// The placed event and the one of an unknown type are skipped.
+	if len(requests) != 2 || len(requests[0]) != 2 || len(requests[1]) != 1 {
+		t.Fatalf("Expected publish requests of 2 and 1 messages, got %v", requests)
+	}
+	msg := requests[0][0]
+	if msg.Attributes["event_type"] != models.EventOrderCancelled || msg.Attributes["order_id"] != "order-1" {
+		t.Errorf("Unexpected attributes %v", msg.Attributes)
+	}
+	var event pb.OrderCancelled
+	if err := protojson.Unmarshal(msg.Data, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.OrderId != "order-1" || event.UserId != "user-1" || event.PreviousStatus != models.StatusPaid ||
+		event.Reason != "changed my mind" || event.Total.GetUnits() != 41 || event.ShippingTrackingId != "TRACK-1" ||
+		!event.CancelTime.AsTime().Equal(time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected event %v", &event)
+	}
+}
+
+func TestDrainKeepsEventsWhenPublishFails(t *testing.T) {
+	p := testPublisher(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	outbox := &fakeOutbox{events: []models.OrderEvent{cancelled("order-1")}}
+	err := p.Drain(context.Background(), outbox)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected a 503 error, got %v", err)
+	}
+	if len(outbox.events) != 1 {
+		t.Errorf("Expected the event to stay in the outbox")
+	}
+}
+
+func TestDrainReportsOutboxErrors(t *testing.T) {
+	p := testPublisher(t, func(w http.ResponseWriter, r *http.Request) {})
+	want := errors.New("database down")
+	err := p.Drain(context.Background(), failingOutbox{want})
+	if !errors.Is(err, want) {
+		t.Errorf("Expected %v, got %v", want, err)
+	}
+}
+
+type failingOutbox struct{ err error }
+
+func (f failingOutbox) PublishOrderEvents(context.Context, int, time.Duration, func([]models.OrderEvent) error) (int, error) {
+	return 0, f.err
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/google/uuid"
+)
+
+// AddAddress saves address to the user's address book. With isDefault, or
+// as the user's first address, it becomes the default. The error wraps
+// models.ErrInvalidAddress for an address without a street address, city or
+// country.
+func (os *OrderService) AddAddress(ctx context.Context, userID string, address *pb.Address, isDefault bool) (*models.SavedAddress, error) {
+	for _, field := range []struct{ name, value string }{
+		{"street address", address.GetStreetAddress()},
+		{"city", address.GetCity()},
+		{"country", address.GetCountry()},
+	} {
+		if strings.TrimSpace(field.value) == "" {
+			return nil, fmt.Errorf("%w: %s is required", models.ErrInvalidAddress, field.name)
+		}
+	}
+
+	addr := models.NewSavedAddressFromProto(uuid.NewString(), userID, address, isDefault)
+	if err := os.db.AddAddress(ctx, addr); err != nil {
+		return nil, fmt.Errorf("failed to add address: %w", err)
+	}
+
+	os.log.Infof("address %s added for user %s", addr.AddressID, userID)
+	return addr, nil
+}
+
+// ListAddresses returns the user's saved addresses, the default first and
+// then newest first.
+func (os *OrderService) ListAddresses(ctx context.Context, userID string) ([]models.SavedAddress, error) {
+	addrs, err := os.db.ListAddresses(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %w", err)
+	}
+	return addrs, nil
+}
+
+// GetAddress returns one of the user's saved addresses. The error wraps
+// database.ErrAddressNotFound for an unknown address or one of another user.
+func (os *OrderService) GetAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error) {
+	addr, err := os.db.GetAddress(ctx, userID, addressID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address: %w", err)
+	}
+	return addr, nil
+}
+
+// DeleteAddress deletes one of the user's saved addresses. If it was the
+// default, the newest remaining address becomes the default. Orders shipped
+// to it keep their shipping address but lose the link to it. The error wraps
+// database.ErrAddressNotFound for an unknown address or one of another user.
+func (os *OrderService) DeleteAddress(ctx context.Context, userID, addressID string) error {
+	if err := os.db.DeleteAddress(ctx, userID, addressID); err != nil {
+		return fmt.Errorf("failed to delete address: %w", err)
+	}
+
+	os.log.Infof("address %s of user %s deleted", addressID, userID)
+	return nil
+}
+
+// SetDefaultAddress makes one of the user's saved addresses the default. The
+// error wraps database.ErrAddressNotFound for an unknown address or one of
+// another user.
+func (os *OrderService) SetDefaultAddress(ctx context.Context, userID, addressID string) (*models.SavedAddress, error) {
+	addr, err := os.db.SetDefaultAddress(ctx, userID, addressID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set default address: %w", err)
+	}
+
+	os.log.Infof("address %s is now the default of user %s", addressID, userID)
+	return addr, nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+func TestOrderService_Addresses(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	home, err := orderService.AddAddress(ctx, "user-1", &pb.Address{StreetAddress: "1 Main St", City: "Springfield", Country: "US"}, false)
+	if err != nil {
+		t.Fatalf("Failed to add address: %v", err)
+	}
+	if home.AddressID == "" || !home.IsDefault {
+		t.Errorf("Expected the first address to be the default, got %+v", home)
+	}
+	work, err := orderService.AddAddress(ctx, "user-1", &pb.Address{StreetAddress: "2 Side St", City: "Springfield", Country: "US"}, true)
+	if err != nil {
+		t.Fatalf("Failed to add address: %v", err)
+	}
+
+	addrs, err := orderService.ListAddresses(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to list addresses: %v", err)
+	}
+	if len(addrs) != 2 || addrs[0].AddressID != work.AddressID || addrs[1].IsDefault {
+		t.Errorf("Expected the new default first, got %+v", addrs)
+	}
+
+	if _, err := orderService.SetDefaultAddress(ctx, "user-1", home.AddressID); err != nil {
+		t.Fatalf("Failed to set default address: %v", err)
+	}
+	if err := orderService.DeleteAddress(ctx, "user-1", home.AddressID); err != nil {
+		t.Fatalf("Failed to delete address: %v", err)
+	}
+	if got, err := orderService.GetAddress(ctx, "user-1", work.AddressID); err != nil || !got.IsDefault {
+		t.Errorf("Expected the remaining address to become the default, got %+v, %v", got, err)
+	}
+
+	if _, err := orderService.GetAddress(ctx, "user-2", work.AddressID); !errors.Is(err, database.ErrAddressNotFound) {
+		t.Errorf("Expected ErrAddressNotFound for another user's address, got %v", err)
+	}
+	if err := orderService.DeleteAddress(ctx, "user-1", home.AddressID); !errors.Is(err, database.ErrAddressNotFound) {
+		t.Errorf("Expected ErrAddressNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestOrderService_AddAddress_Invalid(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	for _, address := range []*pb.Address{
+		nil,
+		{City: "Springfield", Country: "US"},
+		{StreetAddress: "1 Main St", Country: "US"},
+		{StreetAddress: "1 Main St", City: "Springfield", Country: " "},
+	} {
+		if _, err := orderService.AddAddress(context.Background(), "user-1", address, false); !errors.Is(err, models.ErrInvalidAddress) {
+			t.Errorf("AddAddress(%v) = %v, want ErrInvalidAddress", address, err)
+		}
+	}
+}
+
+func TestOrderService_SaveOrder_AddressLink(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	addr, err := orderService.AddAddress(ctx, userID, orderResult.ShippingAddress, false)
+	if err != nil {
+		t.Fatalf("Failed to add address: %v", err)
+	}
+	orderResult.AddressId = addr.AddressID
+	if err := placeOrder(ctx, orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	order, _, err := orderService.GetOrderDetails(ctx, orderResult.OrderId)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if order.AddressID != addr.AddressID || order.ToProto(nil).GetAddressId() != addr.AddressID {
+		t.Errorf("Expected the order to link to address %s, got %q", addr.AddressID, order.AddressID)
+	}
+}
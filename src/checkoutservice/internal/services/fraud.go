@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+)
+
+// RecentOrderCount counts, up to limit, the orders placed since a time by
+// the user or, for a guest without a user ID, with the email. It implements
+// fraud.History.
+func (os *OrderService) RecentOrderCount(ctx context.Context, userID, email string, since time.Time, limit int) (int, error) {
+	dates := database.DateRange{From: since}
+	if userID != "" {
+		orders, err := os.db.GetOrdersPage(ctx, userID, dates, nil, limit)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count recent orders: %w", err)
+		}
+		return len(orders), nil
+	}
+	orders, err := os.db.SearchOrders(ctx, database.OrderSearch{Email: email, Dates: dates}, nil, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recent orders: %w", err)
+	}
+	return len(orders), nil
+}
+
+// DefaultCountry returns the country of the user's default saved address,
+// or "" if they have none. It implements fraud.History.
+func (os *OrderService) DefaultCountry(ctx context.Context, userID string) (string, error) {
+	addrs, err := os.ListAddresses(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if addr.IsDefault {
+			return addr.Country, nil
+		}
+	}
+	return "", nil
+}
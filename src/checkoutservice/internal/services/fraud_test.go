@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+func TestOrderService_RecentOrderCount(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	for i, o := range []struct{ id, userID, email string }{
+		{"order-old", "user-1", "a@example.com"},
+		{"order-1", "user-1", "a@example.com"},
+		{"order-2", "user-1", "a@example.com"},
+		{"order-guest", "", "A@example.com"},
+	} {
+		date := now.Add(-time.Duration(3-i) * time.Minute)
+		if i == 0 {
+			date = now.Add(-2 * time.Hour)
+		}
+		order := &models.Order{OrderID: o.id, UserID: o.userID, Email: o.email, TotalAmountCurrency: "USD", OrderDate: date, Status: models.StatusPaid}
+		if err := mockDB.SaveOrder(ctx, order, nil); err != nil {
+			t.Fatalf("Failed to save order %s: %v", o.id, err)
+		}
+	}
+
+	since := now.Add(-time.Hour)
+	if n, err := orderService.RecentOrderCount(ctx, "user-1", "", since, 10); err != nil || n != 2 {
+		t.Errorf("RecentOrderCount(user-1) = %d, %v; want 2", n, err)
+	}
+	if n, _ := orderService.RecentOrderCount(ctx, "user-1", "", since, 1); n != 1 {
+		t.Errorf("Expected the count to stop at the limit, got %d", n)
+	}
+	if n, err := orderService.RecentOrderCount(ctx, "", "a@example.com", since, 10); err != nil || n != 3 {
+		t.Errorf("RecentOrderCount(guest) = %d, %v; want 3", n, err)
+	}
+
+	mockDB.SetShouldError(true)
+	if _, err := orderService.RecentOrderCount(ctx, "user-1", "", since, 10); err == nil {
+		t.Error("Expected an error from the database")
+	}
+}
+
+func TestOrderService_DefaultCountry(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	if country, err := orderService.DefaultCountry(ctx, "user-1"); err != nil || country != "" {
+		t.Errorf("DefaultCountry() = %q, %v; want none without addresses", country, err)
+	}
+	if _, err := orderService.AddAddress(ctx, "user-1", &pb.Address{StreetAddress: "1 Main St", City: "Berlin", Country: "Germany"}, true); err != nil {
+		t.Fatalf("Failed to add address: %v", err)
+	}
+	if _, err := orderService.AddAddress(ctx, "user-1", &pb.Address{StreetAddress: "2 Rue", City: "Paris", Country: "France"}, false); err != nil {
+		t.Fatalf("Failed to add address: %v", err)
+	}
+	if country, err := orderService.DefaultCountry(ctx, "user-1"); err != nil || country != "Germany" {
+		t.Errorf("DefaultCountry() = %q, %v; want Germany", country, err)
+	}
+}
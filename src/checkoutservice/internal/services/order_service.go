@@ -1,13 +1,47 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/money"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// DefaultOrderPageSize is the page size of GetUserOrderHistoryPage when
+	// none is requested.
+	DefaultOrderPageSize = 20
+	// MaxOrderPageSize caps the page size of GetUserOrderHistoryPage.
+	MaxOrderPageSize = 100
+	// DefaultTopProducts is the number of top products GetUserOrderStats
+	// returns when none is requested.
+	DefaultTopProducts = 5
+	// MaxTopProducts caps the top products of GetUserOrderStats.
+	MaxTopProducts = 20
 )
 
+// ErrInvalidDateRange is returned by GetUserOrderHistoryPage for a date range
+// that ends before it starts.
+var ErrInvalidDateRange = errors.New("invalid date range: end is before start")
+
+// ErrInvalidPageToken is returned for a page token that was not produced by
+// GetUserOrderHistoryPage.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// ErrTotalMismatch is returned by ValidateOrder and ReserveOrder for an
+// order whose total is not its items less the discount plus shipping and tax,
+// or whose tax is not the sum of its breakdown.
+var ErrTotalMismatch = errors.New("order total does not match its items, discount, shipping and tax")
+
 // OrderService handles order-related business logic
 type OrderService struct {
 	db  database.DatabaseInterface
@@ -22,40 +56,430 @@ func NewOrderService(db database.DatabaseInterface, log *logrus.Logger) *OrderSe
 	}
 }
 
-// SaveOrder saves an order to the database
-func (os *OrderService) SaveOrder(orderResult *pb.OrderResult, email, userID string, total *pb.Money) error {
-	// Convert protobuf to internal models
+// ValidateOrder returns an error wrapping ErrTotalMismatch or
+// models.ErrCurrencyMismatch unless the items, discount, shipping and tax of
+// an order are priced in the currency of its total and add up to it. It is
+// checked before the card is charged.
+func ValidateOrder(orderResult *pb.OrderResult, email, userID string, total *pb.Money) error {
+	_, err := checkOrder(models.NewOrderFromProto(orderResult, email, userID, total), orderResult)
+	return err
+}
+
+// ReserveOrder saves an order as pending before its card is charged, so
+// that a retry of it finds it on the primary. It returns an error wrapping
+// database.ErrDuplicateOrder if the order is already saved, and
+// ErrTotalMismatch or models.ErrCurrencyMismatch for an order that doesn't
+// add up. CompleteOrder completes the order, CancelPendingOrder drops it.
+func (os *OrderService) ReserveOrder(ctx context.Context, orderResult *pb.OrderResult, email, userID string, total *pb.Money) error {
 	order := models.NewOrderFromProto(orderResult, email, userID, total)
-	items := models.NewOrderItemsFromProto(orderResult.OrderId, orderResult.Items)
+	order.Status = models.StatusPending
+	items, err := checkOrder(order, orderResult)
+	if err != nil {
+		return err
+	}
+	if err := os.db.SaveOrder(ctx, order, items); err != nil {
+		return fmt.Errorf("failed to reserve order: %w", err)
+	}
+	os.log.Infof("order %s reserved", order.OrderID)
+	return nil
+}
+
+// CompleteOrder moves an order saved by ReserveOrder to the status of
+// orderResult with its shipping tracking ID, and queues its confirmation
+// email to email. An order under review is held with transactionID, the
+// payment that authorized its total, until ReleaseOrder. A nil error means
+// the email is queued.
+func (os *OrderService) CompleteOrder(ctx context.Context, orderResult *pb.OrderResult, email, transactionID string) error {
+	status, err := os.completeOrder(ctx, orderResult, transactionID)
+	if err != nil {
+		return err
+	}
+	confirmation, err := protojson.Marshal(orderResult)
+	if err != nil {
+		return fmt.Errorf("failed to encode order confirmation: %w", err)
+	}
+	if err := os.db.EnqueueConfirmation(ctx, orderResult.GetOrderId(), email, confirmation); err != nil {
+		return fmt.Errorf("failed to queue order confirmation: %w", err)
+	}
+	os.log.Infof("order %s saved as %s", orderResult.GetOrderId(), status)
+	return nil
+}
+
+// completeOrder moves a pending order to the status of orderResult, held
+// with transactionID if it is under review, and returns the status.
+func (os *OrderService) completeOrder(ctx context.Context, orderResult *pb.OrderResult, transactionID string) (string, error) {
+	status := orderResult.GetStatus()
+	if status == "" {
+		status = models.StatusPaid
+	}
+	var hold *models.OrderHold
+	if status == models.StatusUnderReview {
+		hold = &models.OrderHold{OrderID: orderResult.GetOrderId(), TransactionID: transactionID, Address: orderResult.GetShippingAddress()}
+	}
+	if _, err := os.db.CompleteOrder(ctx, orderResult.GetOrderId(), status, orderResult.GetShippingTrackingId(), hold); err != nil {
+		return "", fmt.Errorf("failed to complete order: %w", err)
+	}
+	return status, nil
+}
+
+// SaveBufferedOrder saves an order placed at placedAt that was held in the
+// order buffer while the database was unavailable, reserving and completing
+// it as PlaceOrder would have. Its confirmation email was sent when it was
+// placed, so none is queued. An order already reserved, by an earlier
+// attempt or by a ReserveOrder whose commit was not acknowledged, is
+// completed.
+func (os *OrderService) SaveBufferedOrder(ctx context.Context, orderResult *pb.OrderResult, email, userID string, total *pb.Money, transactionID string, placedAt time.Time) error {
+	order := models.NewOrderFromProto(orderResult, email, userID, total)
+	order.Status = models.StatusPending
+	order.OrderDate = placedAt
+	items, err := checkOrder(order, orderResult)
+	if err != nil {
+		return err
+	}
+	// The order is dated when it was placed, so the reservation sweep may
+	// drop it before it is completed; it is then saved again, once.
+	for attempt := 1; ; attempt++ {
+		if err := os.db.SaveOrder(ctx, order, items); err != nil && !errors.Is(err, database.ErrDuplicateOrder) {
+			return fmt.Errorf("failed to save buffered order: %w", err)
+		}
+		status, err := os.completeOrder(ctx, orderResult, transactionID)
+		if errors.Is(err, database.ErrOrderNotFound) && attempt == 1 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		os.log.Infof("buffered order %s saved as %s", order.OrderID, status)
+		return nil
+	}
+}
+
+// TakeOrderHold takes the hold of an order under review, with the items to
+// ship, so that only the caller releases it. Until ReleaseOrder succeeds,
+// a failed release is undone with PutOrderHold. The error wraps
+// database.ErrNoOrderHold if the order is not held.
+func (os *OrderService) TakeOrderHold(ctx context.Context, orderID string) (*models.OrderHold, []models.OrderItem, error) {
+	hold, err := os.db.TakeOrderHold(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to take order hold: %w", err)
+	}
+	items, err := os.db.GetOrderItems(ctx, orderID)
+	if err != nil {
+		os.PutOrderHold(ctx, hold)
+		return nil, nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	return hold, items, nil
+}
+
+// PutOrderHold puts back a hold taken by TakeOrderHold whose release failed.
+// The failure is logged, since the caller is already handling another.
+func (os *OrderService) PutOrderHold(ctx context.Context, hold *models.OrderHold) {
+	if err := os.db.PutOrderHold(ctx, hold); err != nil {
+		os.log.Errorf("failed to restore the hold of order %s, transaction %s: %v", hold.OrderID, hold.TransactionID, err)
+	}
+}
+
+// ReleaseOrder marks an order whose hold was taken paid once its payment is
+// captured and it has shipped with trackingID.
+func (os *OrderService) ReleaseOrder(ctx context.Context, orderID, trackingID, reason string) (*models.Order, error) {
+	order, err := os.db.ReleaseOrder(ctx, orderID, trackingID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release order: %w", err)
+	}
+	os.log.Infof("order %s approved and shipped", orderID)
+	return order, nil
+}
+
+// CancelPendingOrder drops an order saved by ReserveOrder whose card could
+// not be charged or that could not be shipped, so that it can be placed
+// again. Orders that are no longer pending are left alone.
+func (os *OrderService) CancelPendingOrder(ctx context.Context, orderID string) error {
+	if err := os.db.DeletePendingOrder(ctx, orderID); err != nil {
+		return fmt.Errorf("failed to drop pending order: %w", err)
+	}
+	return nil
+}
+
+// DropStaleReservations drops the orders saved by ReserveOrder that are
+// still pending after timeout, so that the order can be placed again, and
+// returns how many it dropped. Their PlaceOrder stopped between reserving
+// and completing them, possibly after charging the card; the payment service
+// charges an order ID once, so placing the order again doesn't charge twice.
+func (os *OrderService) DropStaleReservations(ctx context.Context, timeout time.Duration) (int, error) {
+	orders, err := os.db.DeleteStalePendingOrders(ctx, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to drop stale reservations: %w", err)
+	}
+	for _, order := range orders {
+		os.log.Warnf("dropped order %s of user %q, still pending since %s", order.OrderID, order.UserID, order.OrderDate.Format(time.RFC3339))
+	}
+	return len(orders), nil
+}
+
+// SweepReservations runs DropStaleReservations every interval until ctx is
+// done.
+func (os *OrderService) SweepReservations(ctx context.Context, timeout, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := os.DropStaleReservations(ctx, timeout); err != nil {
+			os.log.Warnf("%v", err)
+		}
+	}
+}
+
+// GetPlacedOrder is GetOrderDetails read from the primary, for checking
+// whether an order was already placed without replica lag hiding it.
+func (os *OrderService) GetPlacedOrder(ctx context.Context, orderID string) (*models.Order, []models.OrderItem, error) {
+	order, items, err := os.db.GetPlacedOrder(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return order, items, nil
+}
+
+// checkOrder returns the items of orderResult, priced in the currency of
+// order, unless the shipping, discount and tax are priced in another
+// currency or the total doesn't add up.
+func checkOrder(order *models.Order, orderResult *pb.OrderResult) ([]models.OrderItem, error) {
+	if shipping := orderResult.GetShippingCost(); shipping != nil && shipping.GetCurrencyCode() != order.TotalAmountCurrency {
+		return nil, fmt.Errorf("%w: shipping is priced in %q, the order total in %q",
+			models.ErrCurrencyMismatch, shipping.GetCurrencyCode(), order.TotalAmountCurrency)
+	}
+	if order.DiscountAmountCurrency != order.TotalAmountCurrency {
+		return nil, fmt.Errorf("%w: the discount is in %q, the order total in %q",
+			models.ErrCurrencyMismatch, order.DiscountAmountCurrency, order.TotalAmountCurrency)
+	}
+	if order.TaxAmountCurrency != order.TotalAmountCurrency {
+		return nil, fmt.Errorf("%w: the tax is in %q, the order total in %q",
+			models.ErrCurrencyMismatch, order.TaxAmountCurrency, order.TotalAmountCurrency)
+	}
+	items, err := models.NewOrderItemsFromProto(orderResult.OrderId, order.TotalAmountCurrency, orderResult.Items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert order items: %w", err)
+	}
+	if err := checkTotal(order, items, orderResult.GetShippingCost()); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
 
-	// Save to database
-	if err := os.db.SaveOrder(order, items); err != nil {
-		return fmt.Errorf("failed to save order to database: %v", err)
+// checkTotal sets the subtotal of order to the sum of its items' totals and
+// returns ErrTotalMismatch unless its total is the subtotal less the discount
+// plus shipping, which may be nil for none, and tax. The discount may not
+// exceed the subtotal, and the tax must be the sum of its breakdown.
+func checkTotal(order *models.Order, items []models.OrderItem, shipping *pb.Money) error {
+	subtotal := &pb.Money{CurrencyCode: order.TotalAmountCurrency}
+	for _, item := range items {
+		var err error
+		subtotal, err = money.Sum(subtotal, &pb.Money{CurrencyCode: item.TotalPriceCurrency, Units: item.TotalPriceUnits, Nanos: item.TotalPriceNanos})
+		if err != nil {
+			return fmt.Errorf("%w: failed to add up the items: %v", ErrTotalMismatch, err)
+		}
 	}
+	order.SubtotalAmountCurrency, order.SubtotalAmountUnits, order.SubtotalAmountNanos = subtotal.CurrencyCode, subtotal.Units, subtotal.Nanos
 
-	os.log.Infof("order %s saved to database successfully", order.OrderID)
+	discount := &pb.Money{CurrencyCode: order.DiscountAmountCurrency, Units: order.DiscountAmountUnits, Nanos: order.DiscountAmountNanos}
+	if err := money.Validate(discount); err != nil || money.IsNegative(discount) {
+		return fmt.Errorf("%w: order %s has an invalid discount %d.%09d", ErrTotalMismatch, order.OrderID, discount.Units, discount.Nanos)
+	}
+	if cmp, err := money.Compare(discount, subtotal); err != nil || cmp > 0 {
+		return fmt.Errorf("%w: order %s has a discount of %d.%09d on items worth %d.%09d",
+			ErrTotalMismatch, order.OrderID, discount.Units, discount.Nanos, subtotal.Units, subtotal.Nanos)
+	}
+	tax := &pb.Money{CurrencyCode: order.TaxAmountCurrency, Units: order.TaxAmountUnits, Nanos: order.TaxAmountNanos}
+	if err := checkTax(order, tax); err != nil {
+		return err
+	}
+
+	want, err := money.Sum(subtotal, money.Negate(discount))
+	if err == nil && shipping != nil {
+		want, err = money.Sum(want, &pb.Money{CurrencyCode: order.TotalAmountCurrency, Units: shipping.GetUnits(), Nanos: shipping.GetNanos()})
+	}
+	if err == nil {
+		want, err = money.Sum(want, tax)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to add up the order: %v", ErrTotalMismatch, err)
+	}
+	got := &pb.Money{CurrencyCode: order.TotalAmountCurrency, Units: order.TotalAmountUnits, Nanos: order.TotalAmountNanos}
+	if cmp, err := money.Compare(got, want); err != nil || cmp != 0 {
+		return fmt.Errorf("%w: order %s has total %d.%09d %s, items, discount, shipping and tax add up to %d.%09d",
+			ErrTotalMismatch, order.OrderID, got.Units, got.Nanos, got.CurrencyCode, want.Units, want.Nanos)
+	}
 	return nil
 }
 
-// GetUserOrderHistory retrieves order history for a user
-func (os *OrderService) GetUserOrderHistory(userID string) ([]models.Order, error) {
-	orders, err := os.db.GetOrdersByUser(userID)
+// checkTax returns ErrTotalMismatch unless tax, the tax of order, is a valid,
+// non-negative amount and the sum of the order's tax breakdown.
+func checkTax(order *models.Order, tax *pb.Money) error {
+	if err := money.Validate(tax); err != nil || money.IsNegative(tax) {
+		return fmt.Errorf("%w: order %s has an invalid tax %d.%09d", ErrTotalMismatch, order.OrderID, tax.Units, tax.Nanos)
+	}
+	lines := &pb.Money{CurrencyCode: tax.CurrencyCode}
+	for _, line := range order.TaxBreakdown {
+		var err error
+		if lines, err = money.Sum(lines, &pb.Money{CurrencyCode: line.Currency, Units: line.Units, Nanos: line.Nanos}); err != nil {
+			return fmt.Errorf("%w: invalid tax of %s: %v", ErrTotalMismatch, line.Jurisdiction, err)
+		}
+	}
+	if cmp, err := money.Compare(tax, lines); err != nil || cmp != 0 {
+		return fmt.Errorf("%w: order %s has tax %d.%09d, its breakdown adds up to %d.%09d",
+			ErrTotalMismatch, order.OrderID, tax.Units, tax.Nanos, lines.Units, lines.Nanos)
+	}
+	return nil
+}
+
+// GetUserOrderHistory retrieves order history for a user. truncated reports
+// whether the history exceeded database.MaxOrdersPerUser and older orders were
+// left out. GetUserOrderHistoryPage loads the history a page at a time.
+func (os *OrderService) GetUserOrderHistory(ctx context.Context, userID string) ([]models.Order, bool, error) {
+	orders, truncated, err := os.db.GetOrdersByUser(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user order history: %v", err)
+		return nil, false, fmt.Errorf("failed to get user order history: %w", err)
+	}
+	if truncated {
+		os.log.Warnf("order history for user %s truncated to %d orders", userID, len(orders))
+	}
+
+	return orders, truncated, nil
+}
+
+// GetUserOrderHistoryPage retrieves one page of a user's orders placed within
+// dates, newest first. pageToken is empty for the first page and otherwise the token
+// returned with the previous page; the returned token is empty on the last
+// page. A pageSize of 0 or less means DefaultOrderPageSize and larger sizes
+// are capped at MaxOrderPageSize.
+func (os *OrderService) GetUserOrderHistoryPage(ctx context.Context, userID string, dates database.DateRange, pageToken string, pageSize int) ([]models.Order, string, error) {
+	if !dates.From.IsZero() && !dates.To.IsZero() && dates.To.Before(dates.From) {
+		return nil, "", ErrInvalidDateRange
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultOrderPageSize
 	}
+	pageSize = min(pageSize, MaxOrderPageSize)
 
-	return orders, nil
+	var after *database.OrderCursor
+	if pageToken != "" {
+		c, err := decodePageToken(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+
+	// Fetch one extra order to learn whether there is another page.
+	orders, err := os.db.GetOrdersPage(ctx, userID, dates, after, pageSize+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user order history: %w", err)
+	}
+	if len(orders) <= pageSize {
+		return orders, "", nil
+	}
+	orders = orders[:pageSize]
+	last := orders[pageSize-1]
+	return orders, encodePageToken(database.OrderCursor{OrderDate: last.OrderDate, OrderID: last.OrderID}), nil
 }
 
-// GetOrderDetails retrieves full order details including items
-func (os *OrderService) GetOrderDetails(orderID string) (*models.Order, []models.OrderItem, error) {
-	// Get order items
-	items, err := os.db.GetOrderItems(orderID)
+// GetUserOrderStats summarizes a user's orders with up to topProducts of the
+// products they ordered most. A topProducts of 0 or less means
+// DefaultTopProducts and larger counts are capped at MaxTopProducts.
+func (os *OrderService) GetUserOrderStats(ctx context.Context, userID string, topProducts int) (*models.UserOrderStats, error) {
+	if topProducts <= 0 {
+		topProducts = DefaultTopProducts
+	}
+	topProducts = min(topProducts, MaxTopProducts)
+
+	stats, err := os.db.GetUserOrderStats(ctx, userID, topProducts)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get order items: %v", err)
+		return nil, fmt.Errorf("failed to get user order stats: %w", err)
 	}
+	return stats, nil
+}
 
-	// In a real implementation, you'd also fetch the order details
-	// For now, returning nil order but valid items
-	return nil, items, nil
-} 
\ No newline at end of file
+// encodePageToken turns a cursor into an opaque page token.
+func encodePageToken(c database.OrderCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.OrderDate.UTC().Format(time.RFC3339Nano) + "|" + c.OrderID))
+}
+
+// decodePageToken parses a token made by encodePageToken.
+func decodePageToken(token string) (database.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return database.OrderCursor{}, ErrInvalidPageToken
+	}
+	date, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return database.OrderCursor{}, ErrInvalidPageToken
+	}
+	t, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return database.OrderCursor{}, ErrInvalidPageToken
+	}
+	return database.OrderCursor{OrderDate: t, OrderID: id}, nil
+}
+
+// GetOrderDetails retrieves full order details including items. It returns an
+// error wrapping database.ErrOrderNotFound for an unknown order.
+func (os *OrderService) GetOrderDetails(ctx context.Context, orderID string) (*models.Order, []models.OrderItem, error) {
+	order, err := os.db.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	items, err := os.db.GetOrderItems(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	return order, items, nil
+}
+
+// GetOrderDetailsByTrackingID retrieves the full details of the order shipped
+// with a tracking ID. It returns an error wrapping database.ErrOrderNotFound if
+// no order has the tracking ID.
+func (os *OrderService) GetOrderDetailsByTrackingID(ctx context.Context, trackingID string) (*models.Order, []models.OrderItem, error) {
+	order, err := os.db.GetOrderByTrackingID(ctx, trackingID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	items, err := os.db.GetOrderItems(ctx, order.OrderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	return order, items, nil
+}
+
+// UpdateOrderStatus moves an order to a new status, recording the reason. The
+// error wraps database.ErrOrderNotFound for an unknown order and
+// models.ErrUnknownStatus or models.ErrInvalidStatusTransition for a status
+// the order may not move to.
+func (os *OrderService) UpdateOrderStatus(ctx context.Context, orderID, status, reason string) (*models.Order, error) {
+	order, err := os.db.UpdateOrderStatus(ctx, orderID, status, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	os.log.Infof("order %s is now %s", orderID, status)
+	return order, nil
+}
+
+// CancelOrder cancels one of the user's orders, recording the reason and an
+// event for the order event publisher. The error wraps
+// database.ErrOrderNotFound for an unknown order or one of another user, and
+// models.ErrInvalidStatusTransition for an order that can no longer be
+// cancelled.
+func (os *OrderService) CancelOrder(ctx context.Context, userID, orderID, reason string) (*models.Order, error) {
+	order, err := os.db.CancelOrder(ctx, userID, orderID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel order: %w", err)
+	}
+
+	os.log.Infof("order %s cancelled: %s", orderID, reason)
+	return order, nil
+}
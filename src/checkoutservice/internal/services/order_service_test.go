@@ -1,13 +1,17 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func setupTestOrderService() (*OrderService, *database.MockConnection) {
@@ -67,7 +71,7 @@ func createTestOrderResult() (*pb.OrderResult, *pb.Money, string, string) {
 	total := &pb.Money{
 		CurrencyCode: "USD",
 		Units:        71,
-		Nanos:        970000000, // $71.97 (2*15.99 + 29.99 + 9.99)
+		Nanos:        960000000, // $71.96 (2*15.99 + 29.99 + 9.99)
 	}
 
 	email := "test@example.com"
@@ -76,20 +80,29 @@ func createTestOrderResult() (*pb.OrderResult, *pb.Money, string, string) {
 	return orderResult, total, email, userID
 }
 
-func TestOrderService_SaveOrder_Success(t *testing.T) {
+// placeOrder saves an order as PlaceOrder does: reserved before its card is
+// charged, then completed.
+func placeOrder(ctx context.Context, orderService *OrderService, orderResult *pb.OrderResult, email, userID string, total *pb.Money) error {
+	if err := orderService.ReserveOrder(ctx, orderResult, email, userID, total); err != nil {
+		return err
+	}
+	return orderService.CompleteOrder(ctx, orderResult, email, "tx-1")
+}
+
+func TestOrderService_CompleteOrder_Success(t *testing.T) {
 	orderService, mockDB := setupTestOrderService()
 	defer mockDB.Close()
 
 	orderResult, total, email, userID := createTestOrderResult()
 
 	// Test successful order save
-	err := orderService.SaveOrder(orderResult, email, userID, total)
+	err := placeOrder(context.Background(), orderService, orderResult, email, userID, total)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
 
 	// Verify order was saved by retrieving it
-	orders, err := orderService.GetUserOrderHistory(userID)
+	orders, _, err := orderService.GetUserOrderHistory(context.Background(), userID)
 	if err != nil {
 		t.Fatalf("Failed to retrieve order history: %v", err)
 	}
@@ -114,12 +127,12 @@ func TestOrderService_SaveOrder_Success(t *testing.T) {
 	if order.TotalAmountUnits != total.Units {
 		t.Errorf("Expected units %d, got %d", total.Units, order.TotalAmountUnits)
 	}
-	if order.Status != "completed" {
-		t.Errorf("Expected status 'completed', got %s", order.Status)
+	if order.Status != models.StatusPaid {
+		t.Errorf("Expected status 'paid', got %s", order.Status)
 	}
 }
 
-func TestOrderService_SaveOrder_DatabaseError(t *testing.T) {
+func TestOrderService_ReserveOrder_DatabaseError(t *testing.T) {
 	orderService, mockDB := setupTestOrderService()
 	defer mockDB.Close()
 
@@ -129,17 +142,362 @@ func TestOrderService_SaveOrder_DatabaseError(t *testing.T) {
 	orderResult, total, email, userID := createTestOrderResult()
 
 	// Test error handling
-	err := orderService.SaveOrder(orderResult, email, userID, total)
+	err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total)
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
 
-	expectedError := "failed to save order to database: mock database error"
+	expectedError := "failed to reserve order: mock database error"
 	if err.Error() != expectedError {
 		t.Errorf("Expected error '%s', got '%s'", expectedError, err.Error())
 	}
 }
 
+func TestValidateOrder_CurrencyMismatch(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	for name, mismatch := range map[string]func(*pb.OrderResult){
+		"item":     func(o *pb.OrderResult) { o.Items[1].Cost.CurrencyCode = "EUR" },
+		"shipping": func(o *pb.OrderResult) { o.ShippingCost.CurrencyCode = "EUR" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			orderResult, total, email, userID := createTestOrderResult()
+			mismatch(orderResult)
+			if err := ValidateOrder(orderResult, email, userID, total); !errors.Is(err, models.ErrCurrencyMismatch) {
+				t.Fatalf("Expected ErrCurrencyMismatch, got %v", err)
+			}
+			err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total)
+			if !errors.Is(err, models.ErrCurrencyMismatch) {
+				t.Fatalf("Expected ErrCurrencyMismatch, got %v", err)
+			}
+			if _, _, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId); !errors.Is(err, database.ErrOrderNotFound) {
+				t.Errorf("Expected the order not to be saved, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateOrder_TotalMismatch(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	for name, tamper := range map[string]func(*pb.OrderResult, *pb.Money){
+		"total":    func(o *pb.OrderResult, total *pb.Money) { total.Nanos += 10000000 },
+		"item":     func(o *pb.OrderResult, total *pb.Money) { o.Items[0].Cost.Units = 14 },
+		"shipping": func(o *pb.OrderResult, total *pb.Money) { o.ShippingCost = nil },
+		"discount": func(o *pb.OrderResult, total *pb.Money) { o.Discount = &pb.Money{CurrencyCode: "USD", Units: 1} },
+		"tax": func(o *pb.OrderResult, total *pb.Money) {
+			o.Tax = &pb.Money{CurrencyCode: "USD", Units: 1}
+			o.TaxLines = []*pb.TaxLine{{Jurisdiction: "germany", Amount: o.Tax}}
+		},
+		"tax breakdown": func(o *pb.OrderResult, total *pb.Money) {
+			o.Tax = &pb.Money{CurrencyCode: "USD", Units: 1}
+			total.Units++
+		},
+		"discount above the items": func(o *pb.OrderResult, total *pb.Money) {
+			o.Discount = &pb.Money{CurrencyCode: "USD", Units: 70}
+			total.Units -= 70
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			orderResult, total, email, userID := createTestOrderResult()
+			tamper(orderResult, total)
+			if err := ValidateOrder(orderResult, email, userID, total); !errors.Is(err, ErrTotalMismatch) {
+				t.Fatalf("Expected ErrTotalMismatch, got %v", err)
+			}
+			err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total)
+			if !errors.Is(err, ErrTotalMismatch) {
+				t.Fatalf("Expected ErrTotalMismatch, got %v", err)
+			}
+			if _, _, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId); !errors.Is(err, database.ErrOrderNotFound) {
+				t.Errorf("Expected the order not to be saved, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOrderService_CompleteOrder_Discount(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	// 10% off the $61.97 of items; shipping is paid in full.
+	orderResult, total, email, userID := createTestOrderResult()
+	orderResult.DiscountCode = "WELCOME10"
+	orderResult.Discount = &pb.Money{CurrencyCode: "USD", Units: 6, Nanos: 190000000}
+	total.Units, total.Nanos = 65, 770000000
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+
+	order, _, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.DiscountCode != "WELCOME10" || order.DiscountAmountUnits != 6 || order.DiscountAmountNanos != 190000000 {
+		t.Errorf("Unexpected discount %q %d.%09d", order.DiscountCode, order.DiscountAmountUnits, order.DiscountAmountNanos)
+	}
+	if order.SubtotalAmountCurrency != "USD" || order.SubtotalAmountUnits != 61 || order.SubtotalAmountNanos != 970000000 {
+		t.Errorf("Expected a subtotal of USD 61.97, got %s %d.%09d", order.SubtotalAmountCurrency, order.SubtotalAmountUnits, order.SubtotalAmountNanos)
+	}
+}
+
+func TestOrderService_CompleteOrder_Tax(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	// $0.62 and $4.49 of tax on the $61.97 of items.
+	orderResult, total, email, userID := createTestOrderResult()
+	orderResult.Tax = &pb.Money{CurrencyCode: "USD", Units: 5, Nanos: 110000000}
+	orderResult.TaxLines = []*pb.TaxLine{
+		{Jurisdiction: "united states", Amount: &pb.Money{CurrencyCode: "USD", Nanos: 620000000}},
+		{Jurisdiction: "united states/ca", Amount: &pb.Money{CurrencyCode: "USD", Units: 4, Nanos: 490000000}},
+	}
+	total.Units, total.Nanos = 77, 70000000
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+
+	order, _, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.TaxAmountCurrency != "USD" || order.TaxAmountUnits != 5 || order.TaxAmountNanos != 110000000 {
+		t.Errorf("Expected tax of USD 5.11, got %s %d.%09d", order.TaxAmountCurrency, order.TaxAmountUnits, order.TaxAmountNanos)
+	}
+	if len(order.TaxBreakdown) != 2 || order.TaxBreakdown[1] != (models.TaxLine{Jurisdiction: "united states/ca", Currency: "USD", Units: 4, Nanos: 490000000}) {
+		t.Errorf("Unexpected tax breakdown %+v", order.TaxBreakdown)
+	}
+}
+
+func TestOrderService_CompleteOrder_QueuesConfirmation(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	// Completing the order again, as a retry does, queues it once.
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	if err := orderService.CompleteOrder(context.Background(), orderResult, email, "tx-1"); err != nil {
+		t.Fatalf("Failed to complete order again: %v", err)
+	}
+
+	order, _, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if order.ConfirmationStatus != models.ConfirmationPending {
+		t.Errorf("Expected confirmation to be pending, got %q", order.ConfirmationStatus)
+	}
+
+	var queued []models.Confirmation
+	_, err = mockDB.DeliverConfirmations(context.Background(), 10, time.Minute, func(c models.Confirmation) error {
+		queued = append(queued, c)
+		return nil
+	}, func(int) (time.Duration, bool) { return 0, false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 {
+		t.Fatalf("Expected one queued confirmation, got %d", len(queued))
+	}
+	var sent pb.OrderResult
+	if err := protojson.Unmarshal(queued[0].Order, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if queued[0].Email != email || sent.OrderId != orderResult.OrderId || len(sent.Items) != len(orderResult.Items) {
+		t.Errorf("Unexpected confirmation to %s of %v", queued[0].Email, &sent)
+	}
+}
+
+func TestOrderService_SaveBufferedOrder(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	orderResult.Status = models.StatusPaid
+	placedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := orderService.SaveBufferedOrder(context.Background(), orderResult, email, userID, total, "tx-1", placedAt); err != nil {
+		t.Fatalf("Failed to save buffered order: %v", err)
+	}
+	// Saving it again, as a flush retried after a lost commit does, keeps it.
+	if err := orderService.SaveBufferedOrder(context.Background(), orderResult, email, userID, total, "tx-1", placedAt); err != nil {
+		t.Fatalf("Failed to save buffered order again: %v", err)
+	}
+
+	order, items, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if !order.OrderDate.Equal(placedAt) || order.Status != models.StatusPaid || order.ShippingTrackingID != orderResult.ShippingTrackingId || len(items) != 2 {
+		t.Errorf("Expected a paid order dated %v with 2 items, got %+v with %d", placedAt, order, len(items))
+	}
+
+	// Its confirmation was sent when the order was placed.
+	delivered, err := mockDB.DeliverConfirmations(context.Background(), 10, time.Minute, func(models.Confirmation) error { return nil },
+		func(int) (time.Duration, bool) { return 0, false })
+	if err != nil || delivered != 0 {
+		t.Errorf("Expected no queued confirmation, delivered %d (%v)", delivered, err)
+	}
+}
+
+func TestOrderService_SaveBufferedOrder_Held(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	// A flagged order is saved with the hold on its authorization.
+	orderResult, total, email, userID := createTestOrderResult()
+	orderResult.ShippingTrackingId = ""
+	orderResult.Status = models.StatusUnderReview
+	if err := orderService.SaveBufferedOrder(context.Background(), orderResult, email, userID, total, "tx-1", time.Now()); err != nil {
+		t.Fatalf("Failed to save buffered order: %v", err)
+	}
+	hold, _, err := orderService.TakeOrderHold(context.Background(), orderResult.OrderId)
+	if err != nil || hold.TransactionID != "tx-1" {
+		t.Errorf("Expected the order held with tx-1, got %+v, %v", hold, err)
+	}
+}
+
+func TestOrderService_ReserveOrder(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	orderResult.ShippingTrackingId = ""
+	if err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to reserve order: %v", err)
+	}
+	if err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total); !errors.Is(err, database.ErrDuplicateOrder) {
+		t.Errorf("Expected reserving the order again to fail with ErrDuplicateOrder, got: %v", err)
+	}
+
+	order, _, err := orderService.GetPlacedOrder(context.Background(), orderResult.OrderId)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if order.Status != models.StatusPending {
+		t.Errorf("Expected status 'pending', got %s", order.Status)
+	}
+	if events := publishEvents(t, mockDB); len(events) != 0 {
+		t.Errorf("Expected no event for a pending order, got %+v", events)
+	}
+	// A pending order is still being placed: it isn't in the user's history
+	// or in search, and can't be cancelled.
+	if orders, _, err := orderService.GetUserOrderHistory(context.Background(), userID); err != nil || len(orders) != 0 {
+		t.Errorf("Expected no orders in history, got %+v, %v", orders, err)
+	}
+	if orders, _, err := orderService.SearchOrders(context.Background(), database.OrderSearch{Email: email}, "", 10); err != nil || len(orders) != 0 {
+		t.Errorf("Expected no orders in search, got %+v, %v", orders, err)
+	}
+	if _, err := orderService.CancelOrder(context.Background(), userID, orderResult.OrderId, "too slow"); !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected cancelling a pending order to fail, got: %v", err)
+	}
+
+	orderResult.ShippingTrackingId = "TEST-TRACKING-12345"
+	orderResult.Status = models.StatusPaid
+	if err := orderService.CompleteOrder(context.Background(), orderResult, email, "tx-1"); err != nil {
+		t.Fatalf("Failed to complete order: %v", err)
+	}
+	order, _, err = orderService.GetPlacedOrder(context.Background(), orderResult.OrderId)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if order.Status != models.StatusPaid || order.ShippingTrackingID != "TEST-TRACKING-12345" || order.ConfirmationStatus != models.ConfirmationPending {
+		t.Errorf("Unexpected completed order %+v", order)
+	}
+	if events := publishEvents(t, mockDB); len(events) != 1 || events[0].Type != models.EventOrderPlaced {
+		t.Errorf("Expected the placed event, got %+v", events)
+	}
+	// Completing it again, as a retry whose commit was lost does, succeeds
+	// without another event; completing it differently fails.
+	if err := orderService.CompleteOrder(context.Background(), orderResult, email, "tx-1"); err != nil {
+		t.Errorf("Expected completing the order again to succeed, got: %v", err)
+	}
+	if events := publishEvents(t, mockDB); len(events) != 0 {
+		t.Errorf("Expected no event for completing the order again, got %+v", events)
+	}
+	orderResult.Status = models.StatusUnderReview
+	if err := orderService.CompleteOrder(context.Background(), orderResult, email, "tx-1"); !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected completing the order as under review to fail, got: %v", err)
+	}
+}
+
+func TestOrderService_DropStaleReservations(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	for id, order := range map[string]*models.Order{
+		"stale":  {Status: models.StatusPending, OrderDate: time.Now().Add(-time.Hour)},
+		"recent": {Status: models.StatusPending, OrderDate: time.Now()},
+		"paid":   {Status: models.StatusPaid, OrderDate: time.Now().Add(-time.Hour)},
+	} {
+		order.OrderID = id
+		order.UserID = "user-1"
+		if err := mockDB.SaveOrder(context.Background(), order, nil); err != nil {
+			t.Fatalf("SaveOrder(%s) failed: %v", id, err)
+		}
+	}
+
+	n, err := orderService.DropStaleReservations(context.Background(), 15*time.Minute)
+	if err != nil || n != 1 {
+		t.Fatalf("DropStaleReservations = %d, %v; want 1", n, err)
+	}
+	if _, _, err := orderService.GetPlacedOrder(context.Background(), "stale"); !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected the stale reservation to be dropped, got: %v", err)
+	}
+	for _, id := range []string{"recent", "paid"} {
+		if _, _, err := orderService.GetPlacedOrder(context.Background(), id); err != nil {
+			t.Errorf("Expected order %s to be kept, got: %v", id, err)
+		}
+	}
+}
+
+func TestOrderService_ReserveOrder_TotalMismatch(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	total.Units++
+	if err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total); !errors.Is(err, ErrTotalMismatch) {
+		t.Errorf("Expected ErrTotalMismatch, got: %v", err)
+	}
+	if _, _, err := orderService.GetPlacedOrder(context.Background(), orderResult.OrderId); !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected the order not to be saved, got: %v", err)
+	}
+}
+
+func TestOrderService_CancelPendingOrder(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to reserve order: %v", err)
+	}
+	if err := orderService.CancelPendingOrder(context.Background(), orderResult.OrderId); err != nil {
+		t.Fatalf("Failed to drop pending order: %v", err)
+	}
+	if _, _, err := orderService.GetPlacedOrder(context.Background(), orderResult.OrderId); !errors.Is(err, database.ErrOrderNotFound) {
+		t.Fatalf("Expected the pending order to be dropped, got: %v", err)
+	}
+
+	// Once dropped, the order can be reserved again, and a completed order
+	// is not dropped.
+	if err := orderService.ReserveOrder(context.Background(), orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to reserve order again: %v", err)
+	}
+	if err := orderService.CompleteOrder(context.Background(), orderResult, email, "tx-1"); err != nil {
+		t.Fatalf("Failed to complete order: %v", err)
+	}
+	if err := orderService.CancelPendingOrder(context.Background(), orderResult.OrderId); err != nil {
+		t.Fatalf("Failed to drop pending order: %v", err)
+	}
+	if _, _, err := orderService.GetPlacedOrder(context.Background(), orderResult.OrderId); err != nil {
+		t.Errorf("Expected the completed order to be kept, got: %v", err)
+	}
+}
+
 func TestOrderService_GetUserOrderHistory_Success(t *testing.T) {
 	orderService, mockDB := setupTestOrderService()
 	defer mockDB.Close()
@@ -149,7 +507,7 @@ func TestOrderService_GetUserOrderHistory_Success(t *testing.T) {
 	// Save multiple orders for the same user
 	for i := 0; i < 3; i++ {
 		orderResult, total, email, _ := createTestOrderResult()
-		err := orderService.SaveOrder(orderResult, email, userID, total)
+		err := placeOrder(context.Background(), orderService, orderResult, email, userID, total)
 		if err != nil {
 			t.Fatalf("Failed to save order %d: %v", i, err)
 		}
@@ -157,7 +515,7 @@ func TestOrderService_GetUserOrderHistory_Success(t *testing.T) {
 	}
 
 	// Retrieve order history
-	orders, err := orderService.GetUserOrderHistory(userID)
+	orders, _, err := orderService.GetUserOrderHistory(context.Background(), userID)
 	if err != nil {
 		t.Fatalf("Failed to get order history: %v", err)
 	}
@@ -181,7 +539,7 @@ func TestOrderService_GetUserOrderHistory_NoOrders(t *testing.T) {
 	userID := "nonexistent-user"
 
 	// Get order history for user with no orders
-	orders, err := orderService.GetUserOrderHistory(userID)
+	orders, _, err := orderService.GetUserOrderHistory(context.Background(), userID)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -191,6 +549,30 @@ func TestOrderService_GetUserOrderHistory_NoOrders(t *testing.T) {
 	}
 }
 
+func TestOrderService_GetUserOrderHistory_Truncated(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	userID := "test-user-long-history"
+	for i := 0; i < database.MaxOrdersPerUser+1; i++ {
+		orderResult, total, email, _ := createTestOrderResult()
+		if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+			t.Fatalf("Failed to save order %d: %v", i, err)
+		}
+	}
+
+	orders, truncated, err := orderService.GetUserOrderHistory(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Failed to get order history: %v", err)
+	}
+	if !truncated {
+		t.Error("Expected history to be truncated")
+	}
+	if len(orders) != database.MaxOrdersPerUser {
+		t.Errorf("Expected %d orders, got %d", database.MaxOrdersPerUser, len(orders))
+	}
+}
+
 func TestOrderService_GetUserOrderHistory_DatabaseError(t *testing.T) {
 	orderService, mockDB := setupTestOrderService()
 	defer mockDB.Close()
@@ -201,7 +583,7 @@ func TestOrderService_GetUserOrderHistory_DatabaseError(t *testing.T) {
 	userID := "test-user-789"
 
 	// Test error handling
-	_, err := orderService.GetUserOrderHistory(userID)
+	_, _, err := orderService.GetUserOrderHistory(context.Background(), userID)
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -212,6 +594,129 @@ func TestOrderService_GetUserOrderHistory_DatabaseError(t *testing.T) {
 	}
 }
 
+func TestOrderService_GetUserOrderHistoryPage(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	userID := "test-user-pages"
+	for i := 0; i < 5; i++ {
+		orderResult, total, email, _ := createTestOrderResult()
+		if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+			t.Fatalf("Failed to save order %d: %v", i, err)
+		}
+	}
+
+	// Walk the pages and check every order comes once, newest first.
+	var seen []models.Order
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Expected 3 pages")
+		}
+		orders, next, err := orderService.GetUserOrderHistoryPage(context.Background(), userID, database.DateRange{}, token, 2)
+		if err != nil {
+			t.Fatalf("Failed to get page %d: %v", pages, err)
+		}
+		seen = append(seen, orders...)
+		if next == "" {
+			break
+		}
+		if len(orders) != 2 {
+			t.Fatalf("Expected a full page before the last, got %d orders", len(orders))
+		}
+		token = next
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("Expected 5 orders, got %d", len(seen))
+	}
+	ids := make(map[string]bool)
+	for i, order := range seen {
+		if ids[order.OrderID] {
+			t.Errorf("Order %s listed twice", order.OrderID)
+		}
+		ids[order.OrderID] = true
+		if i > 0 && order.OrderDate.After(seen[i-1].OrderDate) {
+			t.Errorf("Order %d is newer than the one before it", i)
+		}
+	}
+}
+
+func TestOrderService_GetUserOrderHistoryPage_PageSize(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	userID := "test-user-page-size"
+	for i := 0; i < MaxOrderPageSize+1; i++ {
+		orderResult, total, email, _ := createTestOrderResult()
+		if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+			t.Fatalf("Failed to save order %d: %v", i, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		pageSize int
+		want     int
+	}{
+		{0, DefaultOrderPageSize},
+		{5, 5},
+		{MaxOrderPageSize + 50, MaxOrderPageSize},
+	} {
+		orders, next, err := orderService.GetUserOrderHistoryPage(context.Background(), userID, database.DateRange{}, "", tc.pageSize)
+		if err != nil {
+			t.Fatalf("Page size %d: %v", tc.pageSize, err)
+		}
+		if len(orders) != tc.want {
+			t.Errorf("Page size %d: expected %d orders, got %d", tc.pageSize, tc.want, len(orders))
+		}
+		if next == "" {
+			t.Errorf("Page size %d: expected a next page token", tc.pageSize)
+		}
+	}
+}
+
+func TestOrderService_GetUserOrderHistoryPage_DateRange(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	userID := "test-user-dates"
+	var dates []time.Time
+	for i := 0; i < 3; i++ {
+		orderResult, total, email, _ := createTestOrderResult()
+		if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+			t.Fatalf("Failed to save order %d: %v", i, err)
+		}
+		orders, _, _ := orderService.GetUserOrderHistoryPage(context.Background(), userID, database.DateRange{}, "", 1)
+		dates = append(dates, orders[0].OrderDate)
+		time.Sleep(1 * time.Millisecond) // Ensure different timestamps
+	}
+
+	orders, _, err := orderService.GetUserOrderHistoryPage(context.Background(), userID, database.DateRange{From: dates[1], To: dates[2]}, "", 10)
+	if err != nil {
+		t.Fatalf("Failed to get order history: %v", err)
+	}
+	if len(orders) != 1 || !orders[0].OrderDate.Equal(dates[1]) {
+		t.Errorf("Expected only the order placed at %v, got %v", dates[1], orders)
+	}
+
+	_, _, err = orderService.GetUserOrderHistoryPage(context.Background(), userID, database.DateRange{From: dates[2], To: dates[0]}, "", 10)
+	if !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("Expected ErrInvalidDateRange, got %v", err)
+	}
+}
+
+func TestOrderService_GetUserOrderHistoryPage_InvalidToken(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	for _, token := range []string{"not base64!", "bm8tc2VwYXJhdG9y", "bm90LWEtdGltZXxpZA"} {
+		_, _, err := orderService.GetUserOrderHistoryPage(context.Background(), "user", database.DateRange{}, token, 10)
+		if !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("Token %q: expected ErrInvalidPageToken, got %v", token, err)
+		}
+	}
+}
+
 func TestOrderService_GetOrderDetails_Success(t *testing.T) {
 	orderService, mockDB := setupTestOrderService()
 	defer mockDB.Close()
@@ -219,16 +724,19 @@ func TestOrderService_GetOrderDetails_Success(t *testing.T) {
 	orderResult, total, email, userID := createTestOrderResult()
 
 	// Save an order first
-	err := orderService.SaveOrder(orderResult, email, userID, total)
+	err := placeOrder(context.Background(), orderService, orderResult, email, userID, total)
 	if err != nil {
 		t.Fatalf("Failed to save order: %v", err)
 	}
 
 	// Get order details
-	_, items, err := orderService.GetOrderDetails(orderResult.OrderId)
+	order, items, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId)
 	if err != nil {
 		t.Fatalf("Failed to get order details: %v", err)
 	}
+	if order.OrderID != orderResult.OrderId || order.UserID != userID {
+		t.Errorf("Expected order %s of user %s, got %s of %s", orderResult.OrderId, userID, order.OrderID, order.UserID)
+	}
 
 	expectedItemCount := len(orderResult.Items)
 	if len(items) != expectedItemCount {
@@ -249,20 +757,16 @@ func TestOrderService_GetOrderDetails_Success(t *testing.T) {
 	}
 }
 
-func TestOrderService_GetOrderDetails_NoItems(t *testing.T) {
+func TestOrderService_GetOrderDetails_NotFound(t *testing.T) {
 	orderService, mockDB := setupTestOrderService()
 	defer mockDB.Close()
 
 	orderID := "nonexistent-order"
 
 	// Get details for non-existent order
-	_, items, err := orderService.GetOrderDetails(orderID)
-	if err != nil {
-		t.Fatalf("Expected no error, got: %v", err)
-	}
-
-	if len(items) != 0 {
-		t.Fatalf("Expected 0 items, got %d", len(items))
+	_, _, err := orderService.GetOrderDetails(context.Background(), orderID)
+	if !errors.Is(err, database.ErrOrderNotFound) {
+		t.Fatalf("Expected ErrOrderNotFound, got: %v", err)
 	}
 }
 
@@ -276,15 +780,228 @@ func TestOrderService_GetOrderDetails_DatabaseError(t *testing.T) {
 	orderID := "test-order-error"
 
 	// Test error handling
-	_, _, err := orderService.GetOrderDetails(orderID)
+	_, _, err := orderService.GetOrderDetails(context.Background(), orderID)
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
 
-	expectedError := "failed to get order items: mock database error"
+	expectedError := "failed to get order: mock database error"
 	if err.Error() != expectedError {
 		t.Errorf("Expected error '%s', got '%s'", expectedError, err.Error())
 	}
+	if !errors.Is(err, database.ErrUnavailable) {
+		t.Errorf("Expected the error to be database.ErrUnavailable, got %v", err)
+	}
+}
+
+func TestOrderService_GetOrderDetailsByTrackingID(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+
+	order, items, err := orderService.GetOrderDetailsByTrackingID(context.Background(), orderResult.ShippingTrackingId)
+	if err != nil {
+		t.Fatalf("Failed to get order details: %v", err)
+	}
+	if order.OrderID != orderResult.OrderId || len(items) != len(orderResult.Items) {
+		t.Errorf("Expected order %s with %d items, got %s with %d", orderResult.OrderId, len(orderResult.Items), order.OrderID, len(items))
+	}
+
+	_, _, err = orderService.GetOrderDetailsByTrackingID(context.Background(), "TRACK-UNKNOWN")
+	if !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got: %v", err)
+	}
+}
+
+func TestOrderService_GetUserOrderStats(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	ctx := context.Background()
+	var orderIDs []string
+	for i := 0; i < 3; i++ {
+		orderResult, total, email, userID := createTestOrderResult()
+		if err := placeOrder(ctx, orderService, orderResult, email, userID, total); err != nil {
+			t.Fatalf("Failed to save order: %v", err)
+		}
+		orderIDs = append(orderIDs, orderResult.OrderId)
+	}
+	if _, err := orderService.CancelOrder(ctx, "test-user-123", orderIDs[2], "changed my mind"); err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+
+	stats, err := orderService.GetUserOrderStats(ctx, "test-user-123", 0)
+	if err != nil {
+		t.Fatalf("Failed to get order stats: %v", err)
+	}
+	// The cancelled order is left out; 2 * $71.96.
+	if stats.TotalOrders != 2 || stats.FirstOrderDate.IsZero() || stats.LastOrderDate.Before(stats.FirstOrderDate) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if len(stats.Spend) != 1 || stats.Spend[0] != (models.CurrencySpend{Currency: "USD", Units: 143, Nanos: 920000000}) {
+		t.Errorf("Expected spend of USD 143.92, got %+v", stats.Spend)
+	}
+	want := []models.ProductStats{{ProductID: "PRODUCT-1", Quantity: 4, Orders: 2}, {ProductID: "PRODUCT-2", Quantity: 2, Orders: 2}}
+	if len(stats.TopProducts) != 2 || stats.TopProducts[0] != want[0] || stats.TopProducts[1] != want[1] {
+		t.Errorf("Expected top products %+v, got %+v", want, stats.TopProducts)
+	}
+
+	if stats, err := orderService.GetUserOrderStats(ctx, "test-user-123", 1); err != nil || len(stats.TopProducts) != 1 {
+		t.Errorf("Expected 1 top product, got %+v, %v", stats, err)
+	}
+
+	stats, err = orderService.GetUserOrderStats(ctx, "user-without-orders", 0)
+	if err != nil {
+		t.Fatalf("Failed to get order stats: %v", err)
+	}
+	if stats.TotalOrders != 0 || len(stats.Spend) != 0 || !stats.FirstOrderDate.IsZero() {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+}
+
+func TestOrderService_UpdateOrderStatus(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+
+	for _, status := range []string{models.StatusShipped, models.StatusDelivered} {
+		order, err := orderService.UpdateOrderStatus(context.Background(), orderResult.OrderId, status, "carrier update")
+		if err != nil {
+			t.Fatalf("Failed to move order to %s: %v", status, err)
+		}
+		if order.Status != status {
+			t.Errorf("Expected status %s, got %s", status, order.Status)
+		}
+	}
+
+	_, err := orderService.UpdateOrderStatus(context.Background(), orderResult.OrderId, models.StatusCancelled, "too late")
+	if !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+	order, _, err := orderService.GetOrderDetails(context.Background(), orderResult.OrderId)
+	if err != nil {
+		t.Fatalf("Failed to get order details: %v", err)
+	}
+	if order.Status != models.StatusDelivered {
+		t.Errorf("Expected a rejected transition to keep status delivered, got %s", order.Status)
+	}
+
+	_, err = orderService.UpdateOrderStatus(context.Background(), "nonexistent-order", models.StatusShipped, "")
+	if !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestOrderService_CancelOrder(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+
+	_, err := orderService.CancelOrder(context.Background(), "another-user", orderResult.OrderId, "not mine")
+	if !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound for another user's order, got %v", err)
+	}
+
+	order, err := orderService.CancelOrder(context.Background(), userID, orderResult.OrderId, "changed my mind")
+	if err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+	if order.Status != models.StatusCancelled {
+		t.Errorf("Expected status cancelled, got %s", order.Status)
+	}
+
+	_, err = orderService.CancelOrder(context.Background(), userID, orderResult.OrderId, "again")
+	if !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+
+	// Exactly one cancellation was recorded, after the order was placed.
+	events := publishEvents(t, mockDB)
+	if len(events) != 2 || events[0].Type != models.EventOrderPlaced {
+		t.Fatalf("Expected the placed and cancelled events, got %+v", events)
+	}
+	e := events[1]
+	if e.Type != models.EventOrderCancelled || e.FromStatus != models.StatusPaid || e.Reason != "changed my mind" ||
+		e.Order.OrderID != orderResult.OrderId || e.Order.Status != models.StatusCancelled {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestOrderService_CancelOrder_Shipped(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	if _, err := orderService.UpdateOrderStatus(context.Background(), orderResult.OrderId, models.StatusShipped, ""); err != nil {
+		t.Fatalf("Failed to ship order: %v", err)
+	}
+
+	_, err := orderService.CancelOrder(context.Background(), userID, orderResult.OrderId, "too late")
+	if !errors.Is(err, models.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+	for _, e := range publishEvents(t, mockDB) {
+		if e.Type == models.EventOrderCancelled {
+			t.Errorf("Expected no cancellation event, got %+v", e)
+		}
+	}
+}
+
+// publishEvents publishes and returns the mock database's order events.
+func publishEvents(t *testing.T, mockDB *database.MockConnection) []models.OrderEvent {
+	t.Helper()
+	var events []models.OrderEvent
+	_, err := mockDB.PublishOrderEvents(context.Background(), 100, time.Minute, func(batch []models.OrderEvent) error {
+		events = append(events, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestOrderService_RecordsPlacedAndShippedEvents(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	// A retried completion records nothing.
+	if err := orderService.CompleteOrder(context.Background(), orderResult, email, "tx-1"); err != nil {
+		t.Fatalf("Failed to complete order again: %v", err)
+	}
+	if _, err := orderService.UpdateOrderStatus(context.Background(), orderResult.OrderId, models.StatusShipped, "handed to carrier"); err != nil {
+		t.Fatalf("Failed to ship order: %v", err)
+	}
+	if _, err := orderService.UpdateOrderStatus(context.Background(), orderResult.OrderId, models.StatusDelivered, ""); err != nil {
+		t.Fatalf("Failed to deliver order: %v", err)
+	}
+
+	events := publishEvents(t, mockDB)
+	if len(events) != 2 || events[0].Type != models.EventOrderPlaced || events[1].Type != models.EventOrderShipped {
+		t.Fatalf("Expected the placed and shipped events, got %+v", events)
+	}
+	if e := events[1]; e.FromStatus != models.StatusPaid || e.Reason != "handed to carrier" {
+		t.Errorf("Unexpected shipped event %+v", e)
+	}
 }
 
 func TestOrderService_MultipleUsers(t *testing.T) {
@@ -298,7 +1015,7 @@ func TestOrderService_MultipleUsers(t *testing.T) {
 	for i, userID := range users {
 		for j := 0; j < orderCounts[i]; j++ {
 			orderResult, total, email, _ := createTestOrderResult()
-			err := orderService.SaveOrder(orderResult, email, userID, total)
+			err := placeOrder(context.Background(), orderService, orderResult, email, userID, total)
 			if err != nil {
 				t.Fatalf("Failed to save order for user %s: %v", userID, err)
 			}
@@ -307,7 +1024,7 @@ func TestOrderService_MultipleUsers(t *testing.T) {
 
 	// Verify each user has the correct number of orders
 	for i, userID := range users {
-		orders, err := orderService.GetUserOrderHistory(userID)
+		orders, _, err := orderService.GetUserOrderHistory(context.Background(), userID)
 		if err != nil {
 			t.Fatalf("Failed to get order history for user %s: %v", userID, err)
 		}
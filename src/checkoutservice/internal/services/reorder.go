@@ -0,0 +1,43 @@
+package services
+
+import (
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+// Reasons an item of a past order cannot be ordered again.
+const (
+	ReorderNotFound     = "not_found"
+	ReorderDiscontinued = "discontinued"
+	ReorderUnavailable  = "unavailable" // hidden from the catalog for now
+	ReorderOutOfStock   = "out_of_stock"
+)
+
+// ReorderQuantity returns how many of quantity units of a product, ordered
+// before, can be ordered again, and if that is fewer, why. product is the
+// product as the catalog has it now, or nil if the catalog no longer has it.
+// Products with variants are reorderable while any variant is in stock, since
+// orders do not record the variant. Products that don't track stock always
+// are.
+func ReorderQuantity(product *pb.Product, quantity int32) (int32, string) {
+	switch {
+	case product == nil:
+		return 0, ReorderNotFound
+	case product.GetStatus() == pb.Product_DISCONTINUED:
+		return 0, ReorderDiscontinued
+	case product.GetStatus() != pb.Product_ACTIVE:
+		return 0, ReorderUnavailable
+	}
+
+	if len(product.GetVariants()) > 0 {
+		for _, v := range product.GetVariants() {
+			if v.GetStock() > 0 {
+				return quantity, ""
+			}
+		}
+		return 0, ReorderOutOfStock
+	}
+	if product.Stock != nil && product.GetStock() < quantity {
+		return max(product.GetStock(), 0), ReorderOutOfStock
+	}
+	return quantity, ""
+}
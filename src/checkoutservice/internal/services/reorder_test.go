@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReorderQuantity(t *testing.T) {
+	tests := []struct {
+		name       string
+		product    *pb.Product
+		wantQty    int32
+		wantReason string
+	}{
+		{"not in catalog", nil, 0, ReorderNotFound},
+		{"untracked stock", &pb.Product{Id: "p"}, 3, ""},
+		{"enough stock", &pb.Product{Id: "p", Stock: proto.Int32(3)}, 3, ""},
+		{"some stock", &pb.Product{Id: "p", Stock: proto.Int32(2)}, 2, ReorderOutOfStock},
+		{"no stock", &pb.Product{Id: "p", Stock: proto.Int32(0)}, 0, ReorderOutOfStock},
+		{"discontinued", &pb.Product{Id: "p", Status: pb.Product_DISCONTINUED}, 0, ReorderDiscontinued},
+		{"hidden", &pb.Product{Id: "p", Status: pb.Product_HIDDEN}, 0, ReorderUnavailable},
+		{"variant in stock", &pb.Product{Id: "p", Variants: []*pb.ProductVariant{{Sku: "p-s"}, {Sku: "p-m", Stock: 1}}}, 3, ""},
+		{"variants sold out", &pb.Product{Id: "p", Variants: []*pb.ProductVariant{{Sku: "p-s"}, {Sku: "p-m"}}}, 0, ReorderOutOfStock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qty, reason := ReorderQuantity(tt.product, 3)
+			if qty != tt.wantQty || reason != tt.wantReason {
+				t.Errorf("ReorderQuantity() = %d, %q; want %d, %q", qty, reason, tt.wantQty, tt.wantReason)
+			}
+		})
+	}
+}
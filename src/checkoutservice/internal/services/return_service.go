@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/money"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefund is returned by ApproveReturn for a refund that is not a
+// valid amount in the order's currency or exceeds the price of the returned
+// items.
+var ErrInvalidRefund = errors.New("invalid refund")
+
+// RequestReturn opens a return of items, identified by product, of one of the
+// user's orders. The error wraps database.ErrOrderNotFound for an unknown
+// order or one of another user, models.ErrNotReturnable for an order that
+// has not been delivered, and models.ErrInvalidReturn for items that are not
+// in the order or were already returned.
+func (os *OrderService) RequestReturn(ctx context.Context, userID, orderID, reason string, items []models.ReturnItem) (*models.OrderReturn, error) {
+	ret := &models.OrderReturn{
+		ReturnID: uuid.NewString(),
+		OrderID:  orderID,
+		UserID:   userID,
+		Reason:   reason,
+		Items:    items,
+	}
+	if err := os.db.CreateReturn(ctx, ret); err != nil {
+		return nil, fmt.Errorf("failed to request return: %w", err)
+	}
+
+	os.log.Infof("return %s requested for order %s", ret.ReturnID, orderID)
+	return ret, nil
+}
+
+// ApproveReturn approves a requested return and records its refund. A nil
+// amount refunds the price paid for the returned items; a given amount may be
+// less, for example to keep a restocking fee, but not more. The error wraps
+// database.ErrReturnNotFound for an unknown return, models.ErrNotReturnable
+// for a return that was already approved, and ErrInvalidRefund for an amount
+// that cannot be refunded.
+func (os *OrderService) ApproveReturn(ctx context.Context, returnID string, amount *pb.Money) (*models.OrderReturn, error) {
+	// The refund is computed from the return as the approval locked it, so
+	// it matches the items being approved.
+	var refund *pb.Money
+	ret, err := os.db.ApproveReturn(ctx, returnID, func(ret *models.OrderReturn) (models.Refund, error) {
+		due, err := refundDue(ret.Items)
+		if err != nil {
+			return models.Refund{}, fmt.Errorf("failed to compute refund of return %s: %v", returnID, err)
+		}
+		refund = due
+		if amount != nil {
+			if refund, err = checkRefund(amount, due); err != nil {
+				return models.Refund{}, err
+			}
+		}
+		return models.Refund{
+			AmountCurrency: refund.GetCurrencyCode(),
+			AmountUnits:    refund.GetUnits(),
+			AmountNanos:    refund.GetNanos(),
+		}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve return: %w", err)
+	}
+
+	os.log.Infof("return %s approved, refunding %d.%09d %s", returnID, refund.GetUnits(), refund.GetNanos(), refund.GetCurrencyCode())
+	return ret, nil
+}
+
+// refundDue is the price paid for the returned items.
+func refundDue(items []models.ReturnItem) (*pb.Money, error) {
+	var due *pb.Money
+	for i, item := range items {
+		price, err := money.Multiply(&pb.Money{
+			CurrencyCode: item.UnitPriceCurrency,
+			Units:        item.UnitPriceUnits,
+			Nanos:        item.UnitPriceNanos,
+		}, int64(item.Quantity))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			due = price
+			continue
+		}
+		if due, err = money.Sum(due, price); err != nil {
+			return nil, err
+		}
+	}
+	return due, nil
+}
+
+// checkRefund returns amount if it is a valid, non-negative amount in the
+// currency of due and no more than due.
+func checkRefund(amount, due *pb.Money) (*pb.Money, error) {
+	m := amount
+	if err := money.Validate(m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefund, err)
+	}
+	if money.IsNegative(m) {
+		return nil, fmt.Errorf("%w: %d.%09d is negative", ErrInvalidRefund, m.GetUnits(), m.GetNanos())
+	}
+	if !money.AreSameCurrency(m, due) {
+		return nil, fmt.Errorf("%w: refund in %s for an order paid in %s", ErrInvalidRefund, m.GetCurrencyCode(), due.GetCurrencyCode())
+	}
+	cmp, err := money.Compare(m, due)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefund, err)
+	}
+	if cmp > 0 {
+		return nil, fmt.Errorf("%w: more than the %d.%09d %s paid for the items",
+			ErrInvalidRefund, due.GetUnits(), due.GetNanos(), due.GetCurrencyCode())
+	}
+	return m, nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+// saveDeliveredOrder saves the test order and moves it to delivered.
+func saveDeliveredOrder(t *testing.T, orderService *OrderService) (orderID, userID string) {
+	t.Helper()
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	for _, status := range []string{models.StatusShipped, models.StatusDelivered} {
+		if _, err := orderService.UpdateOrderStatus(context.Background(), orderResult.OrderId, status, ""); err != nil {
+			t.Fatalf("Failed to move order to %s: %v", status, err)
+		}
+	}
+	return orderResult.OrderId, userID
+}
+
+func TestOrderService_RequestReturn(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderID, userID := saveDeliveredOrder(t, orderService)
+
+	// PRODUCT-1 was ordered twice at $15.99.
+	ret, err := orderService.RequestReturn(context.Background(), userID, orderID, "too small", []models.ReturnItem{{ProductID: "PRODUCT-1", Quantity: 1}})
+	if err != nil {
+		t.Fatalf("Failed to request return: %v", err)
+	}
+	if ret.ReturnID == "" || ret.Status != models.ReturnRequested || len(ret.Items) != 1 {
+		t.Fatalf("Unexpected return %+v", ret)
+	}
+	if item := ret.Items[0]; item.OrderItemID == 0 || item.UnitPriceUnits != 15 || item.UnitPriceNanos != 990000000 {
+		t.Errorf("Expected the item to link to its order item, got %+v", item)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		items []models.ReturnItem
+	}{
+		{"no items", nil},
+		{"unknown product", []models.ReturnItem{{ProductID: "PRODUCT-9", Quantity: 1}}},
+		{"zero quantity", []models.ReturnItem{{ProductID: "PRODUCT-2", Quantity: 0}}},
+		{"more than ordered", []models.ReturnItem{{ProductID: "PRODUCT-2", Quantity: 2}}},
+		{"already returned", []models.ReturnItem{{ProductID: "PRODUCT-1", Quantity: 2}}},
+		{"listed twice", []models.ReturnItem{{ProductID: "PRODUCT-2", Quantity: 1}, {ProductID: "PRODUCT-2", Quantity: 1}}},
+	} {
+		if _, err := orderService.RequestReturn(context.Background(), userID, orderID, "", tc.items); !errors.Is(err, models.ErrInvalidReturn) {
+			t.Errorf("%s: expected ErrInvalidReturn, got %v", tc.name, err)
+		}
+	}
+
+	// The remaining PRODUCT-1 can still be returned.
+	if _, err := orderService.RequestReturn(context.Background(), userID, orderID, "", []models.ReturnItem{{ProductID: "PRODUCT-1", Quantity: 1}}); err != nil {
+		t.Errorf("Failed to return the second PRODUCT-1: %v", err)
+	}
+
+	if _, err := orderService.RequestReturn(context.Background(), "another-user", orderID, "", []models.ReturnItem{{ProductID: "PRODUCT-2", Quantity: 1}}); !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound for another user's order, got %v", err)
+	}
+}
+
+func TestOrderService_RequestReturn_NotDelivered(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+
+	_, err := orderService.RequestReturn(context.Background(), userID, orderResult.OrderId, "", []models.ReturnItem{{ProductID: "PRODUCT-1", Quantity: 1}})
+	if !errors.Is(err, models.ErrNotReturnable) {
+		t.Errorf("Expected ErrNotReturnable, got %v", err)
+	}
+}
+
+func TestOrderService_ApproveReturn(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderID, userID := saveDeliveredOrder(t, orderService)
+	ret, err := orderService.RequestReturn(context.Background(), userID, orderID, "", []models.ReturnItem{
+		{ProductID: "PRODUCT-1", Quantity: 2},
+		{ProductID: "PRODUCT-2", Quantity: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to request return: %v", err)
+	}
+
+	// 2 x $15.99 + $29.99
+	approved, err := orderService.ApproveReturn(context.Background(), ret.ReturnID, nil)
+	if err != nil {
+		t.Fatalf("Failed to approve return: %v", err)
+	}
+	if approved.Status != models.ReturnApproved {
+		t.Errorf("Expected status approved, got %s", approved.Status)
+	}
+	if r := approved.Refund; r == nil || r.AmountCurrency != "USD" || r.AmountUnits != 61 || r.AmountNanos != 970000000 {
+		t.Errorf("Expected a refund of USD 61.97, got %+v", approved.Refund)
+	}
+
+	if _, err := orderService.ApproveReturn(context.Background(), ret.ReturnID, nil); !errors.Is(err, models.ErrNotReturnable) {
+		t.Errorf("Expected ErrNotReturnable approving twice, got %v", err)
+	}
+	if _, err := orderService.ApproveReturn(context.Background(), "nonexistent-return", nil); !errors.Is(err, database.ErrReturnNotFound) {
+		t.Errorf("Expected ErrReturnNotFound, got %v", err)
+	}
+}
+
+func TestOrderService_ApproveReturn_ReducesSpend(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderID, userID := saveDeliveredOrder(t, orderService)
+	ret, err := orderService.RequestReturn(context.Background(), userID, orderID, "", []models.ReturnItem{{ProductID: "PRODUCT-1", Quantity: 1}})
+	if err != nil {
+		t.Fatalf("Failed to request return: %v", err)
+	}
+	if _, err := orderService.ApproveReturn(context.Background(), ret.ReturnID, nil); err != nil {
+		t.Fatalf("Failed to approve return: %v", err)
+	}
+
+	// $71.96 less the $15.99 refund.
+	stats, err := orderService.GetUserOrderStats(context.Background(), userID, 0)
+	if err != nil {
+		t.Fatalf("Failed to get order stats: %v", err)
+	}
+	if len(stats.Spend) != 1 || stats.Spend[0] != (models.CurrencySpend{Currency: "USD", Units: 55, Nanos: 970000000}) {
+		t.Errorf("Expected spend of USD 55.97, got %+v", stats.Spend)
+	}
+}
+
+func TestOrderService_ApproveReturn_Amount(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderID, userID := saveDeliveredOrder(t, orderService)
+	ret, err := orderService.RequestReturn(context.Background(), userID, orderID, "", []models.ReturnItem{{ProductID: "PRODUCT-2", Quantity: 1}})
+	if err != nil {
+		t.Fatalf("Failed to request return: %v", err)
+	}
+
+	for _, amount := range []*pb.Money{
+		{CurrencyCode: "USD", Units: 30},
+		{CurrencyCode: "EUR", Units: 10},
+		{CurrencyCode: "USD", Units: -1},
+		{CurrencyCode: "USD", Units: 1, Nanos: -5},
+	} {
+		if _, err := orderService.ApproveReturn(context.Background(), ret.ReturnID, amount); !errors.Is(err, ErrInvalidRefund) {
+			t.Errorf("Refund %v: expected ErrInvalidRefund, got %v", amount, err)
+		}
+	}
+
+	// A restocking fee of $5 is kept.
+	approved, err := orderService.ApproveReturn(context.Background(), ret.ReturnID, &pb.Money{CurrencyCode: "USD", Units: 24, Nanos: 990000000})
+	if err != nil {
+		t.Fatalf("Failed to approve return: %v", err)
+	}
+	if r := approved.Refund; r == nil || r.AmountUnits != 24 || r.AmountNanos != 990000000 {
+		t.Errorf("Expected a refund of USD 24.99, got %+v", approved.Refund)
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+// SearchOrders retrieves one page of the orders of any user that match
+// search, for support staff. Page tokens and sizes work as in
+// GetUserOrderHistoryPage; a token only continues a search sorted the same
+// way.
+func (os *OrderService) SearchOrders(ctx context.Context, search database.OrderSearch, pageToken string, pageSize int) ([]models.Order, string, error) {
+	if !search.Dates.From.IsZero() && !search.Dates.To.IsZero() && search.Dates.To.Before(search.Dates.From) {
+		return nil, "", ErrInvalidDateRange
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultOrderPageSize
+	}
+	pageSize = min(pageSize, MaxOrderPageSize)
+
+	var after *database.SearchCursor
+	if pageToken != "" {
+		c, err := decodeSearchPageToken(search.SortBy, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+
+	// Fetch one extra order to learn whether there is another page.
+	orders, err := os.db.SearchOrders(ctx, search, after, pageSize+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to search orders: %w", err)
+	}
+	if len(orders) <= pageSize {
+		return orders, "", nil
+	}
+	orders = orders[:pageSize]
+	last := orders[pageSize-1]
+	return orders, encodeSearchPageToken(search.SortBy, database.SearchCursor{
+		OrderDate: last.OrderDate,
+		Total:     database.Amount{Units: last.TotalAmountUnits, Nanos: last.TotalAmountNanos},
+		OrderID:   last.OrderID,
+	}), nil
+}
+
+// encodeSearchPageToken turns a cursor into an opaque page token holding the
+// key of the sort.
+func encodeSearchPageToken(sortBy database.OrderSort, c database.SearchCursor) string {
+	key := "d|" + c.OrderDate.UTC().Format(time.RFC3339Nano)
+	if sortBy == database.SortByTotal {
+		key = fmt.Sprintf("t|%d|%d", c.Total.Units, c.Total.Nanos)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(key + "|" + c.OrderID))
+}
+
+// decodeSearchPageToken parses a token made by encodeSearchPageToken for the
+// same sort.
+func decodeSearchPageToken(sortBy database.OrderSort, token string) (database.SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return database.SearchCursor{}, ErrInvalidPageToken
+	}
+	var c database.SearchCursor
+	fields := strings.SplitN(string(raw), "|", 4)
+	switch {
+	case sortBy == database.SortByTotal && len(fields) == 4 && fields[0] == "t":
+		units, uerr := strconv.ParseInt(fields[1], 10, 64)
+		nanos, nerr := strconv.ParseInt(fields[2], 10, 32)
+		if uerr != nil || nerr != nil {
+			return c, ErrInvalidPageToken
+		}
+		c.Total, c.OrderID = database.Amount{Units: units, Nanos: int32(nanos)}, fields[3]
+	case sortBy != database.SortByTotal && len(fields) >= 3 && fields[0] == "d":
+		// Order IDs may contain the separator, dates don't.
+		fields = strings.SplitN(string(raw), "|", 3)
+		if c.OrderDate, err = time.Parse(time.RFC3339Nano, fields[1]); err != nil {
+			return c, ErrInvalidPageToken
+		}
+		c.OrderID = fields[2]
+	default:
+		return c, ErrInvalidPageToken
+	}
+	if c.OrderID == "" {
+		return c, ErrInvalidPageToken
+	}
+	return c, nil
+}
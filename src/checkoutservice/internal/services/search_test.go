@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+// saveSearchOrders saves orders of several users with totals of 10 to 50
+// USD, a day apart, the first with PRODUCT-1 and the rest with PRODUCT-2.
+func saveSearchOrders(t *testing.T, mockDB *database.MockConnection) {
+	t.Helper()
+	date := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"order-a", "order-b", "order-c", "order-d", "order-e"} {
+		order := &models.Order{
+			OrderID:             id,
+			UserID:              "user-" + id,
+			Email:               "customer@example.com",
+			TotalAmountCurrency: "USD",
+			TotalAmountUnits:    int64(10 * (i + 1)),
+			OrderDate:           date.AddDate(0, 0, i),
+			Status:              models.StatusPaid,
+		}
+		product := "PRODUCT-2"
+		if i == 0 {
+			product = "PRODUCT-1"
+			order.Email = "Other@Example.com"
+			order.Status = models.StatusShipped
+		}
+		if err := mockDB.SaveOrder(context.Background(), order, []models.OrderItem{{ProductID: product, Quantity: 1}}); err != nil {
+			t.Fatalf("Failed to save order %s: %v", id, err)
+		}
+	}
+}
+
+func orderIDs(orders []models.Order) []string {
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		ids[i] = order.OrderID
+	}
+	return ids
+}
+
+func TestOrderService_SearchOrders(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	saveSearchOrders(t, mockDB)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name   string
+		search database.OrderSearch
+		want   []string
+	}{
+		{"all, newest first", database.OrderSearch{}, []string{"order-e", "order-d", "order-c", "order-b", "order-a"}},
+		{"email", database.OrderSearch{Email: "other@example.com"}, []string{"order-a"}},
+		{"status", database.OrderSearch{Status: models.StatusPaid, Ascending: true}, []string{"order-b", "order-c", "order-d", "order-e"}},
+		{"product", database.OrderSearch{ProductID: "PRODUCT-1"}, []string{"order-a"}},
+		{"dates", database.OrderSearch{Dates: database.DateRange{
+			From: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC),
+		}}, []string{"order-c", "order-b"}},
+		{"total range", database.OrderSearch{Currency: "USD", MinTotal: &database.Amount{Units: 20}, MaxTotal: &database.Amount{Units: 40},
+			SortBy: database.SortByTotal}, []string{"order-d", "order-c", "order-b"}},
+		{"other currency", database.OrderSearch{Currency: "EUR", MinTotal: &database.Amount{}}, []string{}},
+	} {
+		orders, next, err := orderService.SearchOrders(ctx, tc.search, "", 10)
+		if err != nil {
+			t.Fatalf("%s: failed to search orders: %v", tc.name, err)
+		}
+		if got := orderIDs(orders); next != "" || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOrderService_SearchOrders_Pages(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	saveSearchOrders(t, mockDB)
+	ctx := context.Background()
+
+	for _, search := range []database.OrderSearch{
+		{SortBy: database.SortByDate},
+		{SortBy: database.SortByTotal, Ascending: true},
+	} {
+		var seen []string
+		token := ""
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatal("Expected 3 pages")
+			}
+			orders, next, err := orderService.SearchOrders(ctx, search, token, 2)
+			if err != nil {
+				t.Fatalf("Failed to get page %d: %v", pages, err)
+			}
+			seen = append(seen, orderIDs(orders)...)
+			if next == "" {
+				break
+			}
+			token = next
+		}
+		want := []string{"order-e", "order-d", "order-c", "order-b", "order-a"}
+		if search.Ascending {
+			want = []string{"order-a", "order-b", "order-c", "order-d", "order-e"}
+		}
+		if fmt.Sprint(seen) != fmt.Sprint(want) {
+			t.Fatalf("Sorted by %v: got %v, want %v", search.SortBy, seen, want)
+		}
+
+		// A token only continues a search sorted the same way.
+		if _, _, err := orderService.SearchOrders(ctx, database.OrderSearch{SortBy: 1 - search.SortBy}, token, 2); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("Expected ErrInvalidPageToken for a token of another sort, got %v", err)
+		}
+	}
+
+	for _, token := range []string{"not base64!", "eA", encodePageToken(database.OrderCursor{OrderDate: time.Now(), OrderID: "order-a"})} {
+		if _, _, err := orderService.SearchOrders(ctx, database.OrderSearch{SortBy: database.SortByTotal}, token, 2); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("Token %q: expected ErrInvalidPageToken, got %v", token, err)
+		}
+	}
+	dates := database.DateRange{From: time.Now(), To: time.Now().Add(-time.Hour)}
+	if _, _, err := orderService.SearchOrders(ctx, database.OrderSearch{Dates: dates}, "", 2); !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("Expected ErrInvalidDateRange, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateShipment records a shipment of items, identified by product, of an
+// order. The error wraps database.ErrOrderNotFound for an unknown order,
+// models.ErrNotShippable for an order that is not paid or shipped, and
+// models.ErrInvalidShipment for a shipment without a tracking ID or of items
+// that are not in the order or were already shipped.
+func (os *OrderService) CreateShipment(ctx context.Context, orderID, trackingID, carrier string, items []models.ShipmentItem) (*models.Shipment, error) {
+	if strings.TrimSpace(trackingID) == "" {
+		return nil, fmt.Errorf("%w: tracking ID is required", models.ErrInvalidShipment)
+	}
+
+	s := &models.Shipment{
+		ShipmentID: uuid.NewString(),
+		OrderID:    orderID,
+		TrackingID: trackingID,
+		Carrier:    carrier,
+		Items:      items,
+	}
+	if err := os.db.CreateShipment(ctx, s); err != nil {
+		return nil, fmt.Errorf("failed to create shipment: %w", err)
+	}
+
+	os.log.Infof("shipment %s of order %s created with %d items", s.ShipmentID, orderID, len(s.Items))
+	return s, nil
+}
+
+// UpdateShipmentStatus moves a shipment to a new status. The error wraps
+// database.ErrShipmentNotFound for an unknown shipment and
+// models.ErrNotShippable for a status the shipment may not move to.
+func (os *OrderService) UpdateShipmentStatus(ctx context.Context, shipmentID, status string) (*models.Shipment, error) {
+	s, err := os.db.UpdateShipmentStatus(ctx, shipmentID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update shipment status: %w", err)
+	}
+
+	os.log.Infof("shipment %s is now %s", shipmentID, status)
+	return s, nil
+}
+
+// GetShipments returns the shipments of one of the user's orders, oldest
+// first, and the fulfillment of each of its items. The error wraps
+// database.ErrOrderNotFound for an unknown order or one of another user.
+func (os *OrderService) GetShipments(ctx context.Context, userID, orderID string) ([]models.Shipment, []models.ItemFulfillment, error) {
+	order, items, err := os.GetOrderDetails(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.UserID != userID {
+		return nil, nil, fmt.Errorf("failed to get order: %w", database.ErrOrderNotFound)
+	}
+
+	shipments, err := os.db.GetShipments(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get shipments: %w", err)
+	}
+	return shipments, models.Fulfillment(items, shipments), nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+)
+
+func TestOrderService_Shipments(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(ctx, orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	orderID := orderResult.OrderId
+
+	// PRODUCT-1 was ordered twice and PRODUCT-2 once; the first warehouse
+	// ships one PRODUCT-1 and the PRODUCT-2.
+	first, err := orderService.CreateShipment(ctx, orderID, "TRACK-1", "UPS", []models.ShipmentItem{
+		{ProductID: "PRODUCT-1", Quantity: 1}, {ProductID: "PRODUCT-2", Quantity: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shipment: %v", err)
+	}
+	if first.ShipmentID == "" || first.Status != models.ShipmentShipped || first.Items[0].OrderItemID == 0 {
+		t.Fatalf("Unexpected shipment %+v", first)
+	}
+	if _, err := orderService.CreateShipment(ctx, orderID, "TRACK-2", "", []models.ShipmentItem{{ProductID: "PRODUCT-1", Quantity: 1}}); err != nil {
+		t.Fatalf("Failed to create second shipment: %v", err)
+	}
+	if _, err := orderService.UpdateShipmentStatus(ctx, first.ShipmentID, models.ShipmentDelivered); err != nil {
+		t.Fatalf("Failed to deliver shipment: %v", err)
+	}
+
+	shipments, fulfillment, err := orderService.GetShipments(ctx, userID, orderID)
+	if err != nil {
+		t.Fatalf("Failed to get shipments: %v", err)
+	}
+	if len(shipments) != 2 || shipments[0].Status != models.ShipmentDelivered || shipments[1].TrackingID != "TRACK-2" {
+		t.Errorf("Unexpected shipments %+v", shipments)
+	}
+	if len(fulfillment) != 2 || fulfillment[0].Status() != models.FulfillmentShipped || fulfillment[1].Status() != models.FulfillmentDelivered {
+		t.Errorf("Unexpected fulfillment %+v", fulfillment)
+	}
+
+	if _, _, err := orderService.GetShipments(ctx, "other-user", orderID); !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound for another user's order, got %v", err)
+	}
+	if _, err := orderService.UpdateShipmentStatus(ctx, first.ShipmentID, models.ShipmentShipped); !errors.Is(err, models.ErrNotShippable) {
+		t.Errorf("Expected ErrNotShippable moving a delivered shipment back, got %v", err)
+	}
+	if _, err := orderService.UpdateShipmentStatus(ctx, "unknown", models.ShipmentDelivered); !errors.Is(err, database.ErrShipmentNotFound) {
+		t.Errorf("Expected ErrShipmentNotFound, got %v", err)
+	}
+}
+
+func TestOrderService_CreateShipment_Invalid(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(ctx, orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	orderID := orderResult.OrderId
+
+	for _, tc := range []struct {
+		name       string
+		trackingID string
+		items      []models.ShipmentItem
+	}{
+		{"no tracking ID", "", []models.ShipmentItem{{ProductID: "PRODUCT-2", Quantity: 1}}},
+		{"no items", "TRACK-1", nil},
+		{"unknown product", "TRACK-1", []models.ShipmentItem{{ProductID: "PRODUCT-9", Quantity: 1}}},
+		{"zero quantity", "TRACK-1", []models.ShipmentItem{{ProductID: "PRODUCT-2", Quantity: 0}}},
+		{"more than ordered", "TRACK-1", []models.ShipmentItem{{ProductID: "PRODUCT-2", Quantity: 2}}},
+		{"listed twice", "TRACK-1", []models.ShipmentItem{{ProductID: "PRODUCT-2", Quantity: 1}, {ProductID: "PRODUCT-2", Quantity: 1}}},
+	} {
+		if _, err := orderService.CreateShipment(ctx, orderID, tc.trackingID, "", tc.items); !errors.Is(err, models.ErrInvalidShipment) {
+			t.Errorf("%s: expected ErrInvalidShipment, got %v", tc.name, err)
+		}
+	}
+
+	if _, err := orderService.CancelOrder(ctx, userID, orderID, ""); err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+	if _, err := orderService.CreateShipment(ctx, orderID, "TRACK-1", "", []models.ShipmentItem{{ProductID: "PRODUCT-2", Quantity: 1}}); !errors.Is(err, models.ErrNotShippable) {
+		t.Errorf("Expected ErrNotShippable for a cancelled order, got %v", err)
+	}
+	if _, err := orderService.CreateShipment(ctx, "unknown", "TRACK-1", "", []models.ShipmentItem{{ProductID: "PRODUCT-2", Quantity: 1}}); !errors.Is(err, database.ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/google/uuid"
+)
+
+// UserDataExport is a user's order history and saved addresses, as exported
+// for a data portability request.
+type UserDataExport struct {
+	UserID     string                `json:"user_id"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Orders     []OrderExport         `json:"orders"` // newest first
+	Addresses  []models.SavedAddress `json:"addresses"`
+}
+
+// OrderExport is an order with its items in a UserDataExport.
+type OrderExport struct {
+	models.Order
+	Items []models.OrderItem `json:"items"`
+}
+
+// ExportUserData collects all of a user's orders with their items, and their
+// saved addresses.
+func (os *OrderService) ExportUserData(ctx context.Context, userID string) (*UserDataExport, error) {
+	export := &UserDataExport{UserID: userID, ExportedAt: time.Now().UTC(), Orders: []OrderExport{}}
+	var after *database.OrderCursor
+	for {
+		orders, err := os.db.GetOrdersPage(ctx, userID, database.DateRange{}, after, MaxOrderPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user orders: %w", err)
+		}
+		for _, order := range orders {
+			items, err := os.db.GetOrderItems(ctx, order.OrderID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get order items: %w", err)
+			}
+			export.Orders = append(export.Orders, OrderExport{Order: order, Items: items})
+		}
+		if len(orders) < MaxOrderPageSize {
+			break
+		}
+		last := orders[len(orders)-1]
+		after = &database.OrderCursor{OrderDate: last.OrderDate, OrderID: last.OrderID}
+	}
+	addrs, err := os.db.ListAddresses(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user addresses: %w", err)
+	}
+	export.Addresses = append([]models.SavedAddress{}, addrs...)
+
+	os.log.Infof("exported %d orders of user %s", len(export.Orders), userID)
+	return export, nil
+}
+
+// DeleteUserData erases a user's personal data from their orders, keeping
+// the orders themselves, with their totals and items, as financial records
+// under a random pseudonym. It returns how many orders were anonymized.
+func (os *OrderService) DeleteUserData(ctx context.Context, userID string) (int, error) {
+	n, err := os.db.AnonymizeUserData(ctx, userID, "deleted-"+uuid.NewString())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete user data: %w", err)
+	}
+
+	os.log.Infof("anonymized %d orders of user %s", n, userID)
+	return n, nil
+}
+
+// ClaimOrders moves the orders placed without a user ID (guest checkout)
+// with email to the user, so they show in the user's order history. The
+// caller must have verified that the user owns the email. It returns the IDs
+// of the orders claimed.
+func (os *OrderService) ClaimOrders(ctx context.Context, userID, email string) ([]string, error) {
+	orderIDs, err := os.db.ClaimGuestOrders(ctx, userID, strings.TrimSpace(email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim guest orders: %w", err)
+	}
+
+	os.log.Infof("user %s claimed %d guest orders", userID, len(orderIDs))
+	return orderIDs, nil
+}
+
+// JSON encodes the export as indented JSON.
+func (e *UserDataExport) JSON() ([]byte, error) {
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// csvHeader names the columns of UserDataExport.CSV.
+var csvHeader = []string{
+	"order_id", "order_date", "status", "email", "shipping_address", "shipping_tracking_id",
+	"order_total", "currency", "product_id", "quantity", "unit_price", "item_total",
+}
+
+// CSV encodes the export with a row per order item, repeating the order's
+// columns on each. An order without items has one row with empty item
+// columns. Amounts are decimals in the order's currency.
+func (e *UserDataExport) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(csvHeader)
+	for _, o := range e.Orders {
+		order := []string{
+			o.OrderID,
+			o.OrderDate.UTC().Format(time.RFC3339),
+			o.Status,
+			o.Email,
+			o.ShippingAddress,
+			o.ShippingTrackingID,
+			formatAmount(o.TotalAmountUnits, o.TotalAmountNanos),
+			o.TotalAmountCurrency,
+		}
+		if len(o.Items) == 0 {
+			w.Write(append(order, "", "", "", ""))
+		}
+		for _, item := range o.Items {
+			w.Write(append(order[:len(order):len(order)],
+				item.ProductID,
+				strconv.Itoa(int(item.Quantity)),
+				formatAmount(item.UnitPriceUnits, item.UnitPriceNanos),
+				formatAmount(item.TotalPriceUnits, item.TotalPriceNanos),
+			))
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// formatAmount formats units and nanos as a decimal with at least two
+// fractional digits, such as "15.99" or "0.005".
+func formatAmount(units int64, nanos int32) string {
+	sign := ""
+	if units < 0 || nanos < 0 {
+		sign = "-"
+		units, nanos = -units, -nanos
+	}
+	frac := strings.TrimRight(fmt.Sprintf("%09d", nanos), "0")
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	return fmt.Sprintf("%s%d.%s", sign, units, frac)
+}
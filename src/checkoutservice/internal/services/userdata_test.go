@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOrderService_ExportUserData(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(context.Background(), orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	if _, err := orderService.AddAddress(context.Background(), userID, orderResult.ShippingAddress, false); err != nil {
+		t.Fatalf("Failed to add address: %v", err)
+	}
+
+	export, err := orderService.ExportUserData(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Failed to export user data: %v", err)
+	}
+	if len(export.Orders) != 1 || len(export.Orders[0].Items) != 2 || export.Orders[0].Email != email {
+		t.Fatalf("Unexpected export %+v", export)
+	}
+	if len(export.Addresses) != 1 || export.Addresses[0].StreetAddress != orderResult.ShippingAddress.StreetAddress {
+		t.Errorf("Expected the saved address in the export, got %+v", export.Addresses)
+	}
+
+	data, err := export.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		UserID string `json:"user_id"`
+		Orders []struct {
+			OrderID string `json:"order_id"`
+			Items   []struct {
+				ProductID string `json:"product_id"`
+			} `json:"items"`
+		} `json:"orders"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if decoded.UserID != userID || decoded.Orders[0].OrderID != orderResult.OrderId || decoded.Orders[0].Items[1].ProductID != "PRODUCT-2" {
+		t.Errorf("Unexpected JSON export %s", data)
+	}
+
+	data, err = export.CSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("Expected a header and a row per item, got %v", rows)
+	}
+	// order_total, currency, product_id, quantity, unit_price, item_total
+	if got := strings.Join(rows[1][6:], ","); got != "71.96,USD,PRODUCT-1,2,15.99,31.98" {
+		t.Errorf("Unexpected first item row %q", got)
+	}
+
+	export, err = orderService.ExportUserData(context.Background(), "user-without-orders")
+	if err != nil {
+		t.Fatalf("Failed to export user data: %v", err)
+	}
+	if data, _ := export.JSON(); !strings.Contains(string(data), `"orders": []`) || !strings.Contains(string(data), `"addresses": []`) {
+		t.Errorf("Expected empty order and address lists, got %s", data)
+	}
+}
+
+func TestOrderService_DeleteUserData(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+
+	ctx := context.Background()
+	orderResult, total, email, userID := createTestOrderResult()
+	if err := placeOrder(ctx, orderService, orderResult, email, userID, total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+	if _, err := orderService.AddAddress(ctx, userID, orderResult.ShippingAddress, false); err != nil {
+		t.Fatalf("Failed to add address: %v", err)
+	}
+
+	n, err := orderService.DeleteUserData(ctx, userID)
+	if err != nil || n != 1 {
+		t.Fatalf("DeleteUserData = %d, %v; want 1 order anonymized", n, err)
+	}
+	if orders, _, _ := orderService.GetUserOrderHistory(ctx, userID); len(orders) != 0 {
+		t.Errorf("Expected no orders left for the user, got %d", len(orders))
+	}
+	if addrs, _ := orderService.ListAddresses(ctx, userID); len(addrs) != 0 {
+		t.Errorf("Expected the saved addresses to be deleted, got %+v", addrs)
+	}
+
+	// The order and its totals are kept without personal data.
+	order, items, err := orderService.GetOrderDetails(ctx, orderResult.OrderId)
+	if err != nil {
+		t.Fatalf("Failed to get order details: %v", err)
+	}
+	if !strings.HasPrefix(order.UserID, "deleted-") || order.Email != "" || order.ShippingAddress != "" {
+		t.Errorf("Expected an anonymized order, got %+v", order)
+	}
+	if order.TotalAmountUnits != total.Units || len(items) != 2 {
+		t.Errorf("Expected the totals and items to be kept, got %+v with %d items", order, len(items))
+	}
+}
+
+func TestOrderService_ClaimOrders(t *testing.T) {
+	orderService, mockDB := setupTestOrderService()
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	// A guest order and an order of another user with the same email.
+	guestOrder, total, email, _ := createTestOrderResult()
+	if err := placeOrder(ctx, orderService, guestOrder, email, "", total); err != nil {
+		t.Fatalf("Failed to save guest order: %v", err)
+	}
+	userOrder, total, _, _ := createTestOrderResult()
+	if err := placeOrder(ctx, orderService, userOrder, email, "other-user", total); err != nil {
+		t.Fatalf("Failed to save order: %v", err)
+	}
+
+	orderIDs, err := orderService.ClaimOrders(ctx, "new-user", " "+strings.ToUpper(email))
+	if err != nil {
+		t.Fatalf("Failed to claim orders: %v", err)
+	}
+	if len(orderIDs) != 1 || orderIDs[0] != guestOrder.OrderId {
+		t.Fatalf("Expected only the guest order to be claimed, got %v", orderIDs)
+	}
+	if orders, _, _ := orderService.GetUserOrderHistory(ctx, "new-user"); len(orders) != 1 || orders[0].OrderID != guestOrder.OrderId {
+		t.Errorf("Expected the claimed order in the user's history, got %+v", orders)
+	}
+	if orders, _, _ := orderService.GetUserOrderHistory(ctx, "other-user"); len(orders) != 1 {
+		t.Errorf("Expected the other user to keep their order, got %d", len(orders))
+	}
+
+	if orderIDs, err := orderService.ClaimOrders(ctx, "another-user", email); err != nil || len(orderIDs) != 0 {
+		t.Errorf("Expected nothing left to claim, got %v, %v", orderIDs, err)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	for _, tt := range []struct {
+		units int64
+		nanos int32
+		want  string
+	}{
+		{15, 990000000, "15.99"},
+		{3, 0, "3.00"},
+		{0, 5000000, "0.005"},
+		{-2, -500000000, "-2.50"},
+	} {
+		if got := formatAmount(tt.units, tt.nanos); got != tt.want {
+			t.Errorf("formatAmount(%d, %d) = %q, want %q", tt.units, tt.nanos, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWindow  = 60 * time.Second
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// WindowFromEnv returns how long to keep retrying dependencies at startup,
+// read from STARTUP_WAIT_TIMEOUT (default 60s).
+func WindowFromEnv() (time.Duration, error) {
+	s := os.Getenv("STARTUP_WAIT_TIMEOUT")
+	if s == "" {
+		return defaultWindow, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("failed to parse STARTUP_WAIT_TIMEOUT (%s) as a non-negative time.Duration", s)
+	}
+	return v, nil
+}
+
+type permanentError struct{ err error }
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// Permanent marks err as not worth retrying. Retry returns it immediately.
+func Permanent(err error) error { return permanentError{err} }
+
+// Retry calls fn until it succeeds, returns a Permanent error, or window
+// elapses, sleeping with exponential backoff between attempts. It returns the
+// last error from fn.
+func Retry(ctx context.Context, log *logrus.Logger, name string, window time.Duration, fn func() error) error {
+	deadline := time.Now().Add(window)
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				log.Infof("%s became available after %d attempts", name, attempt)
+			}
+			return nil
+		}
+		var p permanentError
+		if errors.As(err, &p) {
+			return p.err
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("%s unavailable after %d attempts: %w", name, attempt, err)
+		}
+		log.Warnf("%s not available yet (attempt %d), retrying in %v: %v", name, attempt, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
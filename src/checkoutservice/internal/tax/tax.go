@@ -0,0 +1,127 @@
+// Package tax calculates the tax on orders at checkout. The Calculator is
+// pluggable: Rates charges configured percentages by shipping country and
+// state, and None, the default, charges no tax.
+package tax
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+// Line is the tax of one jurisdiction.
+type Line struct {
+	Jurisdiction string
+	Amount       *pb.Money
+}
+
+// Result is the tax on an order. Total is the sum of the lines, in the
+// currency of the taxed amount; it is zero when no jurisdiction taxes the
+// order.
+type Result struct {
+	Total *pb.Money
+	Lines []Line
+}
+
+// Calculator calculates the tax on taxable, the amount of an order subject to
+// tax, shipped to address. A Calculator is called before the order is
+// charged and saved, so its tax is part of both.
+type Calculator interface {
+	Calculate(ctx context.Context, address *pb.Address, taxable *pb.Money) (Result, error)
+}
+
+// None charges no tax.
+type None struct{}
+
+// Calculate returns a zero tax in the currency of taxable.
+func (None) Calculate(_ context.Context, _ *pb.Address, taxable *pb.Money) (Result, error) {
+	return Result{Total: &pb.Money{CurrencyCode: taxable.GetCurrencyCode()}}, nil
+}
+
+func (None) String() string { return "none" }
+
+// Rates charges a percentage of the taxable amount per jurisdiction. A
+// jurisdiction is a country, as written in shipping addresses, or a state of
+// one as "country/state"; both are matched case-insensitively. An order pays
+// the rate of its country and that of its state, as separate lines, when
+// they are configured.
+type Rates struct {
+	// BasisPoints maps jurisdictions, in lower case, to hundredths of a
+	// percent.
+	BasisPoints map[string]int64
+}
+
+func (r *Rates) String() string {
+	rates := make([]string, 0, len(r.BasisPoints))
+	for j, bp := range r.BasisPoints {
+		rates = append(rates, fmt.Sprintf("%s=%s%%", j, strconv.FormatFloat(float64(bp)/100, 'f', -1, 64)))
+	}
+	sort.Strings(rates)
+	return strings.Join(rates, ", ")
+}
+
+// Calculate returns a line for each configured jurisdiction of address, each
+// rounded to the nearest cent.
+func (r *Rates) Calculate(_ context.Context, address *pb.Address, taxable *pb.Money) (Result, error) {
+	res := Result{Total: &pb.Money{CurrencyCode: taxable.GetCurrencyCode()}}
+	country := strings.ToLower(strings.TrimSpace(address.GetCountry()))
+	state := strings.ToLower(strings.TrimSpace(address.GetState()))
+	for _, j := range []string{country, country + "/" + state} {
+		bp, ok := r.BasisPoints[j]
+		if !ok || country == "" || strings.HasSuffix(j, "/") {
+			continue
+		}
+		amount := basisPointsOf(taxable, bp)
+		units, nanos := res.Total.GetUnits()+amount.GetUnits(), int64(res.Total.GetNanos())+int64(amount.GetNanos())
+		res.Total.Units, res.Total.Nanos = units+nanos/1e9, int32(nanos%1e9)
+		res.Lines = append(res.Lines, Line{Jurisdiction: j, Amount: amount})
+	}
+	return res, nil
+}
+
+// basisPointsOf returns bp hundredths of a percent of m, rounded half away
+// from zero to whole cents. m must not be negative.
+func basisPointsOf(m *pb.Money, bp int64) *pb.Money {
+	const cent = 10000000 // in nanos
+	n := new(big.Int).Mul(big.NewInt(m.GetUnits()), big.NewInt(1e9))
+	n.Add(n, big.NewInt(int64(m.GetNanos())))
+	n.Mul(n, big.NewInt(bp))
+	n.Add(n, big.NewInt(10000*cent/2))
+	n.Quo(n, big.NewInt(10000*cent))
+	n.Mul(n, big.NewInt(cent))
+	units, nanos := new(big.Int).QuoRem(n, big.NewInt(1e9), new(big.Int))
+	return &pb.Money{CurrencyCode: m.GetCurrencyCode(), Units: units.Int64(), Nanos: int32(nanos.Int64())}
+}
+
+// FromEnv builds the Calculator from TAX_RATES, a comma-separated list of
+// JURISDICTION=PERCENT entries such as "United States/CA=7.25,Germany=19".
+// Percentages may have up to two decimals. It returns None when TAX_RATES is
+// unset.
+func FromEnv() (Calculator, error) {
+	s := os.Getenv("TAX_RATES")
+	if s == "" {
+		return None{}, nil
+	}
+	r := &Rates{BasisPoints: make(map[string]int64)}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		j, p, ok := strings.Cut(entry, "=")
+		j = strings.ToLower(strings.TrimSpace(j))
+		percent, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		bp := math.Round(percent * 100)
+		if !ok || j == "" || err != nil || percent <= 0 || percent > 100 || math.Abs(bp-percent*100) > 1e-6 {
+			return nil, fmt.Errorf("TAX_RATES entry %q must be JURISDICTION=PERCENT with a percentage above 0, at most 100 and with up to two decimals", entry)
+		}
+		r.BasisPoints[j] = int64(bp)
+	}
+	return r, nil
+}
@@ -0,0 +1,72 @@
+package tax
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+)
+
+func TestFromEnv(t *testing.T) {
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(None); !ok {
+		t.Errorf("FromEnv() = %v, want None without TAX_RATES", c)
+	}
+
+	t.Setenv("TAX_RATES", "United States/CA=7.25, Germany = 19,")
+	if c, err = FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.(*Rates).String(); got != "germany=19%, united states/ca=7.25%" {
+		t.Errorf("FromEnv() = %s", got)
+	}
+
+	for _, value := range []string{"Germany", "=19", "Germany=0", "Germany=101", "Germany=7.125", "Germany=high"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("TAX_RATES", value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), "TAX_RATES") {
+				t.Errorf("FromEnv() error = %v, want one naming TAX_RATES", err)
+			}
+		})
+	}
+}
+
+func TestRates(t *testing.T) {
+	r := &Rates{BasisPoints: map[string]int64{"united states": 100, "united states/ca": 725, "germany": 1900}}
+	taxable := &pb.Money{CurrencyCode: "USD", Units: 61, Nanos: 970000000}
+
+	// 1% is $0.6197 and 7.25% is $4.492825, each rounded to the cent.
+	res, err := r.Calculate(context.Background(), &pb.Address{Country: "United States", State: "ca"}, taxable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Lines) != 2 || res.Lines[0].Jurisdiction != "united states" || res.Lines[0].Amount.Nanos != 620000000 ||
+		res.Lines[1].Jurisdiction != "united states/ca" || res.Lines[1].Amount.Units != 4 || res.Lines[1].Amount.Nanos != 490000000 {
+		t.Errorf("Unexpected lines %+v", res.Lines)
+	}
+	if res.Total.CurrencyCode != "USD" || res.Total.Units != 5 || res.Total.Nanos != 110000000 {
+		t.Errorf("Expected a total of USD 5.11, got %v", res.Total.String())
+	}
+
+	// Half a cent rounds up: 19% of 0.50 EUR is 0.095 EUR.
+	res, _ = r.Calculate(context.Background(), &pb.Address{Country: "Germany"}, &pb.Money{CurrencyCode: "EUR", Nanos: 500000000})
+	if len(res.Lines) != 1 || res.Total.Units != 0 || res.Total.Nanos != 100000000 {
+		t.Errorf("Expected EUR 0.10, got %+v", res)
+	}
+
+	res, _ = r.Calculate(context.Background(), &pb.Address{Country: "France"}, taxable)
+	if len(res.Lines) != 0 || res.Total.CurrencyCode != "USD" || res.Total.Units != 0 || res.Total.Nanos != 0 {
+		t.Errorf("Expected no tax for an unconfigured country, got %+v", res)
+	}
+}
+
+func TestNone(t *testing.T) {
+	res, err := None{}.Calculate(context.Background(), &pb.Address{Country: "Germany"}, &pb.Money{CurrencyCode: "EUR", Units: 10})
+	if err != nil || len(res.Lines) != 0 || res.Total.CurrencyCode != "EUR" || res.Total.Units != 0 {
+		t.Errorf("None.Calculate() = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,270 @@
+// Package webhooks delivers order events (placed, shipped, cancelled) to
+// the HTTP endpoints of external systems such as ERPs and fulfillment
+// partners. Each delivery is a POST of a JSON payload signed with HMAC-SHA256,
+// retried with backoff until the endpoint accepts it.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/delivery"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// requestTimeout bounds one POST to an endpoint.
+const requestTimeout = 10 * time.Second
+
+// Headers of a webhook request. The signature is "sha256=" and the hex
+// HMAC-SHA256, keyed with the shared secret, of the timestamp, a ".", and the
+// body.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Config holds the webhook settings.
+type Config struct {
+	Endpoints []string // URLs every event is POSTed to
+	Secret    string   // HMAC key shared with the endpoints
+	// Schedule's interval is how often new events and due deliveries are
+	// checked.
+	delivery.Schedule
+}
+
+func (c *Config) String() string {
+	if c == nil {
+		return "disabled"
+	}
+	return fmt.Sprintf("%d endpoints, %s", len(c.Endpoints), c.Schedule)
+}
+
+// FromEnv builds a Config from the environment:
+//
+//	WEBHOOK_ENDPOINTS     comma-separated http(s) URLs (default none)
+//	WEBHOOK_SECRET        HMAC signing key, required with endpoints
+//	WEBHOOK_INTERVAL      how often events and deliveries are checked (default 5s)
+//	WEBHOOK_BATCH_SIZE    deliveries per check, at most 100 (default 20)
+//	WEBHOOK_MAX_ATTEMPTS  attempts before a delivery is marked failed (default 8)
+//	WEBHOOK_BACKOFF       delay after the first failed attempt (default 30s)
+//
+// Without endpoints it returns nil and no webhooks are sent.
+func FromEnv() (*Config, error) {
+	var endpoints []string
+	for _, e := range strings.Split(os.Getenv("WEBHOOK_ENDPOINTS"), ",") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		u, err := url.Parse(e)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("WEBHOOK_ENDPOINTS: %q is not an http(s) URL", e)
+		}
+		endpoints = append(endpoints, e)
+	}
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+
+	c := &Config{
+		Endpoints: endpoints,
+		Secret:    os.Getenv("WEBHOOK_SECRET"),
+	}
+	if c.Secret == "" {
+		return nil, fmt.Errorf("WEBHOOK_ENDPOINTS needs WEBHOOK_SECRET to sign payloads")
+	}
+	s, err := delivery.ScheduleFromEnv("WEBHOOK",
+		delivery.Schedule{Interval: 5 * time.Second, BatchSize: 20, MaxAttempts: 8, Backoff: 30 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	c.Schedule = s
+	return c, nil
+}
+
+// Store holds the order events and their webhook deliveries.
+type Store interface {
+	QueueWebhooks(ctx context.Context, endpoints []string, limit int) (int, error)
+	DeliverWebhooks(ctx context.Context, limit int, lease time.Duration, deliver func(models.WebhookDelivery) error, retryIn func(attempts int) (time.Duration, bool)) (int, error)
+}
+
+// Dispatcher queues new order events for every endpoint and delivers them.
+// Delivery is at least once, so endpoints should ignore repeated event IDs.
+type Dispatcher struct {
+	config *Config
+	log    *logrus.Logger
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewDispatcher returns a Dispatcher for config, which must not be nil.
+func NewDispatcher(config *Config, log *logrus.Logger) *Dispatcher {
+	return &Dispatcher{
+		config: config,
+		log:    log,
+		client: &http.Client{Timeout: requestTimeout},
+		now:    time.Now,
+	}
+}
+
+// Run queues and delivers webhooks every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, store Store) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := d.Drain(ctx, store); err != nil {
+			d.log.Warnf("failed to deliver webhooks: %v", err)
+		}
+	}
+}
+
+// Drain queues every new event and then delivers batches of due webhooks
+// until none are left.
+func (d *Dispatcher) Drain(ctx context.Context, store Store) error {
+	for {
+		n, err := store.QueueWebhooks(ctx, d.config.Endpoints, d.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		if n < d.config.BatchSize {
+			break
+		}
+	}
+	for {
+		tried := 0
+		delivered, err := store.DeliverWebhooks(ctx, d.config.BatchSize, d.lease(), func(w models.WebhookDelivery) error {
+			tried++
+			return d.deliver(ctx, w)
+		}, d.config.RetryIn)
+		if err != nil {
+			return err
+		}
+		if delivered > 0 {
+			d.log.Infof("delivered %d webhooks", delivered)
+		}
+		if tried < d.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// Payload is the JSON body of a webhook. Order is the order when the webhook
+// is sent, so a retried delivery may show a later status than the event.
+type Payload struct {
+	ID             string       `json:"id"`
+	Type           string       `json:"type"`
+	CreatedAt      time.Time    `json:"created_at"`
+	PreviousStatus string       `json:"previous_status,omitempty"`
+	Reason         string       `json:"reason,omitempty"`
+	Order          OrderPayload `json:"order"`
+}
+
+// OrderPayload is the order in a Payload.
+type OrderPayload struct {
+	OrderID            string    `json:"order_id"`
+	UserID             string    `json:"user_id"`
+	Status             string    `json:"status"`
+	Total              Money     `json:"total"`
+	ShippingTrackingID string    `json:"shipping_tracking_id"`
+	OrderTime          time.Time `json:"order_time"`
+}
+
+// Money is an amount in a Payload, as in the Money message.
+type Money struct {
+	CurrencyCode string `json:"currency_code"`
+	Units        int64  `json:"units"`
+	Nanos        int32  `json:"nanos"`
+}
+
+// payload builds the Payload of an event.
+func payload(e models.OrderEvent) Payload {
+	return Payload{
+		ID:             strconv.FormatInt(e.ID, 10),
+		Type:           e.Type,
+		CreatedAt:      e.CreatedAt.UTC(),
+		PreviousStatus: e.FromStatus,
+		Reason:         e.Reason,
+		Order: OrderPayload{
+			OrderID: e.Order.OrderID,
+			UserID:  e.Order.UserID,
+			Status:  e.Order.Status,
+			Total: Money{
+				CurrencyCode: e.Order.TotalAmountCurrency,
+				Units:        e.Order.TotalAmountUnits,
+				Nanos:        e.Order.TotalAmountNanos,
+			},
+			ShippingTrackingID: e.Order.ShippingTrackingID,
+			OrderTime:          e.Order.OrderDate.UTC(),
+		},
+	}
+}
+
+// Sign returns the signature header value of a body sent at timestamp, in
+// Unix seconds, for secret. Endpoints verify webhooks by computing it and
+// comparing with hmac.Equal.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// lease returns how long a batch of deliveries is claimed for: long enough to
+// POST all of them, each bounded by requestTimeout, with a minute to spare.
+func (d *Dispatcher) lease() time.Duration {
+	return time.Duration(d.config.BatchSize)*requestTimeout + time.Minute
+}
+
+// deliver POSTs one webhook, within requestTimeout. Any 2xx response accepts
+// it.
+func (d *Dispatcher) deliver(ctx context.Context, w models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	p := payload(w.Event)
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %v", err)
+	}
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, p.Type)
+	req.Header.Set(HeaderID, p.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(d.config.Secret, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/delivery"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("WEBHOOK_ENDPOINTS", "")
+	if c, err := FromEnv(); c != nil || err != nil {
+		t.Errorf("FromEnv() = %v, %v; want nil, nil", c, err)
+	}
+
+	t.Setenv("WEBHOOK_ENDPOINTS", "https://erp.example.com/hooks, http://partner.example.com/orders")
+	t.Setenv("WEBHOOK_SECRET", "s3cret")
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Endpoints) != 2 || c.Endpoints[1] != "http://partner.example.com/orders" || c.Secret != "s3cret" ||
+		c.Interval != 5*time.Second || c.BatchSize != 20 || c.MaxAttempts != 8 || c.Backoff != 30*time.Second {
+		t.Errorf("FromEnv() = %+v", c)
+	}
+
+	for env, value := range map[string]string{
+		"WEBHOOK_ENDPOINTS":    "ftp://erp.example.com",
+		"WEBHOOK_SECRET":       "",
+		"WEBHOOK_INTERVAL":     "0s",
+		"WEBHOOK_BATCH_SIZE":   "101",
+		"WEBHOOK_MAX_ATTEMPTS": "none",
+		"WEBHOOK_BACKOFF":      "later",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("FromEnv() error = %v, want one naming %s", err, env)
+			}
+		})
+	}
+}
+
+func TestRetryIn(t *testing.T) {
+	c := &Config{Schedule: delivery.Schedule{MaxAttempts: 4, Backoff: 20 * time.Minute}}
+	for attempts, want := range map[int]time.Duration{1: 20 * time.Minute, 2: 40 * time.Minute, 3: time.Hour} {
+		if got, ok := c.RetryIn(attempts); !ok || got != want {
+			t.Errorf("RetryIn(%d) = %v, %v; want %v, true", attempts, got, ok, want)
+		}
+	}
+	if _, ok := c.RetryIn(4); ok {
+		t.Error("Expected no retry after MaxAttempts")
+	}
+}
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256 of "1700000000.{}" keyed with "key"
+	want := "sha256=9d713ed406bb7076d4123f0dc2c39d2df5c654ed4b0cd56b52c8b4c940bd63ae"
+	if got := Sign("key", "1700000000", []byte("{}")); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
+
+type request struct {
+	header  http.Header
+	payload Payload
+	body    []byte
+}
+
+func testDispatcher(t *testing.T, handler func(request) int) (*Dispatcher, *database.MockConnection, string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(handler(request{header: r.Header, payload: p, body: body}))
+	}))
+	t.Cleanup(srv.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	d := NewDispatcher(&Config{
+		Endpoints: []string{srv.URL + "/a", srv.URL + "/b"},
+		Secret:    "s3cret",
+		Schedule:  delivery.Schedule{Interval: time.Second, BatchSize: 2, MaxAttempts: 2, Backoff: time.Nanosecond},
+	}, logger)
+	d.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return d, database.NewMockConnection(logger), srv.URL
+}
+
+func TestDrain(t *testing.T) {
+	var requests []request
+	d, db, _ := testDispatcher(t, func(r request) int {
+		requests = append(requests, r)
+		return http.StatusAccepted
+	})
+
+	ctx := context.Background()
+	order := &models.Order{OrderID: "order-1", UserID: "user-1", TotalAmountCurrency: "USD", TotalAmountUnits: 41,
+		ShippingTrackingID: "TRACK-1", Status: models.StatusPaid}
+	if err := db.SaveOrder(ctx, order, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UpdateOrderStatus(ctx, "order-1", models.StatusShipped, "handed to carrier"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Drain(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two events, each sent to both endpoints.
+	if len(requests) != 4 {
+		t.Fatalf("Expected 4 requests, got %d", len(requests))
+	}
+	r := requests[0]
+	if r.header.Get(HeaderEvent) != models.EventOrderPlaced || r.header.Get(HeaderID) != "1" ||
+		r.header.Get(HeaderTimestamp) != "1700000000" {
+		t.Errorf("Unexpected headers %v", r.header)
+	}
+	if want := Sign("s3cret", "1700000000", r.body); !hmac.Equal([]byte(r.header.Get(HeaderSignature)), []byte(want)) {
+		t.Errorf("Signature %q, want %q", r.header.Get(HeaderSignature), want)
+	}
+	shipped := requests[3].payload
+	if shipped.Type != models.EventOrderShipped || shipped.PreviousStatus != models.StatusPaid ||
+		shipped.Reason != "handed to carrier" || shipped.Order.OrderID != "order-1" ||
+		shipped.Order.ShippingTrackingID != "TRACK-1" || shipped.Order.Total.Units != 41 {
+		t.Errorf("Unexpected payload %+v", shipped)
+	}
+
+	// Delivered events are not sent again.
+	if err := d.Drain(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 4 {
+		t.Errorf("Expected no more requests, got %d", len(requests))
+	}
+}
+
+func TestDrainRetriesFailedDeliveries(t *testing.T) {
+	attempts := make(map[string]int)
+	d, db, _ := testDispatcher(t, func(r request) int {
+		attempts[r.header.Get(HeaderID)]++
+		return http.StatusServiceUnavailable
+	})
+
+	ctx := context.Background()
+	if err := db.SaveOrder(ctx, &models.Order{OrderID: "order-1", UserID: "user-1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		time.Sleep(time.Millisecond)
+		if err := d.Drain(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each endpoint had MaxAttempts tries before the delivery failed for good.
+	if attempts["1"] != 4 {
+		t.Errorf("Expected 2 attempts per endpoint, got %d in all", attempts["1"])
+	}
+}
+
+func TestDrainReportsStoreErrors(t *testing.T) {
+	d, db, _ := testDispatcher(t, func(request) int { return http.StatusOK })
+	db.SetShouldError(true)
+	if err := d.Drain(context.Background(), db); err == nil {
+		t.Error("Expected the store error")
+	}
+}
+
+func TestDeliverRejectsNon2xx(t *testing.T) {
+	d, _, url := testDispatcher(t, func(request) int { return http.StatusMovedPermanently })
+	err := d.deliver(context.Background(), models.WebhookDelivery{Endpoint: url, Event: models.OrderEvent{ID: 1}})
+	if err == nil || !strings.Contains(err.Error(), "301") {
+		t.Errorf("Expected a status error, got %v", err)
+	}
+	if err := d.deliver(context.Background(), models.WebhookDelivery{Endpoint: "http://127.0.0.1:0", Event: models.OrderEvent{ID: 1}}); err == nil {
+		t.Error("Expected a connection error")
+	}
+}
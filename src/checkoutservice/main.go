@@ -19,18 +19,35 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/profiler"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/config"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/confirmations"
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/discounts"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/emailclaims"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/featureflags"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/fraud"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/grpcopts"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/orderbuffer"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/orderevents"
 	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/services"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/startup"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/tax"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/webhooks"
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
 	money "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/money"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
@@ -43,11 +60,28 @@ import (
 )
 
 const (
-	listenPort  = "5050"
 	usdCurrency = "USD"
+
+	// readinessService is the health check service name readiness probes ask
+	// for. It reports NOT_SERVING while startup dependencies are awaited.
+	readinessService = "readiness"
+
+	// maxConcurrentItemLookups bounds the per-item catalog and currency calls
+	// issued in parallel while pricing a cart.
+	maxConcurrentItemLookups = 8
+
+	// recordPurchasesTimeout bounds reporting an order's purchases to the
+	// product catalog, which happens after the order is placed.
+	recordPurchasesTimeout = 10 * time.Second
 )
 
-var log *logrus.Logger
+var (
+	log *logrus.Logger
+
+	// grpcConfig holds the keepalive and message size settings shared by the
+	// server and the downstream client connections.
+	grpcConfig grpcopts.Config
+)
 
 func init() {
 	log = logrus.New()
@@ -85,39 +119,92 @@ type checkoutService struct {
 	paymentSvcConn *grpc.ClientConn
 
 	// New: Database and services
-	dbConn       *database.Connection
-	orderService *services.OrderService
+	dbConn        *database.Connection
+	orderService  atomic.Pointer[services.OrderService] // set once the database is reachable
+	orderEvents   *orderevents.Publisher                // nil when order events are not published
+	confirmations *confirmations.Sender                 // sends the emails of saved orders
+	webhooks      *webhooks.Dispatcher                  // nil when no webhook endpoints are configured
+	orderBuffer   *orderbuffer.Buffer                   // nil when orders are not buffered
+	discounts     *discounts.Config                     // nil when no discount codes are configured
+	tax           tax.Calculator                        // calculates the tax added to each order
+	fraud         fraud.Checker                         // nil when orders are not screened for fraud
+	fraudShadow   bool                                  // fraud verdicts are only logged
+	emailClaims   *emailclaims.Config                   // nil when guest orders can't be claimed
+
+	// reservationTimeout is how long an order may stay pending before the
+	// reservation sweep drops it.
+	reservationTimeout time.Duration
+
+	// catalogAdminToken authorizes recording purchases in the product
+	// catalog; purchases are not recorded without it.
+	catalogAdminToken string
+
+	// ready is set once the startup dependency wait has finished.
+	ready atomic.Bool
+}
+
+// reservationSweepInterval is how often orders left pending are looked for.
+const reservationSweepInterval = time.Minute
+
+// adminMethods are the back-office RPCs, which need the admin token; see
+// adminauth.
+var adminMethods = []string{
+	pb.CheckoutService_UpdateOrderStatus_FullMethodName,
+	pb.CheckoutService_ApproveReturn_FullMethodName,
+	pb.CheckoutService_GetOrderByTrackingID_FullMethodName,
+	pb.CheckoutService_CreateShipment_FullMethodName,
+	pb.CheckoutService_UpdateShipmentStatus_FullMethodName,
+	pb.CheckoutService_SearchOrders_FullMethodName,
+	pb.CheckoutService_ExportUserData_FullMethodName,
+	pb.CheckoutService_DeleteUserData_FullMethodName,
 }
 
 func main() {
 	ctx := context.Background()
-	if os.Getenv("ENABLE_TRACING") == "1" {
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	grpcConfig = cfg.GRPC
+	log.Infof("grpc connection settings (%s)", grpcConfig)
+
+	if cfg.Tracing {
 		log.Info("Tracing enabled.")
-		initTracing()
+		initTracing(cfg.CollectorAddr)
 
 	} else {
 		log.Info("Tracing disabled.")
 	}
 
-	if os.Getenv("ENABLE_PROFILER") == "1" {
+	if cfg.Profiling {
 		log.Info("Profiling enabled.")
 		go initProfiling("checkoutservice", "1.0.0")
 	} else {
 		log.Info("Profiling disabled.")
 	}
 
-	port := listenPort
-	if os.Getenv("PORT") != "" {
-		port = os.Getenv("PORT")
+	if err := featureflags.Init(log); err != nil {
+		log.Fatalf("failed to initialize feature flags: %+v", err)
+	}
+
+	faults := cfg.Faults
+	if faults.Enabled() {
+		log.Infof("fault injection enabled (%s)", faults)
 	}
 
 	svc := new(checkoutService)
-	mustMapEnv(&svc.shippingSvcAddr, "SHIPPING_SERVICE_ADDR")
-	mustMapEnv(&svc.productCatalogSvcAddr, "PRODUCT_CATALOG_SERVICE_ADDR")
-	mustMapEnv(&svc.cartSvcAddr, "CART_SERVICE_ADDR")
-	mustMapEnv(&svc.currencySvcAddr, "CURRENCY_SERVICE_ADDR")
-	mustMapEnv(&svc.emailSvcAddr, "EMAIL_SERVICE_ADDR")
-	mustMapEnv(&svc.paymentSvcAddr, "PAYMENT_SERVICE_ADDR")
+	svc.shippingSvcAddr = cfg.Services.Shipping
+	svc.productCatalogSvcAddr = cfg.Services.ProductCatalog
+	svc.cartSvcAddr = cfg.Services.Cart
+	svc.currencySvcAddr = cfg.Services.Currency
+	svc.emailSvcAddr = cfg.Services.Email
+	svc.paymentSvcAddr = cfg.Services.Payment
+	svc.reservationTimeout = cfg.ReservationTimeout
+	svc.catalogAdminToken = cfg.CatalogAdminToken
+	if svc.catalogAdminToken == "" {
+		log.Info("CATALOG_ADMIN_TOKEN is not set; purchases are not recorded in the product catalog")
+	}
 
 	mustConnGRPC(ctx, &svc.shippingSvcConn, svc.shippingSvcAddr)
 	mustConnGRPC(ctx, &svc.productCatalogSvcConn, svc.productCatalogSvcAddr)
@@ -126,15 +213,52 @@ func main() {
 	mustConnGRPC(ctx, &svc.emailSvcConn, svc.emailSvcAddr)
 	mustConnGRPC(ctx, &svc.paymentSvcConn, svc.paymentSvcAddr)
 
-	// Initialize database connection and services
-	if err := svc.initDatabase(); err != nil {
-		log.Fatalf("failed to initialize database: %+v", err)
+	// Initialize database connection and services in the background so the
+	// server can answer liveness probes while Cloud SQL comes up.
+	svc.dbConn = database.NewConnection(log, cfg.Database)
+	if cfg.OrderEvents != nil {
+		log.Infof("publishing order events (%s)", cfg.OrderEvents)
+		svc.orderEvents = orderevents.NewPublisher(cfg.OrderEvents, log)
+	}
+	if cfg.Webhooks != nil {
+		log.Infof("delivering webhooks (%s)", cfg.Webhooks)
+		svc.webhooks = webhooks.NewDispatcher(cfg.Webhooks, log)
+	}
+	log.Infof("sending queued order confirmations (%s)", cfg.Confirmations)
+	svc.confirmations = confirmations.NewSender(cfg.Confirmations, svc.sendOrderConfirmation, log)
+	if cfg.OrderBuffer != nil {
+		log.Infof("buffering orders while the database is unavailable (%s)", cfg.OrderBuffer)
+		if svc.orderBuffer, err = orderbuffer.New(cfg.OrderBuffer, log); err != nil {
+			log.Fatalf("failed to open the order buffer: %+v", err)
+		}
+		go svc.orderBuffer.Run(ctx, svc.saveBufferedOrder, cfg.ReservationTimeout)
+	}
+	if cfg.Discounts != nil {
+		log.Infof("accepting discount codes (%s)", cfg.Discounts)
+		svc.discounts = cfg.Discounts
+	}
+	log.Infof("calculating tax (%s)", cfg.Tax)
+	svc.tax = cfg.Tax
+	if cfg.Fraud != nil {
+		log.Infof("screening orders for fraud (%s)", cfg.Fraud)
+		svc.fraud = cfg.Fraud.Checker(orderHistory{svc})
+		svc.fraudShadow = cfg.Fraud.Shadow
 	}
+	svc.emailClaims = cfg.EmailClaims
+	if cfg.Admin == nil {
+		log.Warn("CHECKOUT_ADMIN_TOKEN is not set; admin RPCs are refused")
+	}
+	go svc.initDatabase(ctx, cfg.StartupWindow)
 	defer svc.dbConn.Close()
 
-	log.Infof("service config: %+v", svc)
+	log.Infof("service addresses: %+v", cfg.Services)
+
+	if cfg.MetricsPort != "0" {
+		svc.serveMetrics(cfg.MetricsPort)
+		log.Infof("serving metrics at :%s/metrics", cfg.MetricsPort)
+	}
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.Port))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -145,10 +269,15 @@ func main() {
 	otel.SetTextMapPropagator(
 		propagation.NewCompositeTextMapPropagator(
 			propagation.TraceContext{}, propagation.Baggage{}))
-	srv = grpc.NewServer(
-		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
-	)
+	srv = grpc.NewServer(append(grpcConfig.ServerOptions(),
+		grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(),
+			cfg.Admin.UnaryServerInterceptor(adminMethods...),
+			faults.UnaryServerInterceptor("hipstershop.CheckoutService")),
+		grpc.ChainStreamInterceptor(
+			otelgrpc.StreamServerInterceptor(),
+			faults.StreamServerInterceptor("hipstershop.CheckoutService")),
+	)...)
 
 	pb.RegisterCheckoutServiceServer(srv, svc)
 	healthpb.RegisterHealthServer(srv, svc)
@@ -157,37 +286,58 @@ func main() {
 	log.Fatal(err)
 }
 
-// initDatabase initializes the database connection and services
-func (cs *checkoutService) initDatabase() error {
-	// Create database connection
-	cs.dbConn = database.NewConnection(log)
-	
-	// Connect to database
-	if err := cs.dbConn.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
+// initDatabase connects to the database, retrying with backoff for up to
+// window, and then marks the service ready. If the database stays unreachable
+// the service becomes ready without order history and keeps connecting in the
+// background; orders placed meanwhile go to the order buffer, or fail with
+// UNAVAILABLE without one.
+func (cs *checkoutService) initDatabase(ctx context.Context, window time.Duration) {
+	connect := func() error {
+		return startup.Retry(ctx, log, "order database", window, func() error {
+			err := cs.dbConn.Connect(ctx)
+			if errors.Is(err, database.ErrNotConfigured) {
+				return startup.Permanent(err)
+			}
+			return err
+		})
+	}
+	err := connect()
+	if errors.Is(err, database.ErrNotConfigured) {
+		log.Fatalf("failed to initialize database: %+v", err)
+	}
+	cs.ready.Store(true)
+	for err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Errorf("order history unavailable, still connecting: %+v", err)
+		err = connect()
 	}
 
 	// Initialize order service
-	cs.orderService = services.NewOrderService(cs.dbConn, log)
-
-	return nil
+	orderService := services.NewOrderService(cs.dbConn, log)
+	cs.orderService.Store(orderService)
+	go orderService.SweepReservations(ctx, cs.reservationTimeout, reservationSweepInterval)
+	if cs.orderEvents != nil {
+		go cs.orderEvents.Run(ctx, cs.dbConn)
+	}
+	if cs.webhooks != nil {
+		go cs.webhooks.Run(ctx, cs.dbConn)
+	}
+	go cs.confirmations.Run(ctx, cs.dbConn)
 }
 
 func initStats() {
 	//TODO(arbrown) Implement OpenTelemetry stats
 }
 
-func initTracing() {
-	var (
-		collectorAddr string
-		collectorConn *grpc.ClientConn
-	)
+func initTracing(collectorAddr string) {
+	var collectorConn *grpc.ClientConn
 
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
 
-	mustMapEnv(&collectorAddr, "COLLECTOR_SERVICE_ADDR")
 	mustConnGRPC(ctx, &collectorConn, collectorAddr)
 
 	exporter, err := otlptracegrpc.New(
@@ -225,28 +375,25 @@ func initProfiling(service, version string) {
 	log.Warn("could not initialize Stackdriver profiler after retrying, giving up")
 }
 
-func mustMapEnv(target *string, envKey string) {
-	v := os.Getenv(envKey)
-	if v == "" {
-		panic(fmt.Sprintf("environment variable %q not set", envKey))
-	}
-	*target = v
-}
-
 func mustConnGRPC(ctx context.Context, conn **grpc.ClientConn, addr string) {
 	var err error
 	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
-	*conn, err = grpc.DialContext(ctx, addr,
+	*conn, err = grpc.DialContext(ctx, addr, append(grpcConfig.DialOptions(),
 		grpc.WithInsecure(),
 		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
-		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()))
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()))...)
 	if err != nil {
 		panic(errors.Wrapf(err, "grpc: failed to connect %s", addr))
 	}
 }
 
+// Check reports SERVING, except for the readiness service name, which reports
+// NOT_SERVING until the startup dependency wait has finished.
 func (cs *checkoutService) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.GetService() == readinessService && !cs.ready.Load() {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
 	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
 }
 
@@ -257,55 +404,221 @@ func (cs *checkoutService) Watch(req *healthpb.HealthCheckRequest, ws healthpb.H
 func (cs *checkoutService) PlaceOrder(ctx context.Context, req *pb.PlaceOrderRequest) (*pb.PlaceOrderResponse, error) {
 	log.Infof("[PlaceOrder] user_id=%q user_currency=%q", req.UserId, req.UserCurrency)
 
+	// A saved address is resolved first, so a retry with an idempotency key
+	// is answered with the address it was placed with.
+	if addressID := req.GetAddressId(); addressID != "" {
+		orderService := cs.orderService.Load()
+		if orderService == nil {
+			return nil, status.Errorf(codes.Unavailable, "saved addresses are not available")
+		}
+		saved, err := orderService.GetAddress(ctx, req.UserId, addressID)
+		if err != nil {
+			return nil, addressError(err)
+		}
+		req.Address = saved.Address()
+	}
+
+	// A persisted order is reserved before the card is charged, so while the
+	// order history is unavailable orders are reserved in the order buffer,
+	// or refused rather than charged and lost.
+	persist := featureflags.Enabled(ctx, featureflags.OrderPersistence, req.UserId, true)
+	orderService := cs.orderService.Load()
+	if persist && orderService == nil && cs.orderBuffer == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
 	orderID, err := uuid.NewUUID()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to generate order uuid")
 	}
+	if key := req.GetIdempotencyKey(); key != "" {
+		orderID = idempotentOrderID(req.UserId, key)
+		resp, err := cs.placedOrder(ctx, orderID.String(), req)
+		if err != nil {
+			return nil, err
+		}
+		if resp != nil {
+			log.Infof("[PlaceOrder] order %s was already placed with idempotency key %q", orderID, key)
+			return resp, nil
+		}
+	}
 
 	prep, err := cs.prepareOrderItemsAndShippingQuoteFromCart(ctx, req.UserId, req.UserCurrency, req.Address)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
-	total := pb.Money{CurrencyCode: req.UserCurrency,
+	subtotal := &pb.Money{CurrencyCode: req.UserCurrency,
 		Units: 0,
 		Nanos: 0}
-	total = money.Must(money.Sum(total, *prep.shippingCostLocalized))
 	for _, it := range prep.orderItems {
-		multPrice := money.MultiplySlow(*it.Cost, uint32(it.GetItem().GetQuantity()))
-		total = money.Must(money.Sum(total, multPrice))
+		multPrice, err := money.Multiply(it.Cost, int64(it.GetItem().GetQuantity()))
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to compute price of %s: %v", it.GetItem().GetProductId(), err)
+		}
+		if subtotal, err = money.Sum(subtotal, multPrice); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to compute order total: %v", err)
+		}
 	}
 
-	txID, err := cs.chargeCard(ctx, &total, req.CreditCard)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to charge card: %+v", err)
+	// A discount code takes a share of the items off the total; shipping is
+	// paid in full.
+	total := subtotal
+	var discount *pb.Money
+	if code := req.GetDiscountCode(); code != "" {
+		d, err := cs.discounts.Discount(code, subtotal)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if total, err = money.Sum(total, money.Negate(d)); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to apply discount %q: %v", code, err)
+		}
+		discount = d
+		log.Infof("[PlaceOrder] discount code %q takes %d.%02d %s off", code, d.Units, d.Nanos/1e7, d.CurrencyCode)
 	}
-	log.Infof("payment went through (transaction_id: %s)", txID)
 
-	shippingTrackingID, err := cs.shipOrder(ctx, req.Address, prep.cartItems)
+	// Tax is due on the discounted items, not on shipping.
+	taxed, err := cs.tax.Calculate(ctx, req.Address, total)
 	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "shipping error: %+v", err)
+		return nil, status.Errorf(codes.Internal, "failed to calculate tax: %v", err)
+	}
+	if total, err = money.Sum(total, taxed.Total); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to add tax: %v", err)
+	}
+	var taxLines []*pb.TaxLine
+	for _, line := range taxed.Lines {
+		taxLines = append(taxLines, &pb.TaxLine{Jurisdiction: line.Jurisdiction, Amount: line.Amount})
+	}
+	total, err = money.Sum(total, prep.shippingCostLocalized)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid shipping cost: %v", err)
 	}
 
-	_ = cs.emptyUserCart(ctx, req.UserId)
+	orderStatus := models.StatusPaid
+	if cs.fraud != nil {
+		orderStatus = cs.screenOrder(ctx, &fraud.Order{
+			OrderID: orderID.String(),
+			UserID:  req.UserId,
+			Email:   req.Email,
+			Address: req.Address,
+			Total:   total,
+		})
+	}
+	// A flagged order is only authorized, not charged, and isn't shipped
+	// until it is approved, which needs it saved with its hold.
+	held := orderStatus == models.StatusUnderReview
+	if held && !persist {
+		return nil, status.Errorf(codes.FailedPrecondition, "order needs review, but can't be held while order history is off")
+	}
 
 	orderResult := &pb.OrderResult{
-		OrderId:            orderID.String(),
-		ShippingTrackingId: shippingTrackingID,
-		ShippingCost:       prep.shippingCostLocalized,
-		ShippingAddress:    req.Address,
-		Items:              prep.orderItems,
+		OrderId:         orderID.String(),
+		ShippingCost:    prep.shippingCostLocalized,
+		ShippingAddress: req.Address,
+		Items:           prep.orderItems,
+		DiscountCode:    req.GetDiscountCode(),
+		Discount:        discount,
+		Tax:             taxed.Total,
+		TaxLines:        taxLines,
+		AddressId:       req.GetAddressId(),
+		Status:          models.StatusPending,
+	}
+
+	// The order must add up before its card is charged; a mismatch is a
+	// pricing bug, not the client's fault.
+	if err := services.ValidateOrder(orderResult, req.Email, req.UserId, total); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid order: %v", err)
+	}
+
+	// The order is reserved on the primary before the card is charged, so a
+	// concurrent retry finds it instead of charging again. The reservation
+	// outlives the client, and is dropped if the order fails before it
+	// ships. The order ID is the charge's idempotency key, so placing it
+	// again doesn't charge twice while the payment service remembers the
+	// key: it keeps the latest 10,000 on its volume. While the database is
+	// unavailable the order is reserved in the order buffer instead, and
+	// saved once the database is back.
+	buffered := false
+	if persist {
+		err := database.ErrUnavailable
+		if orderService != nil {
+			err = orderService.ReserveOrder(context.WithoutCancel(ctx), orderResult, req.Email, req.UserId, total)
+		}
+		if database.IsTransient(err) && cs.orderBuffer != nil {
+			dbErr := err
+			err = cs.orderBuffer.Reserve(&orderbuffer.Order{Result: orderResult, Email: req.Email, UserID: req.UserId, Total: total, PlacedAt: time.Now()})
+			if buffered = err == nil; buffered {
+				log.Warnf("order %s reserved in the order buffer until the database is available: %v", orderID, dbErr)
+			}
+		}
+		switch {
+		case errors.Is(err, database.ErrDuplicateOrder), errors.Is(err, orderbuffer.ErrDuplicate):
+			return nil, status.Errorf(codes.Aborted, "order %s is already being placed", orderID)
+		case err != nil:
+			return nil, status.Errorf(codes.Unavailable, "failed to reserve order: %v", err)
+		}
+	}
+	dropReservation := func() {
+		switch {
+		case buffered:
+			cs.orderBuffer.Cancel(orderID.String())
+		case persist:
+			if err := orderService.CancelPendingOrder(context.WithoutCancel(ctx), orderID.String()); err != nil {
+				log.Warnf("failed to drop reservation of order %s: %+v", orderID, err)
+			}
+		}
+	}
+
+	txID, err := cs.chargeCard(ctx, total, req.CreditCard, orderID.String(), held)
+	if err != nil {
+		dropReservation()
+		return nil, status.Errorf(codes.Internal, "failed to charge card: %+v", err)
 	}
+	log.Infof("payment went through (transaction_id: %s, authorized only: %v)", txID, held)
 
-	// *** NEW: Persist order using the order service ***
-	if cs.orderService != nil {
-		if err := cs.orderService.SaveOrder(orderResult, req.Email, req.UserId, &total); err != nil {
-			log.Warnf("failed to save order to database: %+v", err)
-			// Don't fail the order if database save fails (graceful degradation)
+	var shippingTrackingID string
+	if !held {
+		shippingTrackingID, err = cs.shipOrder(ctx, req.Address, prep.cartItems)
+		if err != nil {
+			dropReservation()
+			return nil, status.Errorf(codes.Unavailable, "shipping error: %+v", err)
 		}
 	}
 
-	if err := cs.sendOrderConfirmation(ctx, req.Email, orderResult); err != nil {
+	_ = cs.emptyUserCart(ctx, req.UserId)
+
+	orderResult.ShippingTrackingId = shippingTrackingID
+	orderResult.Status = orderStatus
+
+	queued := false
+	switch {
+	case buffered:
+		// A buffered order's confirmation is sent now, not queued when it
+		// is saved.
+		if err := cs.orderBuffer.Complete(orderResult, txID); err != nil {
+			log.Errorf("failed to complete buffered order %s: %+v", orderID, err)
+		}
+	case persist:
+		// The card is already charged, so the order is completed even if
+		// the client gives up. Transient failures are retried; an order
+		// left pending is dropped by the reservation sweep, after which a
+		// retry places it again.
+		if err := orderService.CompleteOrder(context.WithoutCancel(ctx), orderResult, req.Email, txID); err != nil {
+			log.Errorf("failed to complete order %s: %+v", orderID, err)
+		} else {
+			queued = true
+		}
+	}
+
+	// Purchases feed the catalog's popularity ranking. They are reported
+	// in the background so a slow catalog doesn't delay the order.
+	go cs.recordPurchases(context.WithoutCancel(ctx), req.UserId, prep.cartItems)
+
+	// A saved order's confirmation is queued and sent with retries by
+	// cs.confirmations; otherwise it is sent once, now.
+	if queued {
+		log.Infof("order confirmation email to %q queued", req.Email)
+	} else if err := cs.sendOrderConfirmation(ctx, req.Email, orderResult); err != nil {
 		log.Warnf("failed to send order confirmation to %q: %+v", req.Email, err)
 	} else {
 		log.Infof("order confirmation email sent to %q", req.Email)
@@ -314,6 +627,848 @@ func (cs *checkoutService) PlaceOrder(ctx context.Context, req *pb.PlaceOrderReq
 	return resp, nil
 }
 
+// screenOrder checks an order for fraud and returns the status it is saved
+// with: under review when it was flagged, or paid. In shadow mode flagged
+// orders are only logged. A check that fails lets the order through.
+func (cs *checkoutService) screenOrder(ctx context.Context, order *fraud.Order) string {
+	verdict, err := cs.fraud.Check(ctx, order)
+	if err != nil {
+		log.Warnf("[PlaceOrder] fraud screening of order %s failed: %v", order.OrderID, err)
+	}
+	if !verdict.Review() {
+		return models.StatusPaid
+	}
+	reasons := strings.Join(verdict.Reasons, "; ")
+	if cs.fraudShadow {
+		log.Infof("[PlaceOrder] order %s would be held for review (shadow mode): %s", order.OrderID, reasons)
+		return models.StatusPaid
+	}
+	log.Warnf("[PlaceOrder] order %s held for review: %s", order.OrderID, reasons)
+	return models.StatusUnderReview
+}
+
+// orderHistory is the fraud.History of the order service, which fails with
+// database.ErrUnavailable until the database is reachable.
+type orderHistory struct{ cs *checkoutService }
+
+func (h orderHistory) RecentOrderCount(ctx context.Context, userID, email string, since time.Time, limit int) (int, error) {
+	orderService := h.cs.orderService.Load()
+	if orderService == nil {
+		return 0, database.ErrUnavailable
+	}
+	return orderService.RecentOrderCount(ctx, userID, email, since, limit)
+}
+
+func (h orderHistory) DefaultCountry(ctx context.Context, userID string) (string, error) {
+	orderService := h.cs.orderService.Load()
+	if orderService == nil {
+		return "", database.ErrUnavailable
+	}
+	return orderService.DefaultCountry(ctx, userID)
+}
+
+// saveBufferedOrder saves an order from the order buffer.
+func (cs *checkoutService) saveBufferedOrder(ctx context.Context, order *orderbuffer.Order) error {
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return database.ErrUnavailable
+	}
+	return orderService.SaveBufferedOrder(ctx, order.Result, order.Email, order.UserID, order.Total, order.TransactionID, order.PlacedAt)
+}
+
+// orderIDNamespace scopes the order IDs derived from idempotency keys.
+var orderIDNamespace = uuid.MustParse("6f1c3a52-3d5e-4c8b-9a57-0b6d2f4e8c11")
+
+// idempotentOrderID derives the ID of the order placed by a user with an
+// idempotency key, so every retry of the request uses the same order ID.
+func idempotentOrderID(userID, key string) uuid.UUID {
+	return uuid.NewSHA1(orderIDNamespace, []byte(userID+"\x00"+key))
+}
+
+// placedOrder returns the response to a PlaceOrder request whose order was
+// already saved or buffered, or nil if it was not. The order is read from
+// the order buffer or the primary, since a replica may not have it yet.
+// Without order persistence, retries are not detected. It fails if the order history can't be read, since
+// placing the order again could charge the card twice, and with ABORTED if
+// the order is still being placed.
+func (cs *checkoutService) placedOrder(ctx context.Context, orderID string, req *pb.PlaceOrderRequest) (*pb.PlaceOrderResponse, error) {
+	if cs.orderBuffer != nil {
+		if order := cs.orderBuffer.Get(orderID); order != nil && order.UserID == req.GetUserId() {
+			if order.Pending() {
+				return nil, status.Errorf(codes.Aborted, "order %s is still being placed", orderID)
+			}
+			return &pb.PlaceOrderResponse{Order: order.Result}, nil
+		}
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, nil
+	}
+	order, items, err := orderService.GetPlacedOrder(ctx, orderID)
+	if errors.Is(err, database.ErrOrderNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to check for a previous attempt of the order: %v", err)
+	}
+	if order.UserID != req.GetUserId() {
+		return nil, nil
+	}
+	if order.Status == models.StatusPending {
+		return nil, status.Errorf(codes.Aborted, "order %s is still being placed", orderID)
+	}
+	result, err := order.ToOrderResult(items, req.GetAddress())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to rebuild order %s: %v", orderID, err)
+	}
+	return &pb.PlaceOrderResponse{Order: result}, nil
+}
+
+// GetOrderHistory lists a page of the user's persisted orders, newest first.
+func (cs *checkoutService) GetOrderHistory(ctx context.Context, req *pb.GetOrderHistoryRequest) (*pb.GetOrderHistoryResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetPageSize() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must not be negative")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	var dates database.DateRange
+	if req.GetStartTime() != nil {
+		dates.From = req.GetStartTime().AsTime()
+	}
+	if req.GetEndTime() != nil {
+		dates.To = req.GetEndTime().AsTime()
+	}
+	orders, next, err := orderService.GetUserOrderHistoryPage(ctx, req.GetUserId(), dates, req.GetPageToken(), int(req.GetPageSize()))
+	if errors.Is(err, services.ErrInvalidPageToken) || errors.Is(err, services.ErrInvalidDateRange) {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err != nil {
+		return nil, databaseError(err)
+	}
+
+	resp := &pb.GetOrderHistoryResponse{NextPageToken: next}
+	for _, order := range orders {
+		resp.Orders = append(resp.Orders, order.ToProto(nil))
+	}
+	return resp, nil
+}
+
+// SearchOrders finds orders of any user for support staff.
+func (cs *checkoutService) SearchOrders(ctx context.Context, req *pb.SearchOrdersRequest) (*pb.SearchOrdersResponse, error) {
+	if req.GetPageSize() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if req.GetStatus() != "" && !models.ValidStatus(req.GetStatus()) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown order status %q", req.GetStatus())
+	}
+	if req.GetStatus() == models.StatusPending {
+		return nil, status.Errorf(codes.InvalidArgument, "pending orders are still being placed and can't be searched")
+	}
+	search := database.OrderSearch{
+		Email:     strings.TrimSpace(req.GetEmail()),
+		Status:    req.GetStatus(),
+		ProductID: req.GetProductId(),
+		Ascending: req.GetAscending(),
+	}
+	switch req.GetSortBy() {
+	case pb.SearchOrdersRequest_ORDER_TIME:
+		search.SortBy = database.SortByDate
+	case pb.SearchOrdersRequest_TOTAL:
+		search.SortBy = database.SortByTotal
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown sort_by %v", req.GetSortBy())
+	}
+	if req.GetStartTime() != nil {
+		search.Dates.From = req.GetStartTime().AsTime()
+	}
+	if req.GetEndTime() != nil {
+		search.Dates.To = req.GetEndTime().AsTime()
+	}
+	for _, bound := range []*pb.Money{req.GetMinTotal(), req.GetMaxTotal()} {
+		if bound == nil {
+			continue
+		}
+		if err := money.Validate(bound); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid total bound: %v", err)
+		}
+		search.Currency = bound.GetCurrencyCode()
+	}
+	if lo, hi := req.GetMinTotal(), req.GetMaxTotal(); lo != nil && hi != nil {
+		c, err := money.Compare(lo, hi)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "min_total and max_total must be in the same currency")
+		}
+		if c > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "min_total is above max_total")
+		}
+	}
+	if lo := req.GetMinTotal(); lo != nil {
+		search.MinTotal = &database.Amount{Units: lo.GetUnits(), Nanos: lo.GetNanos()}
+	}
+	if hi := req.GetMaxTotal(); hi != nil {
+		search.MaxTotal = &database.Amount{Units: hi.GetUnits(), Nanos: hi.GetNanos()}
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	orders, next, err := orderService.SearchOrders(ctx, search, req.GetPageToken(), int(req.GetPageSize()))
+	if errors.Is(err, services.ErrInvalidPageToken) || errors.Is(err, services.ErrInvalidDateRange) {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err != nil {
+		return nil, databaseError(err)
+	}
+
+	resp := &pb.SearchOrdersResponse{NextPageToken: next}
+	for _, order := range orders {
+		resp.Orders = append(resp.Orders, order.ToProto(nil))
+	}
+	log.Infof("[SearchOrders] orders=%d more=%t", len(orders), next != "")
+	return resp, nil
+}
+
+// GetOrder returns one of the user's orders with its items.
+func (cs *checkoutService) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.Order, error) {
+	if req.GetUserId() == "" || req.GetOrderId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and order_id are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	order, items, err := orderService.GetOrderDetails(ctx, req.GetOrderId())
+	if errors.Is(err, database.ErrOrderNotFound) {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetOrderId())
+	}
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	// Don't reveal that another user's order exists.
+	if order.UserID != req.GetUserId() {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetOrderId())
+	}
+	return order.ToProto(items), nil
+}
+
+// GetOrderByTrackingID returns the order shipped with a tracking ID with its
+// items. It is meant for customer support, so it is not scoped to a user.
+func (cs *checkoutService) GetOrderByTrackingID(ctx context.Context, req *pb.GetOrderByTrackingIDRequest) (*pb.Order, error) {
+	trackingID := req.GetTrackingId()
+	if trackingID == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "tracking_id is required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	order, items, err := orderService.GetOrderDetailsByTrackingID(ctx, trackingID)
+	if errors.Is(err, database.ErrOrderNotFound) {
+		return nil, status.Errorf(codes.NotFound, "no order with tracking ID %s", trackingID)
+	}
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	return order.ToProto(items), nil
+}
+
+// GetUserOrderStats summarizes the user's orders.
+func (cs *checkoutService) GetUserOrderStats(ctx context.Context, req *pb.GetUserOrderStatsRequest) (*pb.UserOrderStats, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetTopProducts() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "top_products must not be negative")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	stats, err := orderService.GetUserOrderStats(ctx, req.GetUserId(), int(req.GetTopProducts()))
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	return stats.ToProto(), nil
+}
+
+// UpdateOrderStatus moves an order to a new status in its lifecycle.
+func (cs *checkoutService) UpdateOrderStatus(ctx context.Context, req *pb.UpdateOrderStatusRequest) (*pb.Order, error) {
+	if req.GetOrderId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "order_id is required")
+	}
+	if !models.ValidStatus(req.GetStatus()) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown order status %q", req.GetStatus())
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	var order *models.Order
+	var err error
+	restoreHold := func() {}
+	switch req.GetStatus() {
+	case models.StatusPaid:
+		order, err = cs.approveOrder(ctx, orderService, req.GetOrderId(), req.GetReason())
+	case models.StatusCancelled:
+		restoreHold, err = cs.voidHeldPayment(ctx, orderService, "", req.GetOrderId())
+	}
+	if order == nil && err == nil {
+		order, err = orderService.UpdateOrderStatus(ctx, req.GetOrderId(), req.GetStatus(), req.GetReason())
+		if err != nil {
+			restoreHold()
+		}
+	}
+	switch {
+	case errors.Is(err, database.ErrOrderNotFound):
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetOrderId())
+	case errors.Is(err, models.ErrInvalidStatusTransition):
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	case err != nil && status.Code(err) != codes.Unknown:
+		return nil, err
+	case err != nil:
+		return nil, databaseError(err)
+	}
+	log.Infof("[UpdateOrderStatus] order_id=%q status=%q", req.GetOrderId(), req.GetStatus())
+	return order.ToProto(nil), nil
+}
+
+// approveOrder releases an order held for review: its authorized payment is
+// captured and it is shipped, and only then is it marked paid. It returns
+// nil, nil for an order that is not held, which is moved to paid like any
+// other status change. Failures restore the hold so approval can be retried;
+// capturing twice charges once.
+func (cs *checkoutService) approveOrder(ctx context.Context, orderService *services.OrderService, orderID, reason string) (*models.Order, error) {
+	hold, items, err := orderService.TakeOrderHold(ctx, orderID)
+	if errors.Is(err, database.ErrNoOrderHold) {
+		// A held order has no tracking ID; one without a hold is either
+		// being released by another call or was flagged before holds, and
+		// shipped then.
+		order, _, err := orderService.GetPlacedOrder(ctx, orderID)
+		if err == nil && order.Status == models.StatusUnderReview && order.ShippingTrackingID == "" {
+			return nil, status.Errorf(codes.Aborted, "order %s is already being approved", orderID)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The release outlives the caller: once captured, the order must ship.
+	ctx = context.WithoutCancel(ctx)
+
+	if err := cs.captureCharge(ctx, hold.TransactionID); err != nil {
+		orderService.PutOrderHold(ctx, hold)
+		return nil, status.Errorf(codes.Unavailable, "failed to capture payment: %v", err)
+	}
+	cartItems := make([]*pb.CartItem, len(items))
+	for i, item := range items {
+		cartItems[i] = &pb.CartItem{ProductId: item.ProductID, Quantity: item.Quantity}
+	}
+	trackingID, err := cs.shipOrder(ctx, hold.Address, cartItems)
+	if err != nil {
+		orderService.PutOrderHold(ctx, hold)
+		return nil, status.Errorf(codes.Unavailable, "shipping error: %+v", err)
+	}
+	order, err := orderService.ReleaseOrder(ctx, orderID, trackingID, reason)
+	if err != nil {
+		log.Errorf("[UpdateOrderStatus] order %s was captured and shipped with tracking ID %s, but not marked paid: %v", orderID, trackingID, err)
+		return nil, err
+	}
+	return order, nil
+}
+
+// voidHeldPayment voids the authorized payment of an order held for review
+// before it is cancelled, taking its hold so that it can't be approved
+// meanwhile. The returned func puts the hold back for a cancellation that
+// fails; voiding again is harmless. An order that is not held, or that
+// belongs to another user than userID when that is set, is left for the
+// cancellation to handle.
+func (cs *checkoutService) voidHeldPayment(ctx context.Context, orderService *services.OrderService, userID, orderID string) (func(), error) {
+	noop := func() {}
+	order, _, err := orderService.GetPlacedOrder(ctx, orderID)
+	if err != nil || order.Status != models.StatusUnderReview || (userID != "" && order.UserID != userID) {
+		return noop, nil
+	}
+	hold, _, err := orderService.TakeOrderHold(ctx, orderID)
+	switch {
+	case errors.Is(err, database.ErrNoOrderHold) && order.ShippingTrackingID == "":
+		return nil, status.Errorf(codes.Aborted, "order %s is being approved or cancelled", orderID)
+	case errors.Is(err, database.ErrNoOrderHold):
+		return noop, nil
+	case err != nil:
+		return nil, databaseError(err)
+	}
+	// The hold must be put back even if the caller goes away.
+	ctx = context.WithoutCancel(ctx)
+
+	if err := cs.voidCharge(ctx, hold.TransactionID); err != nil {
+		orderService.PutOrderHold(ctx, hold)
+		return nil, status.Errorf(codes.Unavailable, "failed to void payment: %v", err)
+	}
+	return func() { orderService.PutOrderHold(ctx, hold) }, nil
+}
+
+// CancelOrder cancels one of the user's orders that has not shipped yet.
+func (cs *checkoutService) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.Order, error) {
+	if req.GetUserId() == "" || req.GetOrderId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and order_id are required")
+	}
+	if req.GetReason() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "reason is required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	restoreHold, err := cs.voidHeldPayment(ctx, orderService, req.GetUserId(), req.GetOrderId())
+	if err != nil {
+		return nil, err
+	}
+	order, err := orderService.CancelOrder(ctx, req.GetUserId(), req.GetOrderId(), req.GetReason())
+	if err != nil {
+		restoreHold()
+	}
+	switch {
+	case errors.Is(err, database.ErrOrderNotFound):
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetOrderId())
+	case errors.Is(err, models.ErrInvalidStatusTransition):
+		return nil, status.Errorf(codes.FailedPrecondition, "order %s can no longer be cancelled", req.GetOrderId())
+	case err != nil:
+		return nil, databaseError(err)
+	}
+	log.Infof("[CancelOrder] user_id=%q order_id=%q", req.GetUserId(), req.GetOrderId())
+	return order.ToProto(nil), nil
+}
+
+// RequestReturn opens a return of items of one of the user's delivered orders.
+func (cs *checkoutService) RequestReturn(ctx context.Context, req *pb.RequestReturnRequest) (*pb.OrderReturn, error) {
+	if req.GetUserId() == "" || req.GetOrderId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and order_id are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	items := make([]models.ReturnItem, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		items[i] = models.ReturnItem{ProductID: item.GetProductId(), Quantity: item.GetQuantity()}
+	}
+	ret, err := orderService.RequestReturn(ctx, req.GetUserId(), req.GetOrderId(), req.GetReason(), items)
+	if err != nil {
+		return nil, returnError(err)
+	}
+	log.Infof("[RequestReturn] user_id=%q order_id=%q return_id=%q", req.GetUserId(), req.GetOrderId(), ret.ReturnID)
+	return ret.ToProto(), nil
+}
+
+// ApproveReturn approves a requested return and records its refund.
+func (cs *checkoutService) ApproveReturn(ctx context.Context, req *pb.ApproveReturnRequest) (*pb.OrderReturn, error) {
+	if req.GetReturnId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "return_id is required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	ret, err := orderService.ApproveReturn(ctx, req.GetReturnId(), req.GetRefund())
+	if err != nil {
+		return nil, returnError(err)
+	}
+	log.Infof("[ApproveReturn] return_id=%q", req.GetReturnId())
+	return ret.ToProto(), nil
+}
+
+// returnError maps an error of the return RPCs to a gRPC status.
+func returnError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrOrderNotFound), errors.Is(err, database.ErrReturnNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, models.ErrInvalidReturn), errors.Is(err, services.ErrInvalidRefund):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, models.ErrNotReturnable):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	default:
+		return databaseError(err)
+	}
+}
+
+// databaseError maps an error of the order history to a gRPC status by its
+// class, so callers can tell what is worth retrying.
+func databaseError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, database.ErrDuplicate):
+		return status.Errorf(codes.AlreadyExists, "%v", err)
+	case errors.Is(err, database.ErrConstraint):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	case errors.Is(err, database.ErrUnavailable):
+		return status.Errorf(codes.Unavailable, "%v", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Errorf(codes.DeadlineExceeded, "%v", err)
+	case errors.Is(err, context.Canceled):
+		return status.Errorf(codes.Canceled, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+}
+
+// Reorder returns which items of one of the user's orders can be ordered
+// again, adding them to the user's cart if asked to.
+func (cs *checkoutService) Reorder(ctx context.Context, req *pb.ReorderRequest) (*pb.ReorderResponse, error) {
+	if req.GetUserId() == "" || req.GetOrderId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and order_id are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	order, items, err := orderService.GetOrderDetails(ctx, req.GetOrderId())
+	if errors.Is(err, database.ErrOrderNotFound) {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetOrderId())
+	}
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	// Don't reveal that another user's order exists.
+	if order.UserID != req.GetUserId() {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetOrderId())
+	}
+
+	resp, err := cs.reorderItems(ctx, items)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "%v", err)
+	}
+	if req.GetAddToCart() {
+		if err := cs.addToCart(ctx, req.GetUserId(), resp.Items); err != nil {
+			return nil, err
+		}
+	}
+	log.Infof("[Reorder] order_id=%q items=%d unavailable=%d", req.GetOrderId(), len(resp.Items), len(resp.Unavailable))
+	return resp, nil
+}
+
+// ExportUserData exports all of the user's orders in the requested format.
+func (cs *checkoutService) ExportUserData(ctx context.Context, req *pb.ExportUserDataRequest) (*pb.ExportUserDataResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	export, err := orderService.ExportUserData(ctx, req.GetUserId())
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	resp := &pb.ExportUserDataResponse{}
+	switch req.GetFormat() {
+	case pb.ExportUserDataRequest_JSON:
+		resp.Data, err = export.JSON()
+		resp.ContentType = "application/json"
+	case pb.ExportUserDataRequest_CSV:
+		resp.Data, err = export.CSV()
+		resp.ContentType = "text/csv"
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown format %v", req.GetFormat())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode export: %v", err)
+	}
+	log.Infof("[ExportUserData] user_id=%q orders=%d", req.GetUserId(), len(export.Orders))
+	return resp, nil
+}
+
+// DeleteUserData erases the user's personal data from their orders.
+func (cs *checkoutService) DeleteUserData(ctx context.Context, req *pb.DeleteUserDataRequest) (*pb.DeleteUserDataResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	n, err := orderService.DeleteUserData(ctx, req.GetUserId())
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	log.Infof("[DeleteUserData] user_id=%q orders=%d", req.GetUserId(), n)
+	return &pb.DeleteUserDataResponse{OrdersAnonymized: int32(n)}, nil
+}
+
+// CreateShipment records a shipment of some of the items of an order.
+func (cs *checkoutService) CreateShipment(ctx context.Context, req *pb.CreateShipmentRequest) (*pb.Shipment, error) {
+	if req.GetOrderId() == "" || req.GetTrackingId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "order_id and tracking_id are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	items := make([]models.ShipmentItem, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		items[i] = models.ShipmentItem{ProductID: item.GetProductId(), Quantity: item.GetQuantity()}
+	}
+	s, err := orderService.CreateShipment(ctx, req.GetOrderId(), req.GetTrackingId(), req.GetCarrier(), items)
+	if err != nil {
+		return nil, shipmentError(err)
+	}
+	log.Infof("[CreateShipment] order_id=%q shipment_id=%q tracking_id=%q", req.GetOrderId(), s.ShipmentID, req.GetTrackingId())
+	return s.ToProto(), nil
+}
+
+// UpdateShipmentStatus moves a shipment to a new status.
+func (cs *checkoutService) UpdateShipmentStatus(ctx context.Context, req *pb.UpdateShipmentStatusRequest) (*pb.Shipment, error) {
+	if req.GetShipmentId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "shipment_id is required")
+	}
+	if req.GetStatus() != models.ShipmentShipped && req.GetStatus() != models.ShipmentDelivered {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown shipment status %q", req.GetStatus())
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	s, err := orderService.UpdateShipmentStatus(ctx, req.GetShipmentId(), req.GetStatus())
+	if err != nil {
+		return nil, shipmentError(err)
+	}
+	log.Infof("[UpdateShipmentStatus] shipment_id=%q status=%q", req.GetShipmentId(), req.GetStatus())
+	return s.ToProto(), nil
+}
+
+// ListShipments lists the shipments of one of the user's orders with the
+// fulfillment of each of its items.
+func (cs *checkoutService) ListShipments(ctx context.Context, req *pb.ListShipmentsRequest) (*pb.ListShipmentsResponse, error) {
+	if req.GetUserId() == "" || req.GetOrderId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and order_id are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	shipments, fulfillment, err := orderService.GetShipments(ctx, req.GetUserId(), req.GetOrderId())
+	if err != nil {
+		return nil, shipmentError(err)
+	}
+	resp := &pb.ListShipmentsResponse{}
+	for i := range shipments {
+		resp.Shipments = append(resp.Shipments, shipments[i].ToProto())
+	}
+	for _, f := range fulfillment {
+		resp.Items = append(resp.Items, f.ToProto())
+	}
+	log.Infof("[ListShipments] user_id=%q order_id=%q shipments=%d", req.GetUserId(), req.GetOrderId(), len(shipments))
+	return resp, nil
+}
+
+// shipmentError maps an error of the shipment RPCs to a gRPC status.
+func shipmentError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrOrderNotFound), errors.Is(err, database.ErrShipmentNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, models.ErrInvalidShipment):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, models.ErrNotShippable):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	default:
+		return databaseError(err)
+	}
+}
+
+// AddAddress saves a shipping address to the user's address book.
+func (cs *checkoutService) AddAddress(ctx context.Context, req *pb.AddAddressRequest) (*pb.SavedAddress, error) {
+	if req.GetUserId() == "" || req.GetAddress() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and address are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "saved addresses are not available")
+	}
+
+	addr, err := orderService.AddAddress(ctx, req.GetUserId(), req.GetAddress(), req.GetIsDefault())
+	if err != nil {
+		return nil, addressError(err)
+	}
+	log.Infof("[AddAddress] user_id=%q address_id=%q default=%t", req.GetUserId(), addr.AddressID, addr.IsDefault)
+	return addr.ToProto(), nil
+}
+
+// ListAddresses lists the user's saved addresses, the default first.
+func (cs *checkoutService) ListAddresses(ctx context.Context, req *pb.ListAddressesRequest) (*pb.ListAddressesResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "saved addresses are not available")
+	}
+
+	addrs, err := orderService.ListAddresses(ctx, req.GetUserId())
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	resp := &pb.ListAddressesResponse{}
+	for i := range addrs {
+		resp.Addresses = append(resp.Addresses, addrs[i].ToProto())
+	}
+	log.Infof("[ListAddresses] user_id=%q addresses=%d", req.GetUserId(), len(addrs))
+	return resp, nil
+}
+
+// DeleteAddress deletes one of the user's saved addresses.
+func (cs *checkoutService) DeleteAddress(ctx context.Context, req *pb.DeleteAddressRequest) (*pb.Empty, error) {
+	if req.GetUserId() == "" || req.GetAddressId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and address_id are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "saved addresses are not available")
+	}
+
+	if err := orderService.DeleteAddress(ctx, req.GetUserId(), req.GetAddressId()); err != nil {
+		return nil, addressError(err)
+	}
+	log.Infof("[DeleteAddress] user_id=%q address_id=%q", req.GetUserId(), req.GetAddressId())
+	return &pb.Empty{}, nil
+}
+
+// SetDefaultAddress makes one of the user's saved addresses the default.
+func (cs *checkoutService) SetDefaultAddress(ctx context.Context, req *pb.SetDefaultAddressRequest) (*pb.SavedAddress, error) {
+	if req.GetUserId() == "" || req.GetAddressId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and address_id are required")
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "saved addresses are not available")
+	}
+
+	addr, err := orderService.SetDefaultAddress(ctx, req.GetUserId(), req.GetAddressId())
+	if err != nil {
+		return nil, addressError(err)
+	}
+	log.Infof("[SetDefaultAddress] user_id=%q address_id=%q", req.GetUserId(), req.GetAddressId())
+	return addr.ToProto(), nil
+}
+
+// addressError maps an error of the address RPCs to a gRPC status.
+func addressError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrAddressNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, models.ErrInvalidAddress):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	default:
+		return databaseError(err)
+	}
+}
+
+// ClaimOrders moves the user's guest orders, placed with their verified
+// email, to their user ID. The email token must prove the user owns it.
+func (cs *checkoutService) ClaimOrders(ctx context.Context, req *pb.ClaimOrdersRequest) (*pb.ClaimOrdersResponse, error) {
+	if req.GetUserId() == "" || strings.TrimSpace(req.GetEmail()) == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and email are required")
+	}
+	if cs.emailClaims == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "guest orders can't be claimed: EMAIL_CLAIM_SECRET is not set")
+	}
+	if err := cs.emailClaims.Verify(req.GetEmailToken(), req.GetUserId(), req.GetEmail(), time.Now()); err != nil {
+		log.Warnf("[ClaimOrders] user_id=%q rejected: %v", req.GetUserId(), err)
+		return nil, status.Errorf(codes.PermissionDenied, "%v", err)
+	}
+	orderService := cs.orderService.Load()
+	if orderService == nil {
+		return nil, status.Errorf(codes.Unavailable, "order history is not available")
+	}
+
+	orderIDs, err := orderService.ClaimOrders(ctx, req.GetUserId(), req.GetEmail())
+	if err != nil {
+		return nil, databaseError(err)
+	}
+	log.Infof("[ClaimOrders] user_id=%q orders=%d", req.GetUserId(), len(orderIDs))
+	return &pb.ClaimOrdersResponse{OrdersClaimed: int32(len(orderIDs)), OrderIds: orderIDs}, nil
+}
+
+// addToCart adds items to the user's cart in order. The cart service cannot
+// remove an item, so if it fails partway the items already added stay: the
+// UNAVAILABLE status it returns then carries a ReorderResponse listing them.
+func (cs *checkoutService) addToCart(ctx context.Context, userID string, items []*pb.CartItem) error {
+	cl := pb.NewCartServiceClient(cs.cartSvcConn)
+	for i, item := range items {
+		if _, err := cl.AddItem(ctx, &pb.AddItemRequest{UserId: userID, Item: item}); err != nil {
+			st := status.Newf(codes.Unavailable, "failed to add %s to cart after adding %d items: %v", item.GetProductId(), i, err)
+			if i > 0 {
+				if detailed, err := st.WithDetails(&pb.ReorderResponse{Items: items[:i]}); err == nil {
+					st = detailed
+				}
+			}
+			return st.Err()
+		}
+	}
+	return nil
+}
+
+// reorderItems looks up the products of past order items in the catalog and
+// splits the items into those that can be ordered again and those that can't.
+func (cs *checkoutService) reorderItems(ctx context.Context, items []models.OrderItem) (*pb.ReorderResponse, error) {
+	products := make([]*pb.Product, len(items))
+	cl := pb.NewProductCatalogServiceClient(cs.productCatalogSvcConn)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentItemLookups)
+	for i, item := range items {
+		g.Go(func() error {
+			product, err := cl.GetProduct(gctx, &pb.GetProductRequest{Id: item.ProductID})
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get product #%q: %v", item.ProductID, err)
+			}
+			products[i] = product
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ReorderResponse{}
+	for i, item := range items {
+		quantity, reason := services.ReorderQuantity(products[i], item.Quantity)
+		if quantity > 0 {
+			resp.Items = append(resp.Items, &pb.CartItem{ProductId: item.ProductID, Quantity: quantity})
+		}
+		if quantity < item.Quantity {
+			resp.Unavailable = append(resp.Unavailable, &pb.ReorderUnavailableItem{
+				ProductId: item.ProductID,
+				Quantity:  item.Quantity - quantity,
+				Reason:    reason,
+			})
+		}
+	}
+	return resp, nil
+}
+
 type orderPrep struct {
 	orderItems            []*pb.OrderItem
 	cartItems             []*pb.CartItem
@@ -326,22 +1481,35 @@ func (cs *checkoutService) prepareOrderItemsAndShippingQuoteFromCart(ctx context
 	if err != nil {
 		return out, fmt.Errorf("cart failure: %+v", err)
 	}
-	orderItems, err := cs.prepOrderItems(ctx, cartItems, userCurrency)
-	if err != nil {
-		return out, fmt.Errorf("failed to prepare order: %+v", err)
-	}
-	shippingUSD, err := cs.quoteShipping(ctx, address, cartItems)
-	if err != nil {
-		return out, fmt.Errorf("shipping quote failure: %+v", err)
-	}
-	shippingPrice, err := cs.convertCurrency(ctx, shippingUSD, userCurrency)
-	if err != nil {
-		return out, fmt.Errorf("failed to convert shipping cost to currency: %+v", err)
+
+	// Item pricing and the shipping quote only depend on the cart, so run them
+	// concurrently. The first failure cancels the other branch.
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		orderItems, err := cs.prepOrderItems(gctx, cartItems, userCurrency)
+		if err != nil {
+			return fmt.Errorf("failed to prepare order: %+v", err)
+		}
+		out.orderItems = orderItems
+		return nil
+	})
+	g.Go(func() error {
+		shippingUSD, err := cs.quoteShipping(gctx, address, cartItems)
+		if err != nil {
+			return fmt.Errorf("shipping quote failure: %+v", err)
+		}
+		shippingPrice, err := cs.convertCurrency(gctx, shippingUSD, userCurrency)
+		if err != nil {
+			return fmt.Errorf("failed to convert shipping cost to currency: %+v", err)
+		}
+		out.shippingCostLocalized = shippingPrice
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return orderPrep{}, err
 	}
 
-	out.shippingCostLocalized = shippingPrice
 	out.cartItems = cartItems
-	out.orderItems = orderItems
 	return out, nil
 }
 
@@ -375,24 +1543,32 @@ func (cs *checkoutService) prepOrderItems(ctx context.Context, items []*pb.CartI
 	out := make([]*pb.OrderItem, len(items))
 	cl := pb.NewProductCatalogServiceClient(cs.productCatalogSvcConn)
 
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentItemLookups)
 	for i, item := range items {
-		product, err := cl.GetProduct(ctx, &pb.GetProductRequest{Id: item.GetProductId()})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get product #%q", item.GetProductId())
-		}
-		price, err := cs.convertCurrency(ctx, product.GetPriceUsd(), userCurrency)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert price of %q to %s", item.GetProductId(), userCurrency)
-		}
-		out[i] = &pb.OrderItem{
-			Item: item,
-			Cost: price}
+		g.Go(func() error {
+			product, err := cl.GetProduct(gctx, &pb.GetProductRequest{Id: item.GetProductId()})
+			if err != nil {
+				return fmt.Errorf("failed to get product #%q", item.GetProductId())
+			}
+			price, err := cs.convertCurrency(gctx, product.GetPriceUsd(), userCurrency)
+			if err != nil {
+				return fmt.Errorf("failed to convert price of %q to %s", item.GetProductId(), userCurrency)
+			}
+			out[i] = &pb.OrderItem{
+				Item: item,
+				Cost: price}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
 	return out, nil
 }
 
 func (cs *checkoutService) convertCurrency(ctx context.Context, from *pb.Money, toCurrency string) (*pb.Money, error) {
-	result, err := pb.NewCurrencyServiceClient(cs.currencySvcConn).Convert(context.TODO(), &pb.CurrencyConversionRequest{
+	result, err := pb.NewCurrencyServiceClient(cs.currencySvcConn).Convert(ctx, &pb.CurrencyConversionRequest{
 		From:   from,
 		ToCode: toCurrency})
 	if err != nil {
@@ -401,16 +1577,37 @@ func (cs *checkoutService) convertCurrency(ctx context.Context, from *pb.Money,
 	return result, err
 }
 
-func (cs *checkoutService) chargeCard(ctx context.Context, amount *pb.Money, paymentInfo *pb.CreditCardInfo) (string, error) {
+// chargeCard charges an order to a card, or with authorizeOnly only
+// authorizes it, to be charged by captureCharge. The order ID is the
+// idempotency key of the charge, so an order is charged at most once.
+func (cs *checkoutService) chargeCard(ctx context.Context, amount *pb.Money, paymentInfo *pb.CreditCardInfo, orderID string, authorizeOnly bool) (string, error) {
 	paymentResp, err := pb.NewPaymentServiceClient(cs.paymentSvcConn).Charge(ctx, &pb.ChargeRequest{
-		Amount:     amount,
-		CreditCard: paymentInfo})
+		Amount:         amount,
+		CreditCard:     paymentInfo,
+		IdempotencyKey: orderID,
+		AuthorizeOnly:  authorizeOnly})
 	if err != nil {
 		return "", fmt.Errorf("could not charge the card: %+v", err)
 	}
 	return paymentResp.GetTransactionId(), nil
 }
 
+// captureCharge charges a card authorized by chargeCard.
+func (cs *checkoutService) captureCharge(ctx context.Context, transactionID string) error {
+	if _, err := pb.NewPaymentServiceClient(cs.paymentSvcConn).Capture(ctx, &pb.CaptureRequest{TransactionId: transactionID}); err != nil {
+		return fmt.Errorf("could not capture transaction %s: %+v", transactionID, err)
+	}
+	return nil
+}
+
+// voidCharge releases a card authorized by chargeCard that won't be captured.
+func (cs *checkoutService) voidCharge(ctx context.Context, transactionID string) error {
+	if _, err := pb.NewPaymentServiceClient(cs.paymentSvcConn).Void(ctx, &pb.VoidRequest{TransactionId: transactionID}); err != nil {
+		return fmt.Errorf("could not void transaction %s: %+v", transactionID, err)
+	}
+	return nil
+}
+
 func (cs *checkoutService) sendOrderConfirmation(ctx context.Context, email string, order *pb.OrderResult) error {
 	_, err := pb.NewEmailServiceClient(cs.emailSvcConn).SendOrderConfirmation(ctx, &pb.SendOrderConfirmationRequest{
 		Email: email,
@@ -418,6 +1615,32 @@ func (cs *checkoutService) sendOrderConfirmation(ctx context.Context, email stri
 	return err
 }
 
+// recordPurchases records a PURCHASE interaction for each item of an order
+// placed by userID in the product catalog; guest orders have no user to
+// record them for. The catalog only accepts them with its admin token.
+// Failures are only logged: an order is never undone because popularity
+// missed it.
+func (cs *checkoutService) recordPurchases(ctx context.Context, userID string, items []*pb.CartItem) {
+	if userID == "" || cs.catalogAdminToken == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, recordPurchasesTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+cs.catalogAdminToken)
+	cl := pb.NewProductCatalogServiceClient(cs.productCatalogSvcConn)
+	for _, item := range items {
+		_, err := cl.RecordProductInteraction(ctx, &pb.ProductInteraction{
+			UserId:    userID,
+			ProductId: item.GetProductId(),
+			Kind:      pb.ProductInteraction_PURCHASE,
+		})
+		if err != nil {
+			log.Warnf("failed to record the purchase of product %q: %v", item.GetProductId(), err)
+			return
+		}
+	}
+}
+
 func (cs *checkoutService) shipOrder(ctx context.Context, address *pb.Address, items []*pb.CartItem) (string, error) {
 	resp, err := pb.NewShippingServiceClient(cs.shippingSvcConn).ShipOrder(ctx, &pb.ShipOrderRequest{
 		Address: address,
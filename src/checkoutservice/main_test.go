@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/adminauth"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/database"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/emailclaims"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/fraud"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/models"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/orderbuffer"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/services"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/tax"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeDownstream records the calls checkout makes to the services it
+// depends on. Every product costs 10 USD, shipping 5 USD, and currencies are
+// converted one to one.
+type fakeDownstream struct {
+	mu       sync.Mutex
+	charges  []*pb.ChargeRequest
+	captures []string
+	voids    []string
+	shipped  []*pb.ShipOrderRequest
+
+	// interactions, when set, receives the interactions recorded in the
+	// catalog.
+	interactions chan *pb.ProductInteraction
+
+	// cartAdded lists the products added to the cart; adding fails once it
+	// holds cartCapacity products, when that is set.
+	cartAdded    []string
+	cartCapacity int
+}
+
+type fakeCart struct {
+	pb.UnimplementedCartServiceServer
+	d *fakeDownstream
+}
+
+func (c fakeCart) AddItem(_ context.Context, req *pb.AddItemRequest) (*pb.Empty, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.cartCapacity > 0 && len(c.d.cartAdded) == c.d.cartCapacity {
+		return nil, status.Error(codes.Unavailable, "cart is down")
+	}
+	c.d.cartAdded = append(c.d.cartAdded, req.GetItem().GetProductId())
+	return &pb.Empty{}, nil
+}
+
+func (fakeCart) GetCart(context.Context, *pb.GetCartRequest) (*pb.Cart, error) {
+	return &pb.Cart{Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}}}, nil
+}
+
+func (fakeCart) EmptyCart(context.Context, *pb.EmptyCartRequest) (*pb.Empty, error) {
+	return &pb.Empty{}, nil
+}
+
+type fakeCatalog struct {
+	pb.UnimplementedProductCatalogServiceServer
+	d *fakeDownstream
+}
+
+func (fakeCatalog) GetProduct(_ context.Context, req *pb.GetProductRequest) (*pb.Product, error) {
+	return &pb.Product{Id: req.GetId(), PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 10}}, nil
+}
+
+func (c fakeCatalog) RecordProductInteraction(ctx context.Context, req *pb.ProductInteraction) (*pb.Empty, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if auth := md.Get("authorization"); len(auth) != 1 || auth[0] != "Bearer catalog-token" {
+		return nil, status.Error(codes.Unauthenticated, "admin RPCs need an admin bearer token")
+	}
+	if c.d.interactions != nil {
+		c.d.interactions <- req
+	}
+	return &pb.Empty{}, nil
+}
+
+type fakeCurrency struct {
+	pb.UnimplementedCurrencyServiceServer
+}
+
+func (fakeCurrency) Convert(_ context.Context, req *pb.CurrencyConversionRequest) (*pb.Money, error) {
+	return &pb.Money{CurrencyCode: req.GetToCode(), Units: req.GetFrom().GetUnits(), Nanos: req.GetFrom().GetNanos()}, nil
+}
+
+type fakeShipping struct {
+	pb.UnimplementedShippingServiceServer
+	d *fakeDownstream
+}
+
+func (fakeShipping) GetQuote(context.Context, *pb.GetQuoteRequest) (*pb.GetQuoteResponse, error) {
+	return &pb.GetQuoteResponse{CostUsd: &pb.Money{CurrencyCode: "USD", Units: 5}}, nil
+}
+
+func (s fakeShipping) ShipOrder(_ context.Context, req *pb.ShipOrderRequest) (*pb.ShipOrderResponse, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.shipped = append(s.d.shipped, req)
+	return &pb.ShipOrderResponse{TrackingId: "TRACK-1"}, nil
+}
+
+type fakePayment struct {
+	pb.UnimplementedPaymentServiceServer
+	d *fakeDownstream
+}
+
+func (p fakePayment) Charge(_ context.Context, req *pb.ChargeRequest) (*pb.ChargeResponse, error) {
+	p.d.mu.Lock()
+	defer p.d.mu.Unlock()
+	p.d.charges = append(p.d.charges, req)
+	return &pb.ChargeResponse{TransactionId: "tx-1"}, nil
+}
+
+func (p fakePayment) Capture(_ context.Context, req *pb.CaptureRequest) (*pb.ChargeResponse, error) {
+	p.d.mu.Lock()
+	defer p.d.mu.Unlock()
+	p.d.captures = append(p.d.captures, req.GetTransactionId())
+	return &pb.ChargeResponse{TransactionId: req.GetTransactionId()}, nil
+}
+
+func (p fakePayment) Void(_ context.Context, req *pb.VoidRequest) (*pb.ChargeResponse, error) {
+	p.d.mu.Lock()
+	defer p.d.mu.Unlock()
+	p.d.voids = append(p.d.voids, req.GetTransactionId())
+	return &pb.ChargeResponse{TransactionId: req.GetTransactionId()}, nil
+}
+
+type fakeEmail struct {
+	pb.UnimplementedEmailServiceServer
+}
+
+func (fakeEmail) SendOrderConfirmation(context.Context, *pb.SendOrderConfirmationRequest) (*pb.Empty, error) {
+	return &pb.Empty{}, nil
+}
+
+// flagAll flags every order for review.
+type flagAll struct{}
+
+func (flagAll) Check(context.Context, *fraud.Order) (fraud.Verdict, error) {
+	return fraud.Verdict{Reasons: []string{"test"}}, nil
+}
+
+// newTestCheckout returns a checkoutService whose downstream services are the
+// fakes of d and whose order history is a database.MockConnection.
+func newTestCheckout(t *testing.T, d *fakeDownstream) (*checkoutService, *database.MockConnection) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterCartServiceServer(srv, fakeCart{d: d})
+	pb.RegisterProductCatalogServiceServer(srv, fakeCatalog{d: d})
+	pb.RegisterCurrencyServiceServer(srv, fakeCurrency{})
+	pb.RegisterShippingServiceServer(srv, fakeShipping{d: d})
+	pb.RegisterPaymentServiceServer(srv, fakePayment{d: d})
+	pb.RegisterEmailServiceServer(srv, fakeEmail{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	db := database.NewMockConnection(logger)
+	cs := &checkoutService{
+		productCatalogSvcConn: conn,
+		cartSvcConn:           conn,
+		currencySvcConn:       conn,
+		shippingSvcConn:       conn,
+		emailSvcConn:          conn,
+		paymentSvcConn:        conn,
+		tax:                   tax.None{},
+		catalogAdminToken:     "catalog-token",
+	}
+	cs.orderService.Store(services.NewOrderService(db, logger))
+	return cs, db
+}
+
+func TestPlaceOrder_FlaggedOrderIsNotShipped(t *testing.T) {
+	d := &fakeDownstream{}
+	cs, db := newTestCheckout(t, d)
+	cs.fraud = flagAll{}
+	ctx := context.Background()
+
+	resp, err := cs.PlaceOrder(ctx, &pb.PlaceOrderRequest{
+		UserId:       "user-1",
+		UserCurrency: "USD",
+		Email:        "someone@example.com",
+		Address:      &pb.Address{StreetAddress: "1 Main St", City: "Springfield", Country: "USA"},
+		CreditCard:   &pb.CreditCardInfo{CreditCardNumber: "4432-8015-6152-0454"},
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder failed: %v", err)
+	}
+	orderID := resp.GetOrder().GetOrderId()
+	if resp.GetOrder().GetStatus() != models.StatusUnderReview || resp.GetOrder().GetShippingTrackingId() != "" {
+		t.Errorf("Expected an unshipped order under review, got %v", resp.GetOrder())
+	}
+	if len(d.shipped) != 0 {
+		t.Fatalf("Expected a flagged order not to be shipped, got %d shipments", len(d.shipped))
+	}
+	if len(d.charges) != 1 || !d.charges[0].GetAuthorizeOnly() || len(d.captures) != 0 {
+		t.Fatalf("Expected the order to be authorized only, got charges %v and captures %v", d.charges, d.captures)
+	}
+	if order, err := db.GetOrderByID(ctx, orderID); err != nil || order.Status != models.StatusUnderReview {
+		t.Fatalf("Expected the order saved under review, got %+v, %v", order, err)
+	}
+
+	// Approval captures the payment and ships the held order.
+	order, err := cs.UpdateOrderStatus(ctx, &pb.UpdateOrderStatusRequest{OrderId: orderID, Status: models.StatusPaid, Reason: "reviewed"})
+	if err != nil {
+		t.Fatalf("UpdateOrderStatus failed: %v", err)
+	}
+	if order.GetStatus() != models.StatusPaid || order.GetShippingTrackingId() != "TRACK-1" {
+		t.Errorf("Expected the approved order paid and shipped, got %v", order)
+	}
+	if len(d.captures) != 1 || d.captures[0] != "tx-1" {
+		t.Errorf("Expected the authorized payment to be captured, got %v", d.captures)
+	}
+	if len(d.shipped) != 1 || d.shipped[0].GetAddress().GetCity() != "Springfield" ||
+		len(d.shipped[0].GetItems()) != 1 || d.shipped[0].GetItems()[0].GetQuantity() != 2 {
+		t.Errorf("Expected the order's items shipped to its address, got %v", d.shipped)
+	}
+}
+
+func TestCancelOrder_VoidsHeldPayment(t *testing.T) {
+	d := &fakeDownstream{}
+	cs, _ := newTestCheckout(t, d)
+	cs.fraud = flagAll{}
+	ctx := context.Background()
+
+	var orderIDs []string
+	for i := 0; i < 2; i++ {
+		resp, err := cs.PlaceOrder(ctx, &pb.PlaceOrderRequest{
+			UserId:       "user-1",
+			UserCurrency: "USD",
+			Email:        "someone@example.com",
+			Address:      &pb.Address{StreetAddress: "1 Main St", City: "Springfield", Country: "USA"},
+			CreditCard:   &pb.CreditCardInfo{CreditCardNumber: "4432-8015-6152-0454"},
+		})
+		if err != nil {
+			t.Fatalf("PlaceOrder failed: %v", err)
+		}
+		orderIDs = append(orderIDs, resp.GetOrder().GetOrderId())
+	}
+
+	// Another user can't cancel the order, nor void its payment.
+	if _, err := cs.CancelOrder(ctx, &pb.CancelOrderRequest{UserId: "user-2", OrderId: orderIDs[0], Reason: "not mine"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound cancelling another user's order, got %v", err)
+	}
+	if len(d.voids) != 0 {
+		t.Fatalf("Expected no void, got %v", d.voids)
+	}
+
+	// The user cancelling, or staff cancelling, voids the authorization, and
+	// the order can no longer be approved.
+	if _, err := cs.CancelOrder(ctx, &pb.CancelOrderRequest{UserId: "user-1", OrderId: orderIDs[0], Reason: "changed my mind"}); err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+	if _, err := cs.UpdateOrderStatus(ctx, &pb.UpdateOrderStatusRequest{OrderId: orderIDs[1], Status: models.StatusCancelled, Reason: "fraud"}); err != nil {
+		t.Fatalf("UpdateOrderStatus failed: %v", err)
+	}
+	if len(d.voids) != 2 || d.voids[0] != "tx-1" || d.voids[1] != "tx-1" {
+		t.Errorf("Expected both authorizations voided, got %v", d.voids)
+	}
+	for _, orderID := range orderIDs {
+		if _, err := cs.UpdateOrderStatus(ctx, &pb.UpdateOrderStatusRequest{OrderId: orderID, Status: models.StatusPaid, Reason: "reviewed"}); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Expected approving cancelled order %s to fail with FailedPrecondition, got %v", orderID, err)
+		}
+	}
+	if len(d.captures) != 0 || len(d.shipped) != 0 {
+		t.Errorf("Expected nothing captured or shipped, got captures %v and shipments %v", d.captures, d.shipped)
+	}
+}
+
+func TestPlaceOrder_ShipsUnflaggedOrder(t *testing.T) {
+	d := &fakeDownstream{}
+	cs, _ := newTestCheckout(t, d)
+
+	resp, err := cs.PlaceOrder(context.Background(), &pb.PlaceOrderRequest{
+		UserId:       "user-1",
+		UserCurrency: "USD",
+		Email:        "someone@example.com",
+		Address:      &pb.Address{Country: "USA"},
+		CreditCard:   &pb.CreditCardInfo{CreditCardNumber: "4432-8015-6152-0454"},
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder failed: %v", err)
+	}
+	if resp.GetOrder().GetStatus() != models.StatusPaid || resp.GetOrder().GetShippingTrackingId() != "TRACK-1" {
+		t.Errorf("Expected a paid, shipped order, got %v", resp.GetOrder())
+	}
+	if len(d.charges) != 1 || d.charges[0].GetAuthorizeOnly() || d.charges[0].GetIdempotencyKey() != resp.GetOrder().GetOrderId() {
+		t.Errorf("Expected one charge keyed by the order ID, got %v", d.charges)
+	}
+	if len(d.shipped) != 1 {
+		t.Errorf("Expected the order to be shipped once, got %d shipments", len(d.shipped))
+	}
+}
+
+func TestPlaceOrder_BuffersOrderWhileDatabaseIsUnavailable(t *testing.T) {
+	d := &fakeDownstream{}
+	cs, db := newTestCheckout(t, d)
+	orderService := cs.orderService.Swap(nil)
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	buffer, err := orderbuffer.New(&orderbuffer.Config{MaxOrders: 10, Dir: t.TempDir(), Interval: time.Second}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.orderBuffer = buffer
+	ctx := context.Background()
+
+	req := &pb.PlaceOrderRequest{
+		UserId:         "user-1",
+		UserCurrency:   "USD",
+		Email:          "someone@example.com",
+		Address:        &pb.Address{Country: "USA"},
+		CreditCard:     &pb.CreditCardInfo{CreditCardNumber: "4432-8015-6152-0454"},
+		IdempotencyKey: "key-1",
+	}
+	resp, err := cs.PlaceOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("PlaceOrder failed: %v", err)
+	}
+	orderID := resp.GetOrder().GetOrderId()
+	if resp.GetOrder().GetStatus() != models.StatusPaid || len(d.charges) != 1 || len(d.shipped) != 1 {
+		t.Fatalf("Expected a paid order charged and shipped once, got %v with %d charges and %d shipments", resp.GetOrder(), len(d.charges), len(d.shipped))
+	}
+
+	// A retry is answered from the buffer without charging again.
+	again, err := cs.PlaceOrder(ctx, req)
+	if err != nil || again.GetOrder().GetOrderId() != orderID || len(d.charges) != 1 {
+		t.Fatalf("Expected the retry to return order %s without a charge, got %v, %v and %d charges", orderID, again.GetOrder(), err, len(d.charges))
+	}
+
+	// Once the database is back, the order is saved with its payment.
+	cs.orderService.Store(orderService)
+	if err := buffer.Flush(ctx, cs.saveBufferedOrder, time.Minute); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if order, err := db.GetOrderByID(ctx, orderID); err != nil || order.Status != models.StatusPaid || order.ShippingTrackingID != "TRACK-1" {
+		t.Errorf("Expected the order saved paid and shipped, got %+v, %v", order, err)
+	}
+	if s := buffer.Stats(); s.Orders != 0 || s.Saved != 1 {
+		t.Errorf("Expected the buffer emptied, got %+v", s)
+	}
+}
+
+func TestPlaceOrder_RefusedWhileDatabaseIsUnavailableWithoutBuffer(t *testing.T) {
+	d := &fakeDownstream{}
+	cs, _ := newTestCheckout(t, d)
+	cs.orderService.Store(nil)
+
+	_, err := cs.PlaceOrder(context.Background(), &pb.PlaceOrderRequest{
+		UserId:       "user-1",
+		UserCurrency: "USD",
+		Email:        "someone@example.com",
+		Address:      &pb.Address{Country: "USA"},
+		CreditCard:   &pb.CreditCardInfo{CreditCardNumber: "4432-8015-6152-0454"},
+	})
+	if status.Code(err) != codes.Unavailable || len(d.charges) != 0 {
+		t.Errorf("Expected UNAVAILABLE before any charge, got %v and %d charges", err, len(d.charges))
+	}
+}
+
+func TestPlaceOrder_RecordsPurchases(t *testing.T) {
+	d := &fakeDownstream{interactions: make(chan *pb.ProductInteraction, 1)}
+	cs, _ := newTestCheckout(t, d)
+
+	_, err := cs.PlaceOrder(context.Background(), &pb.PlaceOrderRequest{
+		UserId:       "user-1",
+		UserCurrency: "USD",
+		Email:        "someone@example.com",
+		Address:      &pb.Address{Country: "USA"},
+		CreditCard:   &pb.CreditCardInfo{CreditCardNumber: "4432-8015-6152-0454"},
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder failed: %v", err)
+	}
+	select {
+	case got := <-d.interactions:
+		if got.GetUserId() != "user-1" || got.GetProductId() != "OLJCESPC7Z" || got.GetKind() != pb.ProductInteraction_PURCHASE {
+			t.Errorf("Expected a purchase of OLJCESPC7Z by user-1, got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the purchase to be recorded in the catalog")
+	}
+}
+
+func TestClaimOrders_RequiresEmailToken(t *testing.T) {
+	d := &fakeDownstream{}
+	cs, _ := newTestCheckout(t, d)
+	cs.emailClaims = &emailclaims.Config{Secret: "s3cret"}
+	ctx := context.Background()
+
+	resp, err := cs.PlaceOrder(ctx, &pb.PlaceOrderRequest{
+		UserCurrency: "USD",
+		Email:        "guest@example.com",
+		Address:      &pb.Address{Country: "USA"},
+		CreditCard:   &pb.CreditCardInfo{CreditCardNumber: "4432-8015-6152-0454"},
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder failed: %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	for name, token := range map[string]string{
+		"no token":     "",
+		"other secret": emailclaims.Sign("guess", "attacker", "guest@example.com", expires),
+		"other user":   emailclaims.Sign("s3cret", "someone-else", "guest@example.com", expires),
+	} {
+		_, err := cs.ClaimOrders(ctx, &pb.ClaimOrdersRequest{UserId: "attacker", Email: "guest@example.com", EmailToken: token})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("ClaimOrders with %s = %v, want PermissionDenied", name, err)
+		}
+	}
+
+	claimed, err := cs.ClaimOrders(ctx, &pb.ClaimOrdersRequest{
+		UserId:     "user-1",
+		Email:      "guest@example.com",
+		EmailToken: emailclaims.Sign("s3cret", "user-1", "guest@example.com", expires),
+	})
+	if err != nil {
+		t.Fatalf("ClaimOrders failed: %v", err)
+	}
+	if len(claimed.GetOrderIds()) != 1 || claimed.GetOrderIds()[0] != resp.GetOrder().GetOrderId() {
+		t.Errorf("Expected the guest order to be claimed, got %v", claimed.GetOrderIds())
+	}
+}
+
+func TestClaimOrders_DisabledWithoutSecret(t *testing.T) {
+	cs, _ := newTestCheckout(t, &fakeDownstream{})
+	_, err := cs.ClaimOrders(context.Background(), &pb.ClaimOrdersRequest{UserId: "user-1", Email: "guest@example.com", EmailToken: "1.x"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("ClaimOrders without EMAIL_CLAIM_SECRET = %v, want FailedPrecondition", err)
+	}
+}
+
+// newAdminConn serves cs with the admin interceptor, with "s3cret" as the
+// admin token, and returns a client connection to it.
+func newAdminConn(t *testing.T, cs *checkoutService) *grpc.ClientConn {
+	t.Helper()
+	admin := &adminauth.Config{Token: "s3cret"}
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(admin.UnaryServerInterceptor(adminMethods...)))
+	pb.RegisterCheckoutServiceServer(srv, cs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestAdminMethodsNeedToken calls each admin RPC through a server with the
+// admin interceptor, without and with the admin token.
+func TestAdminMethodsNeedToken(t *testing.T) {
+	cs, _ := newTestCheckout(t, &fakeDownstream{})
+	conn := newAdminConn(t, cs)
+
+	ctx := context.Background()
+	authorized := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer s3cret")
+	for _, method := range adminMethods {
+		if err := conn.Invoke(ctx, method, &pb.Empty{}, &pb.Empty{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s without a token = %v, want Unauthenticated", method, err)
+		}
+		// With the token the call reaches the handler, which rejects the
+		// empty request.
+		if err := conn.Invoke(authorized, method, &pb.Empty{}, &pb.Empty{}); status.Code(err) == codes.Unauthenticated || status.Code(err) == codes.PermissionDenied {
+			t.Errorf("%s with the admin token = %v", method, err)
+		}
+	}
+}
+
+func TestUserDataNeedsAdminToken(t *testing.T) {
+	cs, _ := newTestCheckout(t, &fakeDownstream{})
+	client := pb.NewCheckoutServiceClient(newAdminConn(t, cs))
+	ctx := context.Background()
+
+	if _, err := client.ExportUserData(ctx, &pb.ExportUserDataRequest{UserId: "user-1"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ExportUserData without a token = %v, want Unauthenticated", err)
+	}
+	if _, err := client.DeleteUserData(ctx, &pb.DeleteUserDataRequest{UserId: "user-1"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("DeleteUserData without a token = %v, want Unauthenticated", err)
+	}
+}
+
+func TestAddToCart_ReportsItemsAdded(t *testing.T) {
+	d := &fakeDownstream{cartCapacity: 2}
+	cs, _ := newTestCheckout(t, d)
+	items := []*pb.CartItem{{ProductId: "A", Quantity: 1}, {ProductId: "B", Quantity: 1}, {ProductId: "C", Quantity: 1}}
+
+	err := cs.addToCart(context.Background(), "user-1", items)
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable {
+		t.Fatalf("Expected UNAVAILABLE, got %v", err)
+	}
+	var added []string
+	for _, detail := range st.Details() {
+		if resp, ok := detail.(*pb.ReorderResponse); ok {
+			for _, item := range resp.GetItems() {
+				added = append(added, item.GetProductId())
+			}
+		}
+	}
+	if want := []string{"A", "B"}; !reflect.DeepEqual(added, want) || !reflect.DeepEqual(d.cartAdded, want) {
+		t.Errorf("Expected A and B added and reported, got %v reported and %v added", added, d.cartAdded)
+	}
+}
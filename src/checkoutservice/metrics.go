@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/internal/orderbuffer"
+)
+
+// The service exposes its metrics in the Prometheus text format, written
+// here rather than with the Prometheus client library to keep the build
+// free of its dependencies. All of them are read at scrape time.
+
+// writeOrderBufferMetrics writes the state of the order buffer.
+func writeOrderBufferMetrics(w io.Writer, s orderbuffer.Stats) {
+	var oldestAge float64
+	if !s.Oldest.IsZero() {
+		oldestAge = time.Since(s.Oldest).Seconds()
+	}
+	for _, m := range []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"checkout_order_buffer_orders", "gauge", "Orders waiting in the buffer for the database.", float64(s.Orders)},
+		{"checkout_order_buffer_oldest_age_seconds", "gauge", "Age of the oldest buffered order; 0 when the buffer is empty.", oldestAge},
+		{"checkout_order_buffer_saved_total", "counter", "Buffered orders saved to the database.", float64(s.Saved)},
+		{"checkout_order_buffer_dropped_total", "counter", "Buffered orders lost because they were abandoned while pending or could not be saved.", float64(s.Dropped)},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		fmt.Fprintf(w, "%s %s\n", m.name, strconv.FormatFloat(m.value, 'g', -1, 64))
+	}
+}
+
+// metricsHandler serves the metrics in the Prometheus text format.
+func (cs *checkoutService) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if cs.orderBuffer != nil {
+		writeOrderBufferMetrics(w, cs.orderBuffer.Stats())
+	}
+}
+
+// serveMetrics serves /metrics on port in the background.
+func (cs *checkoutService) serveMetrics(port string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", cs.metricsHandler)
+	go func() {
+		if err := http.ListenAndServe(":"+port, mux); err != nil {
+			log.Errorf("metrics server stopped: %v", err)
+		}
+	}()
+}
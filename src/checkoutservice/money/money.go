@@ -16,6 +16,9 @@ package money
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"math/big"
 
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
 )
@@ -29,50 +32,87 @@ const (
 var (
 	ErrInvalidValue        = errors.New("one of the specified money values is invalid")
 	ErrMismatchingCurrency = errors.New("mismatching currency codes")
+	ErrOverflow            = errors.New("money value overflows")
 )
 
 // IsValid checks if specified value has a valid units/nanos signs and ranges.
-func IsValid(m pb.Money) bool {
+func IsValid(m *pb.Money) bool {
 	return signMatches(m) && validNanos(m.GetNanos())
 }
 
-func signMatches(m pb.Money) bool {
+// Validate returns nil if m is valid, and otherwise an ErrInvalidValue that
+// says what is wrong with it.
+func Validate(m *pb.Money) error {
+	if !validNanos(m.GetNanos()) {
+		return fmt.Errorf("%w: nanos %d out of range", ErrInvalidValue, m.GetNanos())
+	}
+	if !signMatches(m) {
+		return fmt.Errorf("%w: units %d and nanos %d have different signs", ErrInvalidValue, m.GetUnits(), m.GetNanos())
+	}
+	return nil
+}
+
+func signMatches(m *pb.Money) bool {
 	return m.GetNanos() == 0 || m.GetUnits() == 0 || (m.GetNanos() < 0) == (m.GetUnits() < 0)
 }
 
 func validNanos(nanos int32) bool { return nanosMin <= nanos && nanos <= nanosMax }
 
 // IsZero returns true if the specified money value is equal to zero.
-func IsZero(m pb.Money) bool { return m.GetUnits() == 0 && m.GetNanos() == 0 }
+func IsZero(m *pb.Money) bool { return m.GetUnits() == 0 && m.GetNanos() == 0 }
 
 // IsPositive returns true if the specified money value is valid and is
 // positive.
-func IsPositive(m pb.Money) bool {
+func IsPositive(m *pb.Money) bool {
 	return IsValid(m) && m.GetUnits() > 0 || (m.GetUnits() == 0 && m.GetNanos() > 0)
 }
 
 // IsNegative returns true if the specified money value is valid and is
 // negative.
-func IsNegative(m pb.Money) bool {
+func IsNegative(m *pb.Money) bool {
 	return IsValid(m) && m.GetUnits() < 0 || (m.GetUnits() == 0 && m.GetNanos() < 0)
 }
 
 // AreSameCurrency returns true if values l and r have a currency code and
 // they are the same values.
-func AreSameCurrency(l, r pb.Money) bool {
+func AreSameCurrency(l, r *pb.Money) bool {
 	return l.GetCurrencyCode() == r.GetCurrencyCode() && l.GetCurrencyCode() != ""
 }
 
 // AreEquals returns true if values l and r are the equal, including the
 // currency. This does not check validity of the provided values.
-func AreEquals(l, r pb.Money) bool {
+func AreEquals(l, r *pb.Money) bool {
 	return l.GetCurrencyCode() == r.GetCurrencyCode() &&
 		l.GetUnits() == r.GetUnits() && l.GetNanos() == r.GetNanos()
 }
 
+// Compare returns -1, 0 or +1 as l is less than, equal to or greater than r.
+// Returns an error if one of the values is invalid or currency codes are not
+// matching.
+func Compare(l, r *pb.Money) (int, error) {
+	if !IsValid(l) || !IsValid(r) {
+		return 0, ErrInvalidValue
+	} else if l.GetCurrencyCode() != r.GetCurrencyCode() {
+		return 0, ErrMismatchingCurrency
+	}
+	// Units and nanos of a valid value have the same sign, so comparing
+	// units first and then nanos orders values correctly.
+	switch {
+	case l.GetUnits() < r.GetUnits():
+		return -1, nil
+	case l.GetUnits() > r.GetUnits():
+		return 1, nil
+	case l.GetNanos() < r.GetNanos():
+		return -1, nil
+	case l.GetNanos() > r.GetNanos():
+		return 1, nil
+	}
+	return 0, nil
+}
+
 // Negate returns the same amount with the sign negated.
-func Negate(m pb.Money) pb.Money {
-	return pb.Money{
+func Negate(m *pb.Money) *pb.Money {
+	return &pb.Money{
 		Units:        -m.GetUnits(),
 		Nanos:        -m.GetNanos(),
 		CurrencyCode: m.GetCurrencyCode()}
@@ -80,7 +120,7 @@ func Negate(m pb.Money) pb.Money {
 
 // Must panics if the given error is not nil. This can be used with other
 // functions like: "m := Must(Sum(a,b))".
-func Must(v pb.Money, err error) pb.Money {
+func Must(v *pb.Money, err error) *pb.Money {
 	if err != nil {
 		panic(err)
 	}
@@ -90,18 +130,26 @@ func Must(v pb.Money, err error) pb.Money {
 // Sum adds two values. Returns an error if one of the values are invalid or
 // currency codes are not matching (unless currency code is unspecified for
 // both).
-func Sum(l, r pb.Money) (pb.Money, error) {
+func Sum(l, r *pb.Money) (*pb.Money, error) {
 	if !IsValid(l) || !IsValid(r) {
-		return pb.Money{}, ErrInvalidValue
+		return nil, ErrInvalidValue
 	} else if l.GetCurrencyCode() != r.GetCurrencyCode() {
-		return pb.Money{}, ErrMismatchingCurrency
+		return nil, ErrMismatchingCurrency
+	}
+	if (r.GetUnits() > 0 && l.GetUnits() > math.MaxInt64-r.GetUnits()) ||
+		(r.GetUnits() < 0 && l.GetUnits() < math.MinInt64-r.GetUnits()) {
+		return nil, ErrOverflow
 	}
 	units := l.GetUnits() + r.GetUnits()
 	nanos := l.GetNanos() + r.GetNanos()
 
-	if (units == 0 && nanos == 0) || (units > 0 && nanos >= 0) || (units < 0 && nanos <= 0) {
+	if units == 0 || (units > 0 && nanos >= 0) || (units < 0 && nanos <= 0) {
 		// same sign <units, nanos>
-		units += int64(nanos / nanosMod)
+		carry := int64(nanos / nanosMod)
+		if (carry > 0 && units == math.MaxInt64) || (carry < 0 && units == math.MinInt64) {
+			return nil, ErrOverflow
+		}
+		units += carry
 		nanos = nanos % nanosMod
 	} else {
 		// different sign. nanos guaranteed to not to go over the limit
@@ -114,7 +162,7 @@ func Sum(l, r pb.Money) (pb.Money, error) {
 		}
 	}
 
-	return pb.Money{
+	return &pb.Money{
 		Units:        units,
 		Nanos:        nanos,
 		CurrencyCode: l.GetCurrencyCode()}, nil
@@ -122,7 +170,7 @@ func Sum(l, r pb.Money) (pb.Money, error) {
 
 // MultiplySlow is a slow multiplication operation done through adding the value
 // to itself n-1 times.
-func MultiplySlow(m pb.Money, n uint32) pb.Money {
+func MultiplySlow(m *pb.Money, n uint32) *pb.Money {
 	out := m
 	for n > 1 {
 		out = Must(Sum(out, m))
@@ -130,3 +178,25 @@ func MultiplySlow(m pb.Money, n uint32) pb.Money {
 	}
 	return out
 }
+
+// Multiply returns m multiplied by n, computed exactly. Returns an error if m
+// is invalid or the product does not fit in a Money value.
+func Multiply(m *pb.Money, n int64) (*pb.Money, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	}
+	total := big.NewInt(m.GetUnits())
+	total.Mul(total, big.NewInt(nanosMod))
+	total.Add(total, big.NewInt(int64(m.GetNanos())))
+	total.Mul(total, big.NewInt(n))
+
+	// QuoRem truncates toward zero, so units and nanos keep the same sign.
+	units, nanos := new(big.Int).QuoRem(total, big.NewInt(nanosMod), new(big.Int))
+	if !units.IsInt64() {
+		return nil, ErrOverflow
+	}
+	return &pb.Money{
+		Units:        units.Int64(),
+		Nanos:        int32(nanos.Int64()),
+		CurrencyCode: m.GetCurrencyCode()}, nil
+}
@@ -15,20 +15,25 @@
 package money
 
 import (
+	"errors"
 	"fmt"
-	"reflect"
+	"math"
+	"math/big"
+	"strings"
 	"testing"
 
+	"google.golang.org/protobuf/proto"
+
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/checkoutservice/genproto"
 )
 
-func mmc(u int64, n int32, c string) pb.Money { return pb.Money{Units: u, Nanos: n, CurrencyCode: c} }
-func mm(u int64, n int32) pb.Money            { return mmc(u, n, "") }
+func mmc(u int64, n int32, c string) *pb.Money { return &pb.Money{Units: u, Nanos: n, CurrencyCode: c} }
+func mm(u int64, n int32) *pb.Money            { return mmc(u, n, "") }
 
 func TestIsValid(t *testing.T) {
 	tests := []struct {
 		name string
-		in   pb.Money
+		in   *pb.Money
 		want bool
 	}{
 		{"valid -/-", mm(-981273891273, -999999999), true},
@@ -49,10 +54,36 @@ func TestIsValid(t *testing.T) {
 	}
 }
 
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want string
+	}{
+		{"valid", mmc(-3, -500000000, ""), ""},
+		{"sign mismatch", mmc(3, -500000000, ""), "units 3 and nanos -500000000 have different signs"},
+		{"nanos overflow", mmc(3, 1000000000, ""), "nanos 1000000000 out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.in)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate(%v) = %v, want nil", tt.in, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate(%v) = %v, want ErrInvalidValue saying %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsZero(t *testing.T) {
 	tests := []struct {
 		name string
-		in   pb.Money
+		in   *pb.Money
 		want bool
 	}{
 		{"zero", mm(0, 0), true},
@@ -73,7 +104,7 @@ func TestIsZero(t *testing.T) {
 func TestIsPositive(t *testing.T) {
 	tests := []struct {
 		name string
-		in   pb.Money
+		in   *pb.Money
 		want bool
 	}{
 		{"zero", mm(0, 0), false},
@@ -94,7 +125,7 @@ func TestIsPositive(t *testing.T) {
 func TestIsNegative(t *testing.T) {
 	tests := []struct {
 		name string
-		in   pb.Money
+		in   *pb.Money
 		want bool
 	}{
 		{"zero", mm(0, 0), false},
@@ -114,8 +145,8 @@ func TestIsNegative(t *testing.T) {
 
 func TestAreSameCurrency(t *testing.T) {
 	type args struct {
-		l pb.Money
-		r pb.Money
+		l *pb.Money
+		r *pb.Money
 	}
 	tests := []struct {
 		name string
@@ -139,8 +170,8 @@ func TestAreSameCurrency(t *testing.T) {
 
 func TestAreEquals(t *testing.T) {
 	type args struct {
-		l pb.Money
-		r pb.Money
+		l *pb.Money
+		r *pb.Money
 	}
 	tests := []struct {
 		name string
@@ -162,11 +193,41 @@ func TestAreEquals(t *testing.T) {
 	}
 }
 
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name    string
+		l, r    *pb.Money
+		want    int
+		wantErr error
+	}{
+		{"equal", mmc(1, 2, "USD"), mmc(1, 2, "USD"), 0, nil},
+		{"units", mmc(2, 0, "USD"), mmc(1, 999999999, "USD"), 1, nil},
+		{"nanos", mmc(1, 1, "USD"), mmc(1, 2, "USD"), -1, nil},
+		{"negative nanos", mmc(-1, -5, "USD"), mmc(-1, -3, "USD"), -1, nil},
+		{"nanos only", mmc(0, -1, "USD"), mmc(0, 1, "USD"), -1, nil},
+		{"Error: mismatching currency", mmc(1, 0, "USD"), mmc(1, 0, "EUR"), 0, ErrMismatchingCurrency},
+		{"Error: invalid", mmc(1, -1, "USD"), mmc(1, 0, "USD"), 0, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compare(tt.l, tt.r)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("Compare([%v],[%v]) = %d, %v; want %d, %v", tt.l, tt.r, got, err, tt.want, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if back, _ := Compare(tt.r, tt.l); back != -tt.want {
+					t.Errorf("Compare([%v],[%v]) = %d, want %d", tt.r, tt.l, back, -tt.want)
+				}
+			}
+		})
+	}
+}
+
 func TestNegate(t *testing.T) {
 	tests := []struct {
 		name string
-		in   pb.Money
-		want pb.Money
+		in   *pb.Money
+		want *pb.Money
 	}{
 		{"zero", mm(0, 0), mm(0, 0)},
 		{"negative", mm(-1, -200), mm(1, 200)},
@@ -195,41 +256,47 @@ func TestMust_panic(t *testing.T) {
 			t.Logf("panic captured: %v", r)
 		}
 	}()
-	Must(mm(2, 3), fmt.Errorf("some error"))
+	Must(mmc(2, 3, ""), fmt.Errorf("some error"))
 	t.Fatal("this should not have executed due to the panic above")
 }
 
 func TestSum(t *testing.T) {
 	type args struct {
-		l pb.Money
-		r pb.Money
+		l *pb.Money
+		r *pb.Money
 	}
 	tests := []struct {
 		name    string
 		args    args
-		want    pb.Money
+		want    *pb.Money
 		wantErr error
 	}{
-		{"0+0=0", args{mm(0, 0), mm(0, 0)}, mm(0, 0), nil},
-		{"Error: currency code on left", args{mmc(0, 0, "XXX"), mm(0, 0)}, mm(0, 0), ErrMismatchingCurrency},
-		{"Error: currency code on right", args{mm(0, 0), mmc(0, 0, "YYY")}, mm(0, 0), ErrMismatchingCurrency},
-		{"Error: currency code mismatch", args{mmc(0, 0, "AAA"), mmc(0, 0, "BBB")}, mm(0, 0), ErrMismatchingCurrency},
-		{"Error: invalid +/-", args{mm(+1, -1), mm(0, 0)}, mm(0, 0), ErrInvalidValue},
-		{"Error: invalid -/+", args{mm(0, 0), mm(-1, +2)}, mm(0, 0), ErrInvalidValue},
-		{"Error: invalid nanos", args{mm(0, 1000000000), mm(1, 0)}, mm(0, 0), ErrInvalidValue},
-		{"both positive (no carry)", args{mm(2, 200000000), mm(2, 200000000)}, mm(4, 400000000), nil},
-		{"both positive (nanos=max)", args{mm(2, 111111111), mm(2, 888888888)}, mm(4, 999999999), nil},
-		{"both positive (carry)", args{mm(2, 200000000), mm(2, 900000000)}, mm(5, 100000000), nil},
-		{"both negative (no carry)", args{mm(-2, -200000000), mm(-2, -200000000)}, mm(-4, -400000000), nil},
-		{"both negative (carry)", args{mm(-2, -200000000), mm(-2, -900000000)}, mm(-5, -100000000), nil},
-		{"mixed (larger positive, just decimals)", args{mm(11, 0), mm(-2, 0)}, mm(9, 0), nil},
-		{"mixed (larger negative, just decimals)", args{mm(-11, 0), mm(2, 0)}, mm(-9, 0), nil},
-		{"mixed (larger positive, no borrow)", args{mm(11, 100000000), mm(-2, -100000000)}, mm(9, 0), nil},
-		{"mixed (larger positive, with borrow)", args{mm(11, 100000000), mm(-2, -9000000 /*.09*/)}, mm(9, 91000000 /*.091*/), nil},
-		{"mixed (larger negative, no borrow)", args{mm(-11, -100000000), mm(2, 100000000)}, mm(-9, 0), nil},
-		{"mixed (larger negative, with borrow)", args{mm(-11, -100000000), mm(2, 9000000 /*.09*/)}, mm(-9, -91000000 /*.091*/), nil},
-		{"0+negative", args{mm(0, 0), mm(-2, -100000000)}, mm(-2, -100000000), nil},
-		{"negative+0", args{mm(-2, -100000000), mm(0, 0)}, mm(-2, -100000000), nil},
+		{"0+0=0", args{mmc(0, 0, ""), mmc(0, 0, "")}, mmc(0, 0, ""), nil},
+		{"Error: currency code on left", args{mmc(0, 0, "XXX"), mmc(0, 0, "")}, nil, ErrMismatchingCurrency},
+		{"Error: currency code on right", args{mmc(0, 0, ""), mmc(0, 0, "YYY")}, nil, ErrMismatchingCurrency},
+		{"Error: currency code mismatch", args{mmc(0, 0, "AAA"), mmc(0, 0, "BBB")}, nil, ErrMismatchingCurrency},
+		{"Error: invalid +/-", args{mmc(+1, -1, ""), mmc(0, 0, "")}, nil, ErrInvalidValue},
+		{"Error: invalid -/+", args{mmc(0, 0, ""), mmc(-1, +2, "")}, nil, ErrInvalidValue},
+		{"Error: invalid nanos", args{mmc(0, 1000000000, ""), mmc(1, 0, "")}, nil, ErrInvalidValue},
+		{"both positive (no carry)", args{mmc(2, 200000000, ""), mmc(2, 200000000, "")}, mmc(4, 400000000, ""), nil},
+		{"both positive (nanos=max)", args{mmc(2, 111111111, ""), mmc(2, 888888888, "")}, mmc(4, 999999999, ""), nil},
+		{"both positive (carry)", args{mmc(2, 200000000, ""), mmc(2, 900000000, "")}, mmc(5, 100000000, ""), nil},
+		{"both negative (no carry)", args{mmc(-2, -200000000, ""), mmc(-2, -200000000, "")}, mmc(-4, -400000000, ""), nil},
+		{"both negative (carry)", args{mmc(-2, -200000000, ""), mmc(-2, -900000000, "")}, mmc(-5, -100000000, ""), nil},
+		{"mixed (larger positive, just decimals)", args{mmc(11, 0, ""), mmc(-2, 0, "")}, mmc(9, 0, ""), nil},
+		{"mixed (larger negative, just decimals)", args{mmc(-11, 0, ""), mmc(2, 0, "")}, mmc(-9, 0, ""), nil},
+		{"mixed (larger positive, no borrow)", args{mmc(11, 100000000, ""), mmc(-2, -100000000, "")}, mmc(9, 0, ""), nil},
+		{"mixed (larger positive, with borrow)", args{mmc(11, 100000000, ""), mmc(-2, -9000000 /*.09*/, "")}, mmc(9, 91000000 /*.091*/, ""), nil},
+		{"mixed (larger negative, no borrow)", args{mmc(-11, -100000000, ""), mmc(2, 100000000, "")}, mmc(-9, 0, ""), nil},
+		{"mixed (larger negative, with borrow)", args{mmc(-11, -100000000, ""), mmc(2, 9000000 /*.09*/, "")}, mmc(-9, -91000000 /*.091*/, ""), nil},
+		{"0+negative", args{mmc(0, 0, ""), mmc(-2, -100000000, "")}, mmc(-2, -100000000, ""), nil},
+		{"negative+0", args{mmc(-2, -100000000, ""), mmc(0, 0, "")}, mmc(-2, -100000000, ""), nil},
+		{"mixed (just nanos)", args{mmc(0, -99999919, ""), mmc(0, 9000040, "")}, mmc(0, -90999879, ""), nil},
+		{"Error: units overflow", args{mmc(math.MaxInt64, 0, ""), mmc(1, 0, "")}, nil, ErrOverflow},
+		{"Error: units underflow", args{mmc(math.MinInt64, 0, ""), mmc(-1, 0, "")}, nil, ErrOverflow},
+		{"Error: carry overflow", args{mmc(math.MaxInt64-1, 600000000, ""), mmc(1, 600000000, "")}, nil, ErrOverflow},
+		{"Error: borrow underflow", args{mmc(math.MinInt64+1, -600000000, ""), mmc(-1, -600000000, "")}, nil, ErrOverflow},
+		{"max+min", args{mmc(math.MaxInt64, 999999999, ""), mmc(math.MinInt64, -999999999, "")}, mmc(-1, 0, ""), nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -237,9 +304,139 @@ func TestSum(t *testing.T) {
 			if err != tt.wantErr {
 				t.Errorf("Sum([%v],[%v]): expected err=\"%v\" got=\"%v\"", tt.args.l, tt.args.r, tt.wantErr, err)
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !proto.Equal(got, tt.want) {
 				t.Errorf("Sum([%v],[%v]) = %v, want %v", tt.args.l, tt.args.r, got, tt.want)
 			}
 		})
 	}
 }
+
+func TestMultiply(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       *pb.Money
+		n       int64
+		want    *pb.Money
+		wantErr error
+	}{
+		{"zero quantity", mmc(15, 990000000, "USD"), 0, mmc(0, 0, "USD"), nil},
+		{"carry", mmc(10, 999999999, "USD"), 3, mmc(32, 999999997, "USD"), nil},
+		{"negative nanos", mmc(-10, -999999999, "USD"), 3, mmc(-32, -999999997, "USD"), nil},
+		{"negative quantity", mmc(2, 500000000, "USD"), -3, mmc(-7, -500000000, "USD"), nil},
+		{"nanos only", mmc(0, -999999999, "USD"), math.MaxInt32, mmc(-2147483644, -852516353, "USD"), nil},
+		{"large cart", mmc(9223372036, 854775807, "USD"), math.MaxInt32, nil, ErrOverflow},
+		{"Error: invalid +/-", mmc(1, -1, ""), 2, nil, ErrInvalidValue},
+		{"Error: invalid nanos", mmc(0, 1000000000, ""), 2, nil, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Multiply(tt.m, tt.n)
+			if err != tt.wantErr {
+				t.Errorf("Multiply([%v],%d): expected err=\"%v\" got=\"%v\"", tt.m, tt.n, tt.wantErr, err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("Multiply([%v],%d) = %v, want %v", tt.m, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+// toNanos returns the exact value of m in nanos.
+func toNanos(m *pb.Money) *big.Int {
+	v := big.NewInt(m.GetUnits())
+	v.Mul(v, big.NewInt(nanosMod))
+	return v.Add(v, big.NewInt(int64(m.GetNanos())))
+}
+
+func FuzzSum(f *testing.F) {
+	f.Add(int64(2), int32(200000000), int64(2), int32(900000000))
+	f.Add(int64(-11), int32(-100000000), int64(2), int32(9000000))
+	f.Add(int64(math.MaxInt64), int32(999999999), int64(0), int32(1))
+	f.Add(int64(math.MinInt64), int32(-999999999), int64(-1), int32(0))
+	f.Fuzz(func(t *testing.T, lu int64, ln int32, ru int64, rn int32) {
+		l, r := mmc(lu, ln, "USD"), mmc(ru, rn, "USD")
+		got, err := Sum(l, r)
+		if !IsValid(l) || !IsValid(r) {
+			if err != ErrInvalidValue {
+				t.Fatalf("Sum([%v],[%v]): expected ErrInvalidValue, got %v", l, r, err)
+			}
+			return
+		}
+		want := new(big.Int).Add(toNanos(l), toNanos(r))
+		if err == ErrOverflow {
+			if new(big.Int).Quo(want, big.NewInt(nanosMod)).IsInt64() {
+				t.Fatalf("Sum([%v],[%v]): unexpected overflow", l, r)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Sum([%v],[%v]): unexpected error %v", l, r, err)
+		}
+		if !IsValid(got) {
+			t.Fatalf("Sum([%v],[%v]) = %v is not valid", l, r, got)
+		}
+		if toNanos(got).Cmp(want) != 0 {
+			t.Fatalf("Sum([%v],[%v]) = %v, want %v nanos", l, r, got, want)
+		}
+		if swapped, _ := Sum(r, l); !proto.Equal(got, swapped) {
+			t.Fatalf("Sum is not commutative: %v != %v", got, swapped)
+		}
+	})
+}
+
+func FuzzMultiply(f *testing.F) {
+	f.Add(int64(15), int32(990000000), int64(2))
+	f.Add(int64(-10), int32(-999999999), int64(3))
+	f.Add(int64(0), int32(999999999), int64(math.MaxInt32))
+	f.Add(int64(math.MaxInt64), int32(0), int64(-1))
+	f.Fuzz(func(t *testing.T, u int64, n int32, q int64) {
+		m := mmc(u, n, "USD")
+		got, err := Multiply(m, q)
+		if !IsValid(m) {
+			if err != ErrInvalidValue {
+				t.Fatalf("Multiply([%v],%d): expected ErrInvalidValue, got %v", m, q, err)
+			}
+			return
+		}
+		want := new(big.Int).Mul(toNanos(m), big.NewInt(q))
+		if err == ErrOverflow {
+			if new(big.Int).Quo(want, big.NewInt(nanosMod)).IsInt64() {
+				t.Fatalf("Multiply([%v],%d): unexpected overflow", m, q)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Multiply([%v],%d): unexpected error %v", m, q, err)
+		}
+		if !IsValid(got) || got.GetCurrencyCode() != "USD" {
+			t.Fatalf("Multiply([%v],%d) = %v is not valid", m, q, got)
+		}
+		if toNanos(got).Cmp(want) != 0 {
+			t.Fatalf("Multiply([%v],%d) = %v, want %v nanos", m, q, got, want)
+		}
+		if q > 0 && q <= 64 {
+			if slow := MultiplySlow(m, uint32(q)); !proto.Equal(got, slow) {
+				t.Fatalf("Multiply([%v],%d) = %v, MultiplySlow = %v", m, q, got, slow)
+			}
+		}
+	})
+}
+
+func FuzzCompare(f *testing.F) {
+	f.Add(int64(1), int32(5), int64(1), int32(3))
+	f.Add(int64(-1), int32(-5), int64(0), int32(999999999))
+	f.Add(int64(math.MaxInt64), int32(999999999), int64(math.MinInt64), int32(-999999999))
+	f.Fuzz(func(t *testing.T, lu int64, ln int32, ru int64, rn int32) {
+		l, r := mmc(lu, ln, "USD"), mmc(ru, rn, "USD")
+		got, err := Compare(l, r)
+		if !IsValid(l) || !IsValid(r) {
+			if err != ErrInvalidValue {
+				t.Fatalf("Compare([%v],[%v]): expected ErrInvalidValue, got %v", l, r, err)
+			}
+			return
+		}
+		if want := toNanos(l).Cmp(toNanos(r)); err != nil || got != want {
+			t.Fatalf("Compare([%v],[%v]) = %d, %v; want %d", l, r, got, err, want)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbtls reads the TLS settings of Cloud SQL connections from the
+// environment, for the services that store data there.
+package dbtls
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Settings are the libpq TLS parameters of database connections, which lib/pq
+// and pgx both understand: the sslmode, the CA bundle the server certificate
+// is checked against, and an optional client certificate and key. Paths point
+// at PEM files, typically mounted from a Kubernetes Secret.
+type Settings struct {
+	Mode     string
+	RootCert string
+	Cert     string
+	Key      string
+}
+
+func (s Settings) String() string {
+	return fmt.Sprintf("mode=%s, root_cert=%q, client_cert=%q", s.Mode, s.RootCert, s.Cert)
+}
+
+// FromEnv reads the settings from the environment:
+//
+//	CLOUDSQL_SSL_MODE       one of modes, the sslmodes the caller's driver
+//	                        supports; defaultMode when unset
+//	CLOUDSQL_SSL_ROOT_CERT  PEM file of the server CA, needed by verify-ca
+//	                        and verify-full
+//	CLOUDSQL_SSL_CERT       PEM file of the client certificate
+//	CLOUDSQL_SSL_KEY        PEM file of the client certificate's key
+//
+// Files are checked here so a missing Secret mount fails at startup rather
+// than on the first connection.
+func FromEnv(defaultMode string, modes ...string) (Settings, error) {
+	s := Settings{
+		Mode:     os.Getenv("CLOUDSQL_SSL_MODE"),
+		RootCert: os.Getenv("CLOUDSQL_SSL_ROOT_CERT"),
+		Cert:     os.Getenv("CLOUDSQL_SSL_CERT"),
+		Key:      os.Getenv("CLOUDSQL_SSL_KEY"),
+	}
+	if s.Mode == "" {
+		s.Mode = defaultMode
+	}
+
+	if !slices.Contains(modes, s.Mode) {
+		return Settings{}, fmt.Errorf("unknown CLOUDSQL_SSL_MODE %q, want %s", s.Mode, orList(modes))
+	}
+	if s.Verified() && s.RootCert == "" {
+		return Settings{}, fmt.Errorf("CLOUDSQL_SSL_MODE=%s needs CLOUDSQL_SSL_ROOT_CERT", s.Mode)
+	}
+	if (s.Cert == "") != (s.Key == "") {
+		return Settings{}, fmt.Errorf("CLOUDSQL_SSL_CERT and CLOUDSQL_SSL_KEY must be set together")
+	}
+	for _, f := range []struct{ env, path string }{
+		{"CLOUDSQL_SSL_ROOT_CERT", s.RootCert},
+		{"CLOUDSQL_SSL_CERT", s.Cert},
+		{"CLOUDSQL_SSL_KEY", s.Key},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return Settings{}, fmt.Errorf("failed to read %s: %v", f.env, err)
+		}
+	}
+	return s, nil
+}
+
+// Verified reports whether the mode checks the server certificate against
+// RootCert.
+func (s Settings) Verified() bool {
+	return s.Mode == "verify-ca" || s.Mode == "verify-full"
+}
+
+// Params returns the connection string parameters of the settings.
+func (s Settings) Params() string {
+	p := []string{"sslmode=" + s.Mode}
+	if s.RootCert != "" {
+		p = append(p, "sslrootcert="+s.RootCert)
+	}
+	if s.Cert != "" {
+		p = append(p, "sslcert="+s.Cert, "sslkey="+s.Key)
+	}
+	return strings.Join(p, " ")
+}
+
+// orList joins words as "a, b or c".
+func orList(words []string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " or " + words[len(words)-1]
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbtls
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var libpqModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+func TestFromEnv(t *testing.T) {
+	s, err := FromEnv("disable", libpqModes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Params() != "sslmode=disable" || s.Verified() {
+		t.Errorf("default = %v", s)
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "verify-full")
+	if _, err := FromEnv("disable", libpqModes...); err == nil {
+		t.Error("verify-full without CLOUDSQL_SSL_ROOT_CERT succeeded, want error")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"server-ca.pem", "client-cert.pem", "client-key.pem"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("pem"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CLOUDSQL_SSL_ROOT_CERT", filepath.Join(dir, "server-ca.pem"))
+	t.Setenv("CLOUDSQL_SSL_CERT", filepath.Join(dir, "client-cert.pem"))
+	if _, err := FromEnv("disable", libpqModes...); err == nil {
+		t.Error("client certificate without key succeeded, want error")
+	}
+	t.Setenv("CLOUDSQL_SSL_KEY", filepath.Join(dir, "client-key.pem"))
+	s, err = FromEnv("disable", libpqModes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "sslmode=verify-full sslrootcert=" + filepath.Join(dir, "server-ca.pem") +
+		" sslcert=" + filepath.Join(dir, "client-cert.pem") +
+		" sslkey=" + filepath.Join(dir, "client-key.pem")
+	if s.Params() != want || !s.Verified() {
+		t.Errorf("Params = %q, want %q", s.Params(), want)
+	}
+
+	t.Setenv("CLOUDSQL_SSL_KEY", filepath.Join(dir, "missing.pem"))
+	if _, err := FromEnv("disable", libpqModes...); err == nil {
+		t.Error("missing key file succeeded, want error")
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "prefer")
+	_, err = FromEnv("disable", libpqModes...)
+	if want := `unknown CLOUDSQL_SSL_MODE "prefer", want disable, require, verify-ca or verify-full`; err == nil || err.Error() != want {
+		t.Errorf("FromEnv = %v, want %q", err, want)
+	}
+}
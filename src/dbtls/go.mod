@@ -0,0 +1,3 @@
+module github.com/GoogleCloudPlatform/microservices-demo/src/dbtls
+
+go 1.23.0
@@ -7,6 +7,7 @@ It runs as a standalone HTTP service that the Go product catalog service calls.
 """
 
 import os
+import sys
 import json
 import logging
 from typing import List, Dict, Any
@@ -18,8 +19,9 @@ from vertexai.language_models import TextEmbeddingModel
 logging.basicConfig(level=logging.INFO)
 logger = logging.getLogger(__name__)
 
-# Configuration
-PROJECT_ID = os.environ.get("PROJECT_ID", "gke-hack-471804")
+# Configuration. PROJECT_ID has no default, so the service never calls
+# Vertex AI in a project nobody chose; it exits at startup without one.
+PROJECT_ID = os.environ.get("PROJECT_ID", "")
 REGION = os.environ.get("REGION", "us-central1")
 MODEL_NAME = os.environ.get("EMBEDDING_MODEL", "text-embedding-004")
 
@@ -30,12 +32,15 @@ if not os.environ.get("GOOGLE_APPLICATION_CREDENTIALS"):
     logger.info("For Kubernetes, ensure the service account has Vertex AI permissions")
 
 # Initialize Vertex AI
-try:
-aiplatform.init(project=PROJECT_ID, location=REGION)
-    logger.info(f"Initialized Vertex AI for project {PROJECT_ID} in region {REGION}")
-except Exception as e:
-    logger.error(f"Failed to initialize Vertex AI: {e}")
-    logger.error("Make sure you have proper authentication and permissions for Vertex AI")
+if not PROJECT_ID:
+    logger.error("PROJECT_ID is not set: it is the Google Cloud project Vertex AI is called in")
+else:
+    try:
+        aiplatform.init(project=PROJECT_ID, location=REGION)
+        logger.info(f"Initialized Vertex AI for project {PROJECT_ID} in region {REGION}")
+    except Exception as e:
+        logger.error(f"Failed to initialize Vertex AI: {e}")
+        logger.error("Make sure you have proper authentication and permissions for Vertex AI")
 
 class VertexAIEmbeddingService:
     def __init__(self):
@@ -45,21 +50,21 @@ class VertexAIEmbeddingService:
     def _ensure_initialized(self):
         """Lazy initialization of the Vertex AI model."""
         if not self._initialized:
-        try:
-            self.model = TextEmbeddingModel.from_pretrained(MODEL_NAME)
-            logger.info(f"Initialized Vertex AI embedding model: {MODEL_NAME}")
+            try:
+                self.model = TextEmbeddingModel.from_pretrained(MODEL_NAME)
+                logger.info(f"Initialized Vertex AI embedding model: {MODEL_NAME}")
                 self._initialized = True
-        except Exception as e:
-            logger.error(f"Failed to initialize Vertex AI model: {e}")
+            except Exception as e:
+                logger.error(f"Failed to initialize Vertex AI model: {e}")
                 self._initialized = True  # Mark as initialized to avoid retrying
                 raise RuntimeError(f"Cannot initialize Vertex AI embedding model: {e}") from e
 
     def generate_embedding(self, text: str) -> List[float]:
         """Generate embedding for a single text."""
-            if not text or not text.strip():
-                # Return zero vector for empty text
-                return [0.0] * 768
-            
+        if not text or not text.strip():
+            # Return zero vector for empty text
+            return [0.0] * 768
+
         # Ensure model is initialized
         self._ensure_initialized()
         
@@ -82,9 +87,9 @@ class VertexAIEmbeddingService:
 
     def generate_embeddings_batch(self, texts: List[str]) -> List[List[float]]:
         """Generate embeddings for multiple texts."""
-            if not texts:
-                return []
-            
+        if not texts:
+            return []
+
         # Ensure model is initialized
         self._ensure_initialized()
         
@@ -223,6 +228,8 @@ def create_app():
     return app
 
 if __name__ == "__main__":
+    if not PROJECT_ID:
+        sys.exit("PROJECT_ID is required")
     app = create_app()
     port = int(os.environ.get("PORT", 8081))
     app.run(host="0.0.0.0", port=port, debug=False) 
\ No newline at end of file
@@ -34,6 +34,17 @@ fi
 
 echo ""
 
+# Contract verification against protos/embedding_contract.json
+echo "📜 Verifying embedding service contract..."
+if python -m pytest tests/test_contract.py -v --tb=short; then
+    echo "✅ Contract verification passed"
+else
+    echo "❌ Contract verification failed"
+    exit 1
+fi
+
+echo ""
+
 # Test 2: Error Handling (no credentials)
 echo "🚨 Test 2: Error Handling (No Credentials)"
 echo "------------------------------------------"
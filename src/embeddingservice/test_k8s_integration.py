@@ -8,10 +8,12 @@ and verifies all endpoints work correctly with Workload Identity.
 Prerequisites:
 - Embedding service deployed to Kubernetes
 - Port forwarding active: kubectl port-forward svc/embeddingservice 8081:8081
+- Optionally PROJECT_ID, the project the service was deployed in
 
 Run with: python test_k8s_integration.py
 """
 
+import os
 import requests
 import json
 import time
@@ -35,7 +37,10 @@ class EmbeddingServiceK8sTest:
             data = response.json()
             assert data["status"] == "healthy"
             assert data["service"] == "vertex-ai-embedding-service"
-            assert data["project"] == "gke-hack-471804"
+            assert data["project"]
+            # PROJECT_ID, when set, is the project the service was deployed in.
+            if os.environ.get("PROJECT_ID"):
+                assert data["project"] == os.environ["PROJECT_ID"]
             assert data["model"] == "text-embedding-004"
             
             print(f"✅ Health check passed")
@@ -231,8 +236,9 @@ class EmbeddingServiceK8sTest:
             
             if result.returncode == 0:
                 gcp_sa = result.stdout.strip()
-                expected_sa = "embedding-service@gke-hack-471804.iam.gserviceaccount.com"
-                if gcp_sa == expected_sa:
+                project_id = os.environ.get("PROJECT_ID")
+                expected_sa = f"embedding-service@{project_id}.iam.gserviceaccount.com"
+                if project_id and gcp_sa == expected_sa:
                     print(f"✅ Workload Identity annotation correct: {gcp_sa}")
                 else:
                     print(f"⚠️  Unexpected service account: {gcp_sa}")
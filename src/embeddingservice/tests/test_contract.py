@@ -0,0 +1,92 @@
+#!/usr/bin/env python3
+"""
+Provider verification for the embedding service contract.
+
+The contract in protos/embedding_contract.json is replayed by the Go product
+catalog service against a fake server. These tests check that this service
+still produces responses of the agreed shape, so a change here cannot
+silently break the Go client.
+"""
+
+import json
+import os
+import sys
+import unittest
+from unittest.mock import Mock, patch
+
+sys.path.append(os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
+
+import embedding_service
+from embedding_service import VertexAIEmbeddingService, create_app
+
+CONTRACT_PATH = os.path.join(
+    os.path.dirname(os.path.abspath(__file__)), "..", "..", "..", "protos", "embedding_contract.json")
+
+TYPES = {
+    "object": dict,
+    "array": list,
+    "string": str,
+    "number": (int, float),
+    "integer": int,
+}
+
+
+def validate(testcase, schema, value, path):
+    """Validate value against the subset of JSON Schema used by the contract."""
+    testcase.assertIsInstance(value, TYPES[schema["type"]], f"{path}: wrong type")
+    if schema["type"] == "object":
+        for name in schema.get("required", []):
+            testcase.assertIn(name, value, f"{path}: missing required field {name!r}")
+        for name, prop in schema.get("properties", {}).items():
+            if name in value:
+                validate(testcase, prop, value[name], f"{path}.{name}")
+    elif schema["type"] == "array":
+        for item in value:
+            validate(testcase, schema["items"], item, f"{path}[]")
+
+
+class TestEmbeddingContract(unittest.TestCase):
+    """Verify the service against every interaction in the shared contract."""
+
+    @classmethod
+    def setUpClass(cls):
+        with open(CONTRACT_PATH) as f:
+            cls.contract = json.load(f)
+
+    def _service_for_state(self, state):
+        """Build a service whose model behaves as the provider state requires."""
+        service = VertexAIEmbeddingService()
+        service._initialized = True
+        if state == "model unavailable":
+            service.model = None
+        else:
+            embedding = Mock()
+            embedding.values = [0.1] * 768
+            service.model = Mock()
+            service.model.get_embeddings.side_effect = lambda texts: [embedding] * len(texts)
+        return service
+
+    def test_interactions(self):
+        for interaction in self.contract["interactions"]:
+            with self.subTest(interaction["description"]):
+                service = self._service_for_state(interaction.get("providerState"))
+                with patch.object(embedding_service, "embedding_service", service):
+                    client = create_app().test_client()
+                    request = interaction["request"]
+                    response = client.open(
+                        request["path"], method=request["method"], json=request["body"])
+
+                expected = interaction["response"]
+                self.assertEqual(response.status_code, expected["status"])
+                body = response.get_json()
+                validate(self, self.contract["schemas"][expected["schema"]], body, "response")
+                if "embedding" in body:
+                    self.assertEqual(body["dimensions"], len(body["embedding"]))
+                if "embeddings" in body:
+                    self.assertEqual(body["count"], len(request["body"]["texts"]))
+                    for values in body["embeddings"]:
+                        self.assertEqual(body["dimensions"], len(values))
+
+
+if __name__ == "__main__":
+    unittest.main()
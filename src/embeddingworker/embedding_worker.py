@@ -34,7 +34,8 @@ class EmbeddingWorker:
         self.db_user = os.getenv('DB_USER', 'postgres')
         self.db_name = os.getenv('DB_NAME', 'products')
         self.secret_name = os.getenv('ALLOYDB_SECRET_NAME', 'cloudsql-secret-private')
-        self.project_id = os.getenv('PROJECT_ID', 'gke-hack-471804')
+        # No default project: the password secret is read from PROJECT_ID
+        self.project_id = os.getenv('PROJECT_ID', '')
         
         # Database password will be fetched from Secret Manager
         self.db_password = None
@@ -234,6 +235,10 @@ class EmbeddingWorker:
         """Main worker loop"""
         logger.info("🚀 Starting Embedding Worker Service...")
         
+        if not self.project_id:
+            logger.error("❌ PROJECT_ID is required. Exiting.")
+            sys.exit(1)
+        
         # Test embedding service
         if not self.test_embedding_service():
             logger.error("❌ Embedding service is not available. Exiting.")
@@ -44,7 +44,7 @@ func (fe *frontendServer) getCurrencies(ctx context.Context) ([]string, error) {
 
 func (fe *frontendServer) getProducts(ctx context.Context) ([]*pb.Product, error) {
 	resp, err := pb.NewProductCatalogServiceClient(fe.productCatalogSvcConn).
-		ListProducts(ctx, &pb.Empty{})
+		ListProducts(ctx, &pb.ListProductsRequest{})
 	return resp.GetProducts(), err
 }
 
@@ -12,10 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+const path = require('path');
 const cardValidator = require('simple-card-validator');
 const { v4: uuidv4 } = require('uuid');
 const pino = require('pino');
 
+const PersistentMap = require('./store');
+
 const logger = pino({
   name: 'paymentservice-charge',
   messageKey: 'message',
@@ -52,14 +55,68 @@ class ExpiredCreditCard extends CreditCardError {
   }
 }
 
+class UnknownTransaction extends Error {
+  constructor (transactionId) {
+    super(`No authorized transaction ${transactionId}`);
+    this.code = 5; // Not found error
+  }
+}
+
+class SettledTransaction extends Error {
+  constructor (transactionId, state) {
+    super(`Transaction ${transactionId} was already ${state}`);
+    this.code = 9; // Failed precondition error
+  }
+}
+
+// Transactions of recent charges by idempotency key, oldest first, so a
+// retried charge returns the transaction of the first instead of charging
+// again. Bounded to the latest MAX_IDEMPOTENCY_KEYS keys. The keys are kept
+// in PAYMENT_STATE_DIR, on a volume, to survive a restart; without it they
+// are lost with the process.
+const MAX_IDEMPOTENCY_KEYS = 10000;
+const stateDir = process.env.PAYMENT_STATE_DIR;
+if (!stateDir) {
+  logger.warn('PAYMENT_STATE_DIR is not set: idempotency keys and authorizations are kept in memory only');
+}
+const transactions = new PersistentMap(stateDir && path.join(stateDir, 'transactions.jsonl'));
+
+// Transactions authorized with authorize_only, oldest first, to whether they
+// are AUTHORIZED, CAPTURED or VOIDED. Kept in PAYMENT_STATE_DIR like the
+// idempotency keys, so a held order can be captured after a restart. Only
+// settled transactions are dropped to keep MAX_IDEMPOTENCY_KEYS of them.
+const AUTHORIZED = 'authorized';
+const CAPTURED = 'captured';
+const VOIDED = 'voided';
+const authorizations = new PersistentMap(stateDir && path.join(stateDir, 'authorizations.jsonl'));
+
+// remember sets key to value in map, dropping its oldest entry whose value
+// may be dropped once it holds more than MAX_IDEMPOTENCY_KEYS.
+function remember (map, key, value, droppable = () => true) {
+  map.set(key, value);
+  if (map.size <= MAX_IDEMPOTENCY_KEYS) { return; }
+  for (const [oldKey, oldValue] of map) {
+    if (droppable(oldValue)) {
+      map.delete(oldKey);
+      return;
+    }
+  }
+}
+
 /**
- * Verifies the credit card number and (pretend) charges the card.
+ * Verifies the credit card number and (pretend) charges the card, or only
+ * authorizes the amount with authorize_only, to be charged by capture. A
+ * request with the idempotency_key of an earlier charge is not charged again.
  *
  * @param {*} request
- * @return transaction_id - a random uuid.
+ * @return transaction_id - a random uuid, or that of the earlier charge.
  */
 module.exports = function charge (request) {
-  const { amount, credit_card: creditCard } = request;
+  const { amount, credit_card: creditCard, idempotency_key: key, authorize_only: authorizeOnly } = request;
+  if (key && transactions.has(key)) {
+    logger.info(`Transaction ${transactions.get(key)} already processed for idempotency key ${key}`);
+    return { transaction_id: transactions.get(key) };
+  }
   const cardNumber = creditCard.credit_card_number;
   const cardInfo = cardValidator(cardNumber);
   const {
@@ -79,8 +136,55 @@ module.exports = function charge (request) {
   const { credit_card_expiration_year: year, credit_card_expiration_month: month } = creditCard;
   if ((currentYear * 12 + currentMonth) > (year * 12 + month)) { throw new ExpiredCreditCard(cardNumber.replace('-', ''), month, year); }
 
-  logger.info(`Transaction processed: ${cardType} ending ${cardNumber.substr(-4)} \
+  const transactionId = uuidv4();
+  logger.info(`Transaction ${authorizeOnly ? 'authorized' : 'processed'}: ${cardType} ending ${cardNumber.substr(-4)} \
     Amount: ${amount.currency_code}${amount.units}.${amount.nanos}`);
 
-  return { transaction_id: uuidv4() };
+  if (authorizeOnly) {
+    remember(authorizations, transactionId, AUTHORIZED, (state) => state !== AUTHORIZED);
+  }
+  if (key) {
+    remember(transactions, key, transactionId);
+  }
+  return { transaction_id: transactionId };
+};
+
+/**
+ * (Pretend) charges a card authorized by charge with authorize_only. A
+ * transaction that was already captured is not charged again; one that was
+ * voided can't be captured.
+ *
+ * @param {*} request
+ * @return transaction_id - that of the authorization.
+ */
+module.exports.capture = function capture (request) {
+  const { transaction_id: transactionId } = request;
+  const state = authorizations.get(transactionId);
+  if (!state) { throw new UnknownTransaction(transactionId); }
+  if (state === VOIDED) { throw new SettledTransaction(transactionId, state); }
+  if (state === AUTHORIZED) {
+    authorizations.set(transactionId, CAPTURED);
+    logger.info(`Transaction captured: ${transactionId}`);
+  }
+  return { transaction_id: transactionId };
+};
+
+/**
+ * Releases a card authorized by charge with authorize_only, so it is never
+ * charged. A transaction that was already voided is left alone; one that was
+ * captured can't be voided.
+ *
+ * @param {*} request
+ * @return transaction_id - that of the authorization.
+ */
+module.exports.void = function voidAuthorization (request) {
+  const { transaction_id: transactionId } = request;
+  const state = authorizations.get(transactionId);
+  if (!state) { throw new UnknownTransaction(transactionId); }
+  if (state === CAPTURED) { throw new SettledTransaction(transactionId, state); }
+  if (state === AUTHORIZED) {
+    authorizations.set(transactionId, VOIDED);
+    logger.info(`Transaction voided: ${transactionId}`);
+  }
+  return { transaction_id: transactionId };
 };
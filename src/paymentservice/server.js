@@ -49,6 +49,38 @@ class HipsterShopServer {
     }
   }
 
+  /**
+   * Handler for PaymentService.Capture.
+   * @param {*} call  { CaptureRequest }
+   * @param {*} callback  fn(err, ChargeResponse)
+   */
+  static CaptureServiceHandler(call, callback) {
+    try {
+      logger.info(`PaymentService#Capture invoked with request ${JSON.stringify(call.request)}`);
+      const response = charge.capture(call.request);
+      callback(null, response);
+    } catch (err) {
+      console.warn(err);
+      callback(err);
+    }
+  }
+
+  /**
+   * Handler for PaymentService.Void.
+   * @param {*} call  { VoidRequest }
+   * @param {*} callback  fn(err, ChargeResponse)
+   */
+  static VoidServiceHandler(call, callback) {
+    try {
+      logger.info(`PaymentService#Void invoked with request ${JSON.stringify(call.request)}`);
+      const response = charge.void(call.request);
+      callback(null, response);
+    } catch (err) {
+      console.warn(err);
+      callback(err);
+    }
+  }
+
   static CheckHandler(call, callback) {
     callback(null, { status: 'SERVING' });
   }
@@ -88,7 +120,9 @@ class HipsterShopServer {
     this.server.addService(
       hipsterShopPackage.PaymentService.service,
       {
-        charge: HipsterShopServer.ChargeServiceHandler.bind(this)
+        charge: HipsterShopServer.ChargeServiceHandler.bind(this),
+        capture: HipsterShopServer.CaptureServiceHandler.bind(this),
+        void: HipsterShopServer.VoidServiceHandler.bind(this)
       }
     );
 
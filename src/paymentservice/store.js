@@ -0,0 +1,100 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+const fs = require('fs');
+
+const logger = require('./logger');
+
+/**
+ * A map whose changes are journaled to a file, so it survives a restart. Each
+ * set appends a [key, value] line and each delete a [key] line, synced before
+ * returning. The journal is replayed when the map is opened, and rewritten
+ * with only the live entries then and whenever it has grown to twice their
+ * number. Without a file the map is kept in memory only.
+ */
+class PersistentMap {
+  constructor (file) {
+    this.file = file;
+    this.entries = new Map();
+    this.lines = 0;
+    this.fd = null;
+    if (!file) { return; }
+    if (fs.existsSync(file)) {
+      for (const line of fs.readFileSync(file, 'utf8').split('\n')) {
+        if (!line) { continue; }
+        let entry;
+        try {
+          entry = JSON.parse(line);
+        } catch (err) {
+          // The last line is cut short if the process died writing it.
+          logger.warn(`Skipping unreadable line of ${file}`);
+          continue;
+        }
+        if (entry.length === 2) {
+          this.entries.set(entry[0], entry[1]);
+        } else {
+          this.entries.delete(entry[0]);
+        }
+      }
+    }
+    this.compact();
+    logger.info(`Loaded ${this.entries.size} entries from ${file}`);
+  }
+
+  get size () { return this.entries.size; }
+
+  has (key) { return this.entries.has(key); }
+
+  get (key) { return this.entries.get(key); }
+
+  /** Iterates the entries, oldest first. */
+  [Symbol.iterator] () { return this.entries[Symbol.iterator](); }
+
+  set (key, value) {
+    this.entries.set(key, value);
+    this.append([key, value]);
+  }
+
+  delete (key) {
+    if (!this.entries.delete(key)) { return; }
+    this.append([key]);
+  }
+
+  append (entry) {
+    if (this.fd === null) { return; }
+    fs.writeSync(this.fd, JSON.stringify(entry) + '\n');
+    fs.fsyncSync(this.fd);
+    if (++this.lines > 2 * this.entries.size + 1000) {
+      this.compact();
+    }
+  }
+
+  // compact rewrites the journal with the live entries, replacing it
+  // atomically, and reopens it for appending.
+  compact () {
+    const tmp = `${this.file}.tmp`;
+    const fd = fs.openSync(tmp, 'w');
+    for (const entry of this.entries) {
+      fs.writeSync(fd, JSON.stringify(entry) + '\n');
+    }
+    fs.fsyncSync(fd);
+    fs.closeSync(fd);
+    fs.renameSync(tmp, this.file);
+    if (this.fd !== null) { fs.closeSync(this.fd); }
+    this.fd = fs.openSync(this.file, 'a');
+    this.lines = this.entries.size;
+  }
+}
+
+module.exports = PersistentMap;
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// adminServicePrefix starts the full method names of the admin API, every
+// one of which needs the admin token.
+const adminServicePrefix = "/hipstershop.ProductCatalogAdminService/"
+
+// adminPublicMethods are the methods of the public catalog service that
+// still need the admin token, as they write data the searches rank by.
+var adminPublicMethods = map[string]bool{
+	"/hipstershop.ProductCatalogService/RecordProductInteraction": true,
+}
+
+// adminAuth holds the bearer token admin callers present in the
+// "authorization" metadata, as "Bearer <token>". An empty token refuses
+// every admin call.
+type adminAuth struct {
+	token string
+}
+
+// authorize checks that ctx carries the admin token. It returns
+// UNAUTHENTICATED without a bearer token and PERMISSION_DENIED for a wrong
+// one.
+func (a adminAuth) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, v := range md.Get("authorization") {
+		if t, ok := strings.CutPrefix(v, "Bearer "); ok {
+			token = strings.TrimSpace(t)
+		}
+	}
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "admin RPCs need an admin bearer token")
+	}
+	if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return status.Error(codes.PermissionDenied, "invalid admin token")
+	}
+	return nil
+}
+
+// isAdminMethod reports whether a full method name needs the admin token.
+func isAdminMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, adminServicePrefix) || adminPublicMethods[fullMethod]
+}
+
+// unaryInterceptor authorizes the calls of admin methods.
+func (a adminAuth) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if isAdminMethod(info.FullMethod) {
+		if err := a.authorize(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminAuthInterceptor(t *testing.T) {
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		auth   adminAuth
+		method string
+		ctx    context.Context
+		want   codes.Code
+	}{
+		{"public method", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogService/ListProducts", context.Background(), codes.OK},
+		{"admin token", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogAdminService/CreateProduct", withToken("s3cret"), codes.OK},
+		{"no token", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogAdminService/CreateProduct", context.Background(), codes.Unauthenticated},
+		{"wrong token", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogAdminService/DeleteProduct", withToken("guess"), codes.PermissionDenied},
+		{"interaction with admin token", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogService/RecordProductInteraction", withToken("s3cret"), codes.OK},
+		{"interaction without token", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogService/RecordProductInteraction", context.Background(), codes.Unauthenticated},
+		{"merchandising rule without token", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogAdminService/CreateMerchandisingRule", context.Background(), codes.Unauthenticated},
+		{"merchandising rules with wrong token", adminAuth{token: "s3cret"}, "/hipstershop.ProductCatalogAdminService/ListMerchandisingRules", withToken("guess"), codes.PermissionDenied},
+		{"no admin token configured", adminAuth{}, "/hipstershop.ProductCatalogAdminService/DeleteProduct", withToken(""), codes.Unauthenticated},
+		{"empty admin token", adminAuth{}, "/hipstershop.ProductCatalogAdminService/DeleteProduct", withToken("anything"), codes.PermissionDenied},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.auth.unaryInterceptor(tc.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+			if status.Code(err) != tc.want {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// campaignsSchemaSQL creates the table of campaigns. Expiring a campaign
+// that has not started yet moves both ends to the same time.
+const campaignsSchemaSQL = `
+	CREATE TABLE IF NOT EXISTS campaigns (
+		id BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		category TEXT NOT NULL,
+		boost DOUBLE PRECISION NOT NULL CHECK (boost > 0 AND boost <= 2),
+		starts_at TIMESTAMPTZ NOT NULL,
+		ends_at TIMESTAMPTZ NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		CHECK (ends_at >= starts_at)
+	);`
+
+// campaignsReady is set once campaignsSchemaSQL has been applied.
+var campaignsReady atomic.Bool
+
+// ensureCampaignsSchema applies campaignsSchemaSQL.
+func ensureCampaignsSchema(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, campaignsSchemaSQL); err != nil {
+		return fmt.Errorf("failed to create campaigns: %v", err)
+	}
+	campaignsReady.Store(true)
+	return nil
+}
+
+// campaign is a Campaign ready to apply.
+type campaign struct {
+	id         int64
+	name       string
+	category   string
+	boost      float64
+	start, end time.Time
+}
+
+// newCampaign validates c.
+func newCampaign(c *pb.Campaign) (campaign, error) {
+	r := campaign{
+		id:       c.GetId(),
+		name:     strings.TrimSpace(c.GetName()),
+		category: strings.ToLower(strings.TrimSpace(c.GetCategory())),
+		boost:    c.GetBoost(),
+	}
+	switch {
+	case r.category == "":
+		return campaign{}, fmt.Errorf("category is required")
+	case !(r.boost > 0 && r.boost <= 2):
+		return campaign{}, fmt.Errorf("boost must be in (0, 2]")
+	case c.StartTime == nil || c.EndTime == nil:
+		return campaign{}, fmt.Errorf("start_time and end_time are required")
+	}
+	r.start, r.end = c.StartTime.AsTime(), c.EndTime.AsTime()
+	if r.end.Before(r.start) {
+		return campaign{}, fmt.Errorf("end_time must not be before start_time")
+	}
+	return r, nil
+}
+
+// proto returns the campaign as a Campaign.
+func (c campaign) proto() *pb.Campaign {
+	return &pb.Campaign{
+		Id:        c.id,
+		Name:      c.name,
+		Category:  c.category,
+		Boost:     c.boost,
+		StartTime: timestamppb.New(c.start),
+		EndTime:   timestamppb.New(c.end),
+	}
+}
+
+// active reports whether the campaign runs at now.
+func (c campaign) active(now time.Time) bool {
+	return !now.Before(c.start) && now.Before(c.end)
+}
+
+// campaigns holds the campaigns loaded from the database, refreshed with the
+// merchandising rules.
+var campaigns atomic.Pointer[[]campaign]
+
+// currentCampaigns returns the loaded campaigns.
+func currentCampaigns() []campaign {
+	if c := campaigns.Load(); c != nil {
+		return *c
+	}
+	return nil
+}
+
+// campaignBoosts returns the boost of each category at now: the largest of
+// the active campaigns on the category or on one of its ancestors.
+func campaignBoosts(list []campaign, now time.Time) map[string]float64 {
+	var boosts map[string]float64
+	for _, c := range list {
+		if !c.active(now) {
+			continue
+		}
+		if boosts == nil {
+			boosts = make(map[string]float64)
+		}
+		for _, category := range currentCategories().expand([]string{c.category}) {
+			boosts[category] = max(boosts[category], c.boost)
+		}
+	}
+	return boosts
+}
+
+// boostCampaigns subtracts the boost of the product's categories from
+// ranking r, appending the categories and their boosts to args. Without an
+// active campaign r is returned as it is.
+func boostCampaigns(r productRanking, args []interface{}) (productRanking, []interface{}) {
+	boosts := campaignBoosts(currentCampaigns(), time.Now())
+	if len(boosts) == 0 {
+		return r, args
+	}
+	categories := make([]string, 0, len(boosts))
+	for category := range boosts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	values := make([]float64, len(categories))
+	for i, category := range categories {
+		values[i] = boosts[category]
+	}
+	args = append(args, categories, values)
+	boost := fmt.Sprintf(`(-COALESCE((SELECT max(c.boost) FROM unnest($%d::text[], $%d::float8[]) AS c(category, boost)
+		WHERE c.category = ANY(%s)), 0))`, len(args)-1, len(args), productCategoriesSQL)
+	if r.penalty != "" {
+		r.penalty = fmt.Sprintf(`(%s + %s)`, r.penalty, boost)
+	} else {
+		r.penalty = boost
+	}
+	r.score = fmt.Sprintf(`(%s + %s)`, r.score, boost)
+	return r, args
+}
+
+// promoteCampaigns moves the products of boosted categories ahead of the
+// others, the most boosted first, keeping the order within each boost. It is
+// the keyword fallback's counterpart of boostCampaigns, for results in
+// relevance order.
+func promoteCampaigns(products []*pb.Product) []*pb.Product {
+	boosts := campaignBoosts(currentCampaigns(), time.Now())
+	if len(boosts) == 0 {
+		return products
+	}
+	boost := func(p *pb.Product) float64 {
+		var b float64
+		for _, category := range p.Categories {
+			b = max(b, boosts[strings.ToLower(category)])
+		}
+		return b
+	}
+	sort.SliceStable(products, func(i, j int) bool { return boost(products[i]) > boost(products[j]) })
+	return products
+}
+
+// queryCampaigns reads every campaign from the database.
+func queryCampaigns(ctx context.Context) ([]campaign, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, category, boost, starts_at, ends_at
+		FROM campaigns
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query campaigns: %v", err)
+	}
+	defer rows.Close()
+
+	var list []campaign
+	for rows.Next() {
+		var c campaign
+		if err := rows.Scan(&c.id, &c.name, &c.category, &c.boost, &c.start, &c.end); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign: %v", err)
+		}
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read campaigns: %v", err)
+	}
+	return list, nil
+}
+
+// reloadCampaigns swaps in the campaigns from the database. The loaded
+// campaigns are kept if they cannot be read.
+func reloadCampaigns(ctx context.Context) error {
+	list, err := queryCampaigns(ctx)
+	if err != nil {
+		return err
+	}
+	campaigns.Store(&list)
+	return nil
+}
+
+// CreateCampaign stores a campaign and applies it on this replica right
+// away; other replicas pick it up within MERCHANDISING_REFRESH_INTERVAL.
+func (a *catalogAdmin) CreateCampaign(ctx context.Context, req *pb.Campaign) (*pb.Campaign, error) {
+	c, err := newCampaign(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid campaign: %v", err)
+	}
+	if !dbReady.Load() || !campaignsReady.Load() {
+		return nil, status.Error(codes.Unavailable, "campaigns are not available")
+	}
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO campaigns (name, category, boost, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		c.name, c.category, c.boost, c.start, c.end).Scan(&c.id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create campaign: %v", err)
+	}
+	if err := reloadCampaigns(ctx); err != nil {
+		log.Warnf("Failed to reload campaigns: %v", err)
+	}
+	log.Infof("Created campaign %d boosting %s by %g", c.id, c.category, c.boost)
+	return c.proto(), nil
+}
+
+func (a *catalogAdmin) ListCampaigns(ctx context.Context, req *pb.Empty) (*pb.ListCampaignsResponse, error) {
+	if !dbReady.Load() || !campaignsReady.Load() {
+		return nil, status.Error(codes.Unavailable, "campaigns are not available")
+	}
+	list, err := queryCampaigns(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	resp := &pb.ListCampaignsResponse{}
+	for _, c := range list {
+		resp.Campaigns = append(resp.Campaigns, c.proto())
+	}
+	return resp, nil
+}
+
+// ExpireCampaign ends a campaign now. Campaigns that have already ended are
+// left as they are.
+func (a *catalogAdmin) ExpireCampaign(ctx context.Context, req *pb.ExpireCampaignRequest) (*pb.Campaign, error) {
+	if !dbReady.Load() || !campaignsReady.Load() {
+		return nil, status.Error(codes.Unavailable, "campaigns are not available")
+	}
+	var c campaign
+	err := db.QueryRowContext(ctx, `
+		UPDATE campaigns
+		SET ends_at = LEAST(ends_at, now()), starts_at = LEAST(starts_at, now())
+		WHERE id = $1
+		RETURNING id, name, category, boost, starts_at, ends_at`, req.GetId()).
+		Scan(&c.id, &c.name, &c.category, &c.boost, &c.start, &c.end)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "no campaign with ID %d", req.GetId())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to expire campaign %d: %v", req.GetId(), err)
+	}
+	if err := reloadCampaigns(ctx); err != nil {
+		log.Warnf("Failed to reload campaigns: %v", err)
+	}
+	log.Infof("Expired campaign %d", c.id)
+	return c.proto(), nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNewCampaign(t *testing.T) {
+	start := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC)
+	c, err := newCampaign(&pb.Campaign{Name: " Winter ", Category: " Clothing ", Boost: 0.2,
+		StartTime: timestamppb.New(start), EndTime: timestamppb.New(end)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.name != "Winter" || c.category != "clothing" || !c.start.Equal(start) || !c.end.Equal(end) {
+		t.Errorf("got %+v", c)
+	}
+
+	for name, c := range map[string]*pb.Campaign{
+		"no category":   {Boost: 0.2, StartTime: timestamppb.New(start), EndTime: timestamppb.New(end)},
+		"zero boost":    {Category: "clothing", StartTime: timestamppb.New(start), EndTime: timestamppb.New(end)},
+		"large boost":   {Category: "clothing", Boost: 3, StartTime: timestamppb.New(start), EndTime: timestamppb.New(end)},
+		"no end":        {Category: "clothing", Boost: 0.2, StartTime: timestamppb.New(start)},
+		"end too early": {Category: "clothing", Boost: 0.2, StartTime: timestamppb.New(end), EndTime: timestamppb.New(start)},
+	} {
+		if _, err := newCampaign(c); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCampaignBoosts(t *testing.T) {
+	defer categories.Store(categories.Load())
+	categories.Store(testCategoryTree())
+	now := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	list := []campaign{
+		{category: "apparel", boost: 0.1, start: now.Add(-time.Hour), end: now.Add(time.Hour)},
+		{category: "tops", boost: 0.3, start: now.Add(-time.Hour), end: now.Add(time.Hour)},
+		{category: "kitchen", boost: 0.5, start: now.Add(time.Hour), end: now.Add(2 * time.Hour)}, // not started
+		{category: "footwear", boost: 0.5, start: now.Add(-time.Hour), end: now},                  // ended
+	}
+	got := campaignBoosts(list, now)
+	want := map[string]float64{"apparel": 0.1, "clothing": 0.1, "footwear": 0.1, "tops": 0.3}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := campaignBoosts(list[2:], now); got != nil {
+		t.Errorf("without an active campaign: got %v, want none", got)
+	}
+}
+
+func TestBoostCampaigns(t *testing.T) {
+	defer campaigns.Store(campaigns.Load())
+	base := make([]interface{}, 7)
+
+	campaigns.Store(nil)
+	if r, args := boostCampaigns(distanceRanking, base); r != distanceRanking || len(args) != 7 {
+		t.Errorf("no campaigns: got %+v and %d args, want distanceRanking", r, len(args))
+	}
+
+	now := time.Now()
+	campaigns.Store(&[]campaign{{category: "kitchen", boost: 0.2, start: now.Add(-time.Hour), end: now.Add(time.Hour)}})
+	r, args := boostCampaigns(distanceRanking, base)
+	if len(args) != 9 || fmt.Sprint(args[7], args[8]) != "[kitchen] [0.2]" {
+		t.Fatalf("got args %v, want the categories and boosts appended", args)
+	}
+	if !strings.Contains(r.penalty, "unnest($8::text[], $9::float8[])") || r.score != "("+weightedDistanceSQL+" + "+r.penalty+")" {
+		t.Errorf("got ranking %+v", r)
+	}
+
+	// Under keyword fusion the boost is scaled to the fused score: half of it
+	// under weighted fusion, whose scores span [0, 1].
+	query, _ := keywordFusion{mode: fusionWeighted, keywordWeight: 0.3}.query("mug", 10, pb.SemanticSearchRequest_RELEVANCE,
+		r, "products p", "", "", args)
+	if w := "+ 0.5 * " + r.penalty + " AS similarity_score"; !strings.Contains(query, w) {
+		t.Errorf("fused query does not contain %q:\n%s", w, query)
+	}
+
+	// An out-of-stock penalty is kept alongside the boost.
+	demoted := productRanking{score: "s", penalty: "d"}
+	if r, _ := boostCampaigns(demoted, base); !strings.HasPrefix(r.penalty, "(d + ") {
+		t.Errorf("got penalty %s, want the demotion kept", r.penalty)
+	}
+}
+
+func TestPromoteCampaigns(t *testing.T) {
+	defer campaigns.Store(campaigns.Load())
+	now := time.Now()
+	campaigns.Store(&[]campaign{
+		{category: "kitchen", boost: 0.2, start: now.Add(-time.Hour), end: now.Add(time.Hour)},
+		{category: "clothing", boost: 0.4, start: now.Add(-time.Hour), end: now.Add(time.Hour)},
+	})
+	products := []*pb.Product{
+		{Id: "a"},
+		{Id: "b", Categories: []string{"Kitchen"}},
+		{Id: "c"},
+		{Id: "d", Categories: []string{"clothing"}},
+		{Id: "e", Categories: []string{"kitchen"}},
+	}
+	var ids []string
+	for _, p := range promoteCampaigns(products) {
+		ids = append(ids, p.Id)
+	}
+	if got := strings.Join(ids, ""); got != "dbeac" {
+		t.Errorf("got %s, want dbeac", got)
+	}
+}
+
+func TestCampaignAdminValidation(t *testing.T) {
+	admin := &catalogAdmin{catalog: &productCatalog{}}
+	if _, err := admin.CreateCampaign(context.Background(), &pb.Campaign{Category: "kitchen"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("campaign without a boost: got %v, want InvalidArgument", err)
+	}
+	if _, err := admin.ExpireCampaign(context.Background(), &pb.ExpireCampaignRequest{Id: 1}); status.Code(err) != codes.Unavailable {
+		t.Errorf("without a database: got %v, want Unavailable", err)
+	}
+}
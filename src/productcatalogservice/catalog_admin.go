@@ -0,0 +1,255 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pgUniqueViolation is the Postgres error code for a duplicate key.
+const pgUniqueViolation = "23505"
+
+// catalogAdmin implements ProductCatalogAdminService on top of the products
+// table. Each write embeds the product, stores the embeddings with it and
+// makes catalog reload the in-memory catalog on its next read.
+type catalogAdmin struct {
+	pb.UnimplementedProductCatalogAdminServiceServer
+	catalog *productCatalog
+}
+
+func (a *catalogAdmin) CreateProduct(ctx context.Context, req *pb.CreateProductRequest) (*pb.Product, error) {
+	product := req.GetProduct()
+	if err := validateProduct(product); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid product: %v", err)
+	}
+	err := a.write(ctx, product, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO `+productsTable+` (id, name, description, picture, price_usd_currency_code,
+				price_usd_units, price_usd_nanos, categories, target_tags, use_context, status, stock)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			productColumnValues(product)...)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return status.Errorf(codes.AlreadyExists, "product %s already exists", product.Id)
+		}
+		if err != nil {
+			return err
+		}
+		return writeVariants(ctx, tx, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	productEvents.emit(product.Id, pb.ProductChanged_CREATED, product)
+	return product, nil
+}
+
+func (a *catalogAdmin) UpdateProduct(ctx context.Context, req *pb.UpdateProductRequest) (*pb.Product, error) {
+	product := req.GetProduct()
+	if err := validateProduct(product); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid product: %v", err)
+	}
+	err := a.write(ctx, product, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE `+productsTable+`
+			SET name = $2, description = $3, picture = $4, price_usd_currency_code = $5,
+				price_usd_units = $6, price_usd_nanos = $7, categories = $8,
+				target_tags = $9, use_context = $10, status = $11, stock = $12
+			WHERE id = $1`,
+			productColumnValues(product)...)
+		if err != nil {
+			return err
+		}
+		if err := requireRowAffected(res, product.Id); err != nil {
+			return err
+		}
+		return writeVariants(ctx, tx, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	productEvents.emit(product.Id, pb.ProductChanged_UPDATED, product)
+	return product, nil
+}
+
+func (a *catalogAdmin) DeleteProduct(ctx context.Context, req *pb.DeleteProductRequest) (*pb.Empty, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if !dbReady.Load() {
+		return nil, status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	if err := ensureProductsSchema(ctx); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	// Discontinued products stay readable for the orders that reference
+	// them; purging removes them with their variants.
+	query, action, change := `UPDATE `+productsTable+` SET status = 'discontinued' WHERE id = $1`, "Discontinued", pb.ProductChanged_DISCONTINUED
+	if req.GetPurge() {
+		query, action, change = `DELETE FROM `+productsTable+` WHERE id = $1`, "Purged", pb.ProductChanged_PURGED
+	}
+	res, err := db.ExecContext(ctx, query, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete product %s: %v", req.Id, err)
+	}
+	if err := requireRowAffected(res, req.Id); err != nil {
+		return nil, err
+	}
+	a.catalog.invalidate()
+	productEvents.emit(req.Id, change, nil)
+	log.Infof("%s product %s", action, req.Id)
+	return &pb.Empty{}, nil
+}
+
+func (a *catalogAdmin) ReloadCatalog(ctx context.Context, req *pb.Empty) (*pb.ReloadCatalogResponse, error) {
+	if !dbReady.Load() {
+		return nil, status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	n, err := a.catalog.reload()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to reload catalog: %v", err)
+	}
+	log.Infof("Reloaded catalog (%d products)", n)
+	return &pb.ReloadCatalogResponse{Products: int32(n)}, nil
+}
+
+// write embeds product, then runs fn, which writes it, and stores the
+// embeddings in one transaction. The embedding provider is called before the
+// transaction opens, so a slow provider holds no locks. If embedding fails
+// the write is still committed: the row is then stale and the embedding
+// reconciler picks it up later. Errors from fn that are already gRPC
+// statuses are returned as they are.
+func (a *catalogAdmin) write(ctx context.Context, product *pb.Product, fn func(tx *sql.Tx) error) error {
+	if !dbReady.Load() {
+		return status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	if err := ensureProductsSchema(ctx); err != nil {
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+	id := product.Id
+	pending := []pendingProduct{pendingFromProduct(product)}
+	embeddings, embedErr := embedPendingProducts(ctx, pending)
+	if embedErr != nil {
+		log.Warnf("Failed to embed product %s, leaving it to the reconciler: %v", id, embedErr)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Internal, "failed to write product %s: %v", id, err)
+	}
+	if embedErr == nil {
+		if err := storeProductEmbeddings(ctx, tx, pending, embeddings); err != nil {
+			return status.Errorf(codes.Internal, "%v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return status.Errorf(codes.Internal, "failed to commit product %s: %v", id, err)
+	}
+	a.catalog.invalidate()
+	log.Infof("Wrote product %s", id)
+	return nil
+}
+
+// validateProduct checks the fields the products table requires.
+func validateProduct(p *pb.Product) error {
+	switch {
+	case p == nil:
+		return fmt.Errorf("product is required")
+	case strings.TrimSpace(p.Id) == "":
+		return fmt.Errorf("id is required")
+	case strings.TrimSpace(p.Name) == "":
+		return fmt.Errorf("name is required")
+	case p.PriceUsd == nil:
+		return fmt.Errorf("price_usd is required")
+	}
+	nanos, err := priceBound("price_usd", p.PriceUsd)
+	if err != nil {
+		return err
+	}
+	if *nanos < 0 {
+		return fmt.Errorf("price_usd must not be negative")
+	}
+	if _, ok := pb.Product_Status_name[int32(p.Status)]; !ok {
+		return fmt.Errorf("unknown status %d", p.Status)
+	}
+	if err := validateStock("stock", p.Stock); err != nil {
+		return err
+	}
+	return validateVariants(p)
+}
+
+// productColumnValues returns the column values of p in products table order,
+// from id to use_context, followed by status and stock.
+func productColumnValues(p *pb.Product) []interface{} {
+	return []interface{}{
+		p.Id, p.Name, p.Description, p.Picture, "USD",
+		p.PriceUsd.GetUnits(), p.PriceUsd.GetNanos(),
+		strings.ToLower(strings.Join(p.Categories, ",")),
+		nonNilStrings(p.TargetTags), nonNilStrings(p.UseContext),
+		statusColumn(p.Status), p.Stock,
+	}
+}
+
+// pendingFromProduct holds the texts of p as the products table stores them,
+// for embedding p before it is written.
+func pendingFromProduct(p *pb.Product) pendingProduct {
+	text := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	return pendingProduct{
+		id:          text(p.Id),
+		name:        text(p.Name),
+		description: text(p.Description),
+		categories:  text(strings.ToLower(strings.Join(p.Categories, ","))),
+		targetTags:  text("{" + strings.Join(p.TargetTags, ",") + "}"),
+		useContext:  text("{" + strings.Join(p.UseContext, ",") + "}"),
+	}
+}
+
+// nonNilStrings stores an absent list as an empty array rather than NULL.
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// requireRowAffected returns NotFound if res changed no row.
+func requireRowAffected(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return status.Errorf(codes.NotFound, "no product with ID %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateProduct(t *testing.T) {
+	valid := func() *pb.Product {
+		return &pb.Product{Id: "MUG1", Name: "Mug", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 8, Nanos: 990000000}}
+	}
+	if err := validateProduct(valid()); err != nil {
+		t.Errorf("valid product rejected: %v", err)
+	}
+
+	for name, mutate := range map[string]func(p *pb.Product){
+		"missing id":     func(p *pb.Product) { p.Id = " " },
+		"missing name":   func(p *pb.Product) { p.Name = "" },
+		"missing price":  func(p *pb.Product) { p.PriceUsd = nil },
+		"other currency": func(p *pb.Product) { p.PriceUsd.CurrencyCode = "EUR" },
+		"negative price": func(p *pb.Product) { p.PriceUsd = &pb.Money{Units: -1} },
+	} {
+		p := valid()
+		mutate(p)
+		if err := validateProduct(p); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := validateProduct(nil); err == nil {
+		t.Error("nil product: expected error")
+	}
+}
+
+func TestCatalogAdminRequiresDatabase(t *testing.T) {
+	admin := &catalogAdmin{catalog: &productCatalog{}}
+	product := &pb.Product{Id: "MUG1", Name: "Mug", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 8}}
+
+	if _, err := admin.CreateProduct(context.Background(), &pb.CreateProductRequest{Product: product}); status.Code(err) != codes.Unavailable {
+		t.Errorf("CreateProduct without database = %v, want Unavailable", err)
+	}
+	if _, err := admin.DeleteProduct(context.Background(), &pb.DeleteProductRequest{Id: "MUG1"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("DeleteProduct without database = %v, want Unavailable", err)
+	}
+	if _, err := admin.UpdateProduct(context.Background(), &pb.UpdateProductRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UpdateProduct without product = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,447 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// csvColumns are the columns of CSV catalog documents, in export order.
+// Imports take them in any order; id, name and price_usd are required.
+// price_usd is a decimal amount such as 19.99, the list columns separate
+// their items with csvListSeparator, status defaults to active and an empty
+// stock leaves stock untracked.
+var csvColumns = []string{"id", "name", "description", "picture", "price_usd", "categories", "target_tags", "use_context", "status", "stock"}
+
+const csvListSeparator = ";"
+
+func (a *catalogAdmin) ImportProducts(ctx context.Context, req *pb.ImportProductsRequest) (*pb.ImportProductsResponse, error) {
+	products, err := decodeProducts(req.GetFormat(), req.GetData())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid document: %v", err)
+	}
+	if err := validateImport(products); err != nil {
+		return nil, err
+	}
+	if !dbReady.Load() {
+		return nil, status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	if err := ensureProductsSchema(ctx); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	// The products are embedded before the transaction opens, so a slow
+	// provider holds no locks. A dry run embeds nothing.
+	var pending []pendingProduct
+	var embeddings [][]float32
+	var embedErr error
+	if !req.GetDryRun() {
+		if pending, err = productsToEmbed(ctx, products, req.GetReplaceExisting()); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+		if len(pending) > 0 {
+			if embeddings, embedErr = embedPendingProducts(ctx, pending); embedErr != nil {
+				log.Warnf("Failed to embed %d imported products, leaving them to the reconciler: %v", len(pending), embedErr)
+			}
+		}
+	}
+
+	// A dry run writes like a real import, so the counts are exact, and
+	// rolls back.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	resp := &pb.ImportProductsResponse{}
+	var written []string
+	changes := make(map[string]pb.ProductChanged_Change)
+	for _, p := range products {
+		// CSV documents have no variants, so they leave them as they are.
+		withVariants := req.GetFormat() == pb.CatalogFormat_CATALOG_FORMAT_JSON
+		created, err := importProduct(ctx, tx, p, req.GetReplaceExisting(), withVariants)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			resp.Skipped++
+			continue
+		case status.Code(err) == codes.AlreadyExists:
+			return nil, err
+		case err != nil:
+			return nil, status.Errorf(codes.Internal, "failed to write product %s: %v", p.Id, err)
+		case created:
+			resp.Created++
+			changes[p.Id] = pb.ProductChanged_CREATED
+		default:
+			resp.Replaced++
+			changes[p.Id] = pb.ProductChanged_UPDATED
+		}
+		written = append(written, p.Id)
+	}
+	if req.GetDryRun() {
+		return resp, nil
+	}
+
+	if len(written) > 0 {
+		if embedErr != nil {
+			resp.EmbeddingPending = int32(len(written))
+		} else {
+			// Products written since productsToEmbed looked, which it
+			// did not embed, are left to the reconciler.
+			pending, embeddings = writtenEmbeddings(pending, embeddings, written)
+			resp.EmbeddingPending = int32(len(written) - len(pending))
+			if err := storeProductEmbeddings(ctx, tx, pending, embeddings); err != nil {
+				return nil, status.Errorf(codes.Internal, "%v", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to commit import: %v", err)
+	}
+	a.catalog.invalidate()
+	for _, p := range products {
+		if change, ok := changes[p.Id]; ok {
+			productEvents.emit(p.Id, change, p)
+		}
+	}
+	log.Infof("Imported products: %d created, %d replaced, %d skipped", resp.Created, resp.Replaced, resp.Skipped)
+	return resp, nil
+}
+
+func (a *catalogAdmin) ExportProducts(ctx context.Context, req *pb.ExportProductsRequest) (*pb.ExportProductsResponse, error) {
+	if !dbReady.Load() || !productsSchemaReady.Load() {
+		return nil, status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	var catalog pb.ListProductsResponse
+	if err := loadCatalogFromDB(&catalog); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	// Summaries are derived on load; documents only carry the variants.
+	for _, p := range catalog.Products {
+		p.VariantSummary = nil
+	}
+	data, err := encodeProducts(req.GetFormat(), catalog.Products)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode catalog: %v", err)
+	}
+	return &pb.ExportProductsResponse{Data: data, Products: int32(len(catalog.Products))}, nil
+}
+
+// importProduct inserts p, or with replace replaces the product with its id,
+// and reports whether it was created. With withVariants the variants of the
+// product are replaced by those of p. An existing product that is not
+// replaced returns sql.ErrNoRows.
+func importProduct(ctx context.Context, tx *sql.Tx, p *pb.Product, replace, withVariants bool) (bool, error) {
+	conflict := `DO NOTHING`
+	if replace {
+		conflict = `DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description,
+			picture = EXCLUDED.picture, price_usd_currency_code = EXCLUDED.price_usd_currency_code,
+			price_usd_units = EXCLUDED.price_usd_units, price_usd_nanos = EXCLUDED.price_usd_nanos,
+			categories = EXCLUDED.categories, target_tags = EXCLUDED.target_tags,
+			use_context = EXCLUDED.use_context, status = EXCLUDED.status, stock = EXCLUDED.stock`
+	}
+	// xmax is 0 only for rows the statement inserted.
+	var created bool
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO `+productsTable+` (id, name, description, picture, price_usd_currency_code,
+			price_usd_units, price_usd_nanos, categories, target_tags, use_context, status, stock)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) `+conflict+`
+		RETURNING xmax = 0`,
+		productColumnValues(p)...).Scan(&created)
+	if err != nil || !withVariants {
+		return created, err
+	}
+	return created, writeVariants(ctx, tx, p)
+}
+
+// productsToEmbed returns the products of an import that it will write:
+// all of them with replace, and otherwise those not in the table yet.
+func productsToEmbed(ctx context.Context, products []*pb.Product, replace bool) ([]pendingProduct, error) {
+	existing := make(map[string]bool)
+	if !replace {
+		ids := make([]string, len(products))
+		for i, p := range products {
+			ids[i] = p.Id
+		}
+		rows, err := db.QueryContext(ctx, `SELECT id FROM `+productsTable+` WHERE id = ANY($1::text[])`, ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing products: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return nil, fmt.Errorf("failed to scan existing product: %v", err)
+			}
+			existing[id] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read existing products: %v", err)
+		}
+	}
+	var pending []pendingProduct
+	for _, p := range products {
+		if !existing[p.Id] {
+			pending = append(pending, pendingFromProduct(p))
+		}
+	}
+	return pending, nil
+}
+
+// writtenEmbeddings keeps the products of pending, with their embeddings,
+// that are in written.
+func writtenEmbeddings(pending []pendingProduct, embeddings [][]float32, written []string) ([]pendingProduct, [][]float32) {
+	isWritten := make(map[string]bool, len(written))
+	for _, id := range written {
+		isWritten[id] = true
+	}
+	var keptPending []pendingProduct
+	var keptEmbeddings [][]float32
+	for i, p := range pending {
+		if isWritten[p.id.String] {
+			keptPending = append(keptPending, p)
+			keptEmbeddings = append(keptEmbeddings, embeddings[i*textsPerProduct:(i+1)*textsPerProduct]...)
+		}
+	}
+	return keptPending, keptEmbeddings
+}
+
+// validateImport checks every product of an import, returning
+// INVALID_ARGUMENT with a BadRequest detail listing each invalid one.
+func validateImport(products []*pb.Product) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	seen := make(map[string]int)
+	skus := make(map[string]int)
+	for i, p := range products {
+		err := validateProduct(p)
+		if err == nil {
+			if first, ok := seen[p.Id]; ok {
+				err = fmt.Errorf("id %s is also products[%d]", p.Id, first)
+			}
+			seen[p.Id] = i
+		}
+		for _, v := range p.GetVariants() {
+			if err != nil {
+				break
+			}
+			if first, ok := skus[v.Sku]; ok {
+				err = fmt.Errorf("sku %s is also a variant of products[%d]", v.Sku, first)
+			}
+			skus[v.Sku] = i
+		}
+		if err != nil {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("products[%d]", i),
+				Description: err.Error(),
+			})
+		}
+	}
+	if len(products) == 0 {
+		return status.Error(codes.InvalidArgument, "the document has no products")
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	st := status.Newf(codes.InvalidArgument, "%d of %d products are invalid, first %s: %s",
+		len(violations), len(products), violations[0].Field, violations[0].Description)
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// decodeProducts parses a catalog document. Products are returned even if
+// invalid; validateImport checks them.
+func decodeProducts(format pb.CatalogFormat, data []byte) ([]*pb.Product, error) {
+	switch format {
+	case pb.CatalogFormat_CATALOG_FORMAT_JSON:
+		var catalog pb.ListProductsResponse
+		if err := protojson.Unmarshal(data, &catalog); err != nil {
+			return nil, err
+		}
+		return catalog.Products, nil
+	case pb.CatalogFormat_CATALOG_FORMAT_CSV:
+		return decodeCSVProducts(data)
+	default:
+		return nil, fmt.Errorf("unknown format %v", format)
+	}
+}
+
+// decodeCSVProducts parses a CSV document with a header row. A price that
+// does not parse leaves price_usd unset, which validateImport reports.
+func decodeCSVProducts(data []byte) ([]*pb.Product, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(csvColumns, name) {
+			return nil, fmt.Errorf("unknown column %q, want %s", name, strings.Join(csvColumns, ", "))
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		index[name] = i
+	}
+	for _, required := range []string{"id", "name", "price_usd"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+
+	var products []*pb.Product
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return products, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		p := &pb.Product{
+			Id:          field("id"),
+			Name:        field("name"),
+			Description: field("description"),
+			Picture:     field("picture"),
+			Categories:  splitCSVList(field("categories")),
+			TargetTags:  splitCSVList(field("target_tags")),
+			UseContext:  splitCSVList(field("use_context")),
+		}
+		if price, err := parseUSD(field("price_usd")); err == nil {
+			p.PriceUsd = price
+		}
+		if s := field("status"); s != "" {
+			if p.Status, err = parseProductStatus(s); err != nil {
+				return nil, fmt.Errorf("products[%d]: %v", len(products), err)
+			}
+		}
+		if s := field("stock"); s != "" {
+			stock, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("products[%d]: stock %q is not an integer", len(products), s)
+			}
+			p.Stock = proto.Int32(int32(stock))
+		}
+		products = append(products, p)
+	}
+}
+
+// encodeProducts writes products as a catalog document.
+func encodeProducts(format pb.CatalogFormat, products []*pb.Product) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case pb.CatalogFormat_CATALOG_FORMAT_JSON:
+		data, err := protojson.MarshalOptions{Indent: "  "}.Marshal(&pb.ListProductsResponse{Products: products})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	case pb.CatalogFormat_CATALOG_FORMAT_CSV:
+		w := csv.NewWriter(&buf)
+		w.Write(csvColumns)
+		for _, p := range products {
+			w.Write([]string{
+				p.Id, p.Name, p.Description, p.Picture, formatUSD(p.PriceUsd),
+				strings.Join(p.Categories, csvListSeparator),
+				strings.Join(p.TargetTags, csvListSeparator),
+				strings.Join(p.UseContext, csvListSeparator),
+				statusColumn(p.Status), formatStock(p.Stock),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %v", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// splitCSVList splits a list column, dropping empty items.
+func splitCSVList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, csvListSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseUSD parses a non-negative decimal amount such as "19.99".
+func parseUSD(s string) (*pb.Money, error) {
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if !isDigits(whole) || (hasFrac && !isDigits(frac)) || len(frac) > 9 {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	nanos, _ := strconv.Atoi(frac + strings.Repeat("0", 9-len(frac)))
+	return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: int32(nanos)}, nil
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// formatUSD formats m as parseUSD reads it, with at least two decimals.
+func formatUSD(m *pb.Money) string {
+	frac := strings.TrimRight(fmt.Sprintf("%09d", m.GetNanos()), "0")
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	return fmt.Sprintf("%d.%s", m.GetUnits(), frac)
+}
+
+// formatStock writes an untracked stock level as an empty CSV field.
+func formatStock(stock *int32) string {
+	if stock == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*stock))
+}
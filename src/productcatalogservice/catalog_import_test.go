@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCatalogDocumentRoundTrip(t *testing.T) {
+	products := []*pb.Product{
+		{Id: "MUG1", Name: "Mug, large", Description: "Holds \"a lot\"", Picture: "/static/img/mug.jpg",
+			PriceUsd:   &pb.Money{CurrencyCode: "USD", Units: 8, Nanos: 990000000},
+			Categories: []string{"kitchen", "gifts"}, TargetTags: []string{"coffee lovers"}, UseContext: []string{"office"}},
+		{Id: "PEN1", Name: "Pen", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 2, Nanos: 500000}, Status: pb.Product_DISCONTINUED,
+			Stock: proto.Int32(0)},
+	}
+	for _, format := range []pb.CatalogFormat{pb.CatalogFormat_CATALOG_FORMAT_JSON, pb.CatalogFormat_CATALOG_FORMAT_CSV} {
+		data, err := encodeProducts(format, products)
+		if err != nil {
+			t.Fatalf("%v: encode: %v", format, err)
+		}
+		got, err := decodeProducts(format, data)
+		if err != nil {
+			t.Fatalf("%v: decode: %v\n%s", format, err, data)
+		}
+		if len(got) != len(products) {
+			t.Fatalf("%v: got %d products, want %d", format, len(got), len(products))
+		}
+		for i := range products {
+			if !proto.Equal(got[i], products[i]) {
+				t.Errorf("%v: product %d = %v, want %v", format, i, got[i], products[i])
+			}
+		}
+	}
+}
+
+func TestDecodeCSVProducts(t *testing.T) {
+	got, err := decodeProducts(pb.CatalogFormat_CATALOG_FORMAT_CSV,
+		[]byte("Price_USD,id,name,categories\n12,HAT1,Hat, hats ; ;summer \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.Product{Id: "HAT1", Name: "Hat", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 12},
+		Categories: []string{"hats", "summer"}}
+	if len(got) != 1 || !proto.Equal(got[0], want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+
+	for name, doc := range map[string]string{
+		"unknown column": "id,name,price_usd,colour\nHAT1,Hat,12,red\n",
+		"missing column": "id,name\nHAT1,Hat\n",
+		"repeated":       "id,name,price_usd,id\nHAT1,Hat,12,HAT2\n",
+		"ragged row":     "id,name,price_usd\nHAT1,Hat\n",
+		"unknown status": "id,name,price_usd,status\nHAT1,Hat,12,retired\n",
+		"bad stock":      "id,name,price_usd,stock\nHAT1,Hat,12,many\n",
+	} {
+		if _, err := decodeProducts(pb.CatalogFormat_CATALOG_FORMAT_CSV, []byte(doc)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseUSD(t *testing.T) {
+	for s, want := range map[string]*pb.Money{
+		"0":          {CurrencyCode: "USD"},
+		"19.99":      {CurrencyCode: "USD", Units: 19, Nanos: 990000000},
+		"3.5":        {CurrencyCode: "USD", Units: 3, Nanos: 500000000},
+		"1.00000001": {CurrencyCode: "USD", Units: 1, Nanos: 10},
+	} {
+		got, err := parseUSD(s)
+		if err != nil || !proto.Equal(got, want) {
+			t.Errorf("parseUSD(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "-1", "+1", "1.", "1.-5", "1.0000000001", "ten", ".5"} {
+		if _, err := parseUSD(s); err == nil {
+			t.Errorf("parseUSD(%q): expected error", s)
+		}
+	}
+	if got := formatUSD(&pb.Money{Units: 3, Nanos: 500000000}); got != "3.50" {
+		t.Errorf("formatUSD = %q, want 3.50", got)
+	}
+}
+
+func TestValidateImport(t *testing.T) {
+	price := &pb.Money{CurrencyCode: "USD", Units: 1}
+	err := validateImport([]*pb.Product{
+		{Id: "A", Name: "A", PriceUsd: price},
+		{Id: "B", PriceUsd: price},
+		{Id: "A", Name: "Again", PriceUsd: price},
+	})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("validateImport = %v, want InvalidArgument", err)
+	}
+	var fields []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "products[1]" || fields[1] != "products[2]" {
+		t.Errorf("violations = %v, want products[1] and products[2]", fields)
+	}
+
+	if err := validateImport(nil); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("empty import = %v, want InvalidArgument", err)
+	}
+}
+
+func TestImportExportRequireDatabase(t *testing.T) {
+	admin := &catalogAdmin{catalog: &productCatalog{}}
+	data := []byte(`{"products": [{"id": "MUG1", "name": "Mug", "priceUsd": {"currencyCode": "USD", "units": 8}}]}`)
+
+	if _, err := admin.ImportProducts(context.Background(), &pb.ImportProductsRequest{Data: data}); status.Code(err) != codes.Unavailable {
+		t.Errorf("ImportProducts without database = %v, want Unavailable", err)
+	}
+	if _, err := admin.ImportProducts(context.Background(), &pb.ImportProductsRequest{Data: []byte("{")}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ImportProducts of malformed JSON = %v, want InvalidArgument", err)
+	}
+	if _, err := admin.ExportProducts(context.Background(), &pb.ExportProductsRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("ExportProducts without database = %v, want Unavailable", err)
+	}
+}
+
+func TestWrittenEmbeddings(t *testing.T) {
+	pending := []pendingProduct{
+		pendingFromProduct(&pb.Product{Id: "A", Name: "Mug", Categories: []string{"Kitchen", "Gifts"}, TargetTags: []string{"cozy"}}),
+		pendingFromProduct(&pb.Product{Id: "B", Name: "Cup"}),
+	}
+	if p := pending[0]; p.categories.String != "kitchen,gifts" || p.targetTags.String != "{cozy}" || p.useContext.String != "{}" {
+		t.Errorf("pendingFromProduct = %+v, want the texts as the products table stores them", p)
+	}
+	var embeddings [][]float32
+	for i := 0; i < 2*textsPerProduct; i++ {
+		embeddings = append(embeddings, []float32{float32(i)})
+	}
+
+	kept, keptEmbeddings := writtenEmbeddings(pending, embeddings, []string{"B"})
+	if len(kept) != 1 || kept[0].id.String != "B" {
+		t.Fatalf("kept %+v, want B", kept)
+	}
+	if len(keptEmbeddings) != textsPerProduct || keptEmbeddings[0][0] != textsPerProduct {
+		t.Errorf("kept embeddings %v, want those of B", keptEmbeddings)
+	}
+}
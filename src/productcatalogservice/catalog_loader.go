@@ -19,7 +19,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
@@ -36,6 +35,13 @@ func loadCatalog(catalog *pb.ListProductsResponse) error {
 	log.Infof("CLOUDSQL_HOST value: '%s'", cloudsqlHost)
 	
 	if cloudsqlHost != "" {
+		// Once semantic search is connected and the products schema is up to
+		// date, read the products table it queries; before that, connect
+		// directly.
+		if dbReady.Load() && productsSchemaReady.Load() {
+			log.Info("Using products table for catalog")
+			return loadCatalogFromDB(catalog)
+		}
 		log.Info("Using Cloud SQL for catalog")
 		return loadCatalogFromCloudSQL(catalog)
 	}
@@ -58,12 +64,12 @@ func loadCatalogFromLocalFile(catalog *pb.ListProductsResponse) error {
 		return err
 	}
 
+	setVariantSummaries(catalog.Products)
 	log.Info("successfully parsed product catalog json")
 	return nil
 }
 
-func getSecretPayload(project, secret, version string) (string, error) {
-	ctx := context.Background()
+func getSecretPayload(ctx context.Context, project, secret, version string) (string, error) {
 	client, err := secretmanager.NewClient(ctx)
 	if err != nil {
 		log.Warnf("failed to create SecretManager client: %v", err)
@@ -88,21 +94,24 @@ func getSecretPayload(project, secret, version string) (string, error) {
 func loadCatalogFromCloudSQL(catalog *pb.ListProductsResponse) error {
 	log.Info("loading catalog from Cloud SQL...")
 
-	projectID := os.Getenv("PROJECT_ID")
 	pgHost := os.Getenv("CLOUDSQL_HOST")
 	pgDatabaseName := os.Getenv("ALLOYDB_DATABASE_NAME")
-	pgTableName := os.Getenv("ALLOYDB_TABLE_NAME")
-	pgSecretName := os.Getenv("ALLOYDB_SECRET_NAME")
 
-	pgPassword, err := getSecretPayload(projectID, pgSecretName, "latest")
+	var pgPassword string
+	var err error
+	if dbAuth.mode == dbAuthIAM {
+		pgPassword, err = dbAuth.tokens.token()
+	} else {
+		pgPassword, err = catalogPassword.get()
+	}
 	if err != nil {
 		return err
 	}
 
 	// Direct connection to Cloud SQL (like cartservice)
 	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s sslmode=disable",
-		pgHost, "postgres", pgPassword, pgDatabaseName,
+		"host=%s user=%s password=%s dbname=%s %s",
+		pgHost, dbAuth.user, pgPassword, pgDatabaseName, dbTLS.Params(),
 	)
 
 	pool, err := pgxpool.New(context.Background(), dsn)
@@ -112,9 +121,13 @@ func loadCatalogFromCloudSQL(catalog *pb.ListProductsResponse) error {
 	}
 	defer pool.Close()
 
-	query := "SELECT id, name, description, picture, price_usd_currency_code, price_usd_units, price_usd_nanos, categories, target_tags, use_context FROM " + pgTableName
+	query := "SELECT id, name, description, picture, price_usd_currency_code, price_usd_units, price_usd_nanos, categories, target_tags, use_context FROM " + productsTable
 	rows, err := pool.Query(context.Background(), query)
 	if err != nil {
+		if isAuthFailure(err) {
+			// The secret was likely rotated; refetch it for the next load.
+			catalogPassword.expire()
+		}
 		log.Warnf("failed to query database: %v", err)
 		return err
 	}
@@ -136,10 +149,7 @@ func loadCatalogFromCloudSQL(catalog *pb.ListProductsResponse) error {
 		}
 		
 		// Parse categories
-		if categories != "" {
-		categories = strings.ToLower(categories)
-			product.Categories = strings.Split(strings.Trim(categories, "{}"), ",")
-		}
+		product.Categories = splitCategories(categories)
 		
 		// Assign target_tags (already a []string slice from pgx)
 		if len(targetTags) > 0 {
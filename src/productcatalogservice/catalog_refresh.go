@@ -0,0 +1,170 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const (
+	defaultCatalogRefreshInterval = time.Minute
+
+	// catalogLoadTimeout bounds one read of the products table.
+	catalogLoadTimeout = 10 * time.Second
+)
+
+var (
+	// catalogRefreshInterval is how often a database-backed catalog is
+	// reread from the products table. Zero disables periodic refreshes.
+	catalogRefreshInterval = defaultCatalogRefreshInterval
+
+	// catalogReloads asks the catalog refresher for an immediate reload.
+	catalogReloads = make(chan struct{}, 1)
+)
+
+// catalogRefreshIntervalFromEnv reads CATALOG_REFRESH_INTERVAL. Zero turns
+// off periodic refreshes; forced reloads still work.
+func catalogRefreshIntervalFromEnv() (time.Duration, error) {
+	s := os.Getenv("CATALOG_REFRESH_INTERVAL")
+	if s == "" {
+		return defaultCatalogRefreshInterval, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("failed to parse CATALOG_REFRESH_INTERVAL (%s) as a non-negative time.Duration", s)
+	}
+	return v, nil
+}
+
+// catalogFromDB reports whether the catalog is backed by the products table.
+func catalogFromDB() bool {
+	return os.Getenv("CLOUDSQL_HOST") != ""
+}
+
+// requestCatalogReload asks the refresher to reload the catalog. It does not
+// block; a reload that is already pending covers this request.
+func requestCatalogReload() {
+	select {
+	case catalogReloads <- struct{}{}:
+	default:
+	}
+}
+
+// loadCatalogFromDB reads the catalog from the products table that semantic
+// search queries, so both serve the same products. catalog is only replaced
+// once every row has been read. Status, stock and variants come from the
+// schema update applied when the database is connected; loadCatalog only
+// reads through here once it has been.
+func loadCatalogFromDB(catalog *pb.ListProductsResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), catalogLoadTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, description, picture, price_usd_currency_code,
+			price_usd_units, price_usd_nanos, categories, target_tags, use_context, status, stock
+		FROM `+productsTable+` ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to query products: %v", err)
+	}
+	defer rows.Close()
+
+	var products []*pb.Product
+	for rows.Next() {
+		product := &pb.Product{PriceUsd: &pb.Money{}}
+		var categories, targetTags, useContext, status string
+		var stock sql.NullInt32
+		if err := rows.Scan(&product.Id, &product.Name, &product.Description, &product.Picture,
+			&product.PriceUsd.CurrencyCode, &product.PriceUsd.Units, &product.PriceUsd.Nanos,
+			&categories, &targetTags, &useContext, &status, &stock); err != nil {
+			return fmt.Errorf("failed to scan product: %v", err)
+		}
+		if product.Status, err = parseProductStatus(status); err != nil {
+			return fmt.Errorf("product %s: %v", product.Id, err)
+		}
+		if stock.Valid {
+			product.Stock = &stock.Int32
+		}
+		product.Categories = splitCategories(categories)
+		product.TargetTags = splitPostgresList(targetTags)
+		product.UseContext = splitPostgresList(useContext)
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read products: %v", err)
+	}
+	rows.Close()
+	if err := loadVariants(ctx, products); err != nil {
+		return err
+	}
+	setVariantSummaries(products)
+	tree, err := loadCategories(ctx)
+	if err != nil {
+		return err
+	}
+	catalog.Products = products
+	categories.Store(tree)
+	return nil
+}
+
+// reload rereads the catalog from its source and returns its size. The
+// loaded catalog is kept if the read fails.
+func (p *productCatalog) reload() (int, error) {
+	var fresh pb.ListProductsResponse
+	if err := loadCatalog(&fresh); err != nil {
+		return 0, err
+	}
+	p.setProducts(fresh.Products)
+	return len(fresh.Products), nil
+}
+
+// refreshCatalog reloads the catalog every interval, and whenever a reload is
+// requested, until ctx is done. Periodic reloads wait for the database to be
+// connected; until then the catalog loaded at startup is served.
+func (p *productCatalog) refreshCatalog(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		forced := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			if !dbReady.Load() {
+				continue
+			}
+		case <-catalogReloads:
+			forced = true
+		}
+		n, err := p.reload()
+		switch {
+		case err != nil:
+			log.Warnf("Catalog reload failed, keeping the loaded catalog: %v", err)
+		case forced:
+			log.Infof("Reloaded catalog (%d products)", n)
+		default:
+			log.Debugf("Refreshed catalog (%d products)", n)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestCatalogRefreshIntervalFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", defaultCatalogRefreshInterval, false},
+		{"0", 0, false},
+		{"5m", 5 * time.Minute, false},
+		{"-1s", 0, true},
+		{"soon", 0, true},
+	} {
+		t.Setenv("CATALOG_REFRESH_INTERVAL", tc.value)
+		got, err := catalogRefreshIntervalFromEnv()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: got error %v, want error %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestReloadKeepsCatalogOnFailure(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil { // no products.json
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{{Id: "kept"}}}}
+	if _, err := svc.reload(); err == nil {
+		t.Fatal("reload succeeded without a catalog source")
+	}
+	if got := svc.catalog.Products; len(got) != 1 || got[0].Id != "kept" {
+		t.Errorf("catalog after failed reload = %v, want the loaded one", got)
+	}
+}
+
+func TestRefreshCatalogForcedReload(t *testing.T) {
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{{Id: "old"}}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.refreshCatalog(ctx, 0)
+
+	requestCatalogReload()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n := len(svc.products())
+		if n == 9 { // products.json
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("catalog has %d products after a forced reload, want 9", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestReloadDuringReads replaces the catalog while RPCs read it. Run with
+// -race to check the two are synchronized.
+func TestReloadDuringReads(t *testing.T) {
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{{Id: "OLJCESPC7Z"}}}}
+	ctx := context.Background()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if _, err := svc.reload(); err != nil {
+				t.Error(err)
+				return
+			}
+			svc.invalidate()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if _, err := svc.ListProducts(ctx, &pb.ListProductsRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.GetProduct(ctx, &pb.GetProductRequest{Id: "OLJCESPC7Z"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pgForeignKeyViolation is the Postgres error code for a missing or still
+// referenced foreign key.
+const pgForeignKeyViolation = "23503"
+
+// categoryTree is the hierarchy of the categories table. Category ids are
+// the lowercase names products list in their categories.
+type categoryTree struct {
+	names    map[string]string
+	parent   map[string]string
+	children map[string][]string
+	// roots are the top-level categories; roots and children are ordered by
+	// name.
+	roots []string
+}
+
+// categoryRow is a row of the categories table.
+type categoryRow struct {
+	id, name, parent string
+}
+
+// categories is the tree loaded with the catalog. It stays empty for a
+// catalog read from products.json.
+var categories atomic.Pointer[categoryTree]
+
+// currentCategories returns the loaded category tree, which may be empty.
+func currentCategories() *categoryTree {
+	if t := categories.Load(); t != nil {
+		return t
+	}
+	return newCategoryTree(nil)
+}
+
+// newCategoryTree builds the tree of rows. A category whose parent is
+// missing, or whose ancestors loop back to it, is made top-level so every
+// category stays reachable.
+func newCategoryTree(rows []categoryRow) *categoryTree {
+	sort.Slice(rows, func(i, j int) bool {
+		if a, b := strings.ToLower(rows[i].name), strings.ToLower(rows[j].name); a != b {
+			return a < b
+		}
+		return rows[i].id < rows[j].id
+	})
+	t := &categoryTree{
+		names:    make(map[string]string, len(rows)),
+		parent:   make(map[string]string),
+		children: make(map[string][]string),
+	}
+	for _, r := range rows {
+		t.names[r.id] = r.name
+	}
+	for _, r := range rows {
+		if _, ok := t.names[r.parent]; ok {
+			t.parent[r.id] = r.parent
+		} else if r.parent != "" {
+			log.Warnf("Category %s has unknown parent %s, listing it at the top level", r.id, r.parent)
+		}
+	}
+	for _, r := range rows {
+		for id, steps := t.parent[r.id], 0; id != "" && steps < len(rows); id, steps = t.parent[id], steps+1 {
+			if id == r.id {
+				log.Warnf("Category %s is its own ancestor, listing it at the top level", r.id)
+				delete(t.parent, r.id)
+				break
+			}
+		}
+	}
+	for _, r := range rows {
+		if parent, ok := t.parent[r.id]; ok {
+			t.children[parent] = append(t.children[parent], r.id)
+		} else {
+			t.roots = append(t.roots, r.id)
+		}
+	}
+	return t
+}
+
+// expand returns ids followed by all their subcategories, without repeats.
+func (t *categoryTree) expand(ids []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for len(ids) > 0 {
+		id := ids[0]
+		ids = ids[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+		ids = append(ids, t.children[id]...)
+	}
+	return out
+}
+
+// proto returns the tree with the number of products in each subtree.
+// Product categories that are not in the tree are added at the top level.
+func (t *categoryTree) proto(products []*pb.Product) []*pb.Category {
+	counts := make(map[string]int32)
+	var loose []string
+	for _, p := range products {
+		counted := make(map[string]bool)
+		for _, c := range normalizeTerms(p.Categories) {
+			if _, ok := t.names[c]; !ok && counts[c] == 0 {
+				loose = append(loose, c)
+			}
+			for id := c; id != "" && !counted[id]; id = t.parent[id] {
+				counted[id] = true
+				counts[id]++
+			}
+		}
+	}
+
+	var node func(id string) *pb.Category
+	node = func(id string) *pb.Category {
+		c := &pb.Category{Id: id, Name: t.names[id], ProductCount: counts[id]}
+		for _, child := range t.children[id] {
+			c.Children = append(c.Children, node(child))
+		}
+		return c
+	}
+	var roots []*pb.Category
+	for _, id := range t.roots {
+		roots = append(roots, node(id))
+	}
+	for _, id := range loose {
+		roots = append(roots, &pb.Category{Id: id, Name: id, ProductCount: counts[id]})
+	}
+	sort.SliceStable(roots, func(i, j int) bool {
+		return strings.ToLower(roots[i].Name) < strings.ToLower(roots[j].Name)
+	})
+	return roots
+}
+
+func (p *productCatalog) ListCategories(ctx context.Context, req *pb.Empty) (*pb.ListCategoriesResponse, error) {
+	products := activeProducts(p.parseCatalog(), false)
+	return &pb.ListCategoriesResponse{Categories: currentCategories().proto(products)}, nil
+}
+
+// loadCategories reads the categories table.
+func loadCategories(ctx context.Context) (*categoryTree, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, name, coalesce(parent_id, '') FROM categories`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query categories: %v", err)
+	}
+	defer rows.Close()
+	var all []categoryRow
+	for rows.Next() {
+		var r categoryRow
+		if err := rows.Scan(&r.id, &r.name, &r.parent); err != nil {
+			return nil, fmt.Errorf("failed to scan category: %v", err)
+		}
+		all = append(all, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read categories: %v", err)
+	}
+	return newCategoryTree(all), nil
+}
+
+func (a *catalogAdmin) CreateCategory(ctx context.Context, req *pb.CreateCategoryRequest) (*pb.Category, error) {
+	id := strings.ToLower(strings.TrimSpace(req.GetId()))
+	parent := strings.ToLower(strings.TrimSpace(req.GetParentId()))
+	name := strings.TrimSpace(req.GetName())
+	switch {
+	case id == "":
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	case strings.Contains(id, ","):
+		// The products table stores categories comma-joined.
+		return nil, status.Error(codes.InvalidArgument, "id must not contain commas")
+	case name == "":
+		name = id
+	}
+	if !dbReady.Load() {
+		return nil, status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	if err := ensureProductsSchema(ctx); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	var parentID interface{}
+	if parent != "" {
+		parentID = parent
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO categories (id, name, parent_id) VALUES ($1, $2, $3)`, id, name, parentID)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation:
+		return nil, status.Errorf(codes.AlreadyExists, "category %s already exists", id)
+	case errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation:
+		return nil, status.Errorf(codes.NotFound, "no parent category %s", parent)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to create category %s: %v", id, err)
+	}
+	a.catalog.invalidate()
+	log.Infof("Created category %s", id)
+	return &pb.Category{Id: id, Name: name}, nil
+}
+
+func (a *catalogAdmin) DeleteCategory(ctx context.Context, req *pb.DeleteCategoryRequest) (*pb.Empty, error) {
+	id := strings.ToLower(strings.TrimSpace(req.GetId()))
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if !dbReady.Load() {
+		return nil, status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	res, err := db.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, id)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation:
+		return nil, status.Errorf(codes.FailedPrecondition, "category %s has subcategories", id)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to delete category %s: %v", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, status.Errorf(codes.NotFound, "no category with ID %s", id)
+	}
+	a.catalog.invalidate()
+	log.Infof("Deleted category %s", id)
+	return &pb.Empty{}, nil
+}
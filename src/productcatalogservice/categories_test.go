@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testCategoryTree() *categoryTree {
+	return newCategoryTree([]categoryRow{
+		{id: "tops", name: "Tops", parent: "clothing"},
+		{id: "clothing", name: "Clothing", parent: "apparel"},
+		{id: "footwear", name: "Footwear", parent: "apparel"},
+		{id: "apparel", name: "Apparel"},
+		{id: "kitchen", name: "Kitchen"},
+	})
+}
+
+func TestCategoryTreeExpand(t *testing.T) {
+	tree := testCategoryTree()
+	if got := fmt.Sprint(tree.expand([]string{"apparel"})); got != "[apparel clothing footwear tops]" {
+		t.Errorf("expand(apparel) = %s", got)
+	}
+	if got := fmt.Sprint(tree.expand([]string{"tops", "clothing", "hats"})); got != "[tops clothing hats]" {
+		t.Errorf("expand(tops, clothing, hats) = %s", got)
+	}
+}
+
+func TestCategoryTreeBreaksCycles(t *testing.T) {
+	tree := newCategoryTree([]categoryRow{
+		{id: "a", name: "A", parent: "b"},
+		{id: "b", name: "B", parent: "a"},
+		{id: "c", name: "C", parent: "gone"},
+	})
+	roots := tree.proto(nil)
+	var ids []string
+	for _, r := range roots {
+		ids = append(ids, r.Id)
+	}
+	if fmt.Sprint(ids) != "[a c]" || len(roots[0].Children) != 1 {
+		t.Errorf("got roots %v, want a with child b, and c", roots)
+	}
+}
+
+func TestCategoryTreeProto(t *testing.T) {
+	products := []*pb.Product{
+		{Id: "TANK1", Categories: []string{"clothing", "Tops"}},
+		{Id: "SHOE1", Categories: []string{"footwear"}},
+		{Id: "MUG1", Categories: []string{"kitchen", "gifts"}},
+	}
+	roots := testCategoryTree().proto(products)
+	if len(roots) != 3 {
+		t.Fatalf("got %d roots, want apparel, gifts and kitchen", len(roots))
+	}
+	apparel, gifts := roots[0], roots[1]
+	if apparel.Id != "apparel" || apparel.ProductCount != 2 {
+		t.Errorf("got %v, want apparel with 2 products", apparel)
+	}
+	if clothing := apparel.Children[0]; clothing.Id != "clothing" || clothing.ProductCount != 1 || clothing.Children[0].ProductCount != 1 {
+		t.Errorf("got %v, want clothing and tops with the tank top", clothing)
+	}
+	if gifts.Id != "gifts" || gifts.Name != "gifts" || gifts.ProductCount != 1 {
+		t.Errorf("got %v, want gifts, which is not in the tree, at the top level", gifts)
+	}
+}
+
+func TestListCategoriesWithoutTree(t *testing.T) {
+	resp, err := (&productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{
+		{Id: "MUG1", Categories: []string{"kitchen"}},
+		{Id: "JAR1", Categories: []string{"kitchen", "decor"}},
+	}}}).ListCategories(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Categories) != 2 {
+		t.Fatalf("got %v, want decor and kitchen", resp.Categories)
+	}
+	if got := fmt.Sprintf("%s %d %s %d", resp.Categories[0].Id, resp.Categories[0].ProductCount,
+		resp.Categories[1].Id, resp.Categories[1].ProductCount); got != "decor 1 kitchen 2" {
+		t.Errorf("got %v, want decor and kitchen", resp.Categories)
+	}
+}
+
+func TestSearchFiltersIncludeSubcategories(t *testing.T) {
+	defer categories.Store(categories.Load())
+	categories.Store(testCategoryTree())
+
+	f, err := parseSearchFilters(&pb.SemanticSearchRequest{Categories: []string{"Apparel"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.match(&pb.Product{Categories: []string{"tops"}}) || f.match(&pb.Product{Categories: []string{"kitchen"}}) {
+		t.Errorf("filter on apparel with categories %v", f.categories)
+	}
+}
+
+func TestCategoryAdminRequiresDatabase(t *testing.T) {
+	admin := &catalogAdmin{catalog: &productCatalog{}}
+	if _, err := admin.CreateCategory(context.Background(), &pb.CreateCategoryRequest{Id: "hats"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("CreateCategory without database = %v, want Unavailable", err)
+	}
+	if _, err := admin.CreateCategory(context.Background(), &pb.CreateCategoryRequest{Id: "hats,caps"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateCategory with a comma = %v, want InvalidArgument", err)
+	}
+	if _, err := admin.DeleteCategory(context.Background(), &pb.DeleteCategoryRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("DeleteCategory without id = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command loadgen drives SemanticSearchProducts and PlaceOrder over gRPC and
+// reports latency percentiles, so regressions in the vector query or the
+// checkout path can be caught before deploy.
+//
+//	go run ./cmd/loadgen -catalog-addr localhost:3550 -concurrency 8 -duration 30s
+//	go run ./cmd/loadgen -mode checkout -checkout-addr localhost:5050 -cart-addr localhost:7070
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var defaultQueries = []string{
+	"comfortable seating",
+	"kitchen appliances",
+	"winter clothing",
+	"home decor",
+	"office furniture",
+	"gift for a coffee lover",
+	"something to keep drinks cold",
+	"outdoor gear for camping",
+}
+
+func main() {
+	var (
+		mode         = flag.String("mode", "search", "workload to run: search, checkout or both")
+		catalogAddr  = flag.String("catalog-addr", "localhost:3550", "productcatalogservice address")
+		checkoutAddr = flag.String("checkout-addr", "localhost:5050", "checkoutservice address")
+		cartAddr     = flag.String("cart-addr", "localhost:7070", "cartservice address, used to fill carts before checkout")
+		concurrency  = flag.Int("concurrency", 4, "number of concurrent workers")
+		duration     = flag.Duration("duration", 30*time.Second, "how long to generate load")
+		timeout      = flag.Duration("timeout", 10*time.Second, "per-request timeout")
+		queriesFile  = flag.String("queries", "", "file with one search query per line (defaults to a built-in corpus)")
+		limit        = flag.Int("limit", 10, "SemanticSearchRequest.limit")
+		maxP99       = flag.Duration("max-p99", 0, "exit non-zero if any RPC's p99 latency exceeds this value")
+	)
+	flag.Parse()
+
+	queries := defaultQueries
+	if *queriesFile != "" {
+		q, err := readQueries(*queriesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read queries: %v\n", err)
+			os.Exit(2)
+		}
+		queries = q
+	}
+
+	var workloads []workload
+	if *mode == "search" || *mode == "both" {
+		conn := mustDial(*catalogAddr)
+		defer conn.Close()
+		workloads = append(workloads, &searchWorkload{
+			client:  pb.NewProductCatalogServiceClient(conn),
+			queries: queries,
+			limit:   int32(*limit),
+		})
+	}
+	if *mode == "checkout" || *mode == "both" {
+		catalogConn := mustDial(*catalogAddr)
+		defer catalogConn.Close()
+		cartConn := mustDial(*cartAddr)
+		defer cartConn.Close()
+		checkoutConn := mustDial(*checkoutAddr)
+		defer checkoutConn.Close()
+		w := &checkoutWorkload{
+			catalog:  pb.NewProductCatalogServiceClient(catalogConn),
+			cart:     pb.NewCartServiceClient(cartConn),
+			checkout: pb.NewCheckoutServiceClient(checkoutConn),
+		}
+		if err := w.init(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to prepare checkout workload: %v\n", err)
+			os.Exit(2)
+		}
+		workloads = append(workloads, w)
+	}
+	if len(workloads) == 0 {
+		fmt.Fprintf(os.Stderr, "unknown -mode %q\n", *mode)
+		os.Exit(2)
+	}
+
+	results := run(workloads, *concurrency, *duration, *timeout)
+
+	failed := false
+	fmt.Printf("%-24s %8s %8s %9s %10s %10s %10s %10s\n", "rpc", "count", "errors", "rps", "p50", "p90", "p99", "max")
+	for _, w := range workloads {
+		r := results[w.name()]
+		s := r.summarize(*duration)
+		fmt.Printf("%-24s %8d %8d %9.1f %10v %10v %10v %10v\n",
+			w.name(), s.count, s.errors, s.rps, s.p50, s.p90, s.p99, s.max)
+		if *maxP99 > 0 && s.p99 > *maxP99 {
+			fmt.Fprintf(os.Stderr, "%s: p99 %v exceeds -max-p99 %v\n", w.name(), s.p99, *maxP99)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// workload issues a single request per call to do.
+type workload interface {
+	name() string
+	do(ctx context.Context, rnd *rand.Rand) error
+}
+
+type searchWorkload struct {
+	client  pb.ProductCatalogServiceClient
+	queries []string
+	limit   int32
+}
+
+func (w *searchWorkload) name() string { return "SemanticSearchProducts" }
+
+func (w *searchWorkload) do(ctx context.Context, rnd *rand.Rand) error {
+	_, err := w.client.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{
+		Query: w.queries[rnd.Intn(len(w.queries))],
+		Limit: w.limit,
+	})
+	return err
+}
+
+type checkoutWorkload struct {
+	catalog    pb.ProductCatalogServiceClient
+	cart       pb.CartServiceClient
+	checkout   pb.CheckoutServiceClient
+	productIDs []string
+}
+
+func (w *checkoutWorkload) name() string { return "PlaceOrder" }
+
+func (w *checkoutWorkload) init(ctx context.Context) error {
+	resp, err := w.catalog.ListProducts(ctx, &pb.ListProductsRequest{})
+	if err != nil {
+		return err
+	}
+	for _, p := range resp.GetProducts() {
+		w.productIDs = append(w.productIDs, p.GetId())
+	}
+	if len(w.productIDs) == 0 {
+		return fmt.Errorf("catalog has no products")
+	}
+	return nil
+}
+
+// do fills a fresh cart and places an order. The measured latency includes
+// the AddItem call, which is small next to PlaceOrder's downstream fan-out.
+func (w *checkoutWorkload) do(ctx context.Context, rnd *rand.Rand) error {
+	userID := fmt.Sprintf("loadgen-%d", rnd.Int63())
+	_, err := w.cart.AddItem(ctx, &pb.AddItemRequest{
+		UserId: userID,
+		Item: &pb.CartItem{
+			ProductId: w.productIDs[rnd.Intn(len(w.productIDs))],
+			Quantity:  int32(1 + rnd.Intn(3)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add item to cart: %v", err)
+	}
+	_, err = w.checkout.PlaceOrder(ctx, &pb.PlaceOrderRequest{
+		UserId:       userID,
+		UserCurrency: "USD",
+		Email:        userID + "@example.com",
+		Address: &pb.Address{
+			StreetAddress: "1600 Amphitheatre Parkway",
+			City:          "Mountain View",
+			State:         "CA",
+			Country:       "United States",
+			ZipCode:       94043,
+		},
+		CreditCard: &pb.CreditCardInfo{
+			CreditCardNumber:          "4432-8015-6152-0454",
+			CreditCardCvv:             672,
+			CreditCardExpirationYear:  int32(time.Now().Year() + 1),
+			CreditCardExpirationMonth: 1,
+		},
+	})
+	return err
+}
+
+type result struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+}
+
+func (r *result) record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors++
+		return
+	}
+	r.latencies = append(r.latencies, d)
+}
+
+type summary struct {
+	count, errors      int
+	rps                float64
+	p50, p90, p99, max time.Duration
+}
+
+func (r *result) summarize(elapsed time.Duration) summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := summary{count: len(r.latencies) + r.errors, errors: r.errors}
+	if elapsed > 0 {
+		s.rps = float64(s.count) / elapsed.Seconds()
+	}
+	if len(r.latencies) == 0 {
+		return s
+	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	s.p50 = percentile(r.latencies, 50)
+	s.p90 = percentile(r.latencies, 90)
+	s.p99 = percentile(r.latencies, 99)
+	s.max = r.latencies[len(r.latencies)-1]
+	return s
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := (len(sorted)*p+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// run starts concurrency workers per workload and collects results until the
+// duration elapses.
+func run(workloads []workload, concurrency int, duration, timeout time.Duration) map[string]*result {
+	results := make(map[string]*result, len(workloads))
+	deadline := time.Now().Add(duration)
+	var wg sync.WaitGroup
+	for _, w := range workloads {
+		r := &result{}
+		results[w.name()] = r
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(w workload, seed int64) {
+				defer wg.Done()
+				rnd := rand.New(rand.NewSource(seed))
+				for time.Now().Before(deadline) {
+					ctx, cancel := context.WithTimeout(context.Background(), timeout)
+					start := time.Now()
+					err := w.do(ctx, rnd)
+					r.record(time.Since(start), err)
+					cancel()
+				}
+			}(w, time.Now().UnixNano()+int64(i))
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+func readQueries(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var queries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if q := strings.TrimSpace(scanner.Text()); q != "" && !strings.HasPrefix(q, "#") {
+			queries = append(queries, q)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries in %s", path)
+	}
+	return queries, nil
+}
+
+func mustDial(addr string) *grpc.ClientConn {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to %s: %v\n", addr, err)
+		os.Exit(2)
+	}
+	return conn
+}
@@ -0,0 +1,271 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/dbtls"
+	"github.com/sirupsen/logrus"
+)
+
+// serviceConfig is everything the service reads from the environment. It is
+// loaded and validated as a whole at startup, so a misconfigured pod fails
+// with every problem listed instead of the first, and nothing is started
+// before the configuration is known to be good.
+type serviceConfig struct {
+	port          string
+	logLevel      logrus.Level
+	grpc          grpcSettings
+	tracing       bool
+	collectorAddr string
+	profiling     bool
+	adminAPI      bool
+	admin         adminAuth
+	metricsPort   string
+	startupWindow time.Duration
+	faults        *faultInjector
+
+	queryProcessing   queryPipeline
+	hybridWeights     searchWeights
+	maxSearchDistance float64
+	vectorIndex       vectorIndexSettings
+	searchFusion      keywordFusion
+	personalization   personalizationSettings
+	popularity        popularitySettings
+	inventory         inventorySettings
+	reranking         rerankSettings
+	diversity         diversitySettings
+	languages         languageSettings
+	searchEvents      *searchEventSink
+	productEvents     *productEventSink
+	searchTimeout     searchTimeouts
+	searchLimit       *searchLimits
+
+	secretCacheTTL time.Duration
+	productsTable  string
+	dbAuth         dbAuthSettings
+	dbTLS          dbtls.Settings
+	dbPool         dbPoolSettings
+
+	embeddingFailure             embeddingFailurePolicy
+	embeddingBreaker             *circuitBreaker
+	embeddingReconcileInterval   time.Duration
+	merchandisingRefreshInterval time.Duration
+	catalogRefreshInterval       time.Duration
+}
+
+// loadConfig reads the serviceConfig from the environment. The error joins
+// every setting that is invalid or missing.
+func loadConfig() (*serviceConfig, error) {
+	c := &serviceConfig{
+		port:          envOrDefault("PORT", port),
+		tracing:       os.Getenv("ENABLE_TRACING") == "1",
+		collectorAddr: os.Getenv("COLLECTOR_SERVICE_ADDR"),
+		profiling:     os.Getenv("DISABLE_PROFILER") == "",
+		adminAPI:      os.Getenv("CATALOG_ADMIN_API") == "1",
+		admin:         adminAuth{token: os.Getenv("CATALOG_ADMIN_TOKEN")},
+	}
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var err error
+	c.logLevel, err = logLevelFromEnv()
+	check(err)
+	c.grpc, err = grpcSettingsFromEnv()
+	check(err)
+	c.metricsPort, err = metricsPortFromEnv()
+	check(err)
+	c.startupWindow, err = startupWindowFromEnv()
+	check(err)
+	c.faults, err = newFaultInjectorFromEnv()
+	check(err)
+
+	c.queryProcessing, err = queryPipelineFromEnv()
+	check(err)
+	c.hybridWeights, err = searchWeightsFromEnv()
+	check(err)
+	c.maxSearchDistance, err = maxSearchDistanceFromEnv()
+	check(err)
+	c.vectorIndex, err = vectorIndexSettingsFromEnv()
+	check(err)
+	c.searchFusion, err = keywordFusionFromEnv()
+	check(err)
+	c.personalization, err = personalizationFromEnv()
+	check(err)
+	c.popularity, err = popularityFromEnv()
+	check(err)
+	c.inventory, err = inventoryFromEnv()
+	check(err)
+	c.reranking, err = rerankingFromEnv()
+	check(err)
+	c.diversity, err = diversityFromEnv()
+	check(err)
+	c.languages, err = languagesFromEnv()
+	check(err)
+	c.searchEvents, err = searchEventsFromEnv()
+	check(err)
+	c.productEvents, err = productEventsFromEnv()
+	check(err)
+	c.searchTimeout, err = searchTimeoutsFromEnv()
+	check(err)
+	c.searchLimit, err = searchLimitsFromEnv()
+	check(err)
+
+	c.secretCacheTTL, err = secretCacheTTLFromEnv()
+	check(err)
+	c.productsTable, err = productsTableFromEnv()
+	check(err)
+	c.dbAuth, err = dbAuthFromEnv()
+	check(err)
+	if err == nil {
+		c.dbTLS, err = dbTLSFromEnv(c.dbAuth)
+		check(err)
+	}
+	c.dbPool, err = dbPoolSettingsFromEnv()
+	check(err)
+
+	c.embeddingFailure, err = embeddingFailurePolicyFromEnv()
+	check(err)
+	c.embeddingBreaker, err = embeddingBreakerFromEnv()
+	check(err)
+	c.embeddingReconcileInterval, err = embeddingReconcileIntervalFromEnv()
+	check(err)
+	c.merchandisingRefreshInterval, err = merchandisingRefreshIntervalFromEnv()
+	check(err)
+	c.catalogRefreshInterval, err = catalogRefreshIntervalFromEnv()
+	check(err)
+
+	for _, err := range c.requirements() {
+		check(err)
+	}
+	return c, errors.Join(errs...)
+}
+
+// requirements checks the settings that only some configurations need.
+func (c *serviceConfig) requirements() []error {
+	var errs []error
+	require := func(name, why string) {
+		if os.Getenv(name) == "" {
+			errs = append(errs, fmt.Errorf("%s needs %s", why, name))
+		}
+	}
+
+	if c.tracing {
+		require("COLLECTOR_SERVICE_ADDR", "ENABLE_TRACING=1")
+	}
+	if c.adminAPI {
+		require("CATALOG_ADMIN_TOKEN", "CATALOG_ADMIN_API=1")
+	}
+	switch mode := embeddingMode(); mode {
+	case embeddingModeService, embeddingModeStub:
+	case embeddingModeVertex:
+		require("PROJECT_ID", "EMBEDDING_MODE=vertex")
+	default:
+		errs = append(errs, fmt.Errorf("unknown EMBEDDING_MODE %q, want service, vertex or stub", mode))
+	}
+	if catalogFromDB() {
+		// The catalog is loaded from CLOUDSQL_HOST.
+		require("ALLOYDB_DATABASE_NAME", "CLOUDSQL_HOST")
+		require("ALLOYDB_TABLE_NAME", "CLOUDSQL_HOST")
+		if c.dbAuth.mode == dbAuthPassword {
+			require("ALLOYDB_SECRET_NAME", "CLOUDSQL_HOST with CLOUDSQL_AUTH=password")
+			require("PROJECT_ID", "CLOUDSQL_HOST with CLOUDSQL_AUTH=password")
+		}
+	}
+	return errs
+}
+
+// projectIDFor returns PROJECT_ID, the Google Cloud project of Secret
+// Manager, Vertex AI and the Cloud Translation API, which feature needs.
+// There is no default project.
+func projectIDFor(feature string) (string, error) {
+	projectID := os.Getenv("PROJECT_ID")
+	if projectID == "" {
+		return "", fmt.Errorf("%s needs PROJECT_ID", feature)
+	}
+	return projectID, nil
+}
+
+// apply makes c the configuration in effect.
+func (c *serviceConfig) apply() {
+	log.SetLevel(c.logLevel)
+	port = c.port
+
+	grpcConfig = c.grpc
+	log.Infof("grpc connection settings (%s)", grpcConfig)
+
+	faults = c.faults
+	if faults.enabled() {
+		log.Infof("fault injection enabled (latency: %v %s, error rate: %v, error code: %s)",
+			faults.latency, faults.distribution, faults.errorRate, faults.errorCode)
+	}
+
+	queryProcessing = c.queryProcessing
+	log.Infof("search query processing: %s", queryProcessing)
+	hybridWeights = c.hybridWeights
+	log.Infof("semantic search weights (%s)", hybridWeights)
+	maxSearchDistance = c.maxSearchDistance
+	vectorIndex = c.vectorIndex
+	log.Infof("semantic search mode: %s", vectorIndex)
+	searchFusion = c.searchFusion
+	log.Infof("semantic search keyword fusion: %s", searchFusion)
+	personalization = c.personalization
+	log.Infof("semantic search personalization: %s", personalization)
+	popularity = c.popularity
+	log.Infof("semantic search popularity: %s", popularity)
+	inventory = c.inventory
+	log.Infof("semantic search inventory: %s", inventory)
+	reranking = c.reranking
+	log.Infof("semantic search reranking: %s", reranking)
+	diversity = c.diversity
+	log.Infof("semantic search diversity: %s", diversity)
+	languages = c.languages
+	log.Infof("search languages: %s", languages)
+	searchEvents = c.searchEvents
+	log.Infof("search events: %s", searchEvents)
+	productEvents = c.productEvents
+	log.Infof("product change events: %s", productEvents)
+	searchTimeout = c.searchTimeout
+	log.Infof("semantic search timeouts (%s)", searchTimeout)
+	searchLimit = c.searchLimit
+	log.Infof("semantic search limits (%s)", searchLimit)
+
+	databasePassword.ttl, catalogPassword.ttl = c.secretCacheTTL, c.secretCacheTTL
+	log.Infof("secrets cached for %s", c.secretCacheTTL)
+	productsTable = c.productsTable
+	log.Infof("products table: %s", productsTable)
+	dbAuth = c.dbAuth
+	log.Infof("database authentication (%s)", dbAuth)
+	dbTLS = c.dbTLS
+	log.Infof("database TLS settings (%s)", dbTLS)
+	dbPool = c.dbPool
+	log.Infof("database pool settings (%s)", dbPool)
+
+	embeddingFailure = c.embeddingFailure
+	log.Infof("embedding failure policy: %s", embeddingFailure)
+	embeddingBreaker = c.embeddingBreaker
+	log.Infof("embedding circuit breaker: %s", embeddingBreaker)
+	embeddingReconcileInterval = c.embeddingReconcileInterval
+	merchandisingRefreshInterval = c.merchandisingRefreshInterval
+	catalogRefreshInterval = c.catalogRefreshInterval
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.port != "3550" || c.metricsPort != "9090" || c.dbAuth.mode != dbAuthPassword || c.dbTLS.Mode != "disable" {
+		t.Errorf("defaults: port=%s metrics=%s auth=%s tls=%s", c.port, c.metricsPort, c.dbAuth, c.dbTLS)
+	}
+}
+
+func TestLoadConfigReportsEveryError(t *testing.T) {
+	t.Setenv("SEMANTIC_QUERY_TIMEOUT", "soon")
+	t.Setenv("DB_POOL", "bouncer")
+	t.Setenv("EMBEDDING_MODE", "magic")
+	_, err := loadConfig()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"SEMANTIC_QUERY_TIMEOUT", "DB_POOL", "EMBEDDING_MODE"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigRequirements(t *testing.T) {
+	t.Setenv("CLOUDSQL_HOST", "10.0.0.3")
+	t.Setenv("ENABLE_TRACING", "1")
+	t.Setenv("SEARCH_RERANK", "vertex")
+	_, err := loadConfig()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"COLLECTOR_SERVICE_ADDR", "ALLOYDB_DATABASE_NAME", "ALLOYDB_TABLE_NAME", "ALLOYDB_SECRET_NAME", "SEARCH_RERANK=vertex needs PROJECT_ID"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+
+	t.Setenv("COLLECTOR_SERVICE_ADDR", "collector:4317")
+	t.Setenv("ALLOYDB_DATABASE_NAME", "products")
+	t.Setenv("ALLOYDB_TABLE_NAME", "catalog_items")
+	t.Setenv("ALLOYDB_SECRET_NAME", "catalog-password")
+	t.Setenv("PROJECT_ID", "shop")
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.tracing || c.collectorAddr != "collector:4317" || !c.reranking.enabled() {
+		t.Errorf("got tracing=%v collector=%q reranking=%s", c.tracing, c.collectorAddr, c.reranking)
+	}
+
+	// IAM logins need no secret, but do need the server CA.
+	t.Setenv("ALLOYDB_SECRET_NAME", "")
+	t.Setenv("CLOUDSQL_AUTH", "iam")
+	t.Setenv("CLOUDSQL_IAM_USER", "productcatalogservice@shop.iam")
+	ca := filepath.Join(t.TempDir(), "server-ca.pem")
+	if err := os.WriteFile(ca, []byte("ca"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLOUDSQL_SSL_ROOT_CERT", ca)
+	if _, err := loadConfig(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProductsTableFromEnv(t *testing.T) {
+	for env, want := range map[string]string{"": `"products"`, "catalog_items": `"catalog_items"`, "shop.items": `"shop"."items"`} {
+		t.Setenv("ALLOYDB_TABLE_NAME", env)
+		if got, err := productsTableFromEnv(); err != nil || got != want {
+			t.Errorf("ALLOYDB_TABLE_NAME=%q: got %q, %v; want %q", env, got, err, want)
+		}
+	}
+	t.Setenv("ALLOYDB_TABLE_NAME", "products; DROP TABLE products")
+	if _, err := productsTableFromEnv(); err == nil {
+		t.Error("expected an error for a name that is not a table name")
+	}
+}
+
+func TestLoadConfigAdminToken(t *testing.T) {
+	t.Setenv("CATALOG_ADMIN_API", "1")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "CATALOG_ADMIN_TOKEN") {
+		t.Errorf("expected an error mentioning CATALOG_ADMIN_TOKEN, got %v", err)
+	}
+	t.Setenv("CATALOG_ADMIN_TOKEN", "s3cret")
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.admin.token != "s3cret" {
+		t.Errorf("got admin token %q", c.admin.token)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/dbtls"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	dbAuthPassword = "password"
+	dbAuthIAM      = "iam"
+
+	// sqlLoginScope is the OAuth scope of tokens Cloud SQL accepts as
+	// passwords of IAM database users.
+	sqlLoginScope = "https://www.googleapis.com/auth/sqlservice.login"
+)
+
+// dbAuthSettings select how the service logs in to its Cloud SQL databases:
+// as postgres with the password kept in Secret Manager, or as the IAM
+// database user of its service account with an OAuth token, as the Cloud SQL
+// connectors' automatic IAM authentication does, so there is no password to
+// store or rotate.
+type dbAuthSettings struct {
+	mode string
+	// user is the database user; for IAM, the service account's email
+	// without its .gserviceaccount.com suffix.
+	user string
+	// tokens supplies IAM tokens; it is nil in password mode.
+	tokens *iamTokens
+}
+
+func (s dbAuthSettings) String() string {
+	return fmt.Sprintf("mode=%s, user=%s", s.mode, s.user)
+}
+
+// dbAuth holds the settings in effect, set from the environment at startup.
+var dbAuth = dbAuthSettings{mode: dbAuthPassword, user: "postgres"}
+
+// dbAuthFromEnv builds dbAuthSettings from the environment:
+//
+//	CLOUDSQL_AUTH      password (Secret Manager, the default) or iam
+//	CLOUDSQL_IAM_USER  database user in iam mode, such as
+//	                   productcatalogservice@my-project.iam
+func dbAuthFromEnv() (dbAuthSettings, error) {
+	switch mode := envOrDefault("CLOUDSQL_AUTH", dbAuthPassword); mode {
+	case dbAuthPassword:
+		return dbAuthSettings{mode: dbAuthPassword, user: "postgres"}, nil
+	case dbAuthIAM:
+		user := os.Getenv("CLOUDSQL_IAM_USER")
+		if user == "" {
+			return dbAuthSettings{}, fmt.Errorf("CLOUDSQL_AUTH=iam needs CLOUDSQL_IAM_USER")
+		}
+		return dbAuthSettings{mode: dbAuthIAM, user: user, tokens: &iamTokens{}}, nil
+	default:
+		return dbAuthSettings{}, fmt.Errorf("unknown CLOUDSQL_AUTH %q, want password or iam", mode)
+	}
+}
+
+// connString returns the connection string of the products database on
+// host, without a password.
+func (s dbAuthSettings) connString(host string, tls dbtls.Settings) string {
+	return fmt.Sprintf("host=%s port=5432 user=%s dbname=products %s", host, s.user, tls.Params())
+}
+
+// credentials returns what supplies the password of semantic search
+// connections: the cached databasePassword, or a fresh IAM token for each
+// one.
+func (s dbAuthSettings) credentials() dbCredentials {
+	if s.mode == dbAuthIAM {
+		return dbCredentials{fetch: s.tokens.token, perConnection: true}
+	}
+	return cachedCredentials(databasePassword)
+}
+
+// iamTokens caches the OAuth tokens of the service's credentials, refreshing
+// them ahead of expiry, so asking for one per connection is cheap.
+type iamTokens struct {
+	mu     sync.Mutex
+	source oauth2.TokenSource
+}
+
+// token returns a valid access token. The token source is created on first
+// use; a failed creation is retried on the next call.
+func (t *iamTokens) token() (string, error) {
+	t.mu.Lock()
+	if t.source == nil {
+		source, err := google.DefaultTokenSource(context.Background(), sqlLoginScope)
+		if err != nil {
+			t.mu.Unlock()
+			return "", fmt.Errorf("failed to find credentials for IAM database authentication: %v", err)
+		}
+		t.source = oauth2.ReuseTokenSourceWithExpiry(nil, source, 5*time.Minute)
+	}
+	source := t.source
+	t.mu.Unlock()
+
+	tok, err := source.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get a token for IAM database authentication: %v", err)
+	}
+	return tok.AccessToken, nil
+}
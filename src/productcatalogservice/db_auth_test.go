@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/dbtls"
+)
+
+func TestDBAuthFromEnv(t *testing.T) {
+	got, err := dbAuthFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.mode != dbAuthPassword || got.user != "postgres" || got.credentials().secret != databasePassword {
+		t.Errorf("default: got %s", got)
+	}
+	if want := "host=10.0.0.3 port=5432 user=postgres dbname=products sslmode=disable"; got.connString("10.0.0.3", dbtls.Settings{Mode: "disable"}) != want {
+		t.Errorf("got %q, want %q", got.connString("10.0.0.3", dbtls.Settings{Mode: "disable"}), want)
+	}
+
+	t.Setenv("CLOUDSQL_AUTH", "iam")
+	if _, err := dbAuthFromEnv(); err == nil {
+		t.Error("expected an error without CLOUDSQL_IAM_USER")
+	}
+	t.Setenv("CLOUDSQL_IAM_USER", "productcatalogservice@shop.iam")
+	got, err = dbAuthFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "host=10.0.0.3 port=5432 user=productcatalogservice@shop.iam dbname=products sslmode=require"; got.connString("10.0.0.3", dbtls.Settings{Mode: "require"}) != want {
+		t.Errorf("got %q, want %q", got.connString("10.0.0.3", dbtls.Settings{Mode: "require"}), want)
+	}
+	if !got.credentials().perConnection {
+		t.Error("IAM tokens are not fetched per connection")
+	}
+
+	t.Setenv("CLOUDSQL_AUTH", "kerberos")
+	if _, err := dbAuthFromEnv(); err == nil {
+		t.Error("expected an error for CLOUDSQL_AUTH=kerberos")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	pgxvec "github.com/pgvector/pgvector-go/pgx"
+	"golang.org/x/sync/singleflight"
+)
+
+// dbCredentials supply the password of semantic search database
+// connections.
+type dbCredentials struct {
+	// fetch returns the current password.
+	fetch func() (string, error)
+	// perConnection has fetch called before every connection rather than
+	// only when Postgres rejects the password. It suits short-lived
+	// passwords, such as IAM tokens, whose source caches them.
+	perConnection bool
+	// secret, when set, is the cache fetch reads; a rejected password is
+	// refetched past it.
+	secret *secretCache
+}
+
+// secretCredentials fetches the password with fetch only when needed, as
+// for a password kept in Secret Manager.
+func secretCredentials(fetch func() (string, error)) dbCredentials {
+	return dbCredentials{fetch: fetch}
+}
+
+// cachedCredentials read the password from secret for every connection, so
+// connections pick up a rotation as soon as the cache sees it.
+func cachedCredentials(secret *secretCache) dbCredentials {
+	return dbCredentials{fetch: secret.get, perConnection: true, secret: secret}
+}
+
+// refetch returns the latest password after Postgres rejected the current
+// one.
+func (c dbCredentials) refetch() (string, error) {
+	if c.secret != nil {
+		return c.secret.refresh()
+	}
+	return c.fetch()
+}
+
+// rotatingConnector is a driver.Connector for the semantic search database
+// whose password comes from Secret Manager or an IAM token. When Postgres
+// rejects the password, e.g. after the secret was rotated, it fetches the
+// latest one and retries once, so new pool connections recover without a
+// restart.
+type rotatingConnector struct {
+	config *pgx.ConnConfig
+	creds  dbCredentials
+
+	// refetches collapses concurrent refetches after a rejected password.
+	refetches singleflight.Group
+
+	mu       sync.Mutex
+	password string
+}
+
+// openRotatingVectorDB is openVectorDB with the password supplied by creds
+// instead of connStr and statements cached as s says. The initial password is
+// fetched eagerly.
+func openRotatingVectorDB(connStr string, creds dbCredentials, s dbPoolSettings) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	s.configure(config)
+	password, err := creds.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database password: %v", err)
+	}
+	return sql.OpenDB(&rotatingConnector{config: config, creds: creds, password: password}), nil
+}
+
+// Connect implements driver.Connector.
+func (r *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	password := r.currentPassword()
+	conn, err := r.connect(ctx, password)
+	if !isAuthFailure(err) {
+		return conn, err
+	}
+
+	log.Warnf("semantic search database rejected credentials, refetching password: %v", err)
+	fresh, ferr := r.refreshPassword(password)
+	if ferr != nil {
+		return nil, fmt.Errorf("%v (refetching password: %v)", err, ferr)
+	}
+	return r.connect(ctx, fresh)
+}
+
+// Driver implements driver.Connector.
+func (r *rotatingConnector) Driver() driver.Driver {
+	return stdlib.GetDefaultDriver()
+}
+
+func (r *rotatingConnector) connect(ctx context.Context, password string) (driver.Conn, error) {
+	config := r.config.Copy()
+	config.Password = password
+	return stdlib.GetConnector(*config, stdlib.OptionAfterConnect(pgxvec.RegisterTypes)).Connect(ctx)
+}
+
+// currentPassword returns the password for a new connection: the last one
+// fetched, or with perConnection credentials a fresh one, falling back to
+// the last one if fetching fails. The fetch is made without holding the
+// lock, so a slow one does not hold up other connections.
+func (r *rotatingConnector) currentPassword() string {
+	if !r.creds.perConnection {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.password
+	}
+	password, err := r.creds.fetch()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		log.Warnf("failed to get database password, reusing the last one: %v", err)
+		return r.password
+	}
+	r.password = password
+	return password
+}
+
+// refreshPassword replaces stale with the latest secret version. Concurrent
+// callers that failed with the same stale password share a single fetch.
+func (r *rotatingConnector) refreshPassword(stale string) (string, error) {
+	r.mu.Lock()
+	current := r.password
+	r.mu.Unlock()
+	if current != stale {
+		return current, nil
+	}
+	v, err, _ := r.refetches.Do(stale, func() (interface{}, error) {
+		password, err := r.creds.refetch()
+		if err != nil {
+			return "", err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.password = password
+		return password, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// isAuthFailure reports whether err is Postgres rejecting the credentials.
+func isAuthFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	// 28P01 invalid_password, 28000 invalid_authorization_specification.
+	return pgErr.Code == "28P01" || pgErr.Code == "28000"
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRotatingConnectorRefreshPassword(t *testing.T) {
+	fetches := 0
+	fetch := func() (string, error) {
+		fetches++
+		return "new", nil
+	}
+
+	c := &rotatingConnector{creds: secretCredentials(fetch), password: "old"}
+	// Two callers failing with the same stale password share one fetch.
+	for i := 0; i < 2; i++ {
+		got, err := c.refreshPassword("old")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "new" {
+			t.Errorf("refreshPassword = %q, want new", got)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetches = %d, want 1", fetches)
+	}
+}
+
+func TestRotatingConnectorPerConnectionPassword(t *testing.T) {
+	tokens := []string{"token-1", "token-2"}
+	var failed bool
+	c := &rotatingConnector{creds: dbCredentials{perConnection: true, fetch: func() (string, error) {
+		if failed {
+			return "", errors.New("metadata server unavailable")
+		}
+		token := tokens[0]
+		tokens = tokens[1:]
+		return token, nil
+	}}}
+	for _, want := range []string{"token-1", "token-2"} {
+		if got := c.currentPassword(); got != want {
+			t.Errorf("currentPassword = %q, want %q", got, want)
+		}
+	}
+	failed = true
+	if got := c.currentPassword(); got != "token-2" {
+		t.Errorf("after a failed fetch: currentPassword = %q, want the last token", got)
+	}
+}
+
+func TestOpenRotatingVectorDBFetchError(t *testing.T) {
+	_, err := openRotatingVectorDB("host=localhost", secretCredentials(func() (string, error) {
+		return "", errors.New("permission denied")
+	}), dbPool)
+	if err == nil {
+		t.Fatal("expected error when the password cannot be fetched")
+	}
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("dial tcp: connection refused"), false},
+		{&pgconn.PgError{Code: "28P01"}, true},
+		{fmt.Errorf("connect: %w", &pgconn.PgError{Code: "28000"}), true},
+		{&pgconn.PgError{Code: "57P03"}, false},
+	}
+	for _, tt := range tests {
+		if got := isAuthFailure(tt.err); got != tt.want {
+			t.Errorf("isAuthFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
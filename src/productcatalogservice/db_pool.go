@@ -0,0 +1,232 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	pgxvec "github.com/pgvector/pgvector-go/pgx"
+)
+
+const (
+	// dbPoolSQL pools connections in database/sql.
+	dbPoolSQL = "sql"
+	// dbPoolPgx pools connections in pgxpool, behind the same *sql.DB.
+	dbPoolPgx = "pgxpool"
+)
+
+// dbPoolSettings size the connection pool of each semantic search database
+// handle: the primary and every read endpoint get a pool of their own.
+type dbPoolSettings struct {
+	driver          string
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	// statementCache is the number of prepared statements each connection
+	// keeps, so the search queries are parsed and planned once per
+	// connection rather than on every call. 0 prepares none.
+	statementCache int
+
+	// maxOpenConnsSet, connMaxLifetimeSet and statementCacheSet record the
+	// settings given in the environment. pgx reads the same settings from
+	// the DSN, which the defaults do not override.
+	maxOpenConnsSet    bool
+	connMaxLifetimeSet bool
+	statementCacheSet  bool
+}
+
+func (s dbPoolSettings) String() string {
+	return fmt.Sprintf("%s, max open %d, max idle %d, max lifetime %v, statement cache %d",
+		s.driver, s.maxOpenConns, s.maxIdleConns, s.connMaxLifetime, s.statementCache)
+}
+
+// dbPool holds the settings in effect, set from the environment at startup.
+var dbPool = dbPoolSettings{driver: dbPoolSQL, maxOpenConns: 20, maxIdleConns: 10, connMaxLifetime: 30 * time.Minute, statementCache: 512}
+
+// dbPoolSettingsFromEnv builds dbPoolSettings from the environment:
+//
+//	DB_POOL                sql (default) or pgxpool
+//	DB_MAX_OPEN_CONNS      connections per database handle (default 20)
+//	DB_MAX_IDLE_CONNS      idle connections kept per handle (default 10, sql only)
+//	DB_CONN_MAX_LIFETIME   age after which a connection is replaced (default 30m)
+//	DB_STATEMENT_CACHE     prepared statements kept per connection (default 512)
+func dbPoolSettingsFromEnv() (dbPoolSettings, error) {
+	s := dbPool
+	if v := os.Getenv("DB_POOL"); v != "" {
+		switch v {
+		case dbPoolSQL, dbPoolPgx:
+			s.driver = v
+		default:
+			return dbPoolSettings{}, fmt.Errorf("unknown DB_POOL %q (want sql or pgxpool)", v)
+		}
+	}
+	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return dbPoolSettings{}, fmt.Errorf("failed to parse DB_MAX_OPEN_CONNS (%s) as a positive integer", v)
+		}
+		s.maxOpenConns, s.maxOpenConnsSet = n, true
+	}
+	if v := os.Getenv("DB_MAX_IDLE_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return dbPoolSettings{}, fmt.Errorf("failed to parse DB_MAX_IDLE_CONNS (%s) as a non-negative integer", v)
+		}
+		s.maxIdleConns = n
+	}
+	if v := os.Getenv("DB_CONN_MAX_LIFETIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return dbPoolSettings{}, fmt.Errorf("failed to parse DB_CONN_MAX_LIFETIME (%s) as a positive time.Duration", v)
+		}
+		s.connMaxLifetime, s.connMaxLifetimeSet = d, true
+	}
+	if v := os.Getenv("DB_STATEMENT_CACHE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return dbPoolSettings{}, fmt.Errorf("failed to parse DB_STATEMENT_CACHE (%s) as a non-negative integer", v)
+		}
+		s.statementCache, s.statementCacheSet = n, true
+	}
+	if s.maxIdleConns > s.maxOpenConns {
+		// database/sql would lower it silently; say so instead.
+		return dbPoolSettings{}, fmt.Errorf("DB_MAX_IDLE_CONNS (%d) is above DB_MAX_OPEN_CONNS (%d)", s.maxIdleConns, s.maxOpenConns)
+	}
+	return s, nil
+}
+
+// open opens a semantic search database handle for connStr with the password
+// supplied by fetch, pooled as s says.
+func (s dbPoolSettings) open(connStr string, creds dbCredentials) (*sql.DB, error) {
+	if s.driver == dbPoolPgx {
+		return openRotatingVectorPool(connStr, creds, s)
+	}
+	conn, err := openRotatingVectorDB(connStr, creds, s)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(s.maxOpenConns)
+	conn.SetMaxIdleConns(s.maxIdleConns)
+	conn.SetConnMaxLifetime(s.connMaxLifetime)
+	if creds.secret != nil {
+		// Reopen idle connections with the new password rather than wait for
+		// them to age out, in case the old one is revoked.
+		creds.secret.subscribe(func(string) {
+			conn.SetMaxIdleConns(0)
+			conn.SetMaxIdleConns(s.maxIdleConns)
+		})
+	}
+	return conn, nil
+}
+
+// configure sets how the connections of config execute queries. Each
+// connection prepares a statement the first time it runs a query and reuses
+// it for every later call with the same SQL; search queries differ only in
+// their parameters, so the few shapes built from the request's filters all
+// stay cached. Without a statement cache, as behind PgBouncer in transaction
+// mode, only the parameter and result types are cached. Unless
+// DB_STATEMENT_CACHE is set, config keeps what the DSN says, or pgx's
+// defaults, which are dbPool's.
+func (s dbPoolSettings) configure(config *pgx.ConnConfig) {
+	if !s.statementCacheSet {
+		return
+	}
+	config.StatementCacheCapacity = s.statementCache
+	config.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	if s.statementCache == 0 {
+		config.DefaultQueryExecMode = pgx.QueryExecModeCacheDescribe
+	}
+}
+
+// configurePool applies s to config. Like configure, it leaves the
+// pool_max_conns and pool_max_conn_lifetime of the DSN alone unless the
+// environment sets them.
+func (s dbPoolSettings) configurePool(config *pgxpool.Config) {
+	s.configure(config.ConnConfig)
+	if s.maxOpenConnsSet {
+		config.MaxConns = int32(s.maxOpenConns)
+	}
+	if s.connMaxLifetimeSet {
+		config.MaxConnLifetime = s.connMaxLifetime
+	}
+}
+
+// openRotatingVectorPool is openRotatingVectorDB backed by a pgxpool.Pool.
+// pgxpool cannot retry a connection, so a rejected password is refetched for
+// the next one instead: the connection that hit the rotation fails.
+func openRotatingVectorPool(connStr string, creds dbCredentials, s dbPoolSettings) (*sql.DB, error) {
+	config, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	password, err := creds.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database password: %v", err)
+	}
+	s.configurePool(config)
+	r := &rotatingConnector{config: config.ConnConfig, creds: creds, password: password}
+
+	config.BeforeConnect = func(_ context.Context, cc *pgx.ConnConfig) error {
+		password := r.currentPassword()
+		cc.Password = password
+		onPgError := cc.OnPgError
+		cc.OnPgError = func(conn *pgconn.PgConn, pgErr *pgconn.PgError) bool {
+			if isAuthFailure(pgErr) {
+				log.Warnf("semantic search database rejected credentials, refetching password: %v", pgErr)
+				if _, err := r.refreshPassword(password); err != nil {
+					log.Warnf("failed to refetch database password: %v", err)
+				}
+			}
+			return onPgError(conn, pgErr)
+		}
+		return nil
+	}
+	config.AfterConnect = pgxvec.RegisterTypes
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	if creds.secret != nil {
+		// Connections in use are replaced once released.
+		creds.secret.subscribe(func(string) { pool.Reset() })
+	}
+	// Like stdlib.OpenDBFromPool, but closing the handle also closes the pool.
+	conn := sql.OpenDB(poolConnector{Connector: stdlib.GetPoolConnector(pool), pool: pool})
+	conn.SetMaxIdleConns(0) // idle connections are pgxpool's to keep
+	return conn, nil
+}
+
+// poolConnector closes its pool when the *sql.DB using it is closed.
+type poolConnector struct {
+	driver.Connector
+	pool *pgxpool.Pool
+}
+
+// Close implements io.Closer, which sql.DB.Close calls on its connector.
+func (c poolConnector) Close() error {
+	c.pool.Close()
+	return nil
+}
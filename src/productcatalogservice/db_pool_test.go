@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestDBPoolSettingsFromEnv(t *testing.T) {
+	t.Setenv("DB_POOL", "pgxpool")
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("DB_MAX_IDLE_CONNS", "5")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "10m")
+	t.Setenv("DB_STATEMENT_CACHE", "0")
+	got, err := dbPoolSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dbPoolSettings{driver: dbPoolPgx, maxOpenConns: 50, maxIdleConns: 5, connMaxLifetime: 10 * time.Minute, statementCache: 0,
+		maxOpenConnsSet: true, connMaxLifetimeSet: true, statementCacheSet: true}
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, tc := range []struct{ env, value string }{
+		{"DB_POOL", "bouncer"},
+		{"DB_MAX_OPEN_CONNS", "0"},
+		{"DB_MAX_IDLE_CONNS", "-1"},
+		{"DB_MAX_IDLE_CONNS", "80"}, // above DB_MAX_OPEN_CONNS
+		{"DB_CONN_MAX_LIFETIME", "forever"},
+		{"DB_STATEMENT_CACHE", "-1"},
+	} {
+		t.Run(tc.env+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			if _, err := dbPoolSettingsFromEnv(); err == nil {
+				t.Errorf("%s=%q: expected an error", tc.env, tc.value)
+			}
+		})
+	}
+}
+
+func TestDBPoolSettingsOpen(t *testing.T) {
+	fetch := func() (string, error) { return "secret", nil }
+	for _, driver := range []string{dbPoolSQL, dbPoolPgx} {
+		t.Run(driver, func(t *testing.T) {
+			s := dbPoolSettings{driver: driver, maxOpenConns: 7, maxIdleConns: 3, connMaxLifetime: time.Minute}
+			// Neither pool connects until the handle is used.
+			conn, err := s.open("host=localhost port=5432 user=postgres dbname=products", secretCredentials(fetch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if driver == dbPoolSQL {
+				if got := conn.Stats().MaxOpenConnections; got != 7 {
+					t.Errorf("MaxOpenConnections = %d, want 7", got)
+				}
+			}
+		})
+	}
+}
+
+func TestDBPoolSettingsConfigure(t *testing.T) {
+	for _, tc := range []struct {
+		cache int
+		mode  pgx.QueryExecMode
+	}{
+		{512, pgx.QueryExecModeCacheStatement},
+		{0, pgx.QueryExecModeCacheDescribe},
+	} {
+		config, err := pgx.ParseConfig("host=localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbPoolSettings{statementCache: tc.cache, statementCacheSet: true}.configure(config)
+		if config.StatementCacheCapacity != tc.cache || config.DefaultQueryExecMode != tc.mode {
+			t.Errorf("statement cache %d: got capacity %d, mode %v, want mode %v",
+				tc.cache, config.StatementCacheCapacity, config.DefaultQueryExecMode, tc.mode)
+		}
+	}
+}
+
+func TestDBPoolSettingsKeepDSNSettings(t *testing.T) {
+	dsn := "host=localhost statement_cache_capacity=64 default_query_exec_mode=exec pool_max_conns=3 pool_max_conn_lifetime=5m"
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only defaults: the DSN's settings stand.
+	dbPool.configurePool(config)
+	if config.ConnConfig.StatementCacheCapacity != 64 || config.ConnConfig.DefaultQueryExecMode != pgx.QueryExecModeExec ||
+		config.MaxConns != 3 || config.MaxConnLifetime != 5*time.Minute {
+		t.Errorf("defaults overrode the DSN: capacity %d, mode %v, max conns %d, max lifetime %v",
+			config.ConnConfig.StatementCacheCapacity, config.ConnConfig.DefaultQueryExecMode, config.MaxConns, config.MaxConnLifetime)
+	}
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "10m")
+	t.Setenv("DB_STATEMENT_CACHE", "128")
+	s, err := dbPoolSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.configurePool(config)
+	if config.ConnConfig.StatementCacheCapacity != 128 || config.ConnConfig.DefaultQueryExecMode != pgx.QueryExecModeCacheStatement ||
+		config.MaxConns != 50 || config.MaxConnLifetime != 10*time.Minute {
+		t.Errorf("the environment did not override the DSN: capacity %d, mode %v, max conns %d, max lifetime %v",
+			config.ConnConfig.StatementCacheCapacity, config.ConnConfig.DefaultQueryExecMode, config.MaxConns, config.MaxConnLifetime)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/dbtls"
+)
+
+// dbTLSModes are the sslmodes pgx supports.
+var dbTLSModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// dbTLS holds the TLS settings of database connections in effect, set from
+// the environment at startup.
+var dbTLS = dbtls.Settings{Mode: "disable"}
+
+// dbTLSFromEnv builds the TLS settings from the environment, as
+// dbtls.FromEnv does. CLOUDSQL_SSL_MODE is verify-full by default with IAM
+// authentication, which only verify-ca and verify-full are accepted with,
+// and disable otherwise.
+func dbTLSFromEnv(auth dbAuthSettings) (dbtls.Settings, error) {
+	mode := "disable"
+	if auth.mode == dbAuthIAM {
+		mode = "verify-full"
+	}
+	s, err := dbtls.FromEnv(mode, dbTLSModes...)
+	if err != nil {
+		return dbtls.Settings{}, err
+	}
+	// An IAM token is a bearer credential, so it is only sent to a server
+	// whose certificate the instance CA vouches for.
+	if auth.mode == dbAuthIAM && !s.Verified() {
+		return dbtls.Settings{}, fmt.Errorf("CLOUDSQL_AUTH=iam needs CLOUDSQL_SSL_MODE=verify-full or verify-ca, not %s", s.Mode)
+	}
+	return s, nil
+}
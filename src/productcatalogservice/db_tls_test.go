@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDBTLSFromEnv(t *testing.T) {
+	password := dbAuthSettings{mode: dbAuthPassword, user: "postgres"}
+	iam := dbAuthSettings{mode: dbAuthIAM, user: "productcatalogservice@shop.iam"}
+
+	got, err := dbTLSFromEnv(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Params() != "sslmode=disable" {
+		t.Errorf("password default: got %q", got.Params())
+	}
+	if _, err := dbTLSFromEnv(iam); err == nil {
+		t.Error("expected an error for IAM authentication without the server CA")
+	}
+	for _, mode := range []string{"disable", "require"} {
+		t.Setenv("CLOUDSQL_SSL_MODE", mode)
+		if _, err := dbTLSFromEnv(iam); err == nil {
+			t.Errorf("expected an error for IAM authentication with CLOUDSQL_SSL_MODE=%s", mode)
+		}
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "verify-ca")
+	if _, err := dbTLSFromEnv(password); err == nil {
+		t.Error("expected an error for verify-ca without CLOUDSQL_SSL_ROOT_CERT")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"server-ca.pem", "client-cert.pem", "client-key.pem"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("pem"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CLOUDSQL_SSL_ROOT_CERT", filepath.Join(dir, "server-ca.pem"))
+	t.Setenv("CLOUDSQL_SSL_CERT", filepath.Join(dir, "client-cert.pem"))
+	if _, err := dbTLSFromEnv(password); err == nil {
+		t.Error("expected an error for a client certificate without a key")
+	}
+	t.Setenv("CLOUDSQL_SSL_KEY", filepath.Join(dir, "client-key.pem"))
+	got, err = dbTLSFromEnv(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "sslmode=verify-ca sslrootcert=" + filepath.Join(dir, "server-ca.pem") +
+		" sslcert=" + filepath.Join(dir, "client-cert.pem") +
+		" sslkey=" + filepath.Join(dir, "client-key.pem")
+	if got.Params() != want {
+		t.Errorf("got %q, want %q", got.Params(), want)
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "")
+	t.Setenv("CLOUDSQL_SSL_CERT", "")
+	t.Setenv("CLOUDSQL_SSL_KEY", "")
+	got, err = dbTLSFromEnv(iam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sslmode=verify-full sslrootcert=" + filepath.Join(dir, "server-ca.pem"); got.Params() != want {
+		t.Errorf("iam default: got %q, want %q", got.Params(), want)
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "verify-ca")
+	t.Setenv("CLOUDSQL_SSL_CERT", filepath.Join(dir, "client-cert.pem"))
+	t.Setenv("CLOUDSQL_SSL_KEY", filepath.Join(dir, "missing.pem"))
+	if _, err := dbTLSFromEnv(password); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+
+	t.Setenv("CLOUDSQL_SSL_MODE", "strict")
+	if _, err := dbTLSFromEnv(password); err == nil {
+		t.Error("expected an error for CLOUDSQL_SSL_MODE=strict")
+	}
+}
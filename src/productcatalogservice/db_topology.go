@@ -0,0 +1,240 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultReadProbeInterval = 10 * time.Second
+	readProbeTimeout         = 2 * time.Second
+
+	// unreachable is the latency recorded for endpoints whose last probe
+	// failed, so they are only picked when nothing else is up.
+	unreachable = int64(math.MaxInt64)
+)
+
+// searchReads routes semantic search queries across the primary and the
+// regional read endpoints. It is nil when no read endpoints are configured,
+// in which case every query goes to db.
+var searchReads *readRouter
+
+// dbTopology describes where the products database lives across regions.
+// Writes (embedding backfill) always go to the primary; search reads go to
+// whichever of the primary and the read endpoints answers fastest.
+type dbTopology struct {
+	primaryRegion string
+	primaryHost   string
+	// readHosts maps a region to the host of its read endpoint.
+	readHosts     map[string]string
+	probeInterval time.Duration
+}
+
+// loadDBTopology reads the topology from the environment:
+//
+//   - CLOUDSQL_HOST is the primary, in CLOUDSQL_PRIMARY_REGION.
+//   - CLOUDSQL_READ_HOSTS lists read endpoints as "region=host,...".
+//   - CLOUDSQL_FAILOVER_REGION, when set, promotes the read endpoint of that
+//     region to primary, e.g. after the old primary region went down.
+//   - CLOUDSQL_READ_PROBE_INTERVAL sets how often latency is probed (10s).
+func loadDBTopology() (*dbTopology, error) {
+	t := &dbTopology{
+		primaryRegion: os.Getenv("CLOUDSQL_PRIMARY_REGION"),
+		primaryHost:   os.Getenv("CLOUDSQL_HOST"),
+		probeInterval: defaultReadProbeInterval,
+	}
+
+	hosts, err := parseReadHosts(os.Getenv("CLOUDSQL_READ_HOSTS"))
+	if err != nil {
+		return nil, err
+	}
+	t.readHosts = hosts
+
+	if region := os.Getenv("CLOUDSQL_FAILOVER_REGION"); region != "" && region != t.primaryRegion {
+		host, ok := t.readHosts[region]
+		if !ok {
+			return nil, fmt.Errorf("CLOUDSQL_FAILOVER_REGION %q has no entry in CLOUDSQL_READ_HOSTS", region)
+		}
+		delete(t.readHosts, region)
+		t.primaryRegion, t.primaryHost = region, host
+	}
+
+	if s := os.Getenv("CLOUDSQL_READ_PROBE_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("failed to parse CLOUDSQL_READ_PROBE_INTERVAL (%s) as a positive time.Duration", s)
+		}
+		t.probeInterval = v
+	}
+	return t, nil
+}
+
+// parseReadHosts parses a "region=host,region=host" list.
+func parseReadHosts(s string) (map[string]string, error) {
+	hosts := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		region, host, ok := strings.Cut(entry, "=")
+		region, host = strings.TrimSpace(region), strings.TrimSpace(host)
+		if !ok || region == "" || host == "" {
+			return nil, fmt.Errorf("invalid CLOUDSQL_READ_HOSTS entry %q, want region=host", entry)
+		}
+		if _, dup := hosts[region]; dup {
+			return nil, fmt.Errorf("duplicate region %q in CLOUDSQL_READ_HOSTS", region)
+		}
+		hosts[region] = host
+	}
+	return hosts, nil
+}
+
+// readEndpoint is a database handle reads may be routed to, with its
+// smoothed probe latency in nanoseconds.
+type readEndpoint struct {
+	region  string
+	db      *sql.DB
+	latency atomic.Int64
+}
+
+// observe folds a probe result into the endpoint's latency estimate.
+func (e *readEndpoint) observe(d time.Duration, err error) {
+	if err != nil {
+		e.latency.Store(unreachable)
+		return
+	}
+	sample := int64(d)
+	prev := e.latency.Load()
+	if prev == unreachable {
+		e.latency.Store(sample)
+		return
+	}
+	// Exponentially weighted so a single slow probe does not flip routing.
+	e.latency.Store((prev*7 + sample*3) / 10)
+}
+
+// readRouter picks the lowest-latency reachable endpoint for reads.
+type readRouter struct {
+	endpoints []*readEndpoint
+}
+
+// newReadRouter returns a router over the given endpoints, the primary
+// first. Endpoints start out unprobed and are ranked after the first probe.
+func newReadRouter(endpoints ...*readEndpoint) *readRouter {
+	for _, e := range endpoints {
+		e.latency.Store(unreachable)
+	}
+	return &readRouter{endpoints: endpoints}
+}
+
+// pick returns the endpoint reads should use. The primary wins ties and is
+// used when no endpoint is reachable.
+func (r *readRouter) pick() *readEndpoint {
+	best := r.endpoints[0]
+	for _, e := range r.endpoints[1:] {
+		if e.latency.Load() < best.latency.Load() {
+			best = e
+		}
+	}
+	return best
+}
+
+// probe pings every endpoint concurrently and records the latencies.
+func (r *readRouter) probe(ctx context.Context) {
+	done := make(chan struct{}, len(r.endpoints))
+	for _, e := range r.endpoints {
+		go func(e *readEndpoint) {
+			defer func() { done <- struct{}{} }()
+			ctx, cancel := context.WithTimeout(ctx, readProbeTimeout)
+			defer cancel()
+			start := time.Now()
+			err := e.db.PingContext(ctx)
+			if err != nil && e.latency.Load() != unreachable {
+				log.Warnf("read endpoint in region %q is unreachable: %v", e.region, err)
+			}
+			e.observe(time.Since(start), err)
+		}(e)
+	}
+	for range r.endpoints {
+		<-done
+	}
+}
+
+// run probes the endpoints every interval until ctx is done.
+func (r *readRouter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.probe(ctx)
+		}
+	}
+}
+
+// regions lists the endpoint regions in routing order, for logging.
+func (r *readRouter) regions() []string {
+	eps := append([]*readEndpoint(nil), r.endpoints...)
+	sort.SliceStable(eps, func(i, j int) bool { return eps[i].latency.Load() < eps[j].latency.Load() })
+	regions := make([]string, len(eps))
+	for i, e := range eps {
+		regions[i] = e.region
+	}
+	return regions
+}
+
+// connectReadEndpoints opens the read endpoints of t next to the already
+// connected primary and starts routing search reads by latency. Unreachable
+// endpoints are skipped until a probe succeeds. Probes run until ctx is done.
+func connectReadEndpoints(ctx context.Context, t *dbTopology, primary *sql.DB, open func(host string) (*sql.DB, error)) error {
+	endpoints := []*readEndpoint{{region: t.primaryRegion, db: primary}}
+	for region, host := range t.readHosts {
+		conn, err := open(host)
+		if err != nil {
+			for _, e := range endpoints[1:] {
+				e.db.Close()
+			}
+			return err
+		}
+		endpoints = append(endpoints, &readEndpoint{region: region, db: conn})
+	}
+
+	r := newReadRouter(endpoints...)
+	r.probe(ctx)
+	log.Infof("Routing semantic search reads by latency across regions %v", r.regions())
+	go r.run(ctx, t.probeInterval)
+	searchReads = r
+	return nil
+}
+
+// readDB returns the database handle search reads should use.
+func readDB() *sql.DB {
+	if searchReads == nil {
+		return db
+	}
+	return searchReads.pick().db
+}
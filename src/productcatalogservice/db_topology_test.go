@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseReadHosts(t *testing.T) {
+	hosts, err := parseReadHosts(" us-east1=10.0.0.2, europe-west1=10.1.0.2 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts["us-east1"] != "10.0.0.2" || hosts["europe-west1"] != "10.1.0.2" {
+		t.Errorf("parseReadHosts = %v", hosts)
+	}
+
+	for _, bad := range []string{"10.0.0.2", "=10.0.0.2", "us-east1=", "a=1,a=2"} {
+		if _, err := parseReadHosts(bad); err == nil {
+			t.Errorf("parseReadHosts(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestLoadDBTopologyFailover(t *testing.T) {
+	t.Setenv("CLOUDSQL_HOST", "10.0.0.1")
+	t.Setenv("CLOUDSQL_PRIMARY_REGION", "us-central1")
+	t.Setenv("CLOUDSQL_READ_HOSTS", "us-east1=10.0.0.2,europe-west1=10.1.0.2")
+	t.Setenv("CLOUDSQL_FAILOVER_REGION", "us-east1")
+
+	topo, err := loadDBTopology()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topo.primaryRegion != "us-east1" || topo.primaryHost != "10.0.0.2" {
+		t.Errorf("primary = %s/%s, want us-east1/10.0.0.2", topo.primaryRegion, topo.primaryHost)
+	}
+	if _, ok := topo.readHosts["us-east1"]; ok || len(topo.readHosts) != 1 {
+		t.Errorf("readHosts = %v, want only europe-west1", topo.readHosts)
+	}
+
+	t.Setenv("CLOUDSQL_FAILOVER_REGION", "asia-east1")
+	if _, err := loadDBTopology(); err == nil {
+		t.Error("expected error for failover region without a read endpoint")
+	}
+}
+
+func TestReadRouterPick(t *testing.T) {
+	primary := &readEndpoint{region: "us-central1"}
+	near := &readEndpoint{region: "us-east1"}
+	far := &readEndpoint{region: "europe-west1"}
+	r := newReadRouter(primary, near, far)
+
+	if got := r.pick(); got != primary {
+		t.Errorf("before probing pick = %s, want primary", got.region)
+	}
+
+	primary.observe(40*time.Millisecond, nil)
+	near.observe(5*time.Millisecond, nil)
+	far.observe(90*time.Millisecond, nil)
+	if got := r.pick(); got != near {
+		t.Errorf("pick = %s, want us-east1", got.region)
+	}
+
+	near.observe(0, errors.New("connection refused"))
+	if got := r.pick(); got != primary {
+		t.Errorf("after us-east1 failed pick = %s, want primary", got.region)
+	}
+}
+
+func TestReadRouterRunStopsWithContext(t *testing.T) {
+	r := newReadRouter(&readEndpoint{region: "us-central1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("probe loop still running after its context was cancelled")
+	}
+}
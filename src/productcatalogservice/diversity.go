@@ -0,0 +1,195 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// diversitySettings configure the diversification of semantic search
+// results by maximal marginal relevance (MMR), so that near-duplicates, such
+// as one chair in five colors, do not fill the top results.
+type diversitySettings struct {
+	// lambda weighs relevance against similarity to the results already
+	// picked; 1 ranks by relevance alone.
+	lambda float64
+	// candidates is how many products, in relevance order, the results are
+	// picked from.
+	candidates int32
+}
+
+func (s diversitySettings) String() string {
+	if s.lambda == 1 {
+		return "disabled"
+	}
+	return fmt.Sprintf("lambda=%g, candidates=%d", s.lambda, s.candidates)
+}
+
+// diversity holds the settings in effect, set from the environment at
+// startup.
+var diversity = diversitySettings{lambda: 1, candidates: 30}
+
+// diversityFromEnv builds diversitySettings from the environment:
+//
+//	SEARCH_DIVERSITY_LAMBDA      relevance weight when picking each result, in [0, 1]; 1 is off (default 1)
+//	SEARCH_DIVERSITY_CANDIDATES  products the results are picked from, up to 200 (default 30)
+func diversityFromEnv() (diversitySettings, error) {
+	s := diversity
+	if v := os.Getenv("SEARCH_DIVERSITY_LAMBDA"); v != "" {
+		l, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(l >= 0 && l <= 1) {
+			return diversitySettings{}, fmt.Errorf("failed to parse SEARCH_DIVERSITY_LAMBDA (%s) as a number in [0, 1]", v)
+		}
+		s.lambda = l
+	}
+	if v := os.Getenv("SEARCH_DIVERSITY_CANDIDATES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRerankCandidates {
+			return diversitySettings{}, fmt.Errorf("failed to parse SEARCH_DIVERSITY_CANDIDATES (%s) as an integer from 1 to %d", v, maxRerankCandidates)
+		}
+		s.candidates = int32(n)
+	}
+	return s, nil
+}
+
+// lambdaFor returns the lambda override of req, or s.lambda when it has
+// none.
+func (s diversitySettings) lambdaFor(req *pb.SemanticSearchRequest) (float64, error) {
+	if req.DiversityLambda == nil {
+		return s.lambda, nil
+	}
+	l := req.GetDiversityLambda()
+	if !(l >= 0 && l <= 1) {
+		return 0, fmt.Errorf("diversity lambda %v is outside [0, 1]", l)
+	}
+	return l, nil
+}
+
+// diversityQuery returns the cosine similarity of each pair of the products
+// in $1 that have combined embeddings.
+func diversityQuery() string {
+	return `
+	SELECT a.id, b.id, 1 - (a.combined_embedding <=> b.combined_embedding)
+	FROM ` + productsTable + ` a JOIN ` + productsTable + ` b ON a.id < b.id
+	WHERE a.id = ANY($1::text[]) AND b.id = ANY($1::text[])
+	  AND a.combined_embedding IS NOT NULL AND b.combined_embedding IS NOT NULL`
+}
+
+// diversify picks limit of products, in relevance order, by maximal marginal
+// relevance with lambda, and returns them with their debug scores reordered
+// alike when there are any. If the similarities cannot be read, the
+// relevance order is kept.
+func diversify(ctx context.Context, products []*pb.Product, scores []*pb.SearchDebug_ResultScores, lambda float64, limit int32, sl *searchLog) ([]*pb.Product, []*pb.SearchDebug_ResultScores) {
+	first := func() ([]*pb.Product, []*pb.SearchDebug_ResultScores) {
+		return products[:min(len(products), int(limit))], scores[:min(len(scores), int(limit))]
+	}
+	if len(products) < 2 {
+		return first()
+	}
+
+	start := time.Now()
+	sim, err := productSimilarities(ctx, products)
+	sl.step("diversify", time.Since(start))
+	if err != nil {
+		sl.set("diversity_error", err.Error())
+		return first()
+	}
+	sl.set("diversified", len(products))
+
+	order := mmrOrder(len(products), sim, lambda, int(limit))
+	diversified := make([]*pb.Product, len(order))
+	var diversifiedScores []*pb.SearchDebug_ResultScores
+	for i, j := range order {
+		diversified[i] = products[j]
+		if len(scores) == len(products) {
+			diversifiedScores = append(diversifiedScores, scores[j])
+		}
+	}
+	return diversified, diversifiedScores
+}
+
+// productSimilarities runs diversityQuery for products and returns the
+// similarity of products i and j; products without embeddings are
+// dissimilar to all others.
+func productSimilarities(ctx context.Context, products []*pb.Product) (func(i, j int) float64, error) {
+	index := make(map[string]int, len(products))
+	ids := make([]string, len(products))
+	for i, p := range products {
+		index[p.Id] = i
+		ids[i] = p.Id
+	}
+	rows, err := readDB().QueryContext(ctx, diversityQuery(), ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query similarities: %v", err)
+	}
+	defer rows.Close()
+	n := len(products)
+	matrix := make([]float64, n*n)
+	for rows.Next() {
+		var a, b string
+		var s float64
+		if err := rows.Scan(&a, &b, &s); err != nil {
+			return nil, fmt.Errorf("failed to scan similarity: %v", err)
+		}
+		i, j := index[a], index[b]
+		matrix[i*n+j], matrix[j*n+i] = s, s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read similarities: %v", err)
+	}
+	return func(i, j int) float64 { return matrix[i*n+j] }, nil
+}
+
+// mmrOrder picks k of n candidates, in relevance order, by maximal marginal
+// relevance: each pick maximizes lambda·relevance − (1−lambda)·the greatest
+// similarity to an earlier pick. Relevance falls linearly from 1 for the
+// first candidate to 0 past the last, so it follows whichever ranking
+// ordered them. It returns the indices of the picks in order.
+func mmrOrder(n int, sim func(i, j int) float64, lambda float64, k int) []int {
+	k = min(k, n)
+	picked := make([]int, 0, k)
+	used := make([]bool, n)
+	// closest holds the greatest similarity of each candidate to a pick.
+	closest := make([]float64, n)
+	for len(picked) < k {
+		best, bestScore := -1, 0.0
+		for i := 0; i < n; i++ {
+			if used[i] {
+				continue
+			}
+			score := lambda * (1 - float64(i)/float64(n))
+			if len(picked) > 0 {
+				score -= (1 - lambda) * closest[i]
+			}
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		picked = append(picked, best)
+		used[best] = true
+		for i := 0; i < n; i++ {
+			if s := sim(i, best); !used[i] && (len(picked) == 1 || s > closest[i]) {
+				closest[i] = s
+			}
+		}
+	}
+	return picked
+}
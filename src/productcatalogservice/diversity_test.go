@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDiversityFromEnv(t *testing.T) {
+	got, err := diversityFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (diversitySettings{lambda: 1, candidates: 30}); got != want || got.String() != "disabled" {
+		t.Errorf("default: got %+v (%s), want %+v", got, got, want)
+	}
+
+	t.Setenv("SEARCH_DIVERSITY_LAMBDA", "0.7")
+	t.Setenv("SEARCH_DIVERSITY_CANDIDATES", "40")
+	if got, err = diversityFromEnv(); err != nil || got != (diversitySettings{lambda: 0.7, candidates: 40}) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	for env, value := range map[string]string{
+		"SEARCH_DIVERSITY_LAMBDA":     "1.5",
+		"SEARCH_DIVERSITY_CANDIDATES": "201",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := diversityFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestDiversityLambdaFor(t *testing.T) {
+	s := diversitySettings{lambda: 0.8}
+	if l, err := s.lambdaFor(&pb.SemanticSearchRequest{}); err != nil || l != 0.8 {
+		t.Errorf("without override: got %v, %v; want 0.8", l, err)
+	}
+	if l, err := s.lambdaFor(&pb.SemanticSearchRequest{DiversityLambda: proto.Float64(1)}); err != nil || l != 1 {
+		t.Errorf("override: got %v, %v; want 1", l, err)
+	}
+	if _, err := s.lambdaFor(&pb.SemanticSearchRequest{DiversityLambda: proto.Float64(-0.1)}); err == nil {
+		t.Error("expected an error for a negative lambda")
+	}
+	if _, err := s.lambdaFor(&pb.SemanticSearchRequest{DiversityLambda: proto.Float64(math.NaN())}); err == nil {
+		t.Error("expected an error for a NaN lambda")
+	}
+}
+
+func TestMMROrder(t *testing.T) {
+	// 0, 1 and 2 are one chair in three colors; 3 and 4 are other products.
+	sim := func(i, j int) float64 {
+		if i == j || (i < 3 && j < 3) {
+			return 0.98
+		}
+		return 0.2
+	}
+	for _, tc := range []struct {
+		lambda float64
+		k      int
+		want   string
+	}{
+		{1, 5, "[0 1 2 3 4]"},
+		{0.5, 5, "[0 3 4 1 2]"},
+		{0.5, 3, "[0 3 4]"},
+		{0.5, 9, "[0 3 4 1 2]"},
+		{0, 2, "[0 3]"},
+	} {
+		if got := fmt.Sprint(mmrOrder(5, sim, tc.lambda, tc.k)); got != tc.want {
+			t.Errorf("mmrOrder(lambda=%g, k=%d) = %s, want %s", tc.lambda, tc.k, got, tc.want)
+		}
+	}
+}
+
+func TestDiversifyKeepsShortResults(t *testing.T) {
+	products := []*pb.Product{{Id: "A"}}
+	got, _ := diversify(context.Background(), products, nil, 0.5, 10, newSearchLog(&pb.SemanticSearchRequest{}))
+	if len(got) != 1 || got[0].Id != "A" {
+		t.Errorf("got %v, want the single product", got)
+	}
+}
+
+func TestSemanticSearchRejectsInvalidDiversity(t *testing.T) {
+	_, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "alpha", DiversityLambda: proto.Float64(2)})
+	if err == nil {
+		t.Error("expected an error for a lambda above 1")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errEmbeddingCircuitOpen is returned instead of calling the embedding
+// provider while the circuit breaker is open.
+var errEmbeddingCircuitOpen = errors.New("embedding circuit breaker is open")
+
+// embeddingBreaker guards calls to the embedding provider. nil, the value
+// until main configures it, never trips.
+var embeddingBreaker *circuitBreaker
+
+// circuitBreaker stops calling a dependency after threshold consecutive
+// failures. Once cooldown has passed it lets a single call through: success
+// closes the breaker, failure keeps it open for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+func (b *circuitBreaker) String() string {
+	if b == nil {
+		return "disabled"
+	}
+	return fmt.Sprintf("opens after %d failures, cooldown %v", b.threshold, b.cooldown)
+}
+
+// embeddingBreakerFromEnv builds the embedding circuit breaker from the
+// environment:
+//
+//	EMBEDDING_BREAKER_THRESHOLD   consecutive failures that open it, 0 to disable (default 5)
+//	EMBEDDING_BREAKER_COOLDOWN    time open before a trial call (default 30s)
+func embeddingBreakerFromEnv() (*circuitBreaker, error) {
+	threshold, cooldown := 5, 30*time.Second
+	if s := os.Getenv("EMBEDDING_BREAKER_THRESHOLD"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("failed to parse EMBEDDING_BREAKER_THRESHOLD (%s) as a non-negative integer", s)
+		}
+		threshold = v
+	}
+	if s := os.Getenv("EMBEDDING_BREAKER_COOLDOWN"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("failed to parse EMBEDDING_BREAKER_COOLDOWN (%s) as a positive time.Duration", s)
+		}
+		cooldown = v
+	}
+	if threshold == 0 {
+		return nil, nil
+	}
+	return newCircuitBreaker(threshold, cooldown), nil
+}
+
+// call runs fn unless the breaker is open, and records its outcome. Failures
+// after ctx is done are the caller giving up and are not counted.
+func (b *circuitBreaker) call(ctx context.Context, fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if !b.allow() {
+		return errEmbeddingCircuitOpen
+	}
+	err := fn()
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return err
+	}
+	b.record(err)
+	return err
+}
+
+// allow reports whether a call may go through.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record updates the breaker with the outcome of an allowed call.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.open {
+			log.Info("Embedding circuit breaker closed")
+		}
+		b.failures, b.open, b.probing = 0, false, false
+		return
+	}
+	b.failures++
+	switch {
+	case b.probing:
+		b.probing = false
+		b.openedAt = b.now()
+	case !b.open && b.failures >= b.threshold:
+		b.open = true
+		b.openedAt = b.now()
+		log.Warnf("Embedding circuit breaker opened after %d consecutive failures: %v", b.failures, err)
+	}
+}
+
+// release forgets an allowed call whose outcome says nothing about the
+// dependency, so a trial call can be made again.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingBreakerFromEnv(t *testing.T) {
+	t.Setenv("EMBEDDING_BREAKER_THRESHOLD", "3")
+	t.Setenv("EMBEDDING_BREAKER_COOLDOWN", "1m")
+	b, err := embeddingBreakerFromEnv()
+	if err != nil || b == nil || b.threshold != 3 || b.cooldown != time.Minute {
+		t.Fatalf("got %v, %v; want threshold 3, cooldown 1m", b, err)
+	}
+
+	t.Setenv("EMBEDDING_BREAKER_THRESHOLD", "0")
+	if b, err := embeddingBreakerFromEnv(); err != nil || b != nil {
+		t.Errorf("threshold 0: got %v, %v; want no breaker", b, err)
+	}
+
+	for env, value := range map[string]string{
+		"EMBEDDING_BREAKER_THRESHOLD": "-1",
+		"EMBEDDING_BREAKER_COOLDOWN":  "0s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := embeddingBreakerFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+	down := errors.New("unavailable")
+	calls := 0
+	fail := func() error { calls++; return down }
+	succeed := func() error { calls++; return nil }
+
+	b.call(ctx, fail)
+	b.call(ctx, fail)
+	if err := b.call(ctx, succeed); !errors.Is(err, errEmbeddingCircuitOpen) || calls != 2 {
+		t.Fatalf("after 2 failures: got %v after %d calls, want the breaker open", err, calls)
+	}
+
+	// After the cooldown a single trial goes through; its failure reopens.
+	now = now.Add(time.Minute)
+	if err := b.call(ctx, fail); !errors.Is(err, down) {
+		t.Fatalf("trial call: got %v, want it made", err)
+	}
+	if err := b.call(ctx, succeed); !errors.Is(err, errEmbeddingCircuitOpen) {
+		t.Fatalf("after a failed trial: got %v, want the breaker open", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.call(ctx, succeed); err != nil {
+		t.Fatalf("second trial: %v", err)
+	}
+	if err := b.call(ctx, fail); !errors.Is(err, down) {
+		t.Errorf("after a successful trial: got %v, want the breaker closed", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresCanceledCalls(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.call(ctx, func() error { return ctx.Err() })
+	if err := b.call(context.Background(), func() error { return nil }); err != nil {
+		t.Errorf("a call the caller canceled opened the breaker: %v", err)
+	}
+}
+
+func TestEmbeddingFailurePolicyStopsRetryingWhenOpen(t *testing.T) {
+	defer func(b *circuitBreaker) { embeddingBreaker = b }(embeddingBreaker)
+	embeddingBreaker = newCircuitBreaker(2, time.Minute)
+
+	calls := 0
+	retry := embeddingFailurePolicy{mode: embeddingFailRetry, attempts: 5, backoff: time.Millisecond}
+	err := retry.run(context.Background(), func(context.Context) error {
+		calls++
+		return errors.New("unavailable")
+	})
+	if !errors.Is(err, errEmbeddingCircuitOpen) || calls != 2 {
+		t.Errorf("got %v after %d calls, want the breaker to cut retries after 2", err, calls)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// embeddingContractPath is the shared contract between this service and the
+// Python embedding service.
+const embeddingContractPath = "../../protos/embedding_contract.json"
+
+type contractSchema struct {
+	Type       string                    `json:"type"`
+	Required   []string                  `json:"required"`
+	Properties map[string]contractSchema `json:"properties"`
+	Items      *contractSchema           `json:"items"`
+}
+
+type contractInteraction struct {
+	Description string `json:"description"`
+	Request     struct {
+		Method string          `json:"method"`
+		Path   string          `json:"path"`
+		Schema string          `json:"schema"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"request"`
+	Response struct {
+		Status int             `json:"status"`
+		Schema string          `json:"schema"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"response"`
+}
+
+type embeddingContract struct {
+	Schemas      map[string]contractSchema `json:"schemas"`
+	Interactions []contractInteraction     `json:"interactions"`
+}
+
+func loadEmbeddingContract(t *testing.T) embeddingContract {
+	t.Helper()
+	data, err := os.ReadFile(embeddingContractPath)
+	if err != nil {
+		t.Fatalf("failed to read embedding contract: %v", err)
+	}
+	var c embeddingContract
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("failed to parse embedding contract: %v", err)
+	}
+	return c
+}
+
+// newFakeEmbeddingServer serves the contract's canned responses. Requests
+// that match no interaction fail the test, so a client sending a request the
+// provider never agreed to is caught as well.
+func newFakeEmbeddingServer(t *testing.T, interactions ...contractInteraction) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var got interface{}
+		json.Unmarshal(body, &got)
+		for _, in := range interactions {
+			var want interface{}
+			json.Unmarshal(in.Request.Body, &want)
+			if r.Method == in.Request.Method && r.URL.Path == in.Request.Path && reflect.DeepEqual(got, want) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(in.Response.Status)
+				w.Write(in.Response.Body)
+				return
+			}
+		}
+		t.Errorf("fake embedding server: no interaction matches %s %s %s", r.Method, r.URL.Path, body)
+		http.Error(w, "no matching interaction", http.StatusNotImplemented)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// validateSchema checks value against the subset of JSON Schema used by the contract.
+func validateSchema(t *testing.T, path string, s contractSchema, value interface{}) {
+	t.Helper()
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: got %T, want object", path, value)
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				t.Errorf("%s: missing required field %q", path, name)
+			}
+		}
+		for name, prop := range s.Properties {
+			if v, ok := obj[name]; ok {
+				validateSchema(t, path+"."+name, prop, v)
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			t.Errorf("%s: got %T, want array", path, value)
+			return
+		}
+		for _, v := range arr {
+			validateSchema(t, path+"[]", *s.Items, v)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			t.Errorf("%s: got %T, want string", path, value)
+		}
+	case "number", "integer":
+		f, ok := value.(float64)
+		if !ok || (s.Type == "integer" && f != float64(int64(f))) {
+			t.Errorf("%s: got %v, want %s", path, value, s.Type)
+		}
+	}
+}
+
+func TestEmbeddingContractExamplesMatchSchemas(t *testing.T) {
+	c := loadEmbeddingContract(t)
+	for _, in := range c.Interactions {
+		var req, resp interface{}
+		json.Unmarshal(in.Request.Body, &req)
+		json.Unmarshal(in.Response.Body, &resp)
+		validateSchema(t, in.Description+" request", c.Schemas[in.Request.Schema], req)
+		validateSchema(t, in.Description+" response", c.Schemas[in.Response.Schema], resp)
+	}
+}
+
+func TestEmbeddingClientContract(t *testing.T) {
+	c := loadEmbeddingContract(t)
+	for _, in := range c.Interactions {
+		t.Run(in.Description, func(t *testing.T) {
+			srv := newFakeEmbeddingServer(t, in)
+			client := httpEmbeddingProvider{baseURL: srv.URL}
+
+			switch in.Request.Path {
+			case "/embed":
+				checkSingleEmbedding(t, client, in)
+			case "/embed/batch":
+				checkBatchEmbedding(t, client, in)
+			default:
+				t.Fatalf("no client for contract path %s", in.Request.Path)
+			}
+		})
+	}
+}
+
+// checkSingleEmbedding replays an /embed interaction through client.Embed.
+func checkSingleEmbedding(t *testing.T, client httpEmbeddingProvider, in contractInteraction) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(in.Request.Body, &req); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.Embed(context.Background(), req.Text)
+
+	if in.Response.Status != http.StatusOK {
+		if err == nil {
+			t.Errorf("expected error for status %d, got embedding %v", in.Response.Status, got)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	var want struct {
+		Embedding  []float32 `json:"embedding"`
+		Dimensions int       `json:"dimensions"`
+	}
+	if err := json.Unmarshal(in.Response.Body, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want.Embedding) {
+		t.Errorf("got embedding %v, want %v", got, want.Embedding)
+	}
+	if len(got) != want.Dimensions {
+		t.Errorf("got %d dimensions, contract says %d", len(got), want.Dimensions)
+	}
+}
+
+// checkBatchEmbedding replays an /embed/batch interaction through
+// client.EmbedBatch.
+func checkBatchEmbedding(t *testing.T, client httpEmbeddingProvider, in contractInteraction) {
+	var req struct {
+		Texts []string `json:"texts"`
+	}
+	if err := json.Unmarshal(in.Request.Body, &req); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.EmbedBatch(context.Background(), req.Texts)
+
+	if in.Response.Status != http.StatusOK {
+		if err == nil {
+			t.Errorf("expected error for status %d, got embeddings %v", in.Response.Status, got)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	var want struct {
+		Embeddings [][]float32 `json:"embeddings"`
+		Count      int         `json:"count"`
+	}
+	if err := json.Unmarshal(in.Response.Body, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want.Embeddings) {
+		t.Errorf("got embeddings %v, want %v", got, want.Embeddings)
+	}
+	if len(got) != want.Count {
+		t.Errorf("got %d embeddings, contract says %d", len(got), want.Count)
+	}
+}
+
+func TestEmbeddingClientRejectsContractDrift(t *testing.T) {
+	// A provider that renames "embedding" must not yield a silent nil vector.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"values": [0.1, 0.2], "dimensions": 2, "model": "text-embedding-004"}`))
+	}))
+	defer srv.Close()
+
+	client := httpEmbeddingProvider{baseURL: srv.URL}
+	if got, err := client.Embed(context.Background(), "comfortable seating"); err == nil {
+		t.Errorf("expected error for response without embedding, got %v", got)
+	}
+}
+
+func TestEmbeddingBatchClientRejectsShortResponse(t *testing.T) {
+	// One embedding for two texts would misalign every product after the gap.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"embeddings": [[0.1, 0.2]], "count": 1, "dimensions": 2, "model": "text-embedding-004"}`))
+	}))
+	defer srv.Close()
+
+	client := httpEmbeddingProvider{baseURL: srv.URL}
+	if got, err := client.EmbedBatch(context.Background(), []string{"mug", "kettle"}); err == nil {
+		t.Errorf("expected error for a short batch response, got %v", got)
+	}
+}
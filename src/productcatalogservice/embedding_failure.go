@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// embeddingFailKeyword serves a failed semantic search from keyword search.
+	embeddingFailKeyword = "keyword"
+	// embeddingFailFail returns Unavailable as soon as embedding fails.
+	embeddingFailFail = "fail"
+	// embeddingFailRetry retries embedding with backoff, then returns Unavailable.
+	embeddingFailRetry = "retry"
+)
+
+// embeddingFailurePolicy decides what happens when text cannot be embedded.
+// No policy substitutes made-up vectors: a product whose texts cannot be
+// embedded keeps NULL embeddings until a later backfill succeeds.
+type embeddingFailurePolicy struct {
+	mode     string
+	attempts int
+	backoff  time.Duration
+	// timeout bounds each attempt; 0 leaves it to the caller's context.
+	timeout time.Duration
+}
+
+func (p embeddingFailurePolicy) String() string {
+	if p.mode != embeddingFailRetry {
+		return fmt.Sprintf("%s (timeout %v)", p.mode, p.timeout)
+	}
+	return fmt.Sprintf("%s (%d attempts, backoff %v, timeout %v)", p.mode, p.attempts, p.backoff, p.timeout)
+}
+
+// embeddingFailure is the policy in effect, set from the environment at
+// startup.
+var embeddingFailure = embeddingFailurePolicy{mode: embeddingFailKeyword, attempts: 3, backoff: 200 * time.Millisecond, timeout: 10 * time.Second}
+
+// embeddingFailurePolicyFromEnv builds an embeddingFailurePolicy from the
+// environment:
+//
+//	EMBEDDING_FAILURE_POLICY   keyword (default), fail or retry
+//	EMBEDDING_RETRY_ATTEMPTS   attempts under the retry policy (default 3)
+//	EMBEDDING_RETRY_BACKOFF    first retry delay, doubled per attempt (default 200ms)
+//	EMBEDDING_TIMEOUT          limit on each attempt, 0 for none (default 10s)
+func embeddingFailurePolicyFromEnv() (embeddingFailurePolicy, error) {
+	p := embeddingFailure
+	if s := os.Getenv("EMBEDDING_FAILURE_POLICY"); s != "" {
+		switch s {
+		case embeddingFailKeyword, embeddingFailFail, embeddingFailRetry:
+			p.mode = s
+		default:
+			return embeddingFailurePolicy{}, fmt.Errorf("unknown EMBEDDING_FAILURE_POLICY %q (want keyword, fail or retry)", s)
+		}
+	}
+	if s := os.Getenv("EMBEDDING_RETRY_ATTEMPTS"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 {
+			return embeddingFailurePolicy{}, fmt.Errorf("failed to parse EMBEDDING_RETRY_ATTEMPTS (%s) as a positive integer", s)
+		}
+		p.attempts = v
+	}
+	if s := os.Getenv("EMBEDDING_RETRY_BACKOFF"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v < 0 {
+			return embeddingFailurePolicy{}, fmt.Errorf("failed to parse EMBEDDING_RETRY_BACKOFF (%s) as a non-negative time.Duration", s)
+		}
+		p.backoff = v
+	}
+	if s := os.Getenv("EMBEDDING_TIMEOUT"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v < 0 {
+			return embeddingFailurePolicy{}, fmt.Errorf("failed to parse EMBEDDING_TIMEOUT (%s) as a non-negative time.Duration", s)
+		}
+		p.timeout = v
+	}
+	return p, nil
+}
+
+// run calls fn once, or under the retry policy until it succeeds, attempts
+// run out or ctx is done. Each attempt gets its own timeout and goes through
+// embeddingBreaker; while the breaker is open run fails at once with
+// errEmbeddingCircuitOpen. Embeddings of the wrong size are not retried,
+// since the model would return them again. It returns the last error.
+func (p embeddingFailurePolicy) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	attempts := 1
+	if p.mode == embeddingFailRetry {
+		attempts = p.attempts
+	}
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		err := embeddingBreaker.call(ctx, func() error { return p.attempt(ctx, fn) })
+		if err == nil || attempt >= attempts || errors.Is(err, errEmbeddingCircuitOpen) || errors.Is(err, errEmbeddingDimensions) {
+			return err
+		}
+		delay := jitter(backoff)
+		log.Warnf("Embedding failed (attempt %d of %d), retrying in %v: %v", attempt, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+// attempt calls fn with a context limited to p.timeout.
+func (p embeddingFailurePolicy) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// jitter spreads d uniformly over [d/2, 3d/2), so replicas that failed
+// together do not retry together.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingFailurePolicyFromEnv(t *testing.T) {
+	t.Setenv("EMBEDDING_FAILURE_POLICY", "retry")
+	t.Setenv("EMBEDDING_RETRY_ATTEMPTS", "5")
+	t.Setenv("EMBEDDING_RETRY_BACKOFF", "50ms")
+	t.Setenv("EMBEDDING_TIMEOUT", "2s")
+	got, err := embeddingFailurePolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (embeddingFailurePolicy{mode: embeddingFailRetry, attempts: 5, backoff: 50 * time.Millisecond, timeout: 2 * time.Second}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for env, value := range map[string]string{
+		"EMBEDDING_FAILURE_POLICY": "hash",
+		"EMBEDDING_RETRY_ATTEMPTS": "0",
+		"EMBEDDING_RETRY_BACKOFF":  "soon",
+		"EMBEDDING_TIMEOUT":        "-1s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := embeddingFailurePolicyFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestEmbeddingFailurePolicyRun(t *testing.T) {
+	failTwice := func(calls *int) func(context.Context) error {
+		return func(context.Context) error {
+			if *calls++; *calls <= 2 {
+				return errors.New("unavailable")
+			}
+			return nil
+		}
+	}
+
+	var calls int
+	retry := embeddingFailurePolicy{mode: embeddingFailRetry, attempts: 3, backoff: time.Millisecond}
+	if err := retry.run(context.Background(), failTwice(&calls)); err != nil || calls != 3 {
+		t.Errorf("retry: got err %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls = 0
+	fail := embeddingFailurePolicy{mode: embeddingFailFail, attempts: 3, backoff: time.Millisecond}
+	if err := fail.run(context.Background(), failTwice(&calls)); err == nil || calls != 1 {
+		t.Errorf("fail: got err %v after %d calls, want an error after 1", err, calls)
+	}
+}
+
+func TestEmbeddingFailurePolicyTimeout(t *testing.T) {
+	p := embeddingFailurePolicy{mode: embeddingFailKeyword, timeout: 10 * time.Millisecond}
+	err := p.run(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done() // a stalled embedding service
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the attempt to time out", err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(100 * time.Millisecond); d < 50*time.Millisecond || d >= 150*time.Millisecond {
+			t.Fatalf("jitter(100ms) = %v, want within [50ms, 150ms)", d)
+		}
+	}
+	if d := jitter(0); d != 0 {
+		t.Errorf("jitter(0) = %v, want 0", d)
+	}
+}
+
+func TestGenerateEmbeddingsNeverSubstitutesVectors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	t.Setenv("EMBEDDING_SERVICE_URL", srv.URL)
+
+	if got, err := generateEmbeddings(context.Background(), []string{"mug", "kettle"}); err == nil {
+		t.Errorf("expected error when the embedding service is down, got %d vectors", len(got))
+	}
+}
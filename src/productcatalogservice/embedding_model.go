@@ -0,0 +1,97 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// defaultEmbeddingModel is the model the embedding service and Vertex AI mode
+// use when EMBEDDING_MODEL is not set.
+const defaultEmbeddingModel = "text-embedding-004"
+
+// embeddingModel names the vector space embeddings are computed in. It is
+// stored with each product's embeddings, and products embedded in another
+// space are left out of semantic search until they are re-embedded. In
+// service mode EMBEDDING_MODEL must match the embedding service's.
+func embeddingModel() string {
+	switch embeddingMode() {
+	case embeddingModeStub:
+		return fmt.Sprintf("stub/%d", stubEmbeddingSeed())
+	default:
+		return envOrDefault("EMBEDDING_MODEL", defaultEmbeddingModel)
+	}
+}
+
+// embeddingModelFilter appends a condition that keeps products embedded with
+// the current model, or before models were recorded, to a products query.
+// It adds nothing until the embedding_model column exists.
+func embeddingModelFilter(args []interface{}) (string, []interface{}) {
+	if !productsSchemaReady.Load() {
+		return "", args
+	}
+	args = append(args, embeddingModel())
+	return fmt.Sprintf(" AND (p.embedding_model IS NULL OR p.embedding_model = $%d)", len(args)), args
+}
+
+// countForeignEmbeddings counts products embedded with another model.
+func countForeignEmbeddings(ctx context.Context) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		`SELECT count(*) FROM `+productsTable+` WHERE embedding_model IS NOT NULL AND embedding_model <> $1`,
+		embeddingModel()).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count products embedded with another model: %v", err)
+	}
+	return n, nil
+}
+
+// warnForeignEmbeddings logs how many products semantic search leaves out
+// because they were embedded with another model.
+func warnForeignEmbeddings(ctx context.Context) {
+	n, err := countForeignEmbeddings(ctx)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+	if n > 0 {
+		log.Warnf("%d products were embedded with another model than %s and are left out of semantic search until re-embedded; run with -migrate-embeddings", n, embeddingModel())
+	}
+}
+
+// migrateEmbeddings re-embeds every product whose embeddings are missing,
+// stale or from another model, then returns. It is the -migrate-embeddings
+// command, run once after changing EMBEDDING_MODEL.
+func migrateEmbeddings() error {
+	if err := initDatabase(); err != nil {
+		return err
+	}
+	if db == nil {
+		return fmt.Errorf("CLOUDSQL_HOST is not set")
+	}
+	ctx := context.Background()
+	if err := ensureProductsSchema(ctx); err != nil {
+		return err
+	}
+	var stale int
+	err := db.QueryRowContext(ctx, `SELECT count(*) FROM `+productsTable+` WHERE `+staleEmbeddingCondition,
+		embeddingVersion, embeddingModel()).Scan(&stale)
+	if err != nil {
+		return fmt.Errorf("failed to count stale products: %v", err)
+	}
+	log.Infof("Re-embedding %d products with model %s", stale, embeddingModel())
+	return populateEmbeddings()
+}
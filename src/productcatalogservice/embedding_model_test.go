@@ -0,0 +1,57 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestEmbeddingModel(t *testing.T) {
+	for _, tc := range []struct {
+		mode, model, seed string
+		want              string
+	}{
+		{"", "", "", defaultEmbeddingModel},
+		{embeddingModeVertex, "text-embedding-005", "", "text-embedding-005"},
+		{embeddingModeStub, "text-embedding-005", "7", "stub/7"},
+	} {
+		t.Setenv("EMBEDDING_MODE", tc.mode)
+		t.Setenv("EMBEDDING_MODEL", tc.model)
+		t.Setenv("EMBEDDING_STUB_SEED", tc.seed)
+		if got := embeddingModel(); got != tc.want {
+			t.Errorf("mode %q, model %q: got %q, want %q", tc.mode, tc.model, got, tc.want)
+		}
+	}
+}
+
+func TestEmbeddingModelFilter(t *testing.T) {
+	t.Setenv("EMBEDDING_MODE", embeddingModeVertex)
+	t.Setenv("EMBEDDING_MODEL", "text-embedding-005")
+	defer productsSchemaReady.Store(productsSchemaReady.Load())
+
+	productsSchemaReady.Store(false)
+	if sql, args := embeddingModelFilter([]interface{}{1}); sql != "" || len(args) != 1 {
+		t.Errorf("without the embedding_model column got %q %v, want no condition", sql, args)
+	}
+
+	productsSchemaReady.Store(true)
+	sql, args := embeddingModelFilter([]interface{}{1, 2})
+	if want := " AND (p.embedding_model IS NULL OR p.embedding_model = $3)"; sql != want {
+		t.Errorf("got %q, want %q", sql, want)
+	}
+	if len(args) != 3 || args[2] != "text-embedding-005" {
+		t.Errorf("got args %v, want the model appended", args)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EmbeddingProvider turns text into the vectors semantic search compares.
+type EmbeddingProvider interface {
+	// Embed returns the embedding of text.
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// EmbedBatch returns one embedding per text, in the order of texts.
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+const (
+	embeddingModeService = "service"
+	embeddingModeVertex  = "vertex"
+	embeddingModeStub    = "stub"
+
+	// embeddingDimensions matches the vector(768) columns of the products table.
+	embeddingDimensions = 768
+
+	// defaultEmbeddingBatchSize is how many texts go into one batch call,
+	// within Vertex AI's per-request input limit.
+	defaultEmbeddingBatchSize = 250
+)
+
+// embeddingMode returns EMBEDDING_MODE, defaulting to "service".
+func embeddingMode() string {
+	if mode := os.Getenv("EMBEDDING_MODE"); mode != "" {
+		return mode
+	}
+	return embeddingModeService
+}
+
+// embeddingProvider returns the provider selected by EMBEDDING_MODE:
+//
+//	service  the embedding service over HTTP (default)
+//	vertex   Vertex AI directly, skipping the embedding service
+//	stub     deterministic vectors without any network call
+func embeddingProvider() (EmbeddingProvider, error) {
+	switch mode := embeddingMode(); mode {
+	case embeddingModeService:
+		return httpEmbeddingProvider{baseURL: embeddingServiceURL()}, nil
+	case embeddingModeVertex:
+		return sharedVertexEmbeddingProvider()
+	case embeddingModeStub:
+		return stubEmbeddingProvider{seed: stubEmbeddingSeed()}, nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDING_MODE %q", mode)
+	}
+}
+
+// errEmbeddingDimensions is returned for embeddings that do not have
+// embeddingDimensions values.
+var errEmbeddingDimensions = errors.New("embedding has the wrong number of dimensions")
+
+// checkEmbeddingDimensions returns errEmbeddingDimensions unless every
+// embedding has embeddingDimensions values. A vector of another size, from a
+// swapped or truncating model, would otherwise fail the vector(768) columns
+// with an obscure pgvector error, or be compared with vectors of another
+// space.
+func checkEmbeddingDimensions(embeddings ...[]float32) error {
+	for i, e := range embeddings {
+		if len(e) != embeddingDimensions {
+			return fmt.Errorf("%w: embedding %d has %d, want %d", errEmbeddingDimensions, i, len(e), embeddingDimensions)
+		}
+	}
+	return nil
+}
+
+// errEmptyEmbeddingText is returned by embedText for blank text, which is
+// not sent to the provider.
+var errEmptyEmbeddingText = errors.New("no text to embed")
+
+// embedText embeds text with the configured provider. Embeddings of the
+// wrong size are logged and returned as errors.
+func embedText(ctx context.Context, text string) ([]float32, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, errEmptyEmbeddingText
+	}
+	p, err := embeddingProvider()
+	if err != nil {
+		return nil, err
+	}
+	embedding, err := p.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEmbeddingDimensions(embedding); err != nil {
+		logEmbeddingDimensions(err)
+		return nil, err
+	}
+	return embedding, nil
+}
+
+// embedTexts is the batch form of embedText. Blank texts are not sent to the
+// provider and get nil embeddings; if every text is blank, the provider is not
+// called at all.
+func embedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	var sent []string
+	var at []int
+	for i, text := range texts {
+		if strings.TrimSpace(text) != "" {
+			sent = append(sent, text)
+			at = append(at, i)
+		}
+	}
+	if len(sent) == 0 {
+		return embeddings, nil
+	}
+	p, err := embeddingProvider()
+	if err != nil {
+		return nil, err
+	}
+	got, err := p.EmbedBatch(ctx, sent)
+	if err != nil {
+		return nil, err
+	}
+	if len(got) != len(sent) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(got), len(sent))
+	}
+	if err := checkEmbeddingDimensions(got...); err != nil {
+		logEmbeddingDimensions(err)
+		return nil, err
+	}
+	for j, i := range at {
+		embeddings[i] = got[j]
+	}
+	return embeddings, nil
+}
+
+// logEmbeddingDimensions reports a dimension mismatch with the embedding
+// settings, which are usually what changed.
+func logEmbeddingDimensions(err error) {
+	log.Errorf("EMBEDDING_MODE=%s with model %s returned an unusable embedding, check that the model produces %d dimensions: %v",
+		embeddingMode(), embeddingModel(), embeddingDimensions, err)
+}
+
+// embeddingBatchSize reads EMBEDDING_BATCH_SIZE, defaulting to
+// defaultEmbeddingBatchSize.
+func embeddingBatchSize() int {
+	size, err := strconv.Atoi(os.Getenv("EMBEDDING_BATCH_SIZE"))
+	if err != nil || size <= 0 {
+		return defaultEmbeddingBatchSize
+	}
+	return size
+}
+
+// embeddingServiceURL returns the base URL of the embedding service.
+func embeddingServiceURL() string {
+	if u := os.Getenv("EMBEDDING_SERVICE_URL"); u != "" {
+		return u
+	}
+	return "http://embeddingservice:8081"
+}
+
+// httpEmbeddingProvider calls the embedding service, which fronts Vertex AI.
+type httpEmbeddingProvider struct {
+	baseURL string
+}
+
+// Embed implements EmbeddingProvider using the service's /embed endpoint.
+func (h httpEmbeddingProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	var response struct {
+		Embedding  []float32 `json:"embedding"`
+		Dimensions int       `json:"dimensions"`
+		Model      string    `json:"model"`
+	}
+	if err := h.post(ctx, "/embed", map[string]string{"text": text}, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Embedding) == 0 {
+		return nil, fmt.Errorf("embedding service response has no embedding")
+	}
+	return response.Embedding, nil
+}
+
+// EmbedBatch implements EmbeddingProvider using the service's /embed/batch
+// endpoint, embedding all texts in one call.
+func (h httpEmbeddingProvider) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var response struct {
+		Embeddings [][]float32 `json:"embeddings"`
+		Count      int         `json:"count"`
+		Dimensions int         `json:"dimensions"`
+		Model      string      `json:"model"`
+	}
+	if err := h.post(ctx, "/embed/batch", map[string][]string{"texts": texts}, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding service returned %d embeddings for %d texts", len(response.Embeddings), len(texts))
+	}
+	for i, e := range response.Embeddings {
+		if len(e) == 0 {
+			return nil, fmt.Errorf("embedding service response has no embedding for text %d", i)
+		}
+	}
+	return response.Embeddings, nil
+}
+
+// post sends payload as JSON to path and decodes the response into out.
+func (h httpEmbeddingProvider) post(ctx context.Context, path string, payload, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call embedding service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("embedding service returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestEmbeddingProviderSelection(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want EmbeddingProvider
+	}{
+		{"", httpEmbeddingProvider{baseURL: "http://embeddings:9000"}},
+		{"service", httpEmbeddingProvider{baseURL: "http://embeddings:9000"}},
+		{"stub", stubEmbeddingProvider{seed: 3}},
+	} {
+		t.Setenv("EMBEDDING_MODE", tc.mode)
+		t.Setenv("EMBEDDING_SERVICE_URL", "http://embeddings:9000")
+		t.Setenv("EMBEDDING_STUB_SEED", "3")
+		got, err := embeddingProvider()
+		if err != nil {
+			t.Errorf("mode %q: %v", tc.mode, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("mode %q: got provider %#v, want %#v", tc.mode, got, tc.want)
+		}
+	}
+
+	// Hash embeddings carry no meaning, so they cannot be selected.
+	t.Setenv("EMBEDDING_MODE", "hash")
+	if _, err := embeddingProvider(); err == nil {
+		t.Error("mode hash: expected an error")
+	}
+}
+
+func TestHashEmbeddingProvider(t *testing.T) {
+	texts := []string{"red mug", "Red Mug"}
+	got, err := hashEmbeddingProvider{}.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || len(got[0]) != embeddingDimensions {
+		t.Fatalf("got %d embeddings of %d dimensions", len(got), len(got[0]))
+	}
+	if !reflect.DeepEqual(got[0], got[1]) {
+		t.Error("hash embedding should ignore case")
+	}
+}
+
+func TestVertexEmbeddings(t *testing.T) {
+	prediction := func(values ...interface{}) *structpb.Value {
+		v, err := structpb.NewValue(map[string]interface{}{
+			"embeddings": map[string]interface{}{"values": values},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	got, err := vertexEmbeddings([]*structpb.Value{prediction(0.5, -0.25), prediction(1.0, 0.0)}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]float32{{0.5, -0.25}, {1, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := vertexEmbeddings([]*structpb.Value{prediction(0.5)}, 2); err == nil {
+		t.Error("expected error for fewer predictions than texts")
+	}
+	if _, err := vertexEmbeddings([]*structpb.Value{prediction()}, 1); err == nil {
+		t.Error("expected error for a prediction without values")
+	}
+}
+
+func TestEmbeddingDimensionsAreChecked(t *testing.T) {
+	// A model swap: the service answers with 1024 dimensions.
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/embed" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"embedding": make([]float32, 1024)})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"embeddings": [][]float32{make([]float32, 1024)}})
+	}))
+	defer srv.Close()
+	t.Setenv("EMBEDDING_MODE", embeddingModeService)
+	t.Setenv("EMBEDDING_SERVICE_URL", srv.URL)
+
+	if _, err := embedText(context.Background(), "mug"); !errors.Is(err, errEmbeddingDimensions) {
+		t.Errorf("embedText: got %v, want errEmbeddingDimensions", err)
+	}
+	if _, err := embedTexts(context.Background(), []string{"mug"}); !errors.Is(err, errEmbeddingDimensions) {
+		t.Errorf("embedTexts: got %v, want errEmbeddingDimensions", err)
+	}
+	// The batch is not retried one text at a time.
+	calls = 0
+	if _, err := generateEmbeddings(context.Background(), []string{"mug"}); !errors.Is(err, errEmbeddingDimensions) || calls != 1 {
+		t.Errorf("generateEmbeddings: got %v after %d calls, want errEmbeddingDimensions after 1", err, calls)
+	}
+}
+
+func TestEmbedBlankText(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Texts []string `json:"texts"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		sent = append(sent, req.Texts...)
+		embeddings := make([][]float32, len(req.Texts))
+		for i := range embeddings {
+			embeddings[i] = make([]float32, embeddingDimensions)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"embeddings": embeddings})
+	}))
+	defer srv.Close()
+	t.Setenv("EMBEDDING_MODE", embeddingModeService)
+	t.Setenv("EMBEDDING_SERVICE_URL", srv.URL)
+
+	if _, err := embedText(context.Background(), "  "); !errors.Is(err, errEmptyEmbeddingText) {
+		t.Errorf("embedText: got %v, want errEmptyEmbeddingText", err)
+	}
+	got, err := embedTexts(context.Background(), []string{"", "mug", " \t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != nil || len(got[1]) != embeddingDimensions || got[2] != nil {
+		t.Errorf("got %d embeddings, want nil ones for the blank texts", len(got))
+	}
+	if _, err := embedTexts(context.Background(), []string{""}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sent, ",") != "mug" {
+		t.Errorf("sent %q to the provider, want only mug", sent)
+	}
+}
+
+func TestStoreProductEmbeddingsRefusesMismatchedVectors(t *testing.T) {
+	pending := []pendingProduct{{}}
+	embeddings := make([][]float32, textsPerProduct)
+	for i := range embeddings {
+		embeddings[i] = make([]float32, embeddingDimensions)
+	}
+	embeddings[2] = embeddings[2][:512]
+	// The check comes before the transaction is used.
+	if err := storeProductEmbeddings(context.Background(), nil, pending, embeddings); err == nil {
+		t.Error("expected a truncated embedding to be refused")
+	}
+	if err := storeProductEmbeddings(context.Background(), nil, pending, embeddings[:1]); err == nil {
+		t.Error("expected missing embeddings to be refused")
+	}
+}
+
+// hashEmbeddingProvider derives vectors from word hashes. It needs no
+// network, but the vectors carry no meaning beyond exact word positions, so
+// it is only for tests.
+type hashEmbeddingProvider struct{}
+
+// Embed implements EmbeddingProvider.
+func (hashEmbeddingProvider) Embed(_ context.Context, text string) ([]float32, error) {
+	return hashEmbedding(text), nil
+}
+
+// EmbedBatch implements EmbeddingProvider.
+func (hashEmbeddingProvider) EmbedBatch(_ context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = hashEmbedding(text)
+	}
+	return embeddings, nil
+}
+
+// hashEmbedding sets one dimension per word, in word order, from a simple
+// string hash.
+func hashEmbedding(text string) []float32 {
+	words := strings.Fields(strings.ToLower(text))
+	embedding := make([]float32, embeddingDimensions)
+
+	for i, word := range words {
+		if i >= embeddingDimensions {
+			break
+		}
+		hash := 0
+		for _, char := range word {
+			hash = hash*31 + int(char)
+		}
+		embedding[i] = float32(hash%1000) / 1000.0
+	}
+	return embedding
+}
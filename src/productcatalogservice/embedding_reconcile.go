@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// embeddingVersion identifies which texts are embedded for a product. Bump it
+// when they change and the reconciler re-embeds every product. Model changes
+// are tracked separately, by embeddingModel.
+const embeddingVersion = 1
+
+const defaultEmbeddingReconcileInterval = 5 * time.Minute
+
+// embeddingReconcileInterval is how often the reconciler looks for products
+// with stale embeddings. 0 runs the backfill once at startup only.
+var embeddingReconcileInterval = defaultEmbeddingReconcileInterval
+
+// staleEmbeddingCondition matches products that have no embeddings, whose
+// text changed after they were embedded, or that were embedded with another
+// embeddingVersion or model. $1 is the current embeddingVersion and $2 the
+// current embeddingModel.
+const staleEmbeddingCondition = `(combined_embedding IS NULL
+			OR embedded_at IS NULL
+			OR embedded_at < updated_at
+			OR embedding_version IS DISTINCT FROM $1
+			OR embedding_model IS DISTINCT FROM $2)`
+
+// embeddingReconcileIntervalFromEnv reads EMBEDDING_RECONCILE_INTERVAL
+// (default 5m). 0 disables the periodic reconciliation.
+func embeddingReconcileIntervalFromEnv() (time.Duration, error) {
+	s := os.Getenv("EMBEDDING_RECONCILE_INTERVAL")
+	if s == "" {
+		return defaultEmbeddingReconcileInterval, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("failed to parse EMBEDDING_RECONCILE_INTERVAL (%s) as a non-negative time.Duration", s)
+	}
+	return v, nil
+}
+
+// reconcileEmbeddings re-embeds stale products, and embeds new product
+// pictures, every interval until ctx is done. Failures are logged and retried
+// on the next tick.
+func reconcileEmbeddings(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := populateEmbeddings(); err != nil {
+			log.Warnf("Embedding reconciliation failed: %v", err)
+		}
+		embedProductPictures(ctx)
+	}
+}
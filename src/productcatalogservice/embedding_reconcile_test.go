@@ -0,0 +1,40 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmbeddingReconcileIntervalFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		env     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", defaultEmbeddingReconcileInterval, false},
+		{"30s", 30 * time.Second, false},
+		{"0", 0, false},
+		{"-1m", 0, true},
+		{"hourly", 0, true},
+	} {
+		t.Setenv("EMBEDDING_RECONCILE_INTERVAL", tc.env)
+		got, err := embeddingReconcileIntervalFromEnv()
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("EMBEDDING_RECONCILE_INTERVAL=%q: got %v, %v; want %v, error %v", tc.env, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// stubEmbeddingProvider returns deterministic vectors without any network
+// call, for tests and local development.
+type stubEmbeddingProvider struct {
+	seed int64
+}
+
+// Embed implements EmbeddingProvider.
+func (s stubEmbeddingProvider) Embed(_ context.Context, text string) ([]float32, error) {
+	return stubEmbedding(text, s.seed), nil
+}
+
+// EmbedBatch implements EmbeddingProvider.
+func (s stubEmbeddingProvider) EmbedBatch(_ context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = stubEmbedding(text, s.seed)
+	}
+	return embeddings, nil
+}
+
+// stubEmbeddingSeed reads EMBEDDING_STUB_SEED, defaulting to 0.
+func stubEmbeddingSeed() int64 {
+	seed, err := strconv.ParseInt(os.Getenv("EMBEDDING_STUB_SEED"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seed
+}
+
+// stubEmbedding builds a unit-length bag-of-words vector: every token maps to
+// a pseudo-random vector derived from (seed, token) and the token vectors are
+// summed. Texts sharing words therefore land close together, which keeps
+// ranking tests meaningful while staying fully deterministic.
+func stubEmbedding(text string, seed int64) []float32 {
+	sum := make([]float64, embeddingDimensions)
+	for _, token := range strings.Fields(strings.ToLower(text)) {
+		h := fnv.New64a()
+		h.Write([]byte(token))
+		rnd := rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+		for i := range sum {
+			sum[i] += rnd.NormFloat64()
+		}
+	}
+
+	var norm float64
+	for _, v := range sum {
+		norm += v * v
+	}
+	embedding := make([]float32, embeddingDimensions)
+	if norm == 0 {
+		return embedding
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range sum {
+		embedding[i] = float32(v / norm)
+	}
+	return embedding
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func TestStubEmbeddingDeterministic(t *testing.T) {
+	a := stubEmbedding("Comfortable Seating", 42)
+	b := stubEmbedding("comfortable   seating", 42)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("same text and seed produced different embeddings")
+	}
+	if reflect.DeepEqual(a, stubEmbedding("comfortable seating", 43)) {
+		t.Error("different seeds produced identical embeddings")
+	}
+	if got := len(a); got != embeddingDimensions {
+		t.Errorf("got %d dimensions, want %d", got, embeddingDimensions)
+	}
+	if n := cosine(a, a); math.Abs(n-1) > 1e-5 {
+		t.Errorf("embedding is not unit length: %v", n)
+	}
+}
+
+func TestStubEmbeddingSharedWordsAreCloser(t *testing.T) {
+	query := stubEmbedding("wooden office chair", 0)
+	related := stubEmbedding("ergonomic office chair with armrests", 0)
+	unrelated := stubEmbedding("stainless steel kettle", 0)
+	if cosine(query, related) <= cosine(query, unrelated) {
+		t.Errorf("related text scored %v, unrelated scored %v", cosine(query, related), cosine(query, unrelated))
+	}
+}
+
+func TestEmbedTextStubMode(t *testing.T) {
+	t.Setenv("EMBEDDING_MODE", "stub")
+	t.Setenv("EMBEDDING_STUB_SEED", "7")
+	t.Setenv("EMBEDDING_SERVICE_URL", "http://127.0.0.1:0")
+
+	got, err := embedText(context.Background(), "kitchen appliances")
+	if err != nil {
+		t.Fatalf("embedText in stub mode failed: %v", err)
+	}
+	if want := stubEmbedding("kitchen appliances", 7); !reflect.DeepEqual(got, want) {
+		t.Error("embedText did not return the seeded stub embedding")
+	}
+
+	t.Setenv("EMBEDDING_MODE", "bogus")
+	if _, err := embedText(context.Background(), "kitchen appliances"); err == nil {
+		t.Error("expected error for unknown EMBEDDING_MODE")
+	}
+}
+
+func TestGenerateEmbeddingsBatches(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embed/batch" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		calls++
+		var req struct {
+			Texts []string `json:"texts"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		embeddings := make([][]float32, len(req.Texts))
+		for i, text := range req.Texts {
+			embeddings[i] = stubEmbedding(text, 0)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"embeddings": embeddings, "count": len(embeddings),
+			"dimensions": embeddingDimensions, "model": "stub",
+		})
+	}))
+	defer srv.Close()
+	t.Setenv("EMBEDDING_SERVICE_URL", srv.URL)
+	t.Setenv("EMBEDDING_BATCH_SIZE", "2")
+
+	texts := []string{"mug", "kettle", "sunglasses", "loafers", "salt and pepper shakers"}
+	got, err := generateEmbeddings(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("made %d batch calls for %d texts, want 3", calls, len(texts))
+	}
+	for i, text := range texts {
+		if !reflect.DeepEqual(got[i], stubEmbedding(text, 0)) {
+			t.Errorf("embedding %d does not belong to %q", i, text)
+		}
+	}
+}
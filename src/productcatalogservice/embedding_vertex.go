@@ -0,0 +1,179 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sync"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// vertexEmbeddingProvider calls the Vertex AI prediction API directly, with
+// the same project, region and model as the embedding service.
+type vertexEmbeddingProvider struct {
+	client   *aiplatform.PredictionClient
+	endpoint string
+	// imageEndpoint is the multimodal model image search embeds with.
+	imageEndpoint string
+}
+
+var (
+	vertexProviderMu sync.Mutex
+	vertexProvider   *vertexEmbeddingProvider
+)
+
+// sharedVertexEmbeddingProvider returns the process-wide Vertex AI provider,
+// creating it on first use. A failed creation is retried on the next call.
+func sharedVertexEmbeddingProvider() (*vertexEmbeddingProvider, error) {
+	vertexProviderMu.Lock()
+	defer vertexProviderMu.Unlock()
+	if vertexProvider != nil {
+		return vertexProvider, nil
+	}
+	p, err := newVertexEmbeddingProvider(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	vertexProvider = p
+	return p, nil
+}
+
+// newVertexEmbeddingProvider builds a provider from the environment:
+//
+//	PROJECT_ID        Google Cloud project (required)
+//	REGION            Vertex AI region (default us-central1)
+//	EMBEDDING_MODEL         embedding model (default text-embedding-004)
+//	IMAGE_EMBEDDING_MODEL   image embedding model (default multimodalembedding@001)
+func newVertexEmbeddingProvider(ctx context.Context) (*vertexEmbeddingProvider, error) {
+	projectID, err := projectIDFor("EMBEDDING_MODE=vertex")
+	if err != nil {
+		return nil, err
+	}
+	region := envOrDefault("REGION", "us-central1")
+	model := envOrDefault("EMBEDDING_MODEL", defaultEmbeddingModel)
+	imageModel := envOrDefault("IMAGE_EMBEDDING_MODEL", defaultImageEmbeddingModel)
+
+	client, err := aiplatform.NewPredictionClient(ctx, option.WithEndpoint(region+"-aiplatform.googleapis.com:443"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vertex AI client: %v", err)
+	}
+	log.Infof("Embedding texts with Vertex AI model %s in %s/%s", model, projectID, region)
+	return &vertexEmbeddingProvider{
+		client:        client,
+		endpoint:      fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", projectID, region, model),
+		imageEndpoint: fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", projectID, region, imageModel),
+	}, nil
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Embed implements EmbeddingProvider.
+func (v *vertexEmbeddingProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := v.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch implements EmbeddingProvider with a single predict call.
+func (v *vertexEmbeddingProvider) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	instances := make([]*structpb.Value, len(texts))
+	for i, text := range texts {
+		instances[i] = structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"content": structpb.NewStringValue(text),
+		}})
+	}
+	resp, err := v.client.Predict(ctx, &aiplatformpb.PredictRequest{
+		Endpoint:  v.endpoint,
+		Instances: instances,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Vertex AI predict failed: %v", err)
+	}
+	return vertexEmbeddings(resp.GetPredictions(), len(texts))
+}
+
+// vertexEmbeddings extracts the embedding values from text embedding model
+// predictions, which have the shape {"embeddings": {"values": [...]}}.
+func vertexEmbeddings(predictions []*structpb.Value, n int) ([][]float32, error) {
+	if len(predictions) != n {
+		return nil, fmt.Errorf("Vertex AI returned %d predictions for %d texts", len(predictions), n)
+	}
+	embeddings := make([][]float32, n)
+	for i, pred := range predictions {
+		values := pred.GetStructValue().GetFields()["embeddings"].GetStructValue().GetFields()["values"].GetListValue().GetValues()
+		if len(values) == 0 {
+			return nil, fmt.Errorf("Vertex AI prediction %d has no embedding values", i)
+		}
+		embedding := make([]float32, len(values))
+		for j, value := range values {
+			embedding[j] = float32(value.GetNumberValue())
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+// EmbedImage implements ImageEmbeddingProvider with the multimodal model,
+// asking for imageEmbeddingDimensions values.
+func (v *vertexEmbeddingProvider) EmbedImage(ctx context.Context, image []byte) ([]float32, error) {
+	instance := structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"image": structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"bytesBase64Encoded": structpb.NewStringValue(base64.StdEncoding.EncodeToString(image)),
+		}}),
+	}})
+	parameters := structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"dimension": structpb.NewNumberValue(imageEmbeddingDimensions),
+	}})
+	resp, err := v.client.Predict(ctx, &aiplatformpb.PredictRequest{
+		Endpoint:   v.imageEndpoint,
+		Instances:  []*structpb.Value{instance},
+		Parameters: parameters,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Vertex AI image predict failed: %v", err)
+	}
+	return vertexImageEmbedding(resp.GetPredictions())
+}
+
+// vertexImageEmbedding extracts the embedding from a multimodal embedding
+// model prediction, which has the shape {"imageEmbedding": [...]}.
+func vertexImageEmbedding(predictions []*structpb.Value) ([]float32, error) {
+	if len(predictions) != 1 {
+		return nil, fmt.Errorf("Vertex AI returned %d predictions for one image", len(predictions))
+	}
+	values := predictions[0].GetStructValue().GetFields()["imageEmbedding"].GetListValue().GetValues()
+	if len(values) != imageEmbeddingDimensions {
+		return nil, fmt.Errorf("%w: Vertex AI returned an image embedding of %d values, want %d", errEmbeddingDimensions, len(values), imageEmbeddingDimensions)
+	}
+	embedding := make([]float32, len(values))
+	for i, value := range values {
+		embedding[i] = float32(value.GetNumberValue())
+	}
+	return embedding, nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// rankingExperiment splits semantic search traffic between ranking variants,
+// so their conversion can be compared. Users, or sessions for anonymous
+// shoppers, are assigned by hashing them with the experiment name, so each
+// keeps seeing the same variant until the experiment is renamed.
+type rankingExperiment struct {
+	Name     string               `json:"name"`
+	Variants []*experimentVariant `json:"variants"`
+}
+
+// experimentVariant overrides the server's ranking settings for its share of
+// traffic. Unset fields keep the server settings.
+type experimentVariant struct {
+	ID string `json:"id"`
+	// Percent is the share of users assigned to the variant.
+	Percent int `json:"percent"`
+	// Weights replace the hybrid search weights, unless the request has its
+	// own.
+	Weights *struct {
+		Combined   float64 `json:"combined"`
+		TargetTags float64 `json:"targetTags"`
+		UseContext float64 `json:"useContext"`
+	} `json:"weights,omitempty"`
+	// Fusion is the keyword fusion mode: off (pure vector), rrf or weighted.
+	Fusion string `json:"fusion,omitempty"`
+	// PopularityWeight replaces SEARCH_POPULARITY_WEIGHT.
+	PopularityWeight *float64 `json:"popularityWeight,omitempty"`
+
+	// tag identifies the variant in responses: "<experiment>/<id>".
+	tag     string
+	weights *searchWeights
+}
+
+var (
+	experiment atomic.Pointer[rankingExperiment]
+
+	// experimentReload asks the watcher started by initExperiment to re-read
+	// the experiment file right away.
+	experimentReload = make(chan struct{}, 1)
+)
+
+// parseExperiment reads and validates an experiment definition. Variant
+// shares may add up to less than 100; the remaining traffic is not in the
+// experiment.
+func parseExperiment(data []byte) (*rankingExperiment, error) {
+	var e rankingExperiment
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse experiment: %v", err)
+	}
+	if strings.TrimSpace(e.Name) == "" {
+		return nil, fmt.Errorf("experiment name is required")
+	}
+	total := 0
+	seen := map[string]bool{}
+	for _, v := range e.Variants {
+		switch {
+		case strings.TrimSpace(v.ID) == "":
+			return nil, fmt.Errorf("variant id is required")
+		case seen[v.ID]:
+			return nil, fmt.Errorf("duplicate variant %q", v.ID)
+		case v.Percent < 0:
+			return nil, fmt.Errorf("variant %q: percent must not be negative", v.ID)
+		}
+		seen[v.ID] = true
+		total += v.Percent
+		switch v.Fusion {
+		case "", fusionOff, fusionRRF, fusionWeighted:
+		default:
+			return nil, fmt.Errorf("variant %q: unknown fusion %q (want off, rrf or weighted)", v.ID, v.Fusion)
+		}
+		if w := v.PopularityWeight; w != nil && (*w < 0 || *w >= 1) {
+			return nil, fmt.Errorf("variant %q: popularityWeight must be in [0, 1)", v.ID)
+		}
+		if v.Weights != nil {
+			w, err := searchWeights{Combined: v.Weights.Combined, TargetTags: v.Weights.TargetTags, UseContext: v.Weights.UseContext}.normalize()
+			if err != nil {
+				return nil, fmt.Errorf("variant %q: %v", v.ID, err)
+			}
+			v.weights = &w
+		}
+		v.tag = e.Name + "/" + v.ID
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("variant percents add up to %d, more than 100", total)
+	}
+	return &e, nil
+}
+
+// assign returns the variant of the request's user, or of its session when
+// it has no user. It is nil without an experiment, for requests with
+// neither, and for users outside the experiment's share.
+func (e *rankingExperiment) assign(req *pb.SemanticSearchRequest) *experimentVariant {
+	if e == nil {
+		return nil
+	}
+	key := req.GetUserId()
+	if key == "" {
+		key = req.GetSessionId()
+	}
+	if key == "" {
+		return nil
+	}
+	bucket := rolloutBucket(e.Name, key)
+	for _, v := range e.Variants {
+		if bucket < v.Percent {
+			return v
+		}
+		bucket -= v.Percent
+	}
+	return nil
+}
+
+// searchWeights returns the weights of a request assigned to v: its own, the
+// variant's, or the server's.
+func (v *experimentVariant) searchWeights(req *pb.SemanticSearchRequest) (searchWeights, error) {
+	if req.GetWeights() == nil && v != nil && v.weights != nil {
+		return *v.weights, nil
+	}
+	return requestSearchWeights(req)
+}
+
+// fusion returns the keyword fusion of requests assigned to v.
+func (v *experimentVariant) fusion() keywordFusion {
+	f := searchFusion
+	if v != nil && v.Fusion != "" {
+		f.mode = v.Fusion
+	}
+	return f
+}
+
+// popularity returns the popularity settings of requests assigned to v.
+func (v *experimentVariant) popularity() popularitySettings {
+	p := popularity
+	if v != nil && v.PopularityWeight != nil {
+		p.weight = *v.PopularityWeight
+	}
+	return p
+}
+
+// initExperiment loads the experiment in RANKING_EXPERIMENT_FILE and keeps
+// it in sync with the file, like initSynonyms. Without the variable there is
+// no experiment.
+func initExperiment() error {
+	path := os.Getenv("RANKING_EXPERIMENT_FILE")
+	if path == "" {
+		return nil
+	}
+	refresh := 30 * time.Second
+	if s := os.Getenv("RANKING_EXPERIMENT_REFRESH_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("failed to parse RANKING_EXPERIMENT_REFRESH_INTERVAL (%s) as a positive time.Duration", s)
+		}
+		refresh = v
+	}
+	watchConfigFile("ranking experiment", path, refresh, experimentReload, loadExperiment)
+	return nil
+}
+
+// reloadExperiment triggers an immediate re-read of RANKING_EXPERIMENT_FILE.
+// It never blocks; a reload that is already pending absorbs the request.
+func reloadExperiment() {
+	if os.Getenv("RANKING_EXPERIMENT_FILE") == "" {
+		return
+	}
+	select {
+	case experimentReload <- struct{}{}:
+	default:
+	}
+}
+
+// loadExperiment parses the experiment file and swaps in the experiment. The
+// loaded experiment is kept if the file is invalid.
+func loadExperiment(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	e, err := parseExperiment(data)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	experiment.Store(e)
+	log.Infof("loaded ranking experiment %q with %d variants from %s", e.Name, len(e.Variants), path)
+	return fi.ModTime(), nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const testExperiment = `{
+	"name": "ranking-test",
+	"variants": [
+		{"id": "control", "percent": 50},
+		{"id": "rrf", "percent": 25, "fusion": "rrf", "popularityWeight": 0.2},
+		{"id": "tags", "percent": 15, "weights": {"combined": 2, "targetTags": 2}}
+	]
+}`
+
+func TestParseExperimentErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"variants": [{"id": "a", "percent": 10}]}`,
+		`{"name": "x", "variants": [{"percent": 10}]}`,
+		`{"name": "x", "variants": [{"id": "a", "percent": 10}, {"id": "a", "percent": 10}]}`,
+		`{"name": "x", "variants": [{"id": "a", "percent": -1}]}`,
+		`{"name": "x", "variants": [{"id": "a", "percent": 60}, {"id": "b", "percent": 50}]}`,
+		`{"name": "x", "variants": [{"id": "a", "percent": 10, "fusion": "bm25"}]}`,
+		`{"name": "x", "variants": [{"id": "a", "percent": 10, "popularityWeight": 1}]}`,
+		`{"name": "x", "variants": [{"id": "a", "percent": 10, "weights": {"combined": 0}}]}`,
+	} {
+		if _, err := parseExperiment([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestExperimentAssign(t *testing.T) {
+	e, err := parseExperiment([]byte(testExperiment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var none *rankingExperiment
+	if v := none.assign(&pb.SemanticSearchRequest{UserId: "u1"}); v != nil {
+		t.Errorf("without an experiment: got %s", v.tag)
+	}
+	if v := e.assign(&pb.SemanticSearchRequest{}); v != nil {
+		t.Errorf("without a user or session: got %s", v.tag)
+	}
+
+	counts := map[string]int{}
+	const users = 20000
+	for i := 0; i < users; i++ {
+		req := &pb.SemanticSearchRequest{UserId: fmt.Sprintf("user-%d", i), SessionId: "shared"}
+		v := e.assign(req)
+		if again := e.assign(req); again != v {
+			t.Fatalf("user-%d was assigned to two variants", i)
+		}
+		tag := "none"
+		if v != nil {
+			tag = v.tag
+		}
+		counts[tag]++
+	}
+	for tag, percent := range map[string]int{
+		"ranking-test/control": 50, "ranking-test/rrf": 25, "ranking-test/tags": 15, "none": 10,
+	} {
+		if got := float64(counts[tag]) * 100 / users; math.Abs(got-float64(percent)) > 2 {
+			t.Errorf("%s got %.1f%% of users, want about %d%%", tag, got, percent)
+		}
+	}
+
+	// Anonymous shoppers are assigned by session.
+	session := &pb.SemanticSearchRequest{SessionId: "s1"}
+	if e.assign(session) != e.assign(&pb.SemanticSearchRequest{UserId: "s1"}) {
+		t.Error("a session was not assigned like a user with the same key")
+	}
+}
+
+func TestExperimentVariantOverrides(t *testing.T) {
+	e, err := parseExperiment([]byte(testExperiment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	control, rrf, tags := e.Variants[0], e.Variants[1], e.Variants[2]
+
+	if got := rrf.fusion().mode; got != fusionRRF {
+		t.Errorf("rrf fusion = %s, want %s", got, fusionRRF)
+	}
+	if got, want := control.fusion(), searchFusion; got != want {
+		t.Errorf("control fusion = %v, want the server's %v", got, want)
+	}
+	if got := rrf.popularity().weight; got != 0.2 {
+		t.Errorf("rrf popularity weight = %v, want 0.2", got)
+	}
+
+	var none *experimentVariant
+	req := &pb.SemanticSearchRequest{}
+	for _, tc := range []struct {
+		variant *experimentVariant
+		req     *pb.SemanticSearchRequest
+		want    searchWeights
+	}{
+		{none, req, hybridWeights},
+		{control, req, hybridWeights},
+		{tags, req, searchWeights{Combined: 0.5, TargetTags: 0.5}},
+		{tags, &pb.SemanticSearchRequest{Weights: &pb.HybridSearchWeights{UseContext: 1}}, searchWeights{UseContext: 1}},
+	} {
+		if got, err := tc.variant.searchWeights(tc.req); err != nil || got != tc.want {
+			t.Errorf("searchWeights: got %v, %v; want %v", got, err, tc.want)
+		}
+	}
+}
+
+func TestSemanticSearchTagsExperimentVariant(t *testing.T) {
+	defer experiment.Store(experiment.Load())
+	defer func(s *searchEventSink) { searchEvents = s }(searchEvents)
+	searchEvents = &searchEventSink{events: make(chan searchEvent, 10)}
+
+	path := filepath.Join(t.TempDir(), "experiment.json")
+	if err := os.WriteFile(path, []byte(`{"name": "all", "variants": [{"id": "rrf", "percent": 100, "fusion": "rrf"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadExperiment(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		req  *pb.SemanticSearchRequest
+		want string
+	}{
+		{&pb.SemanticSearchRequest{Query: "alpha", SessionId: "s1"}, "all/rrf"},
+		{&pb.SemanticSearchRequest{Query: "alpha"}, ""},
+	} {
+		resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(), tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ExperimentVariant != tc.want {
+			t.Errorf("got variant %q, want %q", resp.ExperimentVariant, tc.want)
+		}
+		if e := <-searchEvents.events; e.variant != tc.want {
+			t.Errorf("got event variant %q, want %q", e.variant, tc.want)
+		}
+	}
+}
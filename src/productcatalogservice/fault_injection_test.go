@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFaultInjectorFromEnv(t *testing.T) {
+	t.Setenv("EXTRA_LATENCY", "10ms")
+	t.Setenv("FAULT_LATENCY_DISTRIBUTION", "uniform")
+	t.Setenv("FAULT_ERROR_RATE", "0.5")
+	t.Setenv("FAULT_ERROR_CODE", "resource_exhausted")
+	t.Setenv("FAULT_METHODS", "GetProduct, SearchProducts")
+
+	f, err := newFaultInjectorFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.errorCode, codes.ResourceExhausted; got != want {
+		t.Errorf("errorCode: got %s, want %s", got, want)
+	}
+	if !f.methods["GetProduct"] || !f.methods["SearchProducts"] || len(f.methods) != 2 {
+		t.Errorf("methods: got %v", f.methods)
+	}
+
+	t.Setenv("FAULT_ERROR_RATE", "2")
+	if _, err := newFaultInjectorFromEnv(); err == nil {
+		t.Error("expected error for FAULT_ERROR_RATE > 1")
+	}
+}
+
+func TestFaultInjectorInterceptor(t *testing.T) {
+	f := &faultInjector{
+		errorRate: 1,
+		errorCode: codes.Unavailable,
+		methods:   map[string]bool{"GetProduct": true},
+		rand:      func() float64 { return 0 },
+	}
+	intercept := f.unaryInterceptor("hipstershop.ProductCatalogService")
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	tests := []struct {
+		method string
+		want   codes.Code
+	}{
+		{"/hipstershop.ProductCatalogService/GetProduct", codes.Unavailable},
+		{"/hipstershop.ProductCatalogService/ListProducts", codes.OK},
+		{"/grpc.health.v1.Health/Check", codes.OK},
+	}
+	for _, tt := range tests {
+		_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.method, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+)
+
+const (
+	// flagSemanticSearch gates the vector search path of SemanticSearchProducts.
+	flagSemanticSearch = "semantic-search"
+)
+
+var featureFlags = openfeature.NewClient("productcatalogservice")
+
+// featureFlagsReload asks the watcher started by initFeatureFlags to re-read
+// the flag file right away instead of waiting for the next refresh.
+var featureFlagsReload = make(chan struct{}, 1)
+
+// flagDefinition is the on-disk representation of a boolean feature flag.
+// RolloutPercent, when set, enables the flag only for that share of
+// targeting keys (e.g. users or queries), bucketed deterministically.
+type flagDefinition struct {
+	Enabled        bool `json:"enabled"`
+	RolloutPercent *int `json:"rolloutPercent,omitempty"`
+}
+
+// initFeatureFlags installs an OpenFeature provider backed by the JSON file
+// named in FEATURE_FLAGS_FILE and keeps it in sync with the file, so flags
+// can be flipped (e.g. via a ConfigMap update) without a redeploy. When the
+// variable is unset every flag evaluates to its code default.
+//
+// Sending SIGHUP reloads the file immediately, which makes a flag such as
+// semantic-search usable as an incident kill switch.
+func initFeatureFlags() {
+	path := os.Getenv("FEATURE_FLAGS_FILE")
+	if path == "" {
+		log.Info("FEATURE_FLAGS_FILE not set, using default feature flag values")
+		return
+	}
+
+	refresh := 30 * time.Second
+	if s := os.Getenv("FEATURE_FLAGS_REFRESH_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			log.Fatalf("failed to parse FEATURE_FLAGS_REFRESH_INTERVAL (%s) as time.Duration: %+v", s, err)
+		}
+		refresh = v
+	}
+
+	watchConfigFile("feature flags", path, refresh, featureFlagsReload, loadFeatureFlags)
+}
+
+// watchConfigFile loads the named config file with load and reloads it
+// whenever its modification time advances, checking every refresh, or when
+// reload receives. load keeps the loaded config if the file is invalid.
+func watchConfigFile(name, path string, refresh time.Duration, reload <-chan struct{}, load func(path string) (time.Time, error)) {
+	modTime, err := load(path)
+	if err != nil {
+		log.Warnf("failed to load %s from %s: %v", name, path, err)
+	}
+	go func() {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fi, err := os.Stat(path)
+				if err != nil || !fi.ModTime().After(modTime) {
+					continue
+				}
+			case <-reload:
+			}
+			var err error
+			if modTime, err = load(path); err != nil {
+				log.Warnf("failed to reload %s from %s, keeping the loaded ones: %v", name, path, err)
+			}
+		}
+	}()
+}
+
+// reloadFeatureFlags triggers an immediate re-read of FEATURE_FLAGS_FILE. It
+// never blocks; a reload that is already pending absorbs the request.
+func reloadFeatureFlags() {
+	if os.Getenv("FEATURE_FLAGS_FILE") == "" {
+		log.Warn("FEATURE_FLAGS_FILE not set, nothing to reload")
+		return
+	}
+	select {
+	case featureFlagsReload <- struct{}{}:
+	default:
+	}
+}
+
+// loadFeatureFlags parses the flag file and swaps in a fresh provider.
+func loadFeatureFlags(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	flags, err := parseFeatureFlags(data)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	if err := openfeature.SetProvider(memprovider.NewInMemoryProvider(flags)); err != nil {
+		return fi.ModTime(), err
+	}
+	log.Infof("loaded %d feature flags from %s", len(flags), path)
+	return fi.ModTime(), nil
+}
+
+// parseFeatureFlags converts the JSON flag file into in-memory provider flags.
+func parseFeatureFlags(data []byte) (map[string]memprovider.InMemoryFlag, error) {
+	var defs map[string]flagDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse feature flags: %v", err)
+	}
+
+	flags := make(map[string]memprovider.InMemoryFlag, len(defs))
+	for key, def := range defs {
+		flag := memprovider.InMemoryFlag{
+			Key:            key,
+			State:          memprovider.Enabled,
+			DefaultVariant: "off",
+			Variants:       map[string]interface{}{"on": true, "off": false},
+		}
+		if def.Enabled {
+			flag.DefaultVariant = "on"
+		}
+		if def.Enabled && def.RolloutPercent != nil {
+			percent := *def.RolloutPercent
+			if percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("flag %q: rolloutPercent must be between 0 and 100, got %d", key, percent)
+			}
+			evaluator := func(this memprovider.InMemoryFlag, evalCtx openfeature.FlattenedContext) (interface{}, openfeature.ProviderResolutionDetail) {
+				targetingKey, _ := evalCtx[openfeature.TargetingKey].(string)
+				variant := "off"
+				if rolloutBucket(this.Key, targetingKey) < percent {
+					variant = "on"
+				}
+				return this.Variants[variant], openfeature.ProviderResolutionDetail{
+					Reason:  openfeature.TargetingMatchReason,
+					Variant: variant,
+				}
+			}
+			flag.ContextEvaluator = &evaluator
+		}
+		flags[key] = flag
+	}
+	return flags, nil
+}
+
+// rolloutBucket deterministically maps a targeting key to a bucket in [0, 100).
+func rolloutBucket(flagKey, targetingKey string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flagKey + "/" + targetingKey))
+	return int(h.Sum32() % 100)
+}
+
+// flagEnabled evaluates a boolean flag for the given targeting key, returning
+// defaultValue if no provider is configured or the flag is unknown.
+func flagEnabled(ctx context.Context, flag, targetingKey string, defaultValue bool) bool {
+	return featureFlags.Boolean(ctx, flag, defaultValue, openfeature.NewEvaluationContext(targetingKey, nil))
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+)
+
+func TestParseFeatureFlags(t *testing.T) {
+	flags, err := parseFeatureFlags([]byte(`{
+		"on-flag": {"enabled": true},
+		"off-flag": {"enabled": false},
+		"half-flag": {"enabled": true, "rolloutPercent": 50}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := openfeature.SetProviderAndWait(memprovider.NewInMemoryProvider(flags)); err != nil {
+		t.Fatal(err)
+	}
+	defer openfeature.SetProviderAndWait(openfeature.NoopProvider{})
+
+	ctx := context.Background()
+	if !flagEnabled(ctx, "on-flag", "user", false) {
+		t.Error("on-flag: got disabled, want enabled")
+	}
+	if flagEnabled(ctx, "off-flag", "user", true) {
+		t.Error("off-flag: got enabled, want disabled")
+	}
+	if !flagEnabled(ctx, "unknown-flag", "user", true) {
+		t.Error("unknown-flag: got disabled, want default value")
+	}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		if flagEnabled(ctx, "half-flag", fmt.Sprintf("user-%d", i), false) {
+			enabled++
+		}
+	}
+	if enabled < 400 || enabled > 600 {
+		t.Errorf("half-flag: enabled for %d of 1000 keys, want roughly 500", enabled)
+	}
+}
+
+func TestParseFeatureFlagsInvalidRollout(t *testing.T) {
+	if _, err := parseFeatureFlags([]byte(`{"bad": {"enabled": true, "rolloutPercent": 150}}`)); err == nil {
+		t.Error("expected error for rolloutPercent > 100")
+	}
+}
+
+func TestReloadFeatureFlagsOnDemand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	write := func(enabled bool) {
+		data := fmt.Sprintf(`{"semantic-search": {"enabled": %t}}`, enabled)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(true)
+	t.Setenv("FEATURE_FLAGS_FILE", path)
+	t.Setenv("FEATURE_FLAGS_REFRESH_INTERVAL", "1h")
+	t.Cleanup(func() { openfeature.SetProvider(openfeature.NoopProvider{}) })
+
+	initFeatureFlags()
+	ctx := context.Background()
+	if !flagEnabled(ctx, flagSemanticSearch, "q", false) {
+		t.Fatal("expected semantic-search to start enabled")
+	}
+
+	// The refresh interval is an hour, so only an explicit reload can pick
+	// up the change within the test.
+	write(false)
+	reloadFeatureFlags()
+	deadline := time.Now().Add(2 * time.Second)
+	for flagEnabled(ctx, flagSemanticSearch, "q", true) {
+		if time.Now().After(deadline) {
+			t.Fatal("semantic-search still enabled after reloadFeatureFlags")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -23,6 +23,8 @@ package hipstershop
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -35,6 +37,470 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Document formats of ImportProducts and ExportProducts.
+type CatalogFormat int32
+
+const (
+	// The products.json format: {"products": [...]}.
+	CatalogFormat_CATALOG_FORMAT_JSON CatalogFormat = 0
+	// A header row naming the columns, then one product per row.
+	CatalogFormat_CATALOG_FORMAT_CSV CatalogFormat = 1
+)
+
+// Enum value maps for CatalogFormat.
+var (
+	CatalogFormat_name = map[int32]string{
+		0: "CATALOG_FORMAT_JSON",
+		1: "CATALOG_FORMAT_CSV",
+	}
+	CatalogFormat_value = map[string]int32{
+		"CATALOG_FORMAT_JSON": 0,
+		"CATALOG_FORMAT_CSV":  1,
+	}
+)
+
+func (x CatalogFormat) Enum() *CatalogFormat {
+	p := new(CatalogFormat)
+	*p = x
+	return p
+}
+
+func (x CatalogFormat) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CatalogFormat) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[0].Descriptor()
+}
+
+func (CatalogFormat) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[0]
+}
+
+func (x CatalogFormat) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CatalogFormat.Descriptor instead.
+func (CatalogFormat) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{0}
+}
+
+// Lifecycle of a product. Only active products are listed and searched
+// by default; GetProduct returns products in every status, so past
+// orders keep resolving their items.
+type Product_Status int32
+
+const (
+	Product_ACTIVE Product_Status = 0
+	// No longer sold.
+	Product_DISCONTINUED Product_Status = 1
+	// Temporarily withdrawn, for example before a launch.
+	Product_HIDDEN Product_Status = 2
+)
+
+// Enum value maps for Product_Status.
+var (
+	Product_Status_name = map[int32]string{
+		0: "ACTIVE",
+		1: "DISCONTINUED",
+		2: "HIDDEN",
+	}
+	Product_Status_value = map[string]int32{
+		"ACTIVE":       0,
+		"DISCONTINUED": 1,
+		"HIDDEN":       2,
+	}
+)
+
+func (x Product_Status) Enum() *Product_Status {
+	p := new(Product_Status)
+	*p = x
+	return p
+}
+
+func (x Product_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Product_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[1].Descriptor()
+}
+
+func (Product_Status) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[1]
+}
+
+func (x Product_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Product_Status.Descriptor instead.
+func (Product_Status) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{8, 0}
+}
+
+// Order of the results. Results are the most relevant matches in every
+// order; the others only rearrange them.
+type SemanticSearchRequest_SortOrder int32
+
+const (
+	SemanticSearchRequest_RELEVANCE  SemanticSearchRequest_SortOrder = 0
+	SemanticSearchRequest_PRICE_ASC  SemanticSearchRequest_SortOrder = 1
+	SemanticSearchRequest_PRICE_DESC SemanticSearchRequest_SortOrder = 2
+	SemanticSearchRequest_NEWEST     SemanticSearchRequest_SortOrder = 3
+)
+
+// Enum value maps for SemanticSearchRequest_SortOrder.
+var (
+	SemanticSearchRequest_SortOrder_name = map[int32]string{
+		0: "RELEVANCE",
+		1: "PRICE_ASC",
+		2: "PRICE_DESC",
+		3: "NEWEST",
+	}
+	SemanticSearchRequest_SortOrder_value = map[string]int32{
+		"RELEVANCE":  0,
+		"PRICE_ASC":  1,
+		"PRICE_DESC": 2,
+		"NEWEST":     3,
+	}
+)
+
+func (x SemanticSearchRequest_SortOrder) Enum() *SemanticSearchRequest_SortOrder {
+	p := new(SemanticSearchRequest_SortOrder)
+	*p = x
+	return p
+}
+
+func (x SemanticSearchRequest_SortOrder) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SemanticSearchRequest_SortOrder) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[2].Descriptor()
+}
+
+func (SemanticSearchRequest_SortOrder) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[2]
+}
+
+func (x SemanticSearchRequest_SortOrder) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SemanticSearchRequest_SortOrder.Descriptor instead.
+func (SemanticSearchRequest_SortOrder) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{22, 0}
+}
+
+type ProductInteraction_Kind int32
+
+const (
+	ProductInteraction_VIEW        ProductInteraction_Kind = 0
+	ProductInteraction_ADD_TO_CART ProductInteraction_Kind = 1
+	ProductInteraction_PURCHASE    ProductInteraction_Kind = 2
+)
+
+// Enum value maps for ProductInteraction_Kind.
+var (
+	ProductInteraction_Kind_name = map[int32]string{
+		0: "VIEW",
+		1: "ADD_TO_CART",
+		2: "PURCHASE",
+	}
+	ProductInteraction_Kind_value = map[string]int32{
+		"VIEW":        0,
+		"ADD_TO_CART": 1,
+		"PURCHASE":    2,
+	}
+)
+
+func (x ProductInteraction_Kind) Enum() *ProductInteraction_Kind {
+	p := new(ProductInteraction_Kind)
+	*p = x
+	return p
+}
+
+func (x ProductInteraction_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProductInteraction_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[3].Descriptor()
+}
+
+func (ProductInteraction_Kind) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[3]
+}
+
+func (x ProductInteraction_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProductInteraction_Kind.Descriptor instead.
+func (ProductInteraction_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{24, 0}
+}
+
+type Suggestion_Kind int32
+
+const (
+	Suggestion_PRODUCT  Suggestion_Kind = 0
+	Suggestion_CATEGORY Suggestion_Kind = 1
+)
+
+// Enum value maps for Suggestion_Kind.
+var (
+	Suggestion_Kind_name = map[int32]string{
+		0: "PRODUCT",
+		1: "CATEGORY",
+	}
+	Suggestion_Kind_value = map[string]int32{
+		"PRODUCT":  0,
+		"CATEGORY": 1,
+	}
+)
+
+func (x Suggestion_Kind) Enum() *Suggestion_Kind {
+	p := new(Suggestion_Kind)
+	*p = x
+	return p
+}
+
+func (x Suggestion_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Suggestion_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[4].Descriptor()
+}
+
+func (Suggestion_Kind) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[4]
+}
+
+func (x Suggestion_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Suggestion_Kind.Descriptor instead.
+func (Suggestion_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{27, 0}
+}
+
+type MerchandisingRule_Action int32
+
+const (
+	MerchandisingRule_ACTION_UNSPECIFIED MerchandisingRule_Action = 0
+	// Puts the product first, adding it to the results if it matches
+	// the request filters but was not found. Product targets only.
+	MerchandisingRule_PIN MerchandisingRule_Action = 1
+	// Moves the products ahead of the other results.
+	MerchandisingRule_BOOST MerchandisingRule_Action = 2
+	// Moves the products behind the other results. Burying wins over
+	// pinning and boosting.
+	MerchandisingRule_BURY MerchandisingRule_Action = 3
+)
+
+// Enum value maps for MerchandisingRule_Action.
+var (
+	MerchandisingRule_Action_name = map[int32]string{
+		0: "ACTION_UNSPECIFIED",
+		1: "PIN",
+		2: "BOOST",
+		3: "BURY",
+	}
+	MerchandisingRule_Action_value = map[string]int32{
+		"ACTION_UNSPECIFIED": 0,
+		"PIN":                1,
+		"BOOST":              2,
+		"BURY":               3,
+	}
+)
+
+func (x MerchandisingRule_Action) Enum() *MerchandisingRule_Action {
+	p := new(MerchandisingRule_Action)
+	*p = x
+	return p
+}
+
+func (x MerchandisingRule_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MerchandisingRule_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[5].Descriptor()
+}
+
+func (MerchandisingRule_Action) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[5]
+}
+
+func (x MerchandisingRule_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MerchandisingRule_Action.Descriptor instead.
+func (MerchandisingRule_Action) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{38, 0}
+}
+
+type ProductChanged_Change int32
+
+const (
+	ProductChanged_CHANGE_UNSPECIFIED ProductChanged_Change = 0
+	ProductChanged_CREATED            ProductChanged_Change = 1
+	ProductChanged_UPDATED            ProductChanged_Change = 2
+	// Marked discontinued; the product stays readable.
+	ProductChanged_DISCONTINUED ProductChanged_Change = 3
+	// Removed with its variants.
+	ProductChanged_PURGED ProductChanged_Change = 4
+	// The stock of the product or of one of its variants changed.
+	ProductChanged_STOCK_UPDATED ProductChanged_Change = 5
+)
+
+// Enum value maps for ProductChanged_Change.
+var (
+	ProductChanged_Change_name = map[int32]string{
+		0: "CHANGE_UNSPECIFIED",
+		1: "CREATED",
+		2: "UPDATED",
+		3: "DISCONTINUED",
+		4: "PURGED",
+		5: "STOCK_UPDATED",
+	}
+	ProductChanged_Change_value = map[string]int32{
+		"CHANGE_UNSPECIFIED": 0,
+		"CREATED":            1,
+		"UPDATED":            2,
+		"DISCONTINUED":       3,
+		"PURGED":             4,
+		"STOCK_UPDATED":      5,
+	}
+)
+
+func (x ProductChanged_Change) Enum() *ProductChanged_Change {
+	p := new(ProductChanged_Change)
+	*p = x
+	return p
+}
+
+func (x ProductChanged_Change) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProductChanged_Change) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[6].Descriptor()
+}
+
+func (ProductChanged_Change) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[6]
+}
+
+func (x ProductChanged_Change) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProductChanged_Change.Descriptor instead.
+func (ProductChanged_Change) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{49, 0}
+}
+
+type ExportUserDataRequest_Format int32
+
+const (
+	ExportUserDataRequest_JSON ExportUserDataRequest_Format = 0
+	// One row per order item.
+	ExportUserDataRequest_CSV ExportUserDataRequest_Format = 1
+)
+
+// Enum value maps for ExportUserDataRequest_Format.
+var (
+	ExportUserDataRequest_Format_name = map[int32]string{
+		0: "JSON",
+		1: "CSV",
+	}
+	ExportUserDataRequest_Format_value = map[string]int32{
+		"JSON": 0,
+		"CSV":  1,
+	}
+)
+
+func (x ExportUserDataRequest_Format) Enum() *ExportUserDataRequest_Format {
+	p := new(ExportUserDataRequest_Format)
+	*p = x
+	return p
+}
+
+func (x ExportUserDataRequest_Format) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ExportUserDataRequest_Format) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[7].Descriptor()
+}
+
+func (ExportUserDataRequest_Format) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[7]
+}
+
+func (x ExportUserDataRequest_Format) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ExportUserDataRequest_Format.Descriptor instead.
+func (ExportUserDataRequest_Format) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{80, 0}
+}
+
+type SearchOrdersRequest_SortBy int32
+
+const (
+	SearchOrdersRequest_ORDER_TIME SearchOrdersRequest_SortBy = 0
+	// By amount; set min_total or max_total to compare one currency.
+	SearchOrdersRequest_TOTAL SearchOrdersRequest_SortBy = 1
+)
+
+// Enum value maps for SearchOrdersRequest_SortBy.
+var (
+	SearchOrdersRequest_SortBy_name = map[int32]string{
+		0: "ORDER_TIME",
+		1: "TOTAL",
+	}
+	SearchOrdersRequest_SortBy_value = map[string]int32{
+		"ORDER_TIME": 0,
+		"TOTAL":      1,
+	}
+)
+
+func (x SearchOrdersRequest_SortBy) Enum() *SearchOrdersRequest_SortBy {
+	p := new(SearchOrdersRequest_SortBy)
+	*p = x
+	return p
+}
+
+func (x SearchOrdersRequest_SortBy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SearchOrdersRequest_SortBy) Descriptor() protoreflect.EnumDescriptor {
+	return file_demo_proto_enumTypes[8].Descriptor()
+}
+
+func (SearchOrdersRequest_SortBy) Type() protoreflect.EnumType {
+	return &file_demo_proto_enumTypes[8]
+}
+
+func (x SearchOrdersRequest_SortBy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SearchOrdersRequest_SortBy.Descriptor instead.
+func (SearchOrdersRequest_SortBy) EnumDescriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{99, 0}
+}
+
 type CartItem struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	ProductId     string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
@@ -422,8 +888,20 @@ type Product struct {
 	// other related products.
 	Categories []string `protobuf:"bytes,6,rep,name=categories,proto3" json:"categories,omitempty"`
 	// Semantic search tags
-	TargetTags    []string `protobuf:"bytes,7,rep,name=target_tags,json=targetTags,proto3" json:"target_tags,omitempty"`
-	UseContext    []string `protobuf:"bytes,8,rep,name=use_context,json=useContext,proto3" json:"use_context,omitempty"`
+	TargetTags []string `protobuf:"bytes,7,rep,name=target_tags,json=targetTags,proto3" json:"target_tags,omitempty"`
+	UseContext []string `protobuf:"bytes,8,rep,name=use_context,json=useContext,proto3" json:"use_context,omitempty"`
+	// Purchasable variants of the product, such as sizes and colors, each
+	// with its own SKU. Products sold as a single item have none.
+	Variants []*ProductVariant `protobuf:"bytes,9,rep,name=variants,proto3" json:"variants,omitempty"`
+	// Summary of variants, set when the product has any. Search results
+	// carry only the summary; GetProduct and ListProducts also return the
+	// variants.
+	VariantSummary *ProductVariantSummary `protobuf:"bytes,10,opt,name=variant_summary,json=variantSummary,proto3" json:"variant_summary,omitempty"`
+	Status         Product_Status         `protobuf:"varint,11,opt,name=status,proto3,enum=hipstershop.Product_Status" json:"status,omitempty"`
+	// Units available, unset when stock is not tracked. Products with
+	// variants track stock per variant instead and are in stock while any
+	// variant is.
+	Stock         *int32 `protobuf:"varint,12,opt,name=stock,proto3,oneof" json:"stock,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -514,27 +992,63 @@ func (x *Product) GetUseContext() []string {
 	return nil
 }
 
-type ListProductsResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Products      []*Product             `protobuf:"bytes,1,rep,name=products,proto3" json:"products,omitempty"`
+func (x *Product) GetVariants() []*ProductVariant {
+	if x != nil {
+		return x.Variants
+	}
+	return nil
+}
+
+func (x *Product) GetVariantSummary() *ProductVariantSummary {
+	if x != nil {
+		return x.VariantSummary
+	}
+	return nil
+}
+
+func (x *Product) GetStatus() Product_Status {
+	if x != nil {
+		return x.Status
+	}
+	return Product_ACTIVE
+}
+
+func (x *Product) GetStock() int32 {
+	if x != nil && x.Stock != nil {
+		return *x.Stock
+	}
+	return 0
+}
+
+// A node of the category tree.
+type Category struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Lowercase identifier, as used in Product.categories.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Display name.
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Subcategories, ordered by name ignoring case.
+	Children []*Category `protobuf:"bytes,3,rep,name=children,proto3" json:"children,omitempty"`
+	// Products in this category or any of its subcategories.
+	ProductCount  int32 `protobuf:"varint,4,opt,name=product_count,json=productCount,proto3" json:"product_count,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ListProductsResponse) Reset() {
-	*x = ListProductsResponse{}
+func (x *Category) Reset() {
+	*x = Category{}
 	mi := &file_demo_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ListProductsResponse) String() string {
+func (x *Category) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListProductsResponse) ProtoMessage() {}
+func (*Category) ProtoMessage() {}
 
-func (x *ListProductsResponse) ProtoReflect() protoreflect.Message {
+func (x *Category) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -546,39 +1060,63 @@ func (x *ListProductsResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListProductsResponse.ProtoReflect.Descriptor instead.
-func (*ListProductsResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use Category.ProtoReflect.Descriptor instead.
+func (*Category) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{9}
 }
 
-func (x *ListProductsResponse) GetProducts() []*Product {
+func (x *Category) GetId() string {
 	if x != nil {
-		return x.Products
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Category) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Category) GetChildren() []*Category {
+	if x != nil {
+		return x.Children
 	}
 	return nil
 }
 
-type GetProductRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+func (x *Category) GetProductCount() int32 {
+	if x != nil {
+		return x.ProductCount
+	}
+	return 0
+}
+
+type ListCategoriesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Top-level categories, ordered by name ignoring case. Product
+	// categories that are not in the tree are listed here too, without
+	// children.
+	Categories    []*Category `protobuf:"bytes,1,rep,name=categories,proto3" json:"categories,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetProductRequest) Reset() {
-	*x = GetProductRequest{}
+func (x *ListCategoriesResponse) Reset() {
+	*x = ListCategoriesResponse{}
 	mi := &file_demo_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetProductRequest) String() string {
+func (x *ListCategoriesResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetProductRequest) ProtoMessage() {}
+func (*ListCategoriesResponse) ProtoMessage() {}
 
-func (x *GetProductRequest) ProtoReflect() protoreflect.Message {
+func (x *ListCategoriesResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -590,39 +1128,46 @@ func (x *GetProductRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetProductRequest.ProtoReflect.Descriptor instead.
-func (*GetProductRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use ListCategoriesResponse.ProtoReflect.Descriptor instead.
+func (*ListCategoriesResponse) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{10}
 }
 
-func (x *GetProductRequest) GetId() string {
+func (x *ListCategoriesResponse) GetCategories() []*Category {
 	if x != nil {
-		return x.Id
+		return x.Categories
 	}
-	return ""
+	return nil
 }
 
-type SearchProductsRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+type ProductVariant struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Stock keeping unit, unique across the catalog.
+	Sku   string `protobuf:"bytes,1,opt,name=sku,proto3" json:"sku,omitempty"`
+	Size  string `protobuf:"bytes,2,opt,name=size,proto3" json:"size,omitempty"`
+	Color string `protobuf:"bytes,3,opt,name=color,proto3" json:"color,omitempty"`
+	// Added to the product's price_usd; negative for cheaper variants.
+	PriceDeltaUsd *Money `protobuf:"bytes,4,opt,name=price_delta_usd,json=priceDeltaUsd,proto3" json:"price_delta_usd,omitempty"`
+	// Units available. Zero means out of stock.
+	Stock         int32 `protobuf:"varint,5,opt,name=stock,proto3" json:"stock,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SearchProductsRequest) Reset() {
-	*x = SearchProductsRequest{}
+func (x *ProductVariant) Reset() {
+	*x = ProductVariant{}
 	mi := &file_demo_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SearchProductsRequest) String() string {
+func (x *ProductVariant) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SearchProductsRequest) ProtoMessage() {}
+func (*ProductVariant) ProtoMessage() {}
 
-func (x *SearchProductsRequest) ProtoReflect() protoreflect.Message {
+func (x *ProductVariant) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -634,39 +1179,75 @@ func (x *SearchProductsRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SearchProductsRequest.ProtoReflect.Descriptor instead.
-func (*SearchProductsRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use ProductVariant.ProtoReflect.Descriptor instead.
+func (*ProductVariant) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *SearchProductsRequest) GetQuery() string {
+func (x *ProductVariant) GetSku() string {
 	if x != nil {
-		return x.Query
+		return x.Sku
 	}
 	return ""
 }
 
-type SearchProductsResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Results       []*Product             `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+func (x *ProductVariant) GetSize() string {
+	if x != nil {
+		return x.Size
+	}
+	return ""
+}
+
+func (x *ProductVariant) GetColor() string {
+	if x != nil {
+		return x.Color
+	}
+	return ""
+}
+
+func (x *ProductVariant) GetPriceDeltaUsd() *Money {
+	if x != nil {
+		return x.PriceDeltaUsd
+	}
+	return nil
+}
+
+func (x *ProductVariant) GetStock() int32 {
+	if x != nil {
+		return x.Stock
+	}
+	return 0
+}
+
+type ProductVariantSummary struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Count int32                  `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	// Distinct sizes and colors, in variant order.
+	Sizes  []string `protobuf:"bytes,2,rep,name=sizes,proto3" json:"sizes,omitempty"`
+	Colors []string `protobuf:"bytes,3,rep,name=colors,proto3" json:"colors,omitempty"`
+	// Lowest and highest variant prices, deltas included.
+	MinPriceUsd *Money `protobuf:"bytes,4,opt,name=min_price_usd,json=minPriceUsd,proto3" json:"min_price_usd,omitempty"`
+	MaxPriceUsd *Money `protobuf:"bytes,5,opt,name=max_price_usd,json=maxPriceUsd,proto3" json:"max_price_usd,omitempty"`
+	// Number of variants with stock.
+	InStock       int32 `protobuf:"varint,6,opt,name=in_stock,json=inStock,proto3" json:"in_stock,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SearchProductsResponse) Reset() {
-	*x = SearchProductsResponse{}
+func (x *ProductVariantSummary) Reset() {
+	*x = ProductVariantSummary{}
 	mi := &file_demo_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SearchProductsResponse) String() string {
+func (x *ProductVariantSummary) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SearchProductsResponse) ProtoMessage() {}
+func (*ProductVariantSummary) ProtoMessage() {}
 
-func (x *SearchProductsResponse) ProtoReflect() protoreflect.Message {
+func (x *ProductVariantSummary) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -678,40 +1259,84 @@ func (x *SearchProductsResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SearchProductsResponse.ProtoReflect.Descriptor instead.
-func (*SearchProductsResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use ProductVariantSummary.ProtoReflect.Descriptor instead.
+func (*ProductVariantSummary) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{12}
 }
 
-func (x *SearchProductsResponse) GetResults() []*Product {
+func (x *ProductVariantSummary) GetCount() int32 {
 	if x != nil {
-		return x.Results
+		return x.Count
+	}
+	return 0
+}
+
+func (x *ProductVariantSummary) GetSizes() []string {
+	if x != nil {
+		return x.Sizes
 	}
 	return nil
 }
 
-type SemanticSearchRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
-	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *ProductVariantSummary) GetColors() []string {
+	if x != nil {
+		return x.Colors
+	}
+	return nil
 }
 
-func (x *SemanticSearchRequest) Reset() {
-	*x = SemanticSearchRequest{}
+func (x *ProductVariantSummary) GetMinPriceUsd() *Money {
+	if x != nil {
+		return x.MinPriceUsd
+	}
+	return nil
+}
+
+func (x *ProductVariantSummary) GetMaxPriceUsd() *Money {
+	if x != nil {
+		return x.MaxPriceUsd
+	}
+	return nil
+}
+
+func (x *ProductVariantSummary) GetInStock() int32 {
+	if x != nil {
+		return x.InStock
+	}
+	return 0
+}
+
+// ListProductsRequest is wire compatible with Empty: a request without a
+// page_size returns the whole catalog.
+type ListProductsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Maximum number of products to return. Zero returns every product.
+	PageSize int32 `protobuf:"varint,1,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous response, to fetch the following page.
+	PageToken string `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// Top-level Product fields to return, such as "id", "name", "picture" and
+	// "price_usd". The id is always returned. An empty mask returns all fields.
+	ReadMask *fieldmaskpb.FieldMask `protobuf:"bytes,3,opt,name=read_mask,json=readMask,proto3" json:"read_mask,omitempty"`
+	// Also list discontinued and hidden products, for admin tooling.
+	IncludeInactive bool `protobuf:"varint,4,opt,name=include_inactive,json=includeInactive,proto3" json:"include_inactive,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ListProductsRequest) Reset() {
+	*x = ListProductsRequest{}
 	mi := &file_demo_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SemanticSearchRequest) String() string {
+func (x *ListProductsRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SemanticSearchRequest) ProtoMessage() {}
+func (*ListProductsRequest) ProtoMessage() {}
 
-func (x *SemanticSearchRequest) ProtoReflect() protoreflect.Message {
+func (x *ListProductsRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -723,47 +1348,62 @@ func (x *SemanticSearchRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SemanticSearchRequest.ProtoReflect.Descriptor instead.
-func (*SemanticSearchRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use ListProductsRequest.ProtoReflect.Descriptor instead.
+func (*ListProductsRequest) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{13}
 }
 
-func (x *SemanticSearchRequest) GetQuery() string {
+func (x *ListProductsRequest) GetPageSize() int32 {
 	if x != nil {
-		return x.Query
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListProductsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
 	}
 	return ""
 }
 
-func (x *SemanticSearchRequest) GetLimit() int32 {
+func (x *ListProductsRequest) GetReadMask() *fieldmaskpb.FieldMask {
 	if x != nil {
-		return x.Limit
+		return x.ReadMask
 	}
-	return 0
+	return nil
 }
 
-type GetQuoteRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Address       *Address               `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
-	Items         []*CartItem            `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+func (x *ListProductsRequest) GetIncludeInactive() bool {
+	if x != nil {
+		return x.IncludeInactive
+	}
+	return false
+}
+
+type ListProductsResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Products []*Product             `protobuf:"bytes,1,rep,name=products,proto3" json:"products,omitempty"`
+	// Token for the next page, empty on the last page.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetQuoteRequest) Reset() {
-	*x = GetQuoteRequest{}
+func (x *ListProductsResponse) Reset() {
+	*x = ListProductsResponse{}
 	mi := &file_demo_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetQuoteRequest) String() string {
+func (x *ListProductsResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetQuoteRequest) ProtoMessage() {}
+func (*ListProductsResponse) ProtoMessage() {}
 
-func (x *GetQuoteRequest) ProtoReflect() protoreflect.Message {
+func (x *ListProductsResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -775,46 +1415,46 @@ func (x *GetQuoteRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetQuoteRequest.ProtoReflect.Descriptor instead.
-func (*GetQuoteRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use ListProductsResponse.ProtoReflect.Descriptor instead.
+func (*ListProductsResponse) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{14}
 }
 
-func (x *GetQuoteRequest) GetAddress() *Address {
+func (x *ListProductsResponse) GetProducts() []*Product {
 	if x != nil {
-		return x.Address
+		return x.Products
 	}
 	return nil
 }
 
-func (x *GetQuoteRequest) GetItems() []*CartItem {
+func (x *ListProductsResponse) GetNextPageToken() string {
 	if x != nil {
-		return x.Items
+		return x.NextPageToken
 	}
-	return nil
+	return ""
 }
 
-type GetQuoteResponse struct {
+type GetProductRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	CostUsd       *Money                 `protobuf:"bytes,1,opt,name=cost_usd,json=costUsd,proto3" json:"cost_usd,omitempty"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetQuoteResponse) Reset() {
-	*x = GetQuoteResponse{}
+func (x *GetProductRequest) Reset() {
+	*x = GetProductRequest{}
 	mi := &file_demo_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetQuoteResponse) String() string {
+func (x *GetProductRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetQuoteResponse) ProtoMessage() {}
+func (*GetProductRequest) ProtoMessage() {}
 
-func (x *GetQuoteResponse) ProtoReflect() protoreflect.Message {
+func (x *GetProductRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -826,40 +1466,41 @@ func (x *GetQuoteResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetQuoteResponse.ProtoReflect.Descriptor instead.
-func (*GetQuoteResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use GetProductRequest.ProtoReflect.Descriptor instead.
+func (*GetProductRequest) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{15}
 }
 
-func (x *GetQuoteResponse) GetCostUsd() *Money {
+func (x *GetProductRequest) GetId() string {
 	if x != nil {
-		return x.CostUsd
+		return x.Id
 	}
-	return nil
+	return ""
 }
 
-type ShipOrderRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Address       *Address               `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
-	Items         []*CartItem            `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+type SearchProductsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Query string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	// Also match discontinued and hidden products, for admin tooling.
+	IncludeInactive bool `protobuf:"varint,2,opt,name=include_inactive,json=includeInactive,proto3" json:"include_inactive,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
-func (x *ShipOrderRequest) Reset() {
-	*x = ShipOrderRequest{}
+func (x *SearchProductsRequest) Reset() {
+	*x = SearchProductsRequest{}
 	mi := &file_demo_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ShipOrderRequest) String() string {
+func (x *SearchProductsRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ShipOrderRequest) ProtoMessage() {}
+func (*SearchProductsRequest) ProtoMessage() {}
 
-func (x *ShipOrderRequest) ProtoReflect() protoreflect.Message {
+func (x *SearchProductsRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -871,46 +1512,68 @@ func (x *ShipOrderRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ShipOrderRequest.ProtoReflect.Descriptor instead.
-func (*ShipOrderRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use SearchProductsRequest.ProtoReflect.Descriptor instead.
+func (*SearchProductsRequest) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{16}
 }
 
-func (x *ShipOrderRequest) GetAddress() *Address {
+func (x *SearchProductsRequest) GetQuery() string {
 	if x != nil {
-		return x.Address
+		return x.Query
 	}
-	return nil
+	return ""
 }
 
-func (x *ShipOrderRequest) GetItems() []*CartItem {
+func (x *SearchProductsRequest) GetIncludeInactive() bool {
 	if x != nil {
-		return x.Items
+		return x.IncludeInactive
 	}
-	return nil
+	return false
 }
 
-type ShipOrderResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	TrackingId    string                 `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+type SearchProductsResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Results []*Product             `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	// Set when results were cut short to keep the response within the
+	// server's size limits.
+	Truncated bool `protobuf:"varint,2,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	// Counts over the relevant products, when the request asked for them.
+	Facets *SearchFacets `protobuf:"bytes,3,opt,name=facets,proto3" json:"facets,omitempty"`
+	// A respelling of the query that matches product names or categories,
+	// set when a semantic search found nothing, for example "sunglasses"
+	// for "sunglases".
+	SuggestedQuery string `protobuf:"bytes,4,opt,name=suggested_query,json=suggestedQuery,proto3" json:"suggested_query,omitempty"`
+	// How the results were ranked, when the request asked for it.
+	Debug *SearchDebug `protobuf:"bytes,5,opt,name=debug,proto3" json:"debug,omitempty"`
+	// Identifies the search in the search analytics events, when the server
+	// records them. Pass it in ProductInteraction.search_id to attribute
+	// interactions with the results to the search.
+	SearchId string `protobuf:"bytes,6,opt,name=search_id,json=searchId,proto3" json:"search_id,omitempty"`
+	// The ranking experiment variant that served the request, as
+	// "<experiment>/<variant>", if any.
+	ExperimentVariant string `protobuf:"bytes,7,opt,name=experiment_variant,json=experimentVariant,proto3" json:"experiment_variant,omitempty"`
+	// The language of the query, when it is not the catalog's, whether
+	// detected or from language_code. Results are localized into it where
+	// the catalog has translations.
+	QueryLanguage string `protobuf:"bytes,8,opt,name=query_language,json=queryLanguage,proto3" json:"query_language,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ShipOrderResponse) Reset() {
-	*x = ShipOrderResponse{}
+func (x *SearchProductsResponse) Reset() {
+	*x = SearchProductsResponse{}
 	mi := &file_demo_proto_msgTypes[17]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ShipOrderResponse) String() string {
+func (x *SearchProductsResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ShipOrderResponse) ProtoMessage() {}
+func (*SearchProductsResponse) ProtoMessage() {}
 
-func (x *ShipOrderResponse) ProtoReflect() protoreflect.Message {
+func (x *SearchProductsResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[17]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -922,43 +1585,102 @@ func (x *ShipOrderResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ShipOrderResponse.ProtoReflect.Descriptor instead.
-func (*ShipOrderResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use SearchProductsResponse.ProtoReflect.Descriptor instead.
+func (*SearchProductsResponse) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{17}
 }
 
-func (x *ShipOrderResponse) GetTrackingId() string {
+func (x *SearchProductsResponse) GetResults() []*Product {
 	if x != nil {
-		return x.TrackingId
+		return x.Results
+	}
+	return nil
+}
+
+func (x *SearchProductsResponse) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *SearchProductsResponse) GetFacets() *SearchFacets {
+	if x != nil {
+		return x.Facets
+	}
+	return nil
+}
+
+func (x *SearchProductsResponse) GetSuggestedQuery() string {
+	if x != nil {
+		return x.SuggestedQuery
 	}
 	return ""
 }
 
-type Address struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	StreetAddress string                 `protobuf:"bytes,1,opt,name=street_address,json=streetAddress,proto3" json:"street_address,omitempty"`
-	City          string                 `protobuf:"bytes,2,opt,name=city,proto3" json:"city,omitempty"`
-	State         string                 `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
-	Country       string                 `protobuf:"bytes,4,opt,name=country,proto3" json:"country,omitempty"`
-	ZipCode       int32                  `protobuf:"varint,5,opt,name=zip_code,json=zipCode,proto3" json:"zip_code,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *SearchProductsResponse) GetDebug() *SearchDebug {
+	if x != nil {
+		return x.Debug
+	}
+	return nil
 }
 
-func (x *Address) Reset() {
-	*x = Address{}
+func (x *SearchProductsResponse) GetSearchId() string {
+	if x != nil {
+		return x.SearchId
+	}
+	return ""
+}
+
+func (x *SearchProductsResponse) GetExperimentVariant() string {
+	if x != nil {
+		return x.ExperimentVariant
+	}
+	return ""
+}
+
+func (x *SearchProductsResponse) GetQueryLanguage() string {
+	if x != nil {
+		return x.QueryLanguage
+	}
+	return ""
+}
+
+// Explains a semantic search response.
+type SearchDebug struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Why the request was served from keyword search, for example
+	// "embedding_timeout"; empty when semantic search served it.
+	Fallback string `protobuf:"bytes,1,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	// The query as embedded and matched, after translation and query
+	// processing.
+	ProcessedQuery string `protobuf:"bytes,2,opt,name=processed_query,json=processedQuery,proto3" json:"processed_query,omitempty"`
+	// The ranking weights in effect, normalized to sum to 1.
+	Weights *HybridSearchWeights `protobuf:"bytes,3,opt,name=weights,proto3" json:"weights,omitempty"`
+	// Scores of the results, in result order. Empty when keyword search
+	// served the request; products a merchandising rule pinned without
+	// semantic search finding them have none.
+	Scores []*SearchDebug_ResultScores `protobuf:"bytes,4,rep,name=scores,proto3" json:"scores,omitempty"`
+	// IDs of the merchandising rules that reordered the results.
+	MerchandisingRules []int64 `protobuf:"varint,5,rep,packed,name=merchandising_rules,json=merchandisingRules,proto3" json:"merchandising_rules,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *SearchDebug) Reset() {
+	*x = SearchDebug{}
 	mi := &file_demo_proto_msgTypes[18]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Address) String() string {
+func (x *SearchDebug) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Address) ProtoMessage() {}
+func (*SearchDebug) ProtoMessage() {}
 
-func (x *Address) ProtoReflect() protoreflect.Message {
+func (x *SearchDebug) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[18]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -970,79 +1692,74 @@ func (x *Address) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Address.ProtoReflect.Descriptor instead.
-func (*Address) Descriptor() ([]byte, []int) {
+// Deprecated: Use SearchDebug.ProtoReflect.Descriptor instead.
+func (*SearchDebug) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{18}
 }
 
-func (x *Address) GetStreetAddress() string {
+func (x *SearchDebug) GetFallback() string {
 	if x != nil {
-		return x.StreetAddress
+		return x.Fallback
 	}
 	return ""
 }
 
-func (x *Address) GetCity() string {
+func (x *SearchDebug) GetProcessedQuery() string {
 	if x != nil {
-		return x.City
+		return x.ProcessedQuery
 	}
 	return ""
 }
 
-func (x *Address) GetState() string {
+func (x *SearchDebug) GetWeights() *HybridSearchWeights {
 	if x != nil {
-		return x.State
+		return x.Weights
 	}
-	return ""
+	return nil
 }
 
-func (x *Address) GetCountry() string {
+func (x *SearchDebug) GetScores() []*SearchDebug_ResultScores {
 	if x != nil {
-		return x.Country
+		return x.Scores
 	}
-	return ""
+	return nil
 }
 
-func (x *Address) GetZipCode() int32 {
+func (x *SearchDebug) GetMerchandisingRules() []int64 {
 	if x != nil {
-		return x.ZipCode
+		return x.MerchandisingRules
 	}
-	return 0
+	return nil
 }
 
-// Represents an amount of money with its currency type.
-type Money struct {
+// Facet counts a client can render as filters. Semantic search counts the
+// most relevant products (at least 100, or the request limit if larger) under
+// the request's filters, not only the returned page.
+type SearchFacets struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
-	// The 3-letter currency code defined in ISO 4217.
-	CurrencyCode string `protobuf:"bytes,1,opt,name=currency_code,json=currencyCode,proto3" json:"currency_code,omitempty"`
-	// The whole units of the amount.
-	// For example if `currencyCode` is `"USD"`, then 1 unit is one US dollar.
-	Units int64 `protobuf:"varint,2,opt,name=units,proto3" json:"units,omitempty"`
-	// Number of nano (10^-9) units of the amount.
-	// The value must be between -999,999,999 and +999,999,999 inclusive.
-	// If `units` is positive, `nanos` must be positive or zero.
-	// If `units` is zero, `nanos` can be positive, zero, or negative.
-	// If `units` is negative, `nanos` must be negative or zero.
-	// For example $-1.75 is represented as `units`=-1 and `nanos`=-750,000,000.
-	Nanos         int32 `protobuf:"varint,3,opt,name=nanos,proto3" json:"nanos,omitempty"`
+	// Most common first, then by value.
+	Categories []*FacetCount `protobuf:"bytes,1,rep,name=categories,proto3" json:"categories,omitempty"`
+	TargetTags []*FacetCount `protobuf:"bytes,2,rep,name=target_tags,json=targetTags,proto3" json:"target_tags,omitempty"`
+	// Fixed USD price ranges, cheapest first; empty ranges are included.
+	PriceBuckets  []*PriceBucketCount `protobuf:"bytes,3,rep,name=price_buckets,json=priceBuckets,proto3" json:"price_buckets,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Money) Reset() {
-	*x = Money{}
+func (x *SearchFacets) Reset() {
+	*x = SearchFacets{}
 	mi := &file_demo_proto_msgTypes[19]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Money) String() string {
+func (x *SearchFacets) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Money) ProtoMessage() {}
+func (*SearchFacets) ProtoMessage() {}
 
-func (x *Money) ProtoReflect() protoreflect.Message {
+func (x *SearchFacets) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[19]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1054,54 +1771,54 @@ func (x *Money) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Money.ProtoReflect.Descriptor instead.
-func (*Money) Descriptor() ([]byte, []int) {
+// Deprecated: Use SearchFacets.ProtoReflect.Descriptor instead.
+func (*SearchFacets) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{19}
 }
 
-func (x *Money) GetCurrencyCode() string {
+func (x *SearchFacets) GetCategories() []*FacetCount {
 	if x != nil {
-		return x.CurrencyCode
+		return x.Categories
 	}
-	return ""
+	return nil
 }
 
-func (x *Money) GetUnits() int64 {
+func (x *SearchFacets) GetTargetTags() []*FacetCount {
 	if x != nil {
-		return x.Units
+		return x.TargetTags
 	}
-	return 0
+	return nil
 }
 
-func (x *Money) GetNanos() int32 {
+func (x *SearchFacets) GetPriceBuckets() []*PriceBucketCount {
 	if x != nil {
-		return x.Nanos
+		return x.PriceBuckets
 	}
-	return 0
+	return nil
 }
 
-type GetSupportedCurrenciesResponse struct {
-	state protoimpl.MessageState `protogen:"open.v1"`
-	// The 3-letter currency code defined in ISO 4217.
-	CurrencyCodes []string `protobuf:"bytes,1,rep,name=currency_codes,json=currencyCodes,proto3" json:"currency_codes,omitempty"`
+type FacetCount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Count         int32                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetSupportedCurrenciesResponse) Reset() {
-	*x = GetSupportedCurrenciesResponse{}
+func (x *FacetCount) Reset() {
+	*x = FacetCount{}
 	mi := &file_demo_proto_msgTypes[20]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetSupportedCurrenciesResponse) String() string {
+func (x *FacetCount) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetSupportedCurrenciesResponse) ProtoMessage() {}
+func (*FacetCount) ProtoMessage() {}
 
-func (x *GetSupportedCurrenciesResponse) ProtoReflect() protoreflect.Message {
+func (x *FacetCount) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[20]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1113,41 +1830,50 @@ func (x *GetSupportedCurrenciesResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetSupportedCurrenciesResponse.ProtoReflect.Descriptor instead.
-func (*GetSupportedCurrenciesResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use FacetCount.ProtoReflect.Descriptor instead.
+func (*FacetCount) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{20}
 }
 
-func (x *GetSupportedCurrenciesResponse) GetCurrencyCodes() []string {
+func (x *FacetCount) GetValue() string {
 	if x != nil {
-		return x.CurrencyCodes
+		return x.Value
 	}
-	return nil
+	return ""
 }
 
-type CurrencyConversionRequest struct {
+func (x *FacetCount) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type PriceBucketCount struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
-	From  *Money                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
-	// The 3-letter currency code defined in ISO 4217.
-	ToCode        string `protobuf:"bytes,2,opt,name=to_code,json=toCode,proto3" json:"to_code,omitempty"`
+	// Inclusive lower bound.
+	Min *Money `protobuf:"bytes,1,opt,name=min,proto3" json:"min,omitempty"`
+	// Exclusive upper bound; unset for the most expensive range.
+	Max           *Money `protobuf:"bytes,2,opt,name=max,proto3" json:"max,omitempty"`
+	Count         int32  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *CurrencyConversionRequest) Reset() {
-	*x = CurrencyConversionRequest{}
+func (x *PriceBucketCount) Reset() {
+	*x = PriceBucketCount{}
 	mi := &file_demo_proto_msgTypes[21]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *CurrencyConversionRequest) String() string {
+func (x *PriceBucketCount) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*CurrencyConversionRequest) ProtoMessage() {}
+func (*PriceBucketCount) ProtoMessage() {}
 
-func (x *CurrencyConversionRequest) ProtoReflect() protoreflect.Message {
+func (x *PriceBucketCount) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[21]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1159,49 +1885,98 @@ func (x *CurrencyConversionRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use CurrencyConversionRequest.ProtoReflect.Descriptor instead.
-func (*CurrencyConversionRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use PriceBucketCount.ProtoReflect.Descriptor instead.
+func (*PriceBucketCount) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{21}
 }
 
-func (x *CurrencyConversionRequest) GetFrom() *Money {
+func (x *PriceBucketCount) GetMin() *Money {
 	if x != nil {
-		return x.From
+		return x.Min
 	}
 	return nil
 }
 
-func (x *CurrencyConversionRequest) GetToCode() string {
+func (x *PriceBucketCount) GetMax() *Money {
 	if x != nil {
-		return x.ToCode
+		return x.Max
 	}
-	return ""
+	return nil
 }
 
-type CreditCardInfo struct {
-	state                     protoimpl.MessageState `protogen:"open.v1"`
-	CreditCardNumber          string                 `protobuf:"bytes,1,opt,name=credit_card_number,json=creditCardNumber,proto3" json:"credit_card_number,omitempty"`
-	CreditCardCvv             int32                  `protobuf:"varint,2,opt,name=credit_card_cvv,json=creditCardCvv,proto3" json:"credit_card_cvv,omitempty"`
-	CreditCardExpirationYear  int32                  `protobuf:"varint,3,opt,name=credit_card_expiration_year,json=creditCardExpirationYear,proto3" json:"credit_card_expiration_year,omitempty"`
-	CreditCardExpirationMonth int32                  `protobuf:"varint,4,opt,name=credit_card_expiration_month,json=creditCardExpirationMonth,proto3" json:"credit_card_expiration_month,omitempty"`
-	unknownFields             protoimpl.UnknownFields
-	sizeCache                 protoimpl.SizeCache
+func (x *PriceBucketCount) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
 }
 
-func (x *CreditCardInfo) Reset() {
-	*x = CreditCardInfo{}
+type SemanticSearchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Query string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Limit int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Products in at least one of these categories or their subcategories.
+	Categories []string `protobuf:"bytes,3,rep,name=categories,proto3" json:"categories,omitempty"`
+	// Inclusive price bounds in USD.
+	MinPriceUsd *Money `protobuf:"bytes,4,opt,name=min_price_usd,json=minPriceUsd,proto3" json:"min_price_usd,omitempty"`
+	MaxPriceUsd *Money `protobuf:"bytes,5,opt,name=max_price_usd,json=maxPriceUsd,proto3" json:"max_price_usd,omitempty"`
+	// Products with at least one of these target tags.
+	TargetTags []string `protobuf:"bytes,6,rep,name=target_tags,json=targetTags,proto3" json:"target_tags,omitempty"`
+	// Optional override of the server's hybrid ranking weights.
+	Weights *HybridSearchWeights `protobuf:"bytes,7,opt,name=weights,proto3" json:"weights,omitempty"`
+	// Optional override of the server's maximum weighted cosine distance.
+	// Products scoring above it are left out, so an unrelated query can
+	// return no results. 0 disables the cutoff for this request.
+	MaxDistance *float64                        `protobuf:"fixed64,8,opt,name=max_distance,json=maxDistance,proto3,oneof" json:"max_distance,omitempty"`
+	SortBy      SemanticSearchRequest_SortOrder `protobuf:"varint,9,opt,name=sort_by,json=sortBy,proto3,enum=hipstershop.SemanticSearchRequest_SortOrder" json:"sort_by,omitempty"`
+	// Also return SearchProductsResponse.facets.
+	IncludeFacets bool `protobuf:"varint,10,opt,name=include_facets,json=includeFacets,proto3" json:"include_facets,omitempty"`
+	// Optional limit, in milliseconds, on embedding the query and querying
+	// the database together. Past it the request is served from keyword
+	// search; it can only shorten the server's own timeouts.
+	TimeoutMs int32 `protobuf:"varint,11,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	// Optional personalization. The query embedding is blended with
+	// profile_embedding if set, or else with a profile derived from the
+	// interactions recorded for user_id.
+	UserId           string    `protobuf:"bytes,12,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ProfileEmbedding []float32 `protobuf:"fixed32,13,rep,packed,name=profile_embedding,json=profileEmbedding,proto3" json:"profile_embedding,omitempty"`
+	// Also return SearchProductsResponse.debug, explaining how the results
+	// were ranked, for relevance tuning.
+	Debug bool `protobuf:"varint,14,opt,name=debug,proto3" json:"debug,omitempty"`
+	// Identifies an anonymous shopper's session. Ranking experiments assign
+	// variants by user_id, or by session_id when there is no user.
+	SessionId string `protobuf:"bytes,15,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	// The shopper's language, as a BCP 47 code such as "es". The query is
+	// taken to be in it instead of detecting its language, and results are
+	// localized into it where the catalog has translations.
+	LanguageCode string `protobuf:"bytes,16,opt,name=language_code,json=languageCode,proto3" json:"language_code,omitempty"`
+	// Also return discontinued and hidden products, for admin tooling.
+	IncludeInactive bool `protobuf:"varint,17,opt,name=include_inactive,json=includeInactive,proto3" json:"include_inactive,omitempty"`
+	// Only return products in stock. Products whose stock is not tracked
+	// count as in stock.
+	InStockOnly bool `protobuf:"varint,18,opt,name=in_stock_only,json=inStockOnly,proto3" json:"in_stock_only,omitempty"`
+	// Optional override of the server's diversification lambda, in [0, 1]:
+	// how much relevance counts against being unlike the results already
+	// picked. 1 turns diversification off for this request.
+	DiversityLambda *float64 `protobuf:"fixed64,19,opt,name=diversity_lambda,json=diversityLambda,proto3,oneof" json:"diversity_lambda,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *SemanticSearchRequest) Reset() {
+	*x = SemanticSearchRequest{}
 	mi := &file_demo_proto_msgTypes[22]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *CreditCardInfo) String() string {
+func (x *SemanticSearchRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*CreditCardInfo) ProtoMessage() {}
+func (*SemanticSearchRequest) ProtoMessage() {}
 
-func (x *CreditCardInfo) ProtoReflect() protoreflect.Message {
+func (x *SemanticSearchRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[22]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1213,61 +1988,174 @@ func (x *CreditCardInfo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use CreditCardInfo.ProtoReflect.Descriptor instead.
-func (*CreditCardInfo) Descriptor() ([]byte, []int) {
+// Deprecated: Use SemanticSearchRequest.ProtoReflect.Descriptor instead.
+func (*SemanticSearchRequest) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{22}
 }
 
-func (x *CreditCardInfo) GetCreditCardNumber() string {
+func (x *SemanticSearchRequest) GetQuery() string {
 	if x != nil {
-		return x.CreditCardNumber
+		return x.Query
 	}
 	return ""
 }
 
-func (x *CreditCardInfo) GetCreditCardCvv() int32 {
+func (x *SemanticSearchRequest) GetLimit() int32 {
 	if x != nil {
-		return x.CreditCardCvv
+		return x.Limit
 	}
 	return 0
 }
 
-func (x *CreditCardInfo) GetCreditCardExpirationYear() int32 {
+func (x *SemanticSearchRequest) GetCategories() []string {
 	if x != nil {
-		return x.CreditCardExpirationYear
+		return x.Categories
+	}
+	return nil
+}
+
+func (x *SemanticSearchRequest) GetMinPriceUsd() *Money {
+	if x != nil {
+		return x.MinPriceUsd
+	}
+	return nil
+}
+
+func (x *SemanticSearchRequest) GetMaxPriceUsd() *Money {
+	if x != nil {
+		return x.MaxPriceUsd
+	}
+	return nil
+}
+
+func (x *SemanticSearchRequest) GetTargetTags() []string {
+	if x != nil {
+		return x.TargetTags
+	}
+	return nil
+}
+
+func (x *SemanticSearchRequest) GetWeights() *HybridSearchWeights {
+	if x != nil {
+		return x.Weights
+	}
+	return nil
+}
+
+func (x *SemanticSearchRequest) GetMaxDistance() float64 {
+	if x != nil && x.MaxDistance != nil {
+		return *x.MaxDistance
 	}
 	return 0
 }
 
-func (x *CreditCardInfo) GetCreditCardExpirationMonth() int32 {
+func (x *SemanticSearchRequest) GetSortBy() SemanticSearchRequest_SortOrder {
 	if x != nil {
-		return x.CreditCardExpirationMonth
+		return x.SortBy
+	}
+	return SemanticSearchRequest_RELEVANCE
+}
+
+func (x *SemanticSearchRequest) GetIncludeFacets() bool {
+	if x != nil {
+		return x.IncludeFacets
+	}
+	return false
+}
+
+func (x *SemanticSearchRequest) GetTimeoutMs() int32 {
+	if x != nil {
+		return x.TimeoutMs
 	}
 	return 0
 }
 
-type ChargeRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Amount        *Money                 `protobuf:"bytes,1,opt,name=amount,proto3" json:"amount,omitempty"`
-	CreditCard    *CreditCardInfo        `protobuf:"bytes,2,opt,name=credit_card,json=creditCard,proto3" json:"credit_card,omitempty"`
+func (x *SemanticSearchRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SemanticSearchRequest) GetProfileEmbedding() []float32 {
+	if x != nil {
+		return x.ProfileEmbedding
+	}
+	return nil
+}
+
+func (x *SemanticSearchRequest) GetDebug() bool {
+	if x != nil {
+		return x.Debug
+	}
+	return false
+}
+
+func (x *SemanticSearchRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *SemanticSearchRequest) GetLanguageCode() string {
+	if x != nil {
+		return x.LanguageCode
+	}
+	return ""
+}
+
+func (x *SemanticSearchRequest) GetIncludeInactive() bool {
+	if x != nil {
+		return x.IncludeInactive
+	}
+	return false
+}
+
+func (x *SemanticSearchRequest) GetInStockOnly() bool {
+	if x != nil {
+		return x.InStockOnly
+	}
+	return false
+}
+
+func (x *SemanticSearchRequest) GetDiversityLambda() float64 {
+	if x != nil && x.DiversityLambda != nil {
+		return *x.DiversityLambda
+	}
+	return 0
+}
+
+type ImageSearchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The image to find products like, either as encoded bytes (JPEG, PNG,
+	// ...) or as an http(s) URL the service downloads it from.
+	//
+	// Types that are valid to be assigned to Image:
+	//
+	//	*ImageSearchRequest_ImageData
+	//	*ImageSearchRequest_ImageUrl
+	Image isImageSearchRequest_Image `protobuf_oneof:"image"`
+	// Maximum number of products to return; defaults to 10.
+	Limit         int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ChargeRequest) Reset() {
-	*x = ChargeRequest{}
+func (x *ImageSearchRequest) Reset() {
+	*x = ImageSearchRequest{}
 	mi := &file_demo_proto_msgTypes[23]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ChargeRequest) String() string {
+func (x *ImageSearchRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ChargeRequest) ProtoMessage() {}
+func (*ImageSearchRequest) ProtoMessage() {}
 
-func (x *ChargeRequest) ProtoReflect() protoreflect.Message {
+func (x *ImageSearchRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[23]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1279,46 +2167,85 @@ func (x *ChargeRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ChargeRequest.ProtoReflect.Descriptor instead.
-func (*ChargeRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use ImageSearchRequest.ProtoReflect.Descriptor instead.
+func (*ImageSearchRequest) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{23}
 }
 
-func (x *ChargeRequest) GetAmount() *Money {
+func (x *ImageSearchRequest) GetImage() isImageSearchRequest_Image {
 	if x != nil {
-		return x.Amount
+		return x.Image
 	}
 	return nil
 }
 
-func (x *ChargeRequest) GetCreditCard() *CreditCardInfo {
+func (x *ImageSearchRequest) GetImageData() []byte {
 	if x != nil {
-		return x.CreditCard
+		if x, ok := x.Image.(*ImageSearchRequest_ImageData); ok {
+			return x.ImageData
+		}
 	}
 	return nil
 }
 
-type ChargeResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	TransactionId string                 `protobuf:"bytes,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+func (x *ImageSearchRequest) GetImageUrl() string {
+	if x != nil {
+		if x, ok := x.Image.(*ImageSearchRequest_ImageUrl); ok {
+			return x.ImageUrl
+		}
+	}
+	return ""
+}
+
+func (x *ImageSearchRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type isImageSearchRequest_Image interface {
+	isImageSearchRequest_Image()
+}
+
+type ImageSearchRequest_ImageData struct {
+	ImageData []byte `protobuf:"bytes,1,opt,name=image_data,json=imageData,proto3,oneof"`
+}
+
+type ImageSearchRequest_ImageUrl struct {
+	ImageUrl string `protobuf:"bytes,2,opt,name=image_url,json=imageUrl,proto3,oneof"`
+}
+
+func (*ImageSearchRequest_ImageData) isImageSearchRequest_Image() {}
+
+func (*ImageSearchRequest_ImageUrl) isImageSearchRequest_Image() {}
+
+type ProductInteraction struct {
+	state     protoimpl.MessageState  `protogen:"open.v1"`
+	UserId    string                  `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ProductId string                  `protobuf:"bytes,2,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Kind      ProductInteraction_Kind `protobuf:"varint,3,opt,name=kind,proto3,enum=hipstershop.ProductInteraction_Kind" json:"kind,omitempty"`
+	// The SearchProductsResponse.search_id of the search the product was
+	// found with, if any.
+	SearchId      string `protobuf:"bytes,4,opt,name=search_id,json=searchId,proto3" json:"search_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ChargeResponse) Reset() {
-	*x = ChargeResponse{}
+func (x *ProductInteraction) Reset() {
+	*x = ProductInteraction{}
 	mi := &file_demo_proto_msgTypes[24]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ChargeResponse) String() string {
+func (x *ProductInteraction) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ChargeResponse) ProtoMessage() {}
+func (*ProductInteraction) ProtoMessage() {}
 
-func (x *ChargeResponse) ProtoReflect() protoreflect.Message {
+func (x *ProductInteraction) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[24]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1330,40 +2257,63 @@ func (x *ChargeResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ChargeResponse.ProtoReflect.Descriptor instead.
-func (*ChargeResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use ProductInteraction.ProtoReflect.Descriptor instead.
+func (*ProductInteraction) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{24}
 }
 
-func (x *ChargeResponse) GetTransactionId() string {
+func (x *ProductInteraction) GetUserId() string {
 	if x != nil {
-		return x.TransactionId
+		return x.UserId
 	}
 	return ""
 }
 
-type OrderItem struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Item          *CartItem              `protobuf:"bytes,1,opt,name=item,proto3" json:"item,omitempty"`
-	Cost          *Money                 `protobuf:"bytes,2,opt,name=cost,proto3" json:"cost,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *ProductInteraction) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
 }
 
-func (x *OrderItem) Reset() {
-	*x = OrderItem{}
-	mi := &file_demo_proto_msgTypes[25]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *ProductInteraction) GetKind() ProductInteraction_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return ProductInteraction_VIEW
 }
 
-func (x *OrderItem) String() string {
+func (x *ProductInteraction) GetSearchId() string {
+	if x != nil {
+		return x.SearchId
+	}
+	return ""
+}
+
+type GetSimilarProductsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The product to find neighbors of. It is never among the results.
+	ProductId string `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	// Maximum number of products to return; defaults to 10.
+	Limit         int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSimilarProductsRequest) Reset() {
+	*x = GetSimilarProductsRequest{}
+	mi := &file_demo_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSimilarProductsRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*OrderItem) ProtoMessage() {}
+func (*GetSimilarProductsRequest) ProtoMessage() {}
 
-func (x *OrderItem) ProtoReflect() protoreflect.Message {
+func (x *GetSimilarProductsRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_demo_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1375,51 +2325,4969 @@ func (x *OrderItem) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use OrderItem.ProtoReflect.Descriptor instead.
-func (*OrderItem) Descriptor() ([]byte, []int) {
+// Deprecated: Use GetSimilarProductsRequest.ProtoReflect.Descriptor instead.
+func (*GetSimilarProductsRequest) Descriptor() ([]byte, []int) {
 	return file_demo_proto_rawDescGZIP(), []int{25}
 }
 
-func (x *OrderItem) GetItem() *CartItem {
+func (x *GetSimilarProductsRequest) GetProductId() string {
 	if x != nil {
-		return x.Item
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *GetSimilarProductsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type SuggestProductsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// What the user has typed so far.
+	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	// Maximum number of suggestions to return; defaults to 8.
+	Limit         int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SuggestProductsRequest) Reset() {
+	*x = SuggestProductsRequest{}
+	mi := &file_demo_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SuggestProductsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SuggestProductsRequest) ProtoMessage() {}
+
+func (x *SuggestProductsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SuggestProductsRequest.ProtoReflect.Descriptor instead.
+func (*SuggestProductsRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *SuggestProductsRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SuggestProductsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type Suggestion struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The completion to show, a product name or a category.
+	Text string          `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Kind Suggestion_Kind `protobuf:"varint,2,opt,name=kind,proto3,enum=hipstershop.Suggestion_Kind" json:"kind,omitempty"`
+	// The suggested product, for PRODUCT suggestions.
+	ProductId     string `protobuf:"bytes,3,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Suggestion) Reset() {
+	*x = Suggestion{}
+	mi := &file_demo_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Suggestion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Suggestion) ProtoMessage() {}
+
+func (x *Suggestion) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Suggestion.ProtoReflect.Descriptor instead.
+func (*Suggestion) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *Suggestion) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Suggestion) GetKind() Suggestion_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Suggestion_PRODUCT
+}
+
+func (x *Suggestion) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+type SuggestProductsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Prefix matches first, then close spellings, most similar first.
+	Suggestions   []*Suggestion `protobuf:"bytes,1,rep,name=suggestions,proto3" json:"suggestions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SuggestProductsResponse) Reset() {
+	*x = SuggestProductsResponse{}
+	mi := &file_demo_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SuggestProductsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SuggestProductsResponse) ProtoMessage() {}
+
+func (x *SuggestProductsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SuggestProductsResponse.ProtoReflect.Descriptor instead.
+func (*SuggestProductsResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *SuggestProductsResponse) GetSuggestions() []*Suggestion {
+	if x != nil {
+		return x.Suggestions
 	}
 	return nil
 }
 
-func (x *OrderItem) GetCost() *Money {
+// Relative weights of the embeddings a semantic search ranks products by.
+// They are normalized to sum to 1, and at least one must be positive.
+type HybridSearchWeights struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Combined      float64                `protobuf:"fixed64,1,opt,name=combined,proto3" json:"combined,omitempty"`
+	TargetTags    float64                `protobuf:"fixed64,2,opt,name=target_tags,json=targetTags,proto3" json:"target_tags,omitempty"`
+	UseContext    float64                `protobuf:"fixed64,3,opt,name=use_context,json=useContext,proto3" json:"use_context,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HybridSearchWeights) Reset() {
+	*x = HybridSearchWeights{}
+	mi := &file_demo_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HybridSearchWeights) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HybridSearchWeights) ProtoMessage() {}
+
+func (x *HybridSearchWeights) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[29]
 	if x != nil {
-		return x.Cost
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HybridSearchWeights.ProtoReflect.Descriptor instead.
+func (*HybridSearchWeights) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *HybridSearchWeights) GetCombined() float64 {
+	if x != nil {
+		return x.Combined
+	}
+	return 0
+}
+
+func (x *HybridSearchWeights) GetTargetTags() float64 {
+	if x != nil {
+		return x.TargetTags
+	}
+	return 0
+}
+
+func (x *HybridSearchWeights) GetUseContext() float64 {
+	if x != nil {
+		return x.UseContext
+	}
+	return 0
+}
+
+type CreateProductRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Product       *Product               `protobuf:"bytes,1,opt,name=product,proto3" json:"product,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateProductRequest) Reset() {
+	*x = CreateProductRequest{}
+	mi := &file_demo_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateProductRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateProductRequest) ProtoMessage() {}
+
+func (x *CreateProductRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateProductRequest.ProtoReflect.Descriptor instead.
+func (*CreateProductRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *CreateProductRequest) GetProduct() *Product {
+	if x != nil {
+		return x.Product
 	}
 	return nil
 }
 
-type OrderResult struct {
-	state              protoimpl.MessageState `protogen:"open.v1"`
-	OrderId            string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
-	ShippingTrackingId string                 `protobuf:"bytes,2,opt,name=shipping_tracking_id,json=shippingTrackingId,proto3" json:"shipping_tracking_id,omitempty"`
-	ShippingCost       *Money                 `protobuf:"bytes,3,opt,name=shipping_cost,json=shippingCost,proto3" json:"shipping_cost,omitempty"`
-	ShippingAddress    *Address               `protobuf:"bytes,4,opt,name=shipping_address,json=shippingAddress,proto3" json:"shipping_address,omitempty"`
-	Items              []*OrderItem           `protobuf:"bytes,5,rep,name=items,proto3" json:"items,omitempty"`
-	unknownFields      protoimpl.UnknownFields
-	sizeCache          protoimpl.SizeCache
+type UpdateProductRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Replaces every field of the product with the same id.
+	Product       *Product `protobuf:"bytes,1,opt,name=product,proto3" json:"product,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateProductRequest) Reset() {
+	*x = UpdateProductRequest{}
+	mi := &file_demo_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateProductRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateProductRequest) ProtoMessage() {}
+
+func (x *UpdateProductRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateProductRequest.ProtoReflect.Descriptor instead.
+func (*UpdateProductRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *UpdateProductRequest) GetProduct() *Product {
+	if x != nil {
+		return x.Product
+	}
+	return nil
+}
+
+type DeleteProductRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Removes the product and its variants instead of marking it
+	// discontinued. Orders referencing it can no longer look it up.
+	Purge         bool `protobuf:"varint,2,opt,name=purge,proto3" json:"purge,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteProductRequest) Reset() {
+	*x = DeleteProductRequest{}
+	mi := &file_demo_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteProductRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteProductRequest) ProtoMessage() {}
+
+func (x *DeleteProductRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteProductRequest.ProtoReflect.Descriptor instead.
+func (*DeleteProductRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *DeleteProductRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteProductRequest) GetPurge() bool {
+	if x != nil {
+		return x.Purge
+	}
+	return false
+}
+
+type ReloadCatalogResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of products in the reloaded catalog.
+	Products      int32 `protobuf:"varint,1,opt,name=products,proto3" json:"products,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadCatalogResponse) Reset() {
+	*x = ReloadCatalogResponse{}
+	mi := &file_demo_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadCatalogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadCatalogResponse) ProtoMessage() {}
+
+func (x *ReloadCatalogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadCatalogResponse.ProtoReflect.Descriptor instead.
+func (*ReloadCatalogResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *ReloadCatalogResponse) GetProducts() int32 {
+	if x != nil {
+		return x.Products
+	}
+	return 0
+}
+
+type ImportProductsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Format CatalogFormat          `protobuf:"varint,1,opt,name=format,proto3,enum=hipstershop.CatalogFormat" json:"format,omitempty"`
+	Data   []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// Replaces products whose id already exists; without it they are
+	// skipped.
+	ReplaceExisting bool `protobuf:"varint,3,opt,name=replace_existing,json=replaceExisting,proto3" json:"replace_existing,omitempty"`
+	// Validates the document and counts what would change without
+	// writing anything.
+	DryRun        bool `protobuf:"varint,4,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportProductsRequest) Reset() {
+	*x = ImportProductsRequest{}
+	mi := &file_demo_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportProductsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportProductsRequest) ProtoMessage() {}
+
+func (x *ImportProductsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportProductsRequest.ProtoReflect.Descriptor instead.
+func (*ImportProductsRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *ImportProductsRequest) GetFormat() CatalogFormat {
+	if x != nil {
+		return x.Format
+	}
+	return CatalogFormat_CATALOG_FORMAT_JSON
+}
+
+func (x *ImportProductsRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ImportProductsRequest) GetReplaceExisting() bool {
+	if x != nil {
+		return x.ReplaceExisting
+	}
+	return false
+}
+
+func (x *ImportProductsRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+// An invalid document fails with INVALID_ARGUMENT and a BadRequest detail
+// listing every invalid product; nothing is written then.
+type ImportProductsResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Created  int32                  `protobuf:"varint,1,opt,name=created,proto3" json:"created,omitempty"`
+	Replaced int32                  `protobuf:"varint,2,opt,name=replaced,proto3" json:"replaced,omitempty"`
+	// Existing products left alone because replace_existing was not set.
+	Skipped int32 `protobuf:"varint,3,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	// Written products whose embedding failed; the embedding reconciler
+	// retries them.
+	EmbeddingPending int32 `protobuf:"varint,4,opt,name=embedding_pending,json=embeddingPending,proto3" json:"embedding_pending,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *ImportProductsResponse) Reset() {
+	*x = ImportProductsResponse{}
+	mi := &file_demo_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportProductsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportProductsResponse) ProtoMessage() {}
+
+func (x *ImportProductsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportProductsResponse.ProtoReflect.Descriptor instead.
+func (*ImportProductsResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *ImportProductsResponse) GetCreated() int32 {
+	if x != nil {
+		return x.Created
+	}
+	return 0
+}
+
+func (x *ImportProductsResponse) GetReplaced() int32 {
+	if x != nil {
+		return x.Replaced
+	}
+	return 0
+}
+
+func (x *ImportProductsResponse) GetSkipped() int32 {
+	if x != nil {
+		return x.Skipped
+	}
+	return 0
+}
+
+func (x *ImportProductsResponse) GetEmbeddingPending() int32 {
+	if x != nil {
+		return x.EmbeddingPending
+	}
+	return 0
+}
+
+type ExportProductsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Format        CatalogFormat          `protobuf:"varint,1,opt,name=format,proto3,enum=hipstershop.CatalogFormat" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportProductsRequest) Reset() {
+	*x = ExportProductsRequest{}
+	mi := &file_demo_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportProductsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportProductsRequest) ProtoMessage() {}
+
+func (x *ExportProductsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportProductsRequest.ProtoReflect.Descriptor instead.
+func (*ExportProductsRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *ExportProductsRequest) GetFormat() CatalogFormat {
+	if x != nil {
+		return x.Format
+	}
+	return CatalogFormat_CATALOG_FORMAT_JSON
+}
+
+type ExportProductsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Data  []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// Number of products in data.
+	Products      int32 `protobuf:"varint,2,opt,name=products,proto3" json:"products,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportProductsResponse) Reset() {
+	*x = ExportProductsResponse{}
+	mi := &file_demo_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportProductsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportProductsResponse) ProtoMessage() {}
+
+func (x *ExportProductsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportProductsResponse.ProtoReflect.Descriptor instead.
+func (*ExportProductsResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *ExportProductsResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ExportProductsResponse) GetProducts() int32 {
+	if x != nil {
+		return x.Products
+	}
+	return 0
+}
+
+// Pins, boosts or buries products in the results of matching searches.
+type MerchandisingRule struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Assigned by the server.
+	Id int64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Case-insensitive regular expression the processed query must match,
+	// for example "^(sofa|couch)". Empty matches every query.
+	QueryPattern string `protobuf:"bytes,2,opt,name=query_pattern,json=queryPattern,proto3" json:"query_pattern,omitempty"`
+	// The products the rule moves: one product, or those in a category.
+	//
+	// Types that are valid to be assigned to Target:
+	//
+	//	*MerchandisingRule_ProductId
+	//	*MerchandisingRule_Category
+	Target isMerchandisingRule_Target `protobuf_oneof:"target"`
+	Action MerchandisingRule_Action   `protobuf:"varint,5,opt,name=action,proto3,enum=hipstershop.MerchandisingRule_Action" json:"action,omitempty"`
+	// Optional time range the rule is active in.
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MerchandisingRule) Reset() {
+	*x = MerchandisingRule{}
+	mi := &file_demo_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MerchandisingRule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MerchandisingRule) ProtoMessage() {}
+
+func (x *MerchandisingRule) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MerchandisingRule.ProtoReflect.Descriptor instead.
+func (*MerchandisingRule) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *MerchandisingRule) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *MerchandisingRule) GetQueryPattern() string {
+	if x != nil {
+		return x.QueryPattern
+	}
+	return ""
+}
+
+func (x *MerchandisingRule) GetTarget() isMerchandisingRule_Target {
+	if x != nil {
+		return x.Target
+	}
+	return nil
+}
+
+func (x *MerchandisingRule) GetProductId() string {
+	if x != nil {
+		if x, ok := x.Target.(*MerchandisingRule_ProductId); ok {
+			return x.ProductId
+		}
+	}
+	return ""
+}
+
+func (x *MerchandisingRule) GetCategory() string {
+	if x != nil {
+		if x, ok := x.Target.(*MerchandisingRule_Category); ok {
+			return x.Category
+		}
+	}
+	return ""
+}
+
+func (x *MerchandisingRule) GetAction() MerchandisingRule_Action {
+	if x != nil {
+		return x.Action
+	}
+	return MerchandisingRule_ACTION_UNSPECIFIED
+}
+
+func (x *MerchandisingRule) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *MerchandisingRule) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+type isMerchandisingRule_Target interface {
+	isMerchandisingRule_Target()
+}
+
+type MerchandisingRule_ProductId struct {
+	ProductId string `protobuf:"bytes,3,opt,name=product_id,json=productId,proto3,oneof"`
+}
+
+type MerchandisingRule_Category struct {
+	Category string `protobuf:"bytes,4,opt,name=category,proto3,oneof"`
+}
+
+func (*MerchandisingRule_ProductId) isMerchandisingRule_Target() {}
+
+func (*MerchandisingRule_Category) isMerchandisingRule_Target() {}
+
+type ListMerchandisingRulesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rules         []*MerchandisingRule   `protobuf:"bytes,1,rep,name=rules,proto3" json:"rules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMerchandisingRulesResponse) Reset() {
+	*x = ListMerchandisingRulesResponse{}
+	mi := &file_demo_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMerchandisingRulesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMerchandisingRulesResponse) ProtoMessage() {}
+
+func (x *ListMerchandisingRulesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMerchandisingRulesResponse.ProtoReflect.Descriptor instead.
+func (*ListMerchandisingRulesResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *ListMerchandisingRulesResponse) GetRules() []*MerchandisingRule {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+type DeleteMerchandisingRuleRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteMerchandisingRuleRequest) Reset() {
+	*x = DeleteMerchandisingRuleRequest{}
+	mi := &file_demo_proto_msgTypes[40]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMerchandisingRuleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMerchandisingRuleRequest) ProtoMessage() {}
+
+func (x *DeleteMerchandisingRuleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[40]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMerchandisingRuleRequest.ProtoReflect.Descriptor instead.
+func (*DeleteMerchandisingRuleRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{40}
+}
+
+func (x *DeleteMerchandisingRuleRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+// Boosts the products of a category, and of its subcategories, in semantic
+// search rankings between start_time and end_time, for example winter
+// clothing from November to February.
+type Campaign struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Assigned by the server.
+	Id   int64  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Lowercased by the server.
+	Category string `protobuf:"bytes,3,opt,name=category,proto3" json:"category,omitempty"`
+	// Subtracted from the ranking score of the category's products, in
+	// (0, 2]; scores are weighted cosine distances, lower is better.
+	// Overlapping campaigns do not add up: the largest boost applies.
+	Boost         float64                `protobuf:"fixed64,4,opt,name=boost,proto3" json:"boost,omitempty"`
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Campaign) Reset() {
+	*x = Campaign{}
+	mi := &file_demo_proto_msgTypes[41]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Campaign) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Campaign) ProtoMessage() {}
+
+func (x *Campaign) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[41]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Campaign.ProtoReflect.Descriptor instead.
+func (*Campaign) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{41}
+}
+
+func (x *Campaign) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Campaign) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Campaign) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *Campaign) GetBoost() float64 {
+	if x != nil {
+		return x.Boost
+	}
+	return 0
+}
+
+func (x *Campaign) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *Campaign) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+type ListCampaignsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Campaigns     []*Campaign            `protobuf:"bytes,1,rep,name=campaigns,proto3" json:"campaigns,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCampaignsResponse) Reset() {
+	*x = ListCampaignsResponse{}
+	mi := &file_demo_proto_msgTypes[42]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCampaignsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCampaignsResponse) ProtoMessage() {}
+
+func (x *ListCampaignsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[42]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCampaignsResponse.ProtoReflect.Descriptor instead.
+func (*ListCampaignsResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{42}
+}
+
+func (x *ListCampaignsResponse) GetCampaigns() []*Campaign {
+	if x != nil {
+		return x.Campaigns
+	}
+	return nil
+}
+
+type ExpireCampaignRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpireCampaignRequest) Reset() {
+	*x = ExpireCampaignRequest{}
+	mi := &file_demo_proto_msgTypes[43]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpireCampaignRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpireCampaignRequest) ProtoMessage() {}
+
+func (x *ExpireCampaignRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[43]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpireCampaignRequest.ProtoReflect.Descriptor instead.
+func (*ExpireCampaignRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{43}
+}
+
+func (x *ExpireCampaignRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type CreateCategoryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Lowercased by the server.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Display name; defaults to the id.
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Parent category; empty for a top-level category.
+	ParentId      string `protobuf:"bytes,3,opt,name=parent_id,json=parentId,proto3" json:"parent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateCategoryRequest) Reset() {
+	*x = CreateCategoryRequest{}
+	mi := &file_demo_proto_msgTypes[44]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateCategoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateCategoryRequest) ProtoMessage() {}
+
+func (x *CreateCategoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[44]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateCategoryRequest.ProtoReflect.Descriptor instead.
+func (*CreateCategoryRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{44}
+}
+
+func (x *CreateCategoryRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CreateCategoryRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CreateCategoryRequest) GetParentId() string {
+	if x != nil {
+		return x.ParentId
+	}
+	return ""
+}
+
+type DeleteCategoryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteCategoryRequest) Reset() {
+	*x = DeleteCategoryRequest{}
+	mi := &file_demo_proto_msgTypes[45]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteCategoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteCategoryRequest) ProtoMessage() {}
+
+func (x *DeleteCategoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[45]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteCategoryRequest.ProtoReflect.Descriptor instead.
+func (*DeleteCategoryRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{45}
+}
+
+func (x *DeleteCategoryRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type StockLevel struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// A product, for products without variants, or a variant.
+	//
+	// Types that are valid to be assigned to Item:
+	//
+	//	*StockLevel_ProductId
+	//	*StockLevel_Sku
+	Item          isStockLevel_Item `protobuf_oneof:"item"`
+	Stock         int32             `protobuf:"varint,3,opt,name=stock,proto3" json:"stock,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StockLevel) Reset() {
+	*x = StockLevel{}
+	mi := &file_demo_proto_msgTypes[46]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StockLevel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StockLevel) ProtoMessage() {}
+
+func (x *StockLevel) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[46]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StockLevel.ProtoReflect.Descriptor instead.
+func (*StockLevel) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{46}
+}
+
+func (x *StockLevel) GetItem() isStockLevel_Item {
+	if x != nil {
+		return x.Item
+	}
+	return nil
+}
+
+func (x *StockLevel) GetProductId() string {
+	if x != nil {
+		if x, ok := x.Item.(*StockLevel_ProductId); ok {
+			return x.ProductId
+		}
+	}
+	return ""
+}
+
+func (x *StockLevel) GetSku() string {
+	if x != nil {
+		if x, ok := x.Item.(*StockLevel_Sku); ok {
+			return x.Sku
+		}
+	}
+	return ""
+}
+
+func (x *StockLevel) GetStock() int32 {
+	if x != nil {
+		return x.Stock
+	}
+	return 0
+}
+
+type isStockLevel_Item interface {
+	isStockLevel_Item()
+}
+
+type StockLevel_ProductId struct {
+	ProductId string `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3,oneof"`
+}
+
+type StockLevel_Sku struct {
+	Sku string `protobuf:"bytes,2,opt,name=sku,proto3,oneof"`
+}
+
+func (*StockLevel_ProductId) isStockLevel_Item() {}
+
+func (*StockLevel_Sku) isStockLevel_Item() {}
+
+type UpdateStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Levels        []*StockLevel          `protobuf:"bytes,1,rep,name=levels,proto3" json:"levels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateStockRequest) Reset() {
+	*x = UpdateStockRequest{}
+	mi := &file_demo_proto_msgTypes[47]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateStockRequest) ProtoMessage() {}
+
+func (x *UpdateStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[47]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateStockRequest.ProtoReflect.Descriptor instead.
+func (*UpdateStockRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{47}
+}
+
+func (x *UpdateStockRequest) GetLevels() []*StockLevel {
+	if x != nil {
+		return x.Levels
+	}
+	return nil
+}
+
+type UpdateStockResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Updated int32                  `protobuf:"varint,1,opt,name=updated,proto3" json:"updated,omitempty"`
+	// Product IDs and SKUs that matched nothing; the other levels are
+	// still applied.
+	NotFound      []string `protobuf:"bytes,2,rep,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateStockResponse) Reset() {
+	*x = UpdateStockResponse{}
+	mi := &file_demo_proto_msgTypes[48]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateStockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateStockResponse) ProtoMessage() {}
+
+func (x *UpdateStockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[48]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateStockResponse.ProtoReflect.Descriptor instead.
+func (*UpdateStockResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{48}
+}
+
+func (x *UpdateStockResponse) GetUpdated() int32 {
+	if x != nil {
+		return x.Updated
+	}
+	return 0
+}
+
+func (x *UpdateStockResponse) GetNotFound() []string {
+	if x != nil {
+		return x.NotFound
+	}
+	return nil
+}
+
+// Published to the PRODUCT_EVENTS_TOPIC Pub/Sub topic, in the protobuf JSON
+// encoding, after a write to the catalog commits. Messages also carry the
+// change and product_id as attributes, for subscription filters.
+type ProductChanged struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Change    ProductChanged_Change  `protobuf:"varint,2,opt,name=change,proto3,enum=hipstershop.ProductChanged_Change" json:"change,omitempty"`
+	// The product as written, for CREATED and UPDATED.
+	Product       *Product               `protobuf:"bytes,3,opt,name=product,proto3" json:"product,omitempty"`
+	ChangeTime    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=change_time,json=changeTime,proto3" json:"change_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProductChanged) Reset() {
+	*x = ProductChanged{}
+	mi := &file_demo_proto_msgTypes[49]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProductChanged) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProductChanged) ProtoMessage() {}
+
+func (x *ProductChanged) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[49]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProductChanged.ProtoReflect.Descriptor instead.
+func (*ProductChanged) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{49}
+}
+
+func (x *ProductChanged) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ProductChanged) GetChange() ProductChanged_Change {
+	if x != nil {
+		return x.Change
+	}
+	return ProductChanged_CHANGE_UNSPECIFIED
+}
+
+func (x *ProductChanged) GetProduct() *Product {
+	if x != nil {
+		return x.Product
+	}
+	return nil
+}
+
+func (x *ProductChanged) GetChangeTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ChangeTime
+	}
+	return nil
+}
+
+type GetQuoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       *Address               `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Items         []*CartItem            `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetQuoteRequest) Reset() {
+	*x = GetQuoteRequest{}
+	mi := &file_demo_proto_msgTypes[50]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetQuoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetQuoteRequest) ProtoMessage() {}
+
+func (x *GetQuoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[50]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetQuoteRequest.ProtoReflect.Descriptor instead.
+func (*GetQuoteRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{50}
+}
+
+func (x *GetQuoteRequest) GetAddress() *Address {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *GetQuoteRequest) GetItems() []*CartItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type GetQuoteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CostUsd       *Money                 `protobuf:"bytes,1,opt,name=cost_usd,json=costUsd,proto3" json:"cost_usd,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetQuoteResponse) Reset() {
+	*x = GetQuoteResponse{}
+	mi := &file_demo_proto_msgTypes[51]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetQuoteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetQuoteResponse) ProtoMessage() {}
+
+func (x *GetQuoteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[51]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetQuoteResponse.ProtoReflect.Descriptor instead.
+func (*GetQuoteResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{51}
+}
+
+func (x *GetQuoteResponse) GetCostUsd() *Money {
+	if x != nil {
+		return x.CostUsd
+	}
+	return nil
+}
+
+type ShipOrderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       *Address               `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Items         []*CartItem            `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShipOrderRequest) Reset() {
+	*x = ShipOrderRequest{}
+	mi := &file_demo_proto_msgTypes[52]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShipOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShipOrderRequest) ProtoMessage() {}
+
+func (x *ShipOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[52]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShipOrderRequest.ProtoReflect.Descriptor instead.
+func (*ShipOrderRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{52}
+}
+
+func (x *ShipOrderRequest) GetAddress() *Address {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *ShipOrderRequest) GetItems() []*CartItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type ShipOrderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TrackingId    string                 `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShipOrderResponse) Reset() {
+	*x = ShipOrderResponse{}
+	mi := &file_demo_proto_msgTypes[53]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShipOrderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShipOrderResponse) ProtoMessage() {}
+
+func (x *ShipOrderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[53]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShipOrderResponse.ProtoReflect.Descriptor instead.
+func (*ShipOrderResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{53}
+}
+
+func (x *ShipOrderResponse) GetTrackingId() string {
+	if x != nil {
+		return x.TrackingId
+	}
+	return ""
+}
+
+type Address struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StreetAddress string                 `protobuf:"bytes,1,opt,name=street_address,json=streetAddress,proto3" json:"street_address,omitempty"`
+	City          string                 `protobuf:"bytes,2,opt,name=city,proto3" json:"city,omitempty"`
+	State         string                 `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
+	Country       string                 `protobuf:"bytes,4,opt,name=country,proto3" json:"country,omitempty"`
+	ZipCode       int32                  `protobuf:"varint,5,opt,name=zip_code,json=zipCode,proto3" json:"zip_code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Address) Reset() {
+	*x = Address{}
+	mi := &file_demo_proto_msgTypes[54]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Address) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Address) ProtoMessage() {}
+
+func (x *Address) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[54]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Address.ProtoReflect.Descriptor instead.
+func (*Address) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{54}
+}
+
+func (x *Address) GetStreetAddress() string {
+	if x != nil {
+		return x.StreetAddress
+	}
+	return ""
+}
+
+func (x *Address) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Address) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Address) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *Address) GetZipCode() int32 {
+	if x != nil {
+		return x.ZipCode
+	}
+	return 0
+}
+
+// Represents an amount of money with its currency type.
+type Money struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The 3-letter currency code defined in ISO 4217.
+	CurrencyCode string `protobuf:"bytes,1,opt,name=currency_code,json=currencyCode,proto3" json:"currency_code,omitempty"`
+	// The whole units of the amount.
+	// For example if `currencyCode` is `"USD"`, then 1 unit is one US dollar.
+	Units int64 `protobuf:"varint,2,opt,name=units,proto3" json:"units,omitempty"`
+	// Number of nano (10^-9) units of the amount.
+	// The value must be between -999,999,999 and +999,999,999 inclusive.
+	// If `units` is positive, `nanos` must be positive or zero.
+	// If `units` is zero, `nanos` can be positive, zero, or negative.
+	// If `units` is negative, `nanos` must be negative or zero.
+	// For example $-1.75 is represented as `units`=-1 and `nanos`=-750,000,000.
+	Nanos         int32 `protobuf:"varint,3,opt,name=nanos,proto3" json:"nanos,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Money) Reset() {
+	*x = Money{}
+	mi := &file_demo_proto_msgTypes[55]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Money) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Money) ProtoMessage() {}
+
+func (x *Money) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[55]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Money.ProtoReflect.Descriptor instead.
+func (*Money) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{55}
+}
+
+func (x *Money) GetCurrencyCode() string {
+	if x != nil {
+		return x.CurrencyCode
+	}
+	return ""
+}
+
+func (x *Money) GetUnits() int64 {
+	if x != nil {
+		return x.Units
+	}
+	return 0
+}
+
+func (x *Money) GetNanos() int32 {
+	if x != nil {
+		return x.Nanos
+	}
+	return 0
+}
+
+type GetSupportedCurrenciesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The 3-letter currency code defined in ISO 4217.
+	CurrencyCodes []string `protobuf:"bytes,1,rep,name=currency_codes,json=currencyCodes,proto3" json:"currency_codes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSupportedCurrenciesResponse) Reset() {
+	*x = GetSupportedCurrenciesResponse{}
+	mi := &file_demo_proto_msgTypes[56]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSupportedCurrenciesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSupportedCurrenciesResponse) ProtoMessage() {}
+
+func (x *GetSupportedCurrenciesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[56]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSupportedCurrenciesResponse.ProtoReflect.Descriptor instead.
+func (*GetSupportedCurrenciesResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{56}
+}
+
+func (x *GetSupportedCurrenciesResponse) GetCurrencyCodes() []string {
+	if x != nil {
+		return x.CurrencyCodes
+	}
+	return nil
+}
+
+type CurrencyConversionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	From  *Money                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	// The 3-letter currency code defined in ISO 4217.
+	ToCode        string `protobuf:"bytes,2,opt,name=to_code,json=toCode,proto3" json:"to_code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CurrencyConversionRequest) Reset() {
+	*x = CurrencyConversionRequest{}
+	mi := &file_demo_proto_msgTypes[57]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CurrencyConversionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CurrencyConversionRequest) ProtoMessage() {}
+
+func (x *CurrencyConversionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[57]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CurrencyConversionRequest.ProtoReflect.Descriptor instead.
+func (*CurrencyConversionRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{57}
+}
+
+func (x *CurrencyConversionRequest) GetFrom() *Money {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *CurrencyConversionRequest) GetToCode() string {
+	if x != nil {
+		return x.ToCode
+	}
+	return ""
+}
+
+type CreditCardInfo struct {
+	state                     protoimpl.MessageState `protogen:"open.v1"`
+	CreditCardNumber          string                 `protobuf:"bytes,1,opt,name=credit_card_number,json=creditCardNumber,proto3" json:"credit_card_number,omitempty"`
+	CreditCardCvv             int32                  `protobuf:"varint,2,opt,name=credit_card_cvv,json=creditCardCvv,proto3" json:"credit_card_cvv,omitempty"`
+	CreditCardExpirationYear  int32                  `protobuf:"varint,3,opt,name=credit_card_expiration_year,json=creditCardExpirationYear,proto3" json:"credit_card_expiration_year,omitempty"`
+	CreditCardExpirationMonth int32                  `protobuf:"varint,4,opt,name=credit_card_expiration_month,json=creditCardExpirationMonth,proto3" json:"credit_card_expiration_month,omitempty"`
+	unknownFields             protoimpl.UnknownFields
+	sizeCache                 protoimpl.SizeCache
+}
+
+func (x *CreditCardInfo) Reset() {
+	*x = CreditCardInfo{}
+	mi := &file_demo_proto_msgTypes[58]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreditCardInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreditCardInfo) ProtoMessage() {}
+
+func (x *CreditCardInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[58]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreditCardInfo.ProtoReflect.Descriptor instead.
+func (*CreditCardInfo) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{58}
+}
+
+func (x *CreditCardInfo) GetCreditCardNumber() string {
+	if x != nil {
+		return x.CreditCardNumber
+	}
+	return ""
+}
+
+func (x *CreditCardInfo) GetCreditCardCvv() int32 {
+	if x != nil {
+		return x.CreditCardCvv
+	}
+	return 0
+}
+
+func (x *CreditCardInfo) GetCreditCardExpirationYear() int32 {
+	if x != nil {
+		return x.CreditCardExpirationYear
+	}
+	return 0
+}
+
+func (x *CreditCardInfo) GetCreditCardExpirationMonth() int32 {
+	if x != nil {
+		return x.CreditCardExpirationMonth
+	}
+	return 0
+}
+
+type ChargeRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Amount     *Money                 `protobuf:"bytes,1,opt,name=amount,proto3" json:"amount,omitempty"`
+	CreditCard *CreditCardInfo        `protobuf:"bytes,2,opt,name=credit_card,json=creditCard,proto3" json:"credit_card,omitempty"`
+	// Optional. Charges with the same key are charged once: a retry returns
+	// the transaction of the first.
+	IdempotencyKey string `protobuf:"bytes,3,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	// Only authorize the amount, to be charged later with Capture.
+	AuthorizeOnly bool `protobuf:"varint,4,opt,name=authorize_only,json=authorizeOnly,proto3" json:"authorize_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChargeRequest) Reset() {
+	*x = ChargeRequest{}
+	mi := &file_demo_proto_msgTypes[59]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChargeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChargeRequest) ProtoMessage() {}
+
+func (x *ChargeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[59]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChargeRequest.ProtoReflect.Descriptor instead.
+func (*ChargeRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{59}
+}
+
+func (x *ChargeRequest) GetAmount() *Money {
+	if x != nil {
+		return x.Amount
+	}
+	return nil
+}
+
+func (x *ChargeRequest) GetCreditCard() *CreditCardInfo {
+	if x != nil {
+		return x.CreditCard
+	}
+	return nil
+}
+
+func (x *ChargeRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *ChargeRequest) GetAuthorizeOnly() bool {
+	if x != nil {
+		return x.AuthorizeOnly
+	}
+	return false
+}
+
+type CaptureRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransactionId string                 `protobuf:"bytes,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CaptureRequest) Reset() {
+	*x = CaptureRequest{}
+	mi := &file_demo_proto_msgTypes[60]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CaptureRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CaptureRequest) ProtoMessage() {}
+
+func (x *CaptureRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[60]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CaptureRequest.ProtoReflect.Descriptor instead.
+func (*CaptureRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{60}
+}
+
+func (x *CaptureRequest) GetTransactionId() string {
+	if x != nil {
+		return x.TransactionId
+	}
+	return ""
+}
+
+type VoidRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransactionId string                 `protobuf:"bytes,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VoidRequest) Reset() {
+	*x = VoidRequest{}
+	mi := &file_demo_proto_msgTypes[61]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoidRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoidRequest) ProtoMessage() {}
+
+func (x *VoidRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[61]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoidRequest.ProtoReflect.Descriptor instead.
+func (*VoidRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{61}
+}
+
+func (x *VoidRequest) GetTransactionId() string {
+	if x != nil {
+		return x.TransactionId
+	}
+	return ""
+}
+
+type ChargeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransactionId string                 `protobuf:"bytes,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChargeResponse) Reset() {
+	*x = ChargeResponse{}
+	mi := &file_demo_proto_msgTypes[62]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChargeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChargeResponse) ProtoMessage() {}
+
+func (x *ChargeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[62]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChargeResponse.ProtoReflect.Descriptor instead.
+func (*ChargeResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{62}
+}
+
+func (x *ChargeResponse) GetTransactionId() string {
+	if x != nil {
+		return x.TransactionId
+	}
+	return ""
+}
+
+type OrderItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Item          *CartItem              `protobuf:"bytes,1,opt,name=item,proto3" json:"item,omitempty"`
+	Cost          *Money                 `protobuf:"bytes,2,opt,name=cost,proto3" json:"cost,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderItem) Reset() {
+	*x = OrderItem{}
+	mi := &file_demo_proto_msgTypes[63]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderItem) ProtoMessage() {}
+
+func (x *OrderItem) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[63]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderItem.ProtoReflect.Descriptor instead.
+func (*OrderItem) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{63}
+}
+
+func (x *OrderItem) GetItem() *CartItem {
+	if x != nil {
+		return x.Item
+	}
+	return nil
+}
+
+func (x *OrderItem) GetCost() *Money {
+	if x != nil {
+		return x.Cost
+	}
+	return nil
+}
+
+type OrderResult struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	OrderId            string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	ShippingTrackingId string                 `protobuf:"bytes,2,opt,name=shipping_tracking_id,json=shippingTrackingId,proto3" json:"shipping_tracking_id,omitempty"`
+	ShippingCost       *Money                 `protobuf:"bytes,3,opt,name=shipping_cost,json=shippingCost,proto3" json:"shipping_cost,omitempty"`
+	ShippingAddress    *Address               `protobuf:"bytes,4,opt,name=shipping_address,json=shippingAddress,proto3" json:"shipping_address,omitempty"`
+	Items              []*OrderItem           `protobuf:"bytes,5,rep,name=items,proto3" json:"items,omitempty"`
+	// The discount code applied, if any, and the amount it took off the
+	// items.
+	DiscountCode string `protobuf:"bytes,6,opt,name=discount_code,json=discountCode,proto3" json:"discount_code,omitempty"`
+	Discount     *Money `protobuf:"bytes,7,opt,name=discount,proto3" json:"discount,omitempty"`
+	// The tax charged, included in the amount charged, and its breakdown by
+	// jurisdiction.
+	Tax      *Money     `protobuf:"bytes,8,opt,name=tax,proto3" json:"tax,omitempty"`
+	TaxLines []*TaxLine `protobuf:"bytes,9,rep,name=tax_lines,json=taxLines,proto3" json:"tax_lines,omitempty"`
+	// The saved address shipped to, if one was picked.
+	AddressId string `protobuf:"bytes,10,opt,name=address_id,json=addressId,proto3" json:"address_id,omitempty"`
+	// paid, or under_review when fraud screening held the order for review.
+	Status        string `protobuf:"bytes,11,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderResult) Reset() {
+	*x = OrderResult{}
+	mi := &file_demo_proto_msgTypes[64]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderResult) ProtoMessage() {}
+
+func (x *OrderResult) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[64]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderResult.ProtoReflect.Descriptor instead.
+func (*OrderResult) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{64}
+}
+
+func (x *OrderResult) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *OrderResult) GetShippingTrackingId() string {
+	if x != nil {
+		return x.ShippingTrackingId
+	}
+	return ""
+}
+
+func (x *OrderResult) GetShippingCost() *Money {
+	if x != nil {
+		return x.ShippingCost
+	}
+	return nil
+}
+
+func (x *OrderResult) GetShippingAddress() *Address {
+	if x != nil {
+		return x.ShippingAddress
+	}
+	return nil
+}
+
+func (x *OrderResult) GetItems() []*OrderItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *OrderResult) GetDiscountCode() string {
+	if x != nil {
+		return x.DiscountCode
+	}
+	return ""
+}
+
+func (x *OrderResult) GetDiscount() *Money {
+	if x != nil {
+		return x.Discount
+	}
+	return nil
+}
+
+func (x *OrderResult) GetTax() *Money {
+	if x != nil {
+		return x.Tax
+	}
+	return nil
+}
+
+func (x *OrderResult) GetTaxLines() []*TaxLine {
+	if x != nil {
+		return x.TaxLines
+	}
+	return nil
+}
+
+func (x *OrderResult) GetAddressId() string {
+	if x != nil {
+		return x.AddressId
+	}
+	return ""
+}
+
+func (x *OrderResult) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+// The tax of one jurisdiction, such as a country or a state, on an order.
+type TaxLine struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jurisdiction  string                 `protobuf:"bytes,1,opt,name=jurisdiction,proto3" json:"jurisdiction,omitempty"`
+	Amount        *Money                 `protobuf:"bytes,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaxLine) Reset() {
+	*x = TaxLine{}
+	mi := &file_demo_proto_msgTypes[65]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaxLine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaxLine) ProtoMessage() {}
+
+func (x *TaxLine) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[65]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaxLine.ProtoReflect.Descriptor instead.
+func (*TaxLine) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{65}
+}
+
+func (x *TaxLine) GetJurisdiction() string {
+	if x != nil {
+		return x.Jurisdiction
+	}
+	return ""
+}
+
+func (x *TaxLine) GetAmount() *Money {
+	if x != nil {
+		return x.Amount
+	}
+	return nil
+}
+
+type SendOrderConfirmationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Email         string                 `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	Order         *OrderResult           `protobuf:"bytes,2,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendOrderConfirmationRequest) Reset() {
+	*x = SendOrderConfirmationRequest{}
+	mi := &file_demo_proto_msgTypes[66]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendOrderConfirmationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendOrderConfirmationRequest) ProtoMessage() {}
+
+func (x *SendOrderConfirmationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[66]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendOrderConfirmationRequest.ProtoReflect.Descriptor instead.
+func (*SendOrderConfirmationRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{66}
+}
+
+func (x *SendOrderConfirmationRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *SendOrderConfirmationRequest) GetOrder() *OrderResult {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+type PlaceOrderRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	UserId       string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	UserCurrency string                 `protobuf:"bytes,2,opt,name=user_currency,json=userCurrency,proto3" json:"user_currency,omitempty"`
+	Address      *Address               `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
+	Email        string                 `protobuf:"bytes,5,opt,name=email,proto3" json:"email,omitempty"`
+	CreditCard   *CreditCardInfo        `protobuf:"bytes,6,opt,name=credit_card,json=creditCard,proto3" json:"credit_card,omitempty"`
+	// Optional. Retries of a request with the same key, for the same user,
+	// return the order placed by the first instead of charging again.
+	IdempotencyKey string `protobuf:"bytes,7,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	// Optional. A discount code, which takes a percentage off the items.
+	// An unknown code fails the request with INVALID_ARGUMENT.
+	DiscountCode string `protobuf:"bytes,8,opt,name=discount_code,json=discountCode,proto3" json:"discount_code,omitempty"`
+	// Optional. One of the user's saved addresses to ship to, instead of
+	// address. An unknown address fails the request with NOT_FOUND.
+	AddressId     string `protobuf:"bytes,9,opt,name=address_id,json=addressId,proto3" json:"address_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlaceOrderRequest) Reset() {
+	*x = PlaceOrderRequest{}
+	mi := &file_demo_proto_msgTypes[67]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlaceOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlaceOrderRequest) ProtoMessage() {}
+
+func (x *PlaceOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[67]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlaceOrderRequest.ProtoReflect.Descriptor instead.
+func (*PlaceOrderRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{67}
+}
+
+func (x *PlaceOrderRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetUserCurrency() string {
+	if x != nil {
+		return x.UserCurrency
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetAddress() *Address {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *PlaceOrderRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetCreditCard() *CreditCardInfo {
+	if x != nil {
+		return x.CreditCard
+	}
+	return nil
+}
+
+func (x *PlaceOrderRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetDiscountCode() string {
+	if x != nil {
+		return x.DiscountCode
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetAddressId() string {
+	if x != nil {
+		return x.AddressId
+	}
+	return ""
+}
+
+type PlaceOrderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Order         *OrderResult           `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlaceOrderResponse) Reset() {
+	*x = PlaceOrderResponse{}
+	mi := &file_demo_proto_msgTypes[68]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlaceOrderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlaceOrderResponse) ProtoMessage() {}
+
+func (x *PlaceOrderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[68]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlaceOrderResponse.ProtoReflect.Descriptor instead.
+func (*PlaceOrderResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{68}
+}
+
+func (x *PlaceOrderResponse) GetOrder() *OrderResult {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+// A persisted order.
+type Order struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	OrderId string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	UserId  string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Email   string                 `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	// Including shipping.
+	Total              *Money `protobuf:"bytes,4,opt,name=total,proto3" json:"total,omitempty"`
+	ShippingTrackingId string `protobuf:"bytes,5,opt,name=shipping_tracking_id,json=shippingTrackingId,proto3" json:"shipping_tracking_id,omitempty"`
+	// The address on one line, as stored with the order.
+	ShippingAddress string                 `protobuf:"bytes,6,opt,name=shipping_address,json=shippingAddress,proto3" json:"shipping_address,omitempty"`
+	OrderTime       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=order_time,json=orderTime,proto3" json:"order_time,omitempty"`
+	Status          string                 `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`
+	// Set by GetOrder only; cost is the unit price.
+	Items []*OrderItem `protobuf:"bytes,9,rep,name=items,proto3" json:"items,omitempty"`
+	// Delivery of the confirmation email: pending, sent or failed. Empty for
+	// orders saved before confirmations were queued.
+	ConfirmationStatus string `protobuf:"bytes,10,opt,name=confirmation_status,json=confirmationStatus,proto3" json:"confirmation_status,omitempty"`
+	// The discount code applied, if any, and the amount it saved. Unset for
+	// orders saved before discounts were recorded.
+	DiscountCode string `protobuf:"bytes,11,opt,name=discount_code,json=discountCode,proto3" json:"discount_code,omitempty"`
+	Discount     *Money `protobuf:"bytes,12,opt,name=discount,proto3" json:"discount,omitempty"`
+	// The items before the discount, without shipping.
+	Subtotal *Money `protobuf:"bytes,13,opt,name=subtotal,proto3" json:"subtotal,omitempty"`
+	// The tax included in the total and its breakdown by jurisdiction. Unset
+	// for orders saved before tax was recorded.
+	Tax      *Money     `protobuf:"bytes,14,opt,name=tax,proto3" json:"tax,omitempty"`
+	TaxLines []*TaxLine `protobuf:"bytes,15,rep,name=tax_lines,json=taxLines,proto3" json:"tax_lines,omitempty"`
+	// The saved address the order was shipped to, if one was picked and it
+	// has not been deleted since.
+	AddressId     string `protobuf:"bytes,16,opt,name=address_id,json=addressId,proto3" json:"address_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Order) Reset() {
+	*x = Order{}
+	mi := &file_demo_proto_msgTypes[69]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Order) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Order) ProtoMessage() {}
+
+func (x *Order) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[69]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Order.ProtoReflect.Descriptor instead.
+func (*Order) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{69}
+}
+
+func (x *Order) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *Order) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Order) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *Order) GetTotal() *Money {
+	if x != nil {
+		return x.Total
+	}
+	return nil
+}
+
+func (x *Order) GetShippingTrackingId() string {
+	if x != nil {
+		return x.ShippingTrackingId
+	}
+	return ""
+}
+
+func (x *Order) GetShippingAddress() string {
+	if x != nil {
+		return x.ShippingAddress
+	}
+	return ""
+}
+
+func (x *Order) GetOrderTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OrderTime
+	}
+	return nil
+}
+
+func (x *Order) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Order) GetItems() []*OrderItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Order) GetConfirmationStatus() string {
+	if x != nil {
+		return x.ConfirmationStatus
+	}
+	return ""
+}
+
+func (x *Order) GetDiscountCode() string {
+	if x != nil {
+		return x.DiscountCode
+	}
+	return ""
+}
+
+func (x *Order) GetDiscount() *Money {
+	if x != nil {
+		return x.Discount
+	}
+	return nil
+}
+
+func (x *Order) GetSubtotal() *Money {
+	if x != nil {
+		return x.Subtotal
+	}
+	return nil
+}
+
+func (x *Order) GetTax() *Money {
+	if x != nil {
+		return x.Tax
+	}
+	return nil
+}
+
+func (x *Order) GetTaxLines() []*TaxLine {
+	if x != nil {
+		return x.TaxLines
+	}
+	return nil
+}
+
+func (x *Order) GetAddressId() string {
+	if x != nil {
+		return x.AddressId
+	}
+	return ""
+}
+
+type GetOrderHistoryRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Orders per page: 20 when unset, at most 100.
+	PageSize int32 `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page; empty for the first page.
+	PageToken string `protobuf:"bytes,3,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// Only orders placed at or after start_time and before end_time. Either
+	// may be unset for an open range.
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderHistoryRequest) Reset() {
+	*x = GetOrderHistoryRequest{}
+	mi := &file_demo_proto_msgTypes[70]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderHistoryRequest) ProtoMessage() {}
+
+func (x *GetOrderHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[70]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderHistoryRequest.ProtoReflect.Descriptor instead.
+func (*GetOrderHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{70}
+}
+
+func (x *GetOrderHistoryRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *GetOrderHistoryRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *GetOrderHistoryRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *GetOrderHistoryRequest) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *GetOrderHistoryRequest) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+type GetOrderHistoryResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Orders []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	// Empty on the last page.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderHistoryResponse) Reset() {
+	*x = GetOrderHistoryResponse{}
+	mi := &file_demo_proto_msgTypes[71]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderHistoryResponse) ProtoMessage() {}
+
+func (x *GetOrderHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[71]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderHistoryResponse.ProtoReflect.Descriptor instead.
+func (*GetOrderHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{71}
+}
+
+func (x *GetOrderHistoryResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+func (x *GetOrderHistoryResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type GetOrderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	OrderId       string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderRequest) Reset() {
+	*x = GetOrderRequest{}
+	mi := &file_demo_proto_msgTypes[72]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderRequest) ProtoMessage() {}
+
+func (x *GetOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[72]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderRequest.ProtoReflect.Descriptor instead.
+func (*GetOrderRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{72}
+}
+
+func (x *GetOrderRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *GetOrderRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+type GetOrderByTrackingIDRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TrackingId    string                 `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderByTrackingIDRequest) Reset() {
+	*x = GetOrderByTrackingIDRequest{}
+	mi := &file_demo_proto_msgTypes[73]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderByTrackingIDRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderByTrackingIDRequest) ProtoMessage() {}
+
+func (x *GetOrderByTrackingIDRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[73]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderByTrackingIDRequest.ProtoReflect.Descriptor instead.
+func (*GetOrderByTrackingIDRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{73}
+}
+
+func (x *GetOrderByTrackingIDRequest) GetTrackingId() string {
+	if x != nil {
+		return x.TrackingId
+	}
+	return ""
+}
+
+type GetUserOrderStatsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Products to return in top_products: 5 when unset, at most 20.
+	TopProducts   int32 `protobuf:"varint,2,opt,name=top_products,json=topProducts,proto3" json:"top_products,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUserOrderStatsRequest) Reset() {
+	*x = GetUserOrderStatsRequest{}
+	mi := &file_demo_proto_msgTypes[74]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUserOrderStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUserOrderStatsRequest) ProtoMessage() {}
+
+func (x *GetUserOrderStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[74]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUserOrderStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetUserOrderStatsRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{74}
+}
+
+func (x *GetUserOrderStatsRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *GetUserOrderStatsRequest) GetTopProducts() int32 {
+	if x != nil {
+		return x.TopProducts
+	}
+	return 0
+}
+
+type UserOrderStats struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	UserId      string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	TotalOrders int64                  `protobuf:"varint,2,opt,name=total_orders,json=totalOrders,proto3" json:"total_orders,omitempty"`
+	// The total of the orders in each currency they were placed in, sorted
+	// by currency code.
+	LifetimeSpend []*Money `protobuf:"bytes,3,rep,name=lifetime_spend,json=lifetimeSpend,proto3" json:"lifetime_spend,omitempty"`
+	// Unset without orders.
+	FirstOrderTime *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=first_order_time,json=firstOrderTime,proto3" json:"first_order_time,omitempty"`
+	LastOrderTime  *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=last_order_time,json=lastOrderTime,proto3" json:"last_order_time,omitempty"`
+	// The products ordered most, by units.
+	TopProducts   []*ProductOrderStats `protobuf:"bytes,6,rep,name=top_products,json=topProducts,proto3" json:"top_products,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserOrderStats) Reset() {
+	*x = UserOrderStats{}
+	mi := &file_demo_proto_msgTypes[75]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserOrderStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserOrderStats) ProtoMessage() {}
+
+func (x *UserOrderStats) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[75]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserOrderStats.ProtoReflect.Descriptor instead.
+func (*UserOrderStats) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{75}
+}
+
+func (x *UserOrderStats) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *UserOrderStats) GetTotalOrders() int64 {
+	if x != nil {
+		return x.TotalOrders
+	}
+	return 0
+}
+
+func (x *UserOrderStats) GetLifetimeSpend() []*Money {
+	if x != nil {
+		return x.LifetimeSpend
+	}
+	return nil
+}
+
+func (x *UserOrderStats) GetFirstOrderTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FirstOrderTime
+	}
+	return nil
+}
+
+func (x *UserOrderStats) GetLastOrderTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastOrderTime
+	}
+	return nil
+}
+
+func (x *UserOrderStats) GetTopProducts() []*ProductOrderStats {
+	if x != nil {
+		return x.TopProducts
+	}
+	return nil
+}
+
+type ProductOrderStats struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	// Units ordered across all orders.
+	Quantity int64 `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// Orders that contain the product.
+	Orders        int64 `protobuf:"varint,3,opt,name=orders,proto3" json:"orders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProductOrderStats) Reset() {
+	*x = ProductOrderStats{}
+	mi := &file_demo_proto_msgTypes[76]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProductOrderStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProductOrderStats) ProtoMessage() {}
+
+func (x *ProductOrderStats) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[76]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProductOrderStats.ProtoReflect.Descriptor instead.
+func (*ProductOrderStats) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{76}
+}
+
+func (x *ProductOrderStats) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ProductOrderStats) GetQuantity() int64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *ProductOrderStats) GetOrders() int64 {
+	if x != nil {
+		return x.Orders
+	}
+	return 0
+}
+
+type ReorderRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	UserId  string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	OrderId string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	// Add the items that can be reordered to the user's cart, on top of what
+	// is already in it.
+	AddToCart     bool `protobuf:"varint,3,opt,name=add_to_cart,json=addToCart,proto3" json:"add_to_cart,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReorderRequest) Reset() {
+	*x = ReorderRequest{}
+	mi := &file_demo_proto_msgTypes[77]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReorderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReorderRequest) ProtoMessage() {}
+
+func (x *ReorderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[77]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReorderRequest.ProtoReflect.Descriptor instead.
+func (*ReorderRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{77}
+}
+
+func (x *ReorderRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ReorderRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *ReorderRequest) GetAddToCart() bool {
+	if x != nil {
+		return x.AddToCart
+	}
+	return false
+}
+
+type ReorderResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The items that can be reordered, in order, with quantities capped at
+	// the stock available.
+	Items []*CartItem `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	// The items, or units of them, that cannot be reordered.
+	Unavailable   []*ReorderUnavailableItem `protobuf:"bytes,2,rep,name=unavailable,proto3" json:"unavailable,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReorderResponse) Reset() {
+	*x = ReorderResponse{}
+	mi := &file_demo_proto_msgTypes[78]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReorderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReorderResponse) ProtoMessage() {}
+
+func (x *ReorderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[78]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReorderResponse.ProtoReflect.Descriptor instead.
+func (*ReorderResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{78}
+}
+
+func (x *ReorderResponse) GetItems() []*CartItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *ReorderResponse) GetUnavailable() []*ReorderUnavailableItem {
+	if x != nil {
+		return x.Unavailable
+	}
+	return nil
+}
+
+type ReorderUnavailableItem struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	// Units that cannot be reordered.
+	Quantity int32 `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// not_found, discontinued, unavailable or out_of_stock.
+	Reason        string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReorderUnavailableItem) Reset() {
+	*x = ReorderUnavailableItem{}
+	mi := &file_demo_proto_msgTypes[79]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReorderUnavailableItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReorderUnavailableItem) ProtoMessage() {}
+
+func (x *ReorderUnavailableItem) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[79]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReorderUnavailableItem.ProtoReflect.Descriptor instead.
+func (*ReorderUnavailableItem) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{79}
+}
+
+func (x *ReorderUnavailableItem) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ReorderUnavailableItem) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *ReorderUnavailableItem) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ExportUserDataRequest struct {
+	state         protoimpl.MessageState       `protogen:"open.v1"`
+	UserId        string                       `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Format        ExportUserDataRequest_Format `protobuf:"varint,2,opt,name=format,proto3,enum=hipstershop.ExportUserDataRequest_Format" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportUserDataRequest) Reset() {
+	*x = ExportUserDataRequest{}
+	mi := &file_demo_proto_msgTypes[80]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportUserDataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportUserDataRequest) ProtoMessage() {}
+
+func (x *ExportUserDataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[80]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportUserDataRequest.ProtoReflect.Descriptor instead.
+func (*ExportUserDataRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{80}
+}
+
+func (x *ExportUserDataRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ExportUserDataRequest) GetFormat() ExportUserDataRequest_Format {
+	if x != nil {
+		return x.Format
+	}
+	return ExportUserDataRequest_JSON
+}
+
+type ExportUserDataResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Data  []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// application/json or text/csv.
+	ContentType   string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportUserDataResponse) Reset() {
+	*x = ExportUserDataResponse{}
+	mi := &file_demo_proto_msgTypes[81]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportUserDataResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportUserDataResponse) ProtoMessage() {}
+
+func (x *ExportUserDataResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[81]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportUserDataResponse.ProtoReflect.Descriptor instead.
+func (*ExportUserDataResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{81}
+}
+
+func (x *ExportUserDataResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ExportUserDataResponse) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+type DeleteUserDataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteUserDataRequest) Reset() {
+	*x = DeleteUserDataRequest{}
+	mi := &file_demo_proto_msgTypes[82]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteUserDataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteUserDataRequest) ProtoMessage() {}
+
+func (x *DeleteUserDataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[82]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteUserDataRequest.ProtoReflect.Descriptor instead.
+func (*DeleteUserDataRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{82}
+}
+
+func (x *DeleteUserDataRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type DeleteUserDataResponse struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	OrdersAnonymized int32                  `protobuf:"varint,1,opt,name=orders_anonymized,json=ordersAnonymized,proto3" json:"orders_anonymized,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *DeleteUserDataResponse) Reset() {
+	*x = DeleteUserDataResponse{}
+	mi := &file_demo_proto_msgTypes[83]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteUserDataResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteUserDataResponse) ProtoMessage() {}
+
+func (x *DeleteUserDataResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[83]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteUserDataResponse.ProtoReflect.Descriptor instead.
+func (*DeleteUserDataResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{83}
+}
+
+func (x *DeleteUserDataResponse) GetOrdersAnonymized() int32 {
+	if x != nil {
+		return x.OrdersAnonymized
+	}
+	return 0
+}
+
+// A shipping address in a user's address book.
+type SavedAddress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AddressId     string                 `protobuf:"bytes,1,opt,name=address_id,json=addressId,proto3" json:"address_id,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Address       *Address               `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
+	IsDefault     bool                   `protobuf:"varint,4,opt,name=is_default,json=isDefault,proto3" json:"is_default,omitempty"`
+	CreateTime    *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SavedAddress) Reset() {
+	*x = SavedAddress{}
+	mi := &file_demo_proto_msgTypes[84]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SavedAddress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SavedAddress) ProtoMessage() {}
+
+func (x *SavedAddress) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[84]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SavedAddress.ProtoReflect.Descriptor instead.
+func (*SavedAddress) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{84}
+}
+
+func (x *SavedAddress) GetAddressId() string {
+	if x != nil {
+		return x.AddressId
+	}
+	return ""
+}
+
+func (x *SavedAddress) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SavedAddress) GetAddress() *Address {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *SavedAddress) GetIsDefault() bool {
+	if x != nil {
+		return x.IsDefault
+	}
+	return false
+}
+
+func (x *SavedAddress) GetCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateTime
+	}
+	return nil
+}
+
+type AddAddressRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	UserId  string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Address *Address               `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	// Make the address the default. A user's first address is the default
+	// regardless.
+	IsDefault     bool `protobuf:"varint,3,opt,name=is_default,json=isDefault,proto3" json:"is_default,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddAddressRequest) Reset() {
+	*x = AddAddressRequest{}
+	mi := &file_demo_proto_msgTypes[85]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddAddressRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddAddressRequest) ProtoMessage() {}
+
+func (x *AddAddressRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[85]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddAddressRequest.ProtoReflect.Descriptor instead.
+func (*AddAddressRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{85}
+}
+
+func (x *AddAddressRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *AddAddressRequest) GetAddress() *Address {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *AddAddressRequest) GetIsDefault() bool {
+	if x != nil {
+		return x.IsDefault
+	}
+	return false
+}
+
+type ListAddressesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAddressesRequest) Reset() {
+	*x = ListAddressesRequest{}
+	mi := &file_demo_proto_msgTypes[86]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAddressesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAddressesRequest) ProtoMessage() {}
+
+func (x *ListAddressesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[86]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAddressesRequest.ProtoReflect.Descriptor instead.
+func (*ListAddressesRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{86}
+}
+
+func (x *ListAddressesRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type ListAddressesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addresses     []*SavedAddress        `protobuf:"bytes,1,rep,name=addresses,proto3" json:"addresses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAddressesResponse) Reset() {
+	*x = ListAddressesResponse{}
+	mi := &file_demo_proto_msgTypes[87]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAddressesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAddressesResponse) ProtoMessage() {}
+
+func (x *ListAddressesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[87]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAddressesResponse.ProtoReflect.Descriptor instead.
+func (*ListAddressesResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{87}
+}
+
+func (x *ListAddressesResponse) GetAddresses() []*SavedAddress {
+	if x != nil {
+		return x.Addresses
+	}
+	return nil
+}
+
+type DeleteAddressRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	AddressId     string                 `protobuf:"bytes,2,opt,name=address_id,json=addressId,proto3" json:"address_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteAddressRequest) Reset() {
+	*x = DeleteAddressRequest{}
+	mi := &file_demo_proto_msgTypes[88]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteAddressRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteAddressRequest) ProtoMessage() {}
+
+func (x *DeleteAddressRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[88]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteAddressRequest.ProtoReflect.Descriptor instead.
+func (*DeleteAddressRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{88}
+}
+
+func (x *DeleteAddressRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *DeleteAddressRequest) GetAddressId() string {
+	if x != nil {
+		return x.AddressId
+	}
+	return ""
+}
+
+type SetDefaultAddressRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	AddressId     string                 `protobuf:"bytes,2,opt,name=address_id,json=addressId,proto3" json:"address_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetDefaultAddressRequest) Reset() {
+	*x = SetDefaultAddressRequest{}
+	mi := &file_demo_proto_msgTypes[89]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDefaultAddressRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDefaultAddressRequest) ProtoMessage() {}
+
+func (x *SetDefaultAddressRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[89]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDefaultAddressRequest.ProtoReflect.Descriptor instead.
+func (*SetDefaultAddressRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{89}
+}
+
+func (x *SetDefaultAddressRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SetDefaultAddressRequest) GetAddressId() string {
+	if x != nil {
+		return x.AddressId
+	}
+	return ""
+}
+
+type ShipmentItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Quantity      int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShipmentItem) Reset() {
+	*x = ShipmentItem{}
+	mi := &file_demo_proto_msgTypes[90]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShipmentItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShipmentItem) ProtoMessage() {}
+
+func (x *ShipmentItem) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[90]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShipmentItem.ProtoReflect.Descriptor instead.
+func (*ShipmentItem) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{90}
+}
+
+func (x *ShipmentItem) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ShipmentItem) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+// A parcel with some of the items of an order.
+type Shipment struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	ShipmentId string                 `protobuf:"bytes,1,opt,name=shipment_id,json=shipmentId,proto3" json:"shipment_id,omitempty"`
+	OrderId    string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	TrackingId string                 `protobuf:"bytes,3,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	Carrier    string                 `protobuf:"bytes,4,opt,name=carrier,proto3" json:"carrier,omitempty"`
+	// shipped or delivered.
+	Status        string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	Items         []*ShipmentItem        `protobuf:"bytes,6,rep,name=items,proto3" json:"items,omitempty"`
+	CreateTime    *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	UpdateTime    *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=update_time,json=updateTime,proto3" json:"update_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Shipment) Reset() {
+	*x = Shipment{}
+	mi := &file_demo_proto_msgTypes[91]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Shipment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Shipment) ProtoMessage() {}
+
+func (x *Shipment) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[91]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Shipment.ProtoReflect.Descriptor instead.
+func (*Shipment) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{91}
+}
+
+func (x *Shipment) GetShipmentId() string {
+	if x != nil {
+		return x.ShipmentId
+	}
+	return ""
+}
+
+func (x *Shipment) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *Shipment) GetTrackingId() string {
+	if x != nil {
+		return x.TrackingId
+	}
+	return ""
+}
+
+func (x *Shipment) GetCarrier() string {
+	if x != nil {
+		return x.Carrier
+	}
+	return ""
+}
+
+func (x *Shipment) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Shipment) GetItems() []*ShipmentItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Shipment) GetCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateTime
+	}
+	return nil
+}
+
+func (x *Shipment) GetUpdateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdateTime
+	}
+	return nil
+}
+
+type CreateShipmentRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	OrderId    string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	TrackingId string                 `protobuf:"bytes,2,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	// Optional.
+	Carrier       string          `protobuf:"bytes,3,opt,name=carrier,proto3" json:"carrier,omitempty"`
+	Items         []*ShipmentItem `protobuf:"bytes,4,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateShipmentRequest) Reset() {
+	*x = CreateShipmentRequest{}
+	mi := &file_demo_proto_msgTypes[92]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateShipmentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateShipmentRequest) ProtoMessage() {}
+
+func (x *CreateShipmentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[92]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateShipmentRequest.ProtoReflect.Descriptor instead.
+func (*CreateShipmentRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{92}
+}
+
+func (x *CreateShipmentRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *CreateShipmentRequest) GetTrackingId() string {
+	if x != nil {
+		return x.TrackingId
+	}
+	return ""
+}
+
+func (x *CreateShipmentRequest) GetCarrier() string {
+	if x != nil {
+		return x.Carrier
+	}
+	return ""
+}
+
+func (x *CreateShipmentRequest) GetItems() []*ShipmentItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type UpdateShipmentStatusRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	ShipmentId string                 `protobuf:"bytes,1,opt,name=shipment_id,json=shipmentId,proto3" json:"shipment_id,omitempty"`
+	// delivered.
+	Status        string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateShipmentStatusRequest) Reset() {
+	*x = UpdateShipmentStatusRequest{}
+	mi := &file_demo_proto_msgTypes[93]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateShipmentStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateShipmentStatusRequest) ProtoMessage() {}
+
+func (x *UpdateShipmentStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[93]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateShipmentStatusRequest.ProtoReflect.Descriptor instead.
+func (*UpdateShipmentStatusRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{93}
+}
+
+func (x *UpdateShipmentStatusRequest) GetShipmentId() string {
+	if x != nil {
+		return x.ShipmentId
+	}
+	return ""
+}
+
+func (x *UpdateShipmentStatusRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type ListShipmentsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	OrderId       string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListShipmentsRequest) Reset() {
+	*x = ListShipmentsRequest{}
+	mi := &file_demo_proto_msgTypes[94]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListShipmentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListShipmentsRequest) ProtoMessage() {}
+
+func (x *ListShipmentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[94]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListShipmentsRequest.ProtoReflect.Descriptor instead.
+func (*ListShipmentsRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{94}
+}
+
+func (x *ListShipmentsRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ListShipmentsRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+// How far an item of an order is fulfilled across its shipments.
+type ItemFulfillment struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	// Units ordered.
+	Quantity int32 `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// Units in shipments, delivered or not.
+	ShippedQuantity int32 `protobuf:"varint,3,opt,name=shipped_quantity,json=shippedQuantity,proto3" json:"shipped_quantity,omitempty"`
+	// Units in delivered shipments.
+	DeliveredQuantity int32 `protobuf:"varint,4,opt,name=delivered_quantity,json=deliveredQuantity,proto3" json:"delivered_quantity,omitempty"`
+	// unshipped, partially_shipped, shipped or delivered.
+	Status        string `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ItemFulfillment) Reset() {
+	*x = ItemFulfillment{}
+	mi := &file_demo_proto_msgTypes[95]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ItemFulfillment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ItemFulfillment) ProtoMessage() {}
+
+func (x *ItemFulfillment) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[95]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ItemFulfillment.ProtoReflect.Descriptor instead.
+func (*ItemFulfillment) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{95}
+}
+
+func (x *ItemFulfillment) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ItemFulfillment) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *ItemFulfillment) GetShippedQuantity() int32 {
+	if x != nil {
+		return x.ShippedQuantity
+	}
+	return 0
+}
+
+func (x *ItemFulfillment) GetDeliveredQuantity() int32 {
+	if x != nil {
+		return x.DeliveredQuantity
+	}
+	return 0
+}
+
+func (x *ItemFulfillment) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type ListShipmentsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Oldest first.
+	Shipments []*Shipment `protobuf:"bytes,1,rep,name=shipments,proto3" json:"shipments,omitempty"`
+	// In the order of the order's items.
+	Items         []*ItemFulfillment `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListShipmentsResponse) Reset() {
+	*x = ListShipmentsResponse{}
+	mi := &file_demo_proto_msgTypes[96]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListShipmentsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListShipmentsResponse) ProtoMessage() {}
+
+func (x *ListShipmentsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[96]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListShipmentsResponse.ProtoReflect.Descriptor instead.
+func (*ListShipmentsResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{96}
+}
+
+func (x *ListShipmentsResponse) GetShipments() []*Shipment {
+	if x != nil {
+		return x.Shipments
+	}
+	return nil
+}
+
+func (x *ListShipmentsResponse) GetItems() []*ItemFulfillment {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type ClaimOrdersRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// The user's verified email, matched case-insensitively.
+	Email string `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	// Proof that the user owns the email, signed with the secret shared with
+	// checkout (EMAIL_CLAIM_SECRET).
+	EmailToken    string `protobuf:"bytes,3,opt,name=email_token,json=emailToken,proto3" json:"email_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClaimOrdersRequest) Reset() {
+	*x = ClaimOrdersRequest{}
+	mi := &file_demo_proto_msgTypes[97]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClaimOrdersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClaimOrdersRequest) ProtoMessage() {}
+
+func (x *ClaimOrdersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[97]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClaimOrdersRequest.ProtoReflect.Descriptor instead.
+func (*ClaimOrdersRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{97}
+}
+
+func (x *ClaimOrdersRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ClaimOrdersRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *ClaimOrdersRequest) GetEmailToken() string {
+	if x != nil {
+		return x.EmailToken
+	}
+	return ""
+}
+
+type ClaimOrdersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrdersClaimed int32                  `protobuf:"varint,1,opt,name=orders_claimed,json=ordersClaimed,proto3" json:"orders_claimed,omitempty"`
+	OrderIds      []string               `protobuf:"bytes,2,rep,name=order_ids,json=orderIds,proto3" json:"order_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClaimOrdersResponse) Reset() {
+	*x = ClaimOrdersResponse{}
+	mi := &file_demo_proto_msgTypes[98]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClaimOrdersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClaimOrdersResponse) ProtoMessage() {}
+
+func (x *ClaimOrdersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[98]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClaimOrdersResponse.ProtoReflect.Descriptor instead.
+func (*ClaimOrdersResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{98}
+}
+
+func (x *ClaimOrdersResponse) GetOrdersClaimed() int32 {
+	if x != nil {
+		return x.OrdersClaimed
+	}
+	return 0
+}
+
+func (x *ClaimOrdersResponse) GetOrderIds() []string {
+	if x != nil {
+		return x.OrderIds
+	}
+	return nil
+}
+
+type SearchOrdersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Matched exactly, but case-insensitively.
+	Email string `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	// One of pending, paid, under_review, shipped, delivered, cancelled or
+	// refunded.
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// Only orders placed at or after start_time and before end_time.
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime   *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	// Only orders with an item of the product.
+	ProductId string `protobuf:"bytes,5,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	// Only orders in the currency of the bounds with a total within them,
+	// inclusive. When both are set they must be in the same currency.
+	MinTotal *Money `protobuf:"bytes,6,opt,name=min_total,json=minTotal,proto3" json:"min_total,omitempty"`
+	MaxTotal *Money `protobuf:"bytes,7,opt,name=max_total,json=maxTotal,proto3" json:"max_total,omitempty"`
+	// Orders per page: 20 when unset, at most 100.
+	PageSize int32 `protobuf:"varint,8,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page, searched with the same filters
+	// and sorting; empty for the first page.
+	PageToken string                     `protobuf:"bytes,9,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	SortBy    SearchOrdersRequest_SortBy `protobuf:"varint,10,opt,name=sort_by,json=sortBy,proto3,enum=hipstershop.SearchOrdersRequest_SortBy" json:"sort_by,omitempty"`
+	// Smallest or oldest first; largest or newest first by default.
+	Ascending     bool `protobuf:"varint,11,opt,name=ascending,proto3" json:"ascending,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchOrdersRequest) Reset() {
+	*x = SearchOrdersRequest{}
+	mi := &file_demo_proto_msgTypes[99]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchOrdersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchOrdersRequest) ProtoMessage() {}
+
+func (x *SearchOrdersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[99]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchOrdersRequest.ProtoReflect.Descriptor instead.
+func (*SearchOrdersRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{99}
+}
+
+func (x *SearchOrdersRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *SearchOrdersRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SearchOrdersRequest) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *SearchOrdersRequest) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *SearchOrdersRequest) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *SearchOrdersRequest) GetMinTotal() *Money {
+	if x != nil {
+		return x.MinTotal
+	}
+	return nil
+}
+
+func (x *SearchOrdersRequest) GetMaxTotal() *Money {
+	if x != nil {
+		return x.MaxTotal
+	}
+	return nil
+}
+
+func (x *SearchOrdersRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *SearchOrdersRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *SearchOrdersRequest) GetSortBy() SearchOrdersRequest_SortBy {
+	if x != nil {
+		return x.SortBy
+	}
+	return SearchOrdersRequest_ORDER_TIME
+}
+
+func (x *SearchOrdersRequest) GetAscending() bool {
+	if x != nil {
+		return x.Ascending
+	}
+	return false
+}
+
+type SearchOrdersResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Orders []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	// Empty on the last page.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchOrdersResponse) Reset() {
+	*x = SearchOrdersResponse{}
+	mi := &file_demo_proto_msgTypes[100]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchOrdersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchOrdersResponse) ProtoMessage() {}
+
+func (x *SearchOrdersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[100]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchOrdersResponse.ProtoReflect.Descriptor instead.
+func (*SearchOrdersResponse) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{100}
+}
+
+func (x *SearchOrdersResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+func (x *SearchOrdersResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type UpdateOrderStatusRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	OrderId string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	// One of pending, paid, under_review, shipped, delivered, cancelled or
+	// refunded.
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// Why the status changed, kept in the order's status history.
+	Reason        string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateOrderStatusRequest) Reset() {
+	*x = UpdateOrderStatusRequest{}
+	mi := &file_demo_proto_msgTypes[101]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateOrderStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateOrderStatusRequest) ProtoMessage() {}
+
+func (x *UpdateOrderStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[101]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateOrderStatusRequest.ProtoReflect.Descriptor instead.
+func (*UpdateOrderStatusRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{101}
+}
+
+func (x *UpdateOrderStatusRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *UpdateOrderStatusRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *UpdateOrderStatusRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type CancelOrderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	OrderId       string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelOrderRequest) Reset() {
+	*x = CancelOrderRequest{}
+	mi := &file_demo_proto_msgTypes[102]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelOrderRequest) ProtoMessage() {}
+
+func (x *CancelOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[102]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelOrderRequest.ProtoReflect.Descriptor instead.
+func (*CancelOrderRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{102}
+}
+
+func (x *CancelOrderRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *CancelOrderRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *CancelOrderRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ReturnItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Quantity      int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReturnItem) Reset() {
+	*x = ReturnItem{}
+	mi := &file_demo_proto_msgTypes[103]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReturnItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReturnItem) ProtoMessage() {}
+
+func (x *ReturnItem) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[103]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReturnItem.ProtoReflect.Descriptor instead.
+func (*ReturnItem) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{103}
+}
+
+func (x *ReturnItem) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ReturnItem) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+// A return of items of an order.
+type OrderReturn struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	ReturnId string                 `protobuf:"bytes,1,opt,name=return_id,json=returnId,proto3" json:"return_id,omitempty"`
+	OrderId  string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	UserId   string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Items    []*ReturnItem          `protobuf:"bytes,4,rep,name=items,proto3" json:"items,omitempty"`
+	Reason   string                 `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`
+	// requested or approved.
+	Status string `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+	// The amount refunded; set once the return is approved.
+	Refund        *Money                 `protobuf:"bytes,7,opt,name=refund,proto3" json:"refund,omitempty"`
+	CreateTime    *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderReturn) Reset() {
+	*x = OrderReturn{}
+	mi := &file_demo_proto_msgTypes[104]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderReturn) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderReturn) ProtoMessage() {}
+
+func (x *OrderReturn) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[104]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderReturn.ProtoReflect.Descriptor instead.
+func (*OrderReturn) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{104}
+}
+
+func (x *OrderReturn) GetReturnId() string {
+	if x != nil {
+		return x.ReturnId
+	}
+	return ""
+}
+
+func (x *OrderReturn) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *OrderReturn) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *OrderReturn) GetItems() []*ReturnItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *OrderReturn) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *OrderReturn) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *OrderReturn) GetRefund() *Money {
+	if x != nil {
+		return x.Refund
+	}
+	return nil
 }
 
-func (x *OrderResult) Reset() {
-	*x = OrderResult{}
-	mi := &file_demo_proto_msgTypes[26]
+func (x *OrderReturn) GetCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateTime
+	}
+	return nil
+}
+
+type RequestReturnRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	OrderId       string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Items         []*ReturnItem          `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequestReturnRequest) Reset() {
+	*x = RequestReturnRequest{}
+	mi := &file_demo_proto_msgTypes[105]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *OrderResult) String() string {
+func (x *RequestReturnRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*OrderResult) ProtoMessage() {}
+func (*RequestReturnRequest) ProtoMessage() {}
 
-func (x *OrderResult) ProtoReflect() protoreflect.Message {
-	mi := &file_demo_proto_msgTypes[26]
+func (x *RequestReturnRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[105]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1430,69 +7298,64 @@ func (x *OrderResult) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use OrderResult.ProtoReflect.Descriptor instead.
-func (*OrderResult) Descriptor() ([]byte, []int) {
-	return file_demo_proto_rawDescGZIP(), []int{26}
+// Deprecated: Use RequestReturnRequest.ProtoReflect.Descriptor instead.
+func (*RequestReturnRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{105}
 }
 
-func (x *OrderResult) GetOrderId() string {
+func (x *RequestReturnRequest) GetUserId() string {
 	if x != nil {
-		return x.OrderId
+		return x.UserId
 	}
 	return ""
 }
 
-func (x *OrderResult) GetShippingTrackingId() string {
+func (x *RequestReturnRequest) GetOrderId() string {
 	if x != nil {
-		return x.ShippingTrackingId
+		return x.OrderId
 	}
 	return ""
 }
 
-func (x *OrderResult) GetShippingCost() *Money {
-	if x != nil {
-		return x.ShippingCost
-	}
-	return nil
-}
-
-func (x *OrderResult) GetShippingAddress() *Address {
+func (x *RequestReturnRequest) GetItems() []*ReturnItem {
 	if x != nil {
-		return x.ShippingAddress
+		return x.Items
 	}
 	return nil
 }
 
-func (x *OrderResult) GetItems() []*OrderItem {
+func (x *RequestReturnRequest) GetReason() string {
 	if x != nil {
-		return x.Items
+		return x.Reason
 	}
-	return nil
+	return ""
 }
 
-type SendOrderConfirmationRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Email         string                 `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
-	Order         *OrderResult           `protobuf:"bytes,2,opt,name=order,proto3" json:"order,omitempty"`
+type ApproveReturnRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	ReturnId string                 `protobuf:"bytes,1,opt,name=return_id,json=returnId,proto3" json:"return_id,omitempty"`
+	// The amount to refund, in the order's currency. When unset, the price
+	// paid for the returned items is refunded; more is not allowed.
+	Refund        *Money `protobuf:"bytes,2,opt,name=refund,proto3" json:"refund,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SendOrderConfirmationRequest) Reset() {
-	*x = SendOrderConfirmationRequest{}
-	mi := &file_demo_proto_msgTypes[27]
+func (x *ApproveReturnRequest) Reset() {
+	*x = ApproveReturnRequest{}
+	mi := &file_demo_proto_msgTypes[106]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SendOrderConfirmationRequest) String() string {
+func (x *ApproveReturnRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SendOrderConfirmationRequest) ProtoMessage() {}
+func (*ApproveReturnRequest) ProtoMessage() {}
 
-func (x *SendOrderConfirmationRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_demo_proto_msgTypes[27]
+func (x *ApproveReturnRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[106]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1503,51 +7366,57 @@ func (x *SendOrderConfirmationRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SendOrderConfirmationRequest.ProtoReflect.Descriptor instead.
-func (*SendOrderConfirmationRequest) Descriptor() ([]byte, []int) {
-	return file_demo_proto_rawDescGZIP(), []int{27}
+// Deprecated: Use ApproveReturnRequest.ProtoReflect.Descriptor instead.
+func (*ApproveReturnRequest) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{106}
 }
 
-func (x *SendOrderConfirmationRequest) GetEmail() string {
+func (x *ApproveReturnRequest) GetReturnId() string {
 	if x != nil {
-		return x.Email
+		return x.ReturnId
 	}
 	return ""
 }
 
-func (x *SendOrderConfirmationRequest) GetOrder() *OrderResult {
+func (x *ApproveReturnRequest) GetRefund() *Money {
 	if x != nil {
-		return x.Order
+		return x.Refund
 	}
 	return nil
 }
 
-type PlaceOrderRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
-	UserCurrency  string                 `protobuf:"bytes,2,opt,name=user_currency,json=userCurrency,proto3" json:"user_currency,omitempty"`
-	Address       *Address               `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
-	Email         string                 `protobuf:"bytes,5,opt,name=email,proto3" json:"email,omitempty"`
-	CreditCard    *CreditCardInfo        `protobuf:"bytes,6,opt,name=credit_card,json=creditCard,proto3" json:"credit_card,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+// Published to ORDER_EVENTS_TOPIC when an order is cancelled, so payment and
+// shipping can refund the charge and stop the shipment.
+type OrderCancelled struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	OrderId string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	UserId  string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// The status the order was cancelled from.
+	PreviousStatus string `protobuf:"bytes,3,opt,name=previous_status,json=previousStatus,proto3" json:"previous_status,omitempty"`
+	Reason         string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	// The amount charged for the order.
+	Total              *Money                 `protobuf:"bytes,5,opt,name=total,proto3" json:"total,omitempty"`
+	ShippingTrackingId string                 `protobuf:"bytes,6,opt,name=shipping_tracking_id,json=shippingTrackingId,proto3" json:"shipping_tracking_id,omitempty"`
+	CancelTime         *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=cancel_time,json=cancelTime,proto3" json:"cancel_time,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
-func (x *PlaceOrderRequest) Reset() {
-	*x = PlaceOrderRequest{}
-	mi := &file_demo_proto_msgTypes[28]
+func (x *OrderCancelled) Reset() {
+	*x = OrderCancelled{}
+	mi := &file_demo_proto_msgTypes[107]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *PlaceOrderRequest) String() string {
+func (x *OrderCancelled) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*PlaceOrderRequest) ProtoMessage() {}
+func (*OrderCancelled) ProtoMessage() {}
 
-func (x *PlaceOrderRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_demo_proto_msgTypes[28]
+func (x *OrderCancelled) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[107]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1558,86 +7427,56 @@ func (x *PlaceOrderRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use PlaceOrderRequest.ProtoReflect.Descriptor instead.
-func (*PlaceOrderRequest) Descriptor() ([]byte, []int) {
-	return file_demo_proto_rawDescGZIP(), []int{28}
+// Deprecated: Use OrderCancelled.ProtoReflect.Descriptor instead.
+func (*OrderCancelled) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{107}
 }
 
-func (x *PlaceOrderRequest) GetUserId() string {
+func (x *OrderCancelled) GetOrderId() string {
 	if x != nil {
-		return x.UserId
+		return x.OrderId
 	}
 	return ""
 }
 
-func (x *PlaceOrderRequest) GetUserCurrency() string {
+func (x *OrderCancelled) GetUserId() string {
 	if x != nil {
-		return x.UserCurrency
+		return x.UserId
 	}
 	return ""
 }
 
-func (x *PlaceOrderRequest) GetAddress() *Address {
+func (x *OrderCancelled) GetPreviousStatus() string {
 	if x != nil {
-		return x.Address
+		return x.PreviousStatus
 	}
-	return nil
+	return ""
 }
 
-func (x *PlaceOrderRequest) GetEmail() string {
+func (x *OrderCancelled) GetReason() string {
 	if x != nil {
-		return x.Email
+		return x.Reason
 	}
 	return ""
 }
 
-func (x *PlaceOrderRequest) GetCreditCard() *CreditCardInfo {
+func (x *OrderCancelled) GetTotal() *Money {
 	if x != nil {
-		return x.CreditCard
+		return x.Total
 	}
 	return nil
 }
 
-type PlaceOrderResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Order         *OrderResult           `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
-}
-
-func (x *PlaceOrderResponse) Reset() {
-	*x = PlaceOrderResponse{}
-	mi := &file_demo_proto_msgTypes[29]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
-}
-
-func (x *PlaceOrderResponse) String() string {
-	return protoimpl.X.MessageStringOf(x)
-}
-
-func (*PlaceOrderResponse) ProtoMessage() {}
-
-func (x *PlaceOrderResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_demo_proto_msgTypes[29]
+func (x *OrderCancelled) GetShippingTrackingId() string {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.ShippingTrackingId
 	}
-	return mi.MessageOf(x)
-}
-
-// Deprecated: Use PlaceOrderResponse.ProtoReflect.Descriptor instead.
-func (*PlaceOrderResponse) Descriptor() ([]byte, []int) {
-	return file_demo_proto_rawDescGZIP(), []int{29}
+	return ""
 }
 
-func (x *PlaceOrderResponse) GetOrder() *OrderResult {
+func (x *OrderCancelled) GetCancelTime() *timestamppb.Timestamp {
 	if x != nil {
-		return x.Order
+		return x.CancelTime
 	}
 	return nil
 }
@@ -1652,7 +7491,7 @@ type AdRequest struct {
 
 func (x *AdRequest) Reset() {
 	*x = AdRequest{}
-	mi := &file_demo_proto_msgTypes[30]
+	mi := &file_demo_proto_msgTypes[108]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1664,7 +7503,7 @@ func (x *AdRequest) String() string {
 func (*AdRequest) ProtoMessage() {}
 
 func (x *AdRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_demo_proto_msgTypes[30]
+	mi := &file_demo_proto_msgTypes[108]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1677,7 +7516,7 @@ func (x *AdRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AdRequest.ProtoReflect.Descriptor instead.
 func (*AdRequest) Descriptor() ([]byte, []int) {
-	return file_demo_proto_rawDescGZIP(), []int{30}
+	return file_demo_proto_rawDescGZIP(), []int{108}
 }
 
 func (x *AdRequest) GetContextKeys() []string {
@@ -1696,7 +7535,7 @@ type AdResponse struct {
 
 func (x *AdResponse) Reset() {
 	*x = AdResponse{}
-	mi := &file_demo_proto_msgTypes[31]
+	mi := &file_demo_proto_msgTypes[109]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1708,7 +7547,7 @@ func (x *AdResponse) String() string {
 func (*AdResponse) ProtoMessage() {}
 
 func (x *AdResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_demo_proto_msgTypes[31]
+	mi := &file_demo_proto_msgTypes[109]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1721,7 +7560,7 @@ func (x *AdResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AdResponse.ProtoReflect.Descriptor instead.
 func (*AdResponse) Descriptor() ([]byte, []int) {
-	return file_demo_proto_rawDescGZIP(), []int{31}
+	return file_demo_proto_rawDescGZIP(), []int{109}
 }
 
 func (x *AdResponse) GetAds() []*Ad {
@@ -1743,7 +7582,7 @@ type Ad struct {
 
 func (x *Ad) Reset() {
 	*x = Ad{}
-	mi := &file_demo_proto_msgTypes[32]
+	mi := &file_demo_proto_msgTypes[110]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1755,7 +7594,7 @@ func (x *Ad) String() string {
 func (*Ad) ProtoMessage() {}
 
 func (x *Ad) ProtoReflect() protoreflect.Message {
-	mi := &file_demo_proto_msgTypes[32]
+	mi := &file_demo_proto_msgTypes[110]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1768,7 +7607,7 @@ func (x *Ad) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ad.ProtoReflect.Descriptor instead.
 func (*Ad) Descriptor() ([]byte, []int) {
-	return file_demo_proto_rawDescGZIP(), []int{32}
+	return file_demo_proto_rawDescGZIP(), []int{110}
 }
 
 func (x *Ad) GetRedirectUrl() string {
@@ -1785,12 +7624,123 @@ func (x *Ad) GetText() string {
 	return ""
 }
 
+type SearchDebug_ResultScores struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	// Cosine distances from the query to each of the product's
+	// embeddings, unset where the product has none.
+	CombinedDistance   *float64 `protobuf:"fixed64,2,opt,name=combined_distance,json=combinedDistance,proto3,oneof" json:"combined_distance,omitempty"`
+	TargetTagsDistance *float64 `protobuf:"fixed64,3,opt,name=target_tags_distance,json=targetTagsDistance,proto3,oneof" json:"target_tags_distance,omitempty"`
+	UseContextDistance *float64 `protobuf:"fixed64,4,opt,name=use_context_distance,json=useContextDistance,proto3,oneof" json:"use_context_distance,omitempty"`
+	// Full-text score, set when keyword fusion is on and the product
+	// matched the query's words.
+	KeywordScore *float64 `protobuf:"fixed64,5,opt,name=keyword_score,json=keywordScore,proto3,oneof" json:"keyword_score,omitempty"`
+	// The score results are ranked by; lower is better. It is the
+	// weighted distance, blended with popularity when that is on, or
+	// the negated fused score with keyword fusion.
+	Score float64 `protobuf:"fixed64,6,opt,name=score,proto3" json:"score,omitempty"`
+	// The product's popularity, from 0 to 1, set when popularity is
+	// blended into the ranking.
+	Popularity *float64 `protobuf:"fixed64,7,opt,name=popularity,proto3,oneof" json:"popularity,omitempty"`
+	// The reranker's relevance score, higher is better, set when
+	// reranking reordered the results.
+	RerankScore   *float64 `protobuf:"fixed64,8,opt,name=rerank_score,json=rerankScore,proto3,oneof" json:"rerank_score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchDebug_ResultScores) Reset() {
+	*x = SearchDebug_ResultScores{}
+	mi := &file_demo_proto_msgTypes[111]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchDebug_ResultScores) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchDebug_ResultScores) ProtoMessage() {}
+
+func (x *SearchDebug_ResultScores) ProtoReflect() protoreflect.Message {
+	mi := &file_demo_proto_msgTypes[111]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchDebug_ResultScores.ProtoReflect.Descriptor instead.
+func (*SearchDebug_ResultScores) Descriptor() ([]byte, []int) {
+	return file_demo_proto_rawDescGZIP(), []int{18, 0}
+}
+
+func (x *SearchDebug_ResultScores) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *SearchDebug_ResultScores) GetCombinedDistance() float64 {
+	if x != nil && x.CombinedDistance != nil {
+		return *x.CombinedDistance
+	}
+	return 0
+}
+
+func (x *SearchDebug_ResultScores) GetTargetTagsDistance() float64 {
+	if x != nil && x.TargetTagsDistance != nil {
+		return *x.TargetTagsDistance
+	}
+	return 0
+}
+
+func (x *SearchDebug_ResultScores) GetUseContextDistance() float64 {
+	if x != nil && x.UseContextDistance != nil {
+		return *x.UseContextDistance
+	}
+	return 0
+}
+
+func (x *SearchDebug_ResultScores) GetKeywordScore() float64 {
+	if x != nil && x.KeywordScore != nil {
+		return *x.KeywordScore
+	}
+	return 0
+}
+
+func (x *SearchDebug_ResultScores) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *SearchDebug_ResultScores) GetPopularity() float64 {
+	if x != nil && x.Popularity != nil {
+		return *x.Popularity
+	}
+	return 0
+}
+
+func (x *SearchDebug_ResultScores) GetRerankScore() float64 {
+	if x != nil && x.RerankScore != nil {
+		return *x.RerankScore
+	}
+	return 0
+}
+
 var File_demo_proto protoreflect.FileDescriptor
 
 const file_demo_proto_rawDesc = "" +
 	"\n" +
 	"\n" +
-	"demo.proto\x12\vhipstershop\"E\n" +
+	"demo.proto\x12\vhipstershop\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"E\n" +
 	"\bCartItem\x12\x1d\n" +
 	"\n" +
 	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
@@ -1812,7 +7762,7 @@ const file_demo_proto_rawDesc = "" +
 	"productIds\">\n" +
 	"\x1bListRecommendationsResponse\x12\x1f\n" +
 	"\vproduct_ids\x18\x01 \x03(\tR\n" +
-	"productIds\"\xfc\x01\n" +
+	"productIds\"\x90\x04\n" +
 	"\aProduct\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
@@ -1825,18 +7775,267 @@ const file_demo_proto_rawDesc = "" +
 	"\vtarget_tags\x18\a \x03(\tR\n" +
 	"targetTags\x12\x1f\n" +
 	"\vuse_context\x18\b \x03(\tR\n" +
-	"useContext\"H\n" +
+	"useContext\x127\n" +
+	"\bvariants\x18\t \x03(\v2\x1b.hipstershop.ProductVariantR\bvariants\x12K\n" +
+	"\x0fvariant_summary\x18\n" +
+	" \x01(\v2\".hipstershop.ProductVariantSummaryR\x0evariantSummary\x123\n" +
+	"\x06status\x18\v \x01(\x0e2\x1b.hipstershop.Product.StatusR\x06status\x12\x19\n" +
+	"\x05stock\x18\f \x01(\x05H\x00R\x05stock\x88\x01\x01\"2\n" +
+	"\x06Status\x12\n" +
+	"\n" +
+	"\x06ACTIVE\x10\x00\x12\x10\n" +
+	"\fDISCONTINUED\x10\x01\x12\n" +
+	"\n" +
+	"\x06HIDDEN\x10\x02B\b\n" +
+	"\x06_stock\"\x86\x01\n" +
+	"\bCategory\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x121\n" +
+	"\bchildren\x18\x03 \x03(\v2\x15.hipstershop.CategoryR\bchildren\x12#\n" +
+	"\rproduct_count\x18\x04 \x01(\x05R\fproductCount\"O\n" +
+	"\x16ListCategoriesResponse\x125\n" +
+	"\n" +
+	"categories\x18\x01 \x03(\v2\x15.hipstershop.CategoryR\n" +
+	"categories\"\x9e\x01\n" +
+	"\x0eProductVariant\x12\x10\n" +
+	"\x03sku\x18\x01 \x01(\tR\x03sku\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\tR\x04size\x12\x14\n" +
+	"\x05color\x18\x03 \x01(\tR\x05color\x12:\n" +
+	"\x0fprice_delta_usd\x18\x04 \x01(\v2\x12.hipstershop.MoneyR\rpriceDeltaUsd\x12\x14\n" +
+	"\x05stock\x18\x05 \x01(\x05R\x05stock\"\xe6\x01\n" +
+	"\x15ProductVariantSummary\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x05R\x05count\x12\x14\n" +
+	"\x05sizes\x18\x02 \x03(\tR\x05sizes\x12\x16\n" +
+	"\x06colors\x18\x03 \x03(\tR\x06colors\x126\n" +
+	"\rmin_price_usd\x18\x04 \x01(\v2\x12.hipstershop.MoneyR\vminPriceUsd\x126\n" +
+	"\rmax_price_usd\x18\x05 \x01(\v2\x12.hipstershop.MoneyR\vmaxPriceUsd\x12\x19\n" +
+	"\bin_stock\x18\x06 \x01(\x05R\ainStock\"\xb5\x01\n" +
+	"\x13ListProductsRequest\x12\x1b\n" +
+	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\x127\n" +
+	"\tread_mask\x18\x03 \x01(\v2\x1a.google.protobuf.FieldMaskR\breadMask\x12)\n" +
+	"\x10include_inactive\x18\x04 \x01(\bR\x0fincludeInactive\"p\n" +
 	"\x14ListProductsResponse\x120\n" +
-	"\bproducts\x18\x01 \x03(\v2\x14.hipstershop.ProductR\bproducts\"#\n" +
+	"\bproducts\x18\x01 \x03(\v2\x14.hipstershop.ProductR\bproducts\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"#\n" +
 	"\x11GetProductRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"-\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"X\n" +
 	"\x15SearchProductsRequest\x12\x14\n" +
-	"\x05query\x18\x01 \x01(\tR\x05query\"H\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12)\n" +
+	"\x10include_inactive\x18\x02 \x01(\bR\x0fincludeInactive\"\xe5\x02\n" +
 	"\x16SearchProductsResponse\x12.\n" +
-	"\aresults\x18\x01 \x03(\v2\x14.hipstershop.ProductR\aresults\"C\n" +
+	"\aresults\x18\x01 \x03(\v2\x14.hipstershop.ProductR\aresults\x12\x1c\n" +
+	"\ttruncated\x18\x02 \x01(\bR\ttruncated\x121\n" +
+	"\x06facets\x18\x03 \x01(\v2\x19.hipstershop.SearchFacetsR\x06facets\x12'\n" +
+	"\x0fsuggested_query\x18\x04 \x01(\tR\x0esuggestedQuery\x12.\n" +
+	"\x05debug\x18\x05 \x01(\v2\x18.hipstershop.SearchDebugR\x05debug\x12\x1b\n" +
+	"\tsearch_id\x18\x06 \x01(\tR\bsearchId\x12-\n" +
+	"\x12experiment_variant\x18\a \x01(\tR\x11experimentVariant\x12%\n" +
+	"\x0equery_language\x18\b \x01(\tR\rqueryLanguage\"\xd5\x05\n" +
+	"\vSearchDebug\x12\x1a\n" +
+	"\bfallback\x18\x01 \x01(\tR\bfallback\x12'\n" +
+	"\x0fprocessed_query\x18\x02 \x01(\tR\x0eprocessedQuery\x12:\n" +
+	"\aweights\x18\x03 \x01(\v2 .hipstershop.HybridSearchWeightsR\aweights\x12=\n" +
+	"\x06scores\x18\x04 \x03(\v2%.hipstershop.SearchDebug.ResultScoresR\x06scores\x12/\n" +
+	"\x13merchandising_rules\x18\x05 \x03(\x03R\x12merchandisingRules\x1a\xd4\x03\n" +
+	"\fResultScores\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x120\n" +
+	"\x11combined_distance\x18\x02 \x01(\x01H\x00R\x10combinedDistance\x88\x01\x01\x125\n" +
+	"\x14target_tags_distance\x18\x03 \x01(\x01H\x01R\x12targetTagsDistance\x88\x01\x01\x125\n" +
+	"\x14use_context_distance\x18\x04 \x01(\x01H\x02R\x12useContextDistance\x88\x01\x01\x12(\n" +
+	"\rkeyword_score\x18\x05 \x01(\x01H\x03R\fkeywordScore\x88\x01\x01\x12\x14\n" +
+	"\x05score\x18\x06 \x01(\x01R\x05score\x12#\n" +
+	"\n" +
+	"popularity\x18\a \x01(\x01H\x04R\n" +
+	"popularity\x88\x01\x01\x12&\n" +
+	"\frerank_score\x18\b \x01(\x01H\x05R\vrerankScore\x88\x01\x01B\x14\n" +
+	"\x12_combined_distanceB\x17\n" +
+	"\x15_target_tags_distanceB\x17\n" +
+	"\x15_use_context_distanceB\x10\n" +
+	"\x0e_keyword_scoreB\r\n" +
+	"\v_popularityB\x0f\n" +
+	"\r_rerank_score\"\xc5\x01\n" +
+	"\fSearchFacets\x127\n" +
+	"\n" +
+	"categories\x18\x01 \x03(\v2\x17.hipstershop.FacetCountR\n" +
+	"categories\x128\n" +
+	"\vtarget_tags\x18\x02 \x03(\v2\x17.hipstershop.FacetCountR\n" +
+	"targetTags\x12B\n" +
+	"\rprice_buckets\x18\x03 \x03(\v2\x1d.hipstershop.PriceBucketCountR\fpriceBuckets\"8\n" +
+	"\n" +
+	"FacetCount\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x05R\x05count\"t\n" +
+	"\x10PriceBucketCount\x12$\n" +
+	"\x03min\x18\x01 \x01(\v2\x12.hipstershop.MoneyR\x03min\x12$\n" +
+	"\x03max\x18\x02 \x01(\v2\x12.hipstershop.MoneyR\x03max\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x05R\x05count\"\xf1\x06\n" +
 	"\x15SemanticSearchRequest\x12\x14\n" +
 	"\x05query\x18\x01 \x01(\tR\x05query\x12\x14\n" +
-	"\x05limit\x18\x02 \x01(\x05R\x05limit\"n\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x1e\n" +
+	"\n" +
+	"categories\x18\x03 \x03(\tR\n" +
+	"categories\x126\n" +
+	"\rmin_price_usd\x18\x04 \x01(\v2\x12.hipstershop.MoneyR\vminPriceUsd\x126\n" +
+	"\rmax_price_usd\x18\x05 \x01(\v2\x12.hipstershop.MoneyR\vmaxPriceUsd\x12\x1f\n" +
+	"\vtarget_tags\x18\x06 \x03(\tR\n" +
+	"targetTags\x12:\n" +
+	"\aweights\x18\a \x01(\v2 .hipstershop.HybridSearchWeightsR\aweights\x12&\n" +
+	"\fmax_distance\x18\b \x01(\x01H\x00R\vmaxDistance\x88\x01\x01\x12E\n" +
+	"\asort_by\x18\t \x01(\x0e2,.hipstershop.SemanticSearchRequest.SortOrderR\x06sortBy\x12%\n" +
+	"\x0einclude_facets\x18\n" +
+	" \x01(\bR\rincludeFacets\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\v \x01(\x05R\ttimeoutMs\x12\x17\n" +
+	"\auser_id\x18\f \x01(\tR\x06userId\x12+\n" +
+	"\x11profile_embedding\x18\r \x03(\x02R\x10profileEmbedding\x12\x14\n" +
+	"\x05debug\x18\x0e \x01(\bR\x05debug\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x0f \x01(\tR\tsessionId\x12#\n" +
+	"\rlanguage_code\x18\x10 \x01(\tR\flanguageCode\x12)\n" +
+	"\x10include_inactive\x18\x11 \x01(\bR\x0fincludeInactive\x12\"\n" +
+	"\rin_stock_only\x18\x12 \x01(\bR\vinStockOnly\x12.\n" +
+	"\x10diversity_lambda\x18\x13 \x01(\x01H\x01R\x0fdiversityLambda\x88\x01\x01\"E\n" +
+	"\tSortOrder\x12\r\n" +
+	"\tRELEVANCE\x10\x00\x12\r\n" +
+	"\tPRICE_ASC\x10\x01\x12\x0e\n" +
+	"\n" +
+	"PRICE_DESC\x10\x02\x12\n" +
+	"\n" +
+	"\x06NEWEST\x10\x03B\x0f\n" +
+	"\r_max_distanceB\x13\n" +
+	"\x11_diversity_lambda\"s\n" +
+	"\x12ImageSearchRequest\x12\x1f\n" +
+	"\n" +
+	"image_data\x18\x01 \x01(\fH\x00R\timageData\x12\x1d\n" +
+	"\timage_url\x18\x02 \x01(\tH\x00R\bimageUrl\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limitB\a\n" +
+	"\x05image\"\xd4\x01\n" +
+	"\x12ProductInteraction\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x02 \x01(\tR\tproductId\x128\n" +
+	"\x04kind\x18\x03 \x01(\x0e2$.hipstershop.ProductInteraction.KindR\x04kind\x12\x1b\n" +
+	"\tsearch_id\x18\x04 \x01(\tR\bsearchId\"/\n" +
+	"\x04Kind\x12\b\n" +
+	"\x04VIEW\x10\x00\x12\x0f\n" +
+	"\vADD_TO_CART\x10\x01\x12\f\n" +
+	"\bPURCHASE\x10\x02\"P\n" +
+	"\x19GetSimilarProductsRequest\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"D\n" +
+	"\x16SuggestProductsRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"\x94\x01\n" +
+	"\n" +
+	"Suggestion\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x120\n" +
+	"\x04kind\x18\x02 \x01(\x0e2\x1c.hipstershop.Suggestion.KindR\x04kind\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x03 \x01(\tR\tproductId\"!\n" +
+	"\x04Kind\x12\v\n" +
+	"\aPRODUCT\x10\x00\x12\f\n" +
+	"\bCATEGORY\x10\x01\"T\n" +
+	"\x17SuggestProductsResponse\x129\n" +
+	"\vsuggestions\x18\x01 \x03(\v2\x17.hipstershop.SuggestionR\vsuggestions\"s\n" +
+	"\x13HybridSearchWeights\x12\x1a\n" +
+	"\bcombined\x18\x01 \x01(\x01R\bcombined\x12\x1f\n" +
+	"\vtarget_tags\x18\x02 \x01(\x01R\n" +
+	"targetTags\x12\x1f\n" +
+	"\vuse_context\x18\x03 \x01(\x01R\n" +
+	"useContext\"F\n" +
+	"\x14CreateProductRequest\x12.\n" +
+	"\aproduct\x18\x01 \x01(\v2\x14.hipstershop.ProductR\aproduct\"F\n" +
+	"\x14UpdateProductRequest\x12.\n" +
+	"\aproduct\x18\x01 \x01(\v2\x14.hipstershop.ProductR\aproduct\"<\n" +
+	"\x14DeleteProductRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05purge\x18\x02 \x01(\bR\x05purge\"3\n" +
+	"\x15ReloadCatalogResponse\x12\x1a\n" +
+	"\bproducts\x18\x01 \x01(\x05R\bproducts\"\xa3\x01\n" +
+	"\x15ImportProductsRequest\x122\n" +
+	"\x06format\x18\x01 \x01(\x0e2\x1a.hipstershop.CatalogFormatR\x06format\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x12)\n" +
+	"\x10replace_existing\x18\x03 \x01(\bR\x0freplaceExisting\x12\x17\n" +
+	"\adry_run\x18\x04 \x01(\bR\x06dryRun\"\x95\x01\n" +
+	"\x16ImportProductsResponse\x12\x18\n" +
+	"\acreated\x18\x01 \x01(\x05R\acreated\x12\x1a\n" +
+	"\breplaced\x18\x02 \x01(\x05R\breplaced\x12\x18\n" +
+	"\askipped\x18\x03 \x01(\x05R\askipped\x12+\n" +
+	"\x11embedding_pending\x18\x04 \x01(\x05R\x10embeddingPending\"K\n" +
+	"\x15ExportProductsRequest\x122\n" +
+	"\x06format\x18\x01 \x01(\x0e2\x1a.hipstershop.CatalogFormatR\x06format\"H\n" +
+	"\x16ExportProductsResponse\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x1a\n" +
+	"\bproducts\x18\x02 \x01(\x05R\bproducts\"\x82\x03\n" +
+	"\x11MerchandisingRule\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12#\n" +
+	"\rquery_pattern\x18\x02 \x01(\tR\fqueryPattern\x12\x1f\n" +
+	"\n" +
+	"product_id\x18\x03 \x01(\tH\x00R\tproductId\x12\x1c\n" +
+	"\bcategory\x18\x04 \x01(\tH\x00R\bcategory\x12=\n" +
+	"\x06action\x18\x05 \x01(\x0e2%.hipstershop.MerchandisingRule.ActionR\x06action\x129\n" +
+	"\n" +
+	"start_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\">\n" +
+	"\x06Action\x12\x16\n" +
+	"\x12ACTION_UNSPECIFIED\x10\x00\x12\a\n" +
+	"\x03PIN\x10\x01\x12\t\n" +
+	"\x05BOOST\x10\x02\x12\b\n" +
+	"\x04BURY\x10\x03B\b\n" +
+	"\x06target\"V\n" +
+	"\x1eListMerchandisingRulesResponse\x124\n" +
+	"\x05rules\x18\x01 \x03(\v2\x1e.hipstershop.MerchandisingRuleR\x05rules\"0\n" +
+	"\x1eDeleteMerchandisingRuleRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\xd2\x01\n" +
+	"\bCampaign\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1a\n" +
+	"\bcategory\x18\x03 \x01(\tR\bcategory\x12\x14\n" +
+	"\x05boost\x18\x04 \x01(\x01R\x05boost\x129\n" +
+	"\n" +
+	"start_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\"L\n" +
+	"\x15ListCampaignsResponse\x123\n" +
+	"\tcampaigns\x18\x01 \x03(\v2\x15.hipstershop.CampaignR\tcampaigns\"'\n" +
+	"\x15ExpireCampaignRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"X\n" +
+	"\x15CreateCategoryRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1b\n" +
+	"\tparent_id\x18\x03 \x01(\tR\bparentId\"'\n" +
+	"\x15DeleteCategoryRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"_\n" +
+	"\n" +
+	"StockLevel\x12\x1f\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tH\x00R\tproductId\x12\x12\n" +
+	"\x03sku\x18\x02 \x01(\tH\x00R\x03sku\x12\x14\n" +
+	"\x05stock\x18\x03 \x01(\x05R\x05stockB\x06\n" +
+	"\x04item\"E\n" +
+	"\x12UpdateStockRequest\x12/\n" +
+	"\x06levels\x18\x01 \x03(\v2\x17.hipstershop.StockLevelR\x06levels\"L\n" +
+	"\x13UpdateStockResponse\x12\x18\n" +
+	"\aupdated\x18\x01 \x01(\x05R\aupdated\x12\x1b\n" +
+	"\tnot_found\x18\x02 \x03(\tR\bnotFound\"\xc5\x02\n" +
+	"\x0eProductChanged\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12:\n" +
+	"\x06change\x18\x02 \x01(\x0e2\".hipstershop.ProductChanged.ChangeR\x06change\x12.\n" +
+	"\aproduct\x18\x03 \x01(\v2\x14.hipstershop.ProductR\aproduct\x12;\n" +
+	"\vchange_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"changeTime\"k\n" +
+	"\x06Change\x12\x16\n" +
+	"\x12CHANGE_UNSPECIFIED\x10\x00\x12\v\n" +
+	"\aCREATED\x10\x01\x12\v\n" +
+	"\aUPDATED\x10\x02\x12\x10\n" +
+	"\fDISCONTINUED\x10\x03\x12\n" +
+	"\n" +
+	"\x06PURGED\x10\x04\x12\x11\n" +
+	"\rSTOCK_UPDATED\x10\x05\"n\n" +
 	"\x0fGetQuoteRequest\x12.\n" +
 	"\aaddress\x18\x01 \x01(\v2\x14.hipstershop.AddressR\aaddress\x12+\n" +
 	"\x05items\x18\x02 \x03(\v2\x15.hipstershop.CartItemR\x05items\"A\n" +
@@ -1867,34 +8066,269 @@ const file_demo_proto_rawDesc = "" +
 	"\x12credit_card_number\x18\x01 \x01(\tR\x10creditCardNumber\x12&\n" +
 	"\x0fcredit_card_cvv\x18\x02 \x01(\x05R\rcreditCardCvv\x12=\n" +
 	"\x1bcredit_card_expiration_year\x18\x03 \x01(\x05R\x18creditCardExpirationYear\x12?\n" +
-	"\x1ccredit_card_expiration_month\x18\x04 \x01(\x05R\x19creditCardExpirationMonth\"y\n" +
+	"\x1ccredit_card_expiration_month\x18\x04 \x01(\x05R\x19creditCardExpirationMonth\"\xc9\x01\n" +
 	"\rChargeRequest\x12*\n" +
 	"\x06amount\x18\x01 \x01(\v2\x12.hipstershop.MoneyR\x06amount\x12<\n" +
 	"\vcredit_card\x18\x02 \x01(\v2\x1b.hipstershop.CreditCardInfoR\n" +
-	"creditCard\"7\n" +
+	"creditCard\x12'\n" +
+	"\x0fidempotency_key\x18\x03 \x01(\tR\x0eidempotencyKey\x12%\n" +
+	"\x0eauthorize_only\x18\x04 \x01(\bR\rauthorizeOnly\"7\n" +
+	"\x0eCaptureRequest\x12%\n" +
+	"\x0etransaction_id\x18\x01 \x01(\tR\rtransactionId\"4\n" +
+	"\vVoidRequest\x12%\n" +
+	"\x0etransaction_id\x18\x01 \x01(\tR\rtransactionId\"7\n" +
 	"\x0eChargeResponse\x12%\n" +
 	"\x0etransaction_id\x18\x01 \x01(\tR\rtransactionId\"^\n" +
 	"\tOrderItem\x12)\n" +
 	"\x04item\x18\x01 \x01(\v2\x15.hipstershop.CartItemR\x04item\x12&\n" +
-	"\x04cost\x18\x02 \x01(\v2\x12.hipstershop.MoneyR\x04cost\"\x82\x02\n" +
+	"\x04cost\x18\x02 \x01(\v2\x12.hipstershop.MoneyR\x04cost\"\xe7\x03\n" +
 	"\vOrderResult\x12\x19\n" +
 	"\border_id\x18\x01 \x01(\tR\aorderId\x120\n" +
 	"\x14shipping_tracking_id\x18\x02 \x01(\tR\x12shippingTrackingId\x127\n" +
 	"\rshipping_cost\x18\x03 \x01(\v2\x12.hipstershop.MoneyR\fshippingCost\x12?\n" +
 	"\x10shipping_address\x18\x04 \x01(\v2\x14.hipstershop.AddressR\x0fshippingAddress\x12,\n" +
-	"\x05items\x18\x05 \x03(\v2\x16.hipstershop.OrderItemR\x05items\"d\n" +
+	"\x05items\x18\x05 \x03(\v2\x16.hipstershop.OrderItemR\x05items\x12#\n" +
+	"\rdiscount_code\x18\x06 \x01(\tR\fdiscountCode\x12.\n" +
+	"\bdiscount\x18\a \x01(\v2\x12.hipstershop.MoneyR\bdiscount\x12$\n" +
+	"\x03tax\x18\b \x01(\v2\x12.hipstershop.MoneyR\x03tax\x121\n" +
+	"\ttax_lines\x18\t \x03(\v2\x14.hipstershop.TaxLineR\btaxLines\x12\x1d\n" +
+	"\n" +
+	"address_id\x18\n" +
+	" \x01(\tR\taddressId\x12\x16\n" +
+	"\x06status\x18\v \x01(\tR\x06status\"Y\n" +
+	"\aTaxLine\x12\"\n" +
+	"\fjurisdiction\x18\x01 \x01(\tR\fjurisdiction\x12*\n" +
+	"\x06amount\x18\x02 \x01(\v2\x12.hipstershop.MoneyR\x06amount\"d\n" +
 	"\x1cSendOrderConfirmationRequest\x12\x14\n" +
 	"\x05email\x18\x01 \x01(\tR\x05email\x12.\n" +
-	"\x05order\x18\x02 \x01(\v2\x18.hipstershop.OrderResultR\x05order\"\xd5\x01\n" +
+	"\x05order\x18\x02 \x01(\v2\x18.hipstershop.OrderResultR\x05order\"\xc2\x02\n" +
 	"\x11PlaceOrderRequest\x12\x17\n" +
 	"\auser_id\x18\x01 \x01(\tR\x06userId\x12#\n" +
 	"\ruser_currency\x18\x02 \x01(\tR\fuserCurrency\x12.\n" +
 	"\aaddress\x18\x03 \x01(\v2\x14.hipstershop.AddressR\aaddress\x12\x14\n" +
 	"\x05email\x18\x05 \x01(\tR\x05email\x12<\n" +
 	"\vcredit_card\x18\x06 \x01(\v2\x1b.hipstershop.CreditCardInfoR\n" +
-	"creditCard\"D\n" +
+	"creditCard\x12'\n" +
+	"\x0fidempotency_key\x18\a \x01(\tR\x0eidempotencyKey\x12#\n" +
+	"\rdiscount_code\x18\b \x01(\tR\fdiscountCode\x12\x1d\n" +
+	"\n" +
+	"address_id\x18\t \x01(\tR\taddressId\"D\n" +
 	"\x12PlaceOrderResponse\x12.\n" +
-	"\x05order\x18\x01 \x01(\v2\x18.hipstershop.OrderResultR\x05order\".\n" +
+	"\x05order\x18\x01 \x01(\v2\x18.hipstershop.OrderResultR\x05order\"\x87\x05\n" +
+	"\x05Order\x12\x19\n" +
+	"\border_id\x18\x01 \x01(\tR\aorderId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05email\x18\x03 \x01(\tR\x05email\x12(\n" +
+	"\x05total\x18\x04 \x01(\v2\x12.hipstershop.MoneyR\x05total\x120\n" +
+	"\x14shipping_tracking_id\x18\x05 \x01(\tR\x12shippingTrackingId\x12)\n" +
+	"\x10shipping_address\x18\x06 \x01(\tR\x0fshippingAddress\x129\n" +
+	"\n" +
+	"order_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\torderTime\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x12,\n" +
+	"\x05items\x18\t \x03(\v2\x16.hipstershop.OrderItemR\x05items\x12/\n" +
+	"\x13confirmation_status\x18\n" +
+	" \x01(\tR\x12confirmationStatus\x12#\n" +
+	"\rdiscount_code\x18\v \x01(\tR\fdiscountCode\x12.\n" +
+	"\bdiscount\x18\f \x01(\v2\x12.hipstershop.MoneyR\bdiscount\x12.\n" +
+	"\bsubtotal\x18\r \x01(\v2\x12.hipstershop.MoneyR\bsubtotal\x12$\n" +
+	"\x03tax\x18\x0e \x01(\v2\x12.hipstershop.MoneyR\x03tax\x121\n" +
+	"\ttax_lines\x18\x0f \x03(\v2\x14.hipstershop.TaxLineR\btaxLines\x12\x1d\n" +
+	"\n" +
+	"address_id\x18\x10 \x01(\tR\taddressId\"\xdf\x01\n" +
+	"\x16GetOrderHistoryRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1b\n" +
+	"\tpage_size\x18\x02 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tR\tpageToken\x129\n" +
+	"\n" +
+	"start_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\"m\n" +
+	"\x17GetOrderHistoryResponse\x12*\n" +
+	"\x06orders\x18\x01 \x03(\v2\x12.hipstershop.OrderR\x06orders\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"E\n" +
+	"\x0fGetOrderRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\">\n" +
+	"\x1bGetOrderByTrackingIDRequest\x12\x1f\n" +
+	"\vtracking_id\x18\x01 \x01(\tR\n" +
+	"trackingId\"V\n" +
+	"\x18GetUserOrderStatsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12!\n" +
+	"\ftop_products\x18\x02 \x01(\x05R\vtopProducts\"\xd4\x02\n" +
+	"\x0eUserOrderStats\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12!\n" +
+	"\ftotal_orders\x18\x02 \x01(\x03R\vtotalOrders\x129\n" +
+	"\x0elifetime_spend\x18\x03 \x03(\v2\x12.hipstershop.MoneyR\rlifetimeSpend\x12D\n" +
+	"\x10first_order_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x0efirstOrderTime\x12B\n" +
+	"\x0flast_order_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\rlastOrderTime\x12A\n" +
+	"\ftop_products\x18\x06 \x03(\v2\x1e.hipstershop.ProductOrderStatsR\vtopProducts\"f\n" +
+	"\x11ProductOrderStats\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x03R\bquantity\x12\x16\n" +
+	"\x06orders\x18\x03 \x01(\x03R\x06orders\"d\n" +
+	"\x0eReorderRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\x12\x1e\n" +
+	"\vadd_to_cart\x18\x03 \x01(\bR\taddToCart\"\x85\x01\n" +
+	"\x0fReorderResponse\x12+\n" +
+	"\x05items\x18\x01 \x03(\v2\x15.hipstershop.CartItemR\x05items\x12E\n" +
+	"\vunavailable\x18\x02 \x03(\v2#.hipstershop.ReorderUnavailableItemR\vunavailable\"k\n" +
+	"\x16ReorderUnavailableItem\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"\x90\x01\n" +
+	"\x15ExportUserDataRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12A\n" +
+	"\x06format\x18\x02 \x01(\x0e2).hipstershop.ExportUserDataRequest.FormatR\x06format\"\x1b\n" +
+	"\x06Format\x12\b\n" +
+	"\x04JSON\x10\x00\x12\a\n" +
+	"\x03CSV\x10\x01\"O\n" +
+	"\x16ExportUserDataResponse\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\"0\n" +
+	"\x15DeleteUserDataRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\"E\n" +
+	"\x16DeleteUserDataResponse\x12+\n" +
+	"\x11orders_anonymized\x18\x01 \x01(\x05R\x10ordersAnonymized\"\xd2\x01\n" +
+	"\fSavedAddress\x12\x1d\n" +
+	"\n" +
+	"address_id\x18\x01 \x01(\tR\taddressId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12.\n" +
+	"\aaddress\x18\x03 \x01(\v2\x14.hipstershop.AddressR\aaddress\x12\x1d\n" +
+	"\n" +
+	"is_default\x18\x04 \x01(\bR\tisDefault\x12;\n" +
+	"\vcreate_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"createTime\"{\n" +
+	"\x11AddAddressRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12.\n" +
+	"\aaddress\x18\x02 \x01(\v2\x14.hipstershop.AddressR\aaddress\x12\x1d\n" +
+	"\n" +
+	"is_default\x18\x03 \x01(\bR\tisDefault\"/\n" +
+	"\x14ListAddressesRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\"P\n" +
+	"\x15ListAddressesResponse\x127\n" +
+	"\taddresses\x18\x01 \x03(\v2\x19.hipstershop.SavedAddressR\taddresses\"N\n" +
+	"\x14DeleteAddressRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1d\n" +
+	"\n" +
+	"address_id\x18\x02 \x01(\tR\taddressId\"R\n" +
+	"\x18SetDefaultAddressRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1d\n" +
+	"\n" +
+	"address_id\x18\x02 \x01(\tR\taddressId\"I\n" +
+	"\fShipmentItem\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\"\xc4\x02\n" +
+	"\bShipment\x12\x1f\n" +
+	"\vshipment_id\x18\x01 \x01(\tR\n" +
+	"shipmentId\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\x12\x1f\n" +
+	"\vtracking_id\x18\x03 \x01(\tR\n" +
+	"trackingId\x12\x18\n" +
+	"\acarrier\x18\x04 \x01(\tR\acarrier\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12/\n" +
+	"\x05items\x18\x06 \x03(\v2\x19.hipstershop.ShipmentItemR\x05items\x12;\n" +
+	"\vcreate_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"createTime\x12;\n" +
+	"\vupdate_time\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"updateTime\"\x9e\x01\n" +
+	"\x15CreateShipmentRequest\x12\x19\n" +
+	"\border_id\x18\x01 \x01(\tR\aorderId\x12\x1f\n" +
+	"\vtracking_id\x18\x02 \x01(\tR\n" +
+	"trackingId\x12\x18\n" +
+	"\acarrier\x18\x03 \x01(\tR\acarrier\x12/\n" +
+	"\x05items\x18\x04 \x03(\v2\x19.hipstershop.ShipmentItemR\x05items\"V\n" +
+	"\x1bUpdateShipmentStatusRequest\x12\x1f\n" +
+	"\vshipment_id\x18\x01 \x01(\tR\n" +
+	"shipmentId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\"J\n" +
+	"\x14ListShipmentsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\"\xbe\x01\n" +
+	"\x0fItemFulfillment\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\x12)\n" +
+	"\x10shipped_quantity\x18\x03 \x01(\x05R\x0fshippedQuantity\x12-\n" +
+	"\x12delivered_quantity\x18\x04 \x01(\x05R\x11deliveredQuantity\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\"\x80\x01\n" +
+	"\x15ListShipmentsResponse\x123\n" +
+	"\tshipments\x18\x01 \x03(\v2\x15.hipstershop.ShipmentR\tshipments\x122\n" +
+	"\x05items\x18\x02 \x03(\v2\x1c.hipstershop.ItemFulfillmentR\x05items\"d\n" +
+	"\x12ClaimOrdersRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12\x1f\n" +
+	"\vemail_token\x18\x03 \x01(\tR\n" +
+	"emailToken\"Y\n" +
+	"\x13ClaimOrdersResponse\x12%\n" +
+	"\x0eorders_claimed\x18\x01 \x01(\x05R\rordersClaimed\x12\x1b\n" +
+	"\torder_ids\x18\x02 \x03(\tR\borderIds\"\xf7\x03\n" +
+	"\x13SearchOrdersRequest\x12\x14\n" +
+	"\x05email\x18\x01 \x01(\tR\x05email\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x129\n" +
+	"\n" +
+	"start_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x05 \x01(\tR\tproductId\x12/\n" +
+	"\tmin_total\x18\x06 \x01(\v2\x12.hipstershop.MoneyR\bminTotal\x12/\n" +
+	"\tmax_total\x18\a \x01(\v2\x12.hipstershop.MoneyR\bmaxTotal\x12\x1b\n" +
+	"\tpage_size\x18\b \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\t \x01(\tR\tpageToken\x12@\n" +
+	"\asort_by\x18\n" +
+	" \x01(\x0e2'.hipstershop.SearchOrdersRequest.SortByR\x06sortBy\x12\x1c\n" +
+	"\tascending\x18\v \x01(\bR\tascending\"#\n" +
+	"\x06SortBy\x12\x0e\n" +
+	"\n" +
+	"ORDER_TIME\x10\x00\x12\t\n" +
+	"\x05TOTAL\x10\x01\"j\n" +
+	"\x14SearchOrdersResponse\x12*\n" +
+	"\x06orders\x18\x01 \x03(\v2\x12.hipstershop.OrderR\x06orders\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"e\n" +
+	"\x18UpdateOrderStatusRequest\x12\x19\n" +
+	"\border_id\x18\x01 \x01(\tR\aorderId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"`\n" +
+	"\x12CancelOrderRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"G\n" +
+	"\n" +
+	"ReturnItem\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\"\xa6\x02\n" +
+	"\vOrderReturn\x12\x1b\n" +
+	"\treturn_id\x18\x01 \x01(\tR\breturnId\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12-\n" +
+	"\x05items\x18\x04 \x03(\v2\x17.hipstershop.ReturnItemR\x05items\x12\x16\n" +
+	"\x06reason\x18\x05 \x01(\tR\x06reason\x12\x16\n" +
+	"\x06status\x18\x06 \x01(\tR\x06status\x12*\n" +
+	"\x06refund\x18\a \x01(\v2\x12.hipstershop.MoneyR\x06refund\x12;\n" +
+	"\vcreate_time\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"createTime\"\x91\x01\n" +
+	"\x14RequestReturnRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\x12-\n" +
+	"\x05items\x18\x03 \x03(\v2\x17.hipstershop.ReturnItemR\x05items\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"_\n" +
+	"\x14ApproveReturnRequest\x12\x1b\n" +
+	"\treturn_id\x18\x01 \x01(\tR\breturnId\x12*\n" +
+	"\x06refund\x18\x02 \x01(\v2\x12.hipstershop.MoneyR\x06refund\"\x9e\x02\n" +
+	"\x0eOrderCancelled\x12\x19\n" +
+	"\border_id\x18\x01 \x01(\tR\aorderId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12'\n" +
+	"\x0fprevious_status\x18\x03 \x01(\tR\x0epreviousStatus\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12(\n" +
+	"\x05total\x18\x05 \x01(\v2\x12.hipstershop.MoneyR\x05total\x120\n" +
+	"\x14shipping_tracking_id\x18\x06 \x01(\tR\x12shippingTrackingId\x12;\n" +
+	"\vcancel_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"cancelTime\".\n" +
 	"\tAdRequest\x12!\n" +
 	"\fcontext_keys\x18\x01 \x03(\tR\vcontextKeys\"/\n" +
 	"\n" +
@@ -1902,32 +8336,80 @@ const file_demo_proto_rawDesc = "" +
 	"\x03ads\x18\x01 \x03(\v2\x0f.hipstershop.AdR\x03ads\";\n" +
 	"\x02Ad\x12!\n" +
 	"\fredirect_url\x18\x01 \x01(\tR\vredirectUrl\x12\x12\n" +
-	"\x04text\x18\x02 \x01(\tR\x04text2\xca\x01\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text*@\n" +
+	"\rCatalogFormat\x12\x17\n" +
+	"\x13CATALOG_FORMAT_JSON\x10\x00\x12\x16\n" +
+	"\x12CATALOG_FORMAT_CSV\x10\x012\xca\x01\n" +
 	"\vCartService\x12<\n" +
 	"\aAddItem\x12\x1b.hipstershop.AddItemRequest\x1a\x12.hipstershop.Empty\"\x00\x12;\n" +
 	"\aGetCart\x12\x1b.hipstershop.GetCartRequest\x1a\x11.hipstershop.Cart\"\x00\x12@\n" +
 	"\tEmptyCart\x12\x1d.hipstershop.EmptyCartRequest\x1a\x12.hipstershop.Empty\"\x002\x83\x01\n" +
 	"\x15RecommendationService\x12j\n" +
-	"\x13ListRecommendations\x12'.hipstershop.ListRecommendationsRequest\x1a(.hipstershop.ListRecommendationsResponse\"\x002\xe8\x02\n" +
-	"\x15ProductCatalogService\x12G\n" +
-	"\fListProducts\x12\x12.hipstershop.Empty\x1a!.hipstershop.ListProductsResponse\"\x00\x12D\n" +
+	"\x13ListRecommendations\x12'.hipstershop.ListRecommendationsRequest\x1a(.hipstershop.ListRecommendationsResponse\"\x002\xa7\a\n" +
+	"\x15ProductCatalogService\x12U\n" +
+	"\fListProducts\x12 .hipstershop.ListProductsRequest\x1a!.hipstershop.ListProductsResponse\"\x00\x12D\n" +
 	"\n" +
 	"GetProduct\x12\x1e.hipstershop.GetProductRequest\x1a\x14.hipstershop.Product\"\x00\x12[\n" +
 	"\x0eSearchProducts\x12\".hipstershop.SearchProductsRequest\x1a#.hipstershop.SearchProductsResponse\"\x00\x12c\n" +
-	"\x16SemanticSearchProducts\x12\".hipstershop.SemanticSearchRequest\x1a#.hipstershop.SearchProductsResponse\"\x002\xaa\x01\n" +
+	"\x16SemanticSearchProducts\x12\".hipstershop.SemanticSearchRequest\x1a#.hipstershop.SearchProductsResponse\"\x00\x12k\n" +
+	"\x1cStreamSemanticSearchProducts\x12\".hipstershop.SemanticSearchRequest\x1a#.hipstershop.SearchProductsResponse\"\x000\x01\x12c\n" +
+	"\x12GetSimilarProducts\x12&.hipstershop.GetSimilarProductsRequest\x1a#.hipstershop.SearchProductsResponse\"\x00\x12^\n" +
+	"\x0fSuggestProducts\x12#.hipstershop.SuggestProductsRequest\x1a$.hipstershop.SuggestProductsResponse\"\x00\x12Q\n" +
+	"\x18RecordProductInteraction\x12\x1f.hipstershop.ProductInteraction\x1a\x12.hipstershop.Empty\"\x00\x12]\n" +
+	"\x13ImageSearchProducts\x12\x1f.hipstershop.ImageSearchRequest\x1a#.hipstershop.SearchProductsResponse\"\x00\x12K\n" +
+	"\x0eListCategories\x12\x12.hipstershop.Empty\x1a#.hipstershop.ListCategoriesResponse\"\x002\xe6\t\n" +
+	"\x1aProductCatalogAdminService\x12J\n" +
+	"\rCreateProduct\x12!.hipstershop.CreateProductRequest\x1a\x14.hipstershop.Product\"\x00\x12J\n" +
+	"\rUpdateProduct\x12!.hipstershop.UpdateProductRequest\x1a\x14.hipstershop.Product\"\x00\x12H\n" +
+	"\rDeleteProduct\x12!.hipstershop.DeleteProductRequest\x1a\x12.hipstershop.Empty\"\x00\x12I\n" +
+	"\rReloadCatalog\x12\x12.hipstershop.Empty\x1a\".hipstershop.ReloadCatalogResponse\"\x00\x12[\n" +
+	"\x0eImportProducts\x12\".hipstershop.ImportProductsRequest\x1a#.hipstershop.ImportProductsResponse\"\x00\x12[\n" +
+	"\x0eExportProducts\x12\".hipstershop.ExportProductsRequest\x1a#.hipstershop.ExportProductsResponse\"\x00\x12[\n" +
+	"\x17CreateMerchandisingRule\x12\x1e.hipstershop.MerchandisingRule\x1a\x1e.hipstershop.MerchandisingRule\"\x00\x12[\n" +
+	"\x16ListMerchandisingRules\x12\x12.hipstershop.Empty\x1a+.hipstershop.ListMerchandisingRulesResponse\"\x00\x12\\\n" +
+	"\x17DeleteMerchandisingRule\x12+.hipstershop.DeleteMerchandisingRuleRequest\x1a\x12.hipstershop.Empty\"\x00\x12@\n" +
+	"\x0eCreateCampaign\x12\x15.hipstershop.Campaign\x1a\x15.hipstershop.Campaign\"\x00\x12I\n" +
+	"\rListCampaigns\x12\x12.hipstershop.Empty\x1a\".hipstershop.ListCampaignsResponse\"\x00\x12M\n" +
+	"\x0eExpireCampaign\x12\".hipstershop.ExpireCampaignRequest\x1a\x15.hipstershop.Campaign\"\x00\x12M\n" +
+	"\x0eCreateCategory\x12\".hipstershop.CreateCategoryRequest\x1a\x15.hipstershop.Category\"\x00\x12J\n" +
+	"\x0eDeleteCategory\x12\".hipstershop.DeleteCategoryRequest\x1a\x12.hipstershop.Empty\"\x00\x12R\n" +
+	"\vUpdateStock\x12\x1f.hipstershop.UpdateStockRequest\x1a .hipstershop.UpdateStockResponse\"\x002\xaa\x01\n" +
 	"\x0fShippingService\x12I\n" +
 	"\bGetQuote\x12\x1c.hipstershop.GetQuoteRequest\x1a\x1d.hipstershop.GetQuoteResponse\"\x00\x12L\n" +
 	"\tShipOrder\x12\x1d.hipstershop.ShipOrderRequest\x1a\x1e.hipstershop.ShipOrderResponse\"\x002\xb7\x01\n" +
 	"\x0fCurrencyService\x12[\n" +
 	"\x16GetSupportedCurrencies\x12\x12.hipstershop.Empty\x1a+.hipstershop.GetSupportedCurrenciesResponse\"\x00\x12G\n" +
-	"\aConvert\x12&.hipstershop.CurrencyConversionRequest\x1a\x12.hipstershop.Money\"\x002U\n" +
+	"\aConvert\x12&.hipstershop.CurrencyConversionRequest\x1a\x12.hipstershop.Money\"\x002\xdd\x01\n" +
 	"\x0ePaymentService\x12C\n" +
-	"\x06Charge\x12\x1a.hipstershop.ChargeRequest\x1a\x1b.hipstershop.ChargeResponse\"\x002h\n" +
+	"\x06Charge\x12\x1a.hipstershop.ChargeRequest\x1a\x1b.hipstershop.ChargeResponse\"\x00\x12E\n" +
+	"\aCapture\x12\x1b.hipstershop.CaptureRequest\x1a\x1b.hipstershop.ChargeResponse\"\x00\x12?\n" +
+	"\x04Void\x12\x18.hipstershop.VoidRequest\x1a\x1b.hipstershop.ChargeResponse\"\x002h\n" +
 	"\fEmailService\x12X\n" +
-	"\x15SendOrderConfirmation\x12).hipstershop.SendOrderConfirmationRequest\x1a\x12.hipstershop.Empty\"\x002b\n" +
+	"\x15SendOrderConfirmation\x12).hipstershop.SendOrderConfirmationRequest\x1a\x12.hipstershop.Empty\"\x002\xe6\r\n" +
 	"\x0fCheckoutService\x12O\n" +
 	"\n" +
-	"PlaceOrder\x12\x1e.hipstershop.PlaceOrderRequest\x1a\x1f.hipstershop.PlaceOrderResponse\"\x002H\n" +
+	"PlaceOrder\x12\x1e.hipstershop.PlaceOrderRequest\x1a\x1f.hipstershop.PlaceOrderResponse\"\x00\x12^\n" +
+	"\x0fGetOrderHistory\x12#.hipstershop.GetOrderHistoryRequest\x1a$.hipstershop.GetOrderHistoryResponse\"\x00\x12>\n" +
+	"\bGetOrder\x12\x1c.hipstershop.GetOrderRequest\x1a\x12.hipstershop.Order\"\x00\x12V\n" +
+	"\x14GetOrderByTrackingID\x12(.hipstershop.GetOrderByTrackingIDRequest\x1a\x12.hipstershop.Order\"\x00\x12Y\n" +
+	"\x11GetUserOrderStats\x12%.hipstershop.GetUserOrderStatsRequest\x1a\x1b.hipstershop.UserOrderStats\"\x00\x12P\n" +
+	"\x11UpdateOrderStatus\x12%.hipstershop.UpdateOrderStatusRequest\x1a\x12.hipstershop.Order\"\x00\x12D\n" +
+	"\vCancelOrder\x12\x1f.hipstershop.CancelOrderRequest\x1a\x12.hipstershop.Order\"\x00\x12N\n" +
+	"\rRequestReturn\x12!.hipstershop.RequestReturnRequest\x1a\x18.hipstershop.OrderReturn\"\x00\x12N\n" +
+	"\rApproveReturn\x12!.hipstershop.ApproveReturnRequest\x1a\x18.hipstershop.OrderReturn\"\x00\x12F\n" +
+	"\aReorder\x12\x1b.hipstershop.ReorderRequest\x1a\x1c.hipstershop.ReorderResponse\"\x00\x12[\n" +
+	"\x0eExportUserData\x12\".hipstershop.ExportUserDataRequest\x1a#.hipstershop.ExportUserDataResponse\"\x00\x12[\n" +
+	"\x0eDeleteUserData\x12\".hipstershop.DeleteUserDataRequest\x1a#.hipstershop.DeleteUserDataResponse\"\x00\x12I\n" +
+	"\n" +
+	"AddAddress\x12\x1e.hipstershop.AddAddressRequest\x1a\x19.hipstershop.SavedAddress\"\x00\x12X\n" +
+	"\rListAddresses\x12!.hipstershop.ListAddressesRequest\x1a\".hipstershop.ListAddressesResponse\"\x00\x12H\n" +
+	"\rDeleteAddress\x12!.hipstershop.DeleteAddressRequest\x1a\x12.hipstershop.Empty\"\x00\x12W\n" +
+	"\x11SetDefaultAddress\x12%.hipstershop.SetDefaultAddressRequest\x1a\x19.hipstershop.SavedAddress\"\x00\x12M\n" +
+	"\x0eCreateShipment\x12\".hipstershop.CreateShipmentRequest\x1a\x15.hipstershop.Shipment\"\x00\x12Y\n" +
+	"\x14UpdateShipmentStatus\x12(.hipstershop.UpdateShipmentStatusRequest\x1a\x15.hipstershop.Shipment\"\x00\x12X\n" +
+	"\rListShipments\x12!.hipstershop.ListShipmentsRequest\x1a\".hipstershop.ListShipmentsResponse\"\x00\x12R\n" +
+	"\vClaimOrders\x12\x1f.hipstershop.ClaimOrdersRequest\x1a .hipstershop.ClaimOrdersResponse\"\x00\x12U\n" +
+	"\fSearchOrders\x12 .hipstershop.SearchOrdersRequest\x1a!.hipstershop.SearchOrdersResponse\"\x002H\n" +
 	"\tAdService\x12;\n" +
 	"\x06GetAds\x12\x16.hipstershop.AdRequest\x1a\x17.hipstershop.AdResponse\"\x00B?Z=github.com/GoogleCloudPlatform/microservices-demo/hipstershopb\x06proto3"
 
@@ -1943,103 +8425,364 @@ func file_demo_proto_rawDescGZIP() []byte {
 	return file_demo_proto_rawDescData
 }
 
-var file_demo_proto_msgTypes = make([]protoimpl.MessageInfo, 33)
+var file_demo_proto_enumTypes = make([]protoimpl.EnumInfo, 9)
+var file_demo_proto_msgTypes = make([]protoimpl.MessageInfo, 112)
 var file_demo_proto_goTypes = []any{
-	(*CartItem)(nil),                       // 0: hipstershop.CartItem
-	(*AddItemRequest)(nil),                 // 1: hipstershop.AddItemRequest
-	(*EmptyCartRequest)(nil),               // 2: hipstershop.EmptyCartRequest
-	(*GetCartRequest)(nil),                 // 3: hipstershop.GetCartRequest
-	(*Cart)(nil),                           // 4: hipstershop.Cart
-	(*Empty)(nil),                          // 5: hipstershop.Empty
-	(*ListRecommendationsRequest)(nil),     // 6: hipstershop.ListRecommendationsRequest
-	(*ListRecommendationsResponse)(nil),    // 7: hipstershop.ListRecommendationsResponse
-	(*Product)(nil),                        // 8: hipstershop.Product
-	(*ListProductsResponse)(nil),           // 9: hipstershop.ListProductsResponse
-	(*GetProductRequest)(nil),              // 10: hipstershop.GetProductRequest
-	(*SearchProductsRequest)(nil),          // 11: hipstershop.SearchProductsRequest
-	(*SearchProductsResponse)(nil),         // 12: hipstershop.SearchProductsResponse
-	(*SemanticSearchRequest)(nil),          // 13: hipstershop.SemanticSearchRequest
-	(*GetQuoteRequest)(nil),                // 14: hipstershop.GetQuoteRequest
-	(*GetQuoteResponse)(nil),               // 15: hipstershop.GetQuoteResponse
-	(*ShipOrderRequest)(nil),               // 16: hipstershop.ShipOrderRequest
-	(*ShipOrderResponse)(nil),              // 17: hipstershop.ShipOrderResponse
-	(*Address)(nil),                        // 18: hipstershop.Address
-	(*Money)(nil),                          // 19: hipstershop.Money
-	(*GetSupportedCurrenciesResponse)(nil), // 20: hipstershop.GetSupportedCurrenciesResponse
-	(*CurrencyConversionRequest)(nil),      // 21: hipstershop.CurrencyConversionRequest
-	(*CreditCardInfo)(nil),                 // 22: hipstershop.CreditCardInfo
-	(*ChargeRequest)(nil),                  // 23: hipstershop.ChargeRequest
-	(*ChargeResponse)(nil),                 // 24: hipstershop.ChargeResponse
-	(*OrderItem)(nil),                      // 25: hipstershop.OrderItem
-	(*OrderResult)(nil),                    // 26: hipstershop.OrderResult
-	(*SendOrderConfirmationRequest)(nil),   // 27: hipstershop.SendOrderConfirmationRequest
-	(*PlaceOrderRequest)(nil),              // 28: hipstershop.PlaceOrderRequest
-	(*PlaceOrderResponse)(nil),             // 29: hipstershop.PlaceOrderResponse
-	(*AdRequest)(nil),                      // 30: hipstershop.AdRequest
-	(*AdResponse)(nil),                     // 31: hipstershop.AdResponse
-	(*Ad)(nil),                             // 32: hipstershop.Ad
+	(CatalogFormat)(0),                     // 0: hipstershop.CatalogFormat
+	(Product_Status)(0),                    // 1: hipstershop.Product.Status
+	(SemanticSearchRequest_SortOrder)(0),   // 2: hipstershop.SemanticSearchRequest.SortOrder
+	(ProductInteraction_Kind)(0),           // 3: hipstershop.ProductInteraction.Kind
+	(Suggestion_Kind)(0),                   // 4: hipstershop.Suggestion.Kind
+	(MerchandisingRule_Action)(0),          // 5: hipstershop.MerchandisingRule.Action
+	(ProductChanged_Change)(0),             // 6: hipstershop.ProductChanged.Change
+	(ExportUserDataRequest_Format)(0),      // 7: hipstershop.ExportUserDataRequest.Format
+	(SearchOrdersRequest_SortBy)(0),        // 8: hipstershop.SearchOrdersRequest.SortBy
+	(*CartItem)(nil),                       // 9: hipstershop.CartItem
+	(*AddItemRequest)(nil),                 // 10: hipstershop.AddItemRequest
+	(*EmptyCartRequest)(nil),               // 11: hipstershop.EmptyCartRequest
+	(*GetCartRequest)(nil),                 // 12: hipstershop.GetCartRequest
+	(*Cart)(nil),                           // 13: hipstershop.Cart
+	(*Empty)(nil),                          // 14: hipstershop.Empty
+	(*ListRecommendationsRequest)(nil),     // 15: hipstershop.ListRecommendationsRequest
+	(*ListRecommendationsResponse)(nil),    // 16: hipstershop.ListRecommendationsResponse
+	(*Product)(nil),                        // 17: hipstershop.Product
+	(*Category)(nil),                       // 18: hipstershop.Category
+	(*ListCategoriesResponse)(nil),         // 19: hipstershop.ListCategoriesResponse
+	(*ProductVariant)(nil),                 // 20: hipstershop.ProductVariant
+	(*ProductVariantSummary)(nil),          // 21: hipstershop.ProductVariantSummary
+	(*ListProductsRequest)(nil),            // 22: hipstershop.ListProductsRequest
+	(*ListProductsResponse)(nil),           // 23: hipstershop.ListProductsResponse
+	(*GetProductRequest)(nil),              // 24: hipstershop.GetProductRequest
+	(*SearchProductsRequest)(nil),          // 25: hipstershop.SearchProductsRequest
+	(*SearchProductsResponse)(nil),         // 26: hipstershop.SearchProductsResponse
+	(*SearchDebug)(nil),                    // 27: hipstershop.SearchDebug
+	(*SearchFacets)(nil),                   // 28: hipstershop.SearchFacets
+	(*FacetCount)(nil),                     // 29: hipstershop.FacetCount
+	(*PriceBucketCount)(nil),               // 30: hipstershop.PriceBucketCount
+	(*SemanticSearchRequest)(nil),          // 31: hipstershop.SemanticSearchRequest
+	(*ImageSearchRequest)(nil),             // 32: hipstershop.ImageSearchRequest
+	(*ProductInteraction)(nil),             // 33: hipstershop.ProductInteraction
+	(*GetSimilarProductsRequest)(nil),      // 34: hipstershop.GetSimilarProductsRequest
+	(*SuggestProductsRequest)(nil),         // 35: hipstershop.SuggestProductsRequest
+	(*Suggestion)(nil),                     // 36: hipstershop.Suggestion
+	(*SuggestProductsResponse)(nil),        // 37: hipstershop.SuggestProductsResponse
+	(*HybridSearchWeights)(nil),            // 38: hipstershop.HybridSearchWeights
+	(*CreateProductRequest)(nil),           // 39: hipstershop.CreateProductRequest
+	(*UpdateProductRequest)(nil),           // 40: hipstershop.UpdateProductRequest
+	(*DeleteProductRequest)(nil),           // 41: hipstershop.DeleteProductRequest
+	(*ReloadCatalogResponse)(nil),          // 42: hipstershop.ReloadCatalogResponse
+	(*ImportProductsRequest)(nil),          // 43: hipstershop.ImportProductsRequest
+	(*ImportProductsResponse)(nil),         // 44: hipstershop.ImportProductsResponse
+	(*ExportProductsRequest)(nil),          // 45: hipstershop.ExportProductsRequest
+	(*ExportProductsResponse)(nil),         // 46: hipstershop.ExportProductsResponse
+	(*MerchandisingRule)(nil),              // 47: hipstershop.MerchandisingRule
+	(*ListMerchandisingRulesResponse)(nil), // 48: hipstershop.ListMerchandisingRulesResponse
+	(*DeleteMerchandisingRuleRequest)(nil), // 49: hipstershop.DeleteMerchandisingRuleRequest
+	(*Campaign)(nil),                       // 50: hipstershop.Campaign
+	(*ListCampaignsResponse)(nil),          // 51: hipstershop.ListCampaignsResponse
+	(*ExpireCampaignRequest)(nil),          // 52: hipstershop.ExpireCampaignRequest
+	(*CreateCategoryRequest)(nil),          // 53: hipstershop.CreateCategoryRequest
+	(*DeleteCategoryRequest)(nil),          // 54: hipstershop.DeleteCategoryRequest
+	(*StockLevel)(nil),                     // 55: hipstershop.StockLevel
+	(*UpdateStockRequest)(nil),             // 56: hipstershop.UpdateStockRequest
+	(*UpdateStockResponse)(nil),            // 57: hipstershop.UpdateStockResponse
+	(*ProductChanged)(nil),                 // 58: hipstershop.ProductChanged
+	(*GetQuoteRequest)(nil),                // 59: hipstershop.GetQuoteRequest
+	(*GetQuoteResponse)(nil),               // 60: hipstershop.GetQuoteResponse
+	(*ShipOrderRequest)(nil),               // 61: hipstershop.ShipOrderRequest
+	(*ShipOrderResponse)(nil),              // 62: hipstershop.ShipOrderResponse
+	(*Address)(nil),                        // 63: hipstershop.Address
+	(*Money)(nil),                          // 64: hipstershop.Money
+	(*GetSupportedCurrenciesResponse)(nil), // 65: hipstershop.GetSupportedCurrenciesResponse
+	(*CurrencyConversionRequest)(nil),      // 66: hipstershop.CurrencyConversionRequest
+	(*CreditCardInfo)(nil),                 // 67: hipstershop.CreditCardInfo
+	(*ChargeRequest)(nil),                  // 68: hipstershop.ChargeRequest
+	(*CaptureRequest)(nil),                 // 69: hipstershop.CaptureRequest
+	(*VoidRequest)(nil),                    // 70: hipstershop.VoidRequest
+	(*ChargeResponse)(nil),                 // 71: hipstershop.ChargeResponse
+	(*OrderItem)(nil),                      // 72: hipstershop.OrderItem
+	(*OrderResult)(nil),                    // 73: hipstershop.OrderResult
+	(*TaxLine)(nil),                        // 74: hipstershop.TaxLine
+	(*SendOrderConfirmationRequest)(nil),   // 75: hipstershop.SendOrderConfirmationRequest
+	(*PlaceOrderRequest)(nil),              // 76: hipstershop.PlaceOrderRequest
+	(*PlaceOrderResponse)(nil),             // 77: hipstershop.PlaceOrderResponse
+	(*Order)(nil),                          // 78: hipstershop.Order
+	(*GetOrderHistoryRequest)(nil),         // 79: hipstershop.GetOrderHistoryRequest
+	(*GetOrderHistoryResponse)(nil),        // 80: hipstershop.GetOrderHistoryResponse
+	(*GetOrderRequest)(nil),                // 81: hipstershop.GetOrderRequest
+	(*GetOrderByTrackingIDRequest)(nil),    // 82: hipstershop.GetOrderByTrackingIDRequest
+	(*GetUserOrderStatsRequest)(nil),       // 83: hipstershop.GetUserOrderStatsRequest
+	(*UserOrderStats)(nil),                 // 84: hipstershop.UserOrderStats
+	(*ProductOrderStats)(nil),              // 85: hipstershop.ProductOrderStats
+	(*ReorderRequest)(nil),                 // 86: hipstershop.ReorderRequest
+	(*ReorderResponse)(nil),                // 87: hipstershop.ReorderResponse
+	(*ReorderUnavailableItem)(nil),         // 88: hipstershop.ReorderUnavailableItem
+	(*ExportUserDataRequest)(nil),          // 89: hipstershop.ExportUserDataRequest
+	(*ExportUserDataResponse)(nil),         // 90: hipstershop.ExportUserDataResponse
+	(*DeleteUserDataRequest)(nil),          // 91: hipstershop.DeleteUserDataRequest
+	(*DeleteUserDataResponse)(nil),         // 92: hipstershop.DeleteUserDataResponse
+	(*SavedAddress)(nil),                   // 93: hipstershop.SavedAddress
+	(*AddAddressRequest)(nil),              // 94: hipstershop.AddAddressRequest
+	(*ListAddressesRequest)(nil),           // 95: hipstershop.ListAddressesRequest
+	(*ListAddressesResponse)(nil),          // 96: hipstershop.ListAddressesResponse
+	(*DeleteAddressRequest)(nil),           // 97: hipstershop.DeleteAddressRequest
+	(*SetDefaultAddressRequest)(nil),       // 98: hipstershop.SetDefaultAddressRequest
+	(*ShipmentItem)(nil),                   // 99: hipstershop.ShipmentItem
+	(*Shipment)(nil),                       // 100: hipstershop.Shipment
+	(*CreateShipmentRequest)(nil),          // 101: hipstershop.CreateShipmentRequest
+	(*UpdateShipmentStatusRequest)(nil),    // 102: hipstershop.UpdateShipmentStatusRequest
+	(*ListShipmentsRequest)(nil),           // 103: hipstershop.ListShipmentsRequest
+	(*ItemFulfillment)(nil),                // 104: hipstershop.ItemFulfillment
+	(*ListShipmentsResponse)(nil),          // 105: hipstershop.ListShipmentsResponse
+	(*ClaimOrdersRequest)(nil),             // 106: hipstershop.ClaimOrdersRequest
+	(*ClaimOrdersResponse)(nil),            // 107: hipstershop.ClaimOrdersResponse
+	(*SearchOrdersRequest)(nil),            // 108: hipstershop.SearchOrdersRequest
+	(*SearchOrdersResponse)(nil),           // 109: hipstershop.SearchOrdersResponse
+	(*UpdateOrderStatusRequest)(nil),       // 110: hipstershop.UpdateOrderStatusRequest
+	(*CancelOrderRequest)(nil),             // 111: hipstershop.CancelOrderRequest
+	(*ReturnItem)(nil),                     // 112: hipstershop.ReturnItem
+	(*OrderReturn)(nil),                    // 113: hipstershop.OrderReturn
+	(*RequestReturnRequest)(nil),           // 114: hipstershop.RequestReturnRequest
+	(*ApproveReturnRequest)(nil),           // 115: hipstershop.ApproveReturnRequest
+	(*OrderCancelled)(nil),                 // 116: hipstershop.OrderCancelled
+	(*AdRequest)(nil),                      // 117: hipstershop.AdRequest
+	(*AdResponse)(nil),                     // 118: hipstershop.AdResponse
+	(*Ad)(nil),                             // 119: hipstershop.Ad
+	(*SearchDebug_ResultScores)(nil),       // 120: hipstershop.SearchDebug.ResultScores
+	(*fieldmaskpb.FieldMask)(nil),          // 121: google.protobuf.FieldMask
+	(*timestamppb.Timestamp)(nil),          // 122: google.protobuf.Timestamp
 }
 var file_demo_proto_depIdxs = []int32{
-	0,  // 0: hipstershop.AddItemRequest.item:type_name -> hipstershop.CartItem
-	0,  // 1: hipstershop.Cart.items:type_name -> hipstershop.CartItem
-	19, // 2: hipstershop.Product.price_usd:type_name -> hipstershop.Money
-	8,  // 3: hipstershop.ListProductsResponse.products:type_name -> hipstershop.Product
-	8,  // 4: hipstershop.SearchProductsResponse.results:type_name -> hipstershop.Product
-	18, // 5: hipstershop.GetQuoteRequest.address:type_name -> hipstershop.Address
-	0,  // 6: hipstershop.GetQuoteRequest.items:type_name -> hipstershop.CartItem
-	19, // 7: hipstershop.GetQuoteResponse.cost_usd:type_name -> hipstershop.Money
-	18, // 8: hipstershop.ShipOrderRequest.address:type_name -> hipstershop.Address
-	0,  // 9: hipstershop.ShipOrderRequest.items:type_name -> hipstershop.CartItem
-	19, // 10: hipstershop.CurrencyConversionRequest.from:type_name -> hipstershop.Money
-	19, // 11: hipstershop.ChargeRequest.amount:type_name -> hipstershop.Money
-	22, // 12: hipstershop.ChargeRequest.credit_card:type_name -> hipstershop.CreditCardInfo
-	0,  // 13: hipstershop.OrderItem.item:type_name -> hipstershop.CartItem
-	19, // 14: hipstershop.OrderItem.cost:type_name -> hipstershop.Money
-	19, // 15: hipstershop.OrderResult.shipping_cost:type_name -> hipstershop.Money
-	18, // 16: hipstershop.OrderResult.shipping_address:type_name -> hipstershop.Address
-	25, // 17: hipstershop.OrderResult.items:type_name -> hipstershop.OrderItem
-	26, // 18: hipstershop.SendOrderConfirmationRequest.order:type_name -> hipstershop.OrderResult
-	18, // 19: hipstershop.PlaceOrderRequest.address:type_name -> hipstershop.Address
-	22, // 20: hipstershop.PlaceOrderRequest.credit_card:type_name -> hipstershop.CreditCardInfo
-	26, // 21: hipstershop.PlaceOrderResponse.order:type_name -> hipstershop.OrderResult
-	32, // 22: hipstershop.AdResponse.ads:type_name -> hipstershop.Ad
-	1,  // 23: hipstershop.CartService.AddItem:input_type -> hipstershop.AddItemRequest
-	3,  // 24: hipstershop.CartService.GetCart:input_type -> hipstershop.GetCartRequest
-	2,  // 25: hipstershop.CartService.EmptyCart:input_type -> hipstershop.EmptyCartRequest
-	6,  // 26: hipstershop.RecommendationService.ListRecommendations:input_type -> hipstershop.ListRecommendationsRequest
-	5,  // 27: hipstershop.ProductCatalogService.ListProducts:input_type -> hipstershop.Empty
-	10, // 28: hipstershop.ProductCatalogService.GetProduct:input_type -> hipstershop.GetProductRequest
-	11, // 29: hipstershop.ProductCatalogService.SearchProducts:input_type -> hipstershop.SearchProductsRequest
-	13, // 30: hipstershop.ProductCatalogService.SemanticSearchProducts:input_type -> hipstershop.SemanticSearchRequest
-	14, // 31: hipstershop.ShippingService.GetQuote:input_type -> hipstershop.GetQuoteRequest
-	16, // 32: hipstershop.ShippingService.ShipOrder:input_type -> hipstershop.ShipOrderRequest
-	5,  // 33: hipstershop.CurrencyService.GetSupportedCurrencies:input_type -> hipstershop.Empty
-	21, // 34: hipstershop.CurrencyService.Convert:input_type -> hipstershop.CurrencyConversionRequest
-	23, // 35: hipstershop.PaymentService.Charge:input_type -> hipstershop.ChargeRequest
-	27, // 36: hipstershop.EmailService.SendOrderConfirmation:input_type -> hipstershop.SendOrderConfirmationRequest
-	28, // 37: hipstershop.CheckoutService.PlaceOrder:input_type -> hipstershop.PlaceOrderRequest
-	30, // 38: hipstershop.AdService.GetAds:input_type -> hipstershop.AdRequest
-	5,  // 39: hipstershop.CartService.AddItem:output_type -> hipstershop.Empty
-	4,  // 40: hipstershop.CartService.GetCart:output_type -> hipstershop.Cart
-	5,  // 41: hipstershop.CartService.EmptyCart:output_type -> hipstershop.Empty
-	7,  // 42: hipstershop.RecommendationService.ListRecommendations:output_type -> hipstershop.ListRecommendationsResponse
-	9,  // 43: hipstershop.ProductCatalogService.ListProducts:output_type -> hipstershop.ListProductsResponse
-	8,  // 44: hipstershop.ProductCatalogService.GetProduct:output_type -> hipstershop.Product
-	12, // 45: hipstershop.ProductCatalogService.SearchProducts:output_type -> hipstershop.SearchProductsResponse
-	12, // 46: hipstershop.ProductCatalogService.SemanticSearchProducts:output_type -> hipstershop.SearchProductsResponse
-	15, // 47: hipstershop.ShippingService.GetQuote:output_type -> hipstershop.GetQuoteResponse
-	17, // 48: hipstershop.ShippingService.ShipOrder:output_type -> hipstershop.ShipOrderResponse
-	20, // 49: hipstershop.CurrencyService.GetSupportedCurrencies:output_type -> hipstershop.GetSupportedCurrenciesResponse
-	19, // 50: hipstershop.CurrencyService.Convert:output_type -> hipstershop.Money
-	24, // 51: hipstershop.PaymentService.Charge:output_type -> hipstershop.ChargeResponse
-	5,  // 52: hipstershop.EmailService.SendOrderConfirmation:output_type -> hipstershop.Empty
-	29, // 53: hipstershop.CheckoutService.PlaceOrder:output_type -> hipstershop.PlaceOrderResponse
-	31, // 54: hipstershop.AdService.GetAds:output_type -> hipstershop.AdResponse
-	39, // [39:55] is the sub-list for method output_type
-	23, // [23:39] is the sub-list for method input_type
-	23, // [23:23] is the sub-list for extension type_name
-	23, // [23:23] is the sub-list for extension extendee
-	0,  // [0:23] is the sub-list for field type_name
+	9,   // 0: hipstershop.AddItemRequest.item:type_name -> hipstershop.CartItem
+	9,   // 1: hipstershop.Cart.items:type_name -> hipstershop.CartItem
+	64,  // 2: hipstershop.Product.price_usd:type_name -> hipstershop.Money
+	20,  // 3: hipstershop.Product.variants:type_name -> hipstershop.ProductVariant
+	21,  // 4: hipstershop.Product.variant_summary:type_name -> hipstershop.ProductVariantSummary
+	1,   // 5: hipstershop.Product.status:type_name -> hipstershop.Product.Status
+	18,  // 6: hipstershop.Category.children:type_name -> hipstershop.Category
+	18,  // 7: hipstershop.ListCategoriesResponse.categories:type_name -> hipstershop.Category
+	64,  // 8: hipstershop.ProductVariant.price_delta_usd:type_name -> hipstershop.Money
+	64,  // 9: hipstershop.ProductVariantSummary.min_price_usd:type_name -> hipstershop.Money
+	64,  // 10: hipstershop.ProductVariantSummary.max_price_usd:type_name -> hipstershop.Money
+	121, // 11: hipstershop.ListProductsRequest.read_mask:type_name -> google.protobuf.FieldMask
+	17,  // 12: hipstershop.ListProductsResponse.products:type_name -> hipstershop.Product
+	17,  // 13: hipstershop.SearchProductsResponse.results:type_name -> hipstershop.Product
+	28,  // 14: hipstershop.SearchProductsResponse.facets:type_name -> hipstershop.SearchFacets
+	27,  // 15: hipstershop.SearchProductsResponse.debug:type_name -> hipstershop.SearchDebug
+	38,  // 16: hipstershop.SearchDebug.weights:type_name -> hipstershop.HybridSearchWeights
+	120, // 17: hipstershop.SearchDebug.scores:type_name -> hipstershop.SearchDebug.ResultScores
+	29,  // 18: hipstershop.SearchFacets.categories:type_name -> hipstershop.FacetCount
+	29,  // 19: hipstershop.SearchFacets.target_tags:type_name -> hipstershop.FacetCount
+	30,  // 20: hipstershop.SearchFacets.price_buckets:type_name -> hipstershop.PriceBucketCount
+	64,  // 21: hipstershop.PriceBucketCount.min:type_name -> hipstershop.Money
+	64,  // 22: hipstershop.PriceBucketCount.max:type_name -> hipstershop.Money
+	64,  // 23: hipstershop.SemanticSearchRequest.min_price_usd:type_name -> hipstershop.Money
+	64,  // 24: hipstershop.SemanticSearchRequest.max_price_usd:type_name -> hipstershop.Money
+	38,  // 25: hipstershop.SemanticSearchRequest.weights:type_name -> hipstershop.HybridSearchWeights
+	2,   // 26: hipstershop.SemanticSearchRequest.sort_by:type_name -> hipstershop.SemanticSearchRequest.SortOrder
+	3,   // 27: hipstershop.ProductInteraction.kind:type_name -> hipstershop.ProductInteraction.Kind
+	4,   // 28: hipstershop.Suggestion.kind:type_name -> hipstershop.Suggestion.Kind
+	36,  // 29: hipstershop.SuggestProductsResponse.suggestions:type_name -> hipstershop.Suggestion
+	17,  // 30: hipstershop.CreateProductRequest.product:type_name -> hipstershop.Product
+	17,  // 31: hipstershop.UpdateProductRequest.product:type_name -> hipstershop.Product
+	0,   // 32: hipstershop.ImportProductsRequest.format:type_name -> hipstershop.CatalogFormat
+	0,   // 33: hipstershop.ExportProductsRequest.format:type_name -> hipstershop.CatalogFormat
+	5,   // 34: hipstershop.MerchandisingRule.action:type_name -> hipstershop.MerchandisingRule.Action
+	122, // 35: hipstershop.MerchandisingRule.start_time:type_name -> google.protobuf.Timestamp
+	122, // 36: hipstershop.MerchandisingRule.end_time:type_name -> google.protobuf.Timestamp
+	47,  // 37: hipstershop.ListMerchandisingRulesResponse.rules:type_name -> hipstershop.MerchandisingRule
+	122, // 38: hipstershop.Campaign.start_time:type_name -> google.protobuf.Timestamp
+	122, // 39: hipstershop.Campaign.end_time:type_name -> google.protobuf.Timestamp
+	50,  // 40: hipstershop.ListCampaignsResponse.campaigns:type_name -> hipstershop.Campaign
+	55,  // 41: hipstershop.UpdateStockRequest.levels:type_name -> hipstershop.StockLevel
+	6,   // 42: hipstershop.ProductChanged.change:type_name -> hipstershop.ProductChanged.Change
+	17,  // 43: hipstershop.ProductChanged.product:type_name -> hipstershop.Product
+	122, // 44: hipstershop.ProductChanged.change_time:type_name -> google.protobuf.Timestamp
+	63,  // 45: hipstershop.GetQuoteRequest.address:type_name -> hipstershop.Address
+	9,   // 46: hipstershop.GetQuoteRequest.items:type_name -> hipstershop.CartItem
+	64,  // 47: hipstershop.GetQuoteResponse.cost_usd:type_name -> hipstershop.Money
+	63,  // 48: hipstershop.ShipOrderRequest.address:type_name -> hipstershop.Address
+	9,   // 49: hipstershop.ShipOrderRequest.items:type_name -> hipstershop.CartItem
+	64,  // 50: hipstershop.CurrencyConversionRequest.from:type_name -> hipstershop.Money
+	64,  // 51: hipstershop.ChargeRequest.amount:type_name -> hipstershop.Money
+	67,  // 52: hipstershop.ChargeRequest.credit_card:type_name -> hipstershop.CreditCardInfo
+	9,   // 53: hipstershop.OrderItem.item:type_name -> hipstershop.CartItem
+	64,  // 54: hipstershop.OrderItem.cost:type_name -> hipstershop.Money
+	64,  // 55: hipstershop.OrderResult.shipping_cost:type_name -> hipstershop.Money
+	63,  // 56: hipstershop.OrderResult.shipping_address:type_name -> hipstershop.Address
+	72,  // 57: hipstershop.OrderResult.items:type_name -> hipstershop.OrderItem
+	64,  // 58: hipstershop.OrderResult.discount:type_name -> hipstershop.Money
+	64,  // 59: hipstershop.OrderResult.tax:type_name -> hipstershop.Money
+	74,  // 60: hipstershop.OrderResult.tax_lines:type_name -> hipstershop.TaxLine
+	64,  // 61: hipstershop.TaxLine.amount:type_name -> hipstershop.Money
+	73,  // 62: hipstershop.SendOrderConfirmationRequest.order:type_name -> hipstershop.OrderResult
+	63,  // 63: hipstershop.PlaceOrderRequest.address:type_name -> hipstershop.Address
+	67,  // 64: hipstershop.PlaceOrderRequest.credit_card:type_name -> hipstershop.CreditCardInfo
+	73,  // 65: hipstershop.PlaceOrderResponse.order:type_name -> hipstershop.OrderResult
+	64,  // 66: hipstershop.Order.total:type_name -> hipstershop.Money
+	122, // 67: hipstershop.Order.order_time:type_name -> google.protobuf.Timestamp
+	72,  // 68: hipstershop.Order.items:type_name -> hipstershop.OrderItem
+	64,  // 69: hipstershop.Order.discount:type_name -> hipstershop.Money
+	64,  // 70: hipstershop.Order.subtotal:type_name -> hipstershop.Money
+	64,  // 71: hipstershop.Order.tax:type_name -> hipstershop.Money
+	74,  // 72: hipstershop.Order.tax_lines:type_name -> hipstershop.TaxLine
+	122, // 73: hipstershop.GetOrderHistoryRequest.start_time:type_name -> google.protobuf.Timestamp
+	122, // 74: hipstershop.GetOrderHistoryRequest.end_time:type_name -> google.protobuf.Timestamp
+	78,  // 75: hipstershop.GetOrderHistoryResponse.orders:type_name -> hipstershop.Order
+	64,  // 76: hipstershop.UserOrderStats.lifetime_spend:type_name -> hipstershop.Money
+	122, // 77: hipstershop.UserOrderStats.first_order_time:type_name -> google.protobuf.Timestamp
+	122, // 78: hipstershop.UserOrderStats.last_order_time:type_name -> google.protobuf.Timestamp
+	85,  // 79: hipstershop.UserOrderStats.top_products:type_name -> hipstershop.ProductOrderStats
+	9,   // 80: hipstershop.ReorderResponse.items:type_name -> hipstershop.CartItem
+	88,  // 81: hipstershop.ReorderResponse.unavailable:type_name -> hipstershop.ReorderUnavailableItem
+	7,   // 82: hipstershop.ExportUserDataRequest.format:type_name -> hipstershop.ExportUserDataRequest.Format
+	63,  // 83: hipstershop.SavedAddress.address:type_name -> hipstershop.Address
+	122, // 84: hipstershop.SavedAddress.create_time:type_name -> google.protobuf.Timestamp
+	63,  // 85: hipstershop.AddAddressRequest.address:type_name -> hipstershop.Address
+	93,  // 86: hipstershop.ListAddressesResponse.addresses:type_name -> hipstershop.SavedAddress
+	99,  // 87: hipstershop.Shipment.items:type_name -> hipstershop.ShipmentItem
+	122, // 88: hipstershop.Shipment.create_time:type_name -> google.protobuf.Timestamp
+	122, // 89: hipstershop.Shipment.update_time:type_name -> google.protobuf.Timestamp
+	99,  // 90: hipstershop.CreateShipmentRequest.items:type_name -> hipstershop.ShipmentItem
+	100, // 91: hipstershop.ListShipmentsResponse.shipments:type_name -> hipstershop.Shipment
+	104, // 92: hipstershop.ListShipmentsResponse.items:type_name -> hipstershop.ItemFulfillment
+	122, // 93: hipstershop.SearchOrdersRequest.start_time:type_name -> google.protobuf.Timestamp
+	122, // 94: hipstershop.SearchOrdersRequest.end_time:type_name -> google.protobuf.Timestamp
+	64,  // 95: hipstershop.SearchOrdersRequest.min_total:type_name -> hipstershop.Money
+	64,  // 96: hipstershop.SearchOrdersRequest.max_total:type_name -> hipstershop.Money
+	8,   // 97: hipstershop.SearchOrdersRequest.sort_by:type_name -> hipstershop.SearchOrdersRequest.SortBy
+	78,  // 98: hipstershop.SearchOrdersResponse.orders:type_name -> hipstershop.Order
+	112, // 99: hipstershop.OrderReturn.items:type_name -> hipstershop.ReturnItem
+	64,  // 100: hipstershop.OrderReturn.refund:type_name -> hipstershop.Money
+	122, // 101: hipstershop.OrderReturn.create_time:type_name -> google.protobuf.Timestamp
+	112, // 102: hipstershop.RequestReturnRequest.items:type_name -> hipstershop.ReturnItem
+	64,  // 103: hipstershop.ApproveReturnRequest.refund:type_name -> hipstershop.Money
+	64,  // 104: hipstershop.OrderCancelled.total:type_name -> hipstershop.Money
+	122, // 105: hipstershop.OrderCancelled.cancel_time:type_name -> google.protobuf.Timestamp
+	119, // 106: hipstershop.AdResponse.ads:type_name -> hipstershop.Ad
+	10,  // 107: hipstershop.CartService.AddItem:input_type -> hipstershop.AddItemRequest
+	12,  // 108: hipstershop.CartService.GetCart:input_type -> hipstershop.GetCartRequest
+	11,  // 109: hipstershop.CartService.EmptyCart:input_type -> hipstershop.EmptyCartRequest
+	15,  // 110: hipstershop.RecommendationService.ListRecommendations:input_type -> hipstershop.ListRecommendationsRequest
+	22,  // 111: hipstershop.ProductCatalogService.ListProducts:input_type -> hipstershop.ListProductsRequest
+	24,  // 112: hipstershop.ProductCatalogService.GetProduct:input_type -> hipstershop.GetProductRequest
+	25,  // 113: hipstershop.ProductCatalogService.SearchProducts:input_type -> hipstershop.SearchProductsRequest
+	31,  // 114: hipstershop.ProductCatalogService.SemanticSearchProducts:input_type -> hipstershop.SemanticSearchRequest
+	31,  // 115: hipstershop.ProductCatalogService.StreamSemanticSearchProducts:input_type -> hipstershop.SemanticSearchRequest
+	34,  // 116: hipstershop.ProductCatalogService.GetSimilarProducts:input_type -> hipstershop.GetSimilarProductsRequest
+	35,  // 117: hipstershop.ProductCatalogService.SuggestProducts:input_type -> hipstershop.SuggestProductsRequest
+	33,  // 118: hipstershop.ProductCatalogService.RecordProductInteraction:input_type -> hipstershop.ProductInteraction
+	32,  // 119: hipstershop.ProductCatalogService.ImageSearchProducts:input_type -> hipstershop.ImageSearchRequest
+	14,  // 120: hipstershop.ProductCatalogService.ListCategories:input_type -> hipstershop.Empty
+	39,  // 121: hipstershop.ProductCatalogAdminService.CreateProduct:input_type -> hipstershop.CreateProductRequest
+	40,  // 122: hipstershop.ProductCatalogAdminService.UpdateProduct:input_type -> hipstershop.UpdateProductRequest
+	41,  // 123: hipstershop.ProductCatalogAdminService.DeleteProduct:input_type -> hipstershop.DeleteProductRequest
+	14,  // 124: hipstershop.ProductCatalogAdminService.ReloadCatalog:input_type -> hipstershop.Empty
+	43,  // 125: hipstershop.ProductCatalogAdminService.ImportProducts:input_type -> hipstershop.ImportProductsRequest
+	45,  // 126: hipstershop.ProductCatalogAdminService.ExportProducts:input_type -> hipstershop.ExportProductsRequest
+	47,  // 127: hipstershop.ProductCatalogAdminService.CreateMerchandisingRule:input_type -> hipstershop.MerchandisingRule
+	14,  // 128: hipstershop.ProductCatalogAdminService.ListMerchandisingRules:input_type -> hipstershop.Empty
+	49,  // 129: hipstershop.ProductCatalogAdminService.DeleteMerchandisingRule:input_type -> hipstershop.DeleteMerchandisingRuleRequest
+	50,  // 130: hipstershop.ProductCatalogAdminService.CreateCampaign:input_type -> hipstershop.Campaign
+	14,  // 131: hipstershop.ProductCatalogAdminService.ListCampaigns:input_type -> hipstershop.Empty
+	52,  // 132: hipstershop.ProductCatalogAdminService.ExpireCampaign:input_type -> hipstershop.ExpireCampaignRequest
+	53,  // 133: hipstershop.ProductCatalogAdminService.CreateCategory:input_type -> hipstershop.CreateCategoryRequest
+	54,  // 134: hipstershop.ProductCatalogAdminService.DeleteCategory:input_type -> hipstershop.DeleteCategoryRequest
+	56,  // 135: hipstershop.ProductCatalogAdminService.UpdateStock:input_type -> hipstershop.UpdateStockRequest
+	59,  // 136: hipstershop.ShippingService.GetQuote:input_type -> hipstershop.GetQuoteRequest
+	61,  // 137: hipstershop.ShippingService.ShipOrder:input_type -> hipstershop.ShipOrderRequest
+	14,  // 138: hipstershop.CurrencyService.GetSupportedCurrencies:input_type -> hipstershop.Empty
+	66,  // 139: hipstershop.CurrencyService.Convert:input_type -> hipstershop.CurrencyConversionRequest
+	68,  // 140: hipstershop.PaymentService.Charge:input_type -> hipstershop.ChargeRequest
+	69,  // 141: hipstershop.PaymentService.Capture:input_type -> hipstershop.CaptureRequest
+	70,  // 142: hipstershop.PaymentService.Void:input_type -> hipstershop.VoidRequest
+	75,  // 143: hipstershop.EmailService.SendOrderConfirmation:input_type -> hipstershop.SendOrderConfirmationRequest
+	76,  // 144: hipstershop.CheckoutService.PlaceOrder:input_type -> hipstershop.PlaceOrderRequest
+	79,  // 145: hipstershop.CheckoutService.GetOrderHistory:input_type -> hipstershop.GetOrderHistoryRequest
+	81,  // 146: hipstershop.CheckoutService.GetOrder:input_type -> hipstershop.GetOrderRequest
+	82,  // 147: hipstershop.CheckoutService.GetOrderByTrackingID:input_type -> hipstershop.GetOrderByTrackingIDRequest
+	83,  // 148: hipstershop.CheckoutService.GetUserOrderStats:input_type -> hipstershop.GetUserOrderStatsRequest
+	110, // 149: hipstershop.CheckoutService.UpdateOrderStatus:input_type -> hipstershop.UpdateOrderStatusRequest
+	111, // 150: hipstershop.CheckoutService.CancelOrder:input_type -> hipstershop.CancelOrderRequest
+	114, // 151: hipstershop.CheckoutService.RequestReturn:input_type -> hipstershop.RequestReturnRequest
+	115, // 152: hipstershop.CheckoutService.ApproveReturn:input_type -> hipstershop.ApproveReturnRequest
+	86,  // 153: hipstershop.CheckoutService.Reorder:input_type -> hipstershop.ReorderRequest
+	89,  // 154: hipstershop.CheckoutService.ExportUserData:input_type -> hipstershop.ExportUserDataRequest
+	91,  // 155: hipstershop.CheckoutService.DeleteUserData:input_type -> hipstershop.DeleteUserDataRequest
+	94,  // 156: hipstershop.CheckoutService.AddAddress:input_type -> hipstershop.AddAddressRequest
+	95,  // 157: hipstershop.CheckoutService.ListAddresses:input_type -> hipstershop.ListAddressesRequest
+	97,  // 158: hipstershop.CheckoutService.DeleteAddress:input_type -> hipstershop.DeleteAddressRequest
+	98,  // 159: hipstershop.CheckoutService.SetDefaultAddress:input_type -> hipstershop.SetDefaultAddressRequest
+	101, // 160: hipstershop.CheckoutService.CreateShipment:input_type -> hipstershop.CreateShipmentRequest
+	102, // 161: hipstershop.CheckoutService.UpdateShipmentStatus:input_type -> hipstershop.UpdateShipmentStatusRequest
+	103, // 162: hipstershop.CheckoutService.ListShipments:input_type -> hipstershop.ListShipmentsRequest
+	106, // 163: hipstershop.CheckoutService.ClaimOrders:input_type -> hipstershop.ClaimOrdersRequest
+	108, // 164: hipstershop.CheckoutService.SearchOrders:input_type -> hipstershop.SearchOrdersRequest
+	117, // 165: hipstershop.AdService.GetAds:input_type -> hipstershop.AdRequest
+	14,  // 166: hipstershop.CartService.AddItem:output_type -> hipstershop.Empty
+	13,  // 167: hipstershop.CartService.GetCart:output_type -> hipstershop.Cart
+	14,  // 168: hipstershop.CartService.EmptyCart:output_type -> hipstershop.Empty
+	16,  // 169: hipstershop.RecommendationService.ListRecommendations:output_type -> hipstershop.ListRecommendationsResponse
+	23,  // 170: hipstershop.ProductCatalogService.ListProducts:output_type -> hipstershop.ListProductsResponse
+	17,  // 171: hipstershop.ProductCatalogService.GetProduct:output_type -> hipstershop.Product
+	26,  // 172: hipstershop.ProductCatalogService.SearchProducts:output_type -> hipstershop.SearchProductsResponse
+	26,  // 173: hipstershop.ProductCatalogService.SemanticSearchProducts:output_type -> hipstershop.SearchProductsResponse
+	26,  // 174: hipstershop.ProductCatalogService.StreamSemanticSearchProducts:output_type -> hipstershop.SearchProductsResponse
+	26,  // 175: hipstershop.ProductCatalogService.GetSimilarProducts:output_type -> hipstershop.SearchProductsResponse
+	37,  // 176: hipstershop.ProductCatalogService.SuggestProducts:output_type -> hipstershop.SuggestProductsResponse
+	14,  // 177: hipstershop.ProductCatalogService.RecordProductInteraction:output_type -> hipstershop.Empty
+	26,  // 178: hipstershop.ProductCatalogService.ImageSearchProducts:output_type -> hipstershop.SearchProductsResponse
+	19,  // 179: hipstershop.ProductCatalogService.ListCategories:output_type -> hipstershop.ListCategoriesResponse
+	17,  // 180: hipstershop.ProductCatalogAdminService.CreateProduct:output_type -> hipstershop.Product
+	17,  // 181: hipstershop.ProductCatalogAdminService.UpdateProduct:output_type -> hipstershop.Product
+	14,  // 182: hipstershop.ProductCatalogAdminService.DeleteProduct:output_type -> hipstershop.Empty
+	42,  // 183: hipstershop.ProductCatalogAdminService.ReloadCatalog:output_type -> hipstershop.ReloadCatalogResponse
+	44,  // 184: hipstershop.ProductCatalogAdminService.ImportProducts:output_type -> hipstershop.ImportProductsResponse
+	46,  // 185: hipstershop.ProductCatalogAdminService.ExportProducts:output_type -> hipstershop.ExportProductsResponse
+	47,  // 186: hipstershop.ProductCatalogAdminService.CreateMerchandisingRule:output_type -> hipstershop.MerchandisingRule
+	48,  // 187: hipstershop.ProductCatalogAdminService.ListMerchandisingRules:output_type -> hipstershop.ListMerchandisingRulesResponse
+	14,  // 188: hipstershop.ProductCatalogAdminService.DeleteMerchandisingRule:output_type -> hipstershop.Empty
+	50,  // 189: hipstershop.ProductCatalogAdminService.CreateCampaign:output_type -> hipstershop.Campaign
+	51,  // 190: hipstershop.ProductCatalogAdminService.ListCampaigns:output_type -> hipstershop.ListCampaignsResponse
+	50,  // 191: hipstershop.ProductCatalogAdminService.ExpireCampaign:output_type -> hipstershop.Campaign
+	18,  // 192: hipstershop.ProductCatalogAdminService.CreateCategory:output_type -> hipstershop.Category
+	14,  // 193: hipstershop.ProductCatalogAdminService.DeleteCategory:output_type -> hipstershop.Empty
+	57,  // 194: hipstershop.ProductCatalogAdminService.UpdateStock:output_type -> hipstershop.UpdateStockResponse
+	60,  // 195: hipstershop.ShippingService.GetQuote:output_type -> hipstershop.GetQuoteResponse
+	62,  // 196: hipstershop.ShippingService.ShipOrder:output_type -> hipstershop.ShipOrderResponse
+	65,  // 197: hipstershop.CurrencyService.GetSupportedCurrencies:output_type -> hipstershop.GetSupportedCurrenciesResponse
+	64,  // 198: hipstershop.CurrencyService.Convert:output_type -> hipstershop.Money
+	71,  // 199: hipstershop.PaymentService.Charge:output_type -> hipstershop.ChargeResponse
+	71,  // 200: hipstershop.PaymentService.Capture:output_type -> hipstershop.ChargeResponse
+	71,  // 201: hipstershop.PaymentService.Void:output_type -> hipstershop.ChargeResponse
+	14,  // 202: hipstershop.EmailService.SendOrderConfirmation:output_type -> hipstershop.Empty
+	77,  // 203: hipstershop.CheckoutService.PlaceOrder:output_type -> hipstershop.PlaceOrderResponse
+	80,  // 204: hipstershop.CheckoutService.GetOrderHistory:output_type -> hipstershop.GetOrderHistoryResponse
+	78,  // 205: hipstershop.CheckoutService.GetOrder:output_type -> hipstershop.Order
+	78,  // 206: hipstershop.CheckoutService.GetOrderByTrackingID:output_type -> hipstershop.Order
+	84,  // 207: hipstershop.CheckoutService.GetUserOrderStats:output_type -> hipstershop.UserOrderStats
+	78,  // 208: hipstershop.CheckoutService.UpdateOrderStatus:output_type -> hipstershop.Order
+	78,  // 209: hipstershop.CheckoutService.CancelOrder:output_type -> hipstershop.Order
+	113, // 210: hipstershop.CheckoutService.RequestReturn:output_type -> hipstershop.OrderReturn
+	113, // 211: hipstershop.CheckoutService.ApproveReturn:output_type -> hipstershop.OrderReturn
+	87,  // 212: hipstershop.CheckoutService.Reorder:output_type -> hipstershop.ReorderResponse
+	90,  // 213: hipstershop.CheckoutService.ExportUserData:output_type -> hipstershop.ExportUserDataResponse
+	92,  // 214: hipstershop.CheckoutService.DeleteUserData:output_type -> hipstershop.DeleteUserDataResponse
+	93,  // 215: hipstershop.CheckoutService.AddAddress:output_type -> hipstershop.SavedAddress
+	96,  // 216: hipstershop.CheckoutService.ListAddresses:output_type -> hipstershop.ListAddressesResponse
+	14,  // 217: hipstershop.CheckoutService.DeleteAddress:output_type -> hipstershop.Empty
+	93,  // 218: hipstershop.CheckoutService.SetDefaultAddress:output_type -> hipstershop.SavedAddress
+	100, // 219: hipstershop.CheckoutService.CreateShipment:output_type -> hipstershop.Shipment
+	100, // 220: hipstershop.CheckoutService.UpdateShipmentStatus:output_type -> hipstershop.Shipment
+	105, // 221: hipstershop.CheckoutService.ListShipments:output_type -> hipstershop.ListShipmentsResponse
+	107, // 222: hipstershop.CheckoutService.ClaimOrders:output_type -> hipstershop.ClaimOrdersResponse
+	109, // 223: hipstershop.CheckoutService.SearchOrders:output_type -> hipstershop.SearchOrdersResponse
+	118, // 224: hipstershop.AdService.GetAds:output_type -> hipstershop.AdResponse
+	166, // [166:225] is the sub-list for method output_type
+	107, // [107:166] is the sub-list for method input_type
+	107, // [107:107] is the sub-list for extension type_name
+	107, // [107:107] is the sub-list for extension extendee
+	0,   // [0:107] is the sub-list for field type_name
 }
 
 func init() { file_demo_proto_init() }
@@ -2047,18 +8790,34 @@ func file_demo_proto_init() {
 	if File_demo_proto != nil {
 		return
 	}
+	file_demo_proto_msgTypes[8].OneofWrappers = []any{}
+	file_demo_proto_msgTypes[22].OneofWrappers = []any{}
+	file_demo_proto_msgTypes[23].OneofWrappers = []any{
+		(*ImageSearchRequest_ImageData)(nil),
+		(*ImageSearchRequest_ImageUrl)(nil),
+	}
+	file_demo_proto_msgTypes[38].OneofWrappers = []any{
+		(*MerchandisingRule_ProductId)(nil),
+		(*MerchandisingRule_Category)(nil),
+	}
+	file_demo_proto_msgTypes[46].OneofWrappers = []any{
+		(*StockLevel_ProductId)(nil),
+		(*StockLevel_Sku)(nil),
+	}
+	file_demo_proto_msgTypes[111].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_demo_proto_rawDesc), len(file_demo_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   33,
+			NumEnums:      9,
+			NumMessages:   112,
 			NumExtensions: 0,
-			NumServices:   9,
+			NumServices:   10,
 		},
 		GoTypes:           file_demo_proto_goTypes,
 		DependencyIndexes: file_demo_proto_depIdxs,
+		EnumInfos:         file_demo_proto_enumTypes,
 		MessageInfos:      file_demo_proto_msgTypes,
 	}.Build()
 	File_demo_proto = out.File
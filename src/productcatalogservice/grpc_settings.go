@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// grpcSettings holds keepalive, connection lifetime and message size settings for
+// gRPC servers and client connections. Zero durations and sizes leave the gRPC
+// defaults in place.
+type grpcSettings struct {
+	KeepaliveTime         time.Duration // ping interval on idle connections
+	KeepaliveTimeout      time.Duration // how long to wait for a ping ack
+	KeepaliveMinTime      time.Duration // shortest client ping interval the server accepts
+	MaxConnectionIdle     time.Duration
+	MaxConnectionAge      time.Duration
+	MaxConnectionAgeGrace time.Duration
+	MaxRecvMsgSize        int
+	MaxSendMsgSize        int
+}
+
+// grpcSettingsFromEnv builds grpcSettings from the environment:
+//
+//	GRPC_KEEPALIVE_TIME              ping interval on idle connections (default 30s)
+//	GRPC_KEEPALIVE_TIMEOUT           wait for a ping ack before closing the connection (default 10s)
+//	GRPC_KEEPALIVE_MIN_TIME          shortest client ping interval the server allows (default 10s)
+//	GRPC_MAX_CONNECTION_IDLE         close server connections idle for this long
+//	GRPC_MAX_CONNECTION_AGE          close server connections older than this, forcing clients to rebalance
+//	GRPC_MAX_CONNECTION_AGE_GRACE    time allowed for in-flight RPCs after GRPC_MAX_CONNECTION_AGE
+//	GRPC_MAX_RECV_MSG_SIZE           largest message accepted, in bytes
+//	GRPC_MAX_SEND_MSG_SIZE           largest message sent, in bytes
+//
+// The keepalive defaults are shorter than the idle timeouts of common cloud
+// load balancers, so idle connections are not dropped silently.
+func grpcSettingsFromEnv() (grpcSettings, error) {
+	c := grpcSettings{
+		KeepaliveTime:    30 * time.Second,
+		KeepaliveTimeout: 10 * time.Second,
+		KeepaliveMinTime: 10 * time.Second,
+	}
+	durations := []struct {
+		env    string
+		target *time.Duration
+	}{
+		{"GRPC_KEEPALIVE_TIME", &c.KeepaliveTime},
+		{"GRPC_KEEPALIVE_TIMEOUT", &c.KeepaliveTimeout},
+		{"GRPC_KEEPALIVE_MIN_TIME", &c.KeepaliveMinTime},
+		{"GRPC_MAX_CONNECTION_IDLE", &c.MaxConnectionIdle},
+		{"GRPC_MAX_CONNECTION_AGE", &c.MaxConnectionAge},
+		{"GRPC_MAX_CONNECTION_AGE_GRACE", &c.MaxConnectionAgeGrace},
+	}
+	for _, d := range durations {
+		s := os.Getenv(d.env)
+		if s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil || v < 0 {
+			return grpcSettings{}, fmt.Errorf("failed to parse %s (%s) as a non-negative time.Duration", d.env, s)
+		}
+		*d.target = v
+	}
+	sizes := []struct {
+		env    string
+		target *int
+	}{
+		{"GRPC_MAX_RECV_MSG_SIZE", &c.MaxRecvMsgSize},
+		{"GRPC_MAX_SEND_MSG_SIZE", &c.MaxSendMsgSize},
+	}
+	for _, sz := range sizes {
+		s := os.Getenv(sz.env)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return grpcSettings{}, fmt.Errorf("%s must be a non-negative number of bytes, got %q", sz.env, s)
+		}
+		*sz.target = v
+	}
+	return c, nil
+}
+
+// serverOptions returns the grpc.ServerOptions for c.
+func (c grpcSettings) serverOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  c.KeepaliveTime,
+			Timeout:               c.KeepaliveTimeout,
+			MaxConnectionIdle:     c.MaxConnectionIdle,
+			MaxConnectionAge:      c.MaxConnectionAge,
+			MaxConnectionAgeGrace: c.MaxConnectionAgeGrace,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.KeepaliveMinTime,
+			PermitWithoutStream: true,
+		}),
+	}
+	if c.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsgSize))
+	}
+	return opts
+}
+
+// clientKeepaliveTime is the ping interval of client connections. Servers
+// with the gRPC default enforcement policy close connections that ping more
+// often than every 5 minutes, or at all without active streams.
+const clientKeepaliveTime = 5 * time.Minute
+
+// dialOptions returns the grpc.DialOptions for long-lived client connections.
+func (c grpcSettings) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                clientKeepaliveTime,
+			Timeout:             c.KeepaliveTimeout,
+			PermitWithoutStream: false,
+		}),
+	}
+	var callOpts []grpc.CallOption
+	if c.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(c.MaxSendMsgSize))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	return opts
+}
+
+// String summarizes the configuration for logging.
+func (c grpcSettings) String() string {
+	return fmt.Sprintf("keepalive: %v/%v (min %v), max connection idle: %v, age: %v (grace %v), max message size: recv %d send %d",
+		c.KeepaliveTime, c.KeepaliveTimeout, c.KeepaliveMinTime,
+		c.MaxConnectionIdle, c.MaxConnectionAge, c.MaxConnectionAgeGrace,
+		c.MaxRecvMsgSize, c.MaxSendMsgSize)
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCSettingsFromEnv(t *testing.T) {
+	cfg, err := grpcSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.KeepaliveTime != 30*time.Second || cfg.KeepaliveTimeout != 10*time.Second {
+		t.Errorf("default keepalive: got %v/%v, want 30s/10s", cfg.KeepaliveTime, cfg.KeepaliveTimeout)
+	}
+	if got := len(cfg.serverOptions()); got != 2 {
+		t.Errorf("default server options: got %d, want 2", got)
+	}
+
+	t.Setenv("GRPC_KEEPALIVE_TIME", "1m")
+	t.Setenv("GRPC_MAX_CONNECTION_AGE", "30m")
+	t.Setenv("GRPC_MAX_RECV_MSG_SIZE", "8388608")
+	cfg, err = grpcSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.KeepaliveTime != time.Minute {
+		t.Errorf("KeepaliveTime: got %v, want 1m", cfg.KeepaliveTime)
+	}
+	if cfg.MaxConnectionAge != 30*time.Minute {
+		t.Errorf("MaxConnectionAge: got %v, want 30m", cfg.MaxConnectionAge)
+	}
+	if cfg.MaxRecvMsgSize != 8<<20 {
+		t.Errorf("MaxRecvMsgSize: got %d, want %d", cfg.MaxRecvMsgSize, 8<<20)
+	}
+	if got := len(cfg.serverOptions()); got != 3 {
+		t.Errorf("server options: got %d, want 3", got)
+	}
+	if got := len(cfg.dialOptions()); got != 2 {
+		t.Errorf("dial options: got %d, want 2", got)
+	}
+
+	for env, value := range map[string]string{
+		"GRPC_KEEPALIVE_TIMEOUT":   "soon",
+		"GRPC_MAX_CONNECTION_IDLE": "-1s",
+		"GRPC_MAX_SEND_MSG_SIZE":   "-1",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := grpcSettingsFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+// TestDialOptions calls a server that keeps the gRPC default keepalive
+// enforcement policy through a connection made with dialOptions.
+func TestDialOptions(t *testing.T) {
+	cfg, err := grpcSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn", append(cfg.dialOptions(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/pgvector/pgvector-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultImageEmbeddingModel = "multimodalembedding@001"
+
+	// imageEmbeddingDimensions matches the vector(512) image_embedding
+	// column of the products table.
+	imageEmbeddingDimensions = 512
+
+	// maxImageBytes bounds images sent in requests or downloaded.
+	maxImageBytes = 8 << 20
+
+	// defaultImageSearchResults is how many products ImageSearchProducts
+	// returns when the request has no limit.
+	defaultImageSearchResults = 10
+)
+
+// ImageEmbeddingProvider turns images into the vectors image search compares.
+type ImageEmbeddingProvider interface {
+	// EmbedImage returns the embedding of an encoded image.
+	EmbedImage(ctx context.Context, image []byte) ([]float32, error)
+}
+
+// imageEmbeddingProvider returns the provider for EMBEDDING_MODE. The
+// embedding service only embeds text, so outside stub mode images are
+// embedded with Vertex AI directly.
+func imageEmbeddingProvider() (ImageEmbeddingProvider, error) {
+	switch embeddingMode() {
+	case embeddingModeStub:
+		return stubImageEmbeddingProvider{seed: stubEmbeddingSeed()}, nil
+	default:
+		return sharedVertexEmbeddingProvider()
+	}
+}
+
+// checkImageEmbeddingDimensions returns errEmbeddingDimensions unless
+// embedding has imageEmbeddingDimensions values, which the vector(512)
+// image_embedding column takes.
+func checkImageEmbeddingDimensions(embedding []float32) error {
+	if len(embedding) != imageEmbeddingDimensions {
+		return fmt.Errorf("%w: image embedding has %d, want %d", errEmbeddingDimensions, len(embedding), imageEmbeddingDimensions)
+	}
+	return nil
+}
+
+// embedImage embeds image with provider. Embeddings of the wrong size are
+// logged and returned as errors.
+func embedImage(ctx context.Context, provider ImageEmbeddingProvider, image []byte) ([]float32, error) {
+	embedding, err := provider.EmbedImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkImageEmbeddingDimensions(embedding); err != nil {
+		log.Errorf("EMBEDDING_MODE=%s returned an unusable image embedding, check that IMAGE_EMBEDDING_MODEL produces %d dimensions: %v",
+			embeddingMode(), imageEmbeddingDimensions, err)
+		return nil, err
+	}
+	return embedding, nil
+}
+
+// stubImageEmbeddingProvider maps every distinct image to a deterministic
+// pseudo-random unit vector, so only identical images match closely.
+type stubImageEmbeddingProvider struct {
+	seed int64
+}
+
+// EmbedImage implements ImageEmbeddingProvider.
+func (s stubImageEmbeddingProvider) EmbedImage(_ context.Context, image []byte) ([]float32, error) {
+	h := fnv.New64a()
+	h.Write(image)
+	rnd := rand.New(rand.NewSource(s.seed ^ int64(h.Sum64())))
+	values := make([]float64, imageEmbeddingDimensions)
+	var norm float64
+	for i := range values {
+		values[i] = rnd.NormFloat64()
+		norm += values[i] * values[i]
+	}
+	norm = math.Sqrt(norm)
+	embedding := make([]float32, imageEmbeddingDimensions)
+	for i, v := range values {
+		embedding[i] = float32(v / norm)
+	}
+	return embedding, nil
+}
+
+// maxImageRedirects bounds the redirects followed while downloading an image.
+const maxImageRedirects = 3
+
+// nonPublicPrefixes are special-purpose ranges that net/netip doesn't
+// classify as private but that must not be reached from image_url either.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddr reports whether addr is a public unicast address, rather than
+// loopback, link-local (such as the metadata server), private or otherwise
+// special.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// imageAddrAllowed reports whether images may be downloaded from addr. Tests
+// replace it to reach local servers.
+var imageAddrAllowed = publicAddr
+
+// imageDialer only connects to addresses imageAddrAllowed accepts. The check
+// runs on the address being dialed, after DNS resolution, so a name that
+// resolves to an internal address, or a redirect to one, is refused too.
+var imageDialer = &net.Dialer{
+	Timeout: 5 * time.Second,
+	Control: func(_, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !imageAddrAllowed(addrPort.Addr()) {
+			return fmt.Errorf("%s is not a public address", addrPort.Addr())
+		}
+		return nil
+	},
+}
+
+// imageHTTPClient downloads images by URL. It ignores proxy settings, which
+// would dial the proxy rather than the image's host.
+var imageHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:            imageDialer.DialContext,
+		TLSHandshakeTimeout:    5 * time.Second,
+		MaxResponseHeaderBytes: 64 << 10,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxImageRedirects {
+			return fmt.Errorf("more than %d redirects", maxImageRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to %q is not an http(s) URL", req.URL)
+		}
+		return nil
+	},
+}
+
+// pictureHTTPClient downloads product pictures from PRODUCT_IMAGE_BASE_URL,
+// which the operator configures and is usually internal, such as the
+// frontend's service address.
+var pictureHTTPClient = &http.Client{
+	Timeout:       10 * time.Second,
+	CheckRedirect: imageHTTPClient.CheckRedirect,
+}
+
+// fetchImage downloads the image at rawURL, which must be http or https, on
+// a public address, and at most maxImageBytes long.
+func fetchImage(ctx context.Context, rawURL string) ([]byte, error) {
+	return downloadImage(ctx, imageHTTPClient, rawURL)
+}
+
+// downloadImage downloads the image at rawURL, which must be http or https
+// and at most maxImageBytes long, with client.
+func downloadImage(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%q is not an http(s) URL", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned status %d", u, resp.StatusCode)
+	}
+	if resp.ContentLength > maxImageBytes {
+		return nil, fmt.Errorf("image at %s is larger than %d bytes", u, maxImageBytes)
+	}
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(image) > maxImageBytes {
+		return nil, fmt.Errorf("image at %s is larger than %d bytes", u, maxImageBytes)
+	}
+	return image, nil
+}
+
+// imageSearchQuery ranks products by the distance of their image embedding
+// to $1.
+func imageSearchQuery() string {
+	return `
+	SELECT p.id, p.name, p.description, p.picture, p.price_usd_currency_code,
+		   p.price_usd_units, p.price_usd_nanos, p.categories, p.target_tags, p.use_context
+	FROM ` + productsTable + ` p
+	WHERE p.image_embedding IS NOT NULL` + activeProductSQL + `
+	ORDER BY p.image_embedding <=> $1
+	LIMIT $2`
+}
+
+// ImageSearchProducts returns the products whose pictures look most like
+// the request's image. It needs the database; there is no keyword fallback.
+func (p *productCatalog) ImageSearchProducts(ctx context.Context, req *pb.ImageSearchRequest) (*pb.SearchProductsResponse, error) {
+	image, imageURL := req.GetImageData(), req.GetImageUrl()
+	switch {
+	case len(image) == 0 && imageURL == "":
+		return nil, status.Error(codes.InvalidArgument, "image_data or image_url is required")
+	case len(image) > maxImageBytes:
+		return nil, status.Errorf(codes.InvalidArgument, "image_data is larger than %d bytes", maxImageBytes)
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultImageSearchResults
+	}
+	limit = min(limit, maxSemanticSearchResults)
+	// Image searches embed and query like semantic searches, and share
+	// their limits.
+	release, err := searchLimit.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !dbReady.Load() {
+		return nil, status.Error(codes.Unavailable, "image search database is not available")
+	}
+
+	if imageURL != "" {
+		if image, err = fetchImage(ctx, imageURL); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to fetch image_url: %v", err)
+		}
+	}
+	provider, err := imageEmbeddingProvider()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	embedCtx, cancelEmbed := withStepTimeout(ctx, searchTimeout.embed)
+	var embedding []float32
+	err = embeddingFailure.run(embedCtx, func(ctx context.Context) (err error) {
+		embedding, err = embedImage(ctx, provider, image)
+		return err
+	})
+	cancelEmbed()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		if errors.Is(err, errEmbeddingDimensions) {
+			return nil, status.Errorf(codes.Internal, "failed to embed image: %v", err)
+		}
+		return nil, status.Errorf(codes.Unavailable, "failed to embed image: %v", err)
+	}
+
+	queryCtx, cancelQuery := withStepTimeout(ctx, searchTimeout.query)
+	defer cancelQuery()
+	rows, err := readDB().QueryContext(queryCtx, imageSearchQuery(), pgvector.NewVector(embedding), limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "database error: %v", err)
+	}
+	defer rows.Close()
+
+	products := make([]*pb.Product, 0, limit)
+	budget := responseBudget{remaining: maxSearchResponseBytes}
+	truncated := false
+	for rows.Next() {
+		product := &pb.Product{PriceUsd: &pb.Money{}}
+		var categories, targetTags, useContext string
+		if err := rows.Scan(&product.Id, &product.Name, &product.Description, &product.Picture,
+			&product.PriceUsd.CurrencyCode, &product.PriceUsd.Units, &product.PriceUsd.Nanos,
+			&categories, &targetTags, &useContext); err != nil {
+			return nil, status.Errorf(codes.Internal, "database error: %v", err)
+		}
+		product.Categories = splitCategories(categories)
+		product.TargetTags = splitPostgresList(targetTags)
+		product.UseContext = splitPostgresList(useContext)
+
+		if !budget.take(product) {
+			truncated = true
+			break
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "database error: %v", err)
+	}
+	return &pb.SearchProductsResponse{Results: products, Truncated: truncated}, nil
+}
+
+// productImageBaseURL returns PRODUCT_IMAGE_BASE_URL, the address relative
+// product pictures are downloaded from, such as http://frontend:80. Product
+// pictures are only embedded when it is set.
+func productImageBaseURL() string {
+	return strings.TrimSuffix(os.Getenv("PRODUCT_IMAGE_BASE_URL"), "/")
+}
+
+// backfillImageEmbeddings embeds the pictures of products that have no image
+// embedding, or whose picture changed since it was embedded. A picture that
+// cannot be downloaded or embedded is logged and retried on the next run. It
+// returns the number of products embedded.
+func backfillImageEmbeddings(ctx context.Context) (int, error) {
+	base := productImageBaseURL()
+	if base == "" {
+		return 0, nil
+	}
+	provider, err := imageEmbeddingProvider()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, picture FROM `+productsTable+`
+		WHERE picture <> ''
+		  AND (image_embedding IS NULL OR image_embedded_picture IS DISTINCT FROM picture)
+		ORDER BY id`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find products to embed pictures of: %v", err)
+	}
+	type pending struct{ id, picture string }
+	var products []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.picture); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan product: %v", err)
+		}
+		products = append(products, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read products: %v", err)
+	}
+
+	count := 0
+	for _, p := range products {
+		// Relative pictures come from the configured base; absolute ones
+		// are fetched like image_url.
+		pictureURL, client := p.picture, imageHTTPClient
+		if !strings.Contains(pictureURL, "://") {
+			pictureURL, client = base+"/"+strings.TrimPrefix(pictureURL, "/"), pictureHTTPClient
+		}
+		image, err := downloadImage(ctx, client, pictureURL)
+		if err != nil {
+			log.Warnf("Failed to download the picture of product %s: %v", p.id, err)
+			continue
+		}
+		embedding, err := embedImage(ctx, provider, image)
+		if err != nil {
+			log.Warnf("Failed to embed the picture of product %s: %v", p.id, err)
+			continue
+		}
+		// The picture condition skips products whose picture changed
+		// meanwhile; the next run embeds the new one.
+		_, err = db.ExecContext(ctx, `
+			UPDATE `+productsTable+` SET image_embedding = $1, image_embedded_picture = $2
+			WHERE id = $3 AND picture = $2`,
+			pgvector.NewVector(embedding), p.picture, p.id)
+		if err != nil {
+			return count, fmt.Errorf("failed to store the image embedding of product %s: %v", p.id, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// embedProductPictures runs backfillImageEmbeddings and logs the outcome.
+func embedProductPictures(ctx context.Context) {
+	n, err := backfillImageEmbeddings(ctx)
+	if err != nil {
+		log.Warnf("Image embedding backfill failed: %v", err)
+	}
+	if n > 0 {
+		log.Infof("Embedded the pictures of %d products", n)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestImageSearchProductsValidation(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		req  *pb.ImageSearchRequest
+		want codes.Code
+	}{
+		{&pb.ImageSearchRequest{}, codes.InvalidArgument},
+		{&pb.ImageSearchRequest{Image: &pb.ImageSearchRequest_ImageData{ImageData: make([]byte, maxImageBytes+1)}}, codes.InvalidArgument},
+		{&pb.ImageSearchRequest{Image: &pb.ImageSearchRequest_ImageData{ImageData: []byte("png")}}, codes.Unavailable},
+	} {
+		_, err := mockProductCatalog.ImageSearchProducts(ctx, tc.req)
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("got %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestFetchImage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mug.jpg":
+			w.Write([]byte("mug"))
+		case "/huge.jpg":
+			w.Write(bytes.Repeat([]byte("x"), maxImageBytes+1))
+		case "/redirect.jpg":
+			http.Redirect(w, r, "/mug.jpg", http.StatusFound)
+		case "/loop.jpg":
+			http.Redirect(w, r, "/loop.jpg", http.StatusFound)
+		case "/file.jpg":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// The test server listens on loopback, which is refused by default.
+	if _, err := fetchImage(ctx, srv.URL+"/mug.jpg"); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("expected loopback to be refused, got %v", err)
+	}
+	imageAddrAllowed = func(netip.Addr) bool { return true }
+	defer func() { imageAddrAllowed = publicAddr }()
+
+	for _, u := range []string{srv.URL + "/mug.jpg", srv.URL + "/redirect.jpg"} {
+		image, err := fetchImage(ctx, u)
+		if err != nil || string(image) != "mug" {
+			t.Errorf("%s: got %q, %v; want mug", u, image, err)
+		}
+	}
+	for _, u := range []string{srv.URL + "/missing.jpg", srv.URL + "/huge.jpg", srv.URL + "/loop.jpg", srv.URL + "/file.jpg",
+		"file:///etc/passwd", "ftp://example.com/a.jpg"} {
+		if _, err := fetchImage(ctx, u); err == nil {
+			t.Errorf("%s: expected an error", u)
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"8.8.8.8":              true,
+		"2001:4860:4860::8888": true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"169.254.169.254":      false,
+		"10.0.0.1":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"100.64.0.1":           false,
+		"0.0.0.1":              false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:10.0.0.1":      false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"224.0.0.1":            false,
+		"0.0.0.0":              false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestStubImageEmbedding(t *testing.T) {
+	s := stubImageEmbeddingProvider{}
+	a, _ := s.EmbedImage(context.Background(), []byte("sunglasses"))
+	b, _ := s.EmbedImage(context.Background(), []byte("sunglasses"))
+	c, _ := s.EmbedImage(context.Background(), []byte("watch"))
+	if len(a) != imageEmbeddingDimensions {
+		t.Fatalf("got %d dimensions, want %d", len(a), imageEmbeddingDimensions)
+	}
+	var norm, dot float64
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("the same image embedded differently")
+		}
+		norm += float64(a[i]) * float64(a[i])
+		dot += float64(a[i]) * float64(c[i])
+	}
+	if math.Abs(norm-1) > 1e-4 {
+		t.Errorf("embedding has squared length %v, want 1", norm)
+	}
+	if dot > 0.5 {
+		t.Errorf("different images have similarity %v", dot)
+	}
+}
+
+func TestVertexImageEmbedding(t *testing.T) {
+	values := make([]interface{}, imageEmbeddingDimensions)
+	for i := range values {
+		values[i] = 0.5
+	}
+	prediction, err := structpb.NewValue(map[string]interface{}{"imageEmbedding": values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedding, err := vertexImageEmbedding([]*structpb.Value{prediction})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embedding) != imageEmbeddingDimensions || embedding[0] != 0.5 {
+		t.Errorf("got %d values starting with %v", len(embedding), embedding[0])
+	}
+
+	short, _ := structpb.NewValue(map[string]interface{}{"imageEmbedding": []interface{}{1.0}})
+	if _, err := vertexImageEmbedding([]*structpb.Value{short}); !errors.Is(err, errEmbeddingDimensions) {
+		t.Errorf("got %v for an embedding of the wrong size, want errEmbeddingDimensions", err)
+	}
+}
+
+// fixedImageEmbeddingProvider embeds every image as its embedding.
+type fixedImageEmbeddingProvider struct {
+	embedding []float32
+}
+
+func (f fixedImageEmbeddingProvider) EmbedImage(context.Context, []byte) ([]float32, error) {
+	return f.embedding, nil
+}
+
+func TestEmbedImageChecksDimensions(t *testing.T) {
+	for _, n := range []int{0, embeddingDimensions, imageEmbeddingDimensions + 1} {
+		provider := fixedImageEmbeddingProvider{embedding: make([]float32, n)}
+		if _, err := embedImage(context.Background(), provider, []byte("watch")); !errors.Is(err, errEmbeddingDimensions) {
+			t.Errorf("embedImage with %d dimensions: got %v, want errEmbeddingDimensions", n, err)
+		}
+	}
+	provider := fixedImageEmbeddingProvider{embedding: make([]float32, imageEmbeddingDimensions)}
+	if embedding, err := embedImage(context.Background(), provider, []byte("watch")); err != nil || len(embedding) != imageEmbeddingDimensions {
+		t.Errorf("embedImage: got %d dimensions, %v", len(embedding), err)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// inStockSQL reports whether product p can be bought: any of its variants
+// has stock, or, for products without variants, its stock is untracked
+// (NULL) or positive.
+const inStockSQL = `(CASE WHEN EXISTS (SELECT 1 FROM product_variants sv WHERE sv.product_id = p.id)
+	THEN EXISTS (SELECT 1 FROM product_variants sv WHERE sv.product_id = p.id AND sv.stock > 0)
+	ELSE p.stock IS NULL OR p.stock > 0 END)`
+
+// variantStockJoinSQL joins whether any variant of product p has stock, as
+// vs.in_stock, once per query rather than once per row. vs.in_stock is NULL
+// for products without variants.
+const variantStockJoinSQL = `
+			LEFT JOIN (SELECT product_id, bool_or(stock > 0) AS in_stock
+				FROM product_variants GROUP BY product_id) vs ON vs.product_id = p.id`
+
+// joinedInStockSQL is inStockSQL over variantStockJoinSQL.
+const joinedInStockSQL = `COALESCE(vs.in_stock, p.stock IS NULL OR p.stock > 0)`
+
+// inStock is the in-memory equivalent of inStockSQL. Search results carry a
+// variant summary instead of their variants.
+func inStock(p *pb.Product) bool {
+	if s := p.GetVariantSummary(); s != nil {
+		return s.InStock > 0
+	}
+	if len(p.Variants) > 0 {
+		for _, v := range p.Variants {
+			if v.Stock > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return p.Stock == nil || *p.Stock > 0
+}
+
+// inventorySettings control how stock affects search rankings.
+type inventorySettings struct {
+	// outOfStockPenalty is added to the ranking score of products out of
+	// stock, so they rank below in-stock products at a similar distance; 0
+	// ranks them like any other.
+	outOfStockPenalty float64
+}
+
+func (s inventorySettings) String() string {
+	if s.outOfStockPenalty == 0 {
+		return "out-of-stock demotion disabled"
+	}
+	return fmt.Sprintf("out-of-stock penalty=%g", s.outOfStockPenalty)
+}
+
+// inventory holds the settings in effect, set from the environment at
+// startup.
+var inventory = inventorySettings{outOfStockPenalty: 0.1}
+
+// inventoryFromEnv builds inventorySettings from the environment:
+//
+//	SEARCH_OUT_OF_STOCK_PENALTY  added to the ranking score of products out of stock, in [0, 2] (default 0.1)
+func inventoryFromEnv() (inventorySettings, error) {
+	s := inventory
+	if v := os.Getenv("SEARCH_OUT_OF_STOCK_PENALTY"); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p < 0 || p > 2 {
+			return inventorySettings{}, fmt.Errorf("failed to parse SEARCH_OUT_OF_STOCK_PENALTY (%s) as a number in [0, 2]", v)
+		}
+		s.outOfStockPenalty = p
+	}
+	return s, nil
+}
+
+// demote adds the out-of-stock penalty to ranking r, appending it to args,
+// and joins the stock of the variants it needs.
+// Until productsSchemaSQL has added the stock column, or with a zero
+// penalty, r is returned as it is.
+func (s inventorySettings) demote(r productRanking, args []interface{}) (productRanking, []interface{}) {
+	if s.outOfStockPenalty == 0 || !productsSchemaReady.Load() {
+		return r, args
+	}
+	args = append(args, s.outOfStockPenalty)
+	r.join += variantStockJoinSQL
+	r.penalty = fmt.Sprintf(`(CASE WHEN %s THEN 0 ELSE $%d::float8 END)`, joinedInStockSQL, len(args))
+	r.score = fmt.Sprintf(`(%s + %s)`, r.score, r.penalty)
+	return r, args
+}
+
+// demoteOutOfStock moves the products out of stock after the others,
+// keeping the order within each group. It is the keyword fallback's
+// counterpart of demote, for results in relevance order.
+func (s inventorySettings) demoteOutOfStock(products []*pb.Product) []*pb.Product {
+	if s.outOfStockPenalty == 0 {
+		return products
+	}
+	sorted := make([]*pb.Product, 0, len(products))
+	var out []*pb.Product
+	for _, p := range products {
+		if inStock(p) {
+			sorted = append(sorted, p)
+		} else {
+			out = append(out, p)
+		}
+	}
+	return append(sorted, out...)
+}
+
+// validateStock checks that a stock level, if tracked, is not negative.
+func validateStock(field string, stock *int32) error {
+	if stock != nil && *stock < 0 {
+		return fmt.Errorf("%s must not be negative", field)
+	}
+	return nil
+}
+
+func (a *catalogAdmin) UpdateStock(ctx context.Context, req *pb.UpdateStockRequest) (*pb.UpdateStockResponse, error) {
+	if len(req.GetLevels()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "levels are required")
+	}
+	for i, l := range req.Levels {
+		if l.GetProductId() == "" && l.GetSku() == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "levels[%d]: product_id or sku is required", i)
+		}
+		if l.Stock < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "levels[%d]: stock must not be negative", i)
+		}
+	}
+	if !dbReady.Load() {
+		return nil, status.Error(codes.Unavailable, "catalog database is not available")
+	}
+	if err := ensureProductsSchema(ctx); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Stock is not embedded, so unlike the other writes these leave the
+	// embeddings alone.
+	resp := &pb.UpdateStockResponse{}
+	var changed []string
+	for _, l := range req.Levels {
+		query, key := `UPDATE `+productsTable+` SET stock = $2 WHERE id = $1 RETURNING id`, l.GetProductId()
+		if l.GetSku() != "" {
+			query, key = `UPDATE product_variants SET stock = $2 WHERE sku = $1 RETURNING product_id`, l.GetSku()
+		}
+		var id string
+		err := tx.QueryRowContext(ctx, query, key, l.Stock).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			resp.NotFound = append(resp.NotFound, key)
+			continue
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to update stock of %s: %v", key, err)
+		}
+		if !slices.Contains(changed, id) {
+			changed = append(changed, id)
+		}
+		resp.Updated++
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to commit stock levels: %v", err)
+	}
+	a.catalog.invalidate()
+	for _, id := range changed {
+		productEvents.emit(id, pb.ProductChanged_STOCK_UPDATED, nil)
+	}
+	log.Infof("Updated stock of %d products and variants", resp.Updated)
+	return resp, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestInStock(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		product *pb.Product
+		want    bool
+	}{
+		{"untracked", &pb.Product{}, true},
+		{"stocked", &pb.Product{Stock: proto.Int32(3)}, true},
+		{"sold out", &pb.Product{Stock: proto.Int32(0)}, false},
+		{"variant in stock", &pb.Product{Stock: proto.Int32(0),
+			Variants: []*pb.ProductVariant{{Sku: "A"}, {Sku: "B", Stock: 1}}}, true},
+		{"variants sold out", &pb.Product{Variants: []*pb.ProductVariant{{Sku: "A"}}}, false},
+		{"summary in stock", &pb.Product{VariantSummary: &pb.ProductVariantSummary{Count: 2, InStock: 1}}, true},
+		{"summary sold out", &pb.Product{VariantSummary: &pb.ProductVariantSummary{Count: 2}}, false},
+	} {
+		if got := inStock(tc.product); got != tc.want {
+			t.Errorf("%s: inStock = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestInventoryFromEnv(t *testing.T) {
+	got, err := inventoryFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.outOfStockPenalty != 0.1 {
+		t.Errorf("default penalty = %g, want 0.1", got.outOfStockPenalty)
+	}
+
+	t.Setenv("SEARCH_OUT_OF_STOCK_PENALTY", "0")
+	if got, err = inventoryFromEnv(); err != nil || got.outOfStockPenalty != 0 || got.String() != "out-of-stock demotion disabled" {
+		t.Errorf("got %+v (%s), %v; want demotion disabled", got, got, err)
+	}
+	for _, v := range []string{"-0.1", "3", "lots"} {
+		t.Setenv("SEARCH_OUT_OF_STOCK_PENALTY", v)
+		if _, err := inventoryFromEnv(); err == nil {
+			t.Errorf("expected error for SEARCH_OUT_OF_STOCK_PENALTY=%s", v)
+		}
+	}
+}
+
+func TestOutOfStockDemotion(t *testing.T) {
+	defer productsSchemaReady.Store(productsSchemaReady.Load())
+	base := make([]interface{}, 7)
+
+	productsSchemaReady.Store(true)
+	if r, args := (inventorySettings{}).demote(distanceRanking, base); r != distanceRanking || len(args) != 7 {
+		t.Errorf("zero penalty: got %+v and %d args, want distanceRanking", r, len(args))
+	}
+	productsSchemaReady.Store(false)
+	if r, _ := (inventorySettings{outOfStockPenalty: 0.1}).demote(distanceRanking, base); r != distanceRanking {
+		t.Errorf("without the stock column: got %+v, want distanceRanking", r)
+	}
+
+	productsSchemaReady.Store(true)
+	r, args := inventorySettings{outOfStockPenalty: 0.1}.demote(distanceRanking, base)
+	if len(args) != 8 || args[7] != 0.1 {
+		t.Fatalf("got args %v, want the penalty appended", args)
+	}
+	if !strings.Contains(r.penalty, "ELSE $8::float8") || r.score != "("+weightedDistanceSQL+" + "+r.penalty+")" {
+		t.Errorf("got ranking %+v", r)
+	}
+	// Variant stock is joined rather than looked up per row.
+	if r.join != variantStockJoinSQL || strings.Contains(r.penalty, "EXISTS") {
+		t.Errorf("got ranking %+v, want the variant stock joined", r)
+	}
+
+	// Keyword fusion demotes keyword matches as well as vector candidates,
+	// with the penalty scaled to the fused score: 1 / (k + 1) under RRF.
+	query, _ := keywordFusion{mode: fusionRRF, rrfK: 60}.query("mug", 10, pb.SemanticSearchRequest_RELEVANCE,
+		r, "products p", "", "", args)
+	for _, w := range []string{
+		"FROM products p" + variantStockJoinSQL,
+		r.score + " AS score",
+		"+ (1.0 / ($11 + 1))::float8 * " + r.penalty + " AS similarity_score",
+		"ON p.id = COALESCE(v.id, k.id)" + variantStockJoinSQL,
+	} {
+		if !strings.Contains(query, w) {
+			t.Errorf("fused query does not contain %q:\n%s", w, query)
+		}
+	}
+}
+
+func TestDemoteOutOfStock(t *testing.T) {
+	products := []*pb.Product{
+		{Id: "A", Stock: proto.Int32(0)},
+		{Id: "B"},
+		{Id: "C", VariantSummary: &pb.ProductVariantSummary{Count: 1}},
+		{Id: "D", Stock: proto.Int32(2)},
+	}
+	var ids []string
+	for _, p := range (inventorySettings{outOfStockPenalty: 0.1}).demoteOutOfStock(products) {
+		ids = append(ids, p.Id)
+	}
+	if got := strings.Join(ids, ","); got != "B,D,A,C" {
+		t.Errorf("demoted order = %s, want B,D,A,C", got)
+	}
+	if got := (inventorySettings{}).demoteOutOfStock(products); got[0].Id != "A" {
+		t.Errorf("without a penalty the order changed: %v", got)
+	}
+}
+
+func TestSearchFiltersInStockOnly(t *testing.T) {
+	f, err := parseSearchFilters(&pb.SemanticSearchRequest{InStockOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql, _ := f.where(nil); !strings.Contains(sql, " AND "+inStockSQL) {
+		t.Errorf("where = %q, want the in-stock condition", sql)
+	}
+	if f.match(&pb.Product{Stock: proto.Int32(0)}) || !f.match(&pb.Product{}) {
+		t.Error("match does not keep only products in stock")
+	}
+	if sql, _ := (&searchFilters{}).where(nil); strings.Contains(sql, inStockSQL) {
+		t.Errorf("where = %q without in_stock_only", sql)
+	}
+}
+
+func TestValidateProductStock(t *testing.T) {
+	p := &pb.Product{Id: "MUG1", Name: "Mug", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 8}, Stock: proto.Int32(-1)}
+	if err := validateProduct(p); err == nil {
+		t.Error("expected an error for negative stock")
+	}
+	p.Stock = proto.Int32(0)
+	if err := validateProduct(p); err != nil {
+		t.Errorf("sold out product: %v", err)
+	}
+}
+
+func TestUpdateStockValidation(t *testing.T) {
+	a := &catalogAdmin{catalog: &productCatalog{}}
+	for name, req := range map[string]*pb.UpdateStockRequest{
+		"no levels": {},
+		"no item":   {Levels: []*pb.StockLevel{{Stock: 1}}},
+		"negative":  {Levels: []*pb.StockLevel{{Item: &pb.StockLevel_Sku{Sku: "A"}, Stock: -1}}},
+	} {
+		if _, err := a.UpdateStock(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: got %v, want InvalidArgument", name, err)
+		}
+	}
+}
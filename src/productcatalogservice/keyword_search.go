@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const (
+	// trigramSearchThreshold is the least word similarity to the query of a
+	// product name or description that matches despite typos.
+	trigramSearchThreshold = 0.5
+	// maxTrigramSearchResults caps the results of a trigram keyword search.
+	maxTrigramSearchResults = 100
+)
+
+// trigramSearchQuery matches products whose name or description contains
+// the lowercased query $1, as the LIKE pattern $2, or a close spelling of
+// it: a word similarity of at least pg_trgm.word_similarity_threshold, which
+// trigramSearch sets to trigramSearchThreshold. Exact matches come first,
+// then the closest spellings. LIKE and <% are the operators the
+// products_name_trgm and products_description_trgm indexes serve. The %s
+// takes activeProductSQL unless inactive products are included.
+func trigramSearchQuery() string {
+	return `
+	SELECT id, name, description, picture, price_usd_currency_code,
+		   price_usd_units, price_usd_nanos, categories, target_tags, use_context,
+		   status, stock
+	FROM ` + productsTable + ` p
+	WHERE (lower(name) LIKE $2 OR lower(description) LIKE $2
+		   OR $1 <% lower(name) OR $1 <% lower(description))%s
+	ORDER BY (lower(name) LIKE $2 OR lower(description) LIKE $2) DESC,
+			 greatest(word_similarity($1, lower(name)), word_similarity($1, lower(description))) DESC, id
+	LIMIT $3`
+}
+
+// trigramSearch runs trigramSearchQuery for query, which is lowercased.
+func trigramSearch(ctx context.Context, query string, includeInactive bool) ([]*pb.Product, error) {
+	var active string
+	if !includeInactive {
+		active = activeProductSQL
+	}
+	// The threshold of <% is a setting, so it is set for this transaction
+	// only.
+	tx, err := readDB().BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`,
+		strconv.FormatFloat(trigramSearchThreshold, 'f', -1, 64)); err != nil {
+		return nil, fmt.Errorf("failed to set the word similarity threshold: %v", err)
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(trigramSearchQuery(), active),
+		query, "%"+escapeLike(query)+"%", maxTrigramSearchResults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %v", err)
+	}
+	defer rows.Close()
+
+	var products []*pb.Product
+	for rows.Next() {
+		product := &pb.Product{PriceUsd: &pb.Money{}}
+		var categories, targetTags, useContext, productStatus string
+		var stock sql.NullInt32
+		if err := rows.Scan(&product.Id, &product.Name, &product.Description, &product.Picture,
+			&product.PriceUsd.CurrencyCode, &product.PriceUsd.Units, &product.PriceUsd.Nanos,
+			&categories, &targetTags, &useContext, &productStatus, &stock); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %v", err)
+		}
+		product.Categories = splitCategories(categories)
+		product.TargetTags = splitPostgresList(targetTags)
+		product.UseContext = splitPostgresList(useContext)
+		product.Status, _ = parseProductStatus(productStatus)
+		if stock.Valid {
+			product.Stock = &stock.Int32
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read products: %v", err)
+	}
+	return products, nil
+}
+
+// substringSearch matches the products of the loaded catalog whose name or
+// description contains query, which is lowercased.
+func (p *productCatalog) substringSearch(query string, includeInactive bool) []*pb.Product {
+	var ps []*pb.Product
+	for _, product := range activeProducts(p.parseCatalog(), includeInactive) {
+		if strings.Contains(strings.ToLower(product.Name), query) ||
+			strings.Contains(strings.ToLower(product.Description), query) {
+			ps = append(ps, product)
+		}
+	}
+	return ps
+}
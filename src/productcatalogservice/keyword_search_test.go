@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestSearchProductsWithoutTrigramsMatchesCatalog(t *testing.T) {
+	defer dbReady.Store(dbReady.Load())
+	defer trigramsReady.Store(trigramsReady.Load())
+	// The database is up but pg_trgm is not installed: the catalog is
+	// searched and the database is never queried.
+	dbReady.Store(true)
+	trigramsReady.Store(false)
+
+	resp, err := mockProductCatalog.SearchProducts(context.Background(), &pb.SearchProductsRequest{Query: "ALPHA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 {
+		t.Errorf("got %d results, want the 2 catalog products matching alpha", len(resp.Results))
+	}
+}
+
+func TestKeywordFallbackIsBounded(t *testing.T) {
+	defer dbReady.Store(dbReady.Load())
+	dbReady.Store(false)
+	var products []*pb.Product
+	for i := 0; i < 30; i++ {
+		products = append(products, &pb.Product{Id: fmt.Sprintf("W%02d", i), Name: "widget",
+			Description: strings.Repeat("x", 100<<10), PriceUsd: &pb.Money{CurrencyCode: "USD"}})
+	}
+	catalog := &productCatalog{catalog: pb.ListProductsResponse{Products: products}}
+
+	resp, err := catalog.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "widget", IncludeFacets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != defaultSemanticSearchResults || resp.Truncated {
+		t.Errorf("got %d results, truncated %v; want the default %d", len(resp.Results), resp.Truncated, defaultSemanticSearchResults)
+	}
+	var counted int32
+	for _, b := range resp.GetFacets().GetPriceBuckets() {
+		counted += b.Count
+	}
+	if counted != 30 {
+		t.Errorf("price buckets count %d products, want all 30 matches", counted)
+	}
+
+	// 30 descriptions of 100 KiB are more than the response may carry.
+	resp, err = catalog.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "widget", Limit: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) >= 30 || !resp.Truncated {
+		t.Errorf("got %d results, truncated %v; want fewer than 30, truncated", len(resp.Results), resp.Truncated)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	translationOff   = "off"
+	translationCloud = "cloud"
+)
+
+// queryTranslator translates search queries into the catalog language.
+type queryTranslator interface {
+	// translate returns text, written in source, in target.
+	translate(ctx context.Context, text, source, target string) (string, error)
+}
+
+// languageSettings control how semantic search serves queries in languages
+// other than the catalog's.
+type languageSettings struct {
+	// catalog is the language product texts, and so their embeddings, are in.
+	catalog string
+	mode    string
+	// timeout bounds the translation call; 0 leaves it to the request
+	// deadline.
+	timeout    time.Duration
+	translator queryTranslator
+}
+
+func (s languageSettings) String() string {
+	if s.translator == nil {
+		return fmt.Sprintf("catalog=%s, translation disabled", s.catalog)
+	}
+	return fmt.Sprintf("catalog=%s, translation=%s, timeout=%s", s.catalog, s.mode, s.timeout)
+}
+
+// languages holds the settings in effect, set from the environment at
+// startup.
+var languages = languageSettings{catalog: "en", mode: translationOff, timeout: time.Second}
+
+// languagesFromEnv builds languageSettings from the environment:
+//
+//	CATALOG_LANGUAGE           language of the product texts (default en)
+//	QUERY_TRANSLATION          off or cloud, the Cloud Translation API (default off)
+//	QUERY_TRANSLATION_TIMEOUT  bound on the translation call, 0 for none (default 1s)
+func languagesFromEnv() (languageSettings, error) {
+	s := languages
+	if v := os.Getenv("CATALOG_LANGUAGE"); v != "" {
+		s.catalog = baseLanguage(v)
+	}
+	if v := os.Getenv("QUERY_TRANSLATION_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return languageSettings{}, fmt.Errorf("failed to parse QUERY_TRANSLATION_TIMEOUT (%s) as a non-negative time.Duration", v)
+		}
+		s.timeout = d
+	}
+	s.mode = envOrDefault("QUERY_TRANSLATION", translationOff)
+	switch s.mode {
+	case translationOff:
+		s.translator = nil
+	case translationCloud:
+		projectID, err := projectIDFor("QUERY_TRANSLATION=cloud")
+		if err != nil {
+			return languageSettings{}, err
+		}
+		s.translator = newCloudTranslator(projectID)
+	default:
+		return languageSettings{}, fmt.Errorf("unknown QUERY_TRANSLATION %q, want off or cloud", s.mode)
+	}
+	return s, nil
+}
+
+// baseLanguage returns the primary subtag of a BCP 47 language code,
+// lowercased, such as "es" for "es-MX".
+func baseLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	return code
+}
+
+// queryLanguage returns the language of the request's query: language_code
+// when set, otherwise the detected one. It is "" for the catalog language
+// and for queries whose language cannot be told, which are searched as they
+// are.
+func (s languageSettings) queryLanguage(req *pb.SemanticSearchRequest) string {
+	lang := baseLanguage(req.GetLanguageCode())
+	if lang == "" {
+		lang = detectLanguage(req.GetQuery())
+	}
+	if lang == s.catalog {
+		return ""
+	}
+	return lang
+}
+
+// translateQuery returns the request's query in the catalog language. The
+// query is returned as it is when it is in no other language, translation is
+// off, or translation fails or times out.
+func (s languageSettings) translateQuery(ctx context.Context, query, lang string, sl *searchLog) string {
+	if lang == "" || s.translator == nil || strings.TrimSpace(query) == "" {
+		return query
+	}
+	start := time.Now()
+	translateCtx, cancel := withStepTimeout(ctx, s.timeout)
+	defer cancel()
+	translated, err := s.translator.translate(translateCtx, query, lang, s.catalog)
+	sl.step("translate", time.Since(start))
+	if err != nil {
+		sl.set("translate_error", err.Error())
+		return query
+	}
+	sl.set("translated_query", translated)
+	return translated
+}
+
+// Words common in queries of each Latin-script language, which short product
+// queries otherwise give little sign of. Words that are also English, such as
+// "die", "do" and "pour", are left out, since they turn up in English queries
+// like "die cast car".
+var languageWords = map[string][]string{
+	"en": {"the", "for", "with", "without", "and", "of", "to", "my", "cheap", "gift"},
+	"es": {"el", "la", "los", "las", "del", "para", "con", "sin", "una", "y", "regalo", "barato", "barata"},
+	"fr": {"le", "la", "les", "des", "du", "avec", "sans", "une", "et", "cadeau", "pas", "cher"},
+	"de": {"der", "und", "für", "mit", "ohne", "ein", "eine", "geschenk", "günstig"},
+	"it": {"il", "lo", "la", "gli", "della", "per", "senza", "regalo", "economico"},
+	"pt": {"os", "da", "dos", "das", "para", "com", "sem", "um", "presente", "barato"},
+}
+
+// minLanguageVotes is how many signs, counting a telltale letter as two,
+// a Latin-script language needs to be detected. One word is too little: "la"
+// or "con" on their own are as likely a brand or an English word.
+const minLanguageVotes = 2
+
+// Letters found in only some Latin-script languages.
+var languageLetters = map[rune]string{
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ç': "fr", 'œ': "fr", 'è': "fr", 'ê': "fr", 'û': "fr",
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'ì': "it", 'ò': "it",
+	'ã': "pt", 'õ': "pt",
+}
+
+// detectLanguage guesses the language of text, without a network call: by
+// script, then for Latin script by telltale letters and common words. It
+// returns "" when there is no clear sign, as with queries like "sunglasses"
+// or "la lakers cap".
+func detectLanguage(text string) string {
+	votes := map[string]int{}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			return "ja"
+		case unicode.Is(unicode.Hangul, r):
+			return "ko"
+		case unicode.Is(unicode.Han, r):
+			votes["zh"] += 100
+		case unicode.Is(unicode.Cyrillic, r):
+			return "ru"
+		case unicode.Is(unicode.Arabic, r):
+			return "ar"
+		case unicode.Is(unicode.Greek, r):
+			return "el"
+		case unicode.Is(unicode.Hebrew, r):
+			return "he"
+		case unicode.Is(unicode.Thai, r):
+			return "th"
+		case unicode.Is(unicode.Devanagari, r):
+			return "hi"
+		}
+		if lang, ok := languageLetters[r]; ok {
+			votes[lang] += 2
+		}
+	}
+	// Han characters without kana are Chinese.
+	if votes["zh"] > 0 {
+		return "zh"
+	}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for lang, words := range languageWords {
+			for _, w := range words {
+				if w == word {
+					votes[lang]++
+				}
+			}
+		}
+	}
+
+	best, tie := "", false
+	for lang, n := range votes {
+		switch {
+		case best == "" || n > votes[best]:
+			best, tie = lang, false
+		case n == votes[best]:
+			tie = true
+		}
+	}
+	if tie || votes[best] < minLanguageVotes {
+		return ""
+	}
+	return best
+}
+
+// cloudTranslator calls the Cloud Translation API.
+type cloudTranslator struct {
+	api *googleAPI
+	url string
+}
+
+func newCloudTranslator(projectID string) *cloudTranslator {
+	return &cloudTranslator{
+		api: &googleAPI{name: "translation"},
+		url: fmt.Sprintf("https://translation.googleapis.com/v3/projects/%s/locations/global:translateText", projectID),
+	}
+}
+
+// translate implements queryTranslator.
+func (c *cloudTranslator) translate(ctx context.Context, text, source, target string) (string, error) {
+	request := map[string]interface{}{
+		"contents":           []string{text},
+		"sourceLanguageCode": source,
+		"targetLanguageCode": target,
+		"mimeType":           "text/plain",
+	}
+	var response struct {
+		Translations []struct {
+			TranslatedText string `json:"translatedText"`
+		} `json:"translations"`
+	}
+	if err := c.api.post(ctx, c.url, request, &response); err != nil {
+		return "", err
+	}
+	if len(response.Translations) != 1 || strings.TrimSpace(response.Translations[0].TranslatedText) == "" {
+		return "", fmt.Errorf("translation response has no translation")
+	}
+	return html.UnescapeString(response.Translations[0].TranslatedText), nil
+}
+
+// localizeQuery selects the translations of the given products into $2 from
+// the name_translations and description_translations columns productsSchemaSQL
+// adds.
+func localizeQuery() string {
+	return `
+	SELECT id, name_translations ->> $2::text, description_translations ->> $2::text
+	FROM ` + productsTable + `
+	WHERE id = ANY($1::text[]) AND (name_translations ? $2::text OR description_translations ? $2::text)`
+}
+
+// localize replaces the names and descriptions of products with their
+// translations into lang, where the catalog has them. Products are copied
+// before they are changed, since keyword search returns the loaded catalog's.
+// Products are left as they are if the translations cannot be read.
+func localize(ctx context.Context, lang string, products []*pb.Product, sl *searchLog) {
+	if lang == "" || len(products) == 0 || !dbReady.Load() || !productsSchemaReady.Load() {
+		return
+	}
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.Id
+	}
+	rows, err := readDB().QueryContext(ctx, localizeQuery(), ids, lang)
+	if err != nil {
+		sl.set("localize_error", err.Error())
+		return
+	}
+	defer rows.Close()
+	translations := map[string][2]sql.NullString{}
+	for rows.Next() {
+		var id string
+		var name, description sql.NullString
+		if err := rows.Scan(&id, &name, &description); err != nil {
+			sl.set("localize_error", err.Error())
+			return
+		}
+		translations[id] = [2]sql.NullString{name, description}
+	}
+	if err := rows.Err(); err != nil {
+		sl.set("localize_error", err.Error())
+		return
+	}
+
+	for i, p := range products {
+		t, ok := translations[p.Id]
+		if !ok {
+			continue
+		}
+		localized := proto.Clone(p).(*pb.Product)
+		if t[0].Valid && t[0].String != "" {
+			localized.Name = t[0].String
+		}
+		if t[1].Valid && t[1].String != "" {
+			localized.Description = t[1].String
+		}
+		products[i] = localized
+	}
+	sl.set("localized", len(translations))
+}
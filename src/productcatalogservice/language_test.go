@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestLanguagesFromEnv(t *testing.T) {
+	got, err := languagesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.catalog != "en" || got.translator != nil || got.timeout != time.Second {
+		t.Errorf("default: got %s", got)
+	}
+
+	t.Setenv("CATALOG_LANGUAGE", "fr-CA")
+	t.Setenv("QUERY_TRANSLATION", "cloud")
+	t.Setenv("QUERY_TRANSLATION_TIMEOUT", "300ms")
+	t.Setenv("PROJECT_ID", "shop")
+	got, err = languagesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := got.translator.(*cloudTranslator)
+	if !ok || !strings.Contains(c.url, "/projects/shop/") || got.catalog != "fr" || got.timeout != 300*time.Millisecond {
+		t.Errorf("got %s with translator %+v", got, got.translator)
+	}
+
+	for env, value := range map[string]string{
+		"QUERY_TRANSLATION":         "deepl",
+		"QUERY_TRANSLATION_TIMEOUT": "fast",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := languagesFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	for query, want := range map[string]string{
+		"sunglasses":                   "",
+		"mug for the kitchen":          "en",
+		"gafas de sol para la playa":   "es",
+		"año nuevo":                    "es",
+		"cadeau pour ma mère":          "fr",
+		"Geschenk für Oma":             "de",
+		"occhiali da sole per il mare": "it",
+		"presente para o meu pai":      "pt",
+		"サングラス":                        "ja",
+		"太阳镜":                          "zh",
+		"선글라스":                         "ko",
+		"солнцезащитные очки":          "ru",
+		"la mug":                       "",
+	} {
+		if got := detectLanguage(query); got != want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestDetectLanguageEnglishQueries(t *testing.T) {
+	// English queries with words that are also common in other languages.
+	for query, want := range map[string]string{
+		"pour over coffee maker":          "",
+		"die cast model car":              "",
+		"do it yourself kit":              "",
+		"o ring set":                      "",
+		"la lakers cap":                   "",
+		"con artist poster":               "",
+		"sin city poster":                 "",
+		"das boot dvd":                    "",
+		"a la carte menu":                 "",
+		"eine kleine nachtmusik cd":       "",
+		"salsa con queso for a party":     "",
+		"pour over kettle for the office": "en",
+	} {
+		if got := detectLanguage(query); got != want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestQueryLanguage(t *testing.T) {
+	s := languageSettings{catalog: "en"}
+	for _, tc := range []struct {
+		req  *pb.SemanticSearchRequest
+		want string
+	}{
+		{&pb.SemanticSearchRequest{Query: "sunglasses"}, ""},
+		{&pb.SemanticSearchRequest{Query: "gafas para la playa"}, "es"},
+		{&pb.SemanticSearchRequest{Query: "sunglasses", LanguageCode: "es-MX"}, "es"},
+		{&pb.SemanticSearchRequest{Query: "gafas para la playa", LanguageCode: "EN-us"}, ""},
+	} {
+		if got := s.queryLanguage(tc.req); got != tc.want {
+			t.Errorf("queryLanguage(%v) = %q, want %q", tc.req, got, tc.want)
+		}
+	}
+}
+
+// translateFunc is a queryTranslator backed by a function.
+type translateFunc func(ctx context.Context, text, source, target string) (string, error)
+
+func (f translateFunc) translate(ctx context.Context, text, source, target string) (string, error) {
+	return f(ctx, text, source, target)
+}
+
+// translateFrom translates whole queries from a table.
+func translateFrom(table map[string]string) translateFunc {
+	return func(_ context.Context, text, _, _ string) (string, error) {
+		if out, ok := table[text]; ok {
+			return out, nil
+		}
+		return "", errors.New("no translation")
+	}
+}
+
+func TestTranslateQuery(t *testing.T) {
+	s := languageSettings{catalog: "en", translator: translateFrom(map[string]string{"taza": "mug"})}
+	sl := newSearchLog(&pb.SemanticSearchRequest{})
+	if got := s.translateQuery(context.Background(), "taza", "es", sl); got != "mug" {
+		t.Errorf("got %q, want mug", got)
+	}
+	if got := s.translateQuery(context.Background(), "taza", "", sl); got != "taza" {
+		t.Errorf("a query in the catalog language was translated to %q", got)
+	}
+
+	sl = newSearchLog(&pb.SemanticSearchRequest{})
+	if got := s.translateQuery(context.Background(), "vaso", "es", sl); got != "vaso" || sl.fields["translate_error"] == nil {
+		t.Errorf("failed translation: got %q and fields %v", got, sl.fields)
+	}
+	if got := (languageSettings{catalog: "en"}).translateQuery(context.Background(), "taza", "es", sl); got != "taza" {
+		t.Errorf("without a translator: got %q", got)
+	}
+}
+
+func TestCloudTranslator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Contents []string `json:"contents"`
+			Source   string   `json:"sourceLanguageCode"`
+			Target   string   `json:"targetLanguageCode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		if len(req.Contents) != 1 || req.Contents[0] != "taza del chef" || req.Source != "es" || req.Target != "en" {
+			t.Errorf("got request %+v", req)
+		}
+		w.Write([]byte(`{"translations": [{"translatedText": "chef&#39;s mug"}]}`))
+	}))
+	defer srv.Close()
+
+	c := &cloudTranslator{api: &googleAPI{name: "translation", client: srv.Client()}, url: srv.URL}
+	got, err := c.translate(context.Background(), "taza del chef", "es", "en")
+	if err != nil || got != "chef's mug" {
+		t.Errorf("got %q, %v; want chef's mug", got, err)
+	}
+}
+
+func TestSemanticSearchTranslatesQuery(t *testing.T) {
+	defer func(s languageSettings) { languages = s }(languages)
+	languages = languageSettings{catalog: "en", translator: translateFrom(map[string]string{"delta producto": "delta"})}
+
+	resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "delta producto", LanguageCode: "es", Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Id != "abc002" {
+		t.Errorf("got %v, want the translated query's match", resp.Results)
+	}
+	if resp.QueryLanguage != "es" || resp.Debug.GetProcessedQuery() != "delta" {
+		t.Errorf("got query language %q and processed query %q", resp.QueryLanguage, resp.Debug.GetProcessedQuery())
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// maxListPageSize caps the page_size of ListProducts.
+const maxListPageSize = 1000
+
+// listPage returns the page of products that req asks for and the token of
+// the next page. Page tokens hold the offset of the next product, so a page
+// may skip or repeat products if the catalog changes between calls.
+func listPage(products []*pb.Product, req *pb.ListProductsRequest) ([]*pb.Product, string, error) {
+	size := int(req.GetPageSize())
+	if size < 0 {
+		return nil, "", fmt.Errorf("page_size must not be negative")
+	}
+	if size == 0 && req.GetPageToken() == "" {
+		return products, "", nil
+	}
+	if size == 0 || size > maxListPageSize {
+		size = maxListPageSize
+	}
+	offset, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, "", err
+	}
+	if offset >= len(products) {
+		return nil, "", nil
+	}
+	end := offset + size
+	if end >= len(products) {
+		return products[offset:], "", nil
+	}
+	return products[offset:end], encodePageToken(end), nil
+}
+
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page_token")
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid page_token")
+	}
+	return offset, nil
+}
+
+// productMask resolves mask to the Product fields to copy. A nil result means
+// every field. Only top-level fields can be selected.
+func productMask(mask *fieldmaskpb.FieldMask) ([]protoreflect.FieldDescriptor, error) {
+	if len(mask.GetPaths()) == 0 {
+		return nil, nil
+	}
+	fields := (&pb.Product{}).ProtoReflect().Descriptor().Fields()
+	selected := []protoreflect.FieldDescriptor{fields.ByName("id")}
+	for _, path := range mask.GetPaths() {
+		fd := fields.ByName(protoreflect.Name(path))
+		if fd == nil {
+			return nil, fmt.Errorf("read_mask: unknown product field %q", path)
+		}
+		if fd.Name() != "id" {
+			selected = append(selected, fd)
+		}
+	}
+	return selected, nil
+}
+
+// maskProducts returns copies of products holding only fields. The catalog's
+// products are never modified.
+func maskProducts(products []*pb.Product, fields []protoreflect.FieldDescriptor) []*pb.Product {
+	if fields == nil {
+		return products
+	}
+	out := make([]*pb.Product, len(products))
+	for i, p := range products {
+		src := p.ProtoReflect()
+		masked := &pb.Product{}
+		dst := masked.ProtoReflect()
+		for _, fd := range fields {
+			if src.Has(fd) {
+				dst.Set(fd, src.Get(fd))
+			}
+		}
+		out[i] = masked
+	}
+	return out
+}
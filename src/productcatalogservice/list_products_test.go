@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestListProductsPages(t *testing.T) {
+	var ids []string
+	req := &pb.ListProductsRequest{PageSize: 3}
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatal("too many pages")
+		}
+		resp, err := mockProductCatalog.ListProducts(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range resp.Products {
+			ids = append(ids, p.Id)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	want := []string{"abc001", "abc002", "abc003", "abc004"}
+	if len(ids) != len(want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("got %v, want %v", ids, want)
+			break
+		}
+	}
+}
+
+func TestListProductsInvalidPage(t *testing.T) {
+	for _, req := range []*pb.ListProductsRequest{
+		{PageSize: -1},
+		{PageSize: 2, PageToken: "not a token"},
+		{PageSize: 2, PageToken: encodePageToken(-1)},
+	} {
+		_, err := mockProductCatalog.ListProducts(context.Background(), req)
+		if got, want := status.Code(err), codes.InvalidArgument; got != want {
+			t.Errorf("%v: got %s, want %s", req, got, want)
+		}
+	}
+}
+
+func TestListProductsPastEnd(t *testing.T) {
+	resp, err := mockProductCatalog.ListProducts(context.Background(),
+		&pb.ListProductsRequest{PageSize: 2, PageToken: encodePageToken(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Products) != 0 || resp.NextPageToken != "" {
+		t.Errorf("got %d products and token %q, want none", len(resp.Products), resp.NextPageToken)
+	}
+}
+
+func TestListProductsReadMask(t *testing.T) {
+	catalog := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{{
+		Id:          "p1",
+		Name:        "Mug",
+		Description: "A mug",
+		Picture:     "/mug.jpg",
+		PriceUsd:    &pb.Money{CurrencyCode: "USD", Units: 8},
+		Categories:  []string{"kitchen"},
+	}}}}
+	resp, err := catalog.ListProducts(context.Background(), &pb.ListProductsRequest{
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "picture", "price_usd"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Products[0]
+	if got.Id != "p1" || got.Name != "Mug" || got.Picture != "/mug.jpg" || got.PriceUsd.GetUnits() != 8 {
+		t.Errorf("masked product lost a selected field: %v", got)
+	}
+	if got.Description != "" || len(got.Categories) != 0 {
+		t.Errorf("masked product kept an unselected field: %v", got)
+	}
+	if catalog.catalog.Products[0].Description == "" {
+		t.Error("masking modified the catalog")
+	}
+}
+
+func TestListProductsInvalidReadMask(t *testing.T) {
+	for _, path := range []string{"color", "price_usd.units"} {
+		_, err := mockProductCatalog.ListProducts(context.Background(), &pb.ListProductsRequest{
+			ReadMask: &fieldmaskpb.FieldMask{Paths: []string{path}},
+		})
+		if got, want := status.Code(err), codes.InvalidArgument; got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+}
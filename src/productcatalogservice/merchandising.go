@@ -0,0 +1,455 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// merchandisingSchemaSQL creates the table of merchandising rules. Exactly
+// one of product_id and category is set.
+const merchandisingSchemaSQL = `
+	CREATE TABLE IF NOT EXISTS merchandising_rules (
+		id BIGSERIAL PRIMARY KEY,
+		query_pattern TEXT NOT NULL DEFAULT '',
+		product_id TEXT,
+		category TEXT,
+		action TEXT NOT NULL,
+		starts_at TIMESTAMPTZ,
+		ends_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		CHECK ((product_id IS NULL) <> (category IS NULL))
+	);`
+
+// merchandisingReady is set once merchandisingSchemaSQL has been applied.
+var merchandisingReady atomic.Bool
+
+// ensureMerchandisingSchema applies merchandisingSchemaSQL.
+func ensureMerchandisingSchema(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, merchandisingSchemaSQL); err != nil {
+		return fmt.Errorf("failed to create merchandising_rules: %v", err)
+	}
+	merchandisingReady.Store(true)
+	return nil
+}
+
+// merchandisingRule is a MerchandisingRule ready to apply.
+type merchandisingRule struct {
+	id int64
+	// pattern is nil for a rule that matches every query.
+	pattern   *regexp.Regexp
+	productID string
+	category  string
+	action    pb.MerchandisingRule_Action
+	// start and end are zero for an open range.
+	start, end time.Time
+}
+
+// newMerchandisingRule validates r and compiles its pattern.
+func newMerchandisingRule(r *pb.MerchandisingRule) (merchandisingRule, error) {
+	rule := merchandisingRule{
+		id:        r.GetId(),
+		productID: strings.TrimSpace(r.GetProductId()),
+		category:  strings.ToLower(strings.TrimSpace(r.GetCategory())),
+		action:    r.GetAction(),
+	}
+	switch {
+	case rule.productID == "" && rule.category == "":
+		return merchandisingRule{}, fmt.Errorf("product_id or category is required")
+	case rule.action == pb.MerchandisingRule_ACTION_UNSPECIFIED || pb.MerchandisingRule_Action_name[int32(rule.action)] == "":
+		return merchandisingRule{}, fmt.Errorf("unknown action %d", rule.action)
+	case rule.action == pb.MerchandisingRule_PIN && rule.productID == "":
+		return merchandisingRule{}, fmt.Errorf("only products can be pinned")
+	}
+	if p := r.GetQueryPattern(); p != "" {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return merchandisingRule{}, fmt.Errorf("invalid query_pattern: %v", err)
+		}
+		rule.pattern = re
+	}
+	if r.StartTime != nil {
+		rule.start = r.StartTime.AsTime()
+	}
+	if r.EndTime != nil {
+		rule.end = r.EndTime.AsTime()
+	}
+	if !rule.start.IsZero() && !rule.end.IsZero() && !rule.end.After(rule.start) {
+		return merchandisingRule{}, fmt.Errorf("end_time must be after start_time")
+	}
+	return rule, nil
+}
+
+// proto returns the rule as a MerchandisingRule.
+func (r merchandisingRule) proto() *pb.MerchandisingRule {
+	m := &pb.MerchandisingRule{Id: r.id, Action: r.action}
+	if r.pattern != nil {
+		m.QueryPattern = strings.TrimPrefix(r.pattern.String(), "(?i)")
+	}
+	if r.productID != "" {
+		m.Target = &pb.MerchandisingRule_ProductId{ProductId: r.productID}
+	} else {
+		m.Target = &pb.MerchandisingRule_Category{Category: r.category}
+	}
+	if !r.start.IsZero() {
+		m.StartTime = timestamppb.New(r.start)
+	}
+	if !r.end.IsZero() {
+		m.EndTime = timestamppb.New(r.end)
+	}
+	return m
+}
+
+// active reports whether the rule applies to query at now.
+func (r merchandisingRule) active(query string, now time.Time) bool {
+	if !r.start.IsZero() && now.Before(r.start) {
+		return false
+	}
+	if !r.end.IsZero() && !now.Before(r.end) {
+		return false
+	}
+	return r.pattern == nil || r.pattern.MatchString(query)
+}
+
+// targets reports whether the rule moves product.
+func (r merchandisingRule) targets(product *pb.Product) bool {
+	if r.productID != "" {
+		return product.Id == r.productID
+	}
+	for _, c := range product.Categories {
+		if strings.EqualFold(strings.TrimSpace(c), r.category) {
+			return true
+		}
+	}
+	return false
+}
+
+// merchandisingRules holds the loaded rules, in ID order.
+var merchandisingRules atomic.Pointer[[]merchandisingRule]
+
+// currentMerchandisingRules returns the loaded rules.
+func currentMerchandisingRules() []merchandisingRule {
+	if rules := merchandisingRules.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+// merchandisingRefreshInterval is how often each replica rereads the rules,
+// so that rules written through another replica take effect. Set from the
+// environment at startup.
+var merchandisingRefreshInterval = time.Minute
+
+// merchandisingRefreshIntervalFromEnv reads MERCHANDISING_REFRESH_INTERVAL
+// (default 1m).
+func merchandisingRefreshIntervalFromEnv() (time.Duration, error) {
+	s := os.Getenv("MERCHANDISING_REFRESH_INTERVAL")
+	if s == "" {
+		return merchandisingRefreshInterval, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("failed to parse MERCHANDISING_REFRESH_INTERVAL (%s) as a positive time.Duration", s)
+	}
+	return d, nil
+}
+
+// queryMerchandisingRules reads every rule from the database.
+func queryMerchandisingRules(ctx context.Context) ([]merchandisingRule, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, query_pattern, COALESCE(product_id, ''), COALESCE(category, ''), action, starts_at, ends_at
+		FROM merchandising_rules
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merchandising rules: %v", err)
+	}
+	defer rows.Close()
+
+	var rules []merchandisingRule
+	for rows.Next() {
+		r := &pb.MerchandisingRule{}
+		var productID, category, action string
+		var start, end sql.NullTime
+		if err := rows.Scan(&r.Id, &r.QueryPattern, &productID, &category, &action, &start, &end); err != nil {
+			return nil, fmt.Errorf("failed to scan merchandising rule: %v", err)
+		}
+		if productID != "" {
+			r.Target = &pb.MerchandisingRule_ProductId{ProductId: productID}
+		} else {
+			r.Target = &pb.MerchandisingRule_Category{Category: category}
+		}
+		r.Action = pb.MerchandisingRule_Action(pb.MerchandisingRule_Action_value[strings.ToUpper(action)])
+		if start.Valid {
+			r.StartTime = timestamppb.New(start.Time)
+		}
+		if end.Valid {
+			r.EndTime = timestamppb.New(end.Time)
+		}
+		rule, err := newMerchandisingRule(r)
+		if err != nil {
+			log.Warnf("Skipping merchandising rule %d: %v", r.Id, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read merchandising rules: %v", err)
+	}
+	return rules, nil
+}
+
+// reloadMerchandisingRules swaps in the rules from the database. The loaded
+// rules are kept if they cannot be read.
+func reloadMerchandisingRules(ctx context.Context) error {
+	rules, err := queryMerchandisingRules(ctx)
+	if err != nil {
+		return err
+	}
+	merchandisingRules.Store(&rules)
+	return nil
+}
+
+// refreshMerchandisingRules rereads the rules and the campaigns every
+// interval until ctx is done. Each is skipped until the database and its
+// table are ready.
+func refreshMerchandisingRules(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if dbReady.Load() && merchandisingReady.Load() {
+			if err := reloadMerchandisingRules(ctx); err != nil {
+				log.Warnf("Merchandising rules refresh failed, keeping the loaded rules: %v", err)
+			}
+		}
+		if dbReady.Load() && campaignsReady.Load() {
+			if err := reloadCampaigns(ctx); err != nil {
+				log.Warnf("Campaigns refresh failed, keeping the loaded campaigns: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// merchandise applies the rules active for query to results, the ranked
+// results of a search: pinned products first, then boosted ones, the rest,
+// and buried ones last, each group keeping its ranking order. Pinned
+// products missing from the results are added if they match filters, and
+// the results grow to at most limit for them. It returns the results and
+// the IDs of the rules that changed them.
+func (p *productCatalog) merchandise(rules []merchandisingRule, query string, now time.Time,
+	results []*pb.Product, filters *searchFilters, limit int) ([]*pb.Product, []int64) {
+	const (
+		pinned = iota
+		boosted
+		neutral
+		buried
+	)
+	type ranked struct {
+		product *pb.Product
+		tier    int
+	}
+	var out []ranked
+	for _, product := range results {
+		out = append(out, ranked{product, neutral})
+	}
+	var applied []int64
+	found := func(id string) bool {
+		for _, r := range out {
+			if r.product.Id == id {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rule := range rules {
+		if !rule.active(query, now) {
+			continue
+		}
+		matched := false
+		if rule.action == pb.MerchandisingRule_PIN && !found(rule.productID) {
+			for _, product := range p.parseCatalog() {
+				if product.Id == rule.productID && filters.match(product) {
+					out = append(out, ranked{product, pinned})
+					matched = true
+					break
+				}
+			}
+		}
+		for i := range out {
+			if !rule.targets(out[i].product) {
+				continue
+			}
+			switch {
+			case rule.action == pb.MerchandisingRule_BURY:
+				out[i].tier = buried
+			case rule.action == pb.MerchandisingRule_PIN && out[i].tier != buried:
+				out[i].tier = pinned
+			case rule.action == pb.MerchandisingRule_BOOST && out[i].tier == neutral:
+				out[i].tier = boosted
+			default:
+				continue
+			}
+			matched = true
+		}
+		if matched {
+			applied = append(applied, rule.id)
+		}
+	}
+	if len(applied) == 0 {
+		return results, nil
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].tier < out[j].tier })
+	merchandised := make([]*pb.Product, 0, len(out))
+	for _, r := range out[:min(len(out), max(len(results), limit))] {
+		merchandised = append(merchandised, r.product)
+	}
+	return merchandised, applied
+}
+
+// merchandisingApplies reports whether any loaded rule is active for query.
+func merchandisingApplies(query string) bool {
+	now := time.Now()
+	for _, rule := range currentMerchandisingRules() {
+		if rule.active(query, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMerchandising reorders the results of a semantic search by the loaded
+// rules, keeping the debug scores in step, and returns the IDs of the rules
+// that changed them.
+func (p *productCatalog) applyMerchandising(req *pb.SemanticSearchRequest, query string, resp *pb.SearchProductsResponse) []int64 {
+	rules := currentMerchandisingRules()
+	if len(rules) == 0 {
+		return nil
+	}
+	filters, err := parseSearchFilters(req)
+	if err != nil {
+		return nil
+	}
+	limit := int(req.Limit)
+	if limit <= 0 || limit > maxSemanticSearchResults {
+		limit = 10
+	}
+	results, applied := p.merchandise(rules, query, time.Now(), resp.Results, filters, limit)
+	if len(applied) == 0 {
+		return nil
+	}
+	resp.Results = results
+	if resp.Debug != nil {
+		scores := map[string]*pb.SearchDebug_ResultScores{}
+		for _, s := range resp.Debug.Scores {
+			scores[s.ProductId] = s
+		}
+		resp.Debug.Scores = resp.Debug.Scores[:0]
+		for _, product := range results {
+			if s, ok := scores[product.Id]; ok {
+				resp.Debug.Scores = append(resp.Debug.Scores, s)
+			}
+		}
+	}
+	return applied
+}
+
+// CreateMerchandisingRule stores a rule and applies it on this replica right
+// away; other replicas pick it up within MERCHANDISING_REFRESH_INTERVAL.
+func (a *catalogAdmin) CreateMerchandisingRule(ctx context.Context, req *pb.MerchandisingRule) (*pb.MerchandisingRule, error) {
+	rule, err := newMerchandisingRule(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid rule: %v", err)
+	}
+	if !dbReady.Load() || !merchandisingReady.Load() {
+		return nil, status.Error(codes.Unavailable, "merchandising rules are not available")
+	}
+	var productID, category sql.NullString
+	if rule.productID != "" {
+		productID = sql.NullString{String: rule.productID, Valid: true}
+	} else {
+		category = sql.NullString{String: rule.category, Valid: true}
+	}
+	var start, end sql.NullTime
+	if !rule.start.IsZero() {
+		start = sql.NullTime{Time: rule.start, Valid: true}
+	}
+	if !rule.end.IsZero() {
+		end = sql.NullTime{Time: rule.end, Valid: true}
+	}
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO merchandising_rules (query_pattern, product_id, category, action, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		req.GetQueryPattern(), productID, category, strings.ToLower(rule.action.String()), start, end).Scan(&rule.id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create merchandising rule: %v", err)
+	}
+	if err := reloadMerchandisingRules(ctx); err != nil {
+		log.Warnf("Failed to reload merchandising rules: %v", err)
+	}
+	log.Infof("Created merchandising rule %d", rule.id)
+	return rule.proto(), nil
+}
+
+func (a *catalogAdmin) ListMerchandisingRules(ctx context.Context, req *pb.Empty) (*pb.ListMerchandisingRulesResponse, error) {
+	if !dbReady.Load() || !merchandisingReady.Load() {
+		return nil, status.Error(codes.Unavailable, "merchandising rules are not available")
+	}
+	rules, err := queryMerchandisingRules(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	resp := &pb.ListMerchandisingRulesResponse{}
+	for _, r := range rules {
+		resp.Rules = append(resp.Rules, r.proto())
+	}
+	return resp, nil
+}
+
+func (a *catalogAdmin) DeleteMerchandisingRule(ctx context.Context, req *pb.DeleteMerchandisingRuleRequest) (*pb.Empty, error) {
+	if !dbReady.Load() || !merchandisingReady.Load() {
+		return nil, status.Error(codes.Unavailable, "merchandising rules are not available")
+	}
+	res, err := db.ExecContext(ctx, `DELETE FROM merchandising_rules WHERE id = $1`, req.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete merchandising rule %d: %v", req.GetId(), err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, status.Errorf(codes.NotFound, "no merchandising rule with ID %d", req.GetId())
+	}
+	if err := reloadMerchandisingRules(ctx); err != nil {
+		log.Warnf("Failed to reload merchandising rules: %v", err)
+	}
+	log.Infof("Deleted merchandising rule %d", req.GetId())
+	return &pb.Empty{}, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNewMerchandisingRule(t *testing.T) {
+	start := time.Date(2026, 11, 27, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		rule    *pb.MerchandisingRule
+		wantErr bool
+	}{
+		{&pb.MerchandisingRule{Target: &pb.MerchandisingRule_ProductId{ProductId: "p1"}, Action: pb.MerchandisingRule_PIN}, false},
+		{&pb.MerchandisingRule{QueryPattern: "^sofa", Target: &pb.MerchandisingRule_Category{Category: "Home"}, Action: pb.MerchandisingRule_BOOST,
+			StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour))}, false},
+		{&pb.MerchandisingRule{Action: pb.MerchandisingRule_BURY}, true},
+		{&pb.MerchandisingRule{Target: &pb.MerchandisingRule_ProductId{ProductId: "p1"}}, true},
+		{&pb.MerchandisingRule{Target: &pb.MerchandisingRule_ProductId{ProductId: "p1"}, Action: 9}, true},
+		{&pb.MerchandisingRule{Target: &pb.MerchandisingRule_Category{Category: "home"}, Action: pb.MerchandisingRule_PIN}, true},
+		{&pb.MerchandisingRule{QueryPattern: "(", Target: &pb.MerchandisingRule_ProductId{ProductId: "p1"}, Action: pb.MerchandisingRule_BOOST}, true},
+		{&pb.MerchandisingRule{Target: &pb.MerchandisingRule_ProductId{ProductId: "p1"}, Action: pb.MerchandisingRule_BOOST,
+			StartTime: timestamppb.New(start), EndTime: timestamppb.New(start)}, true},
+	} {
+		rule, err := newMerchandisingRule(tc.rule)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("newMerchandisingRule(%v): got error %v, want error %v", tc.rule, err, tc.wantErr)
+			continue
+		}
+		if err == nil && !tc.wantErr {
+			want := proto.Clone(tc.rule).(*pb.MerchandisingRule)
+			if c := want.GetCategory(); c != "" {
+				want.Target = &pb.MerchandisingRule_Category{Category: "home"}
+			}
+			if got := rule.proto(); !proto.Equal(got, want) {
+				t.Errorf("round trip: got %v, want %v", got, want)
+			}
+		}
+	}
+}
+
+func TestMerchandisingRuleActive(t *testing.T) {
+	start := time.Date(2026, 11, 27, 0, 0, 0, 0, time.UTC)
+	rule, err := newMerchandisingRule(&pb.MerchandisingRule{
+		QueryPattern: `\bsofas?\b`,
+		Target:       &pb.MerchandisingRule_Category{Category: "home"},
+		Action:       pb.MerchandisingRule_BOOST,
+		StartTime:    timestamppb.New(start),
+		EndTime:      timestamppb.New(start.Add(24 * time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		query string
+		at    time.Time
+		want  bool
+	}{
+		{"Blue SOFA", start, true},
+		{"sofas", start.Add(23 * time.Hour), true},
+		{"sofabed", start, false},
+		{"sofa", start.Add(-time.Second), false},
+		{"sofa", start.Add(24 * time.Hour), false},
+	} {
+		if got := rule.active(tc.query, tc.at); got != tc.want {
+			t.Errorf("active(%q, %v) = %v, want %v", tc.query, tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestMerchandise(t *testing.T) {
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{
+		{Id: "p1", Categories: []string{"home"}},
+		{Id: "p2", Categories: []string{"kitchen"}},
+		{Id: "p3", Categories: []string{"home"}},
+		{Id: "p4", Categories: []string{"kitchen"}},
+		{Id: "p5", Categories: []string{"garden"}},
+	}}}
+	catalog := svc.parseCatalog()
+	results := []*pb.Product{catalog[0], catalog[1], catalog[2], catalog[3]}
+	rule := func(id int64, action pb.MerchandisingRule_Action, target string) merchandisingRule {
+		r := merchandisingRule{id: id, action: action, productID: target}
+		if target == "home" || target == "kitchen" {
+			r = merchandisingRule{id: id, action: action, category: target}
+		}
+		return r
+	}
+	ids := func(products []*pb.Product) string {
+		var s []string
+		for _, p := range products {
+			s = append(s, p.Id)
+		}
+		return fmt.Sprint(s)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		rules   []merchandisingRule
+		filters *searchFilters
+		limit   int
+		want    string
+		applied []int64
+	}{
+		{"boost category", []merchandisingRule{rule(1, pb.MerchandisingRule_BOOST, "kitchen")}, nil, 10, "[p2 p4 p1 p3]", []int64{1}},
+		{"bury product", []merchandisingRule{rule(1, pb.MerchandisingRule_BURY, "p1")}, nil, 10, "[p2 p3 p4 p1]", []int64{1}},
+		{"pin found product", []merchandisingRule{rule(1, pb.MerchandisingRule_PIN, "p3")}, nil, 10, "[p3 p1 p2 p4]", []int64{1}},
+		{"pin adds product", []merchandisingRule{rule(1, pb.MerchandisingRule_PIN, "p5")}, nil, 10, "[p5 p1 p2 p3 p4]", []int64{1}},
+		{"pin keeps result count at limit", []merchandisingRule{rule(1, pb.MerchandisingRule_PIN, "p5")}, nil, 2, "[p5 p1 p2 p3]", []int64{1}},
+		{"pin skips filtered product", []merchandisingRule{rule(1, pb.MerchandisingRule_PIN, "p5")},
+			&searchFilters{categories: []string{"home"}}, 10, "[p1 p2 p3 p4]", nil},
+		{"bury wins", []merchandisingRule{
+			rule(1, pb.MerchandisingRule_BURY, "home"),
+			rule(2, pb.MerchandisingRule_BOOST, "p1"),
+			rule(3, pb.MerchandisingRule_PIN, "p3"),
+		}, nil, 10, "[p2 p4 p1 p3]", []int64{1}},
+		{"inactive rule", []merchandisingRule{{id: 1, action: pb.MerchandisingRule_BURY, productID: "p1",
+			end: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}}, nil, 10, "[p1 p2 p3 p4]", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filters := tc.filters
+			if filters == nil {
+				filters = &searchFilters{}
+			}
+			got, applied := svc.merchandise(tc.rules, "query", time.Now(), results, filters, tc.limit)
+			if ids(got) != tc.want || fmt.Sprint(applied) != fmt.Sprint(tc.applied) {
+				t.Errorf("got %s by rules %v, want %s by rules %v", ids(got), applied, tc.want, tc.applied)
+			}
+		})
+	}
+}
+
+func TestSemanticSearchAppliesMerchandising(t *testing.T) {
+	defer merchandisingRules.Store(merchandisingRules.Load())
+	rules := []merchandisingRule{
+		{id: 1, action: pb.MerchandisingRule_BURY, productID: "abc001"},
+		{id: 2, action: pb.MerchandisingRule_PIN, productID: "abc004"},
+	}
+	merchandisingRules.Store(&rules)
+
+	resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "alpha", Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range resp.Results {
+		got = append(got, p.Id)
+	}
+	if want := "[abc004 abc003 abc001]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	if fmt.Sprint(resp.Debug.GetMerchandisingRules()) != "[1 2]" {
+		t.Errorf("got debug rules %v, want [1 2]", resp.Debug.GetMerchandisingRules())
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// metricsRegistry holds the metrics served on /metrics.
+var metricsRegistry = prometheus.NewRegistry()
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histograms.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	metricsFactory = promauto.With(metricsRegistry)
+
+	grpcRequests = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "productcatalog_grpc_requests_total",
+		Help: "gRPC requests handled, by service, method and status code.",
+	}, []string{"service", "method", "code"})
+	grpcLatency = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "productcatalog_grpc_request_duration_seconds",
+		Help:    "gRPC request latency, by service and method.",
+		Buckets: latencyBuckets,
+	}, []string{"service", "method"})
+	semanticSearches = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "productcatalog_semantic_searches_total",
+		Help: "Semantic search requests, by outcome: semantic, fallback or error.",
+	}, []string{"outcome"})
+	searchFallbacks = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "productcatalog_search_fallbacks_total",
+		Help: "Semantic search requests served from keyword search, by reason.",
+	}, []string{"reason"})
+	searchStepLatency = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "productcatalog_search_step_duration_seconds",
+		Help:    "Semantic search latency by step: translate, embed, query, rerank and total.",
+		Buckets: latencyBuckets,
+	}, []string{"step"})
+	searchRejections = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "productcatalog_search_rejections_total",
+		Help: "Semantic search requests rejected with RESOURCE_EXHAUSTED, by limit: rate or concurrency.",
+	}, []string{"limit"})
+	catalogReads = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "productcatalog_catalog_reads_total",
+		Help: "Catalog reads, by result: hit when served from memory, miss when the catalog was loaded.",
+	}, []string{"result"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(dbPoolCollector{})
+}
+
+// dbPoolStats describes the connection pool statistics exported for the
+// products database and its read endpoints.
+var dbPoolStats = []struct {
+	desc  *prometheus.Desc
+	kind  prometheus.ValueType
+	value func(s sql.DBStats) float64
+}{
+	{prometheus.NewDesc("productcatalog_db_max_open_connections", "Maximum open connections to the database.", []string{"pool"}, nil),
+		prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+	{prometheus.NewDesc("productcatalog_db_open_connections", "Open connections to the database, in use or idle.", []string{"pool"}, nil),
+		prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+	{prometheus.NewDesc("productcatalog_db_in_use_connections", "Connections to the database in use.", []string{"pool"}, nil),
+		prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.InUse) }},
+	{prometheus.NewDesc("productcatalog_db_idle_connections", "Idle connections to the database.", []string{"pool"}, nil),
+		prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.Idle) }},
+	{prometheus.NewDesc("productcatalog_db_wait_count_total", "Times a query waited for a free connection.", []string{"pool"}, nil),
+		prometheus.CounterValue, func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+	{prometheus.NewDesc("productcatalog_db_wait_duration_seconds_total", "Time spent waiting for a free connection.", []string{"pool"}, nil),
+		prometheus.CounterValue, func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+}
+
+// dbPoolCollector reads the connection pool statistics of the products
+// database and of its read endpoints at scrape time, labeled "primary" and
+// by region.
+type dbPoolCollector struct{}
+
+func (dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range dbPoolStats {
+		ch <- m.desc
+	}
+}
+
+func (dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	pools := map[string]sql.DBStats{}
+	if db != nil {
+		pools["primary"] = db.Stats()
+	}
+	if searchReads != nil {
+		for _, e := range searchReads.endpoints[1:] {
+			pools[e.region] = e.db.Stats()
+		}
+	}
+	for _, m := range dbPoolStats {
+		for name, stats := range pools {
+			ch <- prometheus.MustNewConstMetric(m.desc, m.kind, m.value(stats), name)
+		}
+	}
+}
+
+// metricsUnaryInterceptor counts and times unary calls, with the status
+// code they returned.
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	service, method := splitMethodName(info.FullMethod)
+	grpcRequests.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	grpcLatency.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// splitMethodName splits "/package.Service/Method" into the service and the
+// method.
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+// metricsPortFromEnv reads METRICS_PORT, the port /metrics is served on
+// (default 9090). "0" turns the endpoint off.
+func metricsPortFromEnv() (string, error) {
+	port := envOrDefault("METRICS_PORT", "9090")
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("failed to parse METRICS_PORT (%s) as a port number", port)
+	}
+	return port, nil
+}
+
+// metricsHandler serves the metrics in the Prometheus text format.
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// serveMetrics serves /metrics on port in the background.
+func serveMetrics(port string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler)
+	go func() {
+		if err := http.ListenAndServe(":"+port, mux); err != nil {
+			log.Errorf("metrics server stopped: %v", err)
+		}
+	}()
+}
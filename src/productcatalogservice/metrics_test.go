@@ -0,0 +1,139 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// histogramCount returns the number of observations in h with the given
+// label values.
+func histogramCount(t *testing.T, h *prometheus.HistogramVec, values ...string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.WithLabelValues(values...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsUnaryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ProductCatalogService/GetProduct"}
+	before := testutil.ToFloat64(grpcRequests.WithLabelValues("hipstershop.ProductCatalogService", "GetProduct", "NotFound"))
+	observed := histogramCount(t, grpcLatency, "hipstershop.ProductCatalogService", "GetProduct")
+
+	_, err := metricsUnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such product")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("got %v, want the handler's error", err)
+	}
+	if got := testutil.ToFloat64(grpcRequests.WithLabelValues("hipstershop.ProductCatalogService", "GetProduct", "NotFound")); got != before+1 {
+		t.Errorf("counted %v requests, want %v", got, before+1)
+	}
+	if got := histogramCount(t, grpcLatency, "hipstershop.ProductCatalogService", "GetProduct"); got != observed+1 {
+		t.Errorf("observed %d latencies, want %d", got, observed+1)
+	}
+}
+
+func TestSemanticSearchRecordsMetrics(t *testing.T) {
+	dbReady.Store(false)
+	fallbacks := testutil.ToFloat64(searchFallbacks.WithLabelValues(fallbackDatabaseUnavailable))
+	outcomes := testutil.ToFloat64(semanticSearches.WithLabelValues("fallback"))
+	totals := histogramCount(t, searchStepLatency, "total")
+
+	if _, err := mockProductCatalog.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "alpha"}); err != nil {
+		t.Fatal(err)
+	}
+	if testutil.ToFloat64(searchFallbacks.WithLabelValues(fallbackDatabaseUnavailable)) != fallbacks+1 || testutil.ToFloat64(semanticSearches.WithLabelValues("fallback")) != outcomes+1 {
+		t.Error("the fallback was not counted")
+	}
+	if histogramCount(t, searchStepLatency, "total") != totals+1 {
+		t.Error("the search latency was not observed")
+	}
+}
+
+func TestCatalogReadMetrics(t *testing.T) {
+	hits := testutil.ToFloat64(catalogReads.WithLabelValues("hit"))
+	if _, err := mockProductCatalog.GetProduct(context.Background(), &pb.GetProductRequest{Id: "abc001"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(catalogReads.WithLabelValues("hit")); got != hits+1 {
+		t.Errorf("counted %v catalog hits, want %v", got, hits+1)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	grpcRequests.WithLabelValues("hipstershop.ProductCatalogService", "ListProducts", "OK").Inc()
+	rec := httptest.NewRecorder()
+	metricsHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+	for _, want := range []string{
+		"# TYPE productcatalog_grpc_requests_total counter",
+		`productcatalog_grpc_requests_total{code="OK",method="ListProducts",service="hipstershop.ProductCatalogService"}`,
+		"# TYPE productcatalog_search_step_duration_seconds histogram",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+}
+
+func TestDBPoolCollector(t *testing.T) {
+	savedDB, savedReads := db, searchReads
+	t.Cleanup(func() { db, searchReads = savedDB, savedReads })
+	var err error
+	if db, err = sql.Open("pgx", "postgres://localhost/products"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+	searchReads = nil
+
+	want := `# HELP productcatalog_db_max_open_connections Maximum open connections to the database.
+# TYPE productcatalog_db_max_open_connections gauge
+productcatalog_db_max_open_connections{pool="primary"} 7
+`
+	if err := testutil.CollectAndCompare(dbPoolCollector{}, strings.NewReader(want), "productcatalog_db_max_open_connections"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsPortFromEnv(t *testing.T) {
+	for env, want := range map[string]string{"": "9090", "9464": "9464", "0": "0"} {
+		t.Setenv("METRICS_PORT", env)
+		if got, err := metricsPortFromEnv(); err != nil || got != want {
+			t.Errorf("METRICS_PORT=%q: got %q, %v; want %q", env, got, err, want)
+		}
+	}
+	t.Setenv("METRICS_PORT", "http")
+	if _, err := metricsPortFromEnv(); err == nil {
+		t.Error("expected an error for METRICS_PORT=http")
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/pgvector/pgvector-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// interactionsSchemaSQL creates the table of user interactions with products
+// that personalized search derives user profiles from.
+const interactionsSchemaSQL = `
+	CREATE TABLE IF NOT EXISTS product_interactions (
+		user_id TEXT NOT NULL,
+		product_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	ALTER TABLE product_interactions ADD COLUMN IF NOT EXISTS search_id TEXT;
+	CREATE INDEX IF NOT EXISTS product_interactions_user
+		ON product_interactions (user_id, created_at DESC);`
+
+// interactionsReady is set once interactionsSchemaSQL has been applied.
+var interactionsReady atomic.Bool
+
+// ensureInteractionsSchema applies interactionsSchemaSQL.
+func ensureInteractionsSchema(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, interactionsSchemaSQL); err != nil {
+		return fmt.Errorf("failed to create product_interactions: %v", err)
+	}
+	interactionsReady.Store(true)
+	return nil
+}
+
+// interactionWeights is how strongly each kind of interaction counts towards
+// a user's profile.
+var interactionWeights = map[pb.ProductInteraction_Kind]float64{
+	pb.ProductInteraction_VIEW:        1,
+	pb.ProductInteraction_ADD_TO_CART: 2,
+	pb.ProductInteraction_PURCHASE:    3,
+}
+
+// personalizationSettings control how much a user's profile moves the query
+// embedding of a semantic search.
+type personalizationSettings struct {
+	// weight is the share of the profile in the blended query embedding;
+	// 0 disables personalization.
+	weight float64
+	// halfLife is the age at which an interaction counts half as much.
+	halfLife time.Duration
+	// interactions is how many of the user's latest interactions make up
+	// the profile.
+	interactions int
+}
+
+func (s personalizationSettings) String() string {
+	if s.weight == 0 {
+		return "disabled"
+	}
+	return fmt.Sprintf("weight=%g, half_life=%s, interactions=%d", s.weight, s.halfLife, s.interactions)
+}
+
+// personalization holds the settings in effect, set from the environment at
+// startup.
+var personalization = personalizationSettings{weight: 0.3, halfLife: 30 * 24 * time.Hour, interactions: 50}
+
+// personalizationFromEnv builds personalizationSettings from the environment:
+//
+//	SEARCH_PERSONALIZATION_WEIGHT  profile share of the query, in [0, 1) (default 0.3)
+//	SEARCH_PROFILE_HALF_LIFE       interaction half-life (default 720h)
+//	SEARCH_PROFILE_INTERACTIONS    latest interactions per profile (default 50)
+func personalizationFromEnv() (personalizationSettings, error) {
+	s := personalization
+	if v := os.Getenv("SEARCH_PERSONALIZATION_WEIGHT"); v != "" {
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil || w < 0 || w >= 1 {
+			return personalizationSettings{}, fmt.Errorf("failed to parse SEARCH_PERSONALIZATION_WEIGHT (%s) as a number in [0, 1)", v)
+		}
+		s.weight = w
+	}
+	if v := os.Getenv("SEARCH_PROFILE_HALF_LIFE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return personalizationSettings{}, fmt.Errorf("failed to parse SEARCH_PROFILE_HALF_LIFE (%s) as a positive time.Duration", v)
+		}
+		s.halfLife = d
+	}
+	if v := os.Getenv("SEARCH_PROFILE_INTERACTIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return personalizationSettings{}, fmt.Errorf("failed to parse SEARCH_PROFILE_INTERACTIONS (%s) as a positive integer", v)
+		}
+		s.interactions = n
+	}
+	return s, nil
+}
+
+// requestProfile validates the explicit profile embedding of req.
+func requestProfile(req *pb.SemanticSearchRequest) ([]float32, error) {
+	profile := req.GetProfileEmbedding()
+	if len(profile) != 0 && len(profile) != embeddingDimensions {
+		return nil, fmt.Errorf("profile_embedding has %d dimensions, want %d", len(profile), embeddingDimensions)
+	}
+	return profile, nil
+}
+
+// personalize blends the query embedding with the explicit profile, or with
+// the one derived from the interactions of req.user_id. Without a profile,
+// or if it cannot be loaded, the query embedding is returned unchanged.
+func (s personalizationSettings) personalize(ctx context.Context, req *pb.SemanticSearchRequest, profile, query []float32, sl *searchLog) []float32 {
+	if s.weight == 0 {
+		return query
+	}
+	source := "request"
+	if len(profile) == 0 {
+		if req.GetUserId() == "" || !interactionsReady.Load() {
+			return query
+		}
+		var err error
+		if profile, err = s.userProfile(ctx, req.GetUserId()); err != nil {
+			sl.set("personalization_error", err.Error())
+			return query
+		}
+		if profile == nil {
+			return query
+		}
+		source = "history"
+	}
+	sl.set("personalized", source)
+	return blendEmbeddings(query, profile, s.weight)
+}
+
+// userProfile returns the preference vector of userID: the combined
+// embeddings of the products of their latest interactions, weighted by
+// interaction kind and halved every halfLife. It is nil if the user has no
+// interactions with embedded products.
+func (s personalizationSettings) userProfile(ctx context.Context, userID string) ([]float32, error) {
+	modelSQL, args := embeddingModelFilter([]interface{}{userID, s.interactions})
+	rows, err := readDB().QueryContext(ctx, `
+		SELECT i.kind, i.created_at, p.combined_embedding
+		FROM product_interactions i JOIN `+productsTable+` p ON p.id = i.product_id
+		WHERE i.user_id = $1 AND p.combined_embedding IS NOT NULL`+modelSQL+`
+		ORDER BY i.created_at DESC
+		LIMIT $2`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query interactions: %v", err)
+	}
+	defer rows.Close()
+
+	var profile []float32
+	now := time.Now()
+	for rows.Next() {
+		var kind string
+		var at time.Time
+		var embedding pgvector.Vector
+		if err := rows.Scan(&kind, &at, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan interaction: %v", err)
+		}
+		k, ok := pb.ProductInteraction_Kind_value[strings.ToUpper(kind)]
+		if !ok {
+			continue
+		}
+		w := interactionWeights[pb.ProductInteraction_Kind(k)] * math.Exp2(-now.Sub(at).Hours()/s.halfLife.Hours())
+		if profile == nil {
+			profile = make([]float32, len(embedding.Slice()))
+		}
+		for i, v := range embedding.Slice() {
+			profile[i] += float32(w) * v
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read interactions: %v", err)
+	}
+	return profile, nil
+}
+
+// blendEmbeddings returns (1-weight)·query + weight·profile, both normalized
+// to unit length first so weight is their share regardless of scale.
+func blendEmbeddings(query, profile []float32, weight float64) []float32 {
+	q, p := unitLength(query), unitLength(profile)
+	if p == nil {
+		return query
+	}
+	blended := make([]float32, len(q))
+	for i := range q {
+		blended[i] = float32((1-weight)*float64(q[i]) + weight*float64(p[i]))
+	}
+	return blended
+}
+
+// unitLength returns v scaled to length 1, or nil if v is all zeros.
+func unitLength(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// RecordProductInteraction stores an interaction of a user with a product
+// for personalized search, and for search analytics when it names the search
+// the product was found with.
+func (p *productCatalog) RecordProductInteraction(ctx context.Context, req *pb.ProductInteraction) (*pb.Empty, error) {
+	if req.GetUserId() == "" || req.GetProductId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id and product_id are required")
+	}
+	if _, ok := interactionWeights[req.GetKind()]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown interaction kind %d", req.GetKind())
+	}
+	if !dbReady.Load() || !interactionsReady.Load() {
+		return nil, status.Error(codes.Unavailable, "interaction history is not available")
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO product_interactions (user_id, product_id, kind, search_id) VALUES ($1, $2, $3, NULLIF($4, ''))`,
+		req.UserId, req.ProductId, strings.ToLower(req.Kind.String()), req.SearchId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to record interaction: %v", err)
+	}
+	return &pb.Empty{}, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPersonalizationFromEnv(t *testing.T) {
+	t.Setenv("SEARCH_PERSONALIZATION_WEIGHT", "0.5")
+	t.Setenv("SEARCH_PROFILE_HALF_LIFE", "168h")
+	t.Setenv("SEARCH_PROFILE_INTERACTIONS", "20")
+	got, err := personalizationFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := personalizationSettings{weight: 0.5, halfLife: 7 * 24 * time.Hour, interactions: 20}
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for env, value := range map[string]string{
+		"SEARCH_PERSONALIZATION_WEIGHT": "1",
+		"SEARCH_PROFILE_HALF_LIFE":      "0s",
+		"SEARCH_PROFILE_INTERACTIONS":   "-3",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := personalizationFromEnv(); err == nil {
+				t.Errorf("%s=%q: expected an error", env, value)
+			}
+		})
+	}
+}
+
+func TestBlendEmbeddings(t *testing.T) {
+	got := blendEmbeddings([]float32{2, 0}, []float32{0, 5}, 0.3)
+	want := []float32{0.7, 0.3}
+	for i := range want {
+		if math.Abs(float64(got[i]-want[i])) > 1e-6 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if got := blendEmbeddings([]float32{1, 0}, []float32{0, 0}, 0.3); got[0] != 1 || got[1] != 0 {
+		t.Errorf("blending with an empty profile changed the query: %v", got)
+	}
+}
+
+func TestPersonalizeWithExplicitProfile(t *testing.T) {
+	req := &pb.SemanticSearchRequest{Query: "jacket", UserId: "u1"}
+	sl := newSearchLog(req)
+	s := personalizationSettings{weight: 0.5}
+	got := s.personalize(context.Background(), req, []float32{0, 1}, []float32{1, 0}, sl)
+	if got[0] != 0.5 || got[1] != 0.5 {
+		t.Errorf("got %v, want the query and profile blended evenly", got)
+	}
+	if sl.fields["personalized"] != "request" {
+		t.Errorf("personalized field = %v, want request", sl.fields["personalized"])
+	}
+
+	s.weight = 0
+	if got := s.personalize(context.Background(), req, []float32{0, 1}, []float32{1, 0}, sl); got[0] != 1 {
+		t.Errorf("disabled personalization changed the query: %v", got)
+	}
+}
+
+func TestSemanticSearchRejectsProfileOfWrongSize(t *testing.T) {
+	_, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "jacket", ProfileEmbedding: []float32{1, 2, 3}})
+	if got, want := status.Code(err), codes.InvalidArgument; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRecordProductInteraction(t *testing.T) {
+	ctx := context.Background()
+	for _, req := range []*pb.ProductInteraction{
+		{ProductId: "abc001"},
+		{UserId: "u1"},
+		{UserId: "u1", ProductId: "abc001", Kind: 42},
+	} {
+		_, err := mockProductCatalog.RecordProductInteraction(ctx, req)
+		if got, want := status.Code(err), codes.InvalidArgument; got != want {
+			t.Errorf("%v: got %s, want %s", req, got, want)
+		}
+	}
+	_, err := mockProductCatalog.RecordProductInteraction(ctx, &pb.ProductInteraction{UserId: "u1", ProductId: "abc001"})
+	if got, want := status.Code(err), codes.Unavailable; got != want {
+		t.Errorf("without the database: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// productRanking is what semantic search ranks product p by: score, lower is
+// better, and the popularity column it reports. penalty, when set, is the
+// out-of-stock demotion and campaign boost score already includes, for
+// rankings such as keyword fusion that compute their own score. Both are in
+// the units of the weighted distance. join is joined to p wherever score or
+// penalty is used.
+type productRanking struct {
+	score      string
+	popularity string
+	penalty    string
+	join       string
+}
+
+// distanceRanking ranks products by weighted distance alone.
+var distanceRanking = productRanking{score: weightedDistanceSQL, popularity: "NULL::float8"}
+
+// popularitySettings control how much product popularity, derived from the
+// recorded interactions, moves semantic search rankings.
+type popularitySettings struct {
+	// weight is the share of popularity in the ranking score; 0 ranks by
+	// distance alone.
+	weight float64
+	// window is how far back interactions count.
+	window time.Duration
+	// refresh is how often popularity is recomputed.
+	refresh time.Duration
+}
+
+func (s popularitySettings) String() string {
+	if s.weight == 0 {
+		return "disabled"
+	}
+	return fmt.Sprintf("weight=%g, window=%s, refresh=%s", s.weight, s.window, s.refresh)
+}
+
+// popularity holds the settings in effect, set from the environment at
+// startup.
+var popularity = popularitySettings{window: 30 * 24 * time.Hour, refresh: 15 * time.Minute}
+
+// popularityFromEnv builds popularitySettings from the environment:
+//
+//	SEARCH_POPULARITY_WEIGHT            popularity share of the ranking score, in [0, 1) (default 0)
+//	SEARCH_POPULARITY_WINDOW            age of the oldest interactions counted (default 720h)
+//	SEARCH_POPULARITY_REFRESH_INTERVAL  how often popularity is recomputed (default 15m)
+func popularityFromEnv() (popularitySettings, error) {
+	s := popularity
+	if v := os.Getenv("SEARCH_POPULARITY_WEIGHT"); v != "" {
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil || w < 0 || w >= 1 {
+			return popularitySettings{}, fmt.Errorf("failed to parse SEARCH_POPULARITY_WEIGHT (%s) as a number in [0, 1)", v)
+		}
+		s.weight = w
+	}
+	if v := os.Getenv("SEARCH_POPULARITY_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return popularitySettings{}, fmt.Errorf("failed to parse SEARCH_POPULARITY_WINDOW (%s) as a positive time.Duration", v)
+		}
+		s.window = d
+	}
+	if v := os.Getenv("SEARCH_POPULARITY_REFRESH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return popularitySettings{}, fmt.Errorf("failed to parse SEARCH_POPULARITY_REFRESH_INTERVAL (%s) as a positive time.Duration", v)
+		}
+		s.refresh = d
+	}
+	return s, nil
+}
+
+// ranking returns the ranking of a semantic search: the weighted distance
+// blended with how unpopular the product is, so that among products at a
+// similar distance the best-sellers come first. The weight is appended to
+// args. Until productsSchemaSQL has added the popularity column, or with a
+// zero weight, it is distanceRanking.
+func (s popularitySettings) ranking(args []interface{}) (productRanking, []interface{}) {
+	if s.weight == 0 || !productsSchemaReady.Load() {
+		return distanceRanking, args
+	}
+	args = append(args, s.weight)
+	return productRanking{
+		score:      fmt.Sprintf(`((1 - $%[1]d::float8) * %[2]s + $%[1]d::float8 * (1 - p.popularity))`, len(args), weightedDistanceSQL),
+		popularity: "p.popularity",
+	}, args
+}
+
+// popularityQuery sets the popularity of every product from the interactions
+// of the last $1 seconds, each counted with its interactionWeights weight
+// ($2 purchase, $3 add to cart, $4 view). Scores are log-scaled and divided
+// by the top one, so popularity is between 0 and 1 and the best-seller does
+// not dwarf the rest.
+func popularityQuery() string {
+	return `
+	WITH scores AS (
+		SELECT product_id, sum(CASE kind
+			WHEN 'purchase' THEN $2::float8
+			WHEN 'add_to_cart' THEN $3::float8
+			ELSE $4::float8 END) AS score
+		FROM product_interactions
+		WHERE created_at > now() - make_interval(secs => $1)
+		GROUP BY product_id
+	), normalized AS (
+		SELECT p.id, COALESCE(ln(1 + s.score) / NULLIF(ln(1 + max(s.score) OVER ()), 0), 0) AS popularity
+		FROM ` + productsTable + ` p LEFT JOIN scores s ON s.product_id = p.id
+	)
+	UPDATE ` + productsTable + ` p SET popularity = n.popularity
+	FROM normalized n
+	WHERE n.id = p.id AND p.popularity IS DISTINCT FROM n.popularity`
+}
+
+// popularityLockSQL takes the session advisory lock held by the replica
+// that refreshes popularity, so only one replica runs popularityQuery.
+const popularityLockSQL = `SELECT pg_try_advisory_lock(hashtext('product_popularity'))`
+
+// updatePopularity recomputes product popularity and returns how many
+// products changed.
+func (s popularitySettings) updatePopularity(ctx context.Context) (int64, error) {
+	return s.updatePopularityWith(ctx, db)
+}
+
+// sqlExecer is a *sql.DB or one of its connections.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// updatePopularityWith is updatePopularity run on conn.
+func (s popularitySettings) updatePopularityWith(ctx context.Context, conn sqlExecer) (int64, error) {
+	res, err := conn.ExecContext(ctx, popularityQuery(), s.window.Seconds(),
+		interactionWeights[pb.ProductInteraction_PURCHASE],
+		interactionWeights[pb.ProductInteraction_ADD_TO_CART],
+		interactionWeights[pb.ProductInteraction_VIEW])
+	if err != nil {
+		return 0, fmt.Errorf("failed to update popularity: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+// popularityLeader returns a connection holding the popularity advisory
+// lock, or nil when another replica holds it. The lock lasts as long as the
+// connection, so a replica that exits hands the refresh to the others.
+func popularityLeader(ctx context.Context) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var leader bool
+	if err := conn.QueryRowContext(ctx, popularityLockSQL).Scan(&leader); err != nil || !leader {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// refreshPopularity recomputes product popularity every s.refresh until ctx
+// is done, on the one replica that holds the popularity lock; the others
+// try to take it over at every tick. Refreshes are skipped until the
+// database, the popularity column and the interactions table are ready.
+func (s popularitySettings) refreshPopularity(ctx context.Context) {
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+	var leader *sql.Conn
+	defer func() {
+		if leader != nil {
+			leader.Close()
+		}
+	}()
+	for {
+		if dbReady.Load() && productsSchemaReady.Load() && interactionsReady.Load() {
+			if leader == nil {
+				var err error
+				if leader, err = popularityLeader(ctx); err != nil {
+					log.Warnf("Failed to take the popularity refresh lock: %v", err)
+				} else if leader != nil {
+					log.Info("Refreshing product popularity on this replica")
+				}
+			}
+			if leader != nil {
+				if n, err := s.updatePopularityWith(ctx, leader); err != nil {
+					// The connection may be broken; drop it, and the lock
+					// with it, and take the lock again next time.
+					log.Warnf("Popularity refresh failed: %v", err)
+					leader.Close()
+					leader = nil
+				} else if n > 0 {
+					log.Infof("Updated the popularity of %d products", n)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestPopularityFromEnv(t *testing.T) {
+	got, err := popularityFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (popularitySettings{window: 720 * time.Hour, refresh: 15 * time.Minute}); got != want || got.String() != "disabled" {
+		t.Errorf("default: got %+v (%s), want %+v", got, got, want)
+	}
+
+	t.Setenv("SEARCH_POPULARITY_WEIGHT", "0.2")
+	t.Setenv("SEARCH_POPULARITY_WINDOW", "168h")
+	t.Setenv("SEARCH_POPULARITY_REFRESH_INTERVAL", "1h")
+	got, err = popularityFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (popularitySettings{weight: 0.2, window: 168 * time.Hour, refresh: time.Hour}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for env, value := range map[string]string{
+		"SEARCH_POPULARITY_WEIGHT":           "1",
+		"SEARCH_POPULARITY_WINDOW":           "-1h",
+		"SEARCH_POPULARITY_REFRESH_INTERVAL": "soon",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := popularityFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestPopularityRanking(t *testing.T) {
+	defer productsSchemaReady.Store(productsSchemaReady.Load())
+	base := make([]interface{}, 7)
+
+	productsSchemaReady.Store(true)
+	if r, args := (popularitySettings{}).ranking(base); r != distanceRanking || len(args) != 7 {
+		t.Errorf("zero weight: got %+v and %d args, want distanceRanking", r, len(args))
+	}
+	productsSchemaReady.Store(false)
+	if r, _ := (popularitySettings{weight: 0.2}).ranking(base); r != distanceRanking {
+		t.Errorf("without the popularity column: got %+v, want distanceRanking", r)
+	}
+
+	productsSchemaReady.Store(true)
+	r, args := popularitySettings{weight: 0.2}.ranking(base)
+	if len(args) != 8 || args[7] != 0.2 {
+		t.Fatalf("got args %v, want the weight appended", args)
+	}
+	if !strings.Contains(r.score, "$8::float8 * (1 - p.popularity)") || r.popularity != "p.popularity" {
+		t.Errorf("got ranking %+v", r)
+	}
+
+	// Keyword fusion ranks vector candidates by the blended score too.
+	query, _ := keywordFusion{mode: fusionRRF, rrfK: 60}.query("mug", 10, pb.SemanticSearchRequest_RELEVANCE,
+		r, "products p", "", "", args)
+	for _, w := range []string{r.score + " AS score", "p.popularity AS popularity"} {
+		if !strings.Contains(query, w) {
+			t.Errorf("fused query does not contain %q:\n%s", w, query)
+		}
+	}
+}
@@ -17,7 +17,7 @@ package main
 import (
 	"context"
 	"strings"
-	"time"
+	"sync"
 
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
 	"google.golang.org/grpc/codes"
@@ -27,10 +27,19 @@ import (
 
 type productCatalog struct {
 	pb.UnimplementedProductCatalogServiceServer
+
+	// mu guards catalog, which the refresher and admin RPCs replace while
+	// other RPCs read it.
+	mu      sync.RWMutex
 	catalog pb.ListProductsResponse
 }
 
+// Check reports SERVING, except for the readiness service name, which reports
+// NOT_SERVING until the startup dependency wait has finished.
 func (p *productCatalog) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.GetService() == readinessService && !startupComplete.Load() {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
 	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
 }
 
@@ -38,19 +47,24 @@ func (p *productCatalog) Watch(req *healthpb.HealthCheckRequest, ws healthpb.Hea
 	return status.Errorf(codes.Unimplemented, "health check via Watch not implemented")
 }
 
-func (p *productCatalog) ListProducts(context.Context, *pb.Empty) (*pb.ListProductsResponse, error) {
-	time.Sleep(extraLatency)
-
-	return &pb.ListProductsResponse{Products: p.parseCatalog()}, nil
+func (p *productCatalog) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
+	fields, err := productMask(req.GetReadMask())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	products, next, err := listPage(activeProducts(p.parseCatalog(), req.GetIncludeInactive()), req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.ListProductsResponse{Products: maskProducts(products, fields), NextPageToken: next}, nil
 }
 
 func (p *productCatalog) GetProduct(ctx context.Context, req *pb.GetProductRequest) (*pb.Product, error) {
-	time.Sleep(extraLatency)
-
 	var found *pb.Product
-	for i := 0; i < len(p.parseCatalog()); i++ {
-		if req.Id == p.parseCatalog()[i].Id {
-			found = p.parseCatalog()[i]
+	products := p.parseCatalog()
+	for i := 0; i < len(products); i++ {
+		if req.Id == products[i].Id {
+			found = products[i]
 		}
 	}
 
@@ -60,27 +74,59 @@ func (p *productCatalog) GetProduct(ctx context.Context, req *pb.GetProductReque
 	return found, nil
 }
 
+// SearchProducts matches the query against product names and descriptions.
+// With the database and trigram matching it searches the products table and
+// also finds misspelled and partial words; otherwise, or if that query
+// fails, it does substring matching on the loaded catalog. It is also the
+// fallback of SemanticSearchProducts.
 func (p *productCatalog) SearchProducts(ctx context.Context, req *pb.SearchProductsRequest) (*pb.SearchProductsResponse, error) {
-	time.Sleep(extraLatency)
-
+	query := strings.ToLower(queryProcessing.process(req.Query))
 	var ps []*pb.Product
-	for _, product := range p.parseCatalog() {
-		if strings.Contains(strings.ToLower(product.Name), strings.ToLower(req.Query)) ||
-			strings.Contains(strings.ToLower(product.Description), strings.ToLower(req.Query)) {
-			ps = append(ps, product)
+	if dbReady.Load() && trigramsReady.Load() && productsSchemaReady.Load() {
+		var err error
+		if ps, err = trigramSearch(ctx, query, req.GetIncludeInactive()); err != nil {
+			log.Warnf("Trigram keyword search failed, falling back to the catalog: %v", err)
+			ps = p.substringSearch(query, req.GetIncludeInactive())
 		}
+	} else {
+		ps = p.substringSearch(query, req.GetIncludeInactive())
 	}
+	p.searchResultVariants(ps)
 
 	return &pb.SearchProductsResponse{Results: ps}, nil
 }
 
 func (p *productCatalog) parseCatalog() []*pb.Product {
-	if reloadCatalog || len(p.catalog.Products) == 0 {
-		err := loadCatalog(&p.catalog)
-		if err != nil {
+	products := p.products()
+	if reloadCatalog || len(products) == 0 {
+		catalogReads.WithLabelValues("miss").Inc()
+		var fresh pb.ListProductsResponse
+		if err := loadCatalog(&fresh); err != nil {
 			return []*pb.Product{}
 		}
+		p.setProducts(fresh.Products)
+		return fresh.Products
 	}
+	catalogReads.WithLabelValues("hit").Inc()
+	return products
+}
 
+// products returns the loaded catalog. Callers must not modify it; a reload
+// replaces the slice rather than changing it.
+func (p *productCatalog) products() []*pb.Product {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.catalog.Products
 }
+
+func (p *productCatalog) setProducts(products []*pb.Product) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.catalog.Products = products
+}
+
+// invalidate drops the loaded catalog so the next read reloads it from its
+// source.
+func (p *productCatalog) invalidate() {
+	p.setProducts(nil)
+}
@@ -78,7 +78,7 @@ func TestGetProductNotFound(t *testing.T) {
 
 func TestListProducts(t *testing.T) {
 	products, err := mockProductCatalog.ListProducts(context.Background(),
-		&pb.Empty{},
+		&pb.ListProductsRequest{},
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// productEventBatchSize bounds the messages sent in one publish request;
+// Pub/Sub accepts up to 1000.
+const productEventBatchSize = 100
+
+// productEventSink publishes ProductChanged events to a Pub/Sub topic in the
+// background, so catalog writes never wait for Pub/Sub. Like search events,
+// events that find the buffer full are dropped and counted; a failed publish
+// drops its batch. Consumers that cannot miss a change should still
+// reconcile against the catalog now and then.
+type productEventSink struct {
+	topic   string
+	api     *googleAPI
+	url     string
+	events  chan *pb.ProductChanged
+	dropped atomic.Int64
+}
+
+func (s *productEventSink) String() string {
+	if s == nil {
+		return "disabled"
+	}
+	return fmt.Sprintf("%s, buffer=%d", s.topic, cap(s.events))
+}
+
+// productEvents is the sink in effect, set from the environment at startup;
+// nil disables product change events.
+var productEvents *productEventSink
+
+// productEventsFromEnv builds the sink from the environment:
+//
+//	PRODUCT_EVENTS_TOPIC   Pub/Sub topic, a name in PROJECT_ID or projects/P/topics/T (default none)
+//	PRODUCT_EVENTS_BUFFER  events queued for publishing before new ones are dropped (default 1000)
+func productEventsFromEnv() (*productEventSink, error) {
+	topic := os.Getenv("PRODUCT_EVENTS_TOPIC")
+	if topic == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(topic, "projects/") {
+		projectID, err := projectIDFor("PRODUCT_EVENTS_TOPIC")
+		if err != nil {
+			return nil, err
+		}
+		topic = fmt.Sprintf("projects/%s/topics/%s", projectID, topic)
+	}
+	if parts := strings.Split(topic, "/"); len(parts) != 4 || parts[2] != "topics" || parts[1] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("PRODUCT_EVENTS_TOPIC (%s) is not a topic name or projects/P/topics/T", topic)
+	}
+	buffer := 1000
+	if s := os.Getenv("PRODUCT_EVENTS_BUFFER"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("failed to parse PRODUCT_EVENTS_BUFFER (%s) as a positive integer", s)
+		}
+		buffer = v
+	}
+	return &productEventSink{
+		topic:  topic,
+		api:    &googleAPI{name: "Pub/Sub"},
+		url:    "https://pubsub.googleapis.com/v1/" + topic + ":publish",
+		events: make(chan *pb.ProductChanged, buffer),
+	}, nil
+}
+
+// emit queues a change of product id for publishing without blocking.
+// product is the product as written, or nil. It does nothing on a nil sink.
+func (s *productEventSink) emit(id string, change pb.ProductChanged_Change, product *pb.Product) {
+	if s == nil {
+		return
+	}
+	e := &pb.ProductChanged{ProductId: id, Change: change, Product: product, ChangeTime: timestamppb.Now()}
+	select {
+	case s.events <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run publishes queued events until ctx is done, batching those that queue
+// up while a publish is in flight.
+func (s *productEventSink) run(ctx context.Context) {
+	for {
+		var batch []*pb.ProductChanged
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-s.events:
+			batch = append(batch, e)
+		}
+	drain:
+		for len(batch) < productEventBatchSize {
+			select {
+			case e := <-s.events:
+				batch = append(batch, e)
+			default:
+				break drain
+			}
+		}
+		if err := s.publish(ctx, batch); err != nil {
+			log.Warnf("Failed to publish %d product change events: %v", len(batch), err)
+		}
+		if n := s.dropped.Swap(0); n > 0 {
+			log.Warnf("Dropped %d product change events", n)
+		}
+	}
+}
+
+// publish sends events to the topic in one request.
+func (s *productEventSink) publish(ctx context.Context, events []*pb.ProductChanged) error {
+	type message struct {
+		Data       []byte            `json:"data"`
+		Attributes map[string]string `json:"attributes"`
+	}
+	request := struct {
+		Messages []message `json:"messages"`
+	}{}
+	for _, e := range events {
+		data, err := protojson.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode product change event: %v", err)
+		}
+		request.Messages = append(request.Messages, message{
+			Data:       data,
+			Attributes: map[string]string{"change": e.Change.String(), "product_id": e.ProductId},
+		})
+	}
+	var response struct {
+		MessageIDs []string `json:"messageIds"`
+	}
+	return s.api.post(ctx, s.url, request, &response)
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestProductEventsFromEnv(t *testing.T) {
+	t.Setenv("PRODUCT_EVENTS_TOPIC", "")
+	if s, err := productEventsFromEnv(); s != nil || err != nil {
+		t.Errorf("default: got %v, %v; want disabled", s, err)
+	}
+
+	t.Setenv("PROJECT_ID", "shop")
+	t.Setenv("PRODUCT_EVENTS_TOPIC", "product-changes")
+	s, err := productEventsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.topic != "projects/shop/topics/product-changes" || cap(s.events) != 1000 {
+		t.Errorf("got %v, want projects/shop/topics/product-changes with a buffer of 1000", s)
+	}
+	t.Setenv("PROJECT_ID", "")
+	t.Setenv("PRODUCT_EVENTS_TOPIC", "projects/other/topics/changes")
+	if s, err := productEventsFromEnv(); err != nil || s.topic != "projects/other/topics/changes" {
+		t.Errorf("got %v, %v; want the full topic name kept", s, err)
+	}
+
+	for _, tc := range []struct{ env, value string }{
+		{"PRODUCT_EVENTS_TOPIC", "product-changes"}, // no PROJECT_ID
+		{"PRODUCT_EVENTS_TOPIC", "projects/other/subscriptions/changes"},
+		{"PRODUCT_EVENTS_BUFFER", "0"},
+	} {
+		t.Run(tc.env+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			if _, err := productEventsFromEnv(); err == nil {
+				t.Errorf("%s=%q: expected an error", tc.env, tc.value)
+			}
+		})
+	}
+}
+
+func TestProductEventSinkDropsWhenFull(t *testing.T) {
+	var disabled *productEventSink
+	disabled.emit("a", pb.ProductChanged_CREATED, nil) // no-op
+
+	s := &productEventSink{events: make(chan *pb.ProductChanged, 1)}
+	s.emit("a", pb.ProductChanged_CREATED, nil)
+	s.emit("b", pb.ProductChanged_CREATED, nil)
+	if got := s.dropped.Load(); got != 1 {
+		t.Errorf("dropped %d events, want 1", got)
+	}
+}
+
+func TestProductEventSinkPublish(t *testing.T) {
+	type message struct {
+		Data       []byte            `json:"data"`
+		Attributes map[string]string `json:"attributes"`
+	}
+	var got []message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/shop/topics/changes:publish" {
+			t.Errorf("published to %s", r.URL.Path)
+		}
+		var req struct {
+			Messages []message `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		got = req.Messages
+		json.NewEncoder(w).Encode(map[string][]string{"messageIds": {"1", "2"}})
+	}))
+	defer srv.Close()
+
+	s := &productEventSink{
+		topic:  "projects/shop/topics/changes",
+		api:    &googleAPI{name: "Pub/Sub", client: srv.Client()},
+		url:    srv.URL + "/v1/projects/shop/topics/changes:publish",
+		events: make(chan *pb.ProductChanged, 2),
+	}
+	s.emit("TEAPOT1", pb.ProductChanged_UPDATED, &pb.Product{Id: "TEAPOT1", Name: "Teapot"})
+	s.emit("MUG1", pb.ProductChanged_PURGED, nil)
+	if err := s.publish(context.Background(), []*pb.ProductChanged{<-s.events, <-s.events}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("published %d messages, want 2", len(got))
+	}
+	if got[0].Attributes["change"] != "UPDATED" || got[0].Attributes["product_id"] != "TEAPOT1" {
+		t.Errorf("first message attributes = %v", got[0].Attributes)
+	}
+	var e pb.ProductChanged
+	if err := protojson.Unmarshal(got[0].Data, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ProductId != "TEAPOT1" || e.Product.GetName() != "Teapot" || e.ChangeTime == nil {
+		t.Errorf("first event = %v, want the updated teapot with its change time", &e)
+	}
+	if got[1].Attributes["change"] != "PURGED" {
+		t.Errorf("second message attributes = %v", got[1].Attributes)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// activeProductSQL keeps discontinued and hidden products out of search
+// queries over products p.
+const activeProductSQL = ` AND p.status = 'active'`
+
+// activeProducts returns the products that are listed and searched: the
+// active ones, or all of them with includeInactive.
+func activeProducts(products []*pb.Product, includeInactive bool) []*pb.Product {
+	if includeInactive {
+		return products
+	}
+	for i, p := range products {
+		if p.Status == pb.Product_ACTIVE {
+			continue
+		}
+		active := append(make([]*pb.Product, 0, len(products)-1), products[:i]...)
+		for _, p := range products[i+1:] {
+			if p.Status == pb.Product_ACTIVE {
+				active = append(active, p)
+			}
+		}
+		return active
+	}
+	return products
+}
+
+// statusColumn returns the products table value of status s.
+func statusColumn(s pb.Product_Status) string {
+	return strings.ToLower(s.String())
+}
+
+// parseProductStatus parses a status as stored in the products table or
+// written in CSV documents, case-insensitively.
+func parseProductStatus(s string) (pb.Product_Status, error) {
+	v, ok := pb.Product_Status_value[strings.ToUpper(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("unknown product status %q", s)
+	}
+	return pb.Product_Status(v), nil
+}
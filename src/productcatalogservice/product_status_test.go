@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func statusCatalog() *productCatalog {
+	return &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{
+		{Id: "mug", Name: "Mug", Categories: []string{"kitchen"}},
+		{Id: "old-mug", Name: "Old Mug", Categories: []string{"kitchen"}, Status: pb.Product_DISCONTINUED},
+		{Id: "new-mug", Name: "New Mug", Categories: []string{"kitchen"}, Status: pb.Product_HIDDEN},
+		{Id: "jar", Name: "Jar", Categories: []string{"kitchen"}},
+	}}}
+}
+
+func productIDs(products []*pb.Product) string {
+	var ids []string
+	for _, p := range products {
+		ids = append(ids, p.Id)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestInactiveProductsAreNotListed(t *testing.T) {
+	svc := statusCatalog()
+	ctx := context.Background()
+
+	list, err := svc.ListProducts(ctx, &pb.ListProductsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := productIDs(list.Products); got != "[mug jar]" {
+		t.Errorf("ListProducts = %s, want [mug jar]", got)
+	}
+	list, err = svc.ListProducts(ctx, &pb.ListProductsRequest{IncludeInactive: true, PageSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := productIDs(list.Products); got != "[mug old-mug new-mug]" || list.NextPageToken == "" {
+		t.Errorf("ListProducts with include_inactive = %s, want the first 3 of 4", got)
+	}
+
+	search, err := svc.SearchProducts(ctx, &pb.SearchProductsRequest{Query: "mug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := productIDs(search.Results); got != "[mug]" {
+		t.Errorf("SearchProducts = %s, want [mug]", got)
+	}
+	search, err = svc.SearchProducts(ctx, &pb.SearchProductsRequest{Query: "mug", IncludeInactive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := productIDs(search.Results); got != "[mug old-mug new-mug]" {
+		t.Errorf("SearchProducts with include_inactive = %s", got)
+	}
+
+	similar, err := svc.GetSimilarProducts(ctx, &pb.GetSimilarProductsRequest{ProductId: "old-mug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := productIDs(similar.Results); got != "[mug jar]" {
+		t.Errorf("GetSimilarProducts = %s, want only active products", got)
+	}
+
+	// Orders still resolve discontinued products.
+	if p, err := svc.GetProduct(ctx, &pb.GetProductRequest{Id: "old-mug"}); err != nil || p.Status != pb.Product_DISCONTINUED {
+		t.Errorf("GetProduct(old-mug) = %v, %v", p, err)
+	}
+}
+
+func TestSearchFiltersMatchStatus(t *testing.T) {
+	hidden := &pb.Product{Status: pb.Product_HIDDEN}
+	if (&searchFilters{}).match(hidden) {
+		t.Error("hidden product passed the default filters")
+	}
+	if !(&searchFilters{includeInactive: true}).match(hidden) {
+		t.Error("hidden product failed include_inactive")
+	}
+}
+
+func TestParseProductStatus(t *testing.T) {
+	for s, want := range map[string]pb.Product_Status{
+		"active":        pb.Product_ACTIVE,
+		" Discontinued": pb.Product_DISCONTINUED,
+		"HIDDEN":        pb.Product_HIDDEN,
+	} {
+		if got, err := parseProductStatus(s); err != nil || got != want {
+			t.Errorf("parseProductStatus(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := parseProductStatus("retired"); err == nil {
+		t.Error("parseProductStatus(retired): expected error")
+	}
+	if got := statusColumn(pb.Product_DISCONTINUED); got != "discontinued" {
+		t.Errorf("statusColumn = %q", got)
+	}
+}
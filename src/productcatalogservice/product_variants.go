@@ -0,0 +1,189 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/golang/protobuf/proto"
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validateVariants checks the variants of p, whose price has been validated.
+func validateVariants(p *pb.Product) error {
+	skus := make(map[string]bool)
+	for i, v := range p.Variants {
+		field := fmt.Sprintf("variants[%d]", i)
+		if strings.TrimSpace(v.GetSku()) == "" {
+			return fmt.Errorf("%s: sku is required", field)
+		}
+		if skus[v.Sku] {
+			return fmt.Errorf("%s: sku %s is repeated", field, v.Sku)
+		}
+		skus[v.Sku] = true
+		if v.Stock < 0 {
+			return fmt.Errorf("%s: stock must not be negative", field)
+		}
+		delta, err := priceBound(field+".price_delta_usd", v.PriceDeltaUsd)
+		if err != nil {
+			return err
+		}
+		if delta != nil && priceNanos(p)+*delta < 0 {
+			return fmt.Errorf("%s: price_delta_usd makes the price negative", field)
+		}
+	}
+	return nil
+}
+
+// variantPriceNanos returns the price of variant v of p in USD nanos.
+func variantPriceNanos(p *pb.Product, v *pb.ProductVariant) int64 {
+	return priceNanos(p) + v.GetPriceDeltaUsd().GetUnits()*nanosPerUnit + int64(v.GetPriceDeltaUsd().GetNanos())
+}
+
+// usdFromNanos returns n USD nanos as Money.
+func usdFromNanos(n int64) *pb.Money {
+	return &pb.Money{CurrencyCode: "USD", Units: n / nanosPerUnit, Nanos: int32(n % nanosPerUnit)}
+}
+
+// summarizeVariants returns the summary of the variants of p, or nil if it
+// has none.
+func summarizeVariants(p *pb.Product) *pb.ProductVariantSummary {
+	if len(p.Variants) == 0 {
+		return nil
+	}
+	s := &pb.ProductVariantSummary{Count: int32(len(p.Variants))}
+	var lowest, highest int64
+	for i, v := range p.Variants {
+		if v.Size != "" && !slices.Contains(s.Sizes, v.Size) {
+			s.Sizes = append(s.Sizes, v.Size)
+		}
+		if v.Color != "" && !slices.Contains(s.Colors, v.Color) {
+			s.Colors = append(s.Colors, v.Color)
+		}
+		if v.Stock > 0 {
+			s.InStock++
+		}
+		price := variantPriceNanos(p, v)
+		if i == 0 || price < lowest {
+			lowest = price
+		}
+		if i == 0 || price > highest {
+			highest = price
+		}
+	}
+	s.MinPriceUsd = usdFromNanos(lowest)
+	s.MaxPriceUsd = usdFromNanos(highest)
+	return s
+}
+
+// setVariantSummaries summarizes the variants of freshly loaded products.
+func setVariantSummaries(products []*pb.Product) {
+	for _, p := range products {
+		p.VariantSummary = summarizeVariants(p)
+	}
+}
+
+// searchResultVariants replaces the variants of search results with their
+// summaries, so responses stay small. Results read from the products table
+// take the summary of the loaded catalog. Catalog products are copied before
+// they are changed.
+func (p *productCatalog) searchResultVariants(results []*pb.Product) {
+	missing := make(map[string][]int)
+	for i, r := range results {
+		if len(r.Variants) > 0 {
+			r = proto.Clone(r).(*pb.Product)
+			r.Variants = nil
+			results[i] = r
+		}
+		if r.VariantSummary == nil {
+			missing[r.Id] = append(missing[r.Id], i)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	for _, product := range p.parseCatalog() {
+		if product.VariantSummary == nil {
+			continue
+		}
+		for _, i := range missing[product.Id] {
+			results[i].VariantSummary = product.VariantSummary
+		}
+	}
+}
+
+// loadVariants attaches their variants to products read from the products
+// table.
+func loadVariants(ctx context.Context, products []*pb.Product) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT product_id, sku, size, color, price_delta_units, price_delta_nanos, stock
+		FROM product_variants ORDER BY product_id, position`)
+	if err != nil {
+		return fmt.Errorf("failed to query product variants: %v", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]*pb.Product, len(products))
+	for _, p := range products {
+		byID[p.Id] = p
+	}
+	for rows.Next() {
+		var productID string
+		v := &pb.ProductVariant{PriceDeltaUsd: &pb.Money{CurrencyCode: "USD"}}
+		if err := rows.Scan(&productID, &v.Sku, &v.Size, &v.Color,
+			&v.PriceDeltaUsd.Units, &v.PriceDeltaUsd.Nanos, &v.Stock); err != nil {
+			return fmt.Errorf("failed to scan product variant: %v", err)
+		}
+		if p, ok := byID[productID]; ok {
+			p.Variants = append(p.Variants, v)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read product variants: %v", err)
+	}
+	return nil
+}
+
+// writeVariants replaces the variants of product p. A SKU that belongs to
+// another product fails with ALREADY_EXISTS.
+func writeVariants(ctx context.Context, tx *sql.Tx, p *pb.Product) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_variants WHERE product_id = $1`, p.Id); err != nil {
+		return err
+	}
+	for i, v := range p.Variants {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO product_variants (sku, product_id, position, size, color,
+				price_delta_units, price_delta_nanos, stock)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			v.Sku, p.Id, i, v.Size, v.Color,
+			v.GetPriceDeltaUsd().GetUnits(), v.GetPriceDeltaUsd().GetNanos(), v.Stock)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return status.Errorf(codes.AlreadyExists, "sku %s belongs to another product", v.Sku)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
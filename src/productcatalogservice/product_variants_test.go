@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func tankTop() *pb.Product {
+	return &pb.Product{
+		Id: "TANK1", Name: "Tank Top", Description: "Cotton tank.",
+		PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 18, Nanos: 990000000},
+		Variants: []*pb.ProductVariant{
+			{Sku: "TANK1-S", Size: "S", Color: "white", Stock: 4},
+			{Sku: "TANK1-XL", Size: "XL", Color: "white", Stock: 1, PriceDeltaUsd: &pb.Money{CurrencyCode: "USD", Units: 2}},
+			{Sku: "TANK1-S-BLK", Size: "S", Color: "black", PriceDeltaUsd: &pb.Money{CurrencyCode: "USD", Nanos: -500000000}},
+		},
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	if err := validateProduct(tankTop()); err != nil {
+		t.Errorf("valid product rejected: %v", err)
+	}
+	for name, mutate := range map[string]func(p *pb.Product){
+		"missing sku":    func(p *pb.Product) { p.Variants[1].Sku = "" },
+		"repeated sku":   func(p *pb.Product) { p.Variants[2].Sku = "TANK1-S" },
+		"negative stock": func(p *pb.Product) { p.Variants[0].Stock = -1 },
+		"other currency": func(p *pb.Product) { p.Variants[1].PriceDeltaUsd.CurrencyCode = "EUR" },
+		"invalid delta":  func(p *pb.Product) { p.Variants[1].PriceDeltaUsd.Nanos = -1 },
+		"negative price": func(p *pb.Product) { p.Variants[2].PriceDeltaUsd = &pb.Money{Units: -19} },
+	} {
+		p := tankTop()
+		mutate(p)
+		if err := validateProduct(p); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSummarizeVariants(t *testing.T) {
+	s := summarizeVariants(tankTop())
+	if s.Count != 3 || s.InStock != 2 {
+		t.Errorf("got %d variants, %d in stock, want 3 and 2", s.Count, s.InStock)
+	}
+	if fmt.Sprint(s.Sizes, s.Colors) != "[S XL] [white black]" {
+		t.Errorf("got sizes %v and colors %v", s.Sizes, s.Colors)
+	}
+	if s.MinPriceUsd.Units != 18 || s.MinPriceUsd.Nanos != 490000000 || s.MaxPriceUsd.Units != 20 || s.MaxPriceUsd.Nanos != 990000000 {
+		t.Errorf("got prices %v to %v, want 18.49 to 20.99", s.MinPriceUsd, s.MaxPriceUsd)
+	}
+	if s := summarizeVariants(&pb.Product{Id: "MUG1"}); s != nil {
+		t.Errorf("product without variants summarized as %v", s)
+	}
+}
+
+func TestSearchResultVariants(t *testing.T) {
+	tank := tankTop()
+	tank.VariantSummary = summarizeVariants(tank)
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{tank, {Id: "MUG1", Name: "Tank mug"}}}}
+
+	resp, err := svc.SearchProducts(context.Background(), &pb.SearchProductsRequest{Query: "tank"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 || len(resp.Results[0].Variants) != 0 || resp.Results[0].VariantSummary.GetCount() != 3 {
+		t.Errorf("got results %v, want the tank top with only its summary", resp.Results)
+	}
+	if len(tank.Variants) != 3 {
+		t.Error("search removed the variants of the catalog product")
+	}
+
+	// Rows read from the products table take the catalog's summary.
+	fromDB := []*pb.Product{{Id: "TANK1"}, {Id: "MUG1"}}
+	svc.searchResultVariants(fromDB)
+	if fromDB[0].VariantSummary != tank.VariantSummary || fromDB[1].VariantSummary != nil {
+		t.Errorf("got summaries %v and %v", fromDB[0].VariantSummary, fromDB[1].VariantSummary)
+	}
+}
+
+func TestValidateImportRepeatedSKU(t *testing.T) {
+	other := tankTop()
+	other.Id = "TANK2"
+	other.Variants = other.Variants[:1]
+	err := validateImport([]*pb.Product{tankTop(), other})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("import with a SKU in two products = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// productsTable is the quoted name of the products table the catalog,
+// semantic search and the admin API use, from ALLOYDB_TABLE_NAME.
+var productsTable = "products"
+
+// tableNamePattern matches a table name, optionally qualified by its schema.
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// productsTableFromEnv reads ALLOYDB_TABLE_NAME (default products) and
+// returns it quoted for use in queries.
+func productsTableFromEnv() (string, error) {
+	name := envOrDefault("ALLOYDB_TABLE_NAME", "products")
+	if !tableNamePattern.MatchString(name) {
+		return "", fmt.Errorf("ALLOYDB_TABLE_NAME (%s) must be a table name, optionally qualified by a schema", name)
+	}
+	return pgx.Identifier(strings.Split(name, ".")).Sanitize(), nil
+}
+
+// productsSchemaSQL brings the products table created by
+// scripts/setup_cloudsql_private_complete.sh up to date. It adds:
+//
+//   - created_at, which semantic search sorts by for the NEWEST order;
+//   - updated_at, embedded_at, embedding_version and embedding_model, which
+//     the embedding reconciler compares, and a trigger that bumps updated_at whenever an
+//     embedded text column changes, so writers do not have to remember to;
+//   - search_tsv, the full-text document keyword fusion matches queries
+//     against, weighting name over categories over description;
+//   - image_embedding, which image search compares, and the picture it was
+//     computed from;
+//   - popularity, which semantic search can blend into its ranking;
+//   - name_translations and description_translations, objects mapping a
+//     language code to the product's name or description in it, which
+//     semantic search localizes results with;
+//   - status, the lifecycle status of the product; only active products are
+//     listed and searched by default;
+//   - stock, the units available of products without variants, NULL when
+//     stock is not tracked.
+//
+// It also creates product_variants, which holds the sizes, colors and other
+// purchasable variants of products, each with its own SKU, and categories,
+// the tree of the categories products are listed in.
+//
+// The advisory lock keeps replicas starting together from racing on CREATE OR
+// REPLACE FUNCTION.
+func productsSchemaSQL() string {
+	return `
+	SELECT pg_advisory_xact_lock(hashtext('products_schema'));
+
+	ALTER TABLE ` + productsTable + `
+		ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		ADD COLUMN IF NOT EXISTS embedded_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS embedding_version INTEGER,
+		ADD COLUMN IF NOT EXISTS embedding_model TEXT,
+		ADD COLUMN IF NOT EXISTS image_embedding vector(512),
+		ADD COLUMN IF NOT EXISTS image_embedded_picture TEXT,
+		ADD COLUMN IF NOT EXISTS popularity DOUBLE PRECISION NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS name_translations JSONB NOT NULL DEFAULT '{}',
+		ADD COLUMN IF NOT EXISTS description_translations JSONB NOT NULL DEFAULT '{}',
+		ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+			CHECK (status IN ('active', 'discontinued', 'hidden')),
+		ADD COLUMN IF NOT EXISTS stock INTEGER CHECK (stock >= 0),
+		ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('english', coalesce(categories, '')), 'B') ||
+			setweight(to_tsvector('english', coalesce(description, '')), 'C')
+		) STORED;
+
+	CREATE INDEX IF NOT EXISTS products_search_tsv ON ` + productsTable + ` USING gin (search_tsv);
+
+	CREATE TABLE IF NOT EXISTS product_variants (
+		sku TEXT PRIMARY KEY,
+		product_id VARCHAR(255) NOT NULL REFERENCES ` + productsTable + ` (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		size TEXT NOT NULL DEFAULT '',
+		color TEXT NOT NULL DEFAULT '',
+		price_delta_units BIGINT NOT NULL DEFAULT 0,
+		price_delta_nanos INTEGER NOT NULL DEFAULT 0,
+		stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0)
+	);
+	CREATE INDEX IF NOT EXISTS product_variants_product_id ON product_variants (product_id, position);
+
+	CREATE TABLE IF NOT EXISTS categories (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		parent_id TEXT REFERENCES categories (id)
+	);
+
+	CREATE OR REPLACE FUNCTION products_touch_updated_at() RETURNS trigger AS $$
+	BEGIN
+		IF ROW(NEW.name, NEW.description, NEW.categories, NEW.target_tags, NEW.use_context)
+			IS DISTINCT FROM ROW(OLD.name, OLD.description, OLD.categories, OLD.target_tags, OLD.use_context) THEN
+			NEW.updated_at = now();
+		END IF;
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS products_touch_updated_at ON ` + productsTable + `;
+	CREATE TRIGGER products_touch_updated_at BEFORE UPDATE ON ` + productsTable + `
+		FOR EACH ROW EXECUTE FUNCTION products_touch_updated_at();`
+}
+
+// productsSchemaReady is set once productsSchemaSQL has been applied.
+var productsSchemaReady atomic.Bool
+
+// ensureProductsSchema applies productsSchemaSQL once per process.
+func ensureProductsSchema(ctx context.Context) error {
+	if productsSchemaReady.Load() {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin schema transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, productsSchemaSQL()); err != nil {
+		return fmt.Errorf("failed to update products schema: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit products schema: %v", err)
+	}
+	productsSchemaReady.Store(true)
+	return nil
+}
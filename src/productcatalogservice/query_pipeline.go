@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const (
+	stepLowercase   = "lowercase"
+	stepPunctuation = "punctuation"
+	stepSynonyms    = "synonyms"
+	stepStopwords   = "stopwords"
+)
+
+// queryPipeline rewrites search queries before they are embedded or matched
+// by keyword. The enabled steps always run in the order lowercase,
+// punctuation, synonyms, stopwords.
+type queryPipeline struct {
+	lowercase, punctuation, synonyms, stopwords bool
+}
+
+func (q queryPipeline) String() string {
+	var steps []string
+	for _, s := range []struct {
+		name    string
+		enabled bool
+	}{
+		{stepLowercase, q.lowercase},
+		{stepPunctuation, q.punctuation},
+		{stepSynonyms, q.synonyms},
+		{stepStopwords, q.stopwords},
+	} {
+		if s.enabled {
+			steps = append(steps, s.name)
+		}
+	}
+	if len(steps) == 0 {
+		return "none"
+	}
+	return strings.Join(steps, ",")
+}
+
+// queryProcessing holds the pipeline in effect, set from the environment at
+// startup. By default queries are used as they are.
+var queryProcessing queryPipeline
+
+// queryPipelineFromEnv reads SEARCH_QUERY_STEPS, a comma-separated list of
+// the steps to enable, such as "lowercase,punctuation,synonyms,stopwords".
+func queryPipelineFromEnv() (queryPipeline, error) {
+	var q queryPipeline
+	for _, step := range strings.Split(os.Getenv("SEARCH_QUERY_STEPS"), ",") {
+		switch strings.TrimSpace(step) {
+		case "":
+		case stepLowercase:
+			q.lowercase = true
+		case stepPunctuation:
+			q.punctuation = true
+		case stepSynonyms:
+			q.synonyms = true
+		case stepStopwords:
+			q.stopwords = true
+		default:
+			return queryPipeline{}, fmt.Errorf("unknown SEARCH_QUERY_STEPS step %q (want lowercase, punctuation, synonyms or stopwords)", step)
+		}
+	}
+	return q, nil
+}
+
+// process runs the enabled steps on query and joins the remaining words with
+// single spaces. If removing stopwords would leave nothing, they are kept.
+// With no step enabled the query is returned as it is.
+func (q queryPipeline) process(query string) string {
+	if q == (queryPipeline{}) {
+		return query
+	}
+	if q.lowercase {
+		query = strings.ToLower(query)
+	}
+	if q.punctuation {
+		query = stripPunctuation(query)
+	}
+	words := strings.Fields(query)
+	if q.synonyms {
+		words = currentSynonyms().replace(words)
+	}
+	if q.stopwords {
+		if kept := removeStopwords(words); len(kept) > 0 {
+			words = kept
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// stripPunctuation replaces punctuation and symbols with spaces. Hyphens and
+// apostrophes between letters or digits are kept, as in "t-shirt" or "men's".
+func stripPunctuation(s string) string {
+	runes := []rune(s)
+	isWord := func(i int) bool {
+		return i >= 0 && i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]))
+	}
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			if (r == '-' || r == '\'') && isWord(i-1) && isWord(i+1) {
+				b.WriteRune(r)
+			} else {
+				b.WriteRune(' ')
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// stopwords are English words that carry no product meaning in a search.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "any": true, "are": true, "as": true,
+	"at": true, "be": true, "by": true, "for": true, "from": true, "i": true,
+	"in": true, "is": true, "it": true, "me": true, "my": true, "of": true,
+	"on": true, "or": true, "some": true, "that": true, "the": true,
+	"to": true, "with": true,
+}
+
+// removeStopwords drops the stopwords from words, ignoring case.
+func removeStopwords(words []string) []string {
+	var kept []string
+	for _, w := range words {
+		if !stopwords[strings.ToLower(w)] {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
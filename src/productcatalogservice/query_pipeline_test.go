@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestQueryPipelineFromEnv(t *testing.T) {
+	t.Setenv("SEARCH_QUERY_STEPS", "")
+	if q, err := queryPipelineFromEnv(); err != nil || q.String() != "none" {
+		t.Errorf("default: got %v, %v; want none", q, err)
+	}
+	t.Setenv("SEARCH_QUERY_STEPS", "stopwords, lowercase")
+	q, err := queryPipelineFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (queryPipeline{lowercase: true, stopwords: true}); q != want {
+		t.Errorf("got %v, want %v", q, want)
+	}
+	t.Setenv("SEARCH_QUERY_STEPS", "lowercase,stemming")
+	if _, err := queryPipelineFromEnv(); err == nil {
+		t.Error("expected an error for an unknown step")
+	}
+}
+
+func TestQueryPipelineProcess(t *testing.T) {
+	defer func(t *synonymTable) { synonyms.Store(t) }(synonyms.Load())
+	table, err := parseSynonyms([]byte(`{"sofa": ["couch", "settee"], "t-shirt": ["tee shirt"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synonyms.Store(table)
+
+	all := queryPipeline{lowercase: true, punctuation: true, synonyms: true, stopwords: true}
+	for _, tc := range []struct {
+		pipeline    queryPipeline
+		query, want string
+	}{
+		{queryPipeline{}, "  A Couch!  ", "  A Couch!  "},
+		{all, "A comfy Couch, for the living-room!", "comfy sofa living-room"},
+		{all, "Men's TEE SHIRT (blue)", "men's t-shirt blue"},
+		{all, "the", "the"},
+		{queryPipeline{lowercase: true}, "A Couch", "a couch"},
+		{queryPipeline{synonyms: true}, "Couch", "sofa"},
+	} {
+		if got := tc.pipeline.process(tc.query); got != tc.want {
+			t.Errorf("%v.process(%q) = %q, want %q", tc.pipeline, tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestStripPunctuation(t *testing.T) {
+	for in, want := range map[string]string{
+		"salt & pepper": "salt   pepper",
+		"t-shirt":       "t-shirt",
+		"- rugs -":      "  rugs  ",
+		"$20 mug?":      " 20 mug ",
+	} {
+		if got := stripPunctuation(in); got != want {
+			t.Errorf("stripPunctuation(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
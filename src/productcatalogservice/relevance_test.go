@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"testing"
+)
+
+// relevanceJudgments are golden graded judgments: for each query, the ids of
+// relevant products and their gain (higher is more relevant).
+type relevanceJudgments struct {
+	K       int `json:"k"`
+	Queries []struct {
+		Query    string         `json:"query"`
+		Relevant map[string]int `json:"relevant"`
+	} `json:"queries"`
+}
+
+func loadRelevanceJudgments(t *testing.T) relevanceJudgments {
+	t.Helper()
+	data, err := os.ReadFile("testdata/relevance_judgments.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j relevanceJudgments
+	if err := json.Unmarshal(data, &j); err != nil {
+		t.Fatalf("failed to parse relevance judgments: %v", err)
+	}
+	return j
+}
+
+// recallAtK is the fraction of relevant ids found in the first k results.
+func recallAtK(ranked []string, relevant map[string]int, k int) float64 {
+	if len(relevant) == 0 {
+		return 0
+	}
+	found := 0
+	for i, id := range ranked {
+		if i >= k {
+			break
+		}
+		if relevant[id] > 0 {
+			found++
+		}
+	}
+	return float64(found) / float64(len(relevant))
+}
+
+// ndcgAtK is the normalized discounted cumulative gain of the first k results.
+func ndcgAtK(ranked []string, relevant map[string]int, k int) float64 {
+	dcg := 0.0
+	for i, id := range ranked {
+		if i >= k {
+			break
+		}
+		dcg += float64(relevant[id]) / math.Log2(float64(i+2))
+	}
+
+	var gains []int
+	for _, g := range relevant {
+		gains = append(gains, g)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(gains)))
+	idcg := 0.0
+	for i, g := range gains {
+		if i >= k {
+			break
+		}
+		idcg += float64(g) / math.Log2(float64(i+2))
+	}
+	if idcg == 0 {
+		return 0
+	}
+	return dcg / idcg
+}
+
+func TestRecallAtK(t *testing.T) {
+	relevant := map[string]int{"a": 3, "b": 1}
+	tests := []struct {
+		ranked []string
+		k      int
+		want   float64
+	}{
+		{[]string{"a", "b", "c"}, 3, 1},
+		{[]string{"c", "a", "b"}, 2, 0.5},
+		{[]string{"c", "d"}, 2, 0},
+	}
+	for _, tt := range tests {
+		if got := recallAtK(tt.ranked, relevant, tt.k); got != tt.want {
+			t.Errorf("recallAtK(%v, %d) = %v, want %v", tt.ranked, tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestNDCGAtK(t *testing.T) {
+	relevant := map[string]int{"a": 3, "b": 1}
+	if got := ndcgAtK([]string{"a", "b", "c"}, relevant, 3); math.Abs(got-1) > 1e-9 {
+		t.Errorf("ideal ranking: got %v, want 1", got)
+	}
+	swapped := ndcgAtK([]string{"b", "a"}, relevant, 3)
+	if swapped <= 0 || swapped >= 1 {
+		t.Errorf("swapped ranking: got %v, want strictly between 0 and 1", swapped)
+	}
+	if got := ndcgAtK([]string{"c", "d"}, relevant, 3); got != 0 {
+		t.Errorf("no relevant results: got %v, want 0", got)
+	}
+}
+
+func TestRelevanceJudgmentsReferenceCatalog(t *testing.T) {
+	judgments := loadRelevanceJudgments(t)
+	svc := &productCatalog{}
+	if err := loadCatalogFromLocalFile(&svc.catalog); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, p := range svc.catalog.Products {
+		ids[p.Id] = true
+	}
+	for _, q := range judgments.Queries {
+		for id := range q.Relevant {
+			if !ids[id] {
+				t.Errorf("query %q judges unknown product %s", q.Query, id)
+			}
+		}
+	}
+}
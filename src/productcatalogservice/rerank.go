@@ -0,0 +1,231 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const (
+	rerankOff    = "off"
+	rerankVertex = "vertex"
+
+	defaultRerankModel = "semantic-ranker-512@latest"
+
+	// maxRerankCandidates is the most records the Vertex AI ranking API
+	// accepts in one call.
+	maxRerankCandidates = 200
+)
+
+// reranker scores how well documents answer a query.
+type reranker interface {
+	// rank returns one relevance score per document, in the order of docs;
+	// higher is more relevant.
+	rank(ctx context.Context, query string, docs []rerankDocument) ([]float64, error)
+}
+
+// rerankDocument is the text of a product a reranker reads.
+type rerankDocument struct {
+	title   string
+	content string
+}
+
+// rerankSettings configure the optional second stage of semantic search,
+// which reorders the products closest to the query by a cross-encoder's
+// judgement of their relevance.
+type rerankSettings struct {
+	mode  string
+	model string
+	// candidates is how many products, by vector distance, are reranked.
+	candidates int32
+	// timeout bounds the reranking call; 0 leaves it to the request deadline.
+	timeout time.Duration
+	ranker  reranker
+}
+
+func (s rerankSettings) String() string {
+	if !s.enabled() {
+		return "disabled"
+	}
+	return fmt.Sprintf("mode=%s, model=%s, candidates=%d, timeout=%s", s.mode, s.model, s.candidates, s.timeout)
+}
+
+// reranking holds the settings in effect, set from the environment at
+// startup.
+var reranking = rerankSettings{mode: rerankOff, model: defaultRerankModel, candidates: 50, timeout: time.Second}
+
+// rerankingFromEnv builds rerankSettings from the environment:
+//
+//	SEARCH_RERANK             off or vertex, the Vertex AI ranking API (default off)
+//	SEARCH_RERANK_MODEL       ranking model (default semantic-ranker-512@latest)
+//	SEARCH_RERANK_CANDIDATES  products reranked, up to 200 (default 50)
+//	SEARCH_RERANK_TIMEOUT     bound on the reranking call, 0 for none (default 1s)
+func rerankingFromEnv() (rerankSettings, error) {
+	s := reranking
+	if v := os.Getenv("SEARCH_RERANK_MODEL"); v != "" {
+		s.model = v
+	}
+	if v := os.Getenv("SEARCH_RERANK_CANDIDATES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRerankCandidates {
+			return rerankSettings{}, fmt.Errorf("failed to parse SEARCH_RERANK_CANDIDATES (%s) as an integer from 1 to %d", v, maxRerankCandidates)
+		}
+		s.candidates = int32(n)
+	}
+	if v := os.Getenv("SEARCH_RERANK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return rerankSettings{}, fmt.Errorf("failed to parse SEARCH_RERANK_TIMEOUT (%s) as a non-negative time.Duration", v)
+		}
+		s.timeout = d
+	}
+	s.mode = envOrDefault("SEARCH_RERANK", rerankOff)
+	switch s.mode {
+	case rerankOff:
+		s.ranker = nil
+	case rerankVertex:
+		projectID, err := projectIDFor("SEARCH_RERANK=vertex")
+		if err != nil {
+			return rerankSettings{}, err
+		}
+		s.ranker = newVertexReranker(projectID, s.model)
+	default:
+		return rerankSettings{}, fmt.Errorf("unknown SEARCH_RERANK %q, want off or vertex", s.mode)
+	}
+	return s, nil
+}
+
+func (s rerankSettings) enabled() bool {
+	return s.ranker != nil
+}
+
+// appliesTo reports whether req is reranked. Only relevance-ordered results
+// are: with another sort order the reranker could only change which
+// products make the page, not their order.
+func (s rerankSettings) appliesTo(req *pb.SemanticSearchRequest) bool {
+	return s.enabled() && req.GetSortBy() == pb.SemanticSearchRequest_RELEVANCE
+}
+
+// rerank reorders products, in vector order, by the ranker's scores and
+// returns the first limit, with their debug scores reordered alike when
+// there are any. If the ranker fails or times out, the vector order is kept.
+func (s rerankSettings) rerank(ctx context.Context, query string, products []*pb.Product, scores []*pb.SearchDebug_ResultScores, limit int32, sl *searchLog) ([]*pb.Product, []*pb.SearchDebug_ResultScores) {
+	first := func() ([]*pb.Product, []*pb.SearchDebug_ResultScores) {
+		return products[:min(len(products), int(limit))], scores[:min(len(scores), int(limit))]
+	}
+	if len(products) == 0 {
+		return first()
+	}
+
+	docs := make([]rerankDocument, len(products))
+	for i, p := range products {
+		docs[i] = rerankDocument{title: p.Name, content: p.Description}
+	}
+	start := time.Now()
+	rankCtx, cancel := withStepTimeout(ctx, s.timeout)
+	relevance, err := s.ranker.rank(rankCtx, query, docs)
+	cancel()
+	sl.step("rerank", time.Since(start))
+	if err == nil && len(relevance) != len(products) {
+		err = fmt.Errorf("got %d scores for %d products", len(relevance), len(products))
+	}
+	if err != nil {
+		sl.set("rerank_error", err.Error())
+		return first()
+	}
+	sl.set("reranked", len(products))
+
+	order := make([]int, len(products))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return relevance[order[a]] > relevance[order[b]] })
+	order = order[:min(len(order), int(limit))]
+
+	reranked := make([]*pb.Product, len(order))
+	var rerankedScores []*pb.SearchDebug_ResultScores
+	for i, j := range order {
+		reranked[i] = products[j]
+		if len(scores) == len(products) {
+			score := relevance[j]
+			scores[j].RerankScore = &score
+			rerankedScores = append(rerankedScores, scores[j])
+		}
+	}
+	return reranked, rerankedScores
+}
+
+// vertexReranker calls the Vertex AI ranking API, part of Discovery Engine.
+type vertexReranker struct {
+	api   *googleAPI
+	url   string
+	model string
+}
+
+func newVertexReranker(projectID, model string) *vertexReranker {
+	return &vertexReranker{
+		api:   &googleAPI{name: "ranking"},
+		url:   fmt.Sprintf("https://discoveryengine.googleapis.com/v1/projects/%s/locations/global/rankingConfigs/default_ranking_config:rank", projectID),
+		model: model,
+	}
+}
+
+// rank implements reranker.
+func (v *vertexReranker) rank(ctx context.Context, query string, docs []rerankDocument) ([]float64, error) {
+	type record struct {
+		ID      string  `json:"id"`
+		Title   string  `json:"title,omitempty"`
+		Content string  `json:"content,omitempty"`
+		Score   float64 `json:"score,omitempty"`
+	}
+	request := struct {
+		Model                         string   `json:"model"`
+		Query                         string   `json:"query"`
+		Records                       []record `json:"records"`
+		IgnoreRecordDetailsInResponse bool     `json:"ignoreRecordDetailsInResponse"`
+	}{Model: v.model, Query: query, IgnoreRecordDetailsInResponse: true}
+	// Records are identified by their position in docs.
+	for i, d := range docs {
+		request.Records = append(request.Records, record{ID: strconv.Itoa(i), Title: d.title, Content: d.content})
+	}
+	var response struct {
+		Records []record `json:"records"`
+	}
+	if err := v.api.post(ctx, v.url, request, &response); err != nil {
+		return nil, err
+	}
+
+	// Records the API leaves out rank below all the others.
+	scores := make([]float64, len(docs))
+	for i := range scores {
+		scores[i] = -1
+	}
+	for _, r := range response.Records {
+		i, err := strconv.Atoi(strings.TrimSpace(r.ID))
+		if err != nil || i < 0 || i >= len(docs) {
+			return nil, fmt.Errorf("ranking response has an unknown record %q", r.ID)
+		}
+		scores[i] = r.Score
+	}
+	return scores, nil
+}
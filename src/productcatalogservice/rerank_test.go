@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestRerankingFromEnv(t *testing.T) {
+	got, err := rerankingFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.enabled() || got.String() != "disabled" || got.candidates != 50 || got.timeout != time.Second {
+		t.Errorf("default: got %+v (%s)", got, got)
+	}
+
+	t.Setenv("SEARCH_RERANK", "vertex")
+	t.Setenv("SEARCH_RERANK_MODEL", "semantic-ranker-fast@latest")
+	t.Setenv("SEARCH_RERANK_CANDIDATES", "100")
+	t.Setenv("SEARCH_RERANK_TIMEOUT", "500ms")
+	t.Setenv("PROJECT_ID", "shop")
+	got, err = rerankingFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := got.ranker.(*vertexReranker)
+	if !ok || v.model != "semantic-ranker-fast@latest" || !strings.Contains(v.url, "/projects/shop/") {
+		t.Errorf("got ranker %+v", got.ranker)
+	}
+	if got.candidates != 100 || got.timeout != 500*time.Millisecond {
+		t.Errorf("got %s", got)
+	}
+
+	for env, value := range map[string]string{
+		"SEARCH_RERANK":            "cohere",
+		"SEARCH_RERANK_CANDIDATES": "201",
+		"SEARCH_RERANK_TIMEOUT":    "-1s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := rerankingFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+// rerankFunc is a reranker backed by a function.
+type rerankFunc func(ctx context.Context, query string, docs []rerankDocument) ([]float64, error)
+
+func (f rerankFunc) rank(ctx context.Context, query string, docs []rerankDocument) ([]float64, error) {
+	return f(ctx, query, docs)
+}
+
+// rerankByTitle scores documents from a table of titles; others score 0.
+func rerankByTitle(scores map[string]float64) rerankFunc {
+	return func(_ context.Context, _ string, docs []rerankDocument) ([]float64, error) {
+		out := make([]float64, len(docs))
+		for i, d := range docs {
+			out[i] = scores[d.title]
+		}
+		return out, nil
+	}
+}
+
+func TestRerank(t *testing.T) {
+	candidates := func() ([]*pb.Product, []*pb.SearchDebug_ResultScores) {
+		var products []*pb.Product
+		var scores []*pb.SearchDebug_ResultScores
+		for _, name := range []string{"a", "b", "c", "d"} {
+			products = append(products, &pb.Product{Id: name, Name: name})
+			scores = append(scores, &pb.SearchDebug_ResultScores{ProductId: name})
+		}
+		return products, scores
+	}
+	ids := func(products []*pb.Product) string {
+		var out []string
+		for _, p := range products {
+			out = append(out, p.Id)
+		}
+		return strings.Join(out, ",")
+	}
+
+	s := rerankSettings{ranker: rerankByTitle(map[string]float64{"a": 0.1, "b": 0.7, "c": 0.9, "d": 0.4})}
+	products, scores := candidates()
+	products, scores = s.rerank(context.Background(), "q", products, scores, 3, newSearchLog(&pb.SemanticSearchRequest{}))
+	if got := ids(products); got != "c,b,d" {
+		t.Errorf("got %s, want c,b,d", got)
+	}
+	if len(scores) != 3 || scores[0].ProductId != "c" || scores[0].GetRerankScore() != 0.9 {
+		t.Errorf("got scores %v", scores)
+	}
+
+	products, _ = candidates()
+	products, scores = s.rerank(context.Background(), "q", products, nil, 2, newSearchLog(&pb.SemanticSearchRequest{}))
+	if got := ids(products); got != "c,b" || scores != nil {
+		t.Errorf("without debug scores: got %s and %v", got, scores)
+	}
+
+	for name, ranker := range map[string]reranker{
+		"error": rerankFunc(func(context.Context, string, []rerankDocument) ([]float64, error) {
+			return nil, errors.New("unavailable")
+		}),
+		"short answer": rerankFunc(func(context.Context, string, []rerankDocument) ([]float64, error) {
+			return []float64{1}, nil
+		}),
+	} {
+		products, scores := candidates()
+		sl := newSearchLog(&pb.SemanticSearchRequest{})
+		products, scores = rerankSettings{ranker: ranker}.rerank(context.Background(), "q", products, scores, 3, sl)
+		if got := ids(products); got != "a,b,c" || len(scores) != 3 {
+			t.Errorf("%s: got %s, want the vector order", name, got)
+		}
+		if sl.fields["rerank_error"] == nil {
+			t.Errorf("%s: the failure was not logged", name)
+		}
+	}
+}
+
+func TestRerankAppliesToRelevanceOrder(t *testing.T) {
+	s := rerankSettings{ranker: rerankByTitle(nil)}
+	if !s.appliesTo(&pb.SemanticSearchRequest{}) {
+		t.Error("relevance order is not reranked")
+	}
+	if s.appliesTo(&pb.SemanticSearchRequest{SortBy: pb.SemanticSearchRequest_PRICE_ASC}) {
+		t.Error("price order is reranked")
+	}
+	if (rerankSettings{}).appliesTo(&pb.SemanticSearchRequest{}) {
+		t.Error("reranking without a ranker")
+	}
+}
+
+func TestVertexReranker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model   string `json:"model"`
+			Query   string `json:"query"`
+			Records []struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+			} `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		if req.Model != "ranker" || req.Query != "blue mug" || len(req.Records) != 3 || req.Records[1].Title != "Mug" {
+			t.Errorf("got request %+v", req)
+		}
+		// The API returns records by descending score and may leave some
+		// out.
+		w.Write([]byte(`{"records": [{"id": "1", "score": 0.98}, {"id": "0", "score": 0.2}]}`))
+	}))
+	defer srv.Close()
+
+	v := &vertexReranker{api: &googleAPI{name: "ranking", client: srv.Client()}, url: srv.URL, model: "ranker"}
+	scores, err := v.rank(context.Background(), "blue mug", []rerankDocument{
+		{title: "Sunglasses"}, {title: "Mug"}, {title: "Jar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 3 || scores[0] != 0.2 || scores[1] != 0.98 || scores[2] >= 0 {
+		t.Errorf("got scores %v", scores)
+	}
+}
+
+func TestVertexRerankerErrors(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"status": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "quota", http.StatusTooManyRequests)
+		},
+		"unknown record": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"records": [{"id": "7", "score": 0.5}]}`))
+		},
+	} {
+		srv := httptest.NewServer(handler)
+		v := &vertexReranker{api: &googleAPI{name: "ranking", client: srv.Client()}, url: srv.URL}
+		if _, err := v.rank(context.Background(), "q", []rerankDocument{{title: "Mug"}}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// maxCosineDistance is the largest possible cosine distance, and so the
+// largest weighted score a product can get.
+const maxCosineDistance = 2
+
+// maxSearchDistance is the weighted cosine distance above which semantic
+// search leaves products out of its results. 0 disables the cutoff.
+var maxSearchDistance float64
+
+// maxSearchDistanceFromEnv reads SEMANTIC_MAX_DISTANCE, a weighted cosine
+// distance between 0 and 2. Unset or 0 disables the cutoff.
+func maxSearchDistanceFromEnv() (float64, error) {
+	s := os.Getenv("SEMANTIC_MAX_DISTANCE")
+	if s == "" {
+		return 0, nil
+	}
+	d, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(d >= 0 && d <= maxCosineDistance) {
+		return 0, fmt.Errorf("failed to parse SEMANTIC_MAX_DISTANCE (%s) as a number between 0 and %d", s, maxCosineDistance)
+	}
+	return d, nil
+}
+
+// requestMaxDistance returns the cutoff override of req, or maxSearchDistance
+// when it has none.
+func requestMaxDistance(req *pb.SemanticSearchRequest) (float64, error) {
+	if req.MaxDistance == nil {
+		return maxSearchDistance, nil
+	}
+	d := req.GetMaxDistance()
+	if !(d >= 0 && d <= maxCosineDistance) {
+		return 0, fmt.Errorf("max distance %v is outside [0, %d]", d, maxCosineDistance)
+	}
+	return d, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMaxSearchDistanceFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		env     string
+		want    float64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0.45", 0.45, false},
+		{"-0.1", 0, true},
+		{"3", 0, true},
+		{"close", 0, true},
+		{"NaN", 0, true},
+	} {
+		t.Setenv("SEMANTIC_MAX_DISTANCE", tc.env)
+		got, err := maxSearchDistanceFromEnv()
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("SEMANTIC_MAX_DISTANCE=%q: got %v, %v; want %v, error %v", tc.env, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestRequestMaxDistance(t *testing.T) {
+	defer func(d float64) { maxSearchDistance = d }(maxSearchDistance)
+	maxSearchDistance = 0.5
+
+	for _, tc := range []struct {
+		override *float64
+		want     float64
+		wantErr  bool
+	}{
+		{nil, 0.5, false},
+		{proto.Float64(0.3), 0.3, false},
+		{proto.Float64(0), 0, false},
+		{proto.Float64(-1), 0, true},
+		{proto.Float64(math.NaN()), 0, true},
+		{proto.Float64(math.Inf(1)), 0, true},
+	} {
+		got, err := requestMaxDistance(&pb.SemanticSearchRequest{MaxDistance: tc.override})
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("override %v: got %v, %v; want %v, error %v", tc.override, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// searchEventTopProducts is how many of the leading results an event
+	// records.
+	searchEventTopProducts = 10
+	// searchEventBatchSize bounds the events written in one insert.
+	searchEventBatchSize = 100
+)
+
+// searchEventsSchemaSQL creates the table of search analytics events, one
+// per SemanticSearchProducts call.
+const searchEventsSchemaSQL = `
+	CREATE TABLE IF NOT EXISTS search_events (
+		search_id TEXT PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL,
+		query TEXT NOT NULL,
+		processed_query TEXT NOT NULL,
+		user_id TEXT,
+		status TEXT NOT NULL,
+		result_count INTEGER NOT NULL,
+		top_product_ids TEXT[] NOT NULL,
+		latency_ms INTEGER NOT NULL,
+		fallback TEXT
+	);
+	ALTER TABLE search_events ADD COLUMN IF NOT EXISTS experiment_variant TEXT;
+	CREATE INDEX IF NOT EXISTS search_events_created_at ON search_events (created_at);`
+
+// searchEventsReady is set once searchEventsSchemaSQL has been applied.
+var searchEventsReady atomic.Bool
+
+// ensureSearchEventsSchema applies searchEventsSchemaSQL.
+func ensureSearchEventsSchema(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, searchEventsSchemaSQL); err != nil {
+		return fmt.Errorf("failed to create search_events: %v", err)
+	}
+	searchEventsReady.Store(true)
+	return nil
+}
+
+// searchEvent describes one semantic search for analytics.
+type searchEvent struct {
+	id             string
+	at             time.Time
+	query          string
+	processedQuery string
+	userID         string
+	status         string
+	resultCount    int
+	topProductIDs  []string
+	latency        time.Duration
+	// fallback is why keyword search served the request, or "".
+	fallback string
+	// variant is the ranking experiment variant of the request, or "".
+	variant string
+}
+
+// newSearchEvent describes a finished request: resp and err are what
+// SemanticSearchProducts returns.
+func newSearchEvent(id string, req *pb.SemanticSearchRequest, processedQuery string, resp *pb.SearchProductsResponse, err error, sl *searchLog) searchEvent {
+	e := searchEvent{
+		id:             id,
+		at:             sl.start,
+		query:          req.GetQuery(),
+		processedQuery: processedQuery,
+		userID:         req.GetUserId(),
+		status:         status.Code(err).String(),
+		topProductIDs:  []string{},
+		latency:        time.Since(sl.start),
+		fallback:       sl.fallback,
+	}
+	for i, product := range resp.GetResults() {
+		if i < searchEventTopProducts {
+			e.topProductIDs = append(e.topProductIDs, product.Id)
+		}
+		e.resultCount++
+	}
+	return e
+}
+
+// newSearchID returns a random identifier for a search.
+func newSearchID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// searchEventSink writes search events to the search_events table in the
+// background, so recording them never slows a search down. Events that find
+// the buffer full, or arrive while the database is unavailable, are dropped
+// and counted.
+type searchEventSink struct {
+	events  chan searchEvent
+	dropped atomic.Int64
+}
+
+func (s *searchEventSink) String() string {
+	if s == nil {
+		return "disabled"
+	}
+	return fmt.Sprintf("search_events table, buffer=%d", cap(s.events))
+}
+
+// searchEvents is the sink in effect, set from the environment at startup;
+// nil disables search events.
+var searchEvents *searchEventSink
+
+// searchEventsFromEnv builds the sink from the environment:
+//
+//	SEARCH_EVENTS         1 records an event per semantic search (default off)
+//	SEARCH_EVENTS_BUFFER  events queued for writing before new ones are dropped (default 1000)
+func searchEventsFromEnv() (*searchEventSink, error) {
+	if os.Getenv("SEARCH_EVENTS") != "1" {
+		return nil, nil
+	}
+	buffer := 1000
+	if s := os.Getenv("SEARCH_EVENTS_BUFFER"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("failed to parse SEARCH_EVENTS_BUFFER (%s) as a positive integer", s)
+		}
+		buffer = v
+	}
+	return &searchEventSink{events: make(chan searchEvent, buffer)}, nil
+}
+
+// emit queues e for writing without blocking. It does nothing on a nil sink.
+func (s *searchEventSink) emit(e searchEvent) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.events <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run writes queued events until ctx is done, batching those that queue up
+// while an insert is in flight.
+func (s *searchEventSink) run(ctx context.Context) {
+	for {
+		var batch []searchEvent
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-s.events:
+			batch = append(batch, e)
+		}
+	drain:
+		for len(batch) < searchEventBatchSize {
+			select {
+			case e := <-s.events:
+				batch = append(batch, e)
+			default:
+				break drain
+			}
+		}
+		if !dbReady.Load() || !searchEventsReady.Load() {
+			s.dropped.Add(int64(len(batch)))
+			continue
+		}
+		if err := writeSearchEvents(ctx, batch); err != nil {
+			log.Warnf("Failed to write %d search events: %v", len(batch), err)
+		}
+		if n := s.dropped.Swap(0); n > 0 {
+			log.Warnf("Dropped %d search events", n)
+		}
+	}
+}
+
+// writeSearchEvents inserts events in one statement.
+func writeSearchEvents(ctx context.Context, events []searchEvent) error {
+	const columns = 11
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*columns)
+	for i, e := range events {
+		n := i * columns
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, NULLIF($%d, ''), $%d, $%d, $%d, $%d, NULLIF($%d, ''), NULLIF($%d, ''))",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11))
+		args = append(args, e.id, e.at, e.query, e.processedQuery, e.userID, e.status,
+			e.resultCount, e.topProductIDs, e.latency.Milliseconds(), e.fallback, e.variant)
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO search_events (search_id, created_at, query, processed_query, user_id,
+			status, result_count, top_product_ids, latency_ms, fallback, experiment_variant)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT (search_id) DO NOTHING`, args...)
+	return err
+}
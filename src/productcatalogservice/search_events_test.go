@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestSearchEventsFromEnv(t *testing.T) {
+	t.Setenv("SEARCH_EVENTS", "")
+	if s, err := searchEventsFromEnv(); s != nil || err != nil {
+		t.Errorf("default: got %v, %v; want disabled", s, err)
+	}
+	t.Setenv("SEARCH_EVENTS", "1")
+	s, err := searchEventsFromEnv()
+	if err != nil || cap(s.events) != 1000 {
+		t.Errorf("got %v, %v; want a buffer of 1000", s, err)
+	}
+	t.Setenv("SEARCH_EVENTS_BUFFER", "0")
+	if _, err := searchEventsFromEnv(); err == nil {
+		t.Error("expected an error for a zero buffer")
+	}
+}
+
+func TestSearchEventSinkDropsWhenFull(t *testing.T) {
+	var disabled *searchEventSink
+	disabled.emit(searchEvent{}) // no-op
+
+	s := &searchEventSink{events: make(chan searchEvent, 1)}
+	s.emit(searchEvent{id: "a"})
+	s.emit(searchEvent{id: "b"})
+	if got := s.dropped.Load(); got != 1 {
+		t.Errorf("dropped %d events, want 1", got)
+	}
+}
+
+func TestSemanticSearchEmitsEvents(t *testing.T) {
+	defer func(s *searchEventSink) { searchEvents = s }(searchEvents)
+	searchEvents = &searchEventSink{events: make(chan searchEvent, 10)}
+
+	resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "Alpha", UserId: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := <-searchEvents.events
+	if e.id == "" || e.id != resp.SearchId {
+		t.Errorf("event ID %q, response search ID %q; want the same", e.id, resp.SearchId)
+	}
+	if e.query != "Alpha" || e.userID != "u1" || e.status != "OK" || e.fallback != fallbackDatabaseUnavailable {
+		t.Errorf("got event %+v", e)
+	}
+	if e.resultCount != 2 || len(e.topProductIDs) != 2 || e.topProductIDs[0] != resp.Results[0].Id {
+		t.Errorf("got %d results, top %v; want 2 results, %s first", e.resultCount, e.topProductIDs, resp.Results[0].Id)
+	}
+
+	// Failed requests are recorded too.
+	_, err = mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "Alpha", Weights: &pb.HybridSearchWeights{Combined: -1}})
+	if err == nil {
+		t.Fatal("expected an error for negative weights")
+	}
+	if e := <-searchEvents.events; e.status != "InvalidArgument" || e.resultCount != 0 {
+		t.Errorf("got event %+v for a failed request", e)
+	}
+}
+
+func TestSearchEventSinkDropsWithoutDatabase(t *testing.T) {
+	s := &searchEventSink{events: make(chan searchEvent, 10)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.run(ctx)
+
+	s.emit(searchEvent{id: "a"})
+	deadline := time.Now().Add(time.Second)
+	for s.dropped.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("event was not dropped while the database is unavailable")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
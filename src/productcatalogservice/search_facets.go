@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// facetPool is the least number of relevant products semantic search counts
+// facets over, so the counts do not depend on the page size.
+const facetPool = 100
+
+// priceBucketBounds are the lower bounds, in whole USD, of the facet price
+// ranges. The last range has no upper bound.
+var priceBucketBounds = []int64{0, 10, 25, 50, 100}
+
+// facetPoolSize returns how many relevant products the semantic search query
+// has to rank for req: limit, or the facet pool if facets were asked for.
+func facetPoolSize(req *pb.SemanticSearchRequest, limit int32) int32 {
+	if !req.GetIncludeFacets() {
+		return limit
+	}
+	return max(limit, facetPool)
+}
+
+// computeFacets counts the categories, target tags and price ranges of
+// products. Terms are compared lowercased and trimmed.
+func computeFacets(products []*pb.Product) *pb.SearchFacets {
+	categories := map[string]int32{}
+	targetTags := map[string]int32{}
+	buckets := make([]int32, len(priceBucketBounds))
+	for _, p := range products {
+		countTerms(categories, p.Categories)
+		countTerms(targetTags, p.TargetTags)
+		i := sort.Search(len(priceBucketBounds), func(i int) bool {
+			return priceBucketBounds[i]*nanosPerUnit > priceNanos(p)
+		})
+		buckets[max(i-1, 0)]++
+	}
+
+	facets := &pb.SearchFacets{
+		Categories: sortedFacetCounts(categories),
+		TargetTags: sortedFacetCounts(targetTags),
+	}
+	for i, lower := range priceBucketBounds {
+		bucket := &pb.PriceBucketCount{Min: &pb.Money{CurrencyCode: "USD", Units: lower}, Count: buckets[i]}
+		if i+1 < len(priceBucketBounds) {
+			bucket.Max = &pb.Money{CurrencyCode: "USD", Units: priceBucketBounds[i+1]}
+		}
+		facets.PriceBuckets = append(facets.PriceBuckets, bucket)
+	}
+	return facets
+}
+
+// countTerms adds each distinct term of terms to counts once.
+func countTerms(counts map[string]int32, terms []string) {
+	seen := map[string]bool{}
+	for _, t := range terms {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			counts[t]++
+		}
+	}
+}
+
+// sortedFacetCounts orders counts most common first, then by value.
+func sortedFacetCounts(counts map[string]int32) []*pb.FacetCount {
+	facets := make([]*pb.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, &pb.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	return facets
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestComputeFacets(t *testing.T) {
+	usd := func(units int64, nanos int32) *pb.Money {
+		return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+	}
+	facets := computeFacets([]*pb.Product{
+		{Categories: []string{"kitchen", "home"}, TargetTags: []string{"cook"}, PriceUsd: usd(9, 990000000)},
+		{Categories: []string{"Kitchen", " kitchen"}, PriceUsd: usd(10, 0)},
+		{Categories: []string{"decor"}, TargetTags: []string{"Cook", "host"}, PriceUsd: usd(250, 0)},
+	})
+
+	format := func(counts []*pb.FacetCount) string {
+		var s []string
+		for _, c := range counts {
+			s = append(s, fmt.Sprintf("%s=%d", c.Value, c.Count))
+		}
+		return fmt.Sprint(s)
+	}
+	if got, want := format(facets.Categories), "[kitchen=2 decor=1 home=1]"; got != want {
+		t.Errorf("categories = %s, want %s", got, want)
+	}
+	if got, want := format(facets.TargetTags), "[cook=2 host=1]"; got != want {
+		t.Errorf("target tags = %s, want %s", got, want)
+	}
+
+	var buckets []string
+	for _, b := range facets.PriceBuckets {
+		buckets = append(buckets, fmt.Sprintf("%d-%d:%d", b.Min.GetUnits(), b.Max.GetUnits(), b.Count))
+	}
+	if got, want := fmt.Sprint(buckets), "[0-10:1 10-25:1 25-50:0 50-100:0 100-0:1]"; got != want {
+		t.Errorf("price buckets = %s, want %s", got, want)
+	}
+	if facets.PriceBuckets[len(facets.PriceBuckets)-1].Max != nil {
+		t.Error("the most expensive range has an upper bound")
+	}
+}
+
+func TestFacetPoolSize(t *testing.T) {
+	if got := facetPoolSize(&pb.SemanticSearchRequest{}, 10); got != 10 {
+		t.Errorf("without facets: pool %d, want the limit", got)
+	}
+	if got := facetPoolSize(&pb.SemanticSearchRequest{IncludeFacets: true}, 10); got != facetPool {
+		t.Errorf("with facets: pool %d, want %d", got, facetPool)
+	}
+	if got := facetPoolSize(&pb.SemanticSearchRequest{IncludeFacets: true}, 200); got != 200 {
+		t.Errorf("with facets and a large limit: pool %d, want the limit", got)
+	}
+}
+
+func TestKeywordFallbackFacets(t *testing.T) {
+	dbReady.Store(false)
+	resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "alpha", IncludeFacets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counted int32
+	for _, b := range resp.GetFacets().GetPriceBuckets() {
+		counted += b.Count
+	}
+	if counted != int32(len(resp.Results)) {
+		t.Errorf("price buckets count %d products, want the %d keyword results", counted, len(resp.Results))
+	}
+}
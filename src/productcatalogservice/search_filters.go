@@ -0,0 +1,162 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const nanosPerUnit = 1_000_000_000
+
+// searchFilters are the structured filters of a SemanticSearchRequest.
+// Categories and target tags are lowercased, and categories include their
+// subcategories; prices are in USD nanos. Only active products pass unless
+// includeInactive is set, and only those in stock with inStockOnly.
+type searchFilters struct {
+	categories      []string
+	targetTags      []string
+	minNanos        *int64
+	maxNanos        *int64
+	includeInactive bool
+	inStockOnly     bool
+}
+
+// parseSearchFilters validates and normalizes the filters of req.
+func parseSearchFilters(req *pb.SemanticSearchRequest) (*searchFilters, error) {
+	f := &searchFilters{
+		categories:      currentCategories().expand(normalizeTerms(req.GetCategories())),
+		targetTags:      normalizeTerms(req.GetTargetTags()),
+		includeInactive: req.GetIncludeInactive(),
+		inStockOnly:     req.GetInStockOnly(),
+	}
+	var err error
+	if f.minNanos, err = priceBound("min_price_usd", req.GetMinPriceUsd()); err != nil {
+		return nil, err
+	}
+	if f.maxNanos, err = priceBound("max_price_usd", req.GetMaxPriceUsd()); err != nil {
+		return nil, err
+	}
+	if f.minNanos != nil && f.maxNanos != nil && *f.minNanos > *f.maxNanos {
+		return nil, fmt.Errorf("min_price_usd is greater than max_price_usd")
+	}
+	return f, nil
+}
+
+// productCategoriesSQL is the categories of product p normalized like
+// filter terms, for comparing with them.
+const productCategoriesSQL = "ARRAY(SELECT lower(trim(c)) FROM unnest(string_to_array(trim(both '{}' from p.categories), ',')) c)"
+
+// splitCategories splits a categories column value into categories
+// normalized like filter terms. Products read by any search path carry them
+// this way, so a category filter matches the same on each.
+func splitCategories(s string) []string { return normalizeTerms(splitPostgresList(s)) }
+
+// normalizeTerms lowercases terms and drops blanks.
+func normalizeTerms(terms []string) []string {
+	var out []string
+	for _, t := range terms {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// priceBound converts m to nanos. A nil m means the bound is not set.
+func priceBound(field string, m *pb.Money) (*int64, error) {
+	if m == nil {
+		return nil, nil
+	}
+	if m.CurrencyCode != "" && m.CurrencyCode != "USD" {
+		return nil, fmt.Errorf("%s must be in USD, got %s", field, m.CurrencyCode)
+	}
+	if m.Nanos <= -nanosPerUnit || m.Nanos >= nanosPerUnit ||
+		(m.Units > 0 && m.Nanos < 0) || (m.Units < 0 && m.Nanos > 0) {
+		return nil, fmt.Errorf("%s is not a valid amount", field)
+	}
+	n := m.Units*nanosPerUnit + int64(m.Nanos)
+	return &n, nil
+}
+
+// where appends SQL conditions for the filters to the products query.
+// Placeholders are numbered after the len(args) parameters already bound.
+func (f *searchFilters) where(args []interface{}) (string, []interface{}) {
+	var b strings.Builder
+	param := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if !f.includeInactive {
+		b.WriteString(activeProductSQL)
+	}
+	if f.inStockOnly {
+		b.WriteString(" AND " + inStockSQL)
+	}
+	if len(f.categories) > 0 {
+		fmt.Fprintf(&b, " AND %s && %s::text[]", productCategoriesSQL, param(f.categories))
+	}
+	if len(f.targetTags) > 0 {
+		fmt.Fprintf(&b, " AND ARRAY(SELECT lower(t) FROM unnest(p.target_tags) t) && %s::text[]", param(f.targetTags))
+	}
+	const priceNanosSQL = "(p.price_usd_units::bigint * 1000000000 + p.price_usd_nanos)"
+	if f.minNanos != nil {
+		fmt.Fprintf(&b, " AND %s >= %s", priceNanosSQL, param(*f.minNanos))
+	}
+	if f.maxNanos != nil {
+		fmt.Fprintf(&b, " AND %s <= %s", priceNanosSQL, param(*f.maxNanos))
+	}
+	return b.String(), args
+}
+
+// match reports whether p passes the filters. It is used for results that
+// do not come from the database query, such as the keyword fallback.
+func (f *searchFilters) match(p *pb.Product) bool {
+	if !f.includeInactive && p.Status != pb.Product_ACTIVE {
+		return false
+	}
+	if f.inStockOnly && !inStock(p) {
+		return false
+	}
+	if len(f.categories) > 0 && !anyTermIn(f.categories, p.Categories) {
+		return false
+	}
+	if len(f.targetTags) > 0 && !anyTermIn(f.targetTags, p.TargetTags) {
+		return false
+	}
+	price := priceNanos(p)
+	if f.minNanos != nil && price < *f.minNanos {
+		return false
+	}
+	if f.maxNanos != nil && price > *f.maxNanos {
+		return false
+	}
+	return true
+}
+
+// anyTermIn reports whether any of the lowercased terms is in values.
+func anyTermIn(terms, values []string) bool {
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		for _, t := range terms {
+			if v == t {
+				return true
+			}
+		}
+	}
+	return false
+}
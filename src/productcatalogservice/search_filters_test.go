@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestParseSearchFilters(t *testing.T) {
+	f, err := parseSearchFilters(&pb.SemanticSearchRequest{
+		Categories:  []string{" Kitchen", ""},
+		TargetTags:  []string{"Gift"},
+		MinPriceUsd: &pb.Money{CurrencyCode: "USD", Units: 10},
+		MaxPriceUsd: &pb.Money{Units: 20, Nanos: 500_000_000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f.categories, []string{"kitchen"}) || !reflect.DeepEqual(f.targetTags, []string{"gift"}) {
+		t.Errorf("terms = %v / %v", f.categories, f.targetTags)
+	}
+	if *f.minNanos != 10_000_000_000 || *f.maxNanos != 20_500_000_000 {
+		t.Errorf("price bounds = %d..%d", *f.minNanos, *f.maxNanos)
+	}
+
+	for name, req := range map[string]*pb.SemanticSearchRequest{
+		"currency":     {MinPriceUsd: &pb.Money{CurrencyCode: "EUR", Units: 1}},
+		"nanos sign":   {MaxPriceUsd: &pb.Money{Units: 1, Nanos: -1}},
+		"min over max": {MinPriceUsd: &pb.Money{Units: 5}, MaxPriceUsd: &pb.Money{Units: 4}},
+	} {
+		if _, err := parseSearchFilters(req); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSearchFiltersWhere(t *testing.T) {
+	f, err := parseSearchFilters(&pb.SemanticSearchRequest{
+		Categories:  []string{"kitchen"},
+		MaxPriceUsd: &pb.Money{Units: 20},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := f.where([]interface{}{"embedding", 10})
+	want := " AND p.status = 'active'" +
+		" AND ARRAY(SELECT lower(trim(c)) FROM unnest(string_to_array(trim(both '{}' from p.categories), ',')) c) && $3::text[]" +
+		" AND (p.price_usd_units::bigint * 1000000000 + p.price_usd_nanos) <= $4"
+	if sql != want {
+		t.Errorf("where =\n%s\nwant\n%s", sql, want)
+	}
+	if len(args) != 4 || args[3] != int64(20_000_000_000) {
+		t.Errorf("args = %v", args)
+	}
+
+	if sql, args := (&searchFilters{}).where(nil); sql != activeProductSQL || len(args) != 0 {
+		t.Errorf("empty filters produced %q %v", sql, args)
+	}
+	if sql, _ := (&searchFilters{includeInactive: true}).where(nil); sql != "" {
+		t.Errorf("include_inactive produced %q", sql)
+	}
+}
+
+func TestSearchFiltersMatch(t *testing.T) {
+	mug := &pb.Product{Categories: []string{"kitchen"}, PriceUsd: &pb.Money{Units: 8, Nanos: 990_000_000}}
+	floor := int64(9_000_000_000)
+
+	if !(&searchFilters{categories: []string{"kitchen"}}).match(mug) {
+		t.Error("expected category match")
+	}
+	if (&searchFilters{categories: []string{"footwear"}}).match(mug) {
+		t.Error("expected category mismatch")
+	}
+	if (&searchFilters{minNanos: &floor}).match(mug) {
+		t.Error("expected product below min price to be filtered out")
+	}
+	if (&searchFilters{targetTags: []string{"gift"}}).match(mug) {
+		t.Error("expected product without target tags to be filtered out")
+	}
+}
+
+func TestSplitCategoriesMatchesFilterTerms(t *testing.T) {
+	got := splitCategories("{Kitchen, Home Decor,,}")
+	if !reflect.DeepEqual(got, []string{"kitchen", "home decor"}) {
+		t.Errorf("splitCategories = %q, want lowercased, trimmed categories", got)
+	}
+	f, err := parseSearchFilters(&pb.SemanticSearchRequest{Categories: []string{" HOME DECOR"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.match(&pb.Product{Status: pb.Product_ACTIVE, Categories: got}) {
+		t.Errorf("filter %v does not match categories %q", f.categories, got)
+	}
+	if splitCategories("") != nil {
+		t.Error("Expected no categories for an empty column")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const (
+	// fusionOff ranks by embedding distance only.
+	fusionOff = "off"
+	// fusionRRF fuses the vector and full-text rankings by reciprocal rank.
+	fusionRRF = "rrf"
+	// fusionWeighted fuses the vector and full-text scores by weight.
+	fusionWeighted = "weighted"
+
+	// fusionCandidates is how many products each ranking contributes at
+	// least; requests with a larger limit contribute that many.
+	fusionCandidates = 50
+)
+
+// keywordFusion decides whether semantic search also runs a full-text query
+// and how it combines the two rankings, so that exact keyword matches such as
+// product names are not buried by semantic neighbors.
+type keywordFusion struct {
+	mode string
+	// rrfK damps the weight of top ranks under fusionRRF.
+	rrfK int
+	// keywordWeight is the share of the full-text score under fusionWeighted.
+	keywordWeight float64
+}
+
+func (f keywordFusion) String() string {
+	switch f.mode {
+	case fusionRRF:
+		return fmt.Sprintf("%s (k=%d)", f.mode, f.rrfK)
+	case fusionWeighted:
+		return fmt.Sprintf("%s (keyword weight %v)", f.mode, f.keywordWeight)
+	default:
+		return f.mode
+	}
+}
+
+// searchFusion is the fusion in effect, set from the environment at startup.
+var searchFusion = keywordFusion{mode: fusionOff, rrfK: 60, keywordWeight: 0.3}
+
+// keywordFusionFromEnv builds a keywordFusion from the environment:
+//
+//	SEMANTIC_KEYWORD_FUSION   off (default), rrf or weighted
+//	SEMANTIC_RRF_K            reciprocal rank fusion constant (default 60)
+//	SEMANTIC_KEYWORD_WEIGHT   full-text share of the weighted score, 0 to 1 (default 0.3)
+func keywordFusionFromEnv() (keywordFusion, error) {
+	f := searchFusion
+	if s := os.Getenv("SEMANTIC_KEYWORD_FUSION"); s != "" {
+		switch s {
+		case fusionOff, fusionRRF, fusionWeighted:
+			f.mode = s
+		default:
+			return keywordFusion{}, fmt.Errorf("unknown SEMANTIC_KEYWORD_FUSION %q (want off, rrf or weighted)", s)
+		}
+	}
+	if s := os.Getenv("SEMANTIC_RRF_K"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 {
+			return keywordFusion{}, fmt.Errorf("failed to parse SEMANTIC_RRF_K (%s) as a positive integer", s)
+		}
+		f.rrfK = v
+	}
+	if s := os.Getenv("SEMANTIC_KEYWORD_WEIGHT"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 || v > 1 {
+			return keywordFusion{}, fmt.Errorf("failed to parse SEMANTIC_KEYWORD_WEIGHT (%s) as a number between 0 and 1", s)
+		}
+		f.keywordWeight = v
+	}
+	return f, nil
+}
+
+// enabled reports whether semantic search runs the full-text query.
+func (f keywordFusion) enabled() bool {
+	return f.mode == fusionRRF || f.mode == fusionWeighted
+}
+
+// query returns the fused semantic search query. The vector ranking orders
+// by ranking.score. from and vectorFilterSQL select the vector candidates, as
+// vectorIndexSettings.candidateSource returns them; filterSQL restricts the
+// full-text matches. args holds the arguments of all four, after the six of
+// the plain semantic search query; the full-text query, the candidate depth
+// and the fusion parameter are appended to it.
+//
+// Each ranking contributes its top candidates, vector ones past the distance
+// cutoff excluded, and products are ordered by fused score, so a product may
+// come from either ranking or both. similarity_score is the negated fused
+// score, keeping lower is better for sortOrderSQL.
+func (f keywordFusion) query(text string, limit int32, order pb.SemanticSearchRequest_SortOrder,
+	ranking productRanking, from, vectorFilterSQL, filterSQL string, args []interface{}) (string, []interface{}) {
+	args = append(args, text, max(int(limit), fusionCandidates))
+	textArg, depthArg := len(args)-1, len(args)
+
+	// scale maps the span of the weighted distance, 2, to that of the fused
+	// score: 2 / (k + 1) under fusionRRF and 1 under fusionWeighted.
+	var fused, scale string
+	if f.mode == fusionRRF {
+		args = append(args, f.rrfK)
+		fused = fmt.Sprintf(`COALESCE(1.0 / ($%[1]d + v.rank), 0) + COALESCE(1.0 / ($%[1]d + k.rank), 0)`, len(args))
+		scale = fmt.Sprintf(`(1.0 / ($%d + 1))::float8`, len(args))
+	} else {
+		args = append(args, f.keywordWeight)
+		fused = fmt.Sprintf(`(1 - $%[1]d::float8) * COALESCE(1 - v.score / 2, 0) + $%[1]d::float8 * COALESCE(k.text_score, 0)`, len(args))
+		scale = "0.5"
+	}
+
+	// The out-of-stock penalty and campaign boosts move keyword matches
+	// too, not only the vector candidates ranked by ranking.score. They are
+	// scaled with the fused score so they weigh as much against relevance
+	// as they do in the plain vector ranking.
+	var penalty string
+	if ranking.penalty != "" {
+		penalty = fmt.Sprintf(" + %s * %s", scale, ranking.penalty)
+	}
+
+	query := fmt.Sprintf(`
+		WITH vector AS (
+			SELECT p.id, %[1]s AS distance, %[11]s AS score
+			FROM %[2]s%[14]s
+			WHERE p.combined_embedding IS NOT NULL%[3]s
+			ORDER BY score
+			LIMIT $%[6]d
+		), vector_ranked AS (
+			SELECT id, score, row_number() OVER (ORDER BY score) AS rank
+			FROM vector
+			WHERE $6::float8 <= 0 OR distance <= $6::float8
+		), keyword AS (
+			SELECT p.id, ts_rank_cd(p.search_tsv, q, 32) AS text_score,
+				   row_number() OVER (ORDER BY ts_rank_cd(p.search_tsv, q, 32) DESC) AS rank
+			FROM `+productsTable+` p, websearch_to_tsquery('english', $%[5]d) q
+			WHERE p.search_tsv @@ q%[4]s
+			ORDER BY text_score DESC
+			LIMIT $%[6]d
+		)
+		SELECT %[9]s
+		FROM (
+			SELECT p.id, p.name, p.description, p.picture, p.price_usd_currency_code,
+				   p.price_usd_units, p.price_usd_nanos, p.categories, p.target_tags, p.use_context,
+				   p.status, p.stock, p.created_at, -(%[7]s)%[13]s AS similarity_score,
+				   %[10]s, k.text_score AS keyword_score, %[12]s AS popularity
+			FROM vector_ranked v
+			FULL JOIN keyword k ON k.id = v.id
+			JOIN `+productsTable+` p ON p.id = COALESCE(v.id, k.id)%[14]s
+			ORDER BY similarity_score
+			LIMIT $2
+		) ranked
+		ORDER BY %[8]s`,
+		weightedDistanceSQL, from, vectorFilterSQL, filterSQL, textArg, depthArg, fused, sortOrderSQL(order),
+		resultColumnsSQL, scoreColumnsSQL, ranking.score, ranking.popularity, penalty, ranking.join)
+	return query, args
+}
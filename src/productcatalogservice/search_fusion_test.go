@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestKeywordFusionFromEnv(t *testing.T) {
+	t.Setenv("SEMANTIC_KEYWORD_FUSION", "weighted")
+	t.Setenv("SEMANTIC_KEYWORD_WEIGHT", "0.5")
+	t.Setenv("SEMANTIC_RRF_K", "20")
+	got, err := keywordFusionFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (keywordFusion{mode: fusionWeighted, rrfK: 20, keywordWeight: 0.5}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for env, value := range map[string]string{
+		"SEMANTIC_KEYWORD_FUSION": "bm25",
+		"SEMANTIC_RRF_K":          "0",
+		"SEMANTIC_KEYWORD_WEIGHT": "1.5",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := keywordFusionFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestKeywordFusionQuery(t *testing.T) {
+	// The six plain semantic search arguments and one filter argument.
+	base := []interface{}{"vec", int32(10), 0.6, 0.2, 0.2, 0.0, "kitchen"}
+	filterSQL := " AND p.categories ILIKE $7"
+
+	for _, tc := range []struct {
+		fusion keywordFusion
+		want   []string
+		param  interface{}
+	}{
+		{keywordFusion{mode: fusionRRF, rrfK: 60}, []string{"1.0 / ($10 + v.rank)", "1.0 / ($10 + k.rank)"}, 60},
+		{keywordFusion{mode: fusionWeighted, keywordWeight: 0.3}, []string{"$10::float8 * COALESCE(k.text_score, 0)"}, 0.3},
+	} {
+		t.Run(tc.fusion.mode, func(t *testing.T) {
+			query, args := tc.fusion.query("red mug", 10, pb.SemanticSearchRequest_PRICE_ASC,
+				distanceRanking, "products p", filterSQL, filterSQL, append([]interface{}{}, base...))
+			if len(args) != 10 || args[7] != "red mug" || args[8] != fusionCandidates || args[9] != tc.param {
+				t.Fatalf("got args %v, want the text, depth %d and %v appended", args[7:], fusionCandidates, tc.param)
+			}
+			want := append([]string{
+				"websearch_to_tsquery('english', $8)",
+				"LIMIT $9",
+				"WHERE p.search_tsv @@ q" + filterSQL,
+				"WHERE p.combined_embedding IS NOT NULL" + filterSQL,
+				"ORDER BY " + sortOrderSQL(pb.SemanticSearchRequest_PRICE_ASC),
+			}, tc.want...)
+			for _, w := range want {
+				if !strings.Contains(query, w) {
+					t.Errorf("query does not contain %q:\n%s", w, query)
+				}
+			}
+		})
+	}
+}
+
+func TestKeywordFusionDepthCoversLimit(t *testing.T) {
+	f := keywordFusion{mode: fusionRRF, rrfK: 60}
+	_, args := f.query("mug", 200, pb.SemanticSearchRequest_RELEVANCE, distanceRanking, "products p", "", "", make([]interface{}, 6))
+	if args[7] != 200 {
+		t.Errorf("depth = %v, want the request limit of 200", args[7])
+	}
+}
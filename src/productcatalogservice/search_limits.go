@@ -0,0 +1,191 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// minRetryDelay is the shortest retry hint given to rejected searches, so
+// clients do not come straight back.
+const minRetryDelay = 100 * time.Millisecond
+
+// searchLimits protect the embedding service and Postgres from bursts of
+// semantic searches: a token bucket caps the rate of searches and a
+// semaphore how many run at once. Searches over either limit fail with
+// RESOURCE_EXHAUSTED and a RetryInfo detail saying when to retry. The zero
+// value limits nothing.
+type searchLimits struct {
+	// rate is nil without a rate limit.
+	rate *rate.Limiter
+	// slots holds a token per running search; nil without a cap.
+	slots chan struct{}
+	// queueTimeout is how long a search waits for a free slot.
+	queueTimeout time.Duration
+}
+
+func (l *searchLimits) String() string {
+	if l == nil {
+		return "off"
+	}
+	r, burst := "off", 0
+	if l.rate != nil {
+		r, burst = fmt.Sprintf("%g/s", float64(l.rate.Limit())), l.rate.Burst()
+	}
+	return fmt.Sprintf("rate %s, burst %d, max concurrent %d, queue timeout %v", r, burst, cap(l.slots), l.queueTimeout)
+}
+
+// searchLimit holds the limits in effect, set from the environment at
+// startup; nil limits nothing.
+var searchLimit *searchLimits
+
+// searchLimitsFromEnv builds searchLimits from the environment:
+//
+//	SEARCH_RATE_LIMIT      searches per second across all callers (default 0, unlimited)
+//	SEARCH_RATE_BURST      searches allowed at once above the rate (default the rate, rounded up)
+//	SEARCH_MAX_CONCURRENT  searches running at once (default 0, unlimited)
+//	SEARCH_QUEUE_TIMEOUT   how long a search waits for a running one to finish (default 100ms)
+//
+// It returns nil when neither limit is set.
+func searchLimitsFromEnv() (*searchLimits, error) {
+	var perSecond float64
+	if s := os.Getenv("SEARCH_RATE_LIMIT"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("SEARCH_RATE_LIMIT must be a non-negative number of searches per second, got %q", s)
+		}
+		perSecond = v
+	}
+	burst := int(math.Ceil(perSecond))
+	if s := os.Getenv("SEARCH_RATE_BURST"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("SEARCH_RATE_BURST must be a positive integer, got %q", s)
+		}
+		burst = v
+	}
+	var maxConcurrent int
+	if s := os.Getenv("SEARCH_MAX_CONCURRENT"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("SEARCH_MAX_CONCURRENT must be a non-negative integer, got %q", s)
+		}
+		maxConcurrent = v
+	}
+	queueTimeout := minRetryDelay
+	if s := os.Getenv("SEARCH_QUEUE_TIMEOUT"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("failed to parse SEARCH_QUEUE_TIMEOUT (%s) as a non-negative time.Duration", s)
+		}
+		queueTimeout = v
+	}
+
+	if perSecond == 0 && maxConcurrent == 0 {
+		return nil, nil
+	}
+	l := &searchLimits{queueTimeout: queueTimeout}
+	if perSecond > 0 {
+		l.rate = rate.NewLimiter(rate.Limit(perSecond), burst)
+	}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l, nil
+}
+
+// acquire admits a search, returning a release func to call when it is
+// done, or a RESOURCE_EXHAUSTED error when over a limit. A rate token is only
+// taken once the search has a slot, so rejected searches do not use one up.
+func (l *searchLimits) acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	// Searches that would be rejected for rate anyway do not queue.
+	if l.rate != nil && l.rate.Tokens() < 1 {
+		return nil, l.overRate()
+	}
+	release, err = l.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if l.rate != nil {
+		r := l.rate.Reserve()
+		if d := r.Delay(); d > 0 {
+			// Give the token back; the caller is told to retry instead.
+			r.Cancel()
+			release()
+			searchRejections.WithLabelValues("rate").Inc()
+			return nil, overLimit("semantic search rate limit exceeded", d)
+		}
+	}
+	return release, nil
+}
+
+// overRate is the rejection of a search over the rate limit, which leaves
+// the rate limit as it was.
+func (l *searchLimits) overRate() error {
+	r := l.rate.Reserve()
+	d := r.Delay()
+	r.Cancel()
+	searchRejections.WithLabelValues("rate").Inc()
+	return overLimit("semantic search rate limit exceeded", d)
+}
+
+// acquireSlot waits up to queueTimeout for a free slot when the number of
+// concurrent searches is capped.
+func (l *searchLimits) acquireSlot(ctx context.Context) (release func(), err error) {
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	default:
+	}
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-timer.C:
+		searchRejections.WithLabelValues("concurrency").Inc()
+		return nil, overLimit("too many concurrent semantic searches", l.queueTimeout)
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// overLimit is a RESOURCE_EXHAUSTED error asking the client to retry after
+// delay, or minRetryDelay if that is longer.
+func overLimit(msg string, delay time.Duration) error {
+	delay = max(delay, minRetryDelay)
+	st := status.Newf(codes.ResourceExhausted, "%s, retry after %v", msg, delay.Round(time.Millisecond))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSearchLimitsFromEnv(t *testing.T) {
+	l, err := searchLimitsFromEnv()
+	if err != nil || l != nil {
+		t.Fatalf("default = %v, %v; want no limits", l, err)
+	}
+
+	t.Setenv("SEARCH_RATE_LIMIT", "2.5")
+	t.Setenv("SEARCH_MAX_CONCURRENT", "8")
+	l, err = searchLimitsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.rate.Burst() != 3 || cap(l.slots) != 8 || l.queueTimeout != 100*time.Millisecond {
+		t.Errorf("got %s", l)
+	}
+
+	for env, bad := range map[string]string{
+		"SEARCH_RATE_LIMIT":     "-1",
+		"SEARCH_RATE_BURST":     "0",
+		"SEARCH_MAX_CONCURRENT": "many",
+		"SEARCH_QUEUE_TIMEOUT":  "-1s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, bad)
+			if _, err := searchLimitsFromEnv(); err == nil {
+				t.Errorf("expected an error for %s=%s", env, bad)
+			}
+		})
+	}
+}
+
+// retryDelay returns the RetryInfo delay of a RESOURCE_EXHAUSTED error.
+func retryDelay(t *testing.T, err error) time.Duration {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("got %v, want RESOURCE_EXHAUSTED", err)
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.RetryDelay.AsDuration()
+		}
+	}
+	t.Fatalf("%v has no RetryInfo", err)
+	return 0
+}
+
+func TestSearchLimitsRate(t *testing.T) {
+	t.Setenv("SEARCH_RATE_LIMIT", "1")
+	l, err := searchLimitsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	rejected := testutil.ToFloat64(searchRejections.WithLabelValues("rate"))
+	_, err = l.acquire(context.Background())
+	if d := retryDelay(t, err); d < 500*time.Millisecond || d > time.Second {
+		t.Errorf("retry delay = %v, want about a second", d)
+	}
+	if testutil.ToFloat64(searchRejections.WithLabelValues("rate")) != rejected+1 {
+		t.Error("rejection not counted")
+	}
+}
+
+func TestSearchLimitsConcurrency(t *testing.T) {
+	l := &searchLimits{slots: make(chan struct{}, 1), queueTimeout: 10 * time.Millisecond}
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = l.acquire(context.Background())
+	if d := retryDelay(t, err); d != minRetryDelay {
+		t.Errorf("retry delay = %v, want %v", d, minRetryDelay)
+	}
+
+	// A search waiting in the queue gets the slot once it frees up.
+	l.queueTimeout = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, err = l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	var nothing *searchLimits
+	if _, err := nothing.acquire(context.Background()); err != nil {
+		t.Errorf("without limits: %v", err)
+	}
+}
+
+func TestSearchLimitsRejectionKeepsRateToken(t *testing.T) {
+	l := &searchLimits{
+		rate:         rate.NewLimiter(rate.Every(time.Hour), 1),
+		slots:        make(chan struct{}, 1),
+		queueTimeout: time.Millisecond,
+	}
+	l.slots <- struct{}{}
+	if _, err := l.acquire(context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("acquire with no free slot: %v", err)
+	}
+	<-l.slots
+
+	// The rejected search did not use up the only token.
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire after a rejection: %v", err)
+	}
+	release()
+}
+
+func TestSemanticSearchRejectedOverLimit(t *testing.T) {
+	defer func(l *searchLimits) { searchLimit = l }(searchLimit)
+	searchLimit = &searchLimits{slots: make(chan struct{}, 1)}
+	searchLimit.slots <- struct{}{}
+
+	_, err := mockProductCatalog.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "alpha"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("got %v, want RESOURCE_EXHAUSTED", err)
+	}
+
+	<-searchLimit.slots
+	if _, err := mockProductCatalog.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "alpha"}); err != nil {
+		t.Errorf("after the running search finished: %v", err)
+	}
+	if len(searchLimit.slots) != 0 {
+		t.Error("the search did not release its slot")
+	}
+}
+
+func TestImageSearchRejectedOverLimit(t *testing.T) {
+	defer func(l *searchLimits) { searchLimit = l }(searchLimit)
+	searchLimit = &searchLimits{slots: make(chan struct{}, 1)}
+	searchLimit.slots <- struct{}{}
+
+	req := &pb.ImageSearchRequest{Image: &pb.ImageSearchRequest_ImageData{ImageData: []byte("png")}}
+	if _, err := mockProductCatalog.ImageSearchProducts(context.Background(), req); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("got %v, want RESOURCE_EXHAUSTED", err)
+	}
+
+	<-searchLimit.slots
+	if _, err := mockProductCatalog.ImageSearchProducts(context.Background(), req); status.Code(err) == codes.ResourceExhausted {
+		t.Errorf("after the running search finished: %v", err)
+	}
+	if len(searchLimit.slots) != 0 {
+		t.Error("the search did not release its slot")
+	}
+}
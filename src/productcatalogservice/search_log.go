@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/status"
+)
+
+// Reasons a semantic search was served from keyword search.
+const (
+	fallbackDatabaseUnavailable = "database_unavailable"
+	fallbackSchemaUnavailable   = "schema_unavailable"
+	fallbackFlagDisabled        = "flag_disabled"
+	fallbackEmptyQuery          = "empty_query"
+	fallbackEmbeddingFailed     = "embedding_failed"
+	fallbackEmbeddingTimeout    = "embedding_timeout"
+	fallbackQueryFailed         = "query_failed"
+	fallbackQueryTimeout        = "query_timeout"
+)
+
+// logLevelFromEnv reads LOG_LEVEL (default info) as a logrus level name.
+func logLevelFromEnv() (logrus.Level, error) {
+	s := os.Getenv("LOG_LEVEL")
+	if s == "" {
+		return logrus.InfoLevel, nil
+	}
+	level, err := logrus.ParseLevel(s)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse LOG_LEVEL (%s): %v", s, err)
+	}
+	return level, nil
+}
+
+// searchLog collects what happened during one semantic search request and
+// logs it as a single structured entry when the request finishes, recording
+// its metrics at the same time. Details of each step go to debug level only.
+type searchLog struct {
+	start    time.Time
+	fields   logrus.Fields
+	fallback string
+	cause    error
+	steps    []timedStep
+}
+
+// timedStep is how long a step of a request, such as embedding, took.
+type timedStep struct {
+	name     string
+	duration time.Duration
+}
+
+func newSearchLog(req *pb.SemanticSearchRequest) *searchLog {
+	return &searchLog{
+		start: time.Now(),
+		fields: logrus.Fields{
+			"query":   req.GetQuery(),
+			"limit":   req.GetLimit(),
+			"sort_by": req.GetSortBy().String(),
+		},
+	}
+}
+
+// set adds a field to the summary entry.
+func (l *searchLog) set(key string, value interface{}) {
+	l.fields[key] = value
+}
+
+// step records how long a step of the request took, logged as <name>_ms.
+func (l *searchLog) step(name string, d time.Duration) {
+	l.fields[name+"_ms"] = d.Milliseconds()
+	l.steps = append(l.steps, timedStep{name, d})
+}
+
+// debug logs a step of the request at debug level, tagged with its query.
+func (l *searchLog) debug(format string, args ...interface{}) {
+	if log.IsLevelEnabled(logrus.DebugLevel) {
+		log.WithField("query", l.fields["query"]).Debugf(format, args...)
+	}
+}
+
+// fallBack records that the request is served from keyword search and why.
+func (l *searchLog) fallBack(reason string, cause error) {
+	l.fallback, l.cause = reason, cause
+}
+
+// finish logs the summary entry: error for a failed request, warning for a
+// fallback caused by a failure and info otherwise.
+func (l *searchLog) finish(resp *pb.SearchProductsResponse, err error) {
+	l.recordMetrics(err)
+	entry := log.WithFields(l.fields).WithField("latency_ms", time.Since(l.start).Milliseconds())
+	if resp != nil {
+		entry = entry.WithFields(logrus.Fields{"results": len(resp.Results), "truncated": resp.Truncated})
+	}
+	switch {
+	case err != nil:
+		entry.WithFields(logrus.Fields{"code": status.Code(err).String(), "error": err}).Error("semantic search failed")
+	case l.fallback != "":
+		entry = entry.WithField("fallback", l.fallback)
+		if l.cause == nil {
+			entry.Info("semantic search served from keyword search")
+			return
+		}
+		entry.WithField("error", l.cause).Warn("semantic search served from keyword search")
+	default:
+		entry.Info("semantic search")
+	}
+}
+
+// recordMetrics counts the request by outcome and fallback reason and
+// observes the latency of its steps and in total.
+func (l *searchLog) recordMetrics(err error) {
+	for _, s := range l.steps {
+		searchStepLatency.WithLabelValues(s.name).Observe(s.duration.Seconds())
+	}
+	searchStepLatency.WithLabelValues("total").Observe(time.Since(l.start).Seconds())
+	switch {
+	case err != nil:
+		semanticSearches.WithLabelValues("error").Inc()
+	case l.fallback != "":
+		semanticSearches.WithLabelValues("fallback").Inc()
+		searchFallbacks.WithLabelValues(l.fallback).Inc()
+	default:
+		semanticSearches.WithLabelValues("semantic").Inc()
+	}
+}
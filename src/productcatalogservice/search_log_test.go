@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogLevelFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		env     string
+		want    logrus.Level
+		wantErr bool
+	}{
+		{"", logrus.InfoLevel, false},
+		{"debug", logrus.DebugLevel, false},
+		{"WARN", logrus.WarnLevel, false},
+		{"chatty", 0, true},
+	} {
+		t.Setenv("LOG_LEVEL", tc.env)
+		got, err := logLevelFromEnv()
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("LOG_LEVEL=%q: got %v, %v; want %v, error %v", tc.env, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestSemanticSearchLogsOneSummary(t *testing.T) {
+	defer func(l *logrus.Logger) { log = l }(log)
+	var hook *test.Hook
+	log, hook = test.NewNullLogger()
+	dbReady.Store(false)
+
+	_, err := mockProductCatalog.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "alpha", Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want one summary", len(entries))
+	}
+	e := entries[0]
+	if e.Level != logrus.InfoLevel || e.Data["query"] != "alpha" || e.Data["fallback"] != fallbackDatabaseUnavailable {
+		t.Errorf("got %s entry %q with %v, want an info summary of the fallback", e.Level, e.Message, e.Data)
+	}
+	for _, field := range []string{"latency_ms", "results", "truncated"} {
+		if _, ok := e.Data[field]; !ok {
+			t.Errorf("summary has no %s field", field)
+		}
+	}
+}
+
+func TestSemanticSearchLogsFailures(t *testing.T) {
+	defer func(l *logrus.Logger) { log = l }(log)
+	var hook *test.Hook
+	log, hook = test.NewNullLogger()
+
+	_, err := mockProductCatalog.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+		Query:       "watch",
+		MaxPriceUsd: &pb.Money{CurrencyCode: "EUR", Units: 10},
+	})
+	if err == nil {
+		t.Fatal("expected an invalid filter error")
+	}
+	if e := hook.LastEntry(); e == nil || e.Level != logrus.ErrorLevel || e.Data["code"] != "InvalidArgument" {
+		t.Errorf("got %v, want an error summary with the status code", e)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"sort"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// sortOrderSQL returns the ORDER BY list of the outer semantic search query
+// for order. Ties keep relevance order.
+func sortOrderSQL(order pb.SemanticSearchRequest_SortOrder) string {
+	switch order {
+	case pb.SemanticSearchRequest_PRICE_ASC:
+		return "price_usd_units ASC, price_usd_nanos ASC, similarity_score ASC"
+	case pb.SemanticSearchRequest_PRICE_DESC:
+		return "price_usd_units DESC, price_usd_nanos DESC, similarity_score ASC"
+	case pb.SemanticSearchRequest_NEWEST:
+		return "created_at DESC, similarity_score ASC"
+	default:
+		return "similarity_score ASC"
+	}
+}
+
+// sortProducts applies order to keyword search results. The catalog has no
+// creation times, so NEWEST, like RELEVANCE, keeps the match order.
+func sortProducts(products []*pb.Product, order pb.SemanticSearchRequest_SortOrder) {
+	var less func(a, b *pb.Product) bool
+	switch order {
+	case pb.SemanticSearchRequest_PRICE_ASC:
+		less = func(a, b *pb.Product) bool { return priceNanos(a) < priceNanos(b) }
+	case pb.SemanticSearchRequest_PRICE_DESC:
+		less = func(a, b *pb.Product) bool { return priceNanos(a) > priceNanos(b) }
+	default:
+		return
+	}
+	sort.SliceStable(products, func(i, j int) bool { return less(products[i], products[j]) })
+}
+
+// priceNanos returns the price of p in USD nanos.
+func priceNanos(p *pb.Product) int64 {
+	return p.GetPriceUsd().GetUnits()*nanosPerUnit + int64(p.GetPriceUsd().GetNanos())
+}
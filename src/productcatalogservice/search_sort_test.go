@@ -0,0 +1,56 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestSortProducts(t *testing.T) {
+	catalog := func() []*pb.Product {
+		return []*pb.Product{
+			{Id: "lamp", PriceUsd: &pb.Money{Units: 30}},
+			{Id: "mug", PriceUsd: &pb.Money{Units: 8, Nanos: 990000000}},
+			{Id: "candle", PriceUsd: &pb.Money{Units: 8, Nanos: 500000000}},
+			{Id: "rug", PriceUsd: &pb.Money{Units: 30}},
+		}
+	}
+	ids := func(ps []*pb.Product) []string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.Id)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		order pb.SemanticSearchRequest_SortOrder
+		want  []string
+	}{
+		{pb.SemanticSearchRequest_RELEVANCE, []string{"lamp", "mug", "candle", "rug"}},
+		{pb.SemanticSearchRequest_PRICE_ASC, []string{"candle", "mug", "lamp", "rug"}},
+		{pb.SemanticSearchRequest_PRICE_DESC, []string{"lamp", "rug", "mug", "candle"}},
+		{pb.SemanticSearchRequest_NEWEST, []string{"lamp", "mug", "candle", "rug"}},
+	} {
+		products := catalog()
+		sortProducts(products, tc.order)
+		if got := ids(products); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.order, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const (
+	// searchStreamBatch is how many results each message of a streamed
+	// semantic search carries.
+	searchStreamBatch = 10
+	// maxStreamedSearchResults caps SemanticSearchRequest.limit for
+	// streamed searches, which never hold more than a batch of results.
+	maxStreamedSearchResults = 500
+)
+
+// searchStream sends the results of a streamed semantic search in batches.
+// With live set, semanticSearch sends them as it scans the query rows;
+// otherwise, when reranking or merchandising reorders them afterwards, they
+// are buffered like for SemanticSearchProducts and sent at the end.
+type searchStream struct {
+	ctx  context.Context
+	p    *productCatalog
+	send func(*pb.SearchProductsResponse) error
+	lang string
+	sl   *searchLog
+	live bool
+
+	batch []*pb.Product
+	// sent counts the results sent and topIDs holds the first of them, for
+	// the search event.
+	sent   int
+	topIDs []string
+}
+
+// StreamSemanticSearchProducts serves SemanticSearchProducts as a stream:
+// the results come in batches, then a last message with the rest of the
+// response.
+func (p *productCatalog) StreamSemanticSearchProducts(req *pb.SemanticSearchRequest, stream pb.ProductCatalogService_StreamSemanticSearchProductsServer) error {
+	out := &searchStream{ctx: stream.Context(), p: p, send: stream.Send}
+	resp, err := p.semanticSearchProducts(stream.Context(), req, out)
+	if err != nil {
+		return err
+	}
+	return stream.Send(resp)
+}
+
+// maxResults caps the limit of a search sent to s, or of an unary search if
+// s is nil.
+func (s *searchStream) maxResults() int32 {
+	if s == nil {
+		return maxSemanticSearchResults
+	}
+	return maxStreamedSearchResults
+}
+
+// limit is the number of results of a search sent to s that asks for
+// requested: defaultSemanticSearchResults without a limit, and at most
+// maxResults.
+func (s *searchStream) limit(requested int32) int32 {
+	switch {
+	case requested <= 0:
+		return defaultSemanticSearchResults
+	case requested > s.maxResults():
+		return s.maxResults()
+	}
+	return requested
+}
+
+// add queues product to be sent, sending the batch once it is full.
+func (s *searchStream) add(product *pb.Product) error {
+	s.batch = append(s.batch, product)
+	if len(s.batch) < searchStreamBatch {
+		return nil
+	}
+	return s.flush()
+}
+
+// addAll queues products and sends them all.
+func (s *searchStream) addAll(products []*pb.Product) error {
+	for _, product := range products {
+		if err := s.add(product); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+// flush sends the queued results, summarizing their variants and localizing
+// them like SemanticSearchProducts does.
+func (s *searchStream) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	s.p.searchResultVariants(s.batch)
+	localize(s.ctx, s.lang, s.batch, s.sl)
+	for _, product := range s.batch {
+		if len(s.topIDs) < searchEventTopProducts {
+			s.topIDs = append(s.topIDs, product.Id)
+		}
+	}
+	s.sent += len(s.batch)
+	err := s.send(&pb.SearchProductsResponse{Results: s.batch})
+	s.batch = nil
+	return err
+}
+
+// streamed returns how many results have been sent to s or are queued, 0
+// if s is nil.
+func (s *searchStream) streamed() int {
+	if s == nil {
+		return 0
+	}
+	return s.sent + len(s.batch)
+}
+
+// record adds the results sent to the search event e, whose response has
+// none left.
+func (s *searchStream) record(e *searchEvent) {
+	if s == nil {
+		return
+	}
+	e.topProductIDs = append(e.topProductIDs, s.topIDs...)
+	e.resultCount += s.sent
+}
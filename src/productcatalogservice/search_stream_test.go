@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc"
+)
+
+// fakeSearchStream records the messages of a streamed search.
+type fakeSearchStream struct {
+	grpc.ServerStream
+	sent []*pb.SearchProductsResponse
+}
+
+func (s *fakeSearchStream) Context() context.Context { return context.Background() }
+
+func (s *fakeSearchStream) Send(m *pb.SearchProductsResponse) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestSearchStreamBatches(t *testing.T) {
+	var sizes []int
+	out := &searchStream{ctx: context.Background(), p: &productCatalog{}, send: func(m *pb.SearchProductsResponse) error {
+		sizes = append(sizes, len(m.Results))
+		return nil
+	}}
+	var products []*pb.Product
+	for i := 0; i < 23; i++ {
+		products = append(products, &pb.Product{Id: fmt.Sprintf("P%02d", i)})
+	}
+	if err := out.addAll(products); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(sizes) != "[10 10 3]" || out.sent != 23 || out.streamed() != 23 {
+		t.Errorf("sent batches %v (%d results), want [10 10 3]", sizes, out.sent)
+	}
+
+	e := searchEvent{}
+	out.record(&e)
+	if e.resultCount != 23 || len(e.topProductIDs) != searchEventTopProducts || e.topProductIDs[0] != "P00" {
+		t.Errorf("got event %+v, want 23 results and the top ones from P00", e)
+	}
+	var unary *searchStream
+	unary.record(&e) // no-op
+	if unary.maxResults() != maxSemanticSearchResults || out.maxResults() != maxStreamedSearchResults {
+		t.Error("streamed searches do not take a larger limit")
+	}
+}
+
+func TestSearchStreamLimit(t *testing.T) {
+	var unary *searchStream
+	out := &searchStream{}
+	for _, tc := range []struct {
+		s         *searchStream
+		requested int32
+		want      int32
+	}{
+		{unary, 0, defaultSemanticSearchResults},
+		{unary, -1, defaultSemanticSearchResults},
+		{unary, 20, 20},
+		// A limit above the maximum is clamped to it, not reset to the
+		// default.
+		{unary, maxSemanticSearchResults + 1, maxSemanticSearchResults},
+		{unary, 1000, maxSemanticSearchResults},
+		{out, 1000, 500},
+		{out, maxStreamedSearchResults + 1, maxStreamedSearchResults},
+	} {
+		if got := tc.s.limit(tc.requested); got != tc.want {
+			t.Errorf("limit(%d) with stream %v = %d, want %d", tc.requested, tc.s != nil, got, tc.want)
+		}
+	}
+}
+
+func TestStreamSemanticSearchProducts(t *testing.T) {
+	req := &pb.SemanticSearchRequest{Query: "Alpha", IncludeFacets: true}
+	want, err := mockProductCatalog.SemanticSearchProducts(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := &fakeSearchStream{}
+	if err := mockProductCatalog.StreamSemanticSearchProducts(req, stream); err != nil {
+		t.Fatal(err)
+	}
+	if len(stream.sent) != 2 {
+		t.Fatalf("got %d messages, want the results then the rest of the response", len(stream.sent))
+	}
+	results, last := stream.sent[0].Results, stream.sent[1]
+	if len(results) != len(want.Results) || results[0].Id != want.Results[0].Id {
+		t.Errorf("streamed results %v, want %v", results, want.Results)
+	}
+	if len(last.Results) != 0 || last.Facets == nil {
+		t.Errorf("last message %v, want facets and no results", last)
+	}
+}
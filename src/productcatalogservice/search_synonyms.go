@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// synonymTable rewrites words and phrases to a canonical term, such as
+// "couch" to "sofa", so queries using either find the same products.
+type synonymTable struct {
+	// canonical maps a lowercased phrase, its words joined by single spaces,
+	// to its replacement.
+	canonical map[string]string
+	// longest is the number of words in the longest phrase.
+	longest int
+}
+
+var (
+	synonyms atomic.Pointer[synonymTable]
+
+	// synonymsReload asks the watcher started by initSynonyms to re-read the
+	// synonyms file right away.
+	synonymsReload = make(chan struct{}, 1)
+)
+
+// currentSynonyms returns the loaded synonym table, which may be empty.
+func currentSynonyms() *synonymTable {
+	if t := synonyms.Load(); t != nil {
+		return t
+	}
+	return &synonymTable{}
+}
+
+// parseSynonyms reads a JSON object mapping each canonical term to the words
+// or phrases that mean the same, for example {"sofa": ["couch", "settee"]}.
+func parseSynonyms(data []byte) (*synonymTable, error) {
+	var defs map[string][]string
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse synonyms: %v", err)
+	}
+	t := &synonymTable{canonical: make(map[string]string)}
+	for term, variants := range defs {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("synonyms have an empty term")
+		}
+		for _, v := range variants {
+			words := strings.Fields(strings.ToLower(v))
+			if len(words) == 0 {
+				return nil, fmt.Errorf("synonyms of %q include an empty phrase", term)
+			}
+			phrase := strings.Join(words, " ")
+			if other, ok := t.canonical[phrase]; ok && other != term {
+				return nil, fmt.Errorf("%q is a synonym of both %q and %q", phrase, other, term)
+			}
+			t.canonical[phrase] = term
+			t.longest = max(t.longest, len(words))
+		}
+	}
+	return t, nil
+}
+
+// replace rewrites the phrases of words that have a canonical term, trying
+// the longest phrase first at each position.
+func (t *synonymTable) replace(words []string) []string {
+	if len(t.canonical) == 0 {
+		return words
+	}
+	var out []string
+	for i := 0; i < len(words); {
+		matched := false
+		for n := min(t.longest, len(words)-i); n > 0; n-- {
+			if term, ok := t.canonical[strings.ToLower(strings.Join(words[i:i+n], " "))]; ok {
+				out = append(out, strings.Fields(term)...)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			out = append(out, words[i])
+			i++
+		}
+	}
+	return out
+}
+
+// initSynonyms loads the synonyms in SEARCH_SYNONYMS_FILE and keeps them in
+// sync with the file, like initFeatureFlags, so they can be edited through a
+// ConfigMap without a redeploy. Without the variable there are no synonyms.
+func initSynonyms() error {
+	path := os.Getenv("SEARCH_SYNONYMS_FILE")
+	if path == "" {
+		return nil
+	}
+	refresh := 30 * time.Second
+	if s := os.Getenv("SEARCH_SYNONYMS_REFRESH_INTERVAL"); s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("failed to parse SEARCH_SYNONYMS_REFRESH_INTERVAL (%s) as a positive time.Duration", s)
+		}
+		refresh = v
+	}
+
+	watchConfigFile("synonyms", path, refresh, synonymsReload, loadSynonyms)
+	return nil
+}
+
+// reloadSynonyms triggers an immediate re-read of SEARCH_SYNONYMS_FILE. It
+// never blocks; a reload that is already pending absorbs the request.
+func reloadSynonyms() {
+	if os.Getenv("SEARCH_SYNONYMS_FILE") == "" {
+		return
+	}
+	select {
+	case synonymsReload <- struct{}{}:
+	default:
+	}
+}
+
+// loadSynonyms parses the synonyms file and swaps in the new table. The
+// loaded table is kept if the file is invalid.
+func loadSynonyms(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	t, err := parseSynonyms(data)
+	if err != nil {
+		return fi.ModTime(), err
+	}
+	synonyms.Store(t)
+	log.Infof("loaded %d synonyms from %s", len(t.canonical), path)
+	return fi.ModTime(), nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestParseSynonymsErrors(t *testing.T) {
+	for _, data := range []string{
+		`["sofa"]`,
+		`{"": ["couch"]}`,
+		`{"sofa": [" "]}`,
+		`{"sofa": ["couch"], "bed": ["couch"]}`,
+	} {
+		if _, err := parseSynonyms([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestSynonymsPreferLongestPhrase(t *testing.T) {
+	table, err := parseSynonyms([]byte(`{"glasses": ["sun"], "sunglasses": ["sun glasses"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := table.replace([]string{"cheap", "Sun", "glasses", "sun"})
+	if want := []string{"cheap", "sunglasses", "glasses"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLoadSynonymsKeepsTableOnInvalidFile(t *testing.T) {
+	defer func(t *synonymTable) { synonyms.Store(t) }(synonyms.Load())
+	path := filepath.Join(t.TempDir(), "synonyms.json")
+	if err := os.WriteFile(path, []byte(`{"sofa": ["couch"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSynonyms(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"sofa": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSynonyms(path); err == nil {
+		t.Fatal("expected an error for an invalid file")
+	}
+	if got := currentSynonyms().canonical["couch"]; got != "sofa" {
+		t.Errorf("synonym of couch = %q after a failed reload, want sofa", got)
+	}
+}
+
+func TestSearchProductsUsesSynonyms(t *testing.T) {
+	defer func(t *synonymTable) { synonyms.Store(t) }(synonyms.Load())
+	defer func(q queryPipeline) { queryProcessing = q }(queryProcessing)
+	table, err := parseSynonyms([]byte(`{"alpha": ["first"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synonyms.Store(table)
+	queryProcessing = queryPipeline{lowercase: true, synonyms: true, stopwords: true}
+
+	resp, err := mockProductCatalog.SearchProducts(context.Background(), &pb.SearchProductsRequest{Query: "The First"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(resp.Results), 2; got != want {
+		t.Errorf("got %d results, want %d", got, want)
+	}
+}
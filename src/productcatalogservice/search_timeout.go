@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// searchTimeouts bound the steps of a semantic search. A step that runs out
+// of time is handled like a failed one: the request falls back to keyword
+// search, or fails as embeddingFailure says for the embedding step. 0 leaves
+// a step to the request deadline alone.
+type searchTimeouts struct {
+	// embed covers embedding the query, retries included.
+	embed time.Duration
+	// query covers running the database query and reading its rows.
+	query time.Duration
+}
+
+func (t searchTimeouts) String() string {
+	return fmt.Sprintf("embed %v, query %v", t.embed, t.query)
+}
+
+// searchTimeout holds the timeouts in effect, set from the environment at
+// startup.
+var searchTimeout = searchTimeouts{embed: 5 * time.Second, query: 3 * time.Second}
+
+// searchTimeoutsFromEnv builds searchTimeouts from the environment:
+//
+//	SEMANTIC_EMBED_TIMEOUT   embedding the query, retries included (default 5s)
+//	SEMANTIC_QUERY_TIMEOUT   the database query (default 3s)
+func searchTimeoutsFromEnv() (searchTimeouts, error) {
+	t := searchTimeout
+	for _, v := range []struct {
+		env    string
+		target *time.Duration
+	}{
+		{"SEMANTIC_EMBED_TIMEOUT", &t.embed},
+		{"SEMANTIC_QUERY_TIMEOUT", &t.query},
+	} {
+		s := os.Getenv(v.env)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return searchTimeouts{}, fmt.Errorf("failed to parse %s (%s) as a non-negative time.Duration", v.env, s)
+		}
+		*v.target = d
+	}
+	return t, nil
+}
+
+// requestSearchContext returns the context the semantic steps of req run
+// under: ctx, limited to SemanticSearchRequest.timeout_ms if set, so a
+// caller can leave itself time to use the keyword fallback.
+func requestSearchContext(ctx context.Context, req *pb.SemanticSearchRequest) (context.Context, context.CancelFunc, error) {
+	ms := req.GetTimeoutMs()
+	switch {
+	case ms < 0:
+		return nil, nil, fmt.Errorf("timeout_ms must not be negative")
+	case ms == 0:
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+	return ctx, cancel, nil
+}
+
+// withStepTimeout limits ctx to d, unless d is 0.
+func withStepTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// timedOut reports whether step ran out of time while the request it belongs
+// to is still waiting for an answer.
+func timedOut(request, step context.Context) bool {
+	return request.Err() == nil && step.Err() == context.DeadlineExceeded
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSearchTimeoutsFromEnv(t *testing.T) {
+	t.Setenv("SEMANTIC_EMBED_TIMEOUT", "750ms")
+	t.Setenv("SEMANTIC_QUERY_TIMEOUT", "0")
+	got, err := searchTimeoutsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (searchTimeouts{embed: 750 * time.Millisecond}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	t.Setenv("SEMANTIC_QUERY_TIMEOUT", "-1s")
+	if _, err := searchTimeoutsFromEnv(); err == nil {
+		t.Error("expected an error for a negative timeout")
+	}
+}
+
+// TestSemanticSearchEmbeddingTimeout checks that a stalled embedding service
+// is given up on after the server or request timeout, and the request served
+// from keyword search.
+func TestSemanticSearchEmbeddingTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(stalled)
+	t.Setenv("EMBEDDING_MODE", embeddingModeService)
+	t.Setenv("EMBEDDING_SERVICE_URL", srv.URL)
+
+	defer func(t searchTimeouts) { searchTimeout = t }(searchTimeout)
+	defer func(l *logrus.Logger) { log = l }(log)
+	var hook *test.Hook
+	log, hook = test.NewNullLogger()
+	dbReady.Store(true)
+	defer dbReady.Store(false)
+	defer productsSchemaReady.Store(productsSchemaReady.Load())
+	productsSchemaReady.Store(true)
+
+	for name, tc := range map[string]struct {
+		server    searchTimeouts
+		timeoutMs int32
+	}{
+		"server timeout":  {searchTimeouts{embed: 20 * time.Millisecond}, 0},
+		"request timeout": {searchTimeouts{}, 20},
+	} {
+		searchTimeout = tc.server
+		start := time.Now()
+		resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+			&pb.SemanticSearchRequest{Query: "alpha", TimeoutMs: tc.timeoutMs})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: took %v", name, elapsed)
+		}
+		if len(resp.Results) != 2 {
+			t.Errorf("%s: got %d results, want the 2 keyword matches", name, len(resp.Results))
+		}
+		if got := hook.LastEntry().Data["fallback"]; got != fallbackEmbeddingTimeout {
+			t.Errorf("%s: fallback %v, want %s", name, got, fallbackEmbeddingTimeout)
+		}
+	}
+}
+
+func TestRequestSearchContextRejectsNegativeTimeout(t *testing.T) {
+	if _, _, err := requestSearchContext(context.Background(), &pb.SemanticSearchRequest{TimeoutMs: -1}); err == nil {
+		t.Error("expected an error for a negative timeout_ms")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+// searchWeights are the weights of the combined, target tags and use context
+// embedding distances in the hybrid semantic search score. They sum to 1.
+type searchWeights struct {
+	Combined   float64
+	TargetTags float64
+	UseContext float64
+}
+
+func (w searchWeights) String() string {
+	return fmt.Sprintf("combined=%.3g target_tags=%.3g use_context=%.3g", w.Combined, w.TargetTags, w.UseContext)
+}
+
+// defaultSearchWeights favor the combined embedding, which covers name,
+// description and categories.
+var defaultSearchWeights = searchWeights{Combined: 0.6, TargetTags: 0.2, UseContext: 0.2}
+
+// hybridWeights are the weights used when a request does not override them.
+var hybridWeights = defaultSearchWeights
+
+// searchWeightsFromEnv builds searchWeights from the environment:
+//
+//	SEMANTIC_WEIGHT_COMBINED       weight of the combined embedding (default 0.6)
+//	SEMANTIC_WEIGHT_TARGET_TAGS    weight of the target tags embedding (default 0.2)
+//	SEMANTIC_WEIGHT_USE_CONTEXT    weight of the use context embedding (default 0.2)
+//
+// Weights are relative; they are normalized to sum to 1.
+func searchWeightsFromEnv() (searchWeights, error) {
+	w := defaultSearchWeights
+	vars := []struct {
+		env    string
+		target *float64
+	}{
+		{"SEMANTIC_WEIGHT_COMBINED", &w.Combined},
+		{"SEMANTIC_WEIGHT_TARGET_TAGS", &w.TargetTags},
+		{"SEMANTIC_WEIGHT_USE_CONTEXT", &w.UseContext},
+	}
+	for _, v := range vars {
+		s := os.Getenv(v.env)
+		if s == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return searchWeights{}, fmt.Errorf("failed to parse %s (%s) as a number", v.env, s)
+		}
+		*v.target = f
+	}
+	return w.normalize()
+}
+
+// requestSearchWeights returns the weights override of req, or hybridWeights
+// when it has none.
+func requestSearchWeights(req *pb.SemanticSearchRequest) (searchWeights, error) {
+	o := req.GetWeights()
+	if o == nil {
+		return hybridWeights, nil
+	}
+	return searchWeights{Combined: o.Combined, TargetTags: o.TargetTags, UseContext: o.UseContext}.normalize()
+}
+
+// normalize scales w to sum to 1. Weights must be finite and non-negative,
+// and at least one must be positive.
+func (w searchWeights) normalize() (searchWeights, error) {
+	for _, v := range []float64{w.Combined, w.TargetTags, w.UseContext} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return searchWeights{}, fmt.Errorf("search weights must be finite (%s)", w)
+		}
+	}
+	if w.Combined < 0 || w.TargetTags < 0 || w.UseContext < 0 {
+		return searchWeights{}, fmt.Errorf("search weights must not be negative (%s)", w)
+	}
+	sum := w.Combined + w.TargetTags + w.UseContext
+	if math.IsInf(sum, 0) {
+		return searchWeights{}, fmt.Errorf("search weights are too large (%s)", w)
+	}
+	if sum <= 0 {
+		return searchWeights{}, fmt.Errorf("at least one search weight must be positive")
+	}
+	return searchWeights{Combined: w.Combined / sum, TargetTags: w.TargetTags / sum, UseContext: w.UseContext / sum}, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func weightsNear(a, b searchWeights) bool {
+	const eps = 1e-9
+	return math.Abs(a.Combined-b.Combined) < eps &&
+		math.Abs(a.TargetTags-b.TargetTags) < eps &&
+		math.Abs(a.UseContext-b.UseContext) < eps
+}
+
+func TestSearchWeightsFromEnv(t *testing.T) {
+	w, err := searchWeightsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !weightsNear(w, defaultSearchWeights) {
+		t.Errorf("default weights = %s, want %s", w, defaultSearchWeights)
+	}
+
+	t.Setenv("SEMANTIC_WEIGHT_COMBINED", "2")
+	t.Setenv("SEMANTIC_WEIGHT_TARGET_TAGS", "1")
+	t.Setenv("SEMANTIC_WEIGHT_USE_CONTEXT", "1")
+	w, err = searchWeightsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (searchWeights{Combined: 0.5, TargetTags: 0.25, UseContext: 0.25}); !weightsNear(w, want) {
+		t.Errorf("weights = %s, want %s", w, want)
+	}
+
+	t.Setenv("SEMANTIC_WEIGHT_USE_CONTEXT", "NaN")
+	if _, err := searchWeightsFromEnv(); err == nil {
+		t.Error("expected error for a NaN weight")
+	}
+
+	t.Setenv("SEMANTIC_WEIGHT_USE_CONTEXT", "lots")
+	if _, err := searchWeightsFromEnv(); err == nil {
+		t.Error("expected error for non-numeric weight")
+	}
+}
+
+func TestRequestSearchWeights(t *testing.T) {
+	w, err := requestSearchWeights(&pb.SemanticSearchRequest{})
+	if err != nil || w != hybridWeights {
+		t.Errorf("without override got %s, %v; want %s", w, err, hybridWeights)
+	}
+
+	w, err = requestSearchWeights(&pb.SemanticSearchRequest{Weights: &pb.HybridSearchWeights{Combined: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (searchWeights{Combined: 1}); !weightsNear(w, want) {
+		t.Errorf("weights = %s, want %s", w, want)
+	}
+
+	for _, bad := range []*pb.HybridSearchWeights{
+		{},
+		{Combined: 1, TargetTags: -0.5},
+		{Combined: math.NaN()},
+		{Combined: 1, UseContext: math.Inf(1)},
+		{Combined: 1, TargetTags: math.Inf(-1)},
+		{Combined: math.MaxFloat64, TargetTags: math.MaxFloat64},
+	} {
+		if _, err := requestSearchWeights(&pb.SemanticSearchRequest{Weights: bad}); err == nil {
+			t.Errorf("expected error for weights %v", bad)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// secretFetchTimeout bounds one fetch of a secret from Secret Manager.
+const secretFetchTimeout = 10 * time.Second
+
+// secretCache keeps the value of a Secret Manager secret for ttl, so opening
+// connections does not cost a Secret Manager call each, and tells
+// subscribers when a refetch finds the value rotated.
+type secretCache struct {
+	name  string
+	fetch func(ctx context.Context) (string, error)
+	ttl   time.Duration
+	now   func() time.Time
+
+	// fetches collapses concurrent refreshes into one Secret Manager call.
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	value     string
+	fetchedAt time.Time
+	expired   bool
+	onRotate  []func(value string)
+	refreshes sync.Once
+}
+
+func newSecretCache(name string, fetch func(ctx context.Context) (string, error), ttl time.Duration) *secretCache {
+	return &secretCache{name: name, fetch: fetch, ttl: ttl, now: time.Now}
+}
+
+// defaultSecretCacheTTL is how long secrets are cached, and how often the
+// database password is refreshed in the background, unless SECRET_CACHE_TTL
+// says otherwise.
+const defaultSecretCacheTTL = 5 * time.Minute
+
+var (
+	// databasePassword is the semantic search database password.
+	databasePassword = newSecretCache("CLOUDSQL_SECRET_NAME", getDatabasePassword, defaultSecretCacheTTL)
+
+	// catalogPassword is the password the catalog is loaded with.
+	catalogPassword = newSecretCache("ALLOYDB_SECRET_NAME", func(ctx context.Context) (string, error) {
+		return getSecretPayload(ctx, os.Getenv("PROJECT_ID"), os.Getenv("ALLOYDB_SECRET_NAME"), "latest")
+	}, defaultSecretCacheTTL)
+)
+
+// secretCacheTTLFromEnv reads SECRET_CACHE_TTL, a positive time.Duration.
+func secretCacheTTLFromEnv() (time.Duration, error) {
+	s := os.Getenv("SECRET_CACHE_TTL")
+	if s == "" {
+		return defaultSecretCacheTTL, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("failed to parse SECRET_CACHE_TTL (%s) as a positive time.Duration", s)
+	}
+	return v, nil
+}
+
+// get returns the cached value, fetching it when it is older than ttl. If
+// that fetch fails the stale value is kept, since it most likely still
+// works; only a cache that was never filled returns the error.
+func (c *secretCache) get() (string, error) {
+	c.mu.Lock()
+	if !c.fetchedAt.IsZero() && !c.expired && c.now().Sub(c.fetchedAt) < c.ttl {
+		defer c.mu.Unlock()
+		return c.value, nil
+	}
+	c.mu.Unlock()
+
+	value, err := c.refresh()
+	if err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.fetchedAt.IsZero() {
+			return "", err
+		}
+		log.Warnf("failed to refresh %s, using the cached value: %v", c.name, err)
+		return c.value, nil
+	}
+	return value, nil
+}
+
+// refresh fetches the value regardless of its age, as after Postgres
+// rejected it, and notifies subscribers if it changed. Callers refreshing at
+// the same time share one fetch, which is bounded by secretFetchTimeout and
+// made without holding the lock, so get keeps serving the cached value.
+func (c *secretCache) refresh() (string, error) {
+	v, err, _ := c.fetches.Do(c.name, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+		defer cancel()
+		return c.fetch(ctx)
+	})
+	if err != nil {
+		return "", err
+	}
+	value := v.(string)
+
+	c.mu.Lock()
+	rotated := !c.fetchedAt.IsZero() && value != c.value
+	c.value, c.fetchedAt, c.expired = value, c.now(), false
+	subscribers := c.onRotate
+	c.mu.Unlock()
+
+	if rotated {
+		log.Infof("%s was rotated", c.name)
+		for _, f := range subscribers {
+			f(value)
+		}
+	}
+	return value, nil
+}
+
+// expire has the next get refetch the value.
+func (c *secretCache) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expired = true
+}
+
+// subscribe registers f to be called with the new value after a rotation.
+func (c *secretCache) subscribe(f func(value string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRotate = append(c.onRotate, f)
+}
+
+// refreshPeriodically refetches the value every ttl in the background, so a
+// rotation is noticed even while no connections are being opened. Only the
+// first call starts a refresher.
+func (c *secretCache) refreshPeriodically() {
+	c.refreshes.Do(func() {
+		go func() {
+			for range time.Tick(c.ttl) {
+				if _, err := c.refresh(); err != nil {
+					log.Warnf("failed to refresh %s: %v", c.name, err)
+				}
+			}
+		}()
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeSecret is a secret whose value and availability tests control.
+type fakeSecret struct {
+	value   string
+	err     error
+	fetches int
+}
+
+func (f *fakeSecret) fetch(context.Context) (string, error) {
+	f.fetches++
+	return f.value, f.err
+}
+
+func TestSecretCacheGet(t *testing.T) {
+	secret := &fakeSecret{value: "v1"}
+	now := time.Unix(0, 0)
+	c := newSecretCache("TEST_SECRET", secret.fetch, time.Minute)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if got, err := c.get(); err != nil || got != "v1" {
+			t.Fatalf("get = %q, %v; want v1", got, err)
+		}
+	}
+	if secret.fetches != 1 {
+		t.Errorf("fetches = %d, want 1 within the TTL", secret.fetches)
+	}
+
+	secret.value = "v2"
+	now = now.Add(time.Minute)
+	if got, _ := c.get(); got != "v2" {
+		t.Errorf("get after the TTL = %q, want v2", got)
+	}
+
+	// A failed refresh keeps serving the cached value.
+	secret.err = errors.New("secret manager unavailable")
+	now = now.Add(time.Minute)
+	if got, err := c.get(); err != nil || got != "v2" {
+		t.Errorf("get with a failing fetch = %q, %v; want the cached v2", got, err)
+	}
+
+	empty := newSecretCache("TEST_SECRET", secret.fetch, time.Minute)
+	if _, err := empty.get(); err == nil {
+		t.Error("expected an error when the secret was never fetched")
+	}
+}
+
+func TestSecretCacheRotation(t *testing.T) {
+	secret := &fakeSecret{value: "v1"}
+	c := newSecretCache("TEST_SECRET", secret.fetch, time.Hour)
+	var rotated []string
+	c.subscribe(func(value string) { rotated = append(rotated, value) })
+
+	c.get()
+	c.refresh()
+	if len(rotated) != 0 {
+		t.Errorf("notified of %v without a rotation", rotated)
+	}
+
+	secret.value = "v2"
+	if got, _ := c.get(); got != "v1" {
+		t.Errorf("get before expiry = %q, want the cached v1", got)
+	}
+	c.expire()
+	if got, _ := c.get(); got != "v2" {
+		t.Errorf("get after expire = %q, want v2", got)
+	}
+	if len(rotated) != 1 || rotated[0] != "v2" {
+		t.Errorf("rotations = %v, want [v2]", rotated)
+	}
+}
+
+func TestSecretCacheFetchDoesNotHoldLock(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	c := newSecretCache("TEST_SECRET", func(ctx context.Context) (string, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("fetch has no deadline")
+		}
+		close(entered)
+		<-release
+		return "v1", nil
+	}, time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if got, err := c.refresh(); err != nil || got != "v1" {
+			t.Errorf("refresh = %q, %v; want v1", got, err)
+		}
+	}()
+	<-entered
+	// These take the lock, so they would block if the fetch held it.
+	c.expire()
+	c.subscribe(func(string) {})
+	close(release)
+	<-done
+}
+
+func TestCachedCredentialsRefetchPastCache(t *testing.T) {
+	secret := &fakeSecret{value: "old"}
+	creds := cachedCredentials(newSecretCache("TEST_SECRET", secret.fetch, time.Hour))
+	c := &rotatingConnector{creds: creds}
+	if got := c.currentPassword(); got != "old" {
+		t.Fatalf("currentPassword = %q, want old", got)
+	}
+
+	secret.value = "new"
+	if got := c.currentPassword(); got != "old" {
+		t.Errorf("currentPassword = %q, want the cached old", got)
+	}
+	// Postgres rejecting the cached password skips the cache.
+	if got, err := c.refreshPassword("old"); err != nil || got != "new" {
+		t.Errorf("refreshPassword = %q, %v; want new", got, err)
+	}
+	if got := c.currentPassword(); got != "new" {
+		t.Errorf("currentPassword after the refetch = %q, want new", got)
+	}
+}
+
+func TestSecretCacheTTLFromEnv(t *testing.T) {
+	if got, err := secretCacheTTLFromEnv(); err != nil || got != defaultSecretCacheTTL {
+		t.Errorf("default = %s, %v", got, err)
+	}
+	t.Setenv("SECRET_CACHE_TTL", "30s")
+	if got, err := secretCacheTTLFromEnv(); err != nil || got != 30*time.Second {
+		t.Errorf("30s = %s, %v", got, err)
+	}
+	for _, bad := range []string{"0s", "-1m", "soon"} {
+		t.Setenv("SECRET_CACHE_TTL", bad)
+		if _, err := secretCacheTTLFromEnv(); err == nil {
+			t.Errorf("expected an error for SECRET_CACHE_TTL=%s", bad)
+		}
+	}
+}
@@ -17,44 +17,82 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pgvector/pgvector-go"
+	pgxvec "github.com/pgvector/pgvector-go/pgx"
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 var db *sql.DB
 
+const (
+	// defaultSemanticSearchResults is how many products a semantic search
+	// returns when the request has no limit.
+	defaultSemanticSearchResults = 10
+
+	// maxSemanticSearchResults caps SemanticSearchRequest.limit.
+	maxSemanticSearchResults = 50
+
+	// maxSearchResponseBytes bounds the encoded size of a semantic search
+	// response. Products past the budget are dropped and the response is
+	// marked truncated.
+	maxSearchResponseBytes = 1 << 20
+)
+
+// responseBudget tracks how many encoded bytes a response may still grow by.
+type responseBudget struct {
+	remaining int
+}
+
+// take reserves space for p and reports whether it fits.
+func (b *responseBudget) take(p *pb.Product) bool {
+	size := proto.Size(p)
+	if size > b.remaining {
+		return false
+	}
+	b.remaining -= size
+	return true
+}
+
 // initDatabase initializes the database connection for semantic search
 func initDatabase() error {
 	if db != nil {
 		return nil // Already initialized
 	}
 
-	cloudSQLHost := os.Getenv("CLOUDSQL_HOST")
-	if cloudSQLHost == "" {
+	topology, err := loadDBTopology()
+	if err != nil {
+		return err
+	}
+	if topology.primaryHost == "" {
 		log.Info("CLOUDSQL_HOST not set, semantic search disabled")
 		return nil
 	}
 
-	password, err := getDatabasePassword()
-	if err != nil {
-		return fmt.Errorf("failed to get database password: %v", err)
+	// The password is cached from Secret Manager, refreshed in the
+	// background and refetched if Postgres rejects it, so secret rotation
+	// does not need a restart; with IAM authentication every connection gets
+	// a current token instead.
+	creds := dbAuth.credentials()
+	if creds.secret != nil {
+		creds.secret.refreshPeriodically()
 	}
-
-	connStr := fmt.Sprintf("host=%s port=5432 user=postgres password=%s dbname=products sslmode=disable",
-		cloudSQLHost, password)
-
-	db, err = sql.Open("pgx", connStr)
+	open := func(host string) (*sql.DB, error) {
+		return dbPool.open(dbAuth.connString(host, dbTLS), creds)
+	}
+	conn, err := open(topology.primaryHost)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
@@ -62,20 +100,76 @@ func initDatabase() error {
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	
-	if err := db.PingContext(ctx); err != nil {
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
 		return fmt.Errorf("failed to ping database: %v", err)
 	}
+	if len(topology.readHosts) > 0 {
+		if err := connectReadEndpoints(shutdown, topology, conn, open); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to open read endpoints: %v", err)
+		}
+	}
+	db = conn
+
+	// Semantic search needs the columns the schema update adds; without them
+	// it is served from keyword search.
+	if err := ensureProductsSchema(context.Background()); err != nil {
+		log.Warnf("Failed to update products schema: %v", err)
+	} else {
+		warnForeignEmbeddings(context.Background())
+	}
+	if err := ensureSuggestSchema(context.Background()); err != nil {
+		log.Warnf("Search suggestions limited to prefix matches: %v", err)
+	}
+	if err := ensureInteractionsSchema(context.Background()); err != nil {
+		log.Warnf("Search personalization limited to explicit profiles: %v", err)
+	}
+	if searchEvents != nil {
+		if err := ensureSearchEventsSchema(context.Background()); err != nil {
+			log.Warnf("Search events will be dropped: %v", err)
+		}
+	}
+	if err := ensureMerchandisingSchema(context.Background()); err != nil {
+		log.Warnf("Merchandising rules disabled: %v", err)
+	} else if err := reloadMerchandisingRules(context.Background()); err != nil {
+		log.Warnf("Failed to load merchandising rules: %v", err)
+	}
+	if err := ensureCampaignsSchema(context.Background()); err != nil {
+		log.Warnf("Campaigns disabled: %v", err)
+	} else if err := reloadCampaigns(context.Background()); err != nil {
+		log.Warnf("Failed to load campaigns: %v", err)
+	}
+	if vectorIndex.approximate {
+		// Building the index can take a while on a large catalog; until it is
+		// ready the candidate query scans the table.
+		go func() {
+			if err := ensureVectorIndex(context.Background(), vectorIndex); err != nil {
+				log.Warnf("Failed to build vector index: %v", err)
+			}
+		}()
+	}
 
-	log.Info("Database connection established for semantic search")
+	log.Infof("Database connection established for semantic search (primary region %q)", topology.primaryRegion)
 	return nil
 }
 
+// openVectorDB opens a database handle whose connections have the pgvector
+// types registered, so pgvector.Vector parameters are sent in binary format.
+func openVectorDB(connStr string) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	return stdlib.OpenDB(*config, stdlib.OptionAfterConnect(pgxvec.RegisterTypes)), nil
+}
+
 // getDatabasePassword retrieves the database password from Secret Manager
-func getDatabasePassword() (string, error) {
-	projectID := os.Getenv("PROJECT_ID")
-	if projectID == "" {
-		projectID = "gke-hack-471804"
+func getDatabasePassword(ctx context.Context) (string, error) {
+	projectID, err := projectIDFor("CLOUDSQL_AUTH=password")
+	if err != nil {
+		return "", err
 	}
 
 	secretName := os.Getenv("CLOUDSQL_SECRET_NAME")
@@ -83,7 +177,6 @@ func getDatabasePassword() (string, error) {
 		secretName = "cloudsql-secret-private"
 	}
 
-	ctx := context.Background()
 	client, err := secretmanager.NewClient(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to create Secret Manager client: %v", err)
@@ -103,176 +196,336 @@ func getDatabasePassword() (string, error) {
 	return string(result.Payload.Data), nil
 }
 
-// callVertexAIEmbedding calls the Vertex AI embedding service
-func callVertexAIEmbedding(text string) ([]float32, error) {
-	embeddingServiceURL := os.Getenv("EMBEDDING_SERVICE_URL")
-	if embeddingServiceURL == "" {
-		embeddingServiceURL = "http://embeddingservice:8081"
+// generateEmbeddings embeds texts in batches of embeddingBatchSize. If a
+// batch call fails, its texts are embedded one at a time. Calls are retried
+// as embeddingFailure allows; if a text still cannot be embedded the whole
+// call fails rather than return a placeholder vector. Blank texts are not
+// embedded; their embeddings are nil.
+func generateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	size := embeddingBatchSize()
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		batch := texts[start:min(start+size, len(texts))]
+		var result [][]float32
+		err := embeddingFailure.run(ctx, func(ctx context.Context) (err error) {
+			result, err = embedTexts(ctx, batch)
+			return err
+		})
+		if errors.Is(err, errEmbeddingDimensions) {
+			return nil, err
+		}
+		if err != nil {
+			log.Warnf("Batch embedding of %d texts failed, embedding them one at a time: %v", len(batch), err)
+			result = make([][]float32, len(batch))
+			for i, text := range batch {
+				if strings.TrimSpace(text) == "" {
+					continue
+				}
+				err := embeddingFailure.run(ctx, func(ctx context.Context) (err error) {
+					result[i], err = embedText(ctx, text)
+					return err
+				})
+				if err != nil {
+					return nil, fmt.Errorf("failed to embed text %d: %v", start+i, err)
+				}
+			}
+		}
+		embeddings = append(embeddings, result...)
 	}
-	log.Infof("Calling embedding service at %s with text: '%s'", embeddingServiceURL, text)
-	
-	// Prepare request payload
-	payload := map[string]string{
-		"text": text,
+	return embeddings, nil
+}
+
+// weightedDistanceSQL scores product p against the query embedding $1 as the
+// distances to its embeddings weighted by $3, $4 and $5. Missing embeddings
+// count as distance 1.
+const weightedDistanceSQL = `(
+					   COALESCE(p.combined_embedding <=> $1, 1.0) * $3::float8 +
+					   COALESCE(p.target_tags_embedding <=> $1, 1.0) * $4::float8 +
+					   COALESCE(p.use_context_embedding <=> $1, 1.0) * $5::float8
+				   )`
+
+// scoreColumnsSQL selects the distances weightedDistanceSQL combines, which
+// SearchDebug reports.
+const scoreColumnsSQL = `p.combined_embedding <=> $1 AS combined_distance,
+				   p.target_tags_embedding <=> $1 AS target_tags_distance,
+				   p.use_context_embedding <=> $1 AS use_context_distance`
+
+// resultColumnsSQL is the select list of both semantic search queries.
+const resultColumnsSQL = `id, name, description, picture, price_usd_currency_code,
+			   price_usd_units, price_usd_nanos, categories, target_tags, use_context, status, stock,
+			   similarity_score, combined_distance, target_tags_distance, use_context_distance,
+			   keyword_score, popularity, row_number() OVER (ORDER BY similarity_score) AS relevance_rank`
+
+// SemanticSearchProducts ranks products by embedding similarity to the query,
+// falling back to keyword search when semantic search is unavailable. A query
+// in another language than the catalog's is translated, when translation is
+// on, and the results are localized into its language. When nothing matches,
+// the response suggests a respelled query. Requests in a ranking experiment
+// are ranked and tagged by their variant. Each request is logged once, with
+// its outcome, when it finishes.
+func (p *productCatalog) SemanticSearchProducts(ctx context.Context, req *pb.SemanticSearchRequest) (*pb.SearchProductsResponse, error) {
+	return p.semanticSearchProducts(ctx, req, nil)
+}
+
+// semanticSearchProducts serves SemanticSearchProducts, or with out
+// StreamSemanticSearchProducts; the results are then sent to out and the
+// response returned holds none.
+func (p *productCatalog) semanticSearchProducts(ctx context.Context, req *pb.SemanticSearchRequest, out *searchStream) (*pb.SearchProductsResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request is nil")
 	}
-	payloadBytes, err := json.Marshal(payload)
+	// Rejections are counted in metrics rather than logged, since they come
+	// in bursts.
+	release, err := searchLimit.acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
+		return nil, err
+	}
+	defer release()
+
+	sl := newSearchLog(req)
+	lang := languages.queryLanguage(req)
+	search := req
+	if lang != "" {
+		sl.set("query_language", lang)
+		if q := languages.translateQuery(ctx, req.Query, lang, sl); q != req.Query {
+			search = proto.Clone(req).(*pb.SemanticSearchRequest)
+			search.Query = q
+		}
 	}
-	
-	// Make HTTP request
-	log.Infof("Making POST request to %s/embed", embeddingServiceURL)
-	resp, err := http.Post(embeddingServiceURL+"/embed", "application/json", strings.NewReader(string(payloadBytes)))
-	if err != nil {
-		log.Errorf("HTTP request failed: %v", err)
-		return nil, fmt.Errorf("failed to call embedding service: %v", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		log.Errorf("Embedding service returned status %d", resp.StatusCode)
-		return nil, fmt.Errorf("embedding service returned status %d", resp.StatusCode)
-	}
-	log.Infof("Embedding service responded with status %d", resp.StatusCode)
-	
-	// Parse response
-	var response struct {
-		Embedding  []float32 `json:"embedding"`
-		Dimensions int       `json:"dimensions"`
-		Model      string    `json:"model"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
-	}
-	
-	return response.Embedding, nil
-}
-
-// generateEmbedding generates embedding using Vertex AI with fallback
-func generateEmbedding(text string) []float32 {
-	// Try to call Vertex AI service
-	if embedding, err := callVertexAIEmbedding(text); err == nil {
-		return embedding
-	} else {
-		log.Warnf("Failed to get Vertex AI embedding, using fallback: %v", err)
-	}
-	
-	// Fallback to hash-based embedding
-	words := strings.Fields(strings.ToLower(text))
-	embedding := make([]float32, 768)
-	
-	for i, word := range words {
-		if i >= 768 {
-			break
+	if out != nil {
+		out.lang, out.sl = lang, sl
+	}
+	variant := experiment.Load().assign(req)
+	var variantTag string
+	if variant != nil {
+		variantTag = variant.tag
+		sl.set("experiment_variant", variantTag)
+	}
+	resp, err := p.semanticSearch(ctx, search, variant, sl, out)
+	if err == nil {
+		resp.ExperimentVariant = variantTag
+		resp.QueryLanguage = lang
+	}
+	processedQuery := queryProcessing.process(search.Query)
+	var rules []int64
+	if err == nil {
+		rules = p.applyMerchandising(search, processedQuery, resp)
+		if len(rules) > 0 {
+			sl.set("merchandising_rules", rules)
 		}
-		// Simple hash function to generate deterministic values
-		hash := 0
-		for _, char := range word {
-			hash = hash*31 + int(char)
+	}
+	if err == nil && req.GetDebug() {
+		if resp.Debug == nil {
+			resp.Debug = &pb.SearchDebug{}
 		}
-		embedding[i] = float32(hash%1000) / 1000.0
+		resp.Debug.Fallback = sl.fallback
+		resp.Debug.ProcessedQuery = processedQuery
+		resp.Debug.MerchandisingRules = rules
+	}
+	if err == nil && len(resp.Results)+out.streamed() == 0 {
+		resp.SuggestedQuery = p.didYouMean(ctx, search.Query)
+		if resp.SuggestedQuery != "" {
+			sl.set("suggested_query", resp.SuggestedQuery)
+		}
+	}
+	if err == nil && out != nil {
+		err = out.addAll(resp.Results)
+		resp.Results = nil
+		sl.set("streamed_results", out.sent)
 	}
-	
-	return embedding
+	if err == nil {
+		p.searchResultVariants(resp.Results)
+		localize(ctx, lang, resp.Results, sl)
+	}
+	if searchEvents != nil {
+		id := newSearchID()
+		sl.set("search_id", id)
+		if err == nil {
+			resp.SearchId = id
+		}
+		e := newSearchEvent(id, req, processedQuery, resp, err, sl)
+		e.variant = variantTag
+		out.record(&e)
+		searchEvents.emit(e)
+	}
+	sl.finish(resp, err)
+	return resp, err
 }
 
-// semanticSearchProducts performs semantic search on products
-func (p *productCatalog) SemanticSearchProducts(ctx context.Context, req *pb.SemanticSearchRequest) (*pb.SearchProductsResponse, error) {
-	log.Infof("SemanticSearchProducts called - START")
-	
-	// Add comprehensive nil checks and logging
-	if p == nil {
-		log.Errorf("productCatalog receiver is nil!")
-		return nil, status.Error(codes.Internal, "productCatalog receiver is nil")
-	}
-	log.Infof("productCatalog receiver is valid: %p", p)
-	
-	if ctx == nil {
-		log.Errorf("context is nil!")
-		return nil, status.Error(codes.InvalidArgument, "context is nil")
-	}
-	log.Infof("context is valid: %p", ctx)
-	
-	if req == nil {
-		log.Errorf("request is nil!")
-		return nil, status.Error(codes.InvalidArgument, "request is nil")
+// semanticSearch serves a request with the ranking settings of variant, or
+// the server's when it is nil. Results that can be streamed as they are
+// scanned are sent to out, if set, rather than returned.
+func (p *productCatalog) semanticSearch(ctx context.Context, req *pb.SemanticSearchRequest, variant *experimentVariant, sl *searchLog, out *searchStream) (*pb.SearchProductsResponse, error) {
+	filters, err := parseSearchFilters(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+	}
+	weights, err := variant.searchWeights(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid weights: %v", err)
+	}
+	maxDistance, err := requestMaxDistance(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max distance: %v", err)
+	}
+	profile, err := requestProfile(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid profile: %v", err)
 	}
-	log.Infof("request is valid: %p, query: '%s', limit: %d", req, req.Query, req.Limit)
+	lambda, err := diversity.lambdaFor(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid diversity: %v", err)
+	}
+	searchCtx, cancel, err := requestSearchContext(ctx, req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid timeout: %v", err)
+	}
+	defer cancel()
 
-	time.Sleep(extraLatency)
+	if !dbReady.Load() {
+		sl.fallBack(fallbackDatabaseUnavailable, nil)
+		return p.keywordSearch(ctx, req, filters, out)
+	}
+	// The query reads the columns productsSchemaSQL adds, such as created_at
+	// for the NEWEST order. Catalog admin writes retry applying it.
+	if !productsSchemaReady.Load() {
+		sl.fallBack(fallbackSchemaUnavailable, nil)
+		return p.keywordSearch(ctx, req, filters, out)
+	}
 
-	if db == nil {
-		// Fallback to regular search if database not available
-		log.Warn("Database not available, falling back to regular search")
-		searchReq := &pb.SearchProductsRequest{Query: req.Query}
-		return p.SearchProducts(ctx, searchReq)
+	if !flagEnabled(ctx, flagSemanticSearch, req.Query, true) {
+		sl.fallBack(fallbackFlagDisabled, nil)
+		return p.keywordSearch(ctx, req, filters, out)
 	}
-	log.Infof("Database connection is valid: %p", db)
 
-	limit := req.Limit
-	if limit <= 0 || limit > 50 {
-		limit = 10 // Default limit
+	limit := out.limit(req.Limit)
+
+	// The keyword fallback processes the query itself, in SearchProducts.
+	queryText := queryProcessing.process(req.Query)
+	if queryText != req.Query {
+		sl.set("processed_query", queryText)
+	}
+	// A blank query has nothing to embed, so it is not sent to the provider.
+	if strings.TrimSpace(queryText) == "" {
+		sl.fallBack(fallbackEmptyQuery, nil)
+		return p.keywordSearch(ctx, req, filters, out)
 	}
 
-	// Generate query embedding using our embedding service
-	log.Infof("Generating embedding for query: '%s'", req.Query)
-	queryEmbedding, err := callVertexAIEmbedding(req.Query)
+	embedStart := time.Now()
+	embedCtx, cancelEmbed := withStepTimeout(searchCtx, searchTimeout.embed)
+	var queryEmbedding []float32
+	err = embeddingFailure.run(embedCtx, func(ctx context.Context) (err error) {
+		queryEmbedding, err = embedText(ctx, queryText)
+		return err
+	})
+	embedTimedOut := timedOut(ctx, embedCtx)
+	cancelEmbed()
+	sl.step("embed", time.Since(embedStart))
 	if err != nil {
-		log.Errorf("Failed to generate query embedding: %v", err)
-		// Fallback to regular search if embedding generation fails
-		log.Warn("Falling back to regular search due to embedding failure")
-		searchReq := &pb.SearchProductsRequest{Query: req.Query}
-		return p.SearchProducts(ctx, searchReq)
-	}
-	
-	// Convert query embedding to PostgreSQL vector format
-	queryEmbeddingStr := embeddingToVectorString(queryEmbedding)
-	log.Infof("Generated query embedding with %d dimensions", len(queryEmbedding))
-
-	// Hybrid search query with weighted similarity scores using precomputed embeddings
-	query := `
-		SELECT p.id, p.name, p.description, p.picture, p.price_usd_currency_code, 
-			   p.price_usd_units, p.price_usd_nanos, p.categories, p.target_tags, p.use_context,
-			   (
-				   COALESCE(p.combined_embedding <=> $1::vector, 1.0) * 0.6 +
-				   COALESCE(p.target_tags_embedding <=> $1::vector, 1.0) * 0.2 +
-				   COALESCE(p.use_context_embedding <=> $1::vector, 1.0) * 0.2
-			   ) as similarity_score
-		FROM products p
-		WHERE p.combined_embedding IS NOT NULL
-		ORDER BY similarity_score ASC
-		LIMIT $2
-	`
-
-	log.Infof("Executing semantic search query with params: query='%s', limit=%d", req.Query, limit)
-	log.Infof("Query embedding string (first 100 chars): %s", queryEmbeddingStr[:minInt(100, len(queryEmbeddingStr))])
-	log.Infof("Full SQL query: %s", query)
-	
-	rows, err := db.QueryContext(ctx, query, queryEmbeddingStr, limit)
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		if embeddingFailure.mode != embeddingFailKeyword {
+			return nil, status.Errorf(codes.Unavailable, "failed to embed query: %v", err)
+		}
+		reason := fallbackEmbeddingFailed
+		if embedTimedOut {
+			reason = fallbackEmbeddingTimeout
+		}
+		sl.fallBack(reason, err)
+		return p.keywordSearch(ctx, req, filters, out)
+	}
+	queryEmbedding = personalization.personalize(searchCtx, req, profile, queryEmbedding, sl)
+
+	// $2 is the number of relevant products the query ranks: the results,
+	// or the larger pool facets are counted over.
+	pool := facetPoolSize(req, limit)
+	// A reranked or diversified request retrieves the candidates the
+	// results are picked from. Like reranking, diversification only applies
+	// to relevance order.
+	rerank := reranking.appliesTo(req)
+	diverse := lambda < 1 && req.GetSortBy() == pb.SemanticSearchRequest_RELEVANCE
+	keep := limit
+	if rerank {
+		keep = max(keep, reranking.candidates)
+	}
+	if diverse {
+		keep = max(keep, diversity.candidates)
+	}
+	pool = max(pool, keep)
+	// Reranking, diversification and merchandising reorder the results once
+	// they are all read, so only other searches are streamed as rows are
+	// scanned.
+	if out != nil {
+		out.live = !rerank && !diverse && !merchandisingApplies(queryText)
+	}
+	filterSQL, args := filters.where([]interface{}{pgvector.NewVector(queryEmbedding), pool,
+		weights.Combined, weights.TargetTags, weights.UseContext, maxDistance})
+	modelSQL, args := embeddingModelFilter(args)
+	filterSQL += modelSQL
+	from, vectorFilterSQL, args := vectorIndex.candidateSource(filterSQL, args)
+	ranking, args := variant.popularity().ranking(args)
+	ranking, args = inventory.demote(ranking, args)
+	ranking, args = boostCampaigns(ranking, args)
+
+	var query string
+	if fusion := variant.fusion(); fusion.enabled() {
+		query, args = fusion.query(queryText, pool, req.GetSortBy(), ranking, from, vectorFilterSQL, filterSQL, args)
+		sl.set("fusion", fusion.mode)
+	} else {
+		// Hybrid search query with weighted similarity scores using
+		// precomputed embeddings. The inner query picks the most relevant
+		// products; the outer one drops those past the distance cutoff ($6,
+		// 0 for none) and applies the order.
+		query = `
+		SELECT ` + resultColumnsSQL + `
+		FROM (
+			SELECT p.id, p.name, p.description, p.picture, p.price_usd_currency_code,
+				   p.price_usd_units, p.price_usd_nanos, p.categories, p.target_tags, p.use_context,
+				   p.status, p.stock, p.created_at, ` + weightedDistanceSQL + ` AS distance, ` + ranking.score + ` AS similarity_score,
+				   ` + scoreColumnsSQL + `, NULL::float8 AS keyword_score, ` + ranking.popularity + ` AS popularity
+			FROM ` + from + ranking.join + `
+			WHERE p.combined_embedding IS NOT NULL` + vectorFilterSQL + `
+			ORDER BY similarity_score ASC
+			LIMIT $2
+		) ranked
+		WHERE $6::float8 <= 0 OR distance <= $6::float8
+		ORDER BY ` + sortOrderSQL(req.GetSortBy())
+	}
+	sl.debug("Semantic search SQL: %s", query)
+
+	queryStart := time.Now()
+	queryCtx, cancelQuery := withStepTimeout(searchCtx, searchTimeout.query)
+	defer cancelQuery()
+	rows, done, err := vectorIndex.query(queryCtx, readDB(), query, args...)
 	if err != nil {
-		log.Errorf("Semantic search query failed: %v", err)
-		// Fallback to regular search
-		searchReq := &pb.SearchProductsRequest{Query: req.Query}
-		return p.SearchProducts(ctx, searchReq)
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		reason := fallbackQueryFailed
+		if timedOut(ctx, queryCtx) {
+			reason = fallbackQueryTimeout
+		}
+		sl.fallBack(reason, err)
+		return p.keywordSearch(ctx, req, filters, out)
 	}
-	defer rows.Close()
-	log.Infof("Query executed successfully, processing rows...")
+	defer done()
 
-	var products []*pb.Product
-	rowCount := 0
+	products := make([]*pb.Product, 0, limit)
+	var pooled []*pb.Product
+	budget := responseBudget{remaining: maxSearchResponseBytes}
+	truncated := false
+	skipped := 0
+	var scores []*pb.SearchDebug_ResultScores
 	for rows.Next() {
-		rowCount++
-		log.Infof("Processing row %d", rowCount)
-		
 		var product pb.Product
-		product.PriceUsd = &pb.Money{} // Initialize PriceUsd to avoid nil pointer
-		log.Infof("PriceUsd initialized: %p", product.PriceUsd)
-		
-		var categories, targetTags, useContext string
+		product.PriceUsd = &pb.Money{}
+		var categories, targetTags, useContext, productStatus string
+		var stock sql.NullInt32
 		var similarityScore float64
+		var combinedDistance, targetTagsDistance, useContextDistance, keywordScore, popularityScore sql.NullFloat64
+		var relevanceRank int64
 
-		log.Infof("About to scan row %d...", rowCount)
 		err := rows.Scan(
 			&product.Id,
 			&product.Name,
@@ -284,134 +537,368 @@ func (p *productCatalog) SemanticSearchProducts(ctx context.Context, req *pb.Sem
 			&categories,
 			&targetTags,
 			&useContext,
+			&productStatus,
+			&stock,
 			&similarityScore,
+			&combinedDistance,
+			&targetTagsDistance,
+			&useContextDistance,
+			&keywordScore,
+			&popularityScore,
+			&relevanceRank,
 		)
-		log.Infof("Row %d scan completed", rowCount)
 		if err != nil {
-			log.Errorf("Failed to scan product row %d: %v", rowCount, err)
+			sl.debug("Skipping product row that failed to scan: %v", err)
+			skipped++
 			continue
 		}
-		log.Infof("Row %d scanned successfully - ID: %s, Name: %s", rowCount, product.Id, product.Name)
-
-		// Parse categories
-		log.Infof("Parsing categories for row %d: '%s'", rowCount, categories)
-		if categories != "" {
-			product.Categories = strings.Split(strings.Trim(categories, "{}"), ",")
+		product.Categories = splitCategories(categories)
+		product.TargetTags = splitPostgresList(targetTags)
+		product.UseContext = splitPostgresList(useContext)
+		product.Status, _ = parseProductStatus(productStatus)
+		if stock.Valid {
+			product.Stock = &stock.Int32
 		}
 
-		// Parse target_tags
-		log.Infof("Parsing target_tags for row %d: '%s'", rowCount, targetTags)
-		if targetTags != "" {
-			product.TargetTags = strings.Split(strings.Trim(targetTags, "{}"), ",")
+		if req.GetIncludeFacets() {
+			pooled = append(pooled, &product)
 		}
-
-		// Parse use_context
-		log.Infof("Parsing use_context for row %d: '%s'", rowCount, useContext)
-		if useContext != "" {
-			product.UseContext = strings.Split(strings.Trim(useContext, "{}"), ",")
+		// Rows come in the requested order; only the limit most relevant,
+		// or the rerank candidates, are kept, the rest of the pool is
+		// counted in the facets.
+		if relevanceRank > int64(keep) || truncated {
+			continue
+		}
+		if out != nil && out.live {
+			// Each message is small, so streamed results have no
+			// response budget.
+			if err := out.add(&product); err != nil {
+				return nil, err
+			}
+		} else {
+			if !budget.take(&product) {
+				truncated = true
+				continue
+			}
+			products = append(products, &product)
+		}
+		if req.GetDebug() {
+			scores = append(scores, &pb.SearchDebug_ResultScores{
+				ProductId:          product.Id,
+				CombinedDistance:   nullFloat(combinedDistance),
+				TargetTagsDistance: nullFloat(targetTagsDistance),
+				UseContextDistance: nullFloat(useContextDistance),
+				KeywordScore:       nullFloat(keywordScore),
+				Popularity:         nullFloat(popularityScore),
+				Score:              similarityScore,
+			})
 		}
-
-		log.Infof("About to append product %d to results...", rowCount)
-		products = append(products, &product)
-		log.Infof("Product %d appended successfully", rowCount)
 	}
-
-	log.Infof("Finished processing rows, checking for row errors...")
+	if skipped > 0 {
+		sl.set("skipped_rows", skipped)
+	}
 	if err = rows.Err(); err != nil {
-		log.Errorf("Row iteration error: %v", err)
-		return nil, status.Errorf(codes.Internal, "database error: %v", err)
+		switch {
+		case timedOut(ctx, queryCtx) && out.streamed() > 0:
+			// The results already streamed stand; falling back would
+			// send them again.
+			sl.set("query_timeout", err.Error())
+			truncated = true
+		case timedOut(ctx, queryCtx):
+			sl.fallBack(fallbackQueryTimeout, err)
+			return p.keywordSearch(ctx, req, filters, out)
+		default:
+			return nil, status.Errorf(codes.Internal, "database error: %v", err)
+		}
+	}
+	sl.step("query", time.Since(queryStart))
+	if rerank {
+		// Diversification picks the results from the reranked candidates.
+		picks := limit
+		if diverse {
+			picks = keep
+		}
+		products, scores = reranking.rerank(searchCtx, queryText, products, scores, picks, sl)
+	}
+	if diverse {
+		products, scores = diversify(searchCtx, products, scores, lambda, limit, sl)
+	}
+	resp := &pb.SearchProductsResponse{Results: products, Truncated: truncated}
+	if req.GetIncludeFacets() {
+		resp.Facets = computeFacets(pooled)
+	}
+	if req.GetDebug() {
+		resp.Debug = &pb.SearchDebug{
+			Weights: &pb.HybridSearchWeights{Combined: weights.Combined, TargetTags: weights.TargetTags, UseContext: weights.UseContext},
+			Scores:  scores,
+		}
+	}
+	return resp, nil
+}
+
+// keywordSearch is the fallback for SemanticSearchProducts when semantic
+// search is unavailable. It applies the request filters and sort order to the
+// keyword matches so callers get the same kind of results either way, and
+// the same limit and response budget: the facets count every match, but
+// only the first limit that fit in maxSearchResponseBytes are returned.
+func (p *productCatalog) keywordSearch(ctx context.Context, req *pb.SemanticSearchRequest, filters *searchFilters, out *searchStream) (*pb.SearchProductsResponse, error) {
+	resp, err := p.SearchProducts(ctx, &pb.SearchProductsRequest{Query: req.Query, IncludeInactive: req.GetIncludeInactive()})
+	if err != nil {
+		return nil, err
+	}
+	results := resp.Results[:0]
+	for _, product := range resp.Results {
+		if filters.match(product) {
+			results = append(results, product)
+		}
+	}
+	resp.Results = results
+	sortProducts(resp.Results, req.GetSortBy())
+	if req.GetSortBy() == pb.SemanticSearchRequest_RELEVANCE {
+		resp.Results = inventory.demoteOutOfStock(promoteCampaigns(resp.Results))
+	}
+	if req.GetIncludeFacets() {
+		resp.Facets = computeFacets(resp.Results)
 	}
+	if limit := int(out.limit(req.Limit)); len(resp.Results) > limit {
+		resp.Results = resp.Results[:limit]
+	}
+	budget := responseBudget{remaining: maxSearchResponseBytes}
+	for i, product := range resp.Results {
+		if !budget.take(product) {
+			resp.Results, resp.Truncated = resp.Results[:i], true
+			break
+		}
+	}
+	return resp, nil
+}
 
-	log.Infof("Semantic search completed successfully - found %d products for query: %s", len(products), req.Query)
-	return &pb.SearchProductsResponse{Results: products}, nil
+// nullFloat returns the value of f, or nil if it is NULL.
+func nullFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return proto.Float64(f.Float64)
 }
 
-// populateEmbeddings populates embeddings for existing products
+// embeddingBackfillChunkSize is how many products a replica claims per
+// backfill transaction. Their texts are embedded in batches, so a chunk
+// takes a handful of embedding calls rather than one per text.
+const embeddingBackfillChunkSize = 100
+
+// populateEmbeddings embeds products that lack embeddings or whose
+// embeddings are stale. It is safe to run on several replicas at once: each
+// one repeatedly claims a chunk of such products, skipping rows another
+// replica holds, so the replicas split the backfill between them. Products
+// that fail are skipped for the rest of the run and retried by the next one.
 func populateEmbeddings() error {
 	if db == nil {
 		return fmt.Errorf("database not initialized")
 	}
+	ctx := context.Background()
+	if err := ensureProductsSchema(ctx); err != nil {
+		return err
+	}
 
-	// Get all products without embeddings
-	rows, err := db.Query(`
-		SELECT id, name, description, categories, target_tags, use_context 
-		FROM products 
-		WHERE combined_embedding IS NULL
-	`)
+	count := 0
+	var skipped []string
+	for {
+		n, failed, err := backfillEmbeddingChunk(ctx, embeddingBackfillChunkSize, skipped)
+		if err != nil {
+			return err
+		}
+		if n == 0 && len(failed) == 0 {
+			break
+		}
+		skipped = append(skipped, failed...)
+		count += n
+		log.Infof("Updated embeddings for %d products", count)
+	}
+
+	if len(skipped) > 0 {
+		log.Warnf("Updated embeddings for %d products, skipped %d that failed: %v", count, len(skipped), skipped)
+		return nil
+	}
+	log.Infof("Successfully updated embeddings for %d products", count)
+	return nil
+}
+
+// backfillAborts reports whether an embedding error is not specific to the
+// products being embedded, so the backfill stops instead of skipping them:
+// every other product would fail the same way.
+func backfillAborts(err error) bool {
+	return errors.Is(err, errEmbeddingDimensions) || errors.Is(err, errEmbeddingCircuitOpen) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// backfillEmbeddingChunk claims up to size products with missing or stale
+// embeddings, other than those in skip, and fills them in within a single
+// transaction. The rows stay locked until the transaction ends and FOR
+// UPDATE SKIP LOCKED makes concurrent replicas pass over them. A product
+// whose texts cannot be embedded, or whose row cannot be updated, is logged
+// and left as it was, and its ID is returned in failed; the rest of the chunk
+// is still written. It returns the number of products updated; 0 with no
+// failures means no unclaimed work is left.
+func backfillEmbeddingChunk(ctx context.Context, size int, skip []string) (updated int, failed []string, err error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to query products: %v", err)
-	}
-	defer rows.Close()
-
-	updateStmt, err := db.Prepare(`
-		UPDATE products 
-		SET description_embedding = $1::vector,
-			category_embedding = $2::vector,
-			combined_embedding = $3::vector,
-			target_tags_embedding = $4::vector,
-			use_context_embedding = $5::vector
-		WHERE id = $6
-	`)
+		return 0, nil, fmt.Errorf("failed to begin backfill transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, name, description, categories, target_tags, use_context
+		FROM `+productsTable+`
+		WHERE `+staleEmbeddingCondition+`
+			AND id <> ALL(COALESCE($4::text[], '{}'))
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	`, embeddingVersion, embeddingModel(), size, skip)
 	if err != nil {
-		return fmt.Errorf("failed to prepare update statement: %v", err)
+		return 0, nil, fmt.Errorf("failed to claim products: %v", err)
 	}
-	defer updateStmt.Close()
 
-	count := 0
+	pending := make([]pendingProduct, 0, size)
 	for rows.Next() {
-		var id, name, description, categories, targetTags, useContext sql.NullString
-		
-		err := rows.Scan(&id, &name, &description, &categories, &targetTags, &useContext)
-		if err != nil {
-			log.Errorf("Failed to scan product: %v", err)
-			continue
+		var p pendingProduct
+		if err := rows.Scan(&p.id, &p.name, &p.description, &p.categories, &p.targetTags, &p.useContext); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("failed to scan product: %v", err)
 		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to read claimed products: %v", err)
+	}
+	if len(pending) == 0 {
+		return 0, nil, nil
+	}
 
-		// Generate embeddings
-		descEmb := generateEmbedding(description.String)
-		catEmb := generateEmbedding(categories.String)
-		combined := fmt.Sprintf("%s %s %s", name.String, description.String, categories.String)
-		combinedEmb := generateEmbedding(combined)
-		targetEmb := generateEmbedding(targetTags.String)
-		useContextEmb := generateEmbedding(useContext.String)
-
-		// Convert to vector format
-		descEmbStr := embeddingToVectorString(descEmb)
-		catEmbStr := embeddingToVectorString(catEmb)
-		combinedEmbStr := embeddingToVectorString(combinedEmb)
-		targetEmbStr := embeddingToVectorString(targetEmb)
-		useContextEmbStr := embeddingToVectorString(useContextEmb)
+	embeddings, err := embedPendingProducts(ctx, pending)
+	if backfillAborts(err) {
+		return 0, nil, fmt.Errorf("failed to embed claimed products: %v", err)
+	}
+	if err != nil {
+		// Find the products that fail and embed the others.
+		log.Warnf("Embedding %d claimed products failed, embedding them one at a time: %v", len(pending), err)
+		var embedded []pendingProduct
+		embeddings = nil
+		for _, p := range pending {
+			e, err := embedPendingProducts(ctx, []pendingProduct{p})
+			if backfillAborts(err) {
+				return 0, nil, fmt.Errorf("failed to embed claimed products: %v", err)
+			}
+			if err != nil {
+				log.Errorf("Skipping product %s in the embedding backfill: %v", p.id.String, err)
+				failed = append(failed, p.id.String)
+				continue
+			}
+			embedded = append(embedded, p)
+			embeddings = append(embeddings, e...)
+		}
+		pending = embedded
+	}
 
-		// Update database
-		_, err = updateStmt.Exec(descEmbStr, catEmbStr, combinedEmbStr, targetEmbStr, useContextEmbStr, id.String)
-		if err != nil {
-			log.Errorf("Failed to update embeddings for product %s: %v", id.String, err)
+	// Each product is written under a savepoint, so a row that cannot be
+	// updated is rolled back alone.
+	for i, p := range pending {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT backfill_product`); err != nil {
+			return 0, nil, fmt.Errorf("failed to set savepoint: %v", err)
+		}
+		e := embeddings[i*textsPerProduct : (i+1)*textsPerProduct]
+		if err := storeProductEmbeddings(ctx, tx, pending[i:i+1], e); err != nil {
+			log.Errorf("Skipping product %s in the embedding backfill: %v", p.id.String, err)
+			failed = append(failed, p.id.String)
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT backfill_product`); err != nil {
+				return 0, nil, fmt.Errorf("failed to roll back to savepoint: %v", err)
+			}
 			continue
 		}
-
-		count++
-		if count%10 == 0 {
-			log.Infof("Updated embeddings for %d products", count)
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT backfill_product`); err != nil {
+			return 0, nil, fmt.Errorf("failed to release savepoint: %v", err)
 		}
+		updated++
 	}
 
-	log.Infof("Successfully updated embeddings for %d products", count)
-	return nil
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("failed to commit backfill chunk: %v", err)
+	}
+	return updated, failed, nil
+}
+
+// pendingProduct holds the embedded text columns of a product, as read from
+// the products table.
+type pendingProduct struct {
+	id, name, description, categories, targetTags, useContext sql.NullString
 }
 
-// embeddingToVectorString converts float32 slice to PostgreSQL vector string
-func embeddingToVectorString(embedding []float32) string {
-	strs := make([]string, len(embedding))
-	for i, v := range embedding {
-		strs[i] = fmt.Sprintf("%.6f", v)
+// textsPerProduct is how many texts embedPendingProducts embeds per product,
+// one per embedding column.
+const textsPerProduct = 5
+
+// embedPendingProducts embeds the texts of products in as few calls as
+// possible. The result holds textsPerProduct embeddings per product, in the
+// order of the storeProductEmbeddings UPDATE parameters.
+func embedPendingProducts(ctx context.Context, pending []pendingProduct) ([][]float32, error) {
+	texts := make([]string, 0, textsPerProduct*len(pending))
+	for _, p := range pending {
+		combined := fmt.Sprintf("%s %s %s", p.name.String, p.description.String, p.categories.String)
+		texts = append(texts, p.description.String, p.categories.String, combined, p.targetTags.String, p.useContext.String)
 	}
-	return fmt.Sprintf("[%s]", strings.Join(strs, ","))
+	return generateEmbeddings(ctx, texts)
 }
 
-// minInt returns the minimum of two integers
-func minInt(a, b int) int {
-	if a < b {
-		return a
+// storeProductEmbeddings writes the embeddings from embedPendingProducts and
+// marks the products as embedded with the current embeddingVersion and
+// embeddingModel. The nil embeddings of blank texts are stored as NULL.
+func storeProductEmbeddings(ctx context.Context, tx *sql.Tx, pending []pendingProduct, embeddings [][]float32) error {
+	// Mismatched vectors are refused before anything is written.
+	if len(embeddings) != textsPerProduct*len(pending) {
+		return fmt.Errorf("got %d embeddings for %d products, want %d", len(embeddings), len(pending), textsPerProduct*len(pending))
+	}
+	vectors := make([]interface{}, len(embeddings))
+	for i, e := range embeddings {
+		if e == nil {
+			continue
+		}
+		if err := checkEmbeddingDimensions(e); err != nil {
+			return fmt.Errorf("refusing to store embedding %d: %v", i, err)
+		}
+		vectors[i] = pgvector.NewVector(e)
+	}
+	updateStmt, err := tx.PrepareContext(ctx, `
+		UPDATE `+productsTable+` 
+		SET description_embedding = $1,
+			category_embedding = $2,
+			combined_embedding = $3,
+			target_tags_embedding = $4,
+			use_context_embedding = $5,
+			embedded_at = now(),
+			embedding_version = $6,
+			embedding_model = $7
+		WHERE id = $8
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare update statement: %v", err)
+	}
+	defer updateStmt.Close()
+
+	for i, p := range pending {
+		e := vectors[i*textsPerProduct : (i+1)*textsPerProduct]
+		_, err := updateStmt.ExecContext(ctx,
+			e[0],
+			e[1],
+			e[2],
+			e[3],
+			e[4],
+			embeddingVersion,
+			embeddingModel(),
+			p.id.String)
+		if err != nil {
+			return fmt.Errorf("failed to update embeddings for product %s: %v", p.id.String, err)
+		}
 	}
-	return b
-} 
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,1776 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"github.com/pgvector/pgvector-go"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// setupIntegrationDB starts Postgres with pgvector in a container, applies
+// the products schema, seeds it from products.json and backfills embeddings
+// with the stub embedder. The global db points at the container for the
+// duration of the test. It returns the container's connection string.
+func setupIntegrationDB(t *testing.T) string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	ctr, err := postgres.Run(ctx, "pgvector/pgvector:pg16",
+		postgres.WithDatabase("products"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		postgres.WithInitScripts("testdata/products_schema.sql"),
+		postgres.BasicWaitStrategies())
+	testcontainers.CleanupContainer(t, ctr)
+	if err != nil {
+		t.Fatalf("failed to start pgvector container: %v", err)
+	}
+
+	dsn, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := openVectorDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = conn
+	dbReady.Store(true)
+	productsSchemaReady.Store(false) // each test gets a fresh database
+	trigramsReady.Store(false)
+	interactionsReady.Store(false)
+	searchEventsReady.Store(false)
+	merchandisingReady.Store(false)
+	campaignsReady.Store(false)
+	t.Cleanup(func() {
+		dbReady.Store(false)
+		categories.Store(nil)
+		conn.Close()
+		db = nil
+	})
+
+	var catalog pb.ListProductsResponse
+	if err := loadCatalogFromLocalFile(&catalog); err != nil {
+		t.Fatalf("failed to load products.json: %v", err)
+	}
+	for _, p := range catalog.Products {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO products (id, name, description, picture, price_usd_currency_code,
+				price_usd_units, price_usd_nanos, categories, target_tags, use_context)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			p.Id, p.Name, p.Description, p.Picture, p.PriceUsd.GetCurrencyCode(),
+			p.PriceUsd.GetUnits(), p.PriceUsd.GetNanos(), strings.Join(p.Categories, ","),
+			p.TargetTags, p.UseContext)
+		if err != nil {
+			t.Fatalf("failed to seed product %s: %v", p.Id, err)
+		}
+	}
+	if err := ensureProductsSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range catalog.Products {
+		if err := writeVariants(ctx, tx, p); err != nil {
+			t.Fatalf("failed to seed variants of %s: %v", p.Id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("EMBEDDING_MODE", embeddingModeStub)
+	if err := populateEmbeddings(); err != nil {
+		t.Fatalf("failed to backfill embeddings: %v", err)
+	}
+	return dsn
+}
+
+func TestIntegrationSemanticSearchRanksExactName(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+
+	var catalog pb.ListProductsResponse
+	if err := loadCatalogFromLocalFile(&catalog); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range catalog.Products {
+		resp, err := svc.SemanticSearchProducts(context.Background(),
+			&pb.SemanticSearchRequest{Query: want.Name + " " + want.Description, Limit: 3})
+		if err != nil {
+			t.Fatalf("SemanticSearchProducts(%q) failed: %v", want.Name, err)
+		}
+		var ids []string
+		for _, p := range resp.Results {
+			ids = append(ids, p.Id)
+		}
+		if !strings.Contains(fmt.Sprint(ids), want.Id) {
+			t.Errorf("SemanticSearchProducts(%q): got %v, want %s in the top 3", want.Name, ids, want.Id)
+		}
+	}
+}
+
+func TestIntegrationSemanticSearchFilters(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+
+	maxPrice := &pb.Money{CurrencyCode: "USD", Units: 20}
+	resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+		Query:       "something for the home",
+		Limit:       50,
+		Categories:  []string{"Kitchen"},
+		MaxPriceUsd: maxPrice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) == 0 {
+		t.Fatal("expected kitchen products under $20")
+	}
+	for _, p := range resp.Results {
+		if !strings.Contains(fmt.Sprint(p.Categories), "kitchen") {
+			t.Errorf("%s has categories %v, want kitchen", p.Id, p.Categories)
+		}
+		if p.PriceUsd.Units > maxPrice.Units || (p.PriceUsd.Units == maxPrice.Units && p.PriceUsd.Nanos > 0) {
+			t.Errorf("%s costs %d.%09d, want at most %d", p.Id, p.PriceUsd.Units, p.PriceUsd.Nanos, maxPrice.Units)
+		}
+	}
+}
+
+func TestIntegrationSemanticSearchMaxDistance(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+
+	resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+		Query:       "jet engine turbine",
+		Limit:       10,
+		MaxDistance: proto.Float64(0.01),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 0 {
+		t.Errorf("got %d results past a tight cutoff, want none", len(resp.Results))
+	}
+}
+
+func TestIntegrationSemanticSearchSortByPrice(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+
+	resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+		Query:       "something for the home",
+		Limit:       10,
+		MaxPriceUsd: &pb.Money{CurrencyCode: "USD", Units: 50},
+		SortBy:      pb.SemanticSearchRequest_PRICE_ASC,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) < 2 {
+		t.Fatalf("got %d results, want several products under $50", len(resp.Results))
+	}
+	for i := 1; i < len(resp.Results); i++ {
+		if priceNanos(resp.Results[i]) < priceNanos(resp.Results[i-1]) {
+			t.Errorf("result %d (%s) is cheaper than result %d (%s)", i, resp.Results[i].Id, i-1, resp.Results[i-1].Id)
+		}
+	}
+}
+
+func TestIntegrationApproximateSearchUsesHNSWIndex(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+	ctx := context.Background()
+	req := &pb.SemanticSearchRequest{Query: "vintage camera for photography", Limit: 3}
+
+	exact, err := svc.SemanticSearchProducts(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(s vectorIndexSettings) { vectorIndex = s }(vectorIndex)
+	vectorIndex = vectorIndexSettings{approximate: true, m: 16, efConstruction: 64, efSearch: 40, candidates: 100}
+	if err := ensureVectorIndex(ctx, vectorIndex); err != nil {
+		t.Fatal(err)
+	}
+	var valid bool
+	err = db.QueryRowContext(ctx, `
+		SELECT i.indisvalid FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+		WHERE c.relname = $1`, hnswIndexName).Scan(&valid)
+	if err != nil || !valid {
+		t.Fatalf("index %s: valid %v, %v", hnswIndexName, valid, err)
+	}
+
+	approx, err := svc.SemanticSearchProducts(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The catalog is far smaller than the candidate count, so the index
+	// returns every product and the ranking must match the exact one.
+	ids := func(products []*pb.Product) (ids []string) {
+		for _, p := range products {
+			ids = append(ids, p.Id)
+		}
+		return ids
+	}
+	if got, want := fmt.Sprint(ids(approx.Results)), fmt.Sprint(ids(exact.Results)); got != want {
+		t.Errorf("approximate search got %s, exact got %s", got, want)
+	}
+}
+
+func TestIntegrationQuantizedApproximateSearch(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+	ctx := context.Background()
+	req := &pb.SemanticSearchRequest{Query: "vintage camera for photography", Limit: 3}
+
+	exact, err := svc.SemanticSearchProducts(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(s vectorIndexSettings) { vectorIndex = s }(vectorIndex)
+	for _, quantization := range []string{quantizeHalfvec, quantizeBinary} {
+		vectorIndex = vectorIndexSettings{approximate: true, m: 16, efConstruction: 64, efSearch: 40,
+			candidates: 100, quantization: quantization}
+		if err := ensureVectorIndex(ctx, vectorIndex); err != nil {
+			t.Fatalf("%s: %v", quantization, err)
+		}
+		approx, err := svc.SemanticSearchProducts(ctx, req)
+		if err != nil {
+			t.Fatalf("%s: %v", quantization, err)
+		}
+		// Every product is a candidate and candidates are re-ranked at full
+		// precision, so quantization must not change the ranking.
+		if got, want := fmt.Sprint(approx.Results), fmt.Sprint(exact.Results); got != want {
+			t.Errorf("%s: got %s, want %s", quantization, got, want)
+		}
+	}
+}
+
+func TestIntegrationPgxpoolVectorQueries(t *testing.T) {
+	dsn := setupIntegrationDB(t)
+	s := dbPoolSettings{driver: dbPoolPgx, maxOpenConns: 4, connMaxLifetime: time.Minute, maxOpenConnsSet: true, connMaxLifetimeSet: true}
+	conn, err := s.open(dsn, secretCredentials(func() (string, error) { return "postgres", nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Concurrent vector queries share the four pooled connections. A failed
+	// search would fall back to keyword search, so query directly.
+	query := stubEmbedding("vintage camera", stubEmbeddingSeed())
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var n int
+			err := conn.QueryRowContext(context.Background(),
+				`SELECT count(*) FROM products WHERE combined_embedding <=> $1 < 2`,
+				pgvector.NewVector(query)).Scan(&n)
+			if err == nil && n == 0 {
+				err = fmt.Errorf("no products within distance 2")
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestIntegrationStatementCache(t *testing.T) {
+	dsn := setupIntegrationDB(t)
+	query := `SELECT count(*) FROM products WHERE combined_embedding <=> $1 < 2`
+	embedding := pgvector.NewVector(stubEmbedding("vintage camera", stubEmbeddingSeed()))
+	for _, tc := range []struct {
+		cache, want int
+	}{
+		{512, 1},
+		{0, 0},
+	} {
+		s := dbPoolSettings{driver: dbPoolSQL, maxOpenConns: 1, connMaxLifetime: time.Minute, statementCache: tc.cache, statementCacheSet: true}
+		conn, err := s.open(dsn, secretCredentials(func() (string, error) { return "postgres", nil }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Both calls use the one connection, which prepares the query at
+		// most once.
+		for i := 0; i < 2; i++ {
+			var n int
+			if err := conn.QueryRowContext(context.Background(), query, embedding).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var prepared int
+		err = conn.QueryRowContext(context.Background(),
+			`SELECT count(*) FROM pg_prepared_statements WHERE statement = $1`, query).Scan(&prepared)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prepared != tc.want {
+			t.Errorf("statement cache %d: %d prepared statements, want %d", tc.cache, prepared, tc.want)
+		}
+	}
+}
+
+func TestIntegrationKeywordFusionRanksNameMatchFirst(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+	defer func(f keywordFusion) { searchFusion = f }(searchFusion)
+	// A failed fusion query would be served from keyword search, which also
+	// finds the Mug; the summary log tells the two apart.
+	defer func(l *logrus.Logger) { log = l }(log)
+	var hook *logtest.Hook
+	log, hook = logtest.NewNullLogger()
+
+	for _, mode := range []string{fusionRRF, fusionWeighted} {
+		searchFusion = keywordFusion{mode: mode, rrfK: 60, keywordWeight: 0.5}
+		resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+			Query:      "mug",
+			Limit:      3,
+			Categories: []string{"kitchen"},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if e := hook.LastEntry(); e.Data["fallback"] != nil || e.Data["fusion"] != mode {
+			t.Fatalf("%s: not served by fusion: %s %v", mode, e.Message, e.Data)
+		}
+		if len(resp.Results) == 0 || resp.Results[0].Id != "6E92ZMYYFZ" {
+			t.Errorf("%s: got %v, want the Mug (6E92ZMYYFZ) first", mode, resp.Results)
+		}
+		for _, p := range resp.Results {
+			if !strings.Contains(fmt.Sprint(p.Categories), "kitchen") {
+				t.Errorf("%s: %s has categories %v, want kitchen", mode, p.Id, p.Categories)
+			}
+		}
+	}
+}
+
+func TestIntegrationSemanticSearchDebug(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+	defer func(f keywordFusion) { searchFusion = f }(searchFusion)
+
+	for _, mode := range []string{fusionOff, fusionWeighted} {
+		searchFusion = keywordFusion{mode: mode, rrfK: 60, keywordWeight: 0.5}
+		resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+			Query: "mug",
+			Limit: 3,
+			Debug: true,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		d := resp.Debug
+		if d.GetFallback() != "" || len(d.GetScores()) != len(resp.Results) {
+			t.Fatalf("%s: got debug %v for %d results", mode, d, len(resp.Results))
+		}
+		for i, s := range d.Scores {
+			if s.ProductId != resp.Results[i].Id || s.CombinedDistance == nil {
+				t.Errorf("%s: scores %d = %v, want the combined distance of %s", mode, i, s, resp.Results[i].Id)
+			}
+		}
+		top := d.Scores[0]
+		switch mode {
+		case fusionOff:
+			w := d.Weights
+			want := top.GetCombinedDistance()*w.Combined + top.GetTargetTagsDistance()*w.TargetTags + top.GetUseContextDistance()*w.UseContext
+			if top.KeywordScore != nil || math.Abs(top.Score-want) > 1e-9 {
+				t.Errorf("%s: top score %v, want the weighted distance %v and no keyword score", mode, top, want)
+			}
+		case fusionWeighted:
+			if top.ProductId != "6E92ZMYYFZ" || top.GetKeywordScore() <= 0 {
+				t.Errorf("%s: top score %v, want a keyword score for the Mug (6E92ZMYYFZ)", mode, top)
+			}
+		}
+	}
+}
+
+func TestIntegrationSuggestProducts(t *testing.T) {
+	setupIntegrationDB(t)
+	if err := ensureSuggestSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svc := &productCatalog{}
+
+	for query, want := range map[string]string{
+		"sun":       "Sunglasses",       // prefix
+		"glass":     "Bamboo Glass Jar", // word prefix
+		"hairdrier": "Hairdryer",        // misspelled
+		"kitch":     "kitchen",          // category
+	} {
+		resp, err := svc.SuggestProducts(context.Background(), &pb.SuggestProductsRequest{Query: query})
+		if err != nil {
+			t.Fatalf("SuggestProducts(%q): %v", query, err)
+		}
+		if len(resp.Suggestions) == 0 || resp.Suggestions[0].Text != want {
+			t.Errorf("SuggestProducts(%q) = %v, want %q first", query, resp.Suggestions, want)
+		}
+	}
+}
+
+func TestIntegrationTrigramKeywordSearch(t *testing.T) {
+	setupIntegrationDB(t)
+	if err := ensureSuggestSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svc := &productCatalog{}
+
+	for query, want := range map[string]string{
+		"Sunglases": "OLJCESPC7Z", // misspelled
+		"glass jar": "9SIQT8TOJO", // exact
+		"hairdrier": "2ZYFJ3GM2N", // misspelled
+	} {
+		resp, err := svc.SearchProducts(context.Background(), &pb.SearchProductsRequest{Query: query})
+		if err != nil {
+			t.Fatalf("SearchProducts(%q): %v", query, err)
+		}
+		if len(resp.Results) == 0 || resp.Results[0].Id != want {
+			t.Errorf("SearchProducts(%q) = %v, want %s first", query, resp.Results, want)
+		}
+	}
+
+	// The semantic search fallback goes through the same search.
+	defer func(t searchTimeouts) { searchTimeout = t }(searchTimeout)
+	searchTimeout = searchTimeouts{query: time.Nanosecond}
+	resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "sunglases", Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Debug.GetFallback() != fallbackQueryTimeout || len(resp.Results) == 0 || resp.Results[0].Id != "OLJCESPC7Z" {
+		t.Errorf("fallback %q results %v, want the sunglasses first", resp.Debug.GetFallback(), resp.Results)
+	}
+}
+
+func TestIntegrationSemanticSearchSuggestsSpelling(t *testing.T) {
+	setupIntegrationDB(t)
+	if err := ensureSuggestSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svc := &productCatalog{}
+
+	resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+		Query:       "sunglases kitchn",
+		MaxDistance: proto.Float64(0.01),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 0 {
+		t.Fatalf("got %d results past a tight cutoff, want none", len(resp.Results))
+	}
+	if want := "sunglasses kitchen"; resp.SuggestedQuery != want {
+		t.Errorf("suggested %q, want %q", resp.SuggestedQuery, want)
+	}
+}
+
+func TestIntegrationSemanticSearchFacets(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+
+	resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{
+		Query:         "something for the home",
+		Limit:         2,
+		SortBy:        pb.SemanticSearchRequest_PRICE_ASC,
+		IncludeFacets: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("got %d results, want the limit of 2", len(resp.Results))
+	}
+	// The pool covers the whole seeded catalog, not only the page.
+	var catalog pb.ListProductsResponse
+	if err := loadCatalogFromLocalFile(&catalog); err != nil {
+		t.Fatal(err)
+	}
+	var counted int32
+	for _, b := range resp.GetFacets().GetPriceBuckets() {
+		counted += b.Count
+	}
+	if int(counted) != len(catalog.Products) {
+		t.Errorf("price buckets count %d products, want all %d", counted, len(catalog.Products))
+	}
+	if len(resp.GetFacets().GetCategories()) == 0 || resp.Facets.Categories[0].Value != "kitchen" {
+		t.Errorf("got categories %v, want kitchen, the most common, first", resp.GetFacets().GetCategories())
+	}
+}
+
+func TestIntegrationSemanticSearchQueryTimeout(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+	defer func(t searchTimeouts) { searchTimeout = t }(searchTimeout)
+	searchTimeout = searchTimeouts{query: time.Nanosecond}
+	defer func(l *logrus.Logger) { log = l }(log)
+	var hook *logtest.Hook
+	log, hook = logtest.NewNullLogger()
+
+	resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: "mug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hook.LastEntry().Data["fallback"]; got != fallbackQueryTimeout {
+		t.Errorf("fallback %v, want %s", got, fallbackQueryTimeout)
+	}
+	if len(resp.Results) == 0 {
+		t.Error("expected keyword results for mug")
+	}
+}
+
+func TestIntegrationConcurrentBackfillSplitsWork(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+
+	res, err := db.ExecContext(ctx, `UPDATE products SET combined_embedding = NULL`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := res.RowsAffected()
+
+	const replicas = 3
+	counts := make([]int, replicas)
+	errs := make(chan error, replicas)
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				n, _, err := backfillEmbeddingChunk(ctx, 2, nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if n == 0 {
+					return
+				}
+				counts[i] += n
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("backfill failed: %v", err)
+	}
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if int64(total) != want {
+		t.Errorf("replicas updated %d products in total (%v), want %d", total, counts, want)
+	}
+	var remaining int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM products WHERE combined_embedding IS NULL`).Scan(&remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Errorf("%d products still lack embeddings", remaining)
+	}
+}
+
+func TestIntegrationReconcileReembedsChangedProducts(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+
+	const id = "OLJCESPC7Z" // Sunglasses
+	if _, err := db.ExecContext(ctx, `UPDATE products SET description = 'A heavy cast iron skillet.' WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	var stale int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM products WHERE `+staleEmbeddingCondition, embeddingVersion, embeddingModel()).Scan(&stale); err != nil {
+		t.Fatal(err)
+	}
+	if stale != 1 {
+		t.Fatalf("%d products are stale after editing one, want 1", stale)
+	}
+
+	n, _, err := backfillEmbeddingChunk(ctx, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("re-embedded %d products, want 1", n)
+	}
+	var description pgvector.Vector
+	if err := db.QueryRowContext(ctx, `SELECT description_embedding FROM products WHERE id = $1`, id).Scan(&description); err != nil {
+		t.Fatal(err)
+	}
+	if want := stubEmbedding("A heavy cast iron skillet.", 0); !reflect.DeepEqual(description.Slice(), want) {
+		t.Error("description embedding was not recomputed from the new description")
+	}
+}
+
+func TestIntegrationBackfillSkipsFailingProducts(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+
+	// The constraint only applies to new row versions, so the Sunglasses row
+	// can no longer be marked embedded while the others can.
+	const id = "OLJCESPC7Z" // Sunglasses
+	for _, stmt := range []string{
+		fmt.Sprintf(`ALTER TABLE products ADD CONSTRAINT no_sunglasses CHECK (id <> '%s' OR embedding_version IS NULL) NOT VALID`, id),
+		`UPDATE products SET embedding_version = NULL`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := populateEmbeddings(); err != nil {
+		t.Fatalf("backfill failed on one bad product: %v", err)
+	}
+	var stale []string
+	rows, err := db.QueryContext(ctx, `SELECT id FROM products WHERE `+staleEmbeddingCondition, embeddingVersion, embeddingModel())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		stale = append(stale, s)
+	}
+	if len(stale) != 1 || stale[0] != id {
+		t.Errorf("stale products after the backfill = %v, want only %s", stale, id)
+	}
+}
+
+func TestIntegrationEmbeddingModelChange(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	svc := &productCatalog{}
+	search := func() int {
+		t.Helper()
+		resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "sunglasses"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(resp.Results)
+	}
+	if search() == 0 {
+		t.Fatal("no results before the model change")
+	}
+
+	t.Setenv("EMBEDDING_STUB_SEED", "1") // another vector space
+	foreign, err := countForeignEmbeddings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foreign != 9 {
+		t.Errorf("%d products embedded with another model, want 9", foreign)
+	}
+	if n := search(); n != 0 {
+		t.Errorf("got %d results mixing embedding models, want none", n)
+	}
+
+	if err := populateEmbeddings(); err != nil {
+		t.Fatal(err)
+	}
+	if foreign, _ := countForeignEmbeddings(ctx); foreign != 0 {
+		t.Errorf("%d products still embedded with another model after re-embedding", foreign)
+	}
+	if search() == 0 {
+		t.Error("no results after re-embedding with the new model")
+	}
+}
+
+func TestIntegrationPersonalizedSearch(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	if err := ensureInteractionsSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s personalizationSettings) { personalization = s }(personalization)
+	personalization = personalizationSettings{weight: 0.6, halfLife: time.Hour, interactions: 50}
+
+	svc := &productCatalog{}
+	history := map[string][]string{
+		"cook":    {"6E92ZMYYFZ", "9SIQT8TOJO", "LS4PSXUNUM"}, // Mug, Bamboo Glass Jar, Salt & Pepper Shakers
+		"stylist": {"OLJCESPC7Z", "1YMWWN1N4O"},               // Sunglasses, Watch
+	}
+	for user, ids := range history {
+		for _, id := range ids {
+			_, err := svc.RecordProductInteraction(ctx, &pb.ProductInteraction{
+				UserId: user, ProductId: id, Kind: pb.ProductInteraction_PURCHASE})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	top := func(user string) *pb.Product {
+		t.Helper()
+		resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "a gift", Limit: 3, UserId: user})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Results) == 0 {
+			t.Fatalf("no results for %s", user)
+		}
+		return resp.Results[0]
+	}
+	if got := top("cook"); !anyTermIn([]string{"kitchen"}, got.Categories) {
+		t.Errorf("cook's top result is %s %v, want a kitchen product", got.Name, got.Categories)
+	}
+	if got := top("stylist"); !anyTermIn([]string{"accessories"}, got.Categories) {
+		t.Errorf("stylist's top result is %s %v, want an accessory", got.Name, got.Categories)
+	}
+}
+
+func TestIntegrationPopularityRanking(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	if err := ensureInteractionsSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s popularitySettings) { popularity = s }(popularity)
+	popularity = popularitySettings{weight: 0.9, window: time.Hour, refresh: time.Hour}
+
+	svc := &productCatalog{}
+	for _, kind := range []pb.ProductInteraction_Kind{pb.ProductInteraction_PURCHASE, pb.ProductInteraction_PURCHASE, pb.ProductInteraction_VIEW} {
+		_, err := svc.RecordProductInteraction(ctx, &pb.ProductInteraction{
+			UserId: "shopper", ProductId: "LS4PSXUNUM", Kind: kind}) // Salt & Pepper Shakers
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.RecordProductInteraction(ctx, &pb.ProductInteraction{
+		UserId: "shopper", ProductId: "9SIQT8TOJO", Kind: pb.ProductInteraction_VIEW}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := popularity.updatePopularity(ctx); err != nil || n != 2 {
+		t.Fatalf("updated %d products (%v), want 2", n, err)
+	}
+
+	resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "mug", Limit: 3, Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := resp.Debug.GetScores()
+	if len(top) < 2 || top[0].ProductId != "LS4PSXUNUM" || top[0].GetPopularity() != 1 ||
+		top[1].ProductId != "9SIQT8TOJO" || top[1].GetPopularity() <= 0 || top[1].GetPopularity() >= 1 {
+		t.Errorf("got scores %v, want the best-seller LS4PSXUNUM first, then 9SIQT8TOJO", top)
+	}
+}
+
+func TestIntegrationReranking(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	defer func(s rerankSettings) { reranking = s }(reranking)
+	var candidates int
+	reranking = rerankSettings{candidates: 50, ranker: rerankFunc(func(_ context.Context, query string, docs []rerankDocument) ([]float64, error) {
+		candidates = len(docs)
+		return rerankByTitle(map[string]float64{"Bamboo Glass Jar": 0.9, "Sunglasses": 0.8})(ctx, query, docs)
+	})}
+
+	svc := &productCatalog{}
+	resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "mug", Limit: 2, Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if candidates <= 2 {
+		t.Errorf("reranked %d candidates, want more than the limit", candidates)
+	}
+	if len(resp.Results) != 2 || resp.Results[0].Id != "9SIQT8TOJO" || resp.Results[1].Id != "OLJCESPC7Z" {
+		t.Errorf("got %v, want the reranker's order", resp.Results)
+	}
+	if scores := resp.Debug.GetScores(); len(scores) != 2 || scores[0].GetRerankScore() != 0.9 {
+		t.Errorf("got scores %v", scores)
+	}
+
+	// Other sort orders are not reranked.
+	candidates = 0
+	if _, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "mug", Limit: 2,
+		SortBy: pb.SemanticSearchRequest_PRICE_ASC}); err != nil {
+		t.Fatal(err)
+	}
+	if candidates != 0 {
+		t.Errorf("a price-ordered search reranked %d candidates", candidates)
+	}
+}
+
+func TestIntegrationSemanticSearchLocalizesResults(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	if err := ensureProductsSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE products SET name_translations = '{"es": "Taza"}',
+			description_translations = '{"es": "Una taza sencilla."}'
+		WHERE id = '6E92ZMYYFZ'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &productCatalog{}
+	resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "mug", Limit: 3, LanguageCode: "es"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mug *pb.Product
+	for _, p := range resp.Results {
+		if p.Id == "6E92ZMYYFZ" {
+			mug = p
+		}
+	}
+	if mug == nil || mug.Name != "Taza" || mug.Description != "Una taza sencilla." || resp.QueryLanguage != "es" {
+		t.Errorf("got %v in %q, want the Spanish mug", mug, resp.QueryLanguage)
+	}
+
+	resp, err = svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "mug", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range resp.Results {
+		if p.Id == "6E92ZMYYFZ" && p.Name != "Mug" {
+			t.Errorf("an English search got the name %q", p.Name)
+		}
+	}
+}
+
+func TestIntegrationSearchEvents(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := ensureInteractionsSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureSearchEventsSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s *searchEventSink) { searchEvents = s }(searchEvents)
+	searchEvents = &searchEventSink{events: make(chan searchEvent, 10)}
+	go searchEvents.run(ctx)
+
+	svc := &productCatalog{}
+	resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "mug", Limit: 3, UserId: "cook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SearchId == "" || len(resp.Results) == 0 {
+		t.Fatalf("got search ID %q and %d results", resp.SearchId, len(resp.Results))
+	}
+	_, err = svc.RecordProductInteraction(ctx, &pb.ProductInteraction{
+		UserId: "cook", ProductId: resp.Results[0].Id, Kind: pb.ProductInteraction_VIEW, SearchId: resp.SearchId})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results, topCount, clicks int
+	var top string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = db.QueryRowContext(ctx, `
+			SELECT e.result_count, cardinality(e.top_product_ids), e.top_product_ids[1], count(i.product_id)
+			FROM search_events e LEFT JOIN product_interactions i ON i.search_id = e.search_id
+			WHERE e.search_id = $1 AND e.user_id = 'cook' AND e.status = 'OK' AND e.fallback IS NULL
+			GROUP BY e.search_id`, resp.SearchId).Scan(&results, &topCount, &top, &clicks)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("search event not written: %v", err)
+	}
+	if results != len(resp.Results) || topCount != len(resp.Results) || top != resp.Results[0].Id || clicks != 1 {
+		t.Errorf("got %d results (%d recorded, %s first) and %d clicks; want %d, %s first and 1 click",
+			results, topCount, top, clicks, len(resp.Results), resp.Results[0].Id)
+	}
+}
+
+func TestIntegrationImageSearch(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	// Each picture's content is its path, so the stub embedder tells them
+	// apart.
+	pictures := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer pictures.Close()
+	t.Setenv("PRODUCT_IMAGE_BASE_URL", pictures.URL)
+
+	n, err := backfillImageEmbeddings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 9 {
+		t.Errorf("embedded %d pictures, want 9", n)
+	}
+	if n, _ := backfillImageEmbeddings(ctx); n != 0 {
+		t.Errorf("second backfill embedded %d pictures, want 0", n)
+	}
+
+	const id = "OLJCESPC7Z" // Sunglasses
+	var picture string
+	if err := db.QueryRowContext(ctx, `SELECT picture FROM products WHERE id = $1`, id).Scan(&picture); err != nil {
+		t.Fatal(err)
+	}
+	svc := &productCatalog{}
+	for name, req := range map[string]*pb.ImageSearchRequest{
+		"data": {Image: &pb.ImageSearchRequest_ImageData{ImageData: []byte(picture)}, Limit: 3},
+		"url":  {Image: &pb.ImageSearchRequest_ImageUrl{ImageUrl: pictures.URL + picture}, Limit: 3},
+	} {
+		resp, err := svc.ImageSearchProducts(ctx, req)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(resp.Results) != 3 || resp.Results[0].Id != id {
+			t.Errorf("%s: got %v, want %s first of 3", name, resp.Results, id)
+		}
+	}
+}
+
+func TestIntegrationGetSimilarProducts(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+
+	const id = "OLJCESPC7Z" // Sunglasses
+	resp, err := svc.GetSimilarProducts(context.Background(), &pb.GetSimilarProductsRequest{ProductId: id, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 5 {
+		t.Fatalf("got %d similar products, want 5", len(resp.Results))
+	}
+	for _, p := range resp.Results {
+		if p.Id == id {
+			t.Errorf("product %s is listed as similar to itself", id)
+		}
+	}
+
+	_, err = svc.GetSimilarProducts(context.Background(), &pb.GetSimilarProductsRequest{ProductId: "NOSUCHPRODUCT"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("unknown product: got %v, want NotFound", err)
+	}
+}
+
+func TestIntegrationCatalogAdmin(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	admin := &catalogAdmin{catalog: &productCatalog{}}
+
+	product := &pb.Product{
+		Id:          "TEAPOT1",
+		Name:        "Cast Iron Teapot",
+		Description: "A heavy teapot that keeps tea hot.",
+		PriceUsd:    &pb.Money{CurrencyCode: "USD", Units: 35},
+		Categories:  []string{"kitchen"},
+		TargetTags:  []string{"tea lovers"},
+	}
+	if _, err := admin.CreateProduct(ctx, &pb.CreateProductRequest{Product: product}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.CreateProduct(ctx, &pb.CreateProductRequest{Product: product}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("second CreateProduct = %v, want AlreadyExists", err)
+	}
+	var stale int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM products WHERE `+staleEmbeddingCondition, embeddingVersion, embeddingModel()).Scan(&stale); err != nil {
+		t.Fatal(err)
+	}
+	if stale != 0 {
+		t.Errorf("%d products are stale after CreateProduct, want it embedded on write", stale)
+	}
+
+	product.Description = "A light glass teapot."
+	if _, err := admin.UpdateProduct(ctx, &pb.UpdateProductRequest{Product: product}); err != nil {
+		t.Fatal(err)
+	}
+	var description pgvector.Vector
+	if err := db.QueryRowContext(ctx, `SELECT description_embedding FROM products WHERE id = $1`, product.Id).Scan(&description); err != nil {
+		t.Fatal(err)
+	}
+	if want := stubEmbedding(product.Description, 0); !reflect.DeepEqual(description.Slice(), want) {
+		t.Error("UpdateProduct did not re-embed the new description")
+	}
+
+	if _, err := admin.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: product.Id}); err != nil {
+		t.Fatal(err)
+	}
+	var productStatus string
+	if err := db.QueryRowContext(ctx, `SELECT status FROM products WHERE id = $1`, product.Id).Scan(&productStatus); err != nil || productStatus != "discontinued" {
+		t.Errorf("DeleteProduct left status %q (%v), want the row kept as discontinued", productStatus, err)
+	}
+	resp, err := admin.catalog.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "teapot", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range resp.Results {
+		if p.Id == product.Id {
+			t.Error("discontinued product is still searchable")
+		}
+	}
+	resp, err = admin.catalog.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "teapot", Limit: 3, IncludeInactive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, p := range resp.Results {
+		found = found || (p.Id == product.Id && p.Status == pb.Product_DISCONTINUED)
+	}
+	if !found {
+		t.Errorf("include_inactive search = %v, want the discontinued teapot among them", resp.Results)
+	}
+
+	if _, err := admin.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: product.Id, Purge: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: product.Id, Purge: true}); status.Code(err) != codes.NotFound {
+		t.Errorf("second purge = %v, want NotFound", err)
+	}
+}
+
+func TestIntegrationProductChangeEvents(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	admin := &catalogAdmin{catalog: &productCatalog{}}
+	defer func(s *productEventSink) { productEvents = s }(productEvents)
+	productEvents = &productEventSink{events: make(chan *pb.ProductChanged, 10)}
+
+	product := &pb.Product{
+		Id:         "TEAPOT1",
+		Name:       "Cast Iron Teapot",
+		PriceUsd:   &pb.Money{CurrencyCode: "USD", Units: 35},
+		Categories: []string{"kitchen"},
+		Variants:   []*pb.ProductVariant{{Sku: "TEAPOT1-BLACK", Color: "black", Stock: 2}},
+	}
+	if _, err := admin.CreateProduct(ctx, &pb.CreateProductRequest{Product: product}); err != nil {
+		t.Fatal(err)
+	}
+	// A failed write publishes nothing.
+	if _, err := admin.CreateProduct(ctx, &pb.CreateProductRequest{Product: product}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("second CreateProduct = %v, want AlreadyExists", err)
+	}
+	product.Name = "Glass Teapot"
+	if _, err := admin.UpdateProduct(ctx, &pb.UpdateProductRequest{Product: product}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.UpdateStock(ctx, &pb.UpdateStockRequest{Levels: []*pb.StockLevel{
+		{Item: &pb.StockLevel_Sku{Sku: "TEAPOT1-BLACK"}, Stock: 0},
+		{Item: &pb.StockLevel_Sku{Sku: "NO-SUCH-SKU"}, Stock: 1},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: product.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: product.Id, Purge: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []pb.ProductChanged_Change{pb.ProductChanged_CREATED, pb.ProductChanged_UPDATED,
+		pb.ProductChanged_STOCK_UPDATED, pb.ProductChanged_DISCONTINUED, pb.ProductChanged_PURGED}
+	if got := len(productEvents.events); got != len(want) {
+		t.Fatalf("%d events, want %d", got, len(want))
+	}
+	for _, change := range want {
+		e := <-productEvents.events
+		if e.Change != change || e.ProductId != product.Id {
+			t.Errorf("got %s of %s, want %s of %s", e.Change, e.ProductId, change, product.Id)
+		}
+		if change == pb.ProductChanged_UPDATED && e.Product.GetName() != "Glass Teapot" {
+			t.Errorf("UPDATED event carries %v, want the updated product", e.Product)
+		}
+	}
+}
+
+func TestIntegrationMerchandisingRules(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	if err := ensureMerchandisingSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer merchandisingRules.Store(merchandisingRules.Load())
+	svc := &productCatalog{}
+	admin := &catalogAdmin{catalog: svc}
+
+	search := func() []string {
+		t.Helper()
+		resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "coffee mug", Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, p := range resp.Results {
+			ids = append(ids, p.Id)
+		}
+		return ids
+	}
+	before := search()
+
+	pin, err := admin.CreateMerchandisingRule(ctx, &pb.MerchandisingRule{
+		QueryPattern: "mug",
+		Target:       &pb.MerchandisingRule_ProductId{ProductId: "OLJCESPC7Z"}, // Sunglasses
+		Action:       pb.MerchandisingRule_PIN,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.CreateMerchandisingRule(ctx, &pb.MerchandisingRule{
+		Target:  &pb.MerchandisingRule_Category{Category: "kitchen"},
+		Action:  pb.MerchandisingRule_BURY,
+		EndTime: timestamppb.New(time.Now().Add(-time.Hour)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.CreateMerchandisingRule(ctx, &pb.MerchandisingRule{Action: pb.MerchandisingRule_BOOST}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("rule without a target: got %v, want InvalidArgument", err)
+	}
+
+	list, err := admin.ListMerchandisingRules(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Rules) != 2 || !proto.Equal(list.Rules[0], pin) {
+		t.Errorf("listed %v, want the pin rule %v first of 2", list.Rules, pin)
+	}
+	// The expired bury rule does not apply.
+	if got := search(); len(got) != len(before) || got[0] != "OLJCESPC7Z" || fmt.Sprint(got[1:]) != fmt.Sprint(before[:len(before)-1]) {
+		t.Errorf("got %v with the pin, want OLJCESPC7Z ahead of %v", got, before)
+	}
+
+	if _, err := admin.DeleteMerchandisingRule(ctx, &pb.DeleteMerchandisingRuleRequest{Id: pin.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.DeleteMerchandisingRule(ctx, &pb.DeleteMerchandisingRuleRequest{Id: pin.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("second delete: got %v, want NotFound", err)
+	}
+	if got := search(); fmt.Sprint(got) != fmt.Sprint(before) {
+		t.Errorf("got %v after deleting the pin, want %v", got, before)
+	}
+}
+
+func TestIntegrationCampaigns(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	if err := ensureCampaignsSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer campaigns.Store(campaigns.Load())
+	svc := &productCatalog{}
+	admin := &catalogAdmin{catalog: svc}
+
+	search := func() []string {
+		t.Helper()
+		resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "coffee mug", Limit: 9})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, p := range resp.Results {
+			ids = append(ids, p.Id)
+		}
+		return ids
+	}
+	before := search()
+
+	now := time.Now()
+	winter, err := admin.CreateCampaign(ctx, &pb.Campaign{
+		Name:      "Winter clothing",
+		Category:  "Clothing",
+		Boost:     2,
+		StartTime: timestamppb.New(now.Add(-time.Hour)),
+		EndTime:   timestamppb.New(now.Add(24 * time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.CreateCampaign(ctx, &pb.Campaign{
+		Category:  "footwear",
+		Boost:     2,
+		StartTime: timestamppb.New(now.Add(24 * time.Hour)),
+		EndTime:   timestamppb.New(now.Add(48 * time.Hour)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Only the running campaign moves the tank top, the one clothing
+	// product, to the top.
+	if got := search(); len(got) == 0 || got[0] != "66VCHSJNUP" || got[1] == "L9ECAV7KIM" {
+		t.Errorf("got %v during the winter campaign, want 66VCHSJNUP first and the loafers not boosted", got)
+	}
+
+	expired, err := admin.ExpireCampaign(ctx, &pb.ExpireCampaignRequest{Id: winter.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.EndTime.AsTime().After(time.Now()) {
+		t.Errorf("expired campaign ends at %v, want now at the latest", expired.EndTime.AsTime())
+	}
+	if _, err := admin.ExpireCampaign(ctx, &pb.ExpireCampaignRequest{Id: winter.Id + 100}); status.Code(err) != codes.NotFound {
+		t.Errorf("expiring an unknown campaign: got %v, want NotFound", err)
+	}
+	if got := search(); fmt.Sprint(got) != fmt.Sprint(before) {
+		t.Errorf("got %v after expiring the campaign, want %v", got, before)
+	}
+
+	list, err := admin.ListCampaigns(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Campaigns) != 2 || list.Campaigns[0].Name != "Winter clothing" || list.Campaigns[0].Category != "clothing" {
+		t.Errorf("listed %v, want both campaigns, the expired one first", list.Campaigns)
+	}
+}
+
+func TestIntegrationReloadCatalogFromProductsTable(t *testing.T) {
+	setupIntegrationDB(t)
+	t.Setenv("CLOUDSQL_HOST", "localhost")
+	ctx := context.Background()
+	svc := &productCatalog{}
+	admin := &catalogAdmin{catalog: svc}
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO products (id, name, description, picture, price_usd_currency_code,
+			price_usd_units, price_usd_nanos, categories, target_tags, use_context)
+		VALUES ('KETTLE1', 'Kettle', 'Boils water.', '', 'USD', 20, 0, 'Kitchen', '{}', '{}')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := admin.ReloadCatalog(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Products != 10 {
+		t.Errorf("reloaded %d products, want 10", resp.Products)
+	}
+	kettle, err := svc.GetProduct(ctx, &pb.GetProductRequest{Id: "KETTLE1"})
+	if err != nil {
+		t.Fatalf("product inserted into the table is not in the catalog: %v", err)
+	}
+	if len(kettle.Categories) != 1 || kettle.Categories[0] != "kitchen" {
+		t.Errorf("got categories %v, want [kitchen]", kettle.Categories)
+	}
+}
+
+func TestIntegrationImportExportProducts(t *testing.T) {
+	setupIntegrationDB(t)
+	ctx := context.Background()
+	admin := &catalogAdmin{catalog: &productCatalog{}}
+
+	exported, err := admin.ExportProducts(ctx, &pb.ExportProductsRequest{Format: pb.CatalogFormat_CATALOG_FORMAT_CSV})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported.Products != 9 {
+		t.Errorf("exported %d products, want 9", exported.Products)
+	}
+
+	csv := "id,name,price_usd,categories\nOLJCESPC7Z,Aviators,99.50,accessories\nKETTLE1,Kettle,20,kitchen\n"
+	importCSV := func(req *pb.ImportProductsRequest) *pb.ImportProductsResponse {
+		t.Helper()
+		req.Format, req.Data = pb.CatalogFormat_CATALOG_FORMAT_CSV, []byte(csv)
+		resp, err := admin.ImportProducts(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := importCSV(&pb.ImportProductsRequest{ReplaceExisting: true, DryRun: true}); resp.Created != 1 || resp.Replaced != 1 {
+		t.Errorf("dry run = %v, want 1 created and 1 replaced", resp)
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM products WHERE id = 'KETTLE1'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("dry run wrote KETTLE1 (%d rows, %v)", n, err)
+	}
+	if resp := importCSV(&pb.ImportProductsRequest{}); resp.Created != 1 || resp.Skipped != 1 {
+		t.Errorf("import = %v, want 1 created and 1 skipped", resp)
+	}
+	if resp := importCSV(&pb.ImportProductsRequest{ReplaceExisting: true}); resp.Replaced != 2 || resp.EmbeddingPending != 0 {
+		t.Errorf("replacing import = %v, want 2 replaced and embedded", resp)
+	}
+	var stale int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM products WHERE id IN ('OLJCESPC7Z', 'KETTLE1') AND combined_embedding IS NULL`).Scan(&stale); err != nil || stale != 0 {
+		t.Errorf("%d imported products without embeddings (%v)", stale, err)
+	}
+
+	// Restoring the export puts the sunglasses back.
+	if _, err := admin.ImportProducts(ctx, &pb.ImportProductsRequest{
+		Format: pb.CatalogFormat_CATALOG_FORMAT_CSV, Data: exported.Data, ReplaceExisting: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := db.QueryRowContext(ctx, `SELECT name FROM products WHERE id = 'OLJCESPC7Z'`).Scan(&name); err != nil || name == "Aviators" {
+		t.Errorf("restored name = %q (%v), want the exported one", name, err)
+	}
+
+	_, err = admin.ImportProducts(ctx, &pb.ImportProductsRequest{Data: []byte(`{"products": [{"id": "X"}]}`)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid import = %v, want InvalidArgument", err)
+	}
+}
+
+func TestIntegrationProductVariants(t *testing.T) {
+	setupIntegrationDB(t)
+	t.Setenv("CLOUDSQL_HOST", "localhost")
+	ctx := context.Background()
+	svc := &productCatalog{}
+	admin := &catalogAdmin{catalog: svc}
+
+	tank, err := svc.GetProduct(ctx, &pb.GetProductRequest{Id: "66VCHSJNUP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tank.Variants) != 4 || tank.Variants[3].Sku != "66VCHSJNUP-XL-WHT" || tank.Variants[3].PriceDeltaUsd.GetUnits() != 2 {
+		t.Errorf("got variants %v, want the 4 seeded sizes in order", tank.Variants)
+	}
+	if s := tank.VariantSummary; s.GetCount() != 4 || s.GetInStock() != 3 || s.GetMaxPriceUsd().GetUnits() != 20 {
+		t.Errorf("got summary %v, want 4 variants, 3 in stock, up to $20.99", s)
+	}
+
+	resp, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "tank top", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, p := range resp.Results {
+		if p.Id == "66VCHSJNUP" {
+			found = true
+			if len(p.Variants) != 0 || p.VariantSummary.GetCount() != 4 {
+				t.Errorf("search result has %d variants and summary %v, want only the summary", len(p.Variants), p.VariantSummary)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("tank top not among %v", resp.Results)
+	}
+
+	mug, err := svc.GetProduct(ctx, &pb.GetProductRequest{Id: "6E92ZMYYFZ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mug = proto.Clone(mug).(*pb.Product)
+	mug.Variants = []*pb.ProductVariant{{Sku: "66VCHSJNUP-S-WHT", Stock: 1}}
+	if _, err := admin.UpdateProduct(ctx, &pb.UpdateProductRequest{Product: mug}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("UpdateProduct with another product's SKU = %v, want AlreadyExists", err)
+	}
+	mug.Variants = []*pb.ProductVariant{{Sku: "MUG-BLUE", Color: "blue", Stock: 3}, {Sku: "MUG-RED", Color: "red"}}
+	if _, err := admin.UpdateProduct(ctx, &pb.UpdateProductRequest{Product: mug}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.GetProduct(ctx, &pb.GetProductRequest{Id: mug.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got.VariantSummary.GetColors()) != "[blue red]" || got.VariantSummary.GetInStock() != 1 {
+		t.Errorf("got summary %v after the update, want blue and red, 1 in stock", got.VariantSummary)
+	}
+
+	if _, err := admin.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: mug.Id, Purge: true}); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM product_variants WHERE product_id = $1`, mug.Id).Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d variants left after purging the product (%v)", n, err)
+	}
+}
+
+func TestIntegrationInventory(t *testing.T) {
+	setupIntegrationDB(t)
+	t.Setenv("CLOUDSQL_HOST", "localhost")
+	ctx := context.Background()
+	svc := &productCatalog{}
+	admin := &catalogAdmin{catalog: svc}
+	defer func(s inventorySettings) { inventory = s }(inventory)
+	inventory = inventorySettings{outOfStockPenalty: 2}
+
+	resp, err := admin.UpdateStock(ctx, &pb.UpdateStockRequest{Levels: []*pb.StockLevel{
+		{Item: &pb.StockLevel_ProductId{ProductId: "6E92ZMYYFZ"}},
+		{Item: &pb.StockLevel_Sku{Sku: "66VCHSJNUP-S-WHT"}, Stock: 5},
+		{Item: &pb.StockLevel_Sku{Sku: "NO-SUCH-SKU"}, Stock: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Updated != 2 || fmt.Sprint(resp.NotFound) != "[NO-SUCH-SKU]" {
+		t.Errorf("UpdateStock = %v, want 2 updated and NO-SUCH-SKU not found", resp)
+	}
+	mug, err := svc.GetProduct(ctx, &pb.GetProductRequest{Id: "6E92ZMYYFZ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mug.Stock == nil || *mug.Stock != 0 {
+		t.Errorf("mug stock = %v, want 0", mug.Stock)
+	}
+
+	ids := func(req *pb.SemanticSearchRequest) []string {
+		t.Helper()
+		resp, err := svc.SemanticSearchProducts(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, p := range resp.Results {
+			ids = append(ids, p.Id)
+		}
+		return ids
+	}
+	if got := ids(&pb.SemanticSearchRequest{Query: "coffee mug", Limit: 5, InStockOnly: true}); slices.Contains(got, "6E92ZMYYFZ") {
+		t.Errorf("in_stock_only results %v include the sold out mug", got)
+	}
+	got := ids(&pb.SemanticSearchRequest{Query: "coffee mug", Limit: 9})
+	if i := slices.Index(got, "6E92ZMYYFZ"); i >= 0 && i != len(got)-1 {
+		t.Errorf("results %v do not demote the sold out mug", got)
+	}
+}
+
+func TestIntegrationDiversifiedSearch(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+	ctx := context.Background()
+
+	plain, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "kitchen", Limit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diverse, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "kitchen", Limit: 4,
+		DiversityLambda: proto.Float64(0.3), Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diverse.Results) != len(plain.Results) || diverse.Results[0].Id != plain.Results[0].Id {
+		t.Errorf("diversified results %v, want as many as %v and the same first", diverse.Results, plain.Results)
+	}
+	seen := map[string]bool{}
+	for i, p := range diverse.Results {
+		if seen[p.Id] {
+			t.Errorf("%s appears twice", p.Id)
+		}
+		seen[p.Id] = true
+		if diverse.Debug.Scores[i].ProductId != p.Id {
+			t.Errorf("debug score %d is for %s, want %s", i, diverse.Debug.Scores[i].ProductId, p.Id)
+		}
+	}
+}
+
+func TestIntegrationCategoryTree(t *testing.T) {
+	setupIntegrationDB(t)
+	t.Setenv("CLOUDSQL_HOST", "localhost")
+	ctx := context.Background()
+	svc := &productCatalog{}
+	admin := &catalogAdmin{catalog: svc}
+
+	for _, c := range []*pb.CreateCategoryRequest{
+		{Id: "Apparel"},
+		{Id: "clothing", Name: "Clothing", ParentId: "apparel"},
+		{Id: "footwear", Name: "Shoes", ParentId: "apparel"},
+	} {
+		if _, err := admin.CreateCategory(ctx, c); err != nil {
+			t.Fatalf("CreateCategory(%v): %v", c, err)
+		}
+	}
+	if _, err := admin.CreateCategory(ctx, &pb.CreateCategoryRequest{Id: "hats", ParentId: "headwear"}); status.Code(err) != codes.NotFound {
+		t.Errorf("CreateCategory under a missing parent = %v, want NotFound", err)
+	}
+	if _, err := admin.CreateCategory(ctx, &pb.CreateCategoryRequest{Id: "clothing"}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("second CreateCategory = %v, want AlreadyExists", err)
+	}
+
+	resp, err := svc.ListCategories(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apparel := resp.Categories[0]
+	if apparel.Id != "apparel" || apparel.ProductCount != 2 || len(apparel.Children) != 2 || apparel.Children[1].Name != "Shoes" {
+		t.Errorf("got %v first, want apparel with clothing and shoes, 2 products", apparel)
+	}
+
+	results, err := svc.SemanticSearchProducts(ctx, &pb.SemanticSearchRequest{Query: "something to wear", Categories: []string{"apparel"}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range results.Results {
+		ids = append(ids, p.Id)
+	}
+	sort.Strings(ids)
+	if fmt.Sprint(ids) != "[66VCHSJNUP L9ECAV7KIM]" {
+		t.Errorf("apparel search returned %v, want the tank top and loafers", ids)
+	}
+
+	if _, err := admin.DeleteCategory(ctx, &pb.DeleteCategoryRequest{Id: "apparel"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("DeleteCategory with subcategories = %v, want FailedPrecondition", err)
+	}
+	if _, err := admin.DeleteCategory(ctx, &pb.DeleteCategoryRequest{Id: "footwear"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.DeleteCategory(ctx, &pb.DeleteCategoryRequest{Id: "footwear"}); status.Code(err) != codes.NotFound {
+		t.Errorf("second DeleteCategory = %v, want NotFound", err)
+	}
+}
+
+func TestSemanticSearchProducts(t *testing.T) {
+	setupIntegrationDB(t)
+
+	// Create service instance
+	svc := &productCatalog{}
+
+	tests := []struct {
+		name     string
+		query    string
+		limit    int32
+		minCount int // minimum expected results
+	}{
+		{
+			name:     "comfortable seating",
+			query:    "comfortable seating",
+			limit:    5,
+			minCount: 1,
+		},
+		{
+			name:     "kitchen appliances",
+			query:    "kitchen appliances",
+			limit:    3,
+			minCount: 1,
+		},
+		{
+			name:     "winter clothing",
+			query:    "winter clothing",
+			limit:    3,
+			minCount: 1,
+		},
+		{
+			name:     "home decor",
+			query:    "home decor",
+			limit:    4,
+			minCount: 1,
+		},
+		{
+			name:     "office furniture",
+			query:    "office furniture",
+			limit:    3,
+			minCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			req := &pb.SemanticSearchRequest{
+				Query: tt.query,
+				Limit: tt.limit,
+			}
+
+			resp, err := svc.SemanticSearchProducts(ctx, req)
+			if err != nil {
+				t.Fatalf("SemanticSearchProducts(%q) failed: %v", tt.query, err)
+			}
+
+			if len(resp.Results) < tt.minCount {
+				t.Errorf("SemanticSearchProducts(%q) returned %d results, expected at least %d",
+					tt.query, len(resp.Results), tt.minCount)
+			}
+
+			// Log results for manual verification
+			t.Logf("Query: %q returned %d products:", tt.query, len(resp.Results))
+			for i, product := range resp.Results {
+				if i < 3 { // Show first 3 results
+					t.Logf("  %d. %s: %s", i+1, product.Name, product.Description[:min(60, len(product.Description))])
+				}
+			}
+		})
+	}
+}
+
+func TestSemanticVsRegularSearch(t *testing.T) {
+	setupIntegrationDB(t)
+
+	// Create service instance
+	svc := &productCatalog{}
+
+	// Load catalog for regular search
+	if err := loadCatalog(&svc.catalog); err != nil {
+		t.Fatalf("Failed to load catalog: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := "furniture"
+
+	// Regular search
+	regReq := &pb.SearchProductsRequest{Query: query}
+	regResp, err := svc.SearchProducts(ctx, regReq)
+	if err != nil {
+		t.Fatalf("SearchProducts failed: %v", err)
+	}
+
+	// Semantic search
+	semReq := &pb.SemanticSearchRequest{Query: query, Limit: 10}
+	semResp, err := svc.SemanticSearchProducts(ctx, semReq)
+	if err != nil {
+		t.Fatalf("SemanticSearchProducts failed: %v", err)
+	}
+
+	t.Logf("Regular search for %q: %d results", query, len(regResp.Results))
+	t.Logf("Semantic search for %q: %d results", query, len(semResp.Results))
+
+	// Both should return some results
+	if len(regResp.Results) == 0 && len(semResp.Results) == 0 {
+		t.Error("Both regular and semantic search returned no results")
+	}
+}
+
+func TestSemanticSearchEdgeCases(t *testing.T) {
+	setupIntegrationDB(t)
+
+	svc := &productCatalog{}
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query string
+		limit int32
+	}{
+		{
+			name:  "empty query",
+			query: "",
+			limit: 5,
+		},
+		{
+			name:  "very long query",
+			query: "this is a very long query that should still work with semantic search functionality",
+			limit: 3,
+		},
+		{
+			name:  "zero limit",
+			query: "test",
+			limit: 0,
+		},
+		{
+			name:  "large limit",
+			query: "test",
+			limit: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &pb.SemanticSearchRequest{
+				Query: tt.query,
+				Limit: tt.limit,
+			}
+
+			resp, err := svc.SemanticSearchProducts(ctx, req)
+			if err != nil {
+				t.Errorf("SemanticSearchProducts failed for %s: %v", tt.name, err)
+				return
+			}
+
+			// Should not crash and should return valid response
+			if resp == nil {
+				t.Errorf("SemanticSearchProducts returned nil response for %s", tt.name)
+			}
+
+			t.Logf("%s: returned %d results", tt.name, len(resp.Results))
+		})
+	}
+}
+
+// TestIntegrationRankingRelevance scores the current ranking configuration
+// against testdata/relevance_judgments.json. It always reports per-query and
+// mean recall@k and nDCG@k; set RELEVANCE_MIN_RECALL or RELEVANCE_MIN_NDCG to
+// fail when the means drop below a baseline.
+func TestIntegrationRankingRelevance(t *testing.T) {
+	setupIntegrationDB(t)
+	svc := &productCatalog{}
+	judgments := loadRelevanceJudgments(t)
+
+	var sumRecall, sumNDCG float64
+	for _, q := range judgments.Queries {
+		resp, err := svc.SemanticSearchProducts(context.Background(),
+			&pb.SemanticSearchRequest{Query: q.Query, Limit: int32(judgments.K)})
+		if err != nil {
+			t.Fatalf("SemanticSearchProducts(%q) failed: %v", q.Query, err)
+		}
+		var ranked []string
+		for _, p := range resp.Results {
+			ranked = append(ranked, p.Id)
+		}
+		recall := recallAtK(ranked, q.Relevant, judgments.K)
+		ndcg := ndcgAtK(ranked, q.Relevant, judgments.K)
+		sumRecall += recall
+		sumNDCG += ndcg
+		t.Logf("%-40q recall@%d=%.3f ndcg@%d=%.3f ranked=%v", q.Query, judgments.K, recall, judgments.K, ndcg, ranked)
+	}
+
+	n := float64(len(judgments.Queries))
+	meanRecall, meanNDCG := sumRecall/n, sumNDCG/n
+	t.Logf("mean recall@%d=%.3f mean ndcg@%d=%.3f over %d queries", judgments.K, meanRecall, judgments.K, meanNDCG, len(judgments.Queries))
+
+	for _, check := range []struct {
+		env  string
+		mean float64
+	}{
+		{"RELEVANCE_MIN_RECALL", meanRecall},
+		{"RELEVANCE_MIN_NDCG", meanNDCG},
+	} {
+		s := os.Getenv(check.env)
+		if s == "" {
+			continue
+		}
+		baseline, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			t.Fatalf("invalid %s %q: %v", check.env, s, err)
+		}
+		if check.mean < baseline {
+			t.Errorf("%s: mean %.3f is below the %.3f baseline", check.env, check.mean, baseline)
+		}
+	}
+}
@@ -23,210 +23,76 @@ import (
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
 )
 
-func TestSemanticSearchProducts(t *testing.T) {
-	// Skip test if database not available
-	if os.Getenv("CLOUDSQL_HOST") == "" {
-		t.Skip("Skipping semantic search test: CLOUDSQL_HOST not set")
-	}
-
-	// Initialize database connection
-	if err := initDatabase(); err != nil {
-		t.Fatalf("Failed to initialize database: %v", err)
-	}
-
-	// Create service instance
-	svc := &productCatalog{}
-
-	tests := []struct {
-		name     string
-		query    string
-		limit    int32
-		minCount int // minimum expected results
-	}{
-		{
-			name:     "comfortable seating",
-			query:    "comfortable seating",
-			limit:    5,
-			minCount: 1,
-		},
-		{
-			name:     "kitchen appliances",
-			query:    "kitchen appliances",
-			limit:    3,
-			minCount: 1,
-		},
-		{
-			name:     "winter clothing",
-			query:    "winter clothing",
-			limit:    3,
-			minCount: 1,
-		},
-		{
-			name:     "home decor",
-			query:    "home decor",
-			limit:    4,
-			minCount: 1,
-		},
-		{
-			name:     "office furniture",
-			query:    "office furniture",
-			limit:    3,
-			minCount: 1,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-
-			req := &pb.SemanticSearchRequest{
-				Query: tt.query,
-				Limit: tt.limit,
-			}
-
-			resp, err := svc.SemanticSearchProducts(ctx, req)
-			if err != nil {
-				t.Fatalf("SemanticSearchProducts(%q) failed: %v", tt.query, err)
-			}
-
-			if len(resp.Results) < tt.minCount {
-				t.Errorf("SemanticSearchProducts(%q) returned %d results, expected at least %d", 
-					tt.query, len(resp.Results), tt.minCount)
-			}
-
-			// Log results for manual verification
-			t.Logf("Query: %q returned %d products:", tt.query, len(resp.Results))
-			for i, product := range resp.Results {
-				if i < 3 { // Show first 3 results
-					t.Logf("  %d. %s: %s", i+1, product.Name, product.Description[:min(60, len(product.Description))])
-				}
-			}
-		})
+func min(a, b int) int {
+	if a < b {
+		return a
 	}
+	return b
 }
 
-func TestSemanticVsRegularSearch(t *testing.T) {
-	// Skip test if database not available
-	if os.Getenv("CLOUDSQL_HOST") == "" {
-		t.Skip("Skipping semantic search test: CLOUDSQL_HOST not set")
-	}
+func TestResponseBudget(t *testing.T) {
+	product := &pb.Product{Id: "OLJCESPC7Z", Name: "Sunglasses", Description: "Add a modern touch to your outfits."}
+	size := proto.Size(product)
 
-	// Initialize database connection
-	if err := initDatabase(); err != nil {
-		t.Fatalf("Failed to initialize database: %v", err)
+	budget := responseBudget{remaining: 2*size + size/2}
+	for i := 0; i < 2; i++ {
+		if !budget.take(product) {
+			t.Fatalf("take %d: expected product to fit, %d bytes remaining", i, budget.remaining)
+		}
 	}
-
-	// Create service instance
-	svc := &productCatalog{}
-	
-	// Load catalog for regular search
-	if err := loadCatalog(&svc.catalog); err != nil {
-		t.Fatalf("Failed to load catalog: %v", err)
+	if budget.take(product) {
+		t.Errorf("expected third product to exceed the budget")
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	query := "furniture"
-
-	// Regular search
-	regReq := &pb.SearchProductsRequest{Query: query}
-	regResp, err := svc.SearchProducts(ctx, regReq)
-	if err != nil {
-		t.Fatalf("SearchProducts failed: %v", err)
+	if budget.remaining != size/2 {
+		t.Errorf("remaining = %d, want %d", budget.remaining, size/2)
 	}
+}
 
-	// Semantic search
-	semReq := &pb.SemanticSearchRequest{Query: query, Limit: 10}
-	semResp, err := svc.SemanticSearchProducts(ctx, semReq)
+func TestSemanticSearchWithoutProductsSchema(t *testing.T) {
+	defer dbReady.Store(dbReady.Load())
+	defer productsSchemaReady.Store(productsSchemaReady.Load())
+	dbReady.Store(true)
+	productsSchemaReady.Store(false)
+
+	resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "alpha", SortBy: pb.SemanticSearchRequest_NEWEST, Debug: true})
 	if err != nil {
-		t.Fatalf("SemanticSearchProducts failed: %v", err)
+		t.Fatal(err)
 	}
-
-	t.Logf("Regular search for %q: %d results", query, len(regResp.Results))
-	t.Logf("Semantic search for %q: %d results", query, len(semResp.Results))
-
-	// Both should return some results
-	if len(regResp.Results) == 0 && len(semResp.Results) == 0 {
-		t.Error("Both regular and semantic search returned no results")
+	if resp.Debug.GetFallback() != fallbackSchemaUnavailable || len(resp.Results) == 0 {
+		t.Errorf("got fallback %q with %d results, want keyword results with %q",
+			resp.Debug.GetFallback(), len(resp.Results), fallbackSchemaUnavailable)
 	}
 }
 
-func TestSemanticSearchEdgeCases(t *testing.T) {
-	// Skip test if database not available
-	if os.Getenv("CLOUDSQL_HOST") == "" {
-		t.Skip("Skipping semantic search test: CLOUDSQL_HOST not set")
-	}
+// TestSemanticSearchIntegration tests semantic search via gRPC client
+func TestSemanticSearchDebugReportsFallback(t *testing.T) {
+	defer func(q queryPipeline) { queryProcessing = q }(queryProcessing)
+	queryProcessing = queryPipeline{lowercase: true, stopwords: true}
 
-	// Initialize database connection
-	if err := initDatabase(); err != nil {
-		t.Fatalf("Failed to initialize database: %v", err)
+	resp, err := mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "The Alpha", Debug: true})
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	svc := &productCatalog{}
-	ctx := context.Background()
-
-	tests := []struct {
-		name  string
-		query string
-		limit int32
-	}{
-		{
-			name:  "empty query",
-			query: "",
-			limit: 5,
-		},
-		{
-			name:  "very long query",
-			query: "this is a very long query that should still work with semantic search functionality",
-			limit: 3,
-		},
-		{
-			name:  "zero limit",
-			query: "test",
-			limit: 0,
-		},
-		{
-			name:  "large limit",
-			query: "test",
-			limit: 100,
-		},
+	want := &pb.SearchDebug{Fallback: fallbackDatabaseUnavailable, ProcessedQuery: "alpha"}
+	if !proto.Equal(resp.Debug, want) {
+		t.Errorf("got debug %v, want %v", resp.Debug, want)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			req := &pb.SemanticSearchRequest{
-				Query: tt.query,
-				Limit: tt.limit,
-			}
-
-			resp, err := svc.SemanticSearchProducts(ctx, req)
-			if err != nil {
-				t.Errorf("SemanticSearchProducts failed for %s: %v", tt.name, err)
-				return
-			}
-
-			// Should not crash and should return valid response
-			if resp == nil {
-				t.Errorf("SemanticSearchProducts returned nil response for %s", tt.name)
-			}
-
-			t.Logf("%s: returned %d results", tt.name, len(resp.Results))
-		})
+	resp, err = mockProductCatalog.SemanticSearchProducts(context.Background(),
+		&pb.SemanticSearchRequest{Query: "alpha"})
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
+	if resp.Debug != nil {
+		t.Errorf("got debug %v without asking for it", resp.Debug)
 	}
-	return b
 }
 
-// TestSemanticSearchIntegration tests semantic search via gRPC client
 func TestSemanticSearchIntegration(t *testing.T) {
 	// Skip if not running integration tests
 	if os.Getenv("INTEGRATION_TEST") == "" {
@@ -248,7 +114,7 @@ func TestSemanticSearchIntegration(t *testing.T) {
 
 	// Test 1: List all products first
 	t.Log("📋 Test 1: Listing all products...")
-	listResp, err := client.ListProducts(ctx, &pb.Empty{})
+	listResp, err := client.ListProducts(ctx, &pb.ListProductsRequest{})
 	if err != nil {
 		t.Fatalf("ListProducts failed: %v", err)
 	}
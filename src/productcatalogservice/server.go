@@ -43,11 +43,16 @@ import (
 var (
 	catalogMutex *sync.Mutex
 	log          *logrus.Logger
-	extraLatency time.Duration
+	faults       *faultInjector
+	grpcConfig   grpcSettings
 
 	port = "3550"
 
 	reloadCatalog bool
+
+	// shutdown is cancelled when the server is asked to stop, ending the
+	// background work started with it.
+	shutdown, stopBackground = context.WithCancel(context.Background())
 )
 
 func init() {
@@ -65,8 +70,14 @@ func init() {
 }
 
 func main() {
-	if os.Getenv("ENABLE_TRACING") == "1" {
-		err := initTracing()
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	cfg.apply()
+
+	if cfg.tracing {
+		err := initTracing(cfg.collectorAddr)
 		if err != nil {
 			log.Warnf("warn: failed to start tracer: %+v", err)
 		}
@@ -74,53 +85,76 @@ func main() {
 		log.Info("Tracing disabled.")
 	}
 
-	if os.Getenv("DISABLE_PROFILER") == "" {
+	if cfg.profiling {
 		log.Info("Profiling enabled.")
 		go initProfiling("productcatalogservice", "1.0.0")
 	} else {
 		log.Info("Profiling disabled.")
 	}
 
+	migrate := flag.Bool("migrate-embeddings", false,
+		"re-embed products whose embeddings are stale or from another model, then exit")
 	flag.Parse()
 
-	// set injected latency
-	if s := os.Getenv("EXTRA_LATENCY"); s != "" {
-		v, err := time.ParseDuration(s)
-		if err != nil {
-			log.Fatalf("failed to parse EXTRA_LATENCY (%s) as time.Duration: %+v", v, err)
+	initFeatureFlags()
+	if err := initSynonyms(); err != nil {
+		log.Fatal(err)
+	}
+	if err := initExperiment(); err != nil {
+		log.Fatal(err)
+	}
+
+	if *migrate {
+		if err := migrateEmbeddings(); err != nil {
+			log.Fatalf("embedding migration failed: %v", err)
 		}
-		extraLatency = v
-		log.Infof("extra latency enabled (duration: %v)", extraLatency)
-	} else {
-		extraLatency = time.Duration(0)
+		log.Info("Embedding migration complete")
+		return
 	}
 
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
 	go func() {
 		for {
 			sig := <-sigs
 			log.Printf("Received signal: %s", sig)
-			if sig == syscall.SIGUSR1 {
+			switch sig {
+			case syscall.SIGUSR1:
+				if catalogFromDB() {
+					log.Infof("Reloading catalog")
+					requestCatalogReload()
+					break
+				}
 				reloadCatalog = true
 				log.Infof("Enable catalog reloading")
-			} else {
+			case syscall.SIGUSR2:
 				reloadCatalog = false
 				log.Infof("Disable catalog reloading")
+			case syscall.SIGHUP:
+				log.Infof("Reloading feature flags, synonyms and the ranking experiment")
+				reloadFeatureFlags()
+				reloadSynonyms()
+				reloadExperiment()
 			}
 		}
 	}()
 
-	if os.Getenv("PORT") != "" {
-		port = os.Getenv("PORT")
+	if cfg.metricsPort != "0" {
+		serveMetrics(cfg.metricsPort)
+		log.Infof("serving metrics at :%s/metrics", cfg.metricsPort)
 	}
+
 	log.Infof("starting grpc server at :%s", port)
-	run(port)
-	select {}
+	run(cfg)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	log.Infof("Received signal: %s, shutting down", <-stop)
+	stopBackground()
 }
 
-func run(port string) string {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+func run(cfg *serviceConfig) string {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.port))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -130,9 +164,15 @@ func run(port string) string {
 		propagation.NewCompositeTextMapPropagator(
 			propagation.TraceContext{}, propagation.Baggage{}))
 	var srv *grpc.Server
-	srv = grpc.NewServer(
-		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()))
+	srv = grpc.NewServer(append(grpcConfig.serverOptions(),
+		grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(),
+			metricsUnaryInterceptor,
+			cfg.admin.unaryInterceptor,
+			faults.unaryInterceptor("hipstershop.ProductCatalogService")),
+		grpc.ChainStreamInterceptor(
+			otelgrpc.StreamServerInterceptor(),
+			faults.streamInterceptor("hipstershop.ProductCatalogService")))...)
 
 	svc := &productCatalog{}
 	err = loadCatalog(&svc.catalog)
@@ -140,15 +180,28 @@ func run(port string) string {
 		log.Fatalf("could not parse product catalog: %v", err)
 	}
 
-	// Initialize database connection for semantic search
-	if err := initDatabase(); err != nil {
-		log.Warnf("Failed to initialize database for semantic search: %v", err)
-		log.Info("Semantic search will be disabled, falling back to regular search")
-	} else {
-		log.Info("Semantic search enabled with automatic embedding generation")
+	// Connect to the semantic search dependencies in the background; keyword
+	// search is served meanwhile and readiness waits for the outcome.
+	go awaitDependencies(cfg.startupWindow)
+	if catalogFromDB() {
+		go svc.refreshCatalog(context.Background(), catalogRefreshInterval)
+	}
+	if searchEvents != nil {
+		go searchEvents.run(context.Background())
 	}
+	if productEvents != nil {
+		go productEvents.run(context.Background())
+	}
+	// Experiment variants may rank by popularity even when the server
+	// does not, so it is kept up to date either way.
+	go popularity.refreshPopularity(context.Background())
+	go refreshMerchandisingRules(context.Background(), merchandisingRefreshInterval)
 
 	pb.RegisterProductCatalogServiceServer(srv, svc)
+	if cfg.adminAPI {
+		pb.RegisterProductCatalogAdminServiceServer(srv, &catalogAdmin{catalog: svc})
+		log.Info("Product catalog admin API enabled")
+	}
 	healthpb.RegisterHealthServer(srv, svc)
 	go srv.Serve(listener)
 
@@ -159,15 +212,11 @@ func initStats() {
 	// TODO(drewbr) Implement OpenTelemetry stats
 }
 
-func initTracing() error {
-	var (
-		collectorAddr string
-		collectorConn *grpc.ClientConn
-	)
+func initTracing(collectorAddr string) error {
+	var collectorConn *grpc.ClientConn
 
 	ctx := context.Background()
 
-	mustMapEnv(&collectorAddr, "COLLECTOR_SERVICE_ADDR")
 	mustConnGRPC(ctx, &collectorConn, collectorAddr)
 
 	exporter, err := otlptracegrpc.New(
@@ -203,22 +252,14 @@ func initProfiling(service, version string) {
 	log.Warn("could not initialize Stackdriver profiler after retrying, giving up")
 }
 
-func mustMapEnv(target *string, envKey string) {
-	v := os.Getenv(envKey)
-	if v == "" {
-		panic(fmt.Sprintf("environment variable %q not set", envKey))
-	}
-	*target = v
-}
-
 func mustConnGRPC(ctx context.Context, conn **grpc.ClientConn, addr string) {
 	var err error
 	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
-	*conn, err = grpc.DialContext(ctx, addr,
+	*conn, err = grpc.DialContext(ctx, addr, append(grpcConfig.dialOptions(),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
-		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()))
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()))...)
 	if err != nil {
 		panic(errors.Wrapf(err, "grpc: failed to connect %s", addr))
 	}
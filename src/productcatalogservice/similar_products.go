@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultSimilarProducts is how many neighbors GetSimilarProducts returns
+// when the request has no limit.
+const defaultSimilarProducts = 10
+
+// similarProductsQuery ranks products by the distance of their combined
+// embedding to the stored one of product $1, so no embedding call is needed.
+// Only products embedded with the same model are comparable, and only active
+// ones are returned.
+func similarProductsQuery() string {
+	return `
+	SELECT p.id, p.name, p.description, p.picture, p.price_usd_currency_code,
+		   p.price_usd_units, p.price_usd_nanos, p.categories, p.target_tags, p.use_context
+	FROM ` + productsTable + ` p, ` + productsTable + ` src
+	WHERE src.id = $1
+	  AND p.id <> src.id
+	  AND p.combined_embedding IS NOT NULL
+	  AND p.embedding_model IS NOT DISTINCT FROM src.embedding_model` + activeProductSQL + `
+	ORDER BY p.combined_embedding <=> src.combined_embedding
+	LIMIT $2`
+}
+
+// GetSimilarProducts returns the nearest neighbors of a product by stored
+// combined embedding, excluding the product itself. Without the database, or
+// when the product has not been embedded yet, it returns the products sharing
+// the most categories with it instead.
+func (p *productCatalog) GetSimilarProducts(ctx context.Context, req *pb.GetSimilarProductsRequest) (*pb.SearchProductsResponse, error) {
+	if req.GetProductId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "product_id is required")
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultSimilarProducts
+	}
+	limit = min(limit, maxSemanticSearchResults)
+
+	if !dbReady.Load() {
+		return p.similarByCategory(req.ProductId, limit)
+	}
+
+	var embedded bool
+	err := readDB().QueryRowContext(ctx, `SELECT combined_embedding IS NOT NULL FROM `+productsTable+` WHERE id = $1`, req.ProductId).Scan(&embedded)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, status.Errorf(codes.NotFound, "no product with ID %s", req.ProductId)
+	case err != nil:
+		log.Warnf("Similar products lookup for %s failed, falling back to categories: %v", req.ProductId, err)
+		return p.similarByCategory(req.ProductId, limit)
+	case !embedded:
+		log.Infof("Product %s has no embedding yet, falling back to categories", req.ProductId)
+		return p.similarByCategory(req.ProductId, limit)
+	}
+
+	rows, err := readDB().QueryContext(ctx, similarProductsQuery(), req.ProductId, limit)
+	if err != nil {
+		log.Warnf("Similar products query for %s failed, falling back to categories: %v", req.ProductId, err)
+		return p.similarByCategory(req.ProductId, limit)
+	}
+	defer rows.Close()
+
+	products := make([]*pb.Product, 0, limit)
+	budget := responseBudget{remaining: maxSearchResponseBytes}
+	truncated := false
+	for rows.Next() {
+		product := &pb.Product{PriceUsd: &pb.Money{}}
+		var categories, targetTags, useContext string
+		if err := rows.Scan(&product.Id, &product.Name, &product.Description, &product.Picture,
+			&product.PriceUsd.CurrencyCode, &product.PriceUsd.Units, &product.PriceUsd.Nanos,
+			&categories, &targetTags, &useContext); err != nil {
+			return nil, status.Errorf(codes.Internal, "database error: %v", err)
+		}
+		product.Categories = splitCategories(categories)
+		product.TargetTags = splitPostgresList(targetTags)
+		product.UseContext = splitPostgresList(useContext)
+
+		if !budget.take(product) {
+			truncated = true
+			break
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "database error: %v", err)
+	}
+	return &pb.SearchProductsResponse{Results: products, Truncated: truncated}, nil
+}
+
+// similarByCategory ranks catalog products by the number of categories they
+// share with product id, keeping catalog order among ties. Products sharing
+// no category are left out.
+func (p *productCatalog) similarByCategory(id string, limit int) (*pb.SearchProductsResponse, error) {
+	catalog := p.parseCatalog()
+	var source *pb.Product
+	for _, product := range catalog {
+		if product.Id == id {
+			source = product
+			break
+		}
+	}
+	if source == nil {
+		return nil, status.Errorf(codes.NotFound, "no product with ID %s", id)
+	}
+
+	type candidate struct {
+		product *pb.Product
+		shared  int
+	}
+	var candidates []candidate
+	for _, product := range catalog {
+		if product.Id == id || product.Status != pb.Product_ACTIVE {
+			continue
+		}
+		if shared := countSharedTerms(source.Categories, product.Categories); shared > 0 {
+			candidates = append(candidates, candidate{product, shared})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].shared > candidates[j].shared })
+
+	products := make([]*pb.Product, 0, min(limit, len(candidates)))
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		products = append(products, c.product)
+	}
+	return &pb.SearchProductsResponse{Results: products}, nil
+}
+
+// countSharedTerms counts the terms of a that are also in b, ignoring case
+// and surrounding space.
+func countSharedTerms(a, b []string) int {
+	shared := 0
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(strings.TrimSpace(x), strings.TrimSpace(y)) {
+				shared++
+				break
+			}
+		}
+	}
+	return shared
+}
+
+// splitPostgresList splits a TEXT[] or comma-separated TEXT column value.
+func splitPostgresList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.Trim(s, "{}"), ",")
+}
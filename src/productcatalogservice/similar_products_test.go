@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetSimilarProductsByCategory(t *testing.T) {
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{
+		{Id: "mug", Categories: []string{"kitchen", "home"}},
+		{Id: "sunglasses", Categories: []string{"accessories"}},
+		{Id: "jar", Categories: []string{"kitchen"}},
+		{Id: "candle", Categories: []string{"Home", "kitchen"}},
+	}}}
+
+	resp, err := svc.GetSimilarProducts(context.Background(), &pb.GetSimilarProductsRequest{ProductId: "mug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range resp.Results {
+		ids = append(ids, p.Id)
+	}
+	if len(ids) != 2 || ids[0] != "candle" || ids[1] != "jar" {
+		t.Errorf("got %v, want [candle jar]", ids)
+	}
+
+	resp, err = svc.GetSimilarProducts(context.Background(), &pb.GetSimilarProductsRequest{ProductId: "mug", Limit: 1})
+	if err != nil || len(resp.Results) != 1 {
+		t.Errorf("with limit 1 got %v, %v; want one product", resp.GetResults(), err)
+	}
+
+	for _, tc := range []struct {
+		id   string
+		code codes.Code
+	}{
+		{"", codes.InvalidArgument},
+		{"teapot", codes.NotFound},
+	} {
+		_, err := svc.GetSimilarProducts(context.Background(), &pb.GetSimilarProductsRequest{ProductId: tc.id})
+		if status.Code(err) != tc.code {
+			t.Errorf("GetSimilarProducts(%q) = %v, want %s", tc.id, err, tc.code)
+		}
+	}
+
+	// A limit above the maximum is clamped to it, not reset to the default.
+	var many []*pb.Product
+	for i := 0; i <= maxSemanticSearchResults+1; i++ {
+		many = append(many, &pb.Product{Id: fmt.Sprintf("p%d", i), Categories: []string{"kitchen"}})
+	}
+	svc.catalog.Products = many
+	resp, err = svc.GetSimilarProducts(context.Background(), &pb.GetSimilarProductsRequest{ProductId: "p0", Limit: 1000})
+	if err != nil || len(resp.Results) != maxSemanticSearchResults {
+		t.Errorf("with limit 1000 got %d products, %v; want %d", len(resp.GetResults()), err, maxSemanticSearchResults)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+const (
+	// minCorrectedWordLength is the length below which query words are left
+	// as typed: short words have too few trigrams to match reliably.
+	minCorrectedWordLength = 3
+	// maxCorrectedWords bounds the queries that get a suggestion; longer
+	// ones are unlikely to be a misspelled product or category.
+	maxCorrectedWords = 10
+	// spellingThreshold is the least trigram similarity of a correction,
+	// the pg_trgm default for the % operator.
+	spellingThreshold = 0.3
+)
+
+// correctionQuery finds the closest word of the product names and categories
+// to each of the query words in $1, by trigram similarity. A word that is in
+// the vocabulary matches itself. Words without a close match have no row.
+func correctionQuery() string {
+	return `
+	WITH vocabulary AS (
+		SELECT DISTINCT w
+		FROM ` + productsTable + `, regexp_split_to_table(lower(name || ' ' || categories), '[^a-z0-9]+') w
+		WHERE length(w) >= 3 AND status = 'active'
+	)
+	SELECT q.ord, m.w
+	FROM unnest($1::text[]) WITH ORDINALITY q(word, ord)
+	CROSS JOIN LATERAL (
+		SELECT w FROM vocabulary
+		WHERE w % q.word
+		ORDER BY similarity(w, q.word) DESC, w
+		LIMIT 1
+	) m`
+}
+
+// didYouMean suggests a respelling of a query that found nothing, made of
+// the closest product name and category words to the query words. It
+// returns "" when keyword search matches the query as typed or no word has a
+// better spelling.
+func (p *productCatalog) didYouMean(ctx context.Context, query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 || len(words) > maxCorrectedWords {
+		return ""
+	}
+	if resp, err := p.SearchProducts(ctx, &pb.SearchProductsRequest{Query: query}); err != nil || len(resp.Results) > 0 {
+		return ""
+	}
+
+	var corrected []string
+	if dbReady.Load() && trigramsReady.Load() {
+		var err error
+		if corrected, err = correctFromDB(ctx, words); err != nil {
+			log.Warnf("Spelling correction query failed, falling back to the catalog: %v", err)
+		}
+	}
+	if corrected == nil {
+		corrected = p.correctFromCatalog(words)
+	}
+	suggestion := strings.Join(corrected, " ")
+	if suggestion == strings.Join(words, " ") {
+		return ""
+	}
+	return suggestion
+}
+
+// correctFromDB corrects words with correctionQuery.
+func correctFromDB(ctx context.Context, words []string) ([]string, error) {
+	var lookup []string
+	for _, w := range words {
+		if len(w) >= minCorrectedWordLength {
+			lookup = append(lookup, w)
+		}
+	}
+	closest := map[string]string{}
+	if len(lookup) > 0 {
+		rows, err := readDB().QueryContext(ctx, correctionQuery(), lookup)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var ord int
+			var w string
+			if err := rows.Scan(&ord, &w); err != nil {
+				return nil, err
+			}
+			closest[lookup[ord-1]] = w
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	corrected := make([]string, len(words))
+	for i, w := range words {
+		corrected[i] = w
+		if c, ok := closest[w]; ok {
+			corrected[i] = c
+		}
+	}
+	return corrected, nil
+}
+
+// correctFromCatalog corrects words against the names and categories of the
+// loaded catalog, scoring words the way pg_trgm does.
+func (p *productCatalog) correctFromCatalog(words []string) []string {
+	vocabulary := map[string]bool{}
+	split := func(s string) {
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+		}) {
+			if len(w) >= minCorrectedWordLength {
+				vocabulary[w] = true
+			}
+		}
+	}
+	for _, product := range activeProducts(p.parseCatalog(), false) {
+		split(product.Name)
+		for _, c := range product.Categories {
+			split(c)
+		}
+	}
+	sorted := make([]string, 0, len(vocabulary))
+	for w := range vocabulary {
+		sorted = append(sorted, w)
+	}
+	sort.Strings(sorted)
+
+	corrected := make([]string, len(words))
+	for i, w := range words {
+		corrected[i] = w
+		if len(w) < minCorrectedWordLength || vocabulary[w] {
+			continue
+		}
+		best := 0.0
+		for _, v := range sorted {
+			if s := trigramSimilarity(w, v); s >= spellingThreshold && s > best {
+				best, corrected[i] = s, v
+			}
+		}
+	}
+	return corrected
+}
+
+// trigrams returns the trigrams of a lowercase word padded as pg_trgm pads
+// it: two spaces before and one after.
+func trigrams(word string) map[string]bool {
+	r := []rune("  " + word + " ")
+	t := make(map[string]bool, len(r))
+	for i := 0; i+3 <= len(r); i++ {
+		t[string(r[i:i+3])] = true
+	}
+	return t
+}
+
+// trigramSimilarity is the share of the trigrams of a and b that both have,
+// like pg_trgm's similarity().
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
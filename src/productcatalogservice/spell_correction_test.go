@@ -0,0 +1,61 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestSemanticSearchSuggestsSpelling(t *testing.T) {
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{
+		{Id: "p1", Name: "Sunglasses", Categories: []string{"accessories"}},
+		{Id: "p2", Name: "Scented Candle", Categories: []string{"home decor"}},
+		{Id: "p3", Name: "Mug", Categories: []string{"kitchen"}},
+	}}}
+
+	for query, want := range map[string]string{
+		"sunglases":            "sunglasses",
+		"Blue SUNGLASES!":      "blue sunglasses",
+		"scnted candel for me": "scented candle for me",
+		"kitchn":               "kitchen",
+		"candle":               "", // keyword search matches
+		"bicycle":              "", // nothing close
+		"a":                    "",
+	} {
+		resp, err := svc.SemanticSearchProducts(context.Background(), &pb.SemanticSearchRequest{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.SuggestedQuery != want {
+			t.Errorf("SemanticSearchProducts(%q) suggested %q, want %q", query, resp.SuggestedQuery, want)
+		}
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	if got := trigramSimilarity("candle", "candle"); got != 1 {
+		t.Errorf("similarity of equal words = %v, want 1", got)
+	}
+	// "  c", " ca", "cat", "at " and "  c", " ca", "car", "ar " share 2 of 6.
+	if got, want := trigramSimilarity("cat", "car"), 2.0/6; got != want {
+		t.Errorf("similarity(cat, car) = %v, want %v", got, want)
+	}
+	if got := trigramSimilarity("mug", "lamp"); got != 0 {
+		t.Errorf("similarity(mug, lamp) = %v, want 0", got)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// readinessService is the health check service name readiness probes ask
+	// for. It reports NOT_SERVING while startup dependencies are awaited.
+	readinessService = "readiness"
+
+	defaultStartupWindow  = 60 * time.Second
+	initialStartupBackoff = 500 * time.Millisecond
+	maxStartupBackoff     = 10 * time.Second
+)
+
+var (
+	// dbReady is set once db is connected and semantic search can use it.
+	dbReady atomic.Bool
+
+	// startupComplete is set once awaitDependencies has finished.
+	startupComplete atomic.Bool
+)
+
+// startupWindowFromEnv returns how long to keep retrying dependencies at
+// startup, read from STARTUP_WAIT_TIMEOUT (default 60s).
+func startupWindowFromEnv() (time.Duration, error) {
+	s := os.Getenv("STARTUP_WAIT_TIMEOUT")
+	if s == "" {
+		return defaultStartupWindow, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("failed to parse STARTUP_WAIT_TIMEOUT (%s) as a non-negative time.Duration", s)
+	}
+	return v, nil
+}
+
+// retryWithBackoff calls fn until it succeeds or window elapses, sleeping
+// with exponential backoff between attempts. It returns the last error.
+func retryWithBackoff(name string, window time.Duration, fn func() error) error {
+	deadline := time.Now().Add(window)
+	backoff := initialStartupBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				log.Infof("%s became available after %d attempts", name, attempt)
+			}
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("%s unavailable after %d attempts: %v", name, attempt, err)
+		}
+		log.Warnf("%s not available yet (attempt %d), retrying in %v: %v", name, attempt, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxStartupBackoff {
+			backoff = maxStartupBackoff
+		}
+	}
+}
+
+// checkEmbeddingService probes the embedding service health endpoint.
+func checkEmbeddingService() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, embeddingServiceURL()+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("embedding service health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// awaitDependencies waits up to window for the semantic search database and
+// the embedding service, then marks the service ready. Keyword search works
+// throughout; semantic search turns on as soon as the database connects, and
+// stays on the keyword fallback if it never does.
+func awaitDependencies(window time.Duration) {
+	defer startupComplete.Store(true)
+
+	semantic := os.Getenv("CLOUDSQL_HOST") != ""
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := retryWithBackoff("semantic search database", window, initDatabase); err != nil {
+			log.Warnf("Failed to initialize database for semantic search: %v", err)
+			log.Info("Semantic search will be disabled, falling back to regular search")
+			return
+		}
+		if db == nil {
+			return
+		}
+		dbReady.Store(true)
+		// Reread the catalog read at startup with the products table's
+		// statuses, variants and categories.
+		requestCatalogReload()
+		log.Info("Semantic search enabled with automatic embedding generation")
+		if os.Getenv("EMBEDDING_BACKFILL") == "1" {
+			// The backfill can take as long as embedding the whole catalog,
+			// so it runs without holding up readiness; products it has not
+			// reached yet are found by keyword search meanwhile.
+			go func() {
+				if err := populateEmbeddings(); err != nil {
+					log.Warnf("Embedding backfill failed: %v", err)
+				}
+				embedProductPictures(context.Background())
+			}()
+			if embeddingReconcileInterval > 0 {
+				go reconcileEmbeddings(context.Background(), embeddingReconcileInterval)
+			}
+		}
+	}()
+	if semantic && embeddingMode() == embeddingModeService {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := retryWithBackoff("embedding service", window, checkEmbeddingService); err != nil {
+				log.Warnf("Embedding service not reachable, semantic search will fall back per request: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	log.Info("Startup dependency wait finished")
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestRetryWithBackoff(t *testing.T) {
+	calls := 0
+	err := retryWithBackoff("flaky dependency", defaultStartupWindow, func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected success after retry, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls: got %d, want 2", calls)
+	}
+
+	calls = 0
+	err = retryWithBackoff("missing dependency", 0, func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if err == nil {
+		t.Fatal("expected error once the window is exhausted")
+	}
+	if calls != 1 {
+		t.Errorf("calls with zero window: got %d, want 1", calls)
+	}
+}
+
+func TestReadinessWaitsForStartup(t *testing.T) {
+	defer startupComplete.Store(startupComplete.Load())
+	p := &productCatalog{}
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := p.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+
+	startupComplete.Store(false)
+	if got := check(readinessService); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("readiness during startup: got %s, want NOT_SERVING", got)
+	}
+	if got := check(""); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("liveness during startup: got %s, want SERVING", got)
+	}
+
+	startupComplete.Store(true)
+	if got := check(readinessService); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("readiness after startup: got %s, want SERVING", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultSuggestions is how many suggestions SuggestProducts returns when
+	// the request has no limit.
+	defaultSuggestions = 8
+	maxSuggestions     = 50
+)
+
+// suggestSchemaSQL enables trigram matching of product names and categories,
+// and indexes the lowercased names and descriptions for the LIKE and
+// trigram operators of suggestions and keyword search, which would
+// otherwise read the whole table. pg_trgm needs a privileged role to
+// install, so it is kept apart from productsSchemaSQL: without it
+// suggestions are prefix matches only.
+func suggestSchemaSQL() string {
+	return `
+	CREATE EXTENSION IF NOT EXISTS pg_trgm;
+	CREATE INDEX IF NOT EXISTS products_name_trgm ON ` + productsTable + ` USING gin (lower(name) gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS products_description_trgm ON ` + productsTable + ` USING gin (lower(description) gin_trgm_ops);`
+}
+
+// trigramsReady is set once suggestSchemaSQL has been applied.
+var trigramsReady atomic.Bool
+
+// ensureSuggestSchema applies suggestSchemaSQL.
+func ensureSuggestSchema(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, suggestSchemaSQL()); err != nil {
+		return fmt.Errorf("failed to enable trigram matching: %v", err)
+	}
+	trigramsReady.Store(true)
+	return nil
+}
+
+// suggestQuery ranks product names and categories against the typed text:
+// $1 is the lowercased text, $2 and $3 LIKE patterns for a prefix of the
+// whole value and of any word in it. Prefix matches rank first, then close
+// spellings by trigram similarity. The candidates are all names and
+// categories, which is cheap at catalog sizes.
+func suggestQuery() string {
+	return `
+	WITH candidates AS (
+		SELECT name AS text, 0 AS kind, id AS product_id, lower(name) AS value
+		FROM ` + productsTable + `
+		WHERE status = 'active'
+		UNION
+		SELECT trim(c), 1, '', lower(trim(c))
+		FROM ` + productsTable + `, unnest(string_to_array(trim(both '{}' from categories), ',')) c
+		WHERE trim(c) <> '' AND status = 'active'
+	)
+	SELECT text, kind, product_id
+	FROM candidates
+	WHERE value LIKE $2 OR value LIKE $3 OR value % $1
+	ORDER BY value LIKE $2 DESC, value LIKE $3 DESC, similarity(value, $1) DESC, text
+	LIMIT $4`
+}
+
+// SuggestProducts completes a partially typed search query with product
+// names and categories. It is meant to run on every keystroke, so it never
+// embeds the query. Without the database, or without trigram matching, it
+// returns prefix matches from the loaded catalog.
+func (p *productCatalog) SuggestProducts(ctx context.Context, req *pb.SuggestProductsRequest) (*pb.SuggestProductsResponse, error) {
+	text := strings.ToLower(strings.TrimSpace(req.GetQuery()))
+	if text == "" {
+		return &pb.SuggestProductsResponse{}, nil
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultSuggestions
+	}
+	limit = min(limit, maxSuggestions)
+
+	if !dbReady.Load() || !trigramsReady.Load() {
+		return p.suggestFromCatalog(text, limit), nil
+	}
+	pattern := escapeLike(text)
+	rows, err := readDB().QueryContext(ctx, suggestQuery(), text, pattern+"%", "% "+pattern+"%", limit)
+	if err != nil {
+		log.Warnf("Suggestion query failed, falling back to the catalog: %v", err)
+		return p.suggestFromCatalog(text, limit), nil
+	}
+	defer rows.Close()
+
+	resp := &pb.SuggestProductsResponse{}
+	for rows.Next() {
+		s := &pb.Suggestion{}
+		var kind int32
+		if err := rows.Scan(&s.Text, &kind, &s.ProductId); err != nil {
+			return nil, status.Errorf(codes.Internal, "database error: %v", err)
+		}
+		s.Kind = pb.Suggestion_Kind(kind)
+		resp.Suggestions = append(resp.Suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "database error: %v", err)
+	}
+	return resp, nil
+}
+
+// suggestFromCatalog matches text against the names and categories of the
+// loaded catalog: prefixes of the whole value first, then of any word in it,
+// each alphabetically.
+func (p *productCatalog) suggestFromCatalog(text string, limit int) *pb.SuggestProductsResponse {
+	type match struct {
+		suggestion  *pb.Suggestion
+		wholePrefix bool
+	}
+	var matches []match
+	seen := map[string]bool{}
+	add := func(value string, s *pb.Suggestion) {
+		lower := strings.ToLower(value)
+		switch {
+		case strings.HasPrefix(lower, text):
+			matches = append(matches, match{s, true})
+		case strings.Contains(lower, " "+text):
+			matches = append(matches, match{s, false})
+		}
+	}
+	for _, product := range activeProducts(p.parseCatalog(), false) {
+		add(product.Name, &pb.Suggestion{Text: product.Name, Kind: pb.Suggestion_PRODUCT, ProductId: product.Id})
+		for _, c := range product.Categories {
+			c = strings.TrimSpace(c)
+			if key := strings.ToLower(c); c != "" && !seen[key] {
+				seen[key] = true
+				add(c, &pb.Suggestion{Text: c, Kind: pb.Suggestion_CATEGORY})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].wholePrefix != matches[j].wholePrefix {
+			return matches[i].wholePrefix
+		}
+		return matches[i].suggestion.Text < matches[j].suggestion.Text
+	})
+
+	resp := &pb.SuggestProductsResponse{}
+	for _, m := range matches[:min(limit, len(matches))] {
+		resp.Suggestions = append(resp.Suggestions, m.suggestion)
+	}
+	return resp
+}
+
+// escapeLike escapes the LIKE wildcards in s, so user text matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
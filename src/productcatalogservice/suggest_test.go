@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/productcatalogservice/genproto"
+)
+
+func TestSuggestProductsFromCatalog(t *testing.T) {
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: []*pb.Product{
+		{Id: "p1", Name: "Candle Holder", Categories: []string{"decor", "home"}},
+		{Id: "p2", Name: "Scented Candle", Categories: []string{"Home"}},
+		{Id: "p3", Name: "Mug", Categories: []string{"kitchen"}},
+		{Id: "p4", Name: "Homemade Jam", Categories: []string{"kitchen"}},
+	}}}
+
+	for _, tc := range []struct {
+		query string
+		limit int32
+		want  []string
+	}{
+		// Whole-value prefixes first, then word prefixes.
+		{"cand", 0, []string{"Candle Holder (p1)", "Scented Candle (p2)"}},
+		// Each category is suggested once, whatever its case.
+		{"HOM", 0, []string{"Homemade Jam (p4)", "home"}},
+		{"k", 1, []string{"kitchen"}},
+		{"  ", 0, nil},
+		{"zzz", 0, nil},
+	} {
+		resp, err := svc.SuggestProducts(context.Background(), &pb.SuggestProductsRequest{Query: tc.query, Limit: tc.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range resp.Suggestions {
+			if s.Kind == pb.Suggestion_PRODUCT {
+				got = append(got, fmt.Sprintf("%s (%s)", s.Text, s.ProductId))
+			} else {
+				got = append(got, s.Text)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("SuggestProducts(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestSuggestProductsClampsLimit(t *testing.T) {
+	var products []*pb.Product
+	for i := 0; i <= maxSuggestions; i++ {
+		products = append(products, &pb.Product{Id: fmt.Sprintf("p%d", i), Name: fmt.Sprintf("Mug %d", i)})
+	}
+	svc := &productCatalog{catalog: pb.ListProductsResponse{Products: products}}
+
+	// A limit above the maximum is clamped to it, not reset to the default.
+	resp, err := svc.SuggestProducts(context.Background(), &pb.SuggestProductsRequest{Query: "mug", Limit: 1000})
+	if err != nil || len(resp.Suggestions) != maxSuggestions {
+		t.Errorf("with limit 1000 got %d suggestions, %v; want %d", len(resp.GetSuggestions()), err, maxSuggestions)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got, want := escapeLike(`50%_off\`), `50\%\_off\\`; got != want {
+		t.Errorf("escapeLike = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+-- Schema of the Cloud SQL products database, mirroring
+-- scripts/setup_cloudsql_private_complete.sh. Used by the integration tests.
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE IF NOT EXISTS products (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    picture TEXT,
+    price_usd_currency_code VARCHAR(3),
+    price_usd_units INTEGER,
+    price_usd_nanos INTEGER,
+    categories TEXT,
+    target_tags TEXT[],
+    use_context TEXT[],
+    description_embedding VECTOR(768),
+    category_embedding VECTOR(768),
+    combined_embedding VECTOR(768),
+    target_tags_embedding VECTOR(768),
+    use_context_embedding VECTOR(768)
+);
@@ -0,0 +1,259 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	searchModeExact       = "exact"
+	searchModeApproximate = "approximate"
+
+	// hnswIndexName is the HNSW index on products.combined_embedding.
+	hnswIndexName = "products_combined_embedding_hnsw"
+
+	// Quantizations of the indexed combined embedding. The table keeps the
+	// full-precision vectors, which rank the candidates the index returns.
+	quantizeNone    = "none"
+	quantizeHalfvec = "halfvec"
+	quantizeBinary  = "binary"
+)
+
+// vectorIndexSettings choose between exact semantic search, which scores
+// every product, and approximate search, which takes the nearest candidates
+// by combined embedding from an HNSW index and scores only those.
+type vectorIndexSettings struct {
+	approximate bool
+	// m and efConstruction are the HNSW build parameters.
+	m, efConstruction int
+	// efSearch is the HNSW candidate list size per index scan, raised to
+	// candidates when lower.
+	efSearch int
+	// candidates is how many products the index returns for scoring.
+	candidates int
+	// quantization is how the index stores the combined embedding: as is
+	// (quantizeNone), as half-precision floats, or as one bit per dimension.
+	quantization string
+}
+
+// maxHNSWEfSearch is the largest hnsw.ef_search pgvector accepts. Searches
+// raise ef_search to the candidate count, so it bounds that too.
+const maxHNSWEfSearch = 1000
+
+func (s vectorIndexSettings) String() string {
+	if !s.approximate {
+		return searchModeExact
+	}
+	return fmt.Sprintf("%s (m=%d, ef_construction=%d, ef_search=%d, candidates=%d, quantization=%s)",
+		searchModeApproximate, s.m, s.efConstruction, s.efSearch, s.candidates, s.quantization)
+}
+
+// indexName returns the name of the HNSW index for s.quantization. Each
+// quantization has its own index, so switching builds a new one.
+func (s vectorIndexSettings) indexName() string {
+	switch s.quantization {
+	case quantizeHalfvec:
+		return "products_combined_embedding_halfvec_hnsw"
+	case quantizeBinary:
+		return "products_combined_embedding_bit_hnsw"
+	default:
+		return hnswIndexName
+	}
+}
+
+// indexedEmbedding returns the expression the HNSW index is built on for the
+// combined embedding col, the operator class of the index and the distance
+// operator it serves. The query embedding goes through the same expression.
+func (s vectorIndexSettings) indexedEmbedding(col string) (expr, opclass, op string) {
+	switch s.quantization {
+	case quantizeHalfvec:
+		return fmt.Sprintf("%s::halfvec(%d)", col, embeddingDimensions), "halfvec_cosine_ops", "<=>"
+	case quantizeBinary:
+		return fmt.Sprintf("binary_quantize(%s)::bit(%d)", col, embeddingDimensions), "bit_hamming_ops", "<~>"
+	default:
+		return col, "vector_cosine_ops", "<=>"
+	}
+}
+
+// vectorIndex holds the settings in effect, set from the environment at
+// startup.
+var vectorIndex = vectorIndexSettings{m: 16, efConstruction: 64, efSearch: 40, candidates: 100, quantization: quantizeNone}
+
+// vectorIndexSettingsFromEnv builds vectorIndexSettings from the environment:
+//
+//	SEMANTIC_SEARCH_MODE           exact (default) or approximate
+//	SEMANTIC_HNSW_M                HNSW links per node (default 16)
+//	SEMANTIC_HNSW_EF_CONSTRUCTION  HNSW build candidate list size (default 64)
+//	SEMANTIC_HNSW_EF_SEARCH        HNSW search candidate list size (default 40)
+//	SEMANTIC_ANN_CANDIDATES        products taken from the index per search (default 100)
+//	SEMANTIC_VECTOR_QUANTIZATION   none (default), halfvec or binary; approximate mode only
+func vectorIndexSettingsFromEnv() (vectorIndexSettings, error) {
+	s := vectorIndex
+	switch mode := os.Getenv("SEMANTIC_SEARCH_MODE"); mode {
+	case "", searchModeExact:
+	case searchModeApproximate:
+		s.approximate = true
+	default:
+		return vectorIndexSettings{}, fmt.Errorf("unknown SEMANTIC_SEARCH_MODE %q (want exact or approximate)", mode)
+	}
+	switch q := os.Getenv("SEMANTIC_VECTOR_QUANTIZATION"); q {
+	case "", quantizeNone:
+	case quantizeHalfvec, quantizeBinary:
+		if !s.approximate {
+			return vectorIndexSettings{}, fmt.Errorf("SEMANTIC_VECTOR_QUANTIZATION=%s needs SEMANTIC_SEARCH_MODE=approximate", q)
+		}
+		s.quantization = q
+	default:
+		return vectorIndexSettings{}, fmt.Errorf("unknown SEMANTIC_VECTOR_QUANTIZATION %q (want none, halfvec or binary)", q)
+	}
+	// The ranges are the ones pgvector accepts.
+	vars := []struct {
+		env      string
+		target   *int
+		min, max int
+	}{
+		{"SEMANTIC_HNSW_M", &s.m, 2, 100},
+		{"SEMANTIC_HNSW_EF_CONSTRUCTION", &s.efConstruction, 4, 1000},
+		{"SEMANTIC_HNSW_EF_SEARCH", &s.efSearch, 1, maxHNSWEfSearch},
+		{"SEMANTIC_ANN_CANDIDATES", &s.candidates, 1, maxHNSWEfSearch},
+	}
+	for _, v := range vars {
+		str := os.Getenv(v.env)
+		if str == "" {
+			continue
+		}
+		n, err := strconv.Atoi(str)
+		if err != nil || n < v.min || n > v.max {
+			return vectorIndexSettings{}, fmt.Errorf("failed to parse %s (%s) as an integer from %d to %d", v.env, str, v.min, v.max)
+		}
+		*v.target = n
+	}
+	if s.efConstruction < 2*s.m {
+		return vectorIndexSettings{}, fmt.Errorf("SEMANTIC_HNSW_EF_CONSTRUCTION (%d) must be at least twice SEMANTIC_HNSW_M (%d)", s.efConstruction, s.m)
+	}
+	return s, nil
+}
+
+// ensureVectorIndex builds the HNSW index for s.quantization if it does not
+// exist yet, or rebuilds it if a failed build left it invalid. The build
+// runs CONCURRENTLY so writes continue meanwhile. Only one replica builds it:
+// the others see the advisory lock taken and leave it to that replica.
+func ensureVectorIndex(ctx context.Context, s vectorIndexSettings) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	name := s.indexName()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to take index build lock: %v", err)
+	}
+	if !locked {
+		log.Infof("Another replica is building %s", name)
+		return nil
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, name)
+
+	// CREATE INDEX CONCURRENTLY IF NOT EXISTS skips an index a failed build
+	// left INVALID, which queries never use, so drop that one first.
+	var valid bool
+	var qualified string
+	err = conn.QueryRowContext(ctx, `
+		SELECT i.indisvalid, format('%I.%I', n.nspname, c.relname)
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relname = $1 AND i.indrelid = $2::regclass`, name, productsTable).Scan(&valid, &qualified)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("failed to look up %s: %v", name, err)
+	case valid:
+		return nil
+	default:
+		log.Warnf("Dropping %s, left invalid by a failed build", qualified)
+		if _, err := conn.ExecContext(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+qualified); err != nil {
+			return fmt.Errorf("failed to drop invalid %s: %v", name, err)
+		}
+	}
+
+	// CREATE INDEX takes no parameters; the values are validated integers.
+	expr, opclass, _ := s.indexedEmbedding("combined_embedding")
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON `+productsTable+`
+		USING hnsw ((%s) %s)
+		WITH (m = %d, ef_construction = %d)`, name, expr, opclass, s.m, s.efConstruction))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", name, err)
+	}
+	return nil
+}
+
+// candidateSource returns the FROM item of the semantic search query. In
+// exact mode that is the products table. In approximate mode it is the
+// nearest s.candidates products matching filterSQL by combined embedding,
+// quantized as the HNSW index that serves them; the candidate limit is
+// appended to args. The caller scores the candidates at full precision.
+// The returned filter SQL is what the caller still has to apply.
+func (s vectorIndexSettings) candidateSource(filterSQL string, args []interface{}) (from, remainingFilterSQL string, _ []interface{}) {
+	if !s.approximate {
+		return productsTable + " p", filterSQL, args
+	}
+	args = append(args, s.candidates)
+	indexed, _, op := s.indexedEmbedding("p.combined_embedding")
+	query, _, _ := s.indexedEmbedding("$1")
+	from = fmt.Sprintf(`(
+				SELECT * FROM `+productsTable+` p
+				WHERE p.combined_embedding IS NOT NULL%s
+				ORDER BY %s %s %s
+				LIMIT $%d
+			) p`, filterSQL, indexed, op, query, len(args))
+	return from, "", args
+}
+
+// query runs a semantic search query on conn. In approximate mode it runs in
+// a read-only transaction that sets hnsw.ef_search for the index scan. Call
+// done once the rows have been read.
+func (s vectorIndexSettings) query(ctx context.Context, conn *sql.DB, query string, args ...interface{}) (rows *sql.Rows, done func(), err error) {
+	if !s.approximate {
+		rows, err := conn.QueryContext(ctx, query, args...)
+		return rows, func() {}, err
+	}
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	// An HNSW scan returns at most ef_search rows, so it must cover the
+	// candidates. SET takes no parameters; both are validated integers.
+	efSearch := max(s.efSearch, s.candidates)
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", efSearch)); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	rows, err = tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return rows, func() { rows.Close(); tx.Rollback() }, nil
+}
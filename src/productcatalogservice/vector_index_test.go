@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVectorIndexSettingsFromEnv(t *testing.T) {
+	t.Setenv("SEMANTIC_SEARCH_MODE", "")
+	got, err := vectorIndexSettingsFromEnv()
+	if err != nil || got.approximate {
+		t.Fatalf("default: got %v, %v; want exact", got, err)
+	}
+
+	t.Setenv("SEMANTIC_SEARCH_MODE", "approximate")
+	t.Setenv("SEMANTIC_HNSW_EF_SEARCH", "200")
+	t.Setenv("SEMANTIC_ANN_CANDIDATES", "500")
+	got, err = vectorIndexSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vectorIndexSettings{approximate: true, m: 16, efConstruction: 64, efSearch: 200, candidates: 500, quantization: quantizeNone}
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	t.Setenv("SEMANTIC_VECTOR_QUANTIZATION", "binary")
+	got, err = vectorIndexSettingsFromEnv()
+	if err != nil || got.quantization != quantizeBinary {
+		t.Errorf("binary: got %v, %v", got, err)
+	}
+	t.Setenv("SEMANTIC_VECTOR_QUANTIZATION", "")
+
+	for env, value := range map[string]string{
+		"SEMANTIC_SEARCH_MODE":          "fuzzy",
+		"SEMANTIC_HNSW_M":               "0",
+		"SEMANTIC_HNSW_EF_CONSTRUCTION": "many",
+		"SEMANTIC_HNSW_EF_SEARCH":       "1001",
+		"SEMANTIC_ANN_CANDIDATES":       "5000",
+		"SEMANTIC_VECTOR_QUANTIZATION":  "int8",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := vectorIndexSettingsFromEnv(); err == nil {
+				t.Errorf("%s=%q: expected an error", env, value)
+			}
+		})
+	}
+
+	// ef_construction must be at least twice m.
+	t.Setenv("SEMANTIC_HNSW_M", "64")
+	if _, err := vectorIndexSettingsFromEnv(); err == nil {
+		t.Error("m=64, ef_construction=64: expected an error")
+	}
+}
+
+func TestCandidateSource(t *testing.T) {
+	args := []interface{}{"vec", 10, 1.0, 0.0, 0.0, 0.0, "shoes"}
+	filterSQL := " AND p.categories ILIKE $7"
+
+	from, remaining, got := vectorIndexSettings{}.candidateSource(filterSQL, args)
+	if from != "products p" || remaining != filterSQL || len(got) != len(args) {
+		t.Errorf("exact: got %q, %q, %d args", from, remaining, len(got))
+	}
+
+	s := vectorIndexSettings{approximate: true, candidates: 100}
+	from, remaining, got = s.candidateSource(filterSQL, args)
+	if remaining != "" {
+		t.Errorf("approximate: filters left to the caller: %q", remaining)
+	}
+	if len(got) != len(args)+1 || got[len(args)] != 100 {
+		t.Errorf("approximate: got args %v, want the candidate limit appended", got)
+	}
+	for _, want := range []string{filterSQL, "ORDER BY p.combined_embedding <=> $1", "LIMIT $8"} {
+		if !strings.Contains(from, want) {
+			t.Errorf("approximate: %q does not contain %q", from, want)
+		}
+	}
+}
+
+func TestQuantizedVectorIndexNeedsApproximateMode(t *testing.T) {
+	t.Setenv("SEMANTIC_SEARCH_MODE", "exact")
+	t.Setenv("SEMANTIC_VECTOR_QUANTIZATION", "halfvec")
+	if _, err := vectorIndexSettingsFromEnv(); err == nil {
+		t.Error("halfvec quantization in exact mode: expected an error")
+	}
+}
+
+func TestQuantizedCandidateSource(t *testing.T) {
+	for _, tc := range []struct {
+		quantization, index, order string
+	}{
+		{quantizeNone, hnswIndexName, "ORDER BY p.combined_embedding <=> $1\n"},
+		{quantizeHalfvec, "products_combined_embedding_halfvec_hnsw",
+			"ORDER BY p.combined_embedding::halfvec(768) <=> $1::halfvec(768)"},
+		{quantizeBinary, "products_combined_embedding_bit_hnsw",
+			"ORDER BY binary_quantize(p.combined_embedding)::bit(768) <~> binary_quantize($1)::bit(768)"},
+	} {
+		s := vectorIndexSettings{approximate: true, candidates: 100, quantization: tc.quantization}
+		if got := s.indexName(); got != tc.index {
+			t.Errorf("%s: index %q, want %q", tc.quantization, got, tc.index)
+		}
+		from, _, _ := s.candidateSource("", []interface{}{"vec"})
+		if !strings.Contains(from, tc.order) {
+			t.Errorf("%s: %q does not contain %q", tc.quantization, from, tc.order)
+		}
+	}
+}
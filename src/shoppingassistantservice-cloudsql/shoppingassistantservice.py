@@ -15,6 +15,7 @@
 # limitations under the License.
 
 import os
+import sys
 import psycopg2
 from google.cloud import secretmanager_v1
 from urllib.parse import unquote
@@ -32,8 +33,9 @@ if GOOGLE_API_KEY:
 logging.basicConfig(level=logging.INFO)
 logger = logging.getLogger(__name__)
 
-# Configuration from environment variables
-PROJECT_ID = os.environ.get("PROJECT_ID", "gke-hack-471804")
+# Configuration from environment variables. PROJECT_ID, where the database
+# password secret is read from, has no default.
+PROJECT_ID = os.environ.get("PROJECT_ID", "")
 REGION = os.environ.get("REGION", "us-central1")
 CLOUDSQL_HOST = os.environ.get("CLOUDSQL_HOST", "10.103.0.3")
 CLOUDSQL_DATABASE_NAME = os.environ.get("CLOUDSQL_DATABASE_NAME", "products")
@@ -262,6 +264,8 @@ If no products seem relevant to the customer's request, please say so instead of
     return app
 
 if __name__ == "__main__":
+    if not PROJECT_ID:
+        sys.exit("PROJECT_ID is required")
     # Create an instance of flask server when called directly
     app = create_app()
     port = int(os.environ.get('PORT', 8080))